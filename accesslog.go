@@ -0,0 +1,100 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/logging"
+)
+
+// AccessLogConfig configures which Allow decisions are written to the access log.
+type AccessLogConfig struct {
+	// SampleRate logs 1 in every SampleRate decisions. Values below 1 log every decision.
+	SampleRate int
+	// NamespaceSampleRates overrides SampleRate for specific namespaces. A negative rate disables
+	// logging for the namespace.
+	NamespaceSampleRates map[string]int
+}
+
+// accessLogEntry is a single line of the access log.
+type accessLogEntry struct {
+	Time       string `json:"time"`
+	Namespace  string `json:"namespace"`
+	Bucket     string `json:"bucket"`
+	Tokens     int64  `json:"tokens"`
+	Outcome    string `json:"outcome"`
+	WaitMillis int64  `json:"waitMillis"`
+	Caller     string `json:"caller,omitempty"`
+}
+
+// accessLog writes sampled Allow decisions as JSON, one per line.
+type accessLog struct {
+	w      io.Writer
+	cfg    AccessLogConfig
+	random func(int) int
+	sync.Mutex
+}
+
+func newAccessLog(w io.Writer, cfg AccessLogConfig) *accessLog {
+	return &accessLog{w: w, cfg: cfg, random: rand.Intn}
+}
+
+func (l *accessLog) sampled(namespace string) bool {
+	rate, ok := l.cfg.NamespaceSampleRates[namespace]
+	if !ok {
+		rate = l.cfg.SampleRate
+	}
+
+	if rate < 0 {
+		return false
+	}
+
+	return rate <= 1 || l.random(rate) == 0
+}
+
+func (l *accessLog) log(ctx context.Context, namespace, name string, tokens int64, wait time.Duration, err error) {
+	if !l.sampled(namespace) {
+		return
+	}
+
+	b, e := json.Marshal(&accessLogEntry{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Namespace:  namespace,
+		Bucket:     name,
+		Tokens:     tokens,
+		Outcome:    outcome(err),
+		WaitMillis: wait.Nanoseconds() / int64(time.Millisecond),
+		Caller:     CallerFromContext(ctx)})
+
+	if e != nil {
+		logging.Printf("Unable to marshal access log entry: %v", e)
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if _, e := l.w.Write(append(b, '\n')); e != nil {
+		logging.Printf("Unable to write access log entry: %v", e)
+	}
+}
+
+// outcome describes the result of an Allow call for the access log.
+func outcome(err error) string {
+	if err == nil {
+		return "OK"
+	}
+
+	if qsErr, ok := err.(QuotaServiceError); ok {
+		return qsErr.Reason.String()
+	}
+
+	return "ERROR"
+}
@@ -0,0 +1,79 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestAccessLogSampling(t *testing.T) {
+	l := newAccessLog(&bytes.Buffer{}, AccessLogConfig{
+		SampleRate:           10,
+		NamespaceSampleRates: map[string]int{"all": 1, "none": -1}})
+	l.random = func(n int) int {
+		if n != 10 {
+			t.Fatalf("Expected a 1 in 10 sample, got 1 in %v", n)
+		}
+
+		return 0
+	}
+
+	if !l.sampled("all") || !l.sampled("other") {
+		t.Fatal("Expected decisions to be sampled")
+	}
+
+	if l.sampled("none") {
+		t.Fatal("Expected logging to be disabled for namespace")
+	}
+
+	l.random = func(int) int { return 1 }
+	if l.sampled("other") || !l.sampled("all") {
+		t.Fatal("Expected only decisions in namespaces logging everything to be sampled")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("dummy")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	buf := &bytes.Buffer{}
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetAccessLog(buf, AccessLogConfig{})
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	ctx := WithCaller(context.Background(), "10.0.0.1:1234")
+	_, _, err = s.Allow(ctx, "dummy", "dummy", 2, 0, false)
+	helpers.CheckError(t, err)
+	_, _, _ = s.Allow(ctx, "dummy", "nonexistent", 1, 0, false)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 access log entries, got %v", lines)
+	}
+
+	entries := make([]*accessLogEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = &accessLogEntry{}
+		helpers.CheckError(t, json.Unmarshal([]byte(line), entries[i]))
+	}
+
+	if e := entries[0]; e.Namespace != "dummy" || e.Bucket != "dummy" || e.Tokens != 2 || e.Outcome != "OK" || e.Caller != "10.0.0.1:1234" {
+		t.Fatalf("Unexpected access log entry %+v", e)
+	}
+
+	if e := entries[1]; e.Bucket != "nonexistent" || e.Outcome != "NO_BUCKET" {
+		t.Fatalf("Unexpected access log entry %+v", e)
+	}
+}
@@ -0,0 +1,62 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/square/quotaservice/config"
+)
+
+type accessListsAPIHandler struct {
+	a Administrable
+}
+
+func newAccessListsAPIHandler(admin Administrable) (a *accessListsAPIHandler) {
+	return &accessListsAPIHandler{a: admin}
+}
+
+type accessLists struct {
+	DeniedBuckets  []string `json:"denied_buckets"`
+	AllowedBuckets []string `json:"allowed_buckets"`
+}
+
+// ServeHTTP reads or replaces a namespace's deny-list and allow-list, without having to update the
+// rest of the namespace's configuration.
+func (a *accessListsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ns := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/accesslists"), "/")
+	if ns == "" {
+		writeJSONError(w, &httpError{"No namespace specified", http.StatusBadRequest})
+		return
+	}
+
+	nsCfg := config.CloneConfig(a.a.Configs()).Namespaces[ns]
+	if nsCfg == nil {
+		writeJSONError(w, &httpError{"Unable to locate namespace " + ns, http.StatusNotFound})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, &accessLists{nsCfg.DeniedBuckets, nsCfg.AllowedBuckets})
+	case "PUT":
+		req := &accessLists{}
+		if err := unmarshalJSON(r.Body, req); err != nil {
+			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			return
+		}
+
+		nsCfg.DeniedBuckets = req.DeniedBuckets
+		nsCfg.AllowedBuckets = req.AllowedBuckets
+		if err := a.a.UpdateNamespace(nsCfg, getUsername(r)); err != nil {
+			writeJSONError(w, mutationError(err, http.StatusBadRequest))
+			return
+		}
+
+		writeJSON(w, req)
+	default:
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+	}
+}
@@ -0,0 +1,70 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/square/quotaservice/config"
+)
+
+func TestAccessListsGet(t *testing.T) {
+	a := NewMockAdministrable()
+	nsCfg := config.NewDefaultNamespaceConfig("test")
+	nsCfg.DeniedBuckets = []string{"abuser"}
+	nsCfg.AllowedBuckets = []string{"critical_*"}
+	a.Configs().Namespaces["test"] = nsCfg
+
+	response := &accessLists{}
+	doAccessListsRequest(t, a, response, "GET", "/api/accesslists/test", "")
+	expected := &accessLists{[]string{"abuser"}, []string{"critical_*"}}
+	if !reflect.DeepEqual(response, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, response)
+	}
+}
+
+func TestAccessListsPut(t *testing.T) {
+	a := NewMockAdministrable()
+	a.Configs().Namespaces["test"] = config.NewDefaultNamespaceConfig("test")
+
+	response := &accessLists{}
+	doAccessListsRequest(t, a, response, "PUT", "/api/accesslists/test", `{"denied_buckets": ["abuser"]}`)
+	if !reflect.DeepEqual(response.DeniedBuckets, []string{"abuser"}) {
+		t.Errorf("Expected deny-list to be updated, got %+v", response)
+	}
+
+	if len(a.Configs().Namespaces["test"].DeniedBuckets) != 0 {
+		t.Error("Live configuration should not be modified in place")
+	}
+}
+
+func TestAccessListsErrors(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doAccessListsRequest(t, NewMockAdministrable(), &jsonResponse, "GET", "/api/accesslists/test", "")
+	if jsonResponse["description"] != "Unable to locate namespace test" {
+		t.Errorf("Received \"%s\" from %+v instead of \"Unable to locate namespace test\"", jsonResponse["description"], jsonResponse)
+	}
+
+	a := NewMockErrorAdministrable()
+	a.Configs().Namespaces["test"] = config.NewDefaultNamespaceConfig("test")
+	jsonResponse = make(map[string]string)
+	doAccessListsRequest(t, a, &jsonResponse, "PUT", "/api/accesslists/test", `{"denied_buckets": ["abuser"]}`)
+	if jsonResponse["description"] != "UpdateNamespace" {
+		t.Errorf("Received \"%s\" from %+v instead of \"UpdateNamespace\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doAccessListsRequest(t *testing.T, a Administrable, object interface{}, method, path, body string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	newAccessListsAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -63,9 +63,15 @@ func ServeAdminConsole(a Administrable, mux *http.ServeMux, assetsDirectory stri
 
 	apiHandler := loggingHandler(
 		jsonResponseHandler(
-			apiVersionHandler(
+			rateLimitHandler(
 				a,
-				apiRequestHandler(namespacesHandler, bucketsHandler),
+				readOnlyHandler(
+					a,
+					apiVersionHandler(
+						a,
+						apiRequestHandler(namespacesHandler, bucketsHandler),
+					),
+				),
 			),
 		),
 	)
@@ -77,9 +83,58 @@ func ServeAdminConsole(a Administrable, mux *http.ServeMux, assetsDirectory stri
 	mux.Handle("/api/stats", statsHandler)
 	mux.Handle("/api/stats/", statsHandler)
 
+	metricsHandler := loggingHandler(jsonResponseHandler(newMetricsAPIHandler(a)))
+	mux.Handle("/api/metrics", metricsHandler)
+
 	configsHandler := loggingHandler(jsonResponseHandler(newConfigsAPIHandler(a)))
 	mux.Handle("/api/configs", configsHandler)
 	mux.Handle("/api/configs/", configsHandler)
+
+	bundleHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, readOnlyHandler(a, newBundleAPIHandler(a)))))
+	mux.Handle("/api/bundle", bundleHandler)
+
+	readOnlyAPIHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, newReadOnlyAPIHandler(a))))
+	mux.Handle("/api/readonly", readOnlyAPIHandler)
+
+	accessListsHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, readOnlyHandler(a, newAccessListsAPIHandler(a)))))
+	mux.Handle("/api/accesslists/", accessListsHandler)
+
+	provisionHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, readOnlyHandler(a, newProvisionAPIHandler(a)))))
+	mux.Handle("/api/provision/", provisionHandler)
+
+	cloneHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, readOnlyHandler(a, newCloneAPIHandler(a)))))
+	mux.Handle("/api/clone/", cloneHandler)
+
+	restoreHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, readOnlyHandler(a, newRestoreAPIHandler(a)))))
+	mux.Handle("/api/restore/", restoreHandler)
+
+	approvalsHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, newApprovalsAPIHandler(a))))
+	mux.Handle("/api/changes", approvalsHandler)
+	mux.Handle("/api/changes/", approvalsHandler)
+
+	cleanupHandler := loggingHandler(jsonResponseHandler(adminOnlyHandler(a, rateLimitHandler(a, readOnlyHandler(a, newCleanupAPIHandler(a))))))
+	mux.Handle("/api/cleanup", cleanupHandler)
+
+	debtHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, readOnlyHandler(a, newDebtAPIHandler(a)))))
+	mux.Handle("/api/debt/", debtHandler)
+
+	resetHandler := loggingHandler(jsonResponseHandler(rateLimitHandler(a, readOnlyHandler(a, newResetAPIHandler(a)))))
+	mux.Handle("/api/reset/", resetHandler)
+
+	recommendationsHandler := loggingHandler(jsonResponseHandler(newRecommendationsAPIHandler(a)))
+	mux.Handle("/api/recommendations", recommendationsHandler)
+
+	mux.Handle("/api/slo", loggingHandler(jsonResponseHandler(newSLOAPIHandler(a))))
+
+	dashboardHandler := loggingHandler(jsonResponseHandler(newDashboardAPIHandler(a)))
+	mux.Handle("/api/dashboard", dashboardHandler)
+	mux.Handle("/api/dashboard/", dashboardHandler)
+
+	mux.Handle("/api/dynamicbuckets/", loggingHandler(jsonResponseHandler(newDynamicBucketsAPIHandler(a))))
+
+	mux.Handle("/api/events", loggingHandler(newEventsAPIHandler(a)))
+	mux.Handle("/api/events/recent", loggingHandler(jsonResponseHandler(newRecentEventsAPIHandler(a))))
+	mux.Handle("/api/debug/", loggingHandler(newDebugHandler(a)))
 }
 
 func (r *responseWrapper) Write(p []byte) (int, error) {
@@ -97,6 +152,13 @@ func (r *responseWrapper) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Flush implements http.Flusher, so that streaming handlers can be wrapped.
+func (r *responseWrapper) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (r *responseWrapper) log() {
 	timeFormatted := r.time.Format("02/Jan/2006 03:04:05")
 	requestLine := fmt.Sprintf("%s %s %s", r.method, r.uri, r.protocol)
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/test/helpers"
 )
@@ -98,18 +99,18 @@ func TestNamespacesGetBadVersion(t *testing.T) {
 
 func TestUnmarshalBucketConfig(t *testing.T) {
 	c := config.NewDefaultBucketConfig("Blah 123")
-	c.FillRate = 12345
-	c.MaxDebtMillis = 54321
-	c.MaxIdleMillis = 67890
-	c.MaxTokensPerRequest = 9876
-	c.Size = 50000
+	c.FillRate = proto.Int64(12345)
+	c.MaxDebtMillis = proto.Int64(54321)
+	c.MaxIdleMillis = proto.Int64(67890)
+	c.MaxTokensPerRequest = proto.Int64(9876)
+	c.Size = proto.Int64(50000)
 
 	b, e := json.Marshal(c)
 	if e != nil {
 		t.Fatal("Unable to JSONify proto", e)
 	}
 
-	reRead, err := getBucketConfig(bytes.NewReader(b))
+	reRead, err := getBucketConfig(bytes.NewReader(b), false)
 	if err != nil {
 		t.Fatal("Unable to unmarshal JSON", err)
 	}
@@ -124,25 +125,25 @@ func TestUnmarshalNamespaceConfig(t *testing.T) {
 	config.SetDynamicBucketTemplate(n, config.NewDefaultBucketConfig(""))
 
 	c1 := config.NewDefaultBucketConfig("Blah 123")
-	c1.FillRate = 12345
-	c1.MaxDebtMillis = 54321
-	c1.MaxIdleMillis = 67890
-	c1.MaxTokensPerRequest = 9876
-	c1.Size = 50000
+	c1.FillRate = proto.Int64(12345)
+	c1.MaxDebtMillis = proto.Int64(54321)
+	c1.MaxIdleMillis = proto.Int64(67890)
+	c1.MaxTokensPerRequest = proto.Int64(9876)
+	c1.Size = proto.Int64(50000)
 
 	c2 := config.NewDefaultBucketConfig("Blah 456")
-	c2.FillRate = 123450
-	c2.MaxDebtMillis = 543210
-	c2.MaxIdleMillis = 678900
-	c2.MaxTokensPerRequest = 98760
-	c2.Size = 5000
+	c2.FillRate = proto.Int64(123450)
+	c2.MaxDebtMillis = proto.Int64(543210)
+	c2.MaxIdleMillis = proto.Int64(678900)
+	c2.MaxTokensPerRequest = proto.Int64(98760)
+	c2.Size = proto.Int64(5000)
 
 	c3 := config.NewDefaultBucketConfig("Blah 789")
-	c3.FillRate = 1234500
-	c3.MaxDebtMillis = 5432100
-	c3.MaxIdleMillis = 6789000
-	c3.MaxTokensPerRequest = 987600
-	c3.Size = 500
+	c3.FillRate = proto.Int64(1234500)
+	c3.MaxDebtMillis = proto.Int64(5432100)
+	c3.MaxIdleMillis = proto.Int64(6789000)
+	c3.MaxTokensPerRequest = proto.Int64(987600)
+	c3.Size = proto.Int64(500)
 
 	helpers.CheckError(t, config.AddBucket(n, c1))
 	helpers.CheckError(t, config.AddBucket(n, c2))
@@ -4,6 +4,9 @@
 package admin
 
 import (
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/metrics"
 	pb "github.com/square/quotaservice/protos/config"
 	"github.com/square/quotaservice/stats"
 )
@@ -14,16 +17,99 @@ type Administrable interface {
 	HistoricalConfigs() ([]*pb.ServiceConfig, error)
 
 	UpdateConfig(*pb.ServiceConfig, string) error
+	// ExportConfig exports the current config as a signed bundle on behalf of a user.
+	ExportConfig(string) (*config.Bundle, error)
+	// ImportConfig replaces the current config with that of a signed bundle on behalf of a user,
+	// after verifying its signature.
+	ImportConfig(*config.Bundle, string) error
 
 	DeleteBucket(string, string, string) error
 	AddBucket(string, *pb.BucketConfig, string) error
 	UpdateBucket(string, *pb.BucketConfig, string) error
 
+	// DeleteNamespace soft-deletes a namespace on behalf of a user.
 	DeleteNamespace(string, string) error
+	// RestoreNamespace restores a soft-deleted namespace on behalf of a user.
+	RestoreNamespace(string, string) error
 	AddNamespace(*pb.NamespaceConfig, string) error
 	UpdateNamespace(*pb.NamespaceConfig, string) error
+	// EnsureNamespace creates a namespace from a namespace template on behalf of a user, unless it
+	// already exists.
+	EnsureNamespace(string, string, string) error
+	// CloneNamespace copies the config of a namespace into a new namespace on behalf of a user.
+	CloneNamespace(string, string, config.CloneOverrides, string) error
 
+	// PendingChanges returns the config changes awaiting approval, if two-person approval is enabled.
+	PendingChanges() []*PendingChange
+	// ApproveChange applies a pending change on behalf of an approver other than the user who made
+	// it.
+	ApproveChange(string, string) error
+	// RejectChange discards a pending change on behalf of an approver.
+	RejectChange(string, string) error
+
+	// ReadOnly returns whether the admin API is in read-only mode, rejecting all mutations.
+	ReadOnly() bool
+	// SetReadOnly enables or disables read-only mode on behalf of a user, who must be authorized to
+	// do so.
+	SetReadOnly(bool, string) error
+
+	// SubscribeEvents returns a channel of live events, buffering up to the given number of events,
+	// and a function to unsubscribe.
+	SubscribeEvents(int) (<-chan events.Event, func())
+	// RecentEvents returns up to the given number of the most recent events in a namespace, or in
+	// all namespaces if the namespace is empty, newest first.
+	RecentEvents(string, int) []events.RecordedEvent
+
+	// TopDynamicHits, TopDynamicMisses and DynamicBucketStats include static buckets if the stats
+	// listener tracks them.
 	TopDynamicHits(string) []*stats.BucketScore
 	TopDynamicMisses(string) []*stats.BucketScore
 	DynamicBucketStats(string, string) *stats.BucketScores
+	// NamespaceStats returns the totals of a namespace's buckets, or nil if no stats listener is
+	// configured.
+	NamespaceStats(string) *stats.AggregateStats
+	// GlobalStats returns the totals of all namespaces' buckets, or nil if no stats listener is
+	// configured.
+	GlobalStats() *stats.AggregateStats
+
+	// HealthMetrics reports on the health of the quota service itself.
+	HealthMetrics() *metrics.Health
+
+	// AllowAdminRequest returns whether an identity, a user or a client address, may make another
+	// request to change state through the admin API, or has exceeded its rate limit.
+	AllowAdminRequest(string) bool
+
+	// IsAdmin returns whether a user is an admin, i.e., allowed to toggle read-only mode and use the
+	// debug endpoints.
+	IsAdmin(string) bool
+	// DebugState dumps the service's internal state, for debugging.
+	DebugState() *DebugState
+
+	// CleanStaleBuckets deletes state left behind in the bucket factory's backend by buckets that no
+	// longer exist, on behalf of a user, or only reports what would be deleted in a dry run.
+	CleanStaleBuckets(bool, string) (*CleanupReport, error)
+
+	// BucketDebt reports on the debt of a bucket that has been created.
+	BucketDebt(string, string) (*BucketDebt, error)
+	// ForgiveDebt clears a bucket's debt on behalf of a user, so that a bucket put into debt by an
+	// accidentally large request isn't locked out until the debt is paid back.
+	ForgiveDebt(string, string, string) error
+
+	// ResetBucket restores a bucket that has been created to full capacity, on behalf of a user.
+	ResetBucket(string, string, string) error
+
+	// Recommendations suggests fill rates and sizes for buckets, based on the traffic they have seen.
+	Recommendations() (*RecommendationReport, error)
+
+	// SLOs reports how often requests granted by each bucket waited longer than their latency
+	// budget.
+	SLOs() (*SLOReport, error)
+
+	// Dashboard returns pre-aggregated dashboard data for a namespace, or for all namespaces if the
+	// namespace is empty.
+	Dashboard(string) (*Dashboard, error)
+
+	// DynamicBuckets lists a page of a namespace's live dynamic buckets, across all servers sharing
+	// a registry, continuing from a cursor returned with an earlier page.
+	DynamicBuckets(namespace, cursor string, count int) (*DynamicBucketPage, error)
 }
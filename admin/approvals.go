@@ -0,0 +1,123 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+var (
+	// ErrNotApprover is returned when a user who isn't an approver attempts to approve or reject a
+	// change.
+	ErrNotApprover = errors.New("user is not authorized to approve or reject changes")
+	// ErrSelfApproval is returned when a user attempts to approve their own change.
+	ErrSelfApproval = errors.New("changes must be approved by a different user than the one who made them")
+	// ErrNoSuchChange is returned when approving or rejecting a change that isn't pending.
+	ErrNoSuchChange = errors.New("no such pending change")
+	// ErrStaleChange is returned when approving a change made to a config that has since changed. It
+	// remains pending until rejected, and must be made again.
+	ErrStaleChange = errors.New("the config has changed since the change was made")
+)
+
+// PendingChange is a config change awaiting approval by a second user.
+type PendingChange struct {
+	ID          string `json:"id"`
+	User        string `json:"user"`
+	Description string `json:"description"`
+	// Created is when the change was made, in seconds since the epoch.
+	Created int64 `json:"created"`
+	// BaseVersion is the version of the config the change was made to, and Config the config that
+	// results, which is what gets applied when the change is approved. Changes summarizes the
+	// namespaces and buckets added, removed or changed.
+	BaseVersion int32             `json:"baseVersion"`
+	Changes     []string          `json:"changes"`
+	Config      *pb.ServiceConfig `json:"config"`
+}
+
+// PendingApprovalError is returned by mutations that have been queued for approval by a second
+// user, rather than applied.
+type PendingApprovalError struct {
+	ChangeID string
+}
+
+func (e *PendingApprovalError) Error() string {
+	return fmt.Sprintf("change %v is pending approval", e.ChangeID)
+}
+
+// VetoedError is returned by mutations rejected by a hook that enforces policies on config changes.
+type VetoedError struct {
+	Err error
+}
+
+func (e *VetoedError) Error() string {
+	return fmt.Sprintf("config change vetoed: %v", e.Err)
+}
+
+// mutationError converts an error returned by a mutation to an httpError, with the given status
+// unless the mutation is pending approval, or was vetoed.
+func mutationError(err error, status int) *httpError {
+	switch err.(type) {
+	case *PendingApprovalError:
+		status = http.StatusAccepted
+	case *VetoedError:
+		status = http.StatusUnprocessableEntity
+	}
+
+	return &httpError{err.Error(), status}
+}
+
+type approvalsAPIHandler struct {
+	a Administrable
+}
+
+func newApprovalsAPIHandler(admin Administrable) (a *approvalsAPIHandler) {
+	return &approvalsAPIHandler{a: admin}
+}
+
+// ServeHTTP lists pending changes on GET /api/changes, and approves or rejects them on
+// POST /api/changes/{id}/approve and POST /api/changes/{id}/reject.
+func (a *approvalsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/changes"), "/"), "/")
+
+	switch {
+	case r.Method == "GET" && params[0] == "":
+		changes := a.a.PendingChanges()
+		if changes == nil {
+			changes = []*PendingChange{}
+		}
+
+		writeJSON(w, changes)
+	case r.Method == "POST" && len(params) == 2:
+		var err error
+		switch params[1] {
+		case "approve":
+			err = a.a.ApproveChange(params[0], getUsername(r))
+		case "reject":
+			err = a.a.RejectChange(params[0], getUsername(r))
+		default:
+			writeJSONError(w, &httpError{"Unknown action " + params[1], http.StatusNotFound})
+			return
+		}
+
+		switch err {
+		case nil:
+			writeJSONOk(w)
+		case ErrNotApprover, ErrSelfApproval:
+			writeJSONError(w, &httpError{err.Error(), http.StatusForbidden})
+		case ErrNoSuchChange:
+			writeJSONError(w, &httpError{err.Error(), http.StatusNotFound})
+		case ErrStaleChange:
+			writeJSONError(w, &httpError{err.Error(), http.StatusConflict})
+		default:
+			writeJSONError(w, mutationError(err, http.StatusBadRequest))
+		}
+	default:
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+	}
+}
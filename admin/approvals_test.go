@@ -0,0 +1,79 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+func TestPendingChanges(t *testing.T) {
+	a := NewMockAdministrable()
+	a.pending = []*PendingChange{{ID: "1", User: "alice", Description: "add namespace ns", BaseVersion: 3,
+		Changes: []string{"added namespace ns"}, Config: &pb.ServiceConfig{Version: 3}}}
+
+	var changes []*PendingChange
+	doApprovalsRequest(t, a, &changes, "GET", "/api/changes")
+	if len(changes) != 1 || !reflect.DeepEqual(changes[0], a.pending[0]) {
+		t.Errorf("Expected %+v, got %+v", a.pending, changes)
+	}
+}
+
+func TestApproveChange(t *testing.T) {
+	a := NewMockAdministrable()
+	a.pending = []*PendingChange{{ID: "1", User: "alice"}}
+
+	jsonResponse := make(map[string]string)
+	doApprovalsRequest(t, a, &jsonResponse, "POST", "/api/changes/2/approve")
+	if jsonResponse["error"] != http.StatusText(http.StatusNotFound) {
+		t.Errorf("Expected 404 Not Found, got %+v", jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doApprovalsRequest(t, a, &jsonResponse, "POST", "/api/changes/1/approve")
+	if len(jsonResponse) != 0 || len(a.pending) != 0 {
+		t.Errorf("Expected change to be approved, got %+v", jsonResponse)
+	}
+}
+
+func TestRejectChangeNotAuthorized(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doApprovalsRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST", "/api/changes/1/reject")
+	if jsonResponse["error"] != http.StatusText(http.StatusForbidden) {
+		t.Errorf("Expected 403 Forbidden, got %+v", jsonResponse)
+	}
+}
+
+func TestMutationPendingApproval(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSONError(w, mutationError(&PendingApprovalError{"1"}, http.StatusBadRequest))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected 202 Accepted, got %v", w.Code)
+	}
+}
+
+func TestMutationVetoed(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSONError(w, mutationError(&VetoedError{errors.New("policy")}, http.StatusBadRequest))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 Unprocessable Entity, got %v", w.Code)
+	}
+}
+
+func doApprovalsRequest(t *testing.T, a Administrable, object interface{}, method, path string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(""))
+	newApprovalsAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -27,7 +27,7 @@ func (a *bucketsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
-		err := writeBucket(a, w, namespace, bucket)
+		err := writeBucket(a, w, namespace, bucket, r.URL.Query().Get("resolved") == "true")
 
 		if err != nil {
 			writeJSONError(w, err)
@@ -36,16 +36,16 @@ func (a *bucketsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		err := a.a.DeleteBucket(namespace, bucket, user)
 
 		if err != nil {
-			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			writeJSONError(w, mutationError(err, http.StatusBadRequest))
 		} else {
 			writeJSONOk(w)
 		}
 	case "PUT":
-		changeBucket(w, r, bucket, func(c *pb.BucketConfig) error {
+		changeBucket(w, r, bucket, a.inheritsDefaults(namespace), func(c *pb.BucketConfig) error {
 			return a.a.UpdateBucket(namespace, c, user)
 		})
 	case "POST":
-		changeBucket(w, r, bucket, func(c *pb.BucketConfig) error {
+		changeBucket(w, r, bucket, a.inheritsDefaults(namespace), func(c *pb.BucketConfig) error {
 			return a.a.AddBucket(namespace, c, user)
 		})
 	default:
@@ -53,8 +53,14 @@ func (a *bucketsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func changeBucket(w http.ResponseWriter, r *http.Request, bucket string, updater func(*pb.BucketConfig) error) {
-	c, e := getBucketConfig(r.Body)
+// inheritsDefaults returns whether buckets in a namespace inherit unset settings, in which case
+// defaults mustn't be applied to them.
+func (a *bucketsAPIHandler) inheritsDefaults(namespace string) bool {
+	return a.a.Configs().Namespaces[namespace].GetInheritDefaults()
+}
+
+func changeBucket(w http.ResponseWriter, r *http.Request, bucket string, inheritsDefaults bool, updater func(*pb.BucketConfig) error) {
+	c, e := getBucketConfig(r.Body, inheritsDefaults)
 
 	if e != nil {
 		writeJSONError(w, &httpError{e.Error(), http.StatusInternalServerError})
@@ -68,21 +74,26 @@ func changeBucket(w http.ResponseWriter, r *http.Request, bucket string, updater
 	e = updater(c)
 
 	if e != nil {
-		writeJSONError(w, &httpError{e.Error(), http.StatusInternalServerError})
+		writeJSONError(w, mutationError(e, http.StatusInternalServerError))
 	} else {
 		writeJSONOk(w)
 	}
 }
 
-func getBucketConfig(r io.Reader) (*pb.BucketConfig, error) {
+func getBucketConfig(r io.Reader, inheritsDefaults bool) (*pb.BucketConfig, error) {
 	c := &pb.BucketConfig{}
-	config.ApplyBucketDefaults(c)
+	if !inheritsDefaults {
+		config.ApplyBucketDefaults(c)
+	}
 	err := unmarshalJSON(r, c)
 	return c, err
 }
 
-func writeBucket(a *bucketsAPIHandler, w http.ResponseWriter, namespace, bucket string) *httpError {
-	namespaceConfig, exists := a.a.Configs().Namespaces[namespace]
+// writeBucket writes a bucket's config as configured or, if resolved, its effective config, with
+// inherited and default settings applied.
+func writeBucket(a *bucketsAPIHandler, w http.ResponseWriter, namespace, bucket string, resolved bool) *httpError {
+	cfg := a.a.Configs()
+	namespaceConfig, exists := cfg.Namespaces[namespace]
 
 	if !exists {
 		return &httpError{"Unable to locate namespace " + namespace, http.StatusNotFound}
@@ -99,6 +110,10 @@ func writeBucket(a *bucketsAPIHandler, w http.ResponseWriter, namespace, bucket
 		return &httpError{"Unable to locate bucket " + bucket + " in namespace " + namespace, http.StatusNotFound}
 	}
 
+	if resolved {
+		bucketConfig = config.ResolveBucketConfig(cfg, namespaceConfig, bucketConfig)
+	}
+
 	writeJSON(w, bucketConfig)
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice/config"
 	pb "github.com/square/quotaservice/protos/config"
 )
@@ -48,11 +49,35 @@ func TestBucketsGet(t *testing.T) {
 	configResponse := &pb.BucketConfig{}
 	doBucketsRequest(t, a, configResponse, "GET", "/api/test/bucket", "")
 
-	if *bucket != *configResponse {
+	if !proto.Equal(bucket, configResponse) {
 		t.Errorf("Received \"%+v\" but was expecting \"%+v\"", configResponse, bucket)
 	}
 }
 
+func TestBucketsGetResolved(t *testing.T) {
+	a := NewMockAdministrable()
+
+	testNamespace := config.NewDefaultNamespaceConfig("test")
+	testNamespace.InheritDefaults = true
+	testNamespace.DefaultBucket = &pb.BucketConfig{FillRate: proto.Int64(10)}
+	a.Configs().Namespaces["test"] = testNamespace
+	testNamespace.Buckets["bucket"] = &pb.BucketConfig{Name: "bucket", Size: proto.Int64(20)}
+
+	configResponse := &pb.BucketConfig{}
+	doBucketsRequest(t, a, configResponse, "GET", "/api/test/bucket?resolved=true", "")
+
+	if configResponse.GetSize() != 20 || configResponse.GetFillRate() != 10 || configResponse.GetWaitTimeoutMillis() != 1000 {
+		t.Errorf("Expected the resolved config, got %+v", configResponse)
+	}
+
+	configResponse = &pb.BucketConfig{}
+	doBucketsRequest(t, a, configResponse, "GET", "/api/test/bucket", "")
+
+	if configResponse.GetFillRate() != 0 {
+		t.Errorf("Expected the config as given, got %+v", configResponse)
+	}
+}
+
 func TestBucketsPost(t *testing.T) {
 	jsonResponse := make(map[string]string)
 	doBucketsRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/test/newbucket", "")
@@ -0,0 +1,48 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/square/quotaservice/config"
+)
+
+type bundleAPIHandler struct {
+	a Administrable
+}
+
+func newBundleAPIHandler(admin Administrable) (a *bundleAPIHandler) {
+	return &bundleAPIHandler{a: admin}
+}
+
+// ServeHTTP exports the current config as a signed bundle on GET, and imports a signed bundle on
+// POST.
+func (a *bundleAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		bundle, err := a.a.ExportConfig(getUsername(r))
+		if err != nil {
+			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			return
+		}
+
+		writeJSON(w, bundle)
+	case "POST":
+		bundle := &config.Bundle{}
+		if err := unmarshalJSON(r.Body, bundle); err != nil {
+			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			return
+		}
+
+		if err := a.a.ImportConfig(bundle, getUsername(r)); err != nil {
+			writeJSONError(w, mutationError(err, http.StatusBadRequest))
+			return
+		}
+
+		writeJSONOk(w)
+	default:
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+	}
+}
@@ -0,0 +1,62 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/square/quotaservice/config"
+)
+
+func TestBundleExport(t *testing.T) {
+	bundle := &config.Bundle{}
+	r := httptest.NewRequest("GET", "/api/bundle", strings.NewReader(""))
+	r.Header.Set("X-Forwarded-User", "alice")
+	doBundleRequest(t, NewMockAdministrable(), bundle, r)
+	if bundle.ConfigVersion != 1 || bundle.ExportedBy != "alice" {
+		t.Errorf("Unexpected bundle %+v", bundle)
+	}
+}
+
+func TestBundleImport(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	r := httptest.NewRequest("POST", "/api/bundle", strings.NewReader(`{"formatVersion": 1, "signature": "abc"}`))
+	doBundleRequest(t, NewMockAdministrable(), &jsonResponse, r)
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received non-empty response \"%+v\"", jsonResponse)
+	}
+}
+
+func TestBundleErrors(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doBundleRequest(t, NewMockErrorAdministrable(), &jsonResponse, httptest.NewRequest("GET", "/api/bundle", strings.NewReader("")))
+	if jsonResponse["description"] != "ExportConfig" {
+		t.Errorf("Received \"%s\" from %+v instead of \"ExportConfig\"", jsonResponse["description"], jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doBundleRequest(t, NewMockErrorAdministrable(), &jsonResponse, httptest.NewRequest("POST", "/api/bundle", strings.NewReader("{}")))
+	if jsonResponse["description"] != "ImportConfig" {
+		t.Errorf("Received \"%s\" from %+v instead of \"ImportConfig\"", jsonResponse["description"], jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doBundleRequest(t, NewMockAdministrable(), &jsonResponse, httptest.NewRequest("DELETE", "/api/bundle", strings.NewReader("")))
+	if jsonResponse["description"] != "Unknown method DELETE" {
+		t.Errorf("Received \"%s\" from %+v instead of \"Unknown method DELETE\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doBundleRequest(t *testing.T, a Administrable, object interface{}, r *http.Request) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	newBundleAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,52 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+)
+
+// CleanupReport reports on a cleanup of state left behind in a bucket factory's backend by buckets
+// that no longer exist.
+type CleanupReport struct {
+	DryRun bool `json:"dryRun"`
+	// Scanned is the number of keys examined.
+	Scanned int64 `json:"scanned"`
+	// Stale is the number of keys found to be stale, and Deleted the number deleted. Nothing is
+	// deleted in a dry run.
+	Stale   int64 `json:"stale"`
+	Deleted int64 `json:"deleted"`
+	// Keys are stale keys, up to a limit, so that dry runs can be reviewed.
+	Keys []string `json:"keys"`
+}
+
+type cleanupAPIHandler struct {
+	a Administrable
+}
+
+func newCleanupAPIHandler(admin Administrable) (a *cleanupAPIHandler) {
+	return &cleanupAPIHandler{a: admin}
+}
+
+// ServeHTTP reports the stale keys that a cleanup would delete on GET, and deletes them on POST.
+func (a *cleanupAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var dryRun bool
+	switch r.Method {
+	case "GET":
+		dryRun = true
+	case "POST":
+		dryRun = false
+	default:
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	report, err := a.a.CleanStaleBuckets(dryRun, getUsername(r))
+	if err != nil {
+		writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+		return
+	}
+
+	writeJSON(w, report)
+}
@@ -0,0 +1,53 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCleanupDryRun(t *testing.T) {
+	report := &CleanupReport{}
+	doCleanupRequest(t, NewMockAdministrable(), report, "GET")
+	if !report.DryRun || report.Stale != 1 || report.Deleted != 0 || len(report.Keys) != 1 {
+		t.Errorf("Expected a dry run report, got %+v", report)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	report := &CleanupReport{}
+	doCleanupRequest(t, NewMockAdministrable(), report, "POST")
+	if report.DryRun || report.Deleted != 1 {
+		t.Errorf("Expected stale keys to be deleted, got %+v", report)
+	}
+}
+
+func TestCleanupError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doCleanupRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST")
+	if jsonResponse["description"] != "CleanStaleBuckets" {
+		t.Errorf("Received \"%s\" from %+v instead of \"CleanStaleBuckets\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestCleanupUnknownMethod(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doCleanupRequest(t, NewMockAdministrable(), &jsonResponse, "DELETE")
+	if jsonResponse["description"] != "Unknown method DELETE" {
+		t.Errorf("Received \"%s\" from %+v instead of unknown method", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doCleanupRequest(t *testing.T, a Administrable, object interface{}, method string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/cleanup", strings.NewReader(""))
+	newCleanupAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
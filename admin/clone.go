@@ -0,0 +1,63 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/square/quotaservice/config"
+)
+
+type cloneAPIHandler struct {
+	a Administrable
+}
+
+func newCloneAPIHandler(admin Administrable) (a *cloneAPIHandler) {
+	return &cloneAPIHandler{a: admin}
+}
+
+type cloneRequest struct {
+	Source    string  `json:"source"`
+	RateScale float64 `json:"rateScale"`
+}
+
+// ServeHTTP creates a namespace as a copy of an existing namespace, optionally scaling the sizes and
+// fill rates of its buckets.
+func (a *cloneAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	ns := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/clone"), "/")
+	if ns == "" {
+		writeJSONError(w, &httpError{"No namespace specified", http.StatusBadRequest})
+		return
+	}
+
+	req := &cloneRequest{}
+	if err := unmarshalJSON(r.Body, req); err != nil {
+		writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+		return
+	}
+
+	if req.Source == "" {
+		writeJSONError(w, &httpError{"No source namespace specified", http.StatusBadRequest})
+		return
+	}
+
+	if req.RateScale < 0 {
+		writeJSONError(w, &httpError{"rateScale must not be negative", http.StatusBadRequest})
+		return
+	}
+
+	overrides := config.CloneOverrides{RateScale: req.RateScale}
+	if err := a.a.CloneNamespace(req.Source, ns, overrides, getUsername(r)); err != nil {
+		writeJSONError(w, mutationError(err, http.StatusBadRequest))
+		return
+	}
+
+	writeJSONOk(w)
+}
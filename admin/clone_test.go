@@ -0,0 +1,55 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doCloneRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/clone/staging", `{"source": "prod", "rateScale": 0.1}`)
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received non-empty response \"%+v\"", jsonResponse)
+	}
+}
+
+func TestCloneErrors(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doCloneRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST", "/api/clone/staging", `{"source": "prod"}`)
+	if jsonResponse["description"] != "CloneNamespace" {
+		t.Errorf("Received \"%s\" from %+v instead of \"CloneNamespace\"", jsonResponse["description"], jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doCloneRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/clone/", `{"source": "prod"}`)
+	if jsonResponse["description"] != "No namespace specified" {
+		t.Errorf("Received \"%s\" from %+v instead of \"No namespace specified\"", jsonResponse["description"], jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doCloneRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/clone/staging", `{}`)
+	if jsonResponse["description"] != "No source namespace specified" {
+		t.Errorf("Received \"%s\" from %+v instead of \"No source namespace specified\"", jsonResponse["description"], jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doCloneRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/clone/staging", `{"source": "prod", "rateScale": -1}`)
+	if jsonResponse["description"] != "rateScale must not be negative" {
+		t.Errorf("Received \"%s\" from %+v instead of \"rateScale must not be negative\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doCloneRequest(t *testing.T, a Administrable, object interface{}, method, path, body string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	newCloneAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
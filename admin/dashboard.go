@@ -0,0 +1,78 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/square/quotaservice/stats"
+)
+
+// RatePoint is the number of requests a namespace granted and denied in one minute.
+type RatePoint struct {
+	// Time is the start of the minute, in Unix seconds.
+	Time    int64 `json:"time"`
+	Granted int64 `json:"granted"`
+	Denied  int64 `json:"denied"`
+}
+
+// NamespaceDashboard is the dashboard data of one namespace.
+type NamespaceDashboard struct {
+	Namespace string `json:"namespace"`
+	// Granted and Denied are the requests granted and denied within the dashboard window.
+	Granted int64 `json:"granted"`
+	Denied  int64 `json:"denied"`
+	// Rates has a point for every minute of the dashboard window, oldest first.
+	Rates []*RatePoint `json:"rates"`
+	// TopHits and TopMisses are the namespace's busiest dynamic buckets, if a stats listener is
+	// configured.
+	TopHits   []*stats.BucketScore `json:"topHits,omitempty"`
+	TopMisses []*stats.BucketScore `json:"topMisses,omitempty"`
+}
+
+// ConfigChange describes a version of the config, in the order the config was changed.
+type ConfigChange struct {
+	Version int32  `json:"version"`
+	User    string `json:"user"`
+	Date    int64  `json:"date"`
+}
+
+// Dashboard is pre-aggregated data for plotting a service's, or a namespace's, traffic.
+type Dashboard struct {
+	WindowMinutes int                   `json:"windowMinutes"`
+	Namespaces    []*NamespaceDashboard `json:"namespaces"`
+	// ConfigChanges are the most recent config changes, newest first.
+	ConfigChanges []*ConfigChange `json:"configChanges"`
+}
+
+type dashboardAPIHandler struct {
+	a Administrable
+}
+
+func newDashboardAPIHandler(admin Administrable) (a *dashboardAPIHandler) {
+	return &dashboardAPIHandler{a: admin}
+}
+
+// ServeHTTP returns the dashboard data of all namespaces, or of the namespace in the path.
+func (a *dashboardAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	namespace := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/dashboard"), "/")
+	if _, exists := a.a.Configs().Namespaces[namespace]; namespace != "" && !exists {
+		writeJSONError(w, &httpError{"Unable to locate namespace " + namespace, http.StatusNotFound})
+		return
+	}
+
+	dashboard, err := a.a.Dashboard(namespace)
+	if err != nil {
+		writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+		return
+	}
+
+	writeJSON(w, dashboard)
+}
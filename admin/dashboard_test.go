@@ -0,0 +1,54 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	dashboard := &Dashboard{}
+	doDashboardRequest(t, NewMockAdministrable(), dashboard, "GET", "/api/dashboard", http.StatusOK)
+	if len(dashboard.Namespaces) != 1 || dashboard.Namespaces[0].Denied != 2 || len(dashboard.Namespaces[0].Rates) != 1 {
+		t.Errorf("Unexpected dashboard %+v", dashboard)
+	}
+
+	if len(dashboard.ConfigChanges) != 1 || dashboard.ConfigChanges[0].User != "alice" {
+		t.Errorf("Unexpected config changes %+v", dashboard.ConfigChanges)
+	}
+}
+
+func TestDashboardUnknownNamespace(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doDashboardRequest(t, NewMockAdministrable(), &jsonResponse, "GET", "/api/dashboard/nonexistent", http.StatusNotFound)
+	if jsonResponse["description"] != "Unable to locate namespace nonexistent" {
+		t.Errorf("Received \"%s\" from %+v instead of an unknown namespace", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestDashboardError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doDashboardRequest(t, NewMockErrorAdministrable(), &jsonResponse, "GET", "/api/dashboard", http.StatusBadRequest)
+	if jsonResponse["description"] != "Dashboard" {
+		t.Errorf("Received \"%s\" from %+v instead of \"Dashboard\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doDashboardRequest(t *testing.T, a Administrable, object interface{}, method, path string, status int) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(""))
+	newDashboardAPIHandler(a).ServeHTTP(w, r)
+
+	if w.Code != status {
+		t.Fatalf("Expected status %v, got %v", status, w.Code)
+	}
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+)
+
+// BucketDebt reports on a bucket's debt, i.e., tokens taken in advance by requests that were
+// allowed to borrow against the bucket's future capacity.
+type BucketDebt struct {
+	Namespace string `json:"namespace"`
+	Bucket    string `json:"bucket"`
+	Dynamic   bool   `json:"dynamic"`
+	// Tokens is the number of tokens available, or, if negative, owed.
+	Tokens int64 `json:"tokens"`
+	// DebtTokens is the number of tokens owed, and DebtMillis roughly how long the bucket takes to
+	// pay them back. Unbounded is set instead of DebtMillis if the bucket is blocked, and so never
+	// pays them back.
+	DebtTokens int64 `json:"debtTokens"`
+	DebtMillis int64 `json:"debtMillis"`
+	Unbounded  bool  `json:"unbounded,omitempty"`
+}
+
+type debtAPIHandler struct {
+	a Administrable
+}
+
+func newDebtAPIHandler(admin Administrable) (a *debtAPIHandler) {
+	return &debtAPIHandler{a: admin}
+}
+
+// ServeHTTP reports a bucket's debt on GET, and forgives it on DELETE.
+func (a *debtAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := strings.SplitN(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/debt"), "/"), "/", 2)
+	if len(params) != 2 || params[0] == "" || params[1] == "" {
+		writeJSONError(w, &httpError{"No bucket specified", http.StatusBadRequest})
+		return
+	}
+
+	namespace, bucket := params[0], params[1]
+	switch r.Method {
+	case "GET":
+		debt, err := a.a.BucketDebt(namespace, bucket)
+		if err != nil {
+			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			return
+		}
+
+		writeJSON(w, debt)
+	case "DELETE":
+		if err := a.a.ForgiveDebt(namespace, bucket, getUsername(r)); err != nil {
+			writeJSONError(w, mutationError(err, http.StatusBadRequest))
+			return
+		}
+
+		writeJSONOk(w)
+	default:
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+	}
+}
@@ -0,0 +1,55 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBucketDebt(t *testing.T) {
+	debt := &BucketDebt{}
+	doDebtRequest(t, NewMockAdministrable(), debt, "GET", "/api/debt/ns/b")
+	if debt.Namespace != "ns" || debt.Bucket != "b" || debt.DebtTokens != 5 {
+		t.Errorf("Unexpected debt %+v", debt)
+	}
+}
+
+func TestForgiveDebt(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doDebtRequest(t, NewMockAdministrable(), &jsonResponse, "DELETE", "/api/debt/ns/b")
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received non-empty response \"%+v\"", jsonResponse)
+	}
+}
+
+func TestDebtErrors(t *testing.T) {
+	for method, expected := range map[string]string{"GET": "BucketDebt", "DELETE": "ForgiveDebt"} {
+		jsonResponse := make(map[string]string)
+		doDebtRequest(t, NewMockErrorAdministrable(), &jsonResponse, method, "/api/debt/ns/b")
+		if jsonResponse["description"] != expected {
+			t.Errorf("Received \"%s\" from %+v instead of \"%s\"", jsonResponse["description"], jsonResponse, expected)
+		}
+	}
+}
+
+func TestDebtNoBucket(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doDebtRequest(t, NewMockAdministrable(), &jsonResponse, "GET", "/api/debt/ns")
+	if jsonResponse["description"] != "No bucket specified" {
+		t.Errorf("Received \"%s\" from %+v instead of \"No bucket specified\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doDebtRequest(t *testing.T, a Administrable, object interface{}, method, path string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(""))
+	newDebtAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+)
+
+// ErrNotAdmin is returned when a user who isn't an admin attempts to use the debug endpoints.
+var ErrNotAdmin = errors.New("user is not authorized to use the debug endpoints")
+
+// DebugState is a dump of a quota service's internal state, for debugging.
+type DebugState struct {
+	ConfigVersion int32                           `json:"configVersion"`
+	Namespaces    map[string]*NamespaceDebugState `json:"namespaces"`
+	ReadOnly      bool                            `json:"readOnly"`
+	// Follower is whether the server is a read-only follower.
+	Follower bool `json:"follower"`
+	// ConfigWatcherRunning is whether the server is watching its persister for config changes.
+	ConfigWatcherRunning bool `json:"configWatcherRunning"`
+	// LastConfigNotification is when the persister last notified the server of a config change, in
+	// seconds since the epoch, or 0 if it hasn't.
+	LastConfigNotification int64 `json:"lastConfigNotification"`
+}
+
+// NamespaceDebugState is the internal state of a namespace.
+type NamespaceDebugState struct {
+	StaticBuckets  int  `json:"staticBuckets"`
+	DynamicBuckets int  `json:"dynamicBuckets"`
+	DefaultBucket  bool `json:"defaultBucket"`
+}
+
+// newDebugHandler serves pprof profiles under /api/debug/pprof/, a dump of expvars and the
+// service's internal state under /api/debug/vars, and a dump of all goroutines' stacks under
+// /api/debug/goroutines.
+func newDebugHandler(a Administrable) http.Handler {
+	mux := http.NewServeMux()
+	// The pprof handlers expect to be served under /debug/pprof/.
+	mux.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+	mux.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	mux.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	mux.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	mux.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+	mux.Handle("/debug/vars", newDebugVarsHandler(a))
+	mux.Handle("/debug/goroutines", http.HandlerFunc(writeGoroutines))
+
+	return adminOnlyHandler(a, http.StripPrefix("/api", mux))
+}
+
+// adminOnlyHandler only allows requests from admins, i.e., users allowed to toggle read-only mode.
+func adminOnlyHandler(a Administrable, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.IsAdmin(getUsername(r)) {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, &httpError{ErrNotAdmin.Error(), http.StatusForbidden})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type debugVarsHandler struct {
+	a Administrable
+}
+
+func newDebugVarsHandler(admin Administrable) (a *debugVarsHandler) {
+	return &debugVarsHandler{a: admin}
+}
+
+// ServeHTTP writes expvars, as expvar.Handler does, along with the service's internal state under
+// "quotaservice".
+func (a *debugVarsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := make(map[string]json.RawMessage)
+	expvar.Do(func(kv expvar.KeyValue) {
+		vars[kv.Key] = json.RawMessage(kv.Value.String())
+	})
+
+	state, err := json.Marshal(a.a.DebugState())
+	if err != nil {
+		writeJSONError(w, &httpError{err.Error(), http.StatusInternalServerError})
+		return
+	}
+
+	vars["quotaservice"] = state
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, vars)
+}
+
+func writeGoroutines(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := runtimepprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		_, _ = fmt.Fprintf(w, "Unable to dump goroutines: %v\n", err)
+	}
+}
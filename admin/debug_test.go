@@ -0,0 +1,72 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugRequiresAdmin(t *testing.T) {
+	w := doDebugRequest(NewMockAdministrable(), "mallory", "/api/debug/vars")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden, got %v", w.Code)
+	}
+
+	w = doDebugRequest(NewMockAdministrable(), "", "/api/debug/goroutines")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden, got %v", w.Code)
+	}
+}
+
+func TestDebugVars(t *testing.T) {
+	a := NewMockAdministrable()
+	w := doDebugRequest(a, "admin", "/api/debug/vars")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %v", w.Code)
+	}
+
+	vars := struct {
+		Memstats     map[string]interface{} `json:"memstats"`
+		Quotaservice *DebugState            `json:"quotaservice"`
+	}{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+
+	if vars.Memstats == nil {
+		t.Error("Expected expvars to include memstats")
+	}
+
+	if vars.Quotaservice == nil || vars.Quotaservice.ConfigVersion != a.Configs().Version || vars.Quotaservice.Namespaces["foo"].StaticBuckets != 1 {
+		t.Errorf("Unexpected debug state %+v", vars.Quotaservice)
+	}
+}
+
+func TestDebugGoroutinesAndProfiles(t *testing.T) {
+	w := doDebugRequest(NewMockAdministrable(), "admin", "/api/debug/goroutines")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine ") {
+		t.Errorf("Expected a goroutine dump, got %v: %v", w.Code, w.Body.String())
+	}
+
+	w = doDebugRequest(NewMockAdministrable(), "admin", "/api/debug/pprof/heap?debug=1")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "heap profile") {
+		t.Errorf("Expected a heap profile, got %v: %v", w.Code, w.Body.String())
+	}
+}
+
+func doDebugRequest(a Administrable, user, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", path, strings.NewReader(""))
+	if user != "" {
+		r.Header.Set("X-Forwarded-User", user)
+	}
+
+	newDebugHandler(a).ServeHTTP(w, r)
+	return w
+}
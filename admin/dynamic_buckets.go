@@ -0,0 +1,68 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultDynamicBucketsCount = 100
+
+// DynamicBucket describes a dynamic bucket recorded in a registry of live dynamic buckets.
+type DynamicBucket struct {
+	Name string `json:"name"`
+	// Created is when a server first created the bucket, and LastHit when one last served tokens
+	// from it, as Unix times in millis.
+	Created int64 `json:"created"`
+	LastHit int64 `json:"lastHit"`
+}
+
+// DynamicBucketPage is a page of a namespace's live dynamic buckets.
+type DynamicBucketPage struct {
+	Buckets []*DynamicBucket `json:"buckets"`
+	// Cursor fetches the next page. It is empty on the last page.
+	Cursor string `json:"cursor"`
+}
+
+type dynamicBucketsAPIHandler struct {
+	a Administrable
+}
+
+func newDynamicBucketsAPIHandler(admin Administrable) (a *dynamicBucketsAPIHandler) {
+	return &dynamicBucketsAPIHandler{a: admin}
+}
+
+// ServeHTTP lists a page of a namespace's live dynamic buckets. The "cursor" query parameter
+// continues from a previous page, and "count" sets roughly how many buckets are returned.
+func (a *dynamicBucketsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	namespace := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/dynamicbuckets"), "/")
+	if namespace == "" {
+		writeJSONError(w, &httpError{"No namespace specified", http.StatusBadRequest})
+		return
+	}
+
+	count := defaultDynamicBucketsCount
+	if c := r.URL.Query().Get("count"); c != "" {
+		var err error
+		if count, err = strconv.Atoi(c); err != nil || count < 1 {
+			writeJSONError(w, &httpError{"Invalid count " + c, http.StatusBadRequest})
+			return
+		}
+	}
+
+	page, err := a.a.DynamicBuckets(namespace, r.URL.Query().Get("cursor"), count)
+	if err != nil {
+		writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+		return
+	}
+
+	writeJSON(w, page)
+}
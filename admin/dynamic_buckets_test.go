@@ -0,0 +1,53 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDynamicBuckets(t *testing.T) {
+	page := &DynamicBucketPage{}
+	doDynamicBucketsRequest(t, NewMockAdministrable(), page, "GET", "/api/dynamicbuckets/ns")
+	if len(page.Buckets) != 1 || page.Buckets[0].Name != "b1" || page.Buckets[0].LastHit != 2000 || page.Cursor != "1" {
+		t.Fatalf("Unexpected page %+v", page)
+	}
+
+	page = &DynamicBucketPage{}
+	doDynamicBucketsRequest(t, NewMockAdministrable(), page, "GET", "/api/dynamicbuckets/ns?cursor=1&count=10")
+	if len(page.Buckets) != 1 || page.Buckets[0].Name != "b2" || page.Cursor != "" {
+		t.Fatalf("Unexpected page %+v", page)
+	}
+}
+
+func TestDynamicBucketsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		a                      Administrable
+		method, path, expected string
+	}{
+		{NewMockAdministrable(), "GET", "/api/dynamicbuckets/", "No namespace specified"},
+		{NewMockAdministrable(), "GET", "/api/dynamicbuckets/ns?count=0", "Invalid count 0"},
+		{NewMockAdministrable(), "POST", "/api/dynamicbuckets/ns", "Unknown method POST"},
+		{NewMockErrorAdministrable(), "GET", "/api/dynamicbuckets/ns", "DynamicBuckets"},
+	} {
+		jsonResponse := make(map[string]string)
+		doDynamicBucketsRequest(t, tc.a, &jsonResponse, tc.method, tc.path)
+		if jsonResponse["description"] != tc.expected {
+			t.Errorf("Received \"%s\" from %+v instead of \"%s\"", jsonResponse["description"], jsonResponse, tc.expected)
+		}
+	}
+}
+
+func doDynamicBucketsRequest(t *testing.T, a Administrable, object interface{}, method, path string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(""))
+	newDynamicBucketsAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,143 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+)
+
+const (
+	eventsBufferSize  = 1000
+	keepAliveInterval = 15 * time.Second
+)
+
+type eventsAPIHandler struct {
+	a Administrable
+}
+
+func newEventsAPIHandler(admin Administrable) (a *eventsAPIHandler) {
+	return &eventsAPIHandler{a: admin}
+}
+
+type eventResponse struct {
+	Type       string `json:"type"`
+	Namespace  string `json:"namespace"`
+	Bucket     string `json:"bucket"`
+	Dynamic    bool   `json:"dynamic"`
+	NumTokens  int64  `json:"numTokens"`
+	WaitMillis int64  `json:"waitMillis"`
+	// Labels are those of the event's namespace and bucket, if any.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ConfigVersion and Error are only set for config events.
+	ConfigVersion int32  `json:"configVersion,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ServeHTTP streams live events as server-sent events, until the client disconnects. Events can be
+// filtered with the "namespace" and "type" query parameters, each of which may be repeated.
+func (a *eventsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, &httpError{"Streaming not supported", http.StatusInternalServerError})
+		return
+	}
+
+	namespaces := toSet(r.URL.Query()["namespace"])
+	types := toSet(r.URL.Query()["type"])
+
+	c, unsubscribe := a.a.SubscribeEvents(eventsBufferSize)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-c:
+			if !ok {
+				return
+			}
+
+			if !matches(namespaces, e.Namespace()) || !matches(types, e.EventType().String()) {
+				continue
+			}
+
+			if err := writeEvent(w, e); err != nil {
+				logging.Printf("Error streaming event: %v", err)
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+func newEventResponse(e events.Event) *eventResponse {
+	r := &eventResponse{
+		Type:          e.EventType().String(),
+		Namespace:     e.Namespace(),
+		Bucket:        e.BucketName(),
+		Dynamic:       e.Dynamic(),
+		NumTokens:     e.NumTokens(),
+		WaitMillis:    e.WaitTime().Nanoseconds() / int64(time.Millisecond),
+		Labels:        events.LabelsOf(e),
+		ConfigVersion: events.ConfigVersionOf(e)}
+
+	if err := events.ConfigErrorOf(e); err != nil {
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	b, err := json.Marshal(newEventResponse(e))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.EventType(), b)
+	return err
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s != "" {
+				set[s] = true
+			}
+		}
+	}
+
+	return set
+}
+
+// matches returns true if the set is empty, i.e. no filter was specified, or contains the value.
+func matches(set map[string]bool, value string) bool {
+	return len(set) == 0 || set[value]
+}
@@ -0,0 +1,98 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestEventsStream(t *testing.T) {
+	a := NewMockAdministrable()
+	ts := httptest.NewServer(newEventsAPIHandler(a))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/events?namespace=ns")
+	helpers.CheckError(t, err)
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %v", ct)
+	}
+
+	// Headers are only sent once the handler has subscribed, so these events won't be missed.
+	a.events.HandleEvent(events.NewBucketCreatedEvent("other", "b", false))
+	a.events.HandleEvent(events.WithLabels(events.NewTokensServedEvent("ns", "b", true, 5, 2*time.Millisecond),
+		map[string]string{"team": "quota"}))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	expectLine(t, lines, "event: EVENT_TOKENS_SERVED")
+	data := expectLine(t, lines, "data: ")
+
+	e := &eventResponse{}
+	helpers.CheckError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), e))
+	expected := eventResponse{Type: "EVENT_TOKENS_SERVED", Namespace: "ns", Bucket: "b", Dynamic: true, NumTokens: 5, WaitMillis: 2,
+		Labels: map[string]string{"team": "quota"}}
+	if !reflect.DeepEqual(*e, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, *e)
+	}
+}
+
+func TestEventsFilter(t *testing.T) {
+	set := toSet([]string{"a,b", "c"})
+	for _, s := range []string{"a", "b", "c"} {
+		if !matches(set, s) {
+			t.Errorf("Expected %v to match %v", s, set)
+		}
+	}
+
+	if matches(set, "d") {
+		t.Errorf("Did not expect d to match %v", set)
+	}
+
+	if !matches(toSet(nil), "d") {
+		t.Error("Expected an empty filter to match everything")
+	}
+}
+
+func expectLine(t *testing.T, lines <-chan string, prefix string) string {
+	t.Helper()
+	select {
+	case line := <-lines:
+		if !strings.HasPrefix(line, prefix) {
+			t.Fatalf("Expected line starting with %q, got %q", prefix, line)
+		}
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %q", prefix)
+	}
+
+	return ""
+}
+
+func TestConfigEventResponse(t *testing.T) {
+	r := newEventResponse(events.NewConfigRejectedEvent(12, errors.New("no such quota group")))
+	expected := eventResponse{Type: "EVENT_CONFIG_REJECTED", ConfigVersion: 12, Error: "no such quota group"}
+	if !reflect.DeepEqual(*r, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, *r)
+	}
+}
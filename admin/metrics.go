@@ -0,0 +1,25 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+)
+
+type metricsAPIHandler struct {
+	a Administrable
+}
+
+func newMetricsAPIHandler(admin Administrable) (a *metricsAPIHandler) {
+	return &metricsAPIHandler{a: admin}
+}
+
+func (a *metricsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	writeJSON(w, a.a.HealthMetrics())
+}
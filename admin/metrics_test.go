@@ -0,0 +1,27 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/square/quotaservice/metrics"
+)
+
+func TestHealthMetrics(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/metrics", strings.NewReader(""))
+	newMetricsAPIHandler(NewMockAdministrable()).ServeHTTP(w, r)
+
+	h := &metrics.Health{}
+	if err := unmarshalJSON(w.Body, h); err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Runtime == nil || h.Runtime.Goroutines != 1 || h.ConfigReloads != 1 {
+		t.Errorf("Unexpected health metrics %+v", h)
+	}
+}
@@ -40,7 +40,7 @@ func (a *namespacesAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		err := a.a.DeleteNamespace(ns, user)
 
 		if err != nil {
-			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			writeJSONError(w, mutationError(err, http.StatusBadRequest))
 		} else {
 			writeJSONOk(w)
 		}
@@ -96,7 +96,7 @@ func updateConfig(a *namespacesAPIHandler, w http.ResponseWriter, r *http.Reques
 	e = a.a.UpdateConfig(c, getUsername(r))
 
 	if e != nil {
-		writeJSONError(w, &httpError{e.Error(), http.StatusInternalServerError})
+		writeJSONError(w, mutationError(e, http.StatusInternalServerError))
 	} else {
 		writeJSONOk(w)
 	}
@@ -117,7 +117,7 @@ func changeNamespace(w http.ResponseWriter, r *http.Request, namespace string, u
 	e = updater(c)
 
 	if e != nil {
-		writeJSONError(w, &httpError{e.Error(), http.StatusInternalServerError})
+		writeJSONError(w, mutationError(e, http.StatusInternalServerError))
 	} else {
 		writeJSONOk(w)
 	}
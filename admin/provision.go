@@ -0,0 +1,49 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+)
+
+type provisionAPIHandler struct {
+	a Administrable
+}
+
+func newProvisionAPIHandler(admin Administrable) (a *provisionAPIHandler) {
+	return &provisionAPIHandler{a: admin}
+}
+
+type provisionRequest struct {
+	Template string `json:"template"`
+}
+
+// ServeHTTP creates a namespace from a namespace template, unless it already exists, so that
+// onboarding automation can safely call it repeatedly.
+func (a *provisionAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "PUT" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	ns := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/provision"), "/")
+	if ns == "" {
+		writeJSONError(w, &httpError{"No namespace specified", http.StatusBadRequest})
+		return
+	}
+
+	req := &provisionRequest{}
+	if err := unmarshalJSON(r.Body, req); err != nil {
+		writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+		return
+	}
+
+	if err := a.a.EnsureNamespace(ns, req.Template, getUsername(r)); err != nil {
+		writeJSONError(w, mutationError(err, http.StatusBadRequest))
+		return
+	}
+
+	writeJSONOk(w)
+}
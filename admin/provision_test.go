@@ -0,0 +1,43 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProvision(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doProvisionRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/provision/test", `{"template": "tpl"}`)
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received non-empty response \"%+v\"", jsonResponse)
+	}
+}
+
+func TestProvisionErrors(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doProvisionRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST", "/api/provision/test", `{"template": "tpl"}`)
+	if jsonResponse["description"] != "EnsureNamespace" {
+		t.Errorf("Received \"%s\" from %+v instead of \"EnsureNamespace\"", jsonResponse["description"], jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doProvisionRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/provision/", "")
+	if jsonResponse["description"] != "No namespace specified" {
+		t.Errorf("Received \"%s\" from %+v instead of \"No namespace specified\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doProvisionRequest(t *testing.T, a Administrable, object interface{}, method, path, body string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	newProvisionAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
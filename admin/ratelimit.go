@@ -0,0 +1,41 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ErrRateLimited is returned when an identity has made too many requests to change state through
+// the admin API.
+var ErrRateLimited = errors.New("too many admin API requests; slow down and retry later")
+
+// rateLimitHandler rejects requests to change state from identities over the admin API's rate
+// limit. Reads aren't limited.
+func rateLimitHandler(a Administrable, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && !a.AllowAdminRequest(getIdentity(r)) {
+			writeJSONError(w, &httpError{ErrRateLimited.Error(), http.StatusTooManyRequests})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getIdentity returns the user making a request, or the client's address, without its port, if the
+// request doesn't identify a user.
+func getIdentity(r *http.Request) string {
+	if username, exists := r.Header["X-Forwarded-User"]; exists {
+		return username[0]
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
@@ -0,0 +1,46 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	handler := rateLimitHandler(NewMockAdministrable(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONOk(w)
+	}))
+
+	for _, test := range []struct {
+		method, user string
+		status       int
+	}{
+		{"POST", "hammer", http.StatusTooManyRequests},
+		{"GET", "hammer", http.StatusOK},
+		{"POST", "alice", http.StatusOK},
+	} {
+		req := httptest.NewRequest(test.method, "/api/ns", nil)
+		req.Header.Set("X-Forwarded-User", test.user)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("Expected %v for a %v by %v, got %v", test.status, test.method, test.user, w.Code)
+		}
+	}
+}
+
+func TestGetIdentity(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/ns", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	if identity := getIdentity(req); identity != "10.0.0.1" {
+		t.Errorf("Expected the client's address, got %v", identity)
+	}
+
+	req.Header.Set("X-Forwarded-User", "alice")
+	if identity := getIdentity(req); identity != "alice" {
+		t.Errorf("Expected the user, got %v", identity)
+	}
+}
@@ -0,0 +1,69 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrReadOnly is returned when attempting to change configuration while the admin API is in
+// read-only mode.
+var ErrReadOnly = errors.New("the admin API is in read-only mode; configuration changes are frozen")
+
+// ErrFollower is returned when attempting to change configuration, or the state of buckets, on a
+// server running as a follower.
+var ErrFollower = errors.New("this server is a read-only follower; make changes on another server")
+
+// ErrNotAuthorized is returned when a user isn't allowed to toggle read-only mode.
+var ErrNotAuthorized = errors.New("user is not authorized to toggle read-only mode")
+
+type readOnlyAPIHandler struct {
+	a Administrable
+}
+
+func newReadOnlyAPIHandler(admin Administrable) (a *readOnlyAPIHandler) {
+	return &readOnlyAPIHandler{a: admin}
+}
+
+type readOnlyResponse struct {
+	ReadOnly bool `json:"read_only"`
+}
+
+func (a *readOnlyAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, &readOnlyResponse{a.a.ReadOnly()})
+	case "PUT", "POST":
+		req := &readOnlyResponse{}
+		if err := unmarshalJSON(r.Body, req); err != nil {
+			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			return
+		}
+
+		err := a.a.SetReadOnly(req.ReadOnly, getUsername(r))
+		switch {
+		case err == ErrNotAuthorized:
+			writeJSONError(w, &httpError{err.Error(), http.StatusForbidden})
+		case err != nil:
+			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+		default:
+			writeJSON(w, &readOnlyResponse{a.a.ReadOnly()})
+		}
+	default:
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+	}
+}
+
+// readOnlyHandler rejects mutations while the admin API is in read-only mode.
+func readOnlyHandler(a Administrable, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && a.ReadOnly() {
+			writeJSONError(w, &httpError{ErrReadOnly.Error(), http.StatusForbidden})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyToggle(t *testing.T) {
+	a := NewMockAdministrable()
+
+	response := &readOnlyResponse{}
+	doReadOnlyRequest(t, newReadOnlyAPIHandler(a), response, "PUT", `{"read_only": true}`)
+	if !response.ReadOnly || !a.ReadOnly() {
+		t.Fatalf("Expected read-only mode to be enabled: %+v", response)
+	}
+
+	response = &readOnlyResponse{}
+	doReadOnlyRequest(t, newReadOnlyAPIHandler(a), response, "GET", "")
+	if !response.ReadOnly {
+		t.Fatalf("Expected read-only mode to be reported: %+v", response)
+	}
+}
+
+func TestReadOnlyToggleError(t *testing.T) {
+	a := NewMockErrorAdministrable()
+
+	jsonResponse := make(map[string]string)
+	doReadOnlyRequest(t, newReadOnlyAPIHandler(a), &jsonResponse, "PUT", `{"read_only": true}`)
+	if jsonResponse["description"] != "SetReadOnly" {
+		t.Errorf("Received \"%s\" from %+v instead of \"SetReadOnly\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestReadOnlyRejectsMutations(t *testing.T) {
+	a := NewMockAdministrable()
+	a.readOnly = true
+	handler := readOnlyHandler(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONOk(w)
+	}))
+
+	jsonResponse := make(map[string]string)
+	doReadOnlyRequest(t, handler, &jsonResponse, "POST", "")
+	if jsonResponse["error"] != http.StatusText(http.StatusForbidden) || jsonResponse["description"] != ErrReadOnly.Error() {
+		t.Errorf("Expected 403 Forbidden, but received \"%+v\"", jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doReadOnlyRequest(t, handler, &jsonResponse, "GET", "")
+	if jsonResponse["error"] != "" {
+		t.Errorf("GET request should succeed in read-only mode: %+v", jsonResponse)
+	}
+}
+
+func doReadOnlyRequest(t *testing.T, handler http.Handler, object interface{}, method, body string) {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	request, err := http.NewRequest(method, ts.URL+"/api/readonly", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := (&http.Client{}).Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = unmarshalJSON(res.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,57 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultRecentEventsLimit = 100
+
+type recentEventsAPIHandler struct {
+	a Administrable
+}
+
+func newRecentEventsAPIHandler(admin Administrable) (a *recentEventsAPIHandler) {
+	return &recentEventsAPIHandler{a: admin}
+}
+
+type recentEventResponse struct {
+	eventResponse
+	Time int64 `json:"time"`
+}
+
+type recentEventsResponse struct {
+	Events []*recentEventResponse `json:"events"`
+}
+
+// ServeHTTP returns the most recent events, newest first. Events can be filtered with the
+// "namespace" query parameter, and the number returned set with "limit".
+func (a *recentEventsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	limit := defaultRecentEventsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+			writeJSONError(w, &httpError{"Invalid limit " + l, http.StatusBadRequest})
+			return
+		}
+	}
+
+	recent := a.a.RecentEvents(r.URL.Query().Get("namespace"), limit)
+	rsp := &recentEventsResponse{Events: make([]*recentEventResponse, 0, len(recent))}
+	for _, e := range recent {
+		rsp.Events = append(rsp.Events, &recentEventResponse{
+			eventResponse: *newEventResponse(e.Event),
+			Time:          e.Time.UnixNano() / int64(time.Millisecond)})
+	}
+
+	writeJSON(w, rsp)
+}
@@ -0,0 +1,54 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecentEvents(t *testing.T) {
+	rsp := &recentEventsResponse{}
+	doRecentEventsRequest(t, NewMockAdministrable(), rsp, "GET", "/api/events/recent?namespace=ns")
+	if len(rsp.Events) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", rsp.Events)
+	}
+
+	e := rsp.Events[0]
+	if e.Type != "EVENT_TIMEOUT_SERVING_TOKENS" || e.Namespace != "ns" || e.Bucket != "b" || e.NumTokens != 5 || e.Time != 1000000 {
+		t.Errorf("Unexpected event %+v", e.eventResponse)
+	}
+
+	rsp = &recentEventsResponse{}
+	doRecentEventsRequest(t, NewMockAdministrable(), rsp, "GET", "/api/events/recent?limit=1")
+	if len(rsp.Events) != 1 {
+		t.Fatalf("Expected 1 event, got %+v", rsp.Events)
+	}
+}
+
+func TestRecentEventsErrors(t *testing.T) {
+	for _, tc := range []struct{ method, path, expected string }{
+		{"GET", "/api/events/recent?limit=x", "Invalid limit x"},
+		{"GET", "/api/events/recent?limit=0", "Invalid limit 0"},
+		{"POST", "/api/events/recent", "Unknown method POST"},
+	} {
+		jsonResponse := make(map[string]string)
+		doRecentEventsRequest(t, NewMockAdministrable(), &jsonResponse, tc.method, tc.path)
+		if jsonResponse["description"] != tc.expected {
+			t.Errorf("Received \"%s\" from %+v instead of \"%s\"", jsonResponse["description"], jsonResponse, tc.expected)
+		}
+	}
+}
+
+func doRecentEventsRequest(t *testing.T, a Administrable, object interface{}, method, path string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(""))
+	newRecentEventsAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+// Recommendation suggests a fill rate and size for a bucket, based on the traffic it has seen.
+type Recommendation struct {
+	Namespace string `json:"namespace"`
+	// Bucket is the bucket's name, or the dynamic bucket template's name if the recommendation is
+	// for the namespace's dynamic buckets.
+	Bucket string `json:"bucket"`
+	// Samples is the number of intervals of traffic observed.
+	Samples int `json:"samples"`
+	// ObservedRate is the configured percentile of the tokens requested per second, across
+	// intervals. PeakTokens is the most tokens requested in a single interval.
+	ObservedRate float64 `json:"observedRate"`
+	PeakTokens   int64   `json:"peakTokens"`
+
+	CurrentFillRate int64 `json:"currentFillRate"`
+	CurrentSize     int64 `json:"currentSize"`
+	FillRate        int64 `json:"fillRate"`
+	Size            int64 `json:"size"`
+}
+
+// RecommendationReport lists recommended changes to bucket configs.
+type RecommendationReport struct {
+	Recommendations []*Recommendation `json:"recommendations"`
+	// Candidate is the current config with all recommendations applied. Once reviewed, it can be
+	// applied as is with POST /api.
+	Candidate *pb.ServiceConfig `json:"candidate"`
+}
+
+type recommendationsAPIHandler struct {
+	a Administrable
+}
+
+func newRecommendationsAPIHandler(admin Administrable) (a *recommendationsAPIHandler) {
+	return &recommendationsAPIHandler{a: admin}
+}
+
+// ServeHTTP reports recommended changes to bucket configs. Nothing is changed.
+func (a *recommendationsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	report, err := a.a.Recommendations()
+	if err != nil {
+		writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+		return
+	}
+
+	writeJSON(w, report)
+}
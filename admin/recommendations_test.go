@@ -0,0 +1,45 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecommendations(t *testing.T) {
+	report := &RecommendationReport{}
+	doRecommendationsRequest(t, NewMockAdministrable(), report, "GET")
+	if len(report.Recommendations) != 1 || report.Recommendations[0].FillRate != 15 || report.Candidate == nil {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestRecommendationsError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doRecommendationsRequest(t, NewMockErrorAdministrable(), &jsonResponse, "GET")
+	if jsonResponse["description"] != "Recommendations" {
+		t.Errorf("Received \"%s\" from %+v instead of \"Recommendations\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestRecommendationsUnknownMethod(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doRecommendationsRequest(t, NewMockAdministrable(), &jsonResponse, "POST")
+	if jsonResponse["description"] != "Unknown method POST" {
+		t.Errorf("Received \"%s\" from %+v instead of unknown method", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doRecommendationsRequest(t *testing.T, a Administrable, object interface{}, method string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/recommendations", strings.NewReader(""))
+	newRecommendationsAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,38 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+)
+
+type resetAPIHandler struct {
+	a Administrable
+}
+
+func newResetAPIHandler(admin Administrable) (a *resetAPIHandler) {
+	return &resetAPIHandler{a: admin}
+}
+
+// ServeHTTP restores a bucket to full capacity.
+func (a *resetAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	params := strings.SplitN(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/reset"), "/"), "/", 2)
+	if len(params) != 2 || params[0] == "" || params[1] == "" {
+		writeJSONError(w, &httpError{"No bucket specified", http.StatusBadRequest})
+		return
+	}
+
+	if err := a.a.ResetBucket(params[0], params[1], getUsername(r)); err != nil {
+		writeJSONError(w, mutationError(err, http.StatusBadRequest))
+		return
+	}
+
+	writeJSONOk(w)
+}
@@ -0,0 +1,45 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doResetRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/reset/ns/b")
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received non-empty response \"%+v\"", jsonResponse)
+	}
+}
+
+func TestResetError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doResetRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST", "/api/reset/ns/b")
+	if jsonResponse["description"] != "ResetBucket" {
+		t.Errorf("Received \"%s\" from %+v instead of \"ResetBucket\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestResetNoBucket(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doResetRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/reset/ns/")
+	if jsonResponse["description"] != "No bucket specified" {
+		t.Errorf("Received \"%s\" from %+v instead of \"No bucket specified\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doResetRequest(t *testing.T, a Administrable, object interface{}, method, path string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(""))
+	newResetAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
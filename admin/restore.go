@@ -0,0 +1,38 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+)
+
+type restoreAPIHandler struct {
+	a Administrable
+}
+
+func newRestoreAPIHandler(admin Administrable) (a *restoreAPIHandler) {
+	return &restoreAPIHandler{a: admin}
+}
+
+// ServeHTTP restores a soft-deleted namespace.
+func (a *restoreAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	ns := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/restore"), "/")
+	if ns == "" {
+		writeJSONError(w, &httpError{"No namespace specified", http.StatusBadRequest})
+		return
+	}
+
+	if err := a.a.RestoreNamespace(ns, getUsername(r)); err != nil {
+		writeJSONError(w, mutationError(err, http.StatusBadRequest))
+		return
+	}
+
+	writeJSONOk(w)
+}
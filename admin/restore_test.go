@@ -0,0 +1,37 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doRestoreRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/restore/test")
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received non-empty response \"%+v\"", jsonResponse)
+	}
+}
+
+func TestRestoreError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doRestoreRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST", "/api/restore/test")
+	if jsonResponse["description"] != "RestoreNamespace" {
+		t.Errorf("Received \"%s\" from %+v instead of \"RestoreNamespace\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doRestoreRequest(t *testing.T, a Administrable, object interface{}, method, path string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(""))
+	newRestoreAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
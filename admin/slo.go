@@ -0,0 +1,53 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+)
+
+// SLOStatus reports how many of the requests a bucket granted within the SLO window waited longer
+// than its threshold.
+type SLOStatus struct {
+	Namespace       string `json:"namespace"`
+	Bucket          string `json:"bucket"`
+	Dynamic         bool   `json:"dynamic"`
+	ThresholdMillis int64  `json:"thresholdMillis"`
+	// Objective is the fraction of granted requests that must wait no longer than the threshold.
+	Objective float64 `json:"objective"`
+	Granted   int64   `json:"granted"`
+	Slow      int64   `json:"slow"`
+	// WithinThreshold is the fraction of granted requests that waited no longer than the threshold.
+	WithinThreshold float64 `json:"withinThreshold"`
+	Breached        bool    `json:"breached"`
+}
+
+// SLOReport lists the SLO status of buckets that granted requests within the SLO window.
+type SLOReport struct {
+	Buckets []*SLOStatus `json:"buckets"`
+}
+
+type sloAPIHandler struct {
+	a Administrable
+}
+
+func newSLOAPIHandler(admin Administrable) (a *sloAPIHandler) {
+	return &sloAPIHandler{a: admin}
+}
+
+// ServeHTTP reports the SLO status of buckets.
+func (a *sloAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	report, err := a.a.SLOs()
+	if err != nil {
+		writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+		return
+	}
+
+	writeJSON(w, report)
+}
@@ -0,0 +1,45 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSLOs(t *testing.T) {
+	report := &SLOReport{}
+	doSLORequest(t, NewMockAdministrable(), report, "GET")
+	if len(report.Buckets) != 1 || !report.Buckets[0].Breached || report.Buckets[0].Slow != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestSLOsError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doSLORequest(t, NewMockErrorAdministrable(), &jsonResponse, "GET")
+	if jsonResponse["description"] != "SLOs" {
+		t.Errorf("Received \"%s\" from %+v instead of \"SLOs\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestSLOsUnknownMethod(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doSLORequest(t, NewMockAdministrable(), &jsonResponse, "POST")
+	if jsonResponse["description"] != "Unknown method POST" {
+		t.Errorf("Received \"%s\" from %+v instead of unknown method", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func doSLORequest(t *testing.T, a Administrable, object interface{}, method string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/slo", strings.NewReader(""))
+	newSLOAPIHandler(a).ServeHTTP(w, r)
+
+	if err := unmarshalJSON(w.Body, object); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/stats"
 )
 
@@ -18,6 +19,14 @@ type bucketStats struct {
 	Ns     string               `json:"namespace"`
 	Hits   []*stats.BucketScore `json:"topHits"`
 	Misses []*stats.BucketScore `json:"topMisses"`
+	// Labels are those of the namespace's dynamic buckets.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Totals are those of all the namespace's tracked buckets.
+	Totals *stats.AggregateStats `json:"totals,omitempty"`
+}
+
+type globalStats struct {
+	Totals *stats.AggregateStats `json:"totals"`
 }
 
 func newStatsAPIHandler(admin Administrable) (a *statsAPIHandler) {
@@ -33,7 +42,13 @@ func (a *statsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if ns == "" {
-		writeJSONError(w, &httpError{"No namespace specified", http.StatusBadRequest})
+		totals := a.a.GlobalStats()
+		if totals == nil {
+			writeJSONError(w, &httpError{"No stats listener configured", http.StatusBadRequest})
+			return
+		}
+
+		writeJSON(w, &globalStats{totals})
 		return
 	}
 
@@ -79,7 +94,7 @@ func writeStats(a *statsAPIHandler, w http.ResponseWriter, path string) *httpErr
 		return &httpError{"No stats listener configured", http.StatusBadRequest}
 	}
 
-	writeJSON(w, &bucketStats{namespace, hits, misses})
+	writeJSON(w, &bucketStats{namespace, hits, misses, config.BucketLabels(cfgs, namespace, ""), a.a.NamespaceStats(namespace)})
 
 	return nil
 }
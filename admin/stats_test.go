@@ -17,10 +17,10 @@ func TestStatsErrors(t *testing.T) {
 	a := NewMockAdministrable()
 	jsonResponse := make(map[string]string)
 
-	doStatsRequest(t, a, &jsonResponse, "GET", "/api/stats", "")
+	doStatsRequest(t, NewMockErrorAdministrable(), &jsonResponse, "GET", "/api/stats", "")
 
-	if jsonResponse["description"] != "No namespace specified" {
-		t.Errorf("Received \"%s\" from %+v instead of \"No namespace specified\"",
+	if jsonResponse["description"] != "No stats listener configured" {
+		t.Errorf("Received \"%s\" from %+v instead of \"No stats listener configured\"",
 			jsonResponse["description"], jsonResponse)
 	}
 
@@ -43,6 +43,7 @@ func TestStatsGet(t *testing.T) {
 	a := NewMockAdministrable()
 
 	testNamespace := config.NewDefaultNamespaceConfig("test")
+	testNamespace.Labels = map[string]string{"team": "quota"}
 	a.Configs().Namespaces["test"] = testNamespace
 
 	nsResponse := &bucketStats{}
@@ -52,6 +53,21 @@ func TestStatsGet(t *testing.T) {
 		t.Errorf("Received %+v instead of [Ns=test, Hits=[], Misses=[]]", nsResponse)
 	}
 
+	if nsResponse.Labels["team"] != "quota" {
+		t.Errorf("Expected the namespace's labels, got %+v", nsResponse.Labels)
+	}
+
+	if nsResponse.Totals == nil || nsResponse.Totals.Hits != 10 || nsResponse.Totals.ActiveBuckets != 2 {
+		t.Errorf("Expected the namespace's totals, got %+v", nsResponse.Totals)
+	}
+
+	globalResponse := &globalStats{}
+	doStatsRequest(t, a, globalResponse, "GET", "/api/stats", "")
+
+	if globalResponse.Totals == nil || globalResponse.Totals.Created != 6 || globalResponse.Totals.Removed != 2 {
+		t.Errorf("Expected the global totals, got %+v", globalResponse.Totals)
+	}
+
 	a = NewMockErrorAdministrable()
 	a.Configs().Namespaces["test"] = testNamespace
 
@@ -5,23 +5,29 @@ package admin
 
 import (
 	"errors"
+	"time"
 
 	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/metrics"
 	pb "github.com/square/quotaservice/protos/config"
 	"github.com/square/quotaservice/stats"
 )
 
 type MockAdministrable struct {
-	cfg    *pb.ServiceConfig
-	errors bool
+	cfg      *pb.ServiceConfig
+	errors   bool
+	readOnly bool
+	events   *events.Broadcaster
+	pending  []*PendingChange
 }
 
 func NewMockErrorAdministrable() *MockAdministrable {
-	return &MockAdministrable{config.NewDefaultServiceConfig(), true}
+	return &MockAdministrable{config.NewDefaultServiceConfig(), true, false, events.NewBroadcaster(), nil}
 }
 
 func NewMockAdministrable() *MockAdministrable {
-	return &MockAdministrable{config.NewDefaultServiceConfig(), false}
+	return &MockAdministrable{config.NewDefaultServiceConfig(), false, false, events.NewBroadcaster(), nil}
 }
 
 func (m *MockAdministrable) Configs() *pb.ServiceConfig {
@@ -36,6 +42,22 @@ func (m *MockAdministrable) UpdateConfig(config *pb.ServiceConfig, user string)
 	return nil
 }
 
+func (m *MockAdministrable) ExportConfig(user string) (*config.Bundle, error) {
+	if m.errors {
+		return nil, errors.New("ExportConfig")
+	}
+
+	return &config.Bundle{FormatVersion: config.BundleFormatVersion, ConfigVersion: 1, ExportedBy: user}, nil
+}
+
+func (m *MockAdministrable) ImportConfig(*config.Bundle, string) error {
+	if m.errors {
+		return errors.New("ImportConfig")
+	}
+
+	return nil
+}
+
 func (m *MockAdministrable) DeleteBucket(namespace, name, user string) error {
 	if m.errors {
 		return errors.New("DeleteBucket")
@@ -84,6 +106,89 @@ func (m *MockAdministrable) UpdateNamespace(n *pb.NamespaceConfig, user string)
 	return nil
 }
 
+func (m *MockAdministrable) RestoreNamespace(namespace, user string) error {
+	if m.errors {
+		return errors.New("RestoreNamespace")
+	}
+
+	return nil
+}
+
+func (m *MockAdministrable) EnsureNamespace(name, template, user string) error {
+	if m.errors {
+		return errors.New("EnsureNamespace")
+	}
+
+	return nil
+}
+
+func (m *MockAdministrable) CloneNamespace(string, string, config.CloneOverrides, string) error {
+	if m.errors {
+		return errors.New("CloneNamespace")
+	}
+
+	return nil
+}
+
+func (m *MockAdministrable) PendingChanges() []*PendingChange {
+	return m.pending
+}
+
+func (m *MockAdministrable) ApproveChange(id, user string) error {
+	return m.resolveChange(id, user)
+}
+
+func (m *MockAdministrable) RejectChange(id, user string) error {
+	return m.resolveChange(id, user)
+}
+
+func (m *MockAdministrable) resolveChange(id, user string) error {
+	if m.errors {
+		return ErrNotApprover
+	}
+
+	for i, c := range m.pending {
+		if c.ID == id {
+			if c.User == user {
+				return ErrSelfApproval
+			}
+
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNoSuchChange
+}
+
+func (m *MockAdministrable) ReadOnly() bool {
+	return m.readOnly
+}
+
+func (m *MockAdministrable) SetReadOnly(readOnly bool, user string) error {
+	if m.errors {
+		return errors.New("SetReadOnly")
+	}
+
+	m.readOnly = readOnly
+	return nil
+}
+
+func (m *MockAdministrable) SubscribeEvents(bufSize int) (<-chan events.Event, func()) {
+	return m.events.Subscribe(bufSize)
+}
+
+func (m *MockAdministrable) RecentEvents(namespace string, limit int) []events.RecordedEvent {
+	recent := []events.RecordedEvent{
+		{Event: events.NewTimedOutEvent(namespace, "b", false, 5), Time: time.Unix(1000, 0)},
+		{Event: events.NewBucketCreatedEvent(namespace, "b", false), Time: time.Unix(999, 0)}}
+	if limit > 0 && limit < len(recent) {
+		recent = recent[:limit]
+	}
+
+	return recent
+}
+
 func (m *MockAdministrable) TopDynamicHits(namespace string) []*stats.BucketScore {
 	if m.errors {
 		return nil
@@ -108,6 +213,40 @@ func (m *MockAdministrable) DynamicBucketStats(namespace, bucket string) *stats.
 	return &stats.BucketScores{Hits: 0, Misses: 0}
 }
 
+func (m *MockAdministrable) NamespaceStats(namespace string) *stats.AggregateStats {
+	if m.errors {
+		return nil
+	}
+
+	return &stats.AggregateStats{Hits: 10, Misses: 2, Created: 3, Removed: 1, ActiveBuckets: 2}
+}
+
+func (m *MockAdministrable) GlobalStats() *stats.AggregateStats {
+	if m.errors {
+		return nil
+	}
+
+	return &stats.AggregateStats{Hits: 20, Misses: 4, Created: 6, Removed: 2, ActiveBuckets: 4}
+}
+
+func (m *MockAdministrable) HealthMetrics() *metrics.Health {
+	return &metrics.Health{Runtime: &metrics.Runtime{Goroutines: 1}, ConfigReloads: 1}
+}
+
+func (m *MockAdministrable) AllowAdminRequest(identity string) bool {
+	return identity != "hammer"
+}
+
+func (m *MockAdministrable) IsAdmin(user string) bool {
+	return !m.errors && user == "admin"
+}
+
+func (m *MockAdministrable) DebugState() *DebugState {
+	return &DebugState{
+		ConfigVersion: m.Configs().Version,
+		Namespaces:    map[string]*NamespaceDebugState{"foo": {StaticBuckets: 1}}}
+}
+
 func (m *MockAdministrable) HistoricalConfigs() ([]*pb.ServiceConfig, error) {
 	if m.errors {
 		return nil, errors.New("HistoricalConfigs")
@@ -115,3 +254,89 @@ func (m *MockAdministrable) HistoricalConfigs() ([]*pb.ServiceConfig, error) {
 
 	return make([]*pb.ServiceConfig, 1), nil
 }
+
+func (m *MockAdministrable) Recommendations() (*RecommendationReport, error) {
+	if m.errors {
+		return nil, errors.New("Recommendations")
+	}
+
+	return &RecommendationReport{
+		Recommendations: []*Recommendation{{Namespace: "ns", Bucket: "b", FillRate: 15, Size: 30}},
+		Candidate:       m.Configs()}, nil
+}
+
+func (m *MockAdministrable) SLOs() (*SLOReport, error) {
+	if m.errors {
+		return nil, errors.New("SLOs")
+	}
+
+	return &SLOReport{Buckets: []*SLOStatus{{Namespace: "ns", Bucket: "b", Granted: 10, Slow: 1, Breached: true}}}, nil
+}
+
+func (m *MockAdministrable) Dashboard(namespace string) (*Dashboard, error) {
+	if m.errors {
+		return nil, errors.New("Dashboard")
+	}
+
+	if namespace == "" {
+		namespace = "ns"
+	}
+
+	return &Dashboard{
+		WindowMinutes: 1,
+		Namespaces: []*NamespaceDashboard{{
+			Namespace: namespace,
+			Granted:   10,
+			Denied:    2,
+			Rates:     []*RatePoint{{Time: 60, Granted: 10, Denied: 2}}}},
+		ConfigChanges: []*ConfigChange{{Version: 2, User: "alice", Date: 1000}}}, nil
+}
+
+func (m *MockAdministrable) DynamicBuckets(namespace, cursor string, count int) (*DynamicBucketPage, error) {
+	if m.errors {
+		return nil, errors.New("DynamicBuckets")
+	}
+
+	if cursor != "" {
+		return &DynamicBucketPage{Buckets: []*DynamicBucket{{Name: "b2", Created: 2000, LastHit: 3000}}}, nil
+	}
+
+	return &DynamicBucketPage{Buckets: []*DynamicBucket{{Name: "b1", Created: 1000, LastHit: 2000}}, Cursor: "1"}, nil
+}
+
+func (m *MockAdministrable) BucketDebt(namespace, bucket string) (*BucketDebt, error) {
+	if m.errors {
+		return nil, errors.New("BucketDebt")
+	}
+
+	return &BucketDebt{Namespace: namespace, Bucket: bucket, Tokens: -5, DebtTokens: 5, DebtMillis: 5000}, nil
+}
+
+func (m *MockAdministrable) ForgiveDebt(string, string, string) error {
+	if m.errors {
+		return errors.New("ForgiveDebt")
+	}
+
+	return nil
+}
+
+func (m *MockAdministrable) ResetBucket(string, string, string) error {
+	if m.errors {
+		return errors.New("ResetBucket")
+	}
+
+	return nil
+}
+
+func (m *MockAdministrable) CleanStaleBuckets(dryRun bool, _ string) (*CleanupReport, error) {
+	if m.errors {
+		return nil, errors.New("CleanStaleBuckets")
+	}
+
+	r := &CleanupReport{DryRun: dryRun, Scanned: 3, Stale: 1, Keys: []string{"{ns:b}:1"}}
+	if !dryRun {
+		r.Deleted = 1
+	}
+
+	return r, nil
+}
@@ -0,0 +1,90 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"sync"
+	"time"
+)
+
+// maxIdleAdminIdentities is how many identities the admin rate limiter tracks before forgetting
+// those that have no requests to be paid back.
+const maxIdleAdminIdentities = 1024
+
+// adminRateLimiter limits each identity's requests to change state through the admin API to a
+// steady rate, allowing bursts of up to burst requests. Each identity's next permitted request is
+// tracked as a theoretical arrival time, which advances by the interval between requests on every
+// request allowed.
+type adminRateLimiter struct {
+	sync.Mutex
+	interval time.Duration
+	burst    int
+	arrivals map[string]time.Time
+	now      func() time.Time
+}
+
+func newAdminRateLimiter(requestsPerSecond float64, burst int, now func() time.Time) *adminRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &adminRateLimiter{
+		interval: time.Duration(float64(time.Second) / requestsPerSecond),
+		burst:    burst,
+		arrivals: make(map[string]time.Time),
+		now:      now}
+}
+
+func (l *adminRateLimiter) allow(identity string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	arrival := l.arrivals[identity]
+	if arrival.Before(now) {
+		arrival = now
+	}
+
+	next := arrival.Add(l.interval)
+	if next.Sub(now) > l.interval*time.Duration(l.burst) {
+		return false
+	}
+
+	if len(l.arrivals) >= maxIdleAdminIdentities {
+		l.forgetIdle(now)
+	}
+
+	l.arrivals[identity] = next
+	return true
+}
+
+// forgetIdle forgets identities whose requests have all been paid back, which are treated the same
+// as identities that have never made a request.
+func (l *adminRateLimiter) forgetIdle(now time.Time) {
+	for identity, arrival := range l.arrivals {
+		if !arrival.After(now) {
+			delete(l.arrivals, identity)
+		}
+	}
+}
+
+func (s *server) SetAdminRateLimit(requestsPerSecond float64, burst int) {
+	s.Lock()
+	defer s.Unlock()
+
+	if requestsPerSecond <= 0 {
+		s.adminRateLimiter = nil
+		return
+	}
+
+	s.adminRateLimiter = newAdminRateLimiter(requestsPerSecond, burst, s.now)
+}
+
+func (s *server) AllowAdminRequest(identity string) bool {
+	s.RLock()
+	l := s.adminRateLimiter
+	s.RUnlock()
+
+	return l == nil || l.allow(identity)
+}
@@ -0,0 +1,66 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAdminRateLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newAdminRateLimiter(2, 3, func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		if !l.allow("alice") {
+			t.Fatalf("Expected request %v of a burst to be allowed", i)
+		}
+	}
+
+	if l.allow("alice") {
+		t.Fatal("Expected a request over the burst to be rejected")
+	}
+
+	if !l.allow("bob") {
+		t.Fatal("Expected identities to be limited separately")
+	}
+
+	// Requests are paid back at 2 a second.
+	now = now.Add(500 * time.Millisecond)
+	if !l.allow("alice") || l.allow("alice") {
+		t.Fatal("Expected a single request to be allowed after half a second")
+	}
+}
+
+func TestAdminRateLimiterForgetsIdleIdentities(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newAdminRateLimiter(1, 1, func() time.Time { return now })
+
+	for i := 0; i < maxIdleAdminIdentities; i++ {
+		l.allow(fmt.Sprint(i))
+	}
+
+	now = now.Add(time.Second)
+	if !l.allow("alice") || len(l.arrivals) != 1 {
+		t.Fatalf("Expected idle identities to be forgotten, tracking %v", len(l.arrivals))
+	}
+}
+
+func TestAllowAdminRequest(t *testing.T) {
+	s := &server{now: time.Now}
+	if !s.AllowAdminRequest("alice") || !s.AllowAdminRequest("alice") {
+		t.Fatal("Expected admin requests not to be limited by default")
+	}
+
+	s.SetAdminRateLimit(1, 1)
+	if !s.AllowAdminRequest("alice") || s.AllowAdminRequest("alice") {
+		t.Fatal("Expected admin requests to be limited")
+	}
+
+	s.SetAdminRateLimit(0, 0)
+	if !s.AllowAdminRequest("alice") {
+		t.Fatal("Expected the limit to be disabled")
+	}
+}
@@ -0,0 +1,56 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// admissionController caps the number of concurrent Allow requests, globally and per namespace,
+// so the quota service degrades gracefully under overload instead of queueing indefinitely.
+type admissionController struct {
+	global      int64
+	byNamespace sync.Map // map[string]*int64
+}
+
+// admit attempts to admit a request to the given namespace, given the global and namespace limits.
+// Limits <= 0 are treated as unlimited. If admitted, the returned function must be called once the
+// request completes.
+func (a *admissionController) admit(namespace string, globalLimit, namespaceLimit int64) (func(), error) {
+	if n := atomic.AddInt64(&a.global, 1); globalLimit > 0 && n > globalLimit {
+		atomic.AddInt64(&a.global, -1)
+		return nil, newError(fmt.Sprintf("Too many requests in flight; limit is %v", globalLimit), ER_OVERLOADED)
+	}
+
+	if namespaceLimit <= 0 {
+		// Only namespaces with limits are tracked, so arbitrary namespace names in requests don't
+		// grow byNamespace.
+		return func() {
+			atomic.AddInt64(&a.global, -1)
+		}, nil
+	}
+
+	counter := a.namespaceCounter(namespace)
+	if n := atomic.AddInt64(counter, 1); n > namespaceLimit {
+		atomic.AddInt64(counter, -1)
+		atomic.AddInt64(&a.global, -1)
+		return nil, newError(fmt.Sprintf("Too many requests in flight for namespace %v; limit is %v", namespace, namespaceLimit), ER_OVERLOADED)
+	}
+
+	return func() {
+		atomic.AddInt64(counter, -1)
+		atomic.AddInt64(&a.global, -1)
+	}, nil
+}
+
+func (a *admissionController) namespaceCounter(namespace string) *int64 {
+	if c, ok := a.byNamespace.Load(namespace); ok {
+		return c.(*int64)
+	}
+
+	c, _ := a.byNamespace.LoadOrStore(namespace, new(int64))
+	return c.(*int64)
+}
@@ -0,0 +1,70 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"testing"
+
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func expectOverloaded(t *testing.T, e error) {
+	t.Helper()
+
+	if e == nil {
+		t.Fatal("Expecting request to be rejected")
+	}
+
+	if e.(QuotaServiceError).Reason != ER_OVERLOADED {
+		t.Fatalf("Expected Reason to be %v but was %v", ER_OVERLOADED, e.(QuotaServiceError).Reason)
+	}
+}
+
+func TestGlobalInFlightLimit(t *testing.T) {
+	a := &admissionController{}
+	release1, e := a.admit("a", 2, 0)
+	helpers.CheckError(t, e)
+	_, e = a.admit("b", 2, 0)
+	helpers.CheckError(t, e)
+
+	_, e = a.admit("c", 2, 0)
+	expectOverloaded(t, e)
+
+	release1()
+	_, e = a.admit("c", 2, 0)
+	helpers.CheckError(t, e)
+}
+
+func TestNamespaceInFlightLimit(t *testing.T) {
+	a := &admissionController{}
+	release, e := a.admit("a", 0, 1)
+	helpers.CheckError(t, e)
+
+	_, e = a.admit("a", 0, 1)
+	expectOverloaded(t, e)
+
+	// Other namespaces are unaffected
+	_, e = a.admit("b", 0, 1)
+	helpers.CheckError(t, e)
+
+	release()
+	_, e = a.admit("a", 0, 1)
+	helpers.CheckError(t, e)
+
+	if a.global != 2 {
+		t.Fatalf("Expected 2 requests in flight, got %v", a.global)
+	}
+}
+
+func TestUnlimitedNamespacesNotTracked(t *testing.T) {
+	a := &admissionController{}
+	for i := 0; i < 10; i++ {
+		_, e := a.admit("a", 0, 0)
+		helpers.CheckError(t, e)
+	}
+
+	if _, ok := a.byNamespace.Load("a"); ok {
+		t.Fatal("Namespaces without limits should not be tracked")
+	}
+}
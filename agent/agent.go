@@ -0,0 +1,286 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package agent implements agent mode, where a quota service instance running alongside its
+// clients, e.g. as a sidecar, serves Allow from local buckets, and periodically reconciles with a
+// central quota service. Agents report the tokens they granted, which are charged to the central
+// buckets, and receive in return their share of each bucket, in proportion to their recent usage.
+// Decisions are made locally, in microseconds, while global usage is accurate to within a
+// reconciliation interval.
+package agent
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// Config configures an agent.
+type Config struct {
+	// AgentID identifies the agent to the central quota service, e.g. by hostname.
+	AgentID string
+	// ReconcileInterval is how often the agent reconciles with the central quota service.
+	ReconcileInterval time.Duration
+	// ReconcileTimeout bounds each call to the central quota service.
+	ReconcileTimeout time.Duration
+	// InitialShare is the fraction, between 0 and 1, of each bucket's size and fill rate that the
+	// agent grants locally before it is first told its share.
+	InitialShare float64
+}
+
+// NewDefaultConfig creates a Config with sensible defaults.
+func NewDefaultConfig(agentID string) Config {
+	return Config{
+		AgentID:           agentID,
+		ReconcileInterval: time.Second,
+		ReconcileTimeout:  time.Second,
+		InitialShare:      0.1}
+}
+
+type bucketFactory struct {
+	client pb.QuotaServiceClient
+	cfg    Config
+	// buckets are the buckets whose usage is reported, including destroyed buckets that haven't yet
+	// been reported on, protected by the embedded mutex.
+	buckets map[*bucket]struct{}
+	stop    chan struct{}
+	stopped sync.Once
+	sync.Mutex
+}
+
+// NewBucketFactory creates a bucket factory for an agent, whose buckets reconcile with the central
+// quota service behind client. The central quota service's gRPC endpoint must have a Coordinator.
+func NewBucketFactory(client pb.QuotaServiceClient, cfg Config) quotaservice.BucketFactory {
+	if cfg.AgentID == "" || cfg.ReconcileInterval <= 0 || cfg.ReconcileTimeout <= 0 ||
+		cfg.InitialShare <= 0 || cfg.InitialShare > 1 {
+		panic("AgentID must be set, intervals must be positive, and InitialShare must be greater than 0 and at most 1")
+	}
+
+	bf := &bucketFactory{
+		client:  client,
+		cfg:     cfg,
+		buckets: make(map[*bucket]struct{}),
+		stop:    make(chan struct{})}
+
+	go bf.reconcileLoop()
+
+	return bf
+}
+
+func (bf *bucketFactory) Init(_ *pbconfig.ServiceConfig) {}
+
+func (bf *bucketFactory) Client() interface{} {
+	return bf.client
+}
+
+// Close reports any usage not yet reported, implementing quotaservice.BucketFactoryCloser.
+func (bf *bucketFactory) Close() {
+	bf.stopped.Do(func() {
+		close(bf.stop)
+		bf.reconcile()
+	})
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	b := &bucket{
+		factory:   bf,
+		namespace: namespace,
+		name:      bucketName,
+		cfg:       cfg,
+		dynamic:   dyn,
+		now:       time.Now}
+	b.setShare(bf.cfg.InitialShare)
+	b.state = buckets.NewTokenState(b.local)
+
+	bf.Lock()
+	bf.buckets[b] = struct{}{}
+	bf.Unlock()
+
+	return b
+}
+
+func (bf *bucketFactory) reconcileLoop() {
+	ticker := time.NewTicker(bf.cfg.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bf.stop:
+			return
+		case <-ticker.C:
+			bf.reconcile()
+		}
+	}
+}
+
+// reconcile reports the usage of all buckets, and applies the shares returned. If reconciliation
+// fails, usage is reported next time.
+func (bf *bucketFactory) reconcile() {
+	bf.Lock()
+	bs := make([]*bucket, 0, len(bf.buckets))
+	for b := range bf.buckets {
+		bs = append(bs, b)
+	}
+	bf.Unlock()
+
+	if len(bs) == 0 {
+		return
+	}
+
+	req := &pb.ReconcileRequest{AgentId: bf.cfg.AgentID}
+	consumed := make([]int64, len(bs))
+	for i, b := range bs {
+		consumed[i] = b.takeUsage()
+		req.Usage = append(req.Usage, &pb.BucketUsage{
+			Namespace:      b.namespace,
+			BucketName:     b.name,
+			TokensConsumed: consumed[i]})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bf.cfg.ReconcileTimeout)
+	rsp, err := bf.client.Reconcile(ctx, req)
+	cancel()
+
+	if err == nil && rsp.Status != pb.ReconcileResponse_OK {
+		err = errors.Errorf("status %v", rsp.Status)
+	}
+
+	if err != nil {
+		logging.Printf("Unable to reconcile with the central quota service: %v", err)
+		for i, b := range bs {
+			b.returnUsage(consumed[i])
+		}
+		return
+	}
+
+	shares := make(map[string]float64, len(rsp.Shares))
+	for _, s := range rsp.Shares {
+		shares[config.FullyQualifiedName(s.Namespace, s.BucketName)] = s.Share
+	}
+
+	bf.Lock()
+	defer bf.Unlock()
+
+	for _, b := range bs {
+		if b.isDestroyed() {
+			delete(bf.buckets, b)
+		} else if share, ok := shares[config.FullyQualifiedName(b.namespace, b.name)]; ok {
+			b.setShare(share)
+		}
+	}
+}
+
+type bucket struct {
+	factory         *bucketFactory
+	namespace, name string
+	cfg             *pbconfig.BucketConfig
+	dynamic         bool
+	now             func() time.Time
+	// local is the bucket's config scaled to the agent's share, protected by the embedded mutex.
+	local *pbconfig.BucketConfig
+	state buckets.TokenState
+	// consumed is the net number of tokens consumed since usage was last reported.
+	consumed  int64
+	destroyed bool
+	sync.Mutex
+	quotaservice.DefaultBucket
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	next, waitNanos, ok := b.state.Take(b.local, b.now().UnixNano(), numTokens, maxWaitTime.Nanoseconds(), buckets.MaxDebtNanos(ctx, b.local))
+	if !ok {
+		return 0, false, nil
+	}
+
+	b.state = next
+	b.consumed += numTokens
+	return time.Duration(waitNanos), true, nil
+}
+
+func (b *bucket) Charge(_ context.Context, numTokens int64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.state = b.state.Charge(b.local, b.now().UnixNano(), numTokens)
+	b.consumed += numTokens
+	return nil
+}
+
+// setShare scales the local bucket to the given share of the bucket.
+func (b *bucket) setShare(share float64) {
+	share = math.Max(0, math.Min(1, share))
+
+	b.Lock()
+	defer b.Unlock()
+
+	local := proto.Clone(b.cfg).(*pbconfig.BucketConfig)
+	local.Size = proto.Int64(scale(b.cfg.GetSize(), share))
+	local.FillRate = proto.Int64(scale(b.cfg.GetFillRate(), share))
+	b.local = local
+
+	if b.state.AccumulatedTokens > local.GetSize() {
+		b.state.AccumulatedTokens = local.GetSize()
+	}
+}
+
+func scale(n int64, share float64) int64 {
+	if scaled := int64(math.Round(float64(n) * share)); scaled > 1 {
+		return scaled
+	}
+
+	return 1
+}
+
+// takeUsage returns the tokens consumed since usage was last taken.
+func (b *bucket) takeUsage() int64 {
+	b.Lock()
+	defer b.Unlock()
+
+	n := b.consumed
+	b.consumed = 0
+	return n
+}
+
+// returnUsage returns usage that couldn't be reported, to be reported next time.
+func (b *bucket) returnUsage(n int64) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.consumed += n
+}
+
+func (b *bucket) isDestroyed() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.destroyed
+}
+
+func (b *bucket) Config() *pbconfig.BucketConfig {
+	return b.cfg
+}
+
+func (b *bucket) Dynamic() bool {
+	return b.dynamic
+}
+
+// Destroy marks the bucket destroyed. It is forgotten once its remaining usage has been reported.
+func (b *bucket) Destroy() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.destroyed = true
+}
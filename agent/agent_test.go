@@ -0,0 +1,132 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/config"
+	pb "github.com/square/quotaservice/protos"
+	"google.golang.org/grpc"
+)
+
+// fakeClient records reconcile requests, returning a fixed share for every bucket.
+type fakeClient struct {
+	requests []*pb.ReconcileRequest
+	share    float64
+	fail     bool
+}
+
+func (c *fakeClient) Allow(_ context.Context, _ *pb.AllowRequest, _ ...grpc.CallOption) (*pb.AllowResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeClient) Charge(_ context.Context, _ *pb.ChargeRequest, _ ...grpc.CallOption) (*pb.ChargeResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeClient) Reconcile(_ context.Context, req *pb.ReconcileRequest, _ ...grpc.CallOption) (*pb.ReconcileResponse, error) {
+	c.requests = append(c.requests, req)
+	if c.fail {
+		return nil, errors.New("unavailable")
+	}
+
+	rsp := &pb.ReconcileResponse{}
+	for _, u := range req.Usage {
+		rsp.Shares = append(rsp.Shares, &pb.BucketShare{Namespace: u.Namespace, BucketName: u.BucketName, Share: c.share})
+	}
+
+	return rsp, nil
+}
+
+func newTestFactory(client *fakeClient) *bucketFactory {
+	cfg := NewDefaultConfig("agent")
+	// Reconciled explicitly by tests.
+	cfg.ReconcileInterval = time.Hour
+	return NewBucketFactory(client, cfg).(*bucketFactory)
+}
+
+func TestLocalBucketsScaledToShare(t *testing.T) {
+	client := &fakeClient{share: 0.5}
+	bf := newTestFactory(client)
+	defer bf.Close()
+
+	cfg := config.NewDefaultBucketConfig("b")
+	cfg.MaxDebtMillis = proto.Int64(0)
+	b := bf.NewBucket("ns", "b", cfg, false).(*bucket)
+
+	if b.local.GetSize() != 10 || b.local.GetFillRate() != 5 {
+		t.Fatalf("Expected bucket scaled to the initial share, got %+v", b.local)
+	}
+
+	if _, ok, err := b.Take(context.Background(), 10, 0); !ok || err != nil {
+		t.Fatalf("Expected tokens to be granted locally, got %v, %v", ok, err)
+	}
+
+	if _, ok, _ := b.Take(context.Background(), 1, 0); ok {
+		t.Fatal("Expected local bucket to be exhausted")
+	}
+
+	bf.reconcile()
+
+	if len(client.requests) != 1 || client.requests[0].AgentId != "agent" || client.requests[0].Usage[0].TokensConsumed != 10 {
+		t.Fatalf("Expected usage to be reported, got %+v", client.requests)
+	}
+
+	if b.local.GetSize() != cfg.GetSize()/2 || b.local.GetFillRate() != cfg.GetFillRate()/2 {
+		t.Fatalf("Expected bucket scaled to the new share, got %+v", b.local)
+	}
+
+	bf.reconcile()
+	if consumed := client.requests[1].Usage[0].TokensConsumed; consumed != 0 {
+		t.Fatalf("Expected usage to be reported once, got %v", consumed)
+	}
+}
+
+func TestFailedReconciliationsAreRetried(t *testing.T) {
+	client := &fakeClient{fail: true}
+	bf := newTestFactory(client)
+	defer bf.Close()
+
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+	_, _, err := b.Take(context.Background(), 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bf.reconcile()
+	client.fail = false
+	bf.reconcile()
+
+	if consumed := client.requests[1].Usage[0].TokensConsumed; consumed != 3 {
+		t.Fatalf("Expected unreported usage to be retried, got %v", consumed)
+	}
+}
+
+func TestDestroyedBucketsReportedOnce(t *testing.T) {
+	client := &fakeClient{share: 1}
+	bf := newTestFactory(client)
+	defer bf.Close()
+
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), true)
+	_, _, err := b.Take(context.Background(), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Destroy()
+	bf.reconcile()
+
+	if consumed := client.requests[0].Usage[0].TokensConsumed; consumed != 2 {
+		t.Fatalf("Expected destroyed bucket's usage to be reported, got %v", consumed)
+	}
+
+	if len(bf.buckets) != 0 {
+		t.Fatalf("Expected destroyed bucket to be forgotten, got %v", bf.buckets)
+	}
+}
@@ -0,0 +1,132 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos"
+)
+
+// CoordinatorConfig configures a Coordinator.
+type CoordinatorConfig struct {
+	// AgentTimeout is how long after an agent last reported usage of a bucket it stops being given a
+	// share of it.
+	AgentTimeout time.Duration
+	// Smoothing is the weight, between 0 and 1, given to each report when updating an agent's average
+	// usage of a bucket.
+	Smoothing float64
+}
+
+// NewDefaultCoordinatorConfig creates a CoordinatorConfig with sensible defaults.
+func NewDefaultCoordinatorConfig() CoordinatorConfig {
+	return CoordinatorConfig{
+		AgentTimeout: time.Minute,
+		Smoothing:    0.5}
+}
+
+// Coordinator runs on the central quota service, charging the usage reported by agents to its
+// buckets, and dividing each bucket between the agents using it in proportion to their recent
+// usage. Register it with the gRPC endpoint's SetCoordinator.
+type Coordinator struct {
+	cfg CoordinatorConfig
+	// buckets holds the usage of each bucket, keyed on fully qualified name, by each agent, keyed on
+	// agent ID. Protected by the embedded mutex.
+	buckets map[string]map[string]*agentUsage
+	now     func() time.Time
+	sync.Mutex
+}
+
+type agentUsage struct {
+	// avg is an exponentially weighted moving average of tokens consumed per report.
+	avg      float64
+	lastSeen time.Time
+}
+
+// NewCoordinator creates a Coordinator.
+func NewCoordinator(cfg CoordinatorConfig) *Coordinator {
+	if cfg.AgentTimeout <= 0 || cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		panic("AgentTimeout must be positive, and Smoothing must be greater than 0 and at most 1")
+	}
+
+	return &Coordinator{
+		cfg:     cfg,
+		buckets: make(map[string]map[string]*agentUsage),
+		now:     time.Now}
+}
+
+// Reconcile charges the usage reported by an agent to the buckets in qs, and returns the agent's
+// new share of each bucket. Buckets that can't be charged, e.g. because they don't exist, are left
+// out of the response.
+func (c *Coordinator) Reconcile(ctx context.Context, qs quotaservice.QuotaService, req *pb.ReconcileRequest) *pb.ReconcileResponse {
+	rsp := &pb.ReconcileResponse{}
+
+	for _, u := range req.Usage {
+		if err := charge(ctx, qs, u); err != nil {
+			logging.Printf("Unable to charge usage by agent %v to bucket %v:%v: %v", req.AgentId, u.Namespace, u.BucketName, err)
+			continue
+		}
+
+		rsp.Shares = append(rsp.Shares, &pb.BucketShare{
+			Namespace:  u.Namespace,
+			BucketName: u.BucketName,
+			Share:      c.record(req.AgentId, config.FullyQualifiedName(u.Namespace, u.BucketName), u.TokensConsumed)})
+	}
+
+	return rsp
+}
+
+func charge(ctx context.Context, qs quotaservice.QuotaService, u *pb.BucketUsage) error {
+	if u.TokensConsumed < 0 {
+		// Tokens returned to the agent's local bucket.
+		return qs.Charge(ctx, u.Namespace, u.BucketName, -u.TokensConsumed, 0)
+	}
+
+	return qs.Charge(ctx, u.Namespace, u.BucketName, 0, u.TokensConsumed)
+}
+
+// record updates an agent's average usage of a bucket, returning its share of the bucket.
+func (c *Coordinator) record(agentID, bucket string, consumed int64) float64 {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	agents := c.buckets[bucket]
+	if agents == nil {
+		agents = make(map[string]*agentUsage)
+		c.buckets[bucket] = agents
+	}
+
+	u := agents[agentID]
+	if u == nil {
+		u = &agentUsage{}
+		agents[agentID] = u
+	}
+
+	if consumed < 0 {
+		consumed = 0
+	}
+
+	u.avg = c.cfg.Smoothing*float64(consumed) + (1-c.cfg.Smoothing)*u.avg
+	u.lastSeen = now
+
+	total := 0.0
+	for id, a := range agents {
+		if now.Sub(a.lastSeen) > c.cfg.AgentTimeout {
+			delete(agents, id)
+			continue
+		}
+
+		total += a.avg
+	}
+
+	// Every agent gets an equal floor, so idle agents can still serve a burst locally.
+	floor := total/float64(10*len(agents)) + 1
+	return (u.avg + floor) / (total + floor*float64(len(agents)))
+}
@@ -0,0 +1,100 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	pb "github.com/square/quotaservice/protos"
+)
+
+// chargingQuotaService records the net tokens charged to each bucket.
+type chargingQuotaService struct {
+	charged map[string]int64
+}
+
+func (qs *chargingQuotaService) Allow(_ context.Context, _, _ string, _ int64, _ int64, _ bool) (time.Duration, bool, error) {
+	return 0, false, nil
+}
+
+func (qs *chargingQuotaService) Charge(_ context.Context, namespace, name string, tokensReserved, actualCost int64) error {
+	if namespace == "missing" {
+		return errors.New("no such bucket")
+	}
+
+	qs.charged[config.FullyQualifiedName(namespace, name)] += actualCost - tokensReserved
+	return nil
+}
+
+func reconcile(c *Coordinator, qs *chargingQuotaService, agentID string, consumed int64) float64 {
+	rsp := c.Reconcile(context.Background(), qs, &pb.ReconcileRequest{
+		AgentId: agentID,
+		Usage:   []*pb.BucketUsage{{Namespace: "ns", BucketName: "b", TokensConsumed: consumed}}})
+	return rsp.Shares[0].Share
+}
+
+func TestSharesProportionalToUsage(t *testing.T) {
+	qs := &chargingQuotaService{charged: make(map[string]int64)}
+	cfg := NewDefaultCoordinatorConfig()
+	cfg.Smoothing = 1
+	c := NewCoordinator(cfg)
+
+	if share := reconcile(c, qs, "a1", 300); share != 1 {
+		t.Fatalf("Expected a lone agent to get the whole bucket, got %v", share)
+	}
+
+	reconcile(c, qs, "a2", 100)
+	a1 := reconcile(c, qs, "a1", 300)
+	a2 := reconcile(c, qs, "a2", 100)
+
+	if math.Abs(a1+a2-1) > 1e-9 || a1 <= 2*a2 {
+		t.Fatalf("Expected shares proportional to usage, got %v and %v", a1, a2)
+	}
+
+	if charged := qs.charged["ns:b"]; charged != 800 {
+		t.Fatalf("Expected usage to be charged, got %v", charged)
+	}
+
+	reconcile(c, qs, "a2", -50)
+	if charged := qs.charged["ns:b"]; charged != 750 {
+		t.Fatalf("Expected returned tokens to be refunded, got %v", charged)
+	}
+}
+
+func TestIdleAgentsExpire(t *testing.T) {
+	qs := &chargingQuotaService{charged: make(map[string]int64)}
+	c := NewCoordinator(NewDefaultCoordinatorConfig())
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+
+	reconcile(c, qs, "a1", 100)
+	if share := reconcile(c, qs, "a2", 100); share >= 1 {
+		t.Fatalf("Expected the bucket to be shared, got %v", share)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if share := reconcile(c, qs, "a2", 100); share != 1 {
+		t.Fatalf("Expected idle agent to lose its share, got %v", share)
+	}
+}
+
+func TestUnchargeableBucketsOmitted(t *testing.T) {
+	qs := &chargingQuotaService{charged: make(map[string]int64)}
+	c := NewCoordinator(NewDefaultCoordinatorConfig())
+
+	rsp := c.Reconcile(context.Background(), qs, &pb.ReconcileRequest{
+		AgentId: "a1",
+		Usage: []*pb.BucketUsage{
+			{Namespace: "missing", BucketName: "b", TokensConsumed: 1},
+			{Namespace: "ns", BucketName: "b", TokensConsumed: 1}}})
+
+	if len(rsp.Shares) != 1 || rsp.Shares[0].Namespace != "ns" {
+		t.Fatalf("Expected only the existing bucket's share, got %+v", rsp.Shares)
+	}
+}
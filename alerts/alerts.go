@@ -0,0 +1,314 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package alerts evaluates threshold rules against the event stream, and fires alerts when a
+// rule is breached.
+package alerts
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/events"
+)
+
+type Metric int
+
+const (
+	// METRIC_REJECTION_RATE is the fraction of requests rejected due to timeouts or too many tokens
+	// being requested.
+	METRIC_REJECTION_RATE Metric = iota
+	// METRIC_MISS_RATE is the fraction of requests for which no bucket could be found.
+	METRIC_MISS_RATE
+	// METRIC_ERROR_RATE is the fraction of requests that failed due to server or bucket errors.
+	METRIC_ERROR_RATE
+)
+
+var metricNames = []string{
+	METRIC_REJECTION_RATE: "METRIC_REJECTION_RATE",
+	METRIC_MISS_RATE:      "METRIC_MISS_RATE",
+	METRIC_ERROR_RATE:     "METRIC_ERROR_RATE",
+}
+
+func (m Metric) String() string {
+	return metricNames[m]
+}
+
+// numSlots is the number of slots a rule's window is divided into, for sliding window evaluation.
+const numSlots = 10
+
+// Rule describes a threshold, such as "miss rate > 20% over 5m for bucket X". A rule is
+// evaluated separately for each bucket it matches.
+type Rule struct {
+	Name string
+	// Namespace to match. Matches all namespaces if empty.
+	Namespace string
+	// Bucket to match. Matches all buckets in the namespace if empty.
+	Bucket string
+	Metric Metric
+	// Threshold is the fraction, between 0 and 1, above which the rule is breached.
+	Threshold float64
+	Window    time.Duration
+	// MinRequests is the number of requests needed within the window before the rule is
+	// evaluated, to avoid alerting on low traffic.
+	MinRequests int64
+}
+
+func (r *Rule) String() string {
+	return fmt.Sprintf("Rule{name: %v, namespace: %v, bucket: %v, metric: %v, threshold: %v, window: %v}",
+		r.Name, r.Namespace, r.Bucket, r.Metric, r.Threshold, r.Window)
+}
+
+func (r *Rule) matches(e events.Event) bool {
+	return (r.Namespace == "" || r.Namespace == e.Namespace()) &&
+		(r.Bucket == "" || r.Bucket == e.BucketName())
+}
+
+// Alert is fired when a rule is breached, and again with Resolved set once the rule is no longer
+// breached, its window no longer holds MinRequests requests, e.g. because traffic stopped, or the
+// bucket is removed.
+type Alert struct {
+	Rule      *Rule
+	Namespace string
+	Bucket    string
+	Value     float64
+	Requests  int64
+	Resolved  bool
+	Time      time.Time
+}
+
+// Handler consumes alerts.
+type Handler func(*Alert)
+
+type slot struct {
+	start           time.Time
+	requests, count int64
+}
+
+// ruleState is the state of a rule for a bucket.
+type ruleState struct {
+	rule              *Rule
+	namespace, bucket string
+	slots             [numSlots]slot
+	firing            bool
+}
+
+// Engine evaluates rules against events. Its HandleEvent function is an events.Listener. Rules are
+// also evaluated periodically, so that alerts resolve once traffic stops, and the state of buckets
+// without recent requests is discarded.
+type Engine struct {
+	rules   []*Rule
+	handler Handler
+	states  map[string]*ruleState
+	now     func() time.Time
+	stop    chan struct{}
+	sync.Mutex
+}
+
+// NewEngine creates an Engine that passes alerts to handler. Close stops it.
+func NewEngine(handler Handler, rules ...*Rule) *Engine {
+	e := newEngine(handler, rules...)
+	if len(rules) > 0 {
+		go e.evaluateLoop(e.evaluationInterval())
+	}
+
+	return e
+}
+
+// newEngine creates an Engine that isn't evaluated periodically.
+func newEngine(handler Handler, rules ...*Rule) *Engine {
+	if handler == nil {
+		panic("Cannot create an alerts engine with a nil handler")
+	}
+
+	for _, r := range rules {
+		if r.Window < numSlots {
+			panic(fmt.Sprintf("Window too small for %v", r))
+		}
+	}
+
+	return &Engine{
+		rules:   rules,
+		handler: handler,
+		states:  make(map[string]*ruleState),
+		now:     time.Now,
+		stop:    make(chan struct{})}
+}
+
+// Close stops evaluating rules periodically.
+func (e *Engine) Close() {
+	close(e.stop)
+}
+
+// evaluationInterval returns the smallest slot of any rule's window, which is how often a window
+// slides.
+func (e *Engine) evaluationInterval() time.Duration {
+	interval := e.rules[0].Window / numSlots
+	for _, r := range e.rules[1:] {
+		if r.Window/numSlots < interval {
+			interval = r.Window / numSlots
+		}
+	}
+
+	return interval
+}
+
+func (e *Engine) evaluateLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			e.evaluateAll()
+		}
+	}
+}
+
+// HandleEvent is an events.Listener.
+func (e *Engine) HandleEvent(event events.Event) {
+	if event.EventType() == events.EVENT_BUCKET_REMOVED {
+		e.removeBucket(event.Namespace(), event.BucketName())
+		return
+	}
+
+	isRequest, counts := classify(event)
+	if !isRequest {
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	now := e.now()
+	for i, r := range e.rules {
+		if !r.matches(event) {
+			continue
+		}
+
+		key := fmt.Sprintf("%d:%s:%s", i, event.Namespace(), event.BucketName())
+		state, ok := e.states[key]
+		if !ok {
+			state = &ruleState{rule: r, namespace: event.Namespace(), bucket: event.BucketName()}
+			e.states[key] = state
+		}
+
+		s := state.slotFor(now, r.Window)
+		s.requests++
+		if counts[r.Metric] {
+			s.count++
+		}
+
+		e.evaluate(state, now)
+	}
+}
+
+// evaluateAll evaluates the rules for every bucket, resolving alerts whose windows no longer hold
+// enough requests, and discards the state of buckets without requests within their windows.
+func (e *Engine) evaluateAll() {
+	e.Lock()
+	defer e.Unlock()
+
+	now := e.now()
+	for key, state := range e.states {
+		if requests := e.evaluate(state, now); requests == 0 {
+			delete(e.states, key)
+		}
+	}
+}
+
+// removeBucket discards the state of a removed bucket, resolving its alerts.
+func (e *Engine) removeBucket(namespace, bucket string) {
+	e.Lock()
+	defer e.Unlock()
+
+	now := e.now()
+	for key, state := range e.states {
+		if state.namespace != namespace || state.bucket != bucket {
+			continue
+		}
+
+		if state.firing {
+			requests, count := state.totals(now, state.rule.Window)
+			e.fire(state, value(requests, count), requests, false, now)
+		}
+
+		delete(e.states, key)
+	}
+}
+
+// evaluate fires or resolves a rule's alert for a bucket if need be, returning the requests within
+// the rule's window. Callers must hold the lock.
+func (e *Engine) evaluate(state *ruleState, now time.Time) int64 {
+	r := state.rule
+	requests, count := state.totals(now, r.Window)
+	breached := requests >= r.MinRequests && value(requests, count) > r.Threshold
+	if breached != state.firing {
+		e.fire(state, value(requests, count), requests, breached, now)
+	}
+
+	return requests
+}
+
+// fire calls the handler with a firing or resolved alert. Callers must hold the lock.
+func (e *Engine) fire(state *ruleState, value float64, requests int64, breached bool, now time.Time) {
+	state.firing = breached
+	e.handler(&Alert{
+		Rule:      state.rule,
+		Namespace: state.namespace,
+		Bucket:    state.bucket,
+		Value:     value,
+		Requests:  requests,
+		Resolved:  !breached,
+		Time:      now})
+}
+
+// value returns the fraction of requests counted towards a rule's metric.
+func value(requests, count int64) float64 {
+	if requests == 0 {
+		return 0
+	}
+
+	return float64(count) / float64(requests)
+}
+
+// classify returns whether an event represents a request, and which metrics it counts towards.
+func classify(event events.Event) (bool, map[Metric]bool) {
+	switch event.EventType() {
+	case events.EVENT_TOKENS_SERVED:
+		return true, nil
+	case events.EVENT_TIMEOUT_SERVING_TOKENS, events.EVENT_TOO_MANY_TOKENS_REQUESTED:
+		return true, map[Metric]bool{METRIC_REJECTION_RATE: true}
+	case events.EVENT_BUCKET_MISS:
+		return true, map[Metric]bool{METRIC_MISS_RATE: true}
+	case events.EVENT_SERVER_ERROR, events.EVENT_BUCKET_ERROR:
+		return true, map[Metric]bool{METRIC_ERROR_RATE: true}
+	}
+
+	return false, nil
+}
+
+func (r *ruleState) slotFor(now time.Time, window time.Duration) *slot {
+	slotSize := window / numSlots
+	start := now.Truncate(slotSize)
+	s := &r.slots[(start.UnixNano()/int64(slotSize))%numSlots]
+	if !s.start.Equal(start) {
+		*s = slot{start: start}
+	}
+
+	return s
+}
+
+func (r *ruleState) totals(now time.Time, window time.Duration) (requests, count int64) {
+	for _, s := range r.slots {
+		if now.Sub(s.start) < window {
+			requests += s.requests
+			count += s.count
+		}
+	}
+
+	return
+}
@@ -0,0 +1,125 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+)
+
+func newTestEngine(rules ...*Rule) (*Engine, *[]*Alert, *time.Time) {
+	fired := make([]*Alert, 0)
+	now := time.Unix(1000, 0)
+	e := newEngine(func(a *Alert) { fired = append(fired, a) }, rules...)
+	e.now = func() time.Time { return now }
+	return e, &fired, &now
+}
+
+func TestRuleFiresAndResolves(t *testing.T) {
+	rule := &Rule{Name: "misses", Namespace: "ns", Metric: METRIC_MISS_RATE, Threshold: 0.2, Window: 5 * time.Minute, MinRequests: 5}
+	e, fired, now := newTestEngine(rule)
+
+	for i := 0; i < 4; i++ {
+		e.HandleEvent(events.NewBucketMissedEvent("ns", "b", true))
+	}
+
+	if len(*fired) != 0 {
+		t.Fatalf("Should not fire below MinRequests, got %+v", *fired)
+	}
+
+	e.HandleEvent(events.NewTokensServedEvent("ns", "b", true, 1, 0))
+	if len(*fired) != 1 || (*fired)[0].Resolved || (*fired)[0].Bucket != "b" || (*fired)[0].Value != 0.8 {
+		t.Fatalf("Expected a single firing alert, got %+v", *fired)
+	}
+
+	// Events in other namespaces are ignored.
+	e.HandleEvent(events.NewBucketMissedEvent("other", "b", true))
+	if len(*fired) != 1 {
+		t.Fatalf("Unexpected alerts %+v", *fired)
+	}
+
+	// Once the window has slid past the misses, the alert resolves.
+	*now = now.Add(6 * time.Minute)
+	for i := 0; i < 5; i++ {
+		e.HandleEvent(events.NewTokensServedEvent("ns", "b", true, 1, 0))
+	}
+
+	if len(*fired) != 2 || !(*fired)[1].Resolved {
+		t.Fatalf("Expected alert to resolve, got %+v", *fired)
+	}
+}
+
+func TestRulesEvaluatedPerBucket(t *testing.T) {
+	rule := &Rule{Name: "rejections", Metric: METRIC_REJECTION_RATE, Threshold: 0.5, Window: time.Minute, MinRequests: 1}
+	e, fired, _ := newTestEngine(rule)
+
+	e.HandleEvent(events.NewTimedOutEvent("ns", "a", false, 1))
+	e.HandleEvent(events.NewTokensServedEvent("ns", "b", false, 1, 0))
+	e.HandleEvent(events.NewTooManyTokensRequestedEvent("ns", "b", false, 10))
+
+	if len(*fired) != 1 || (*fired)[0].Bucket != "a" {
+		t.Fatalf("Expected a single alert for bucket a, got %+v", *fired)
+	}
+}
+
+func TestAlertsResolveOnceTrafficStops(t *testing.T) {
+	rule := &Rule{Name: "misses", Metric: METRIC_MISS_RATE, Threshold: 0.2, Window: time.Minute, MinRequests: 1}
+	e, fired, now := newTestEngine(rule)
+
+	e.HandleEvent(events.NewBucketMissedEvent("ns", "b", true))
+	if len(*fired) != 1 || (*fired)[0].Resolved {
+		t.Fatalf("Expected a single firing alert, got %+v", *fired)
+	}
+
+	// Without requests, the alert is only resolved by evaluating the rules periodically.
+	*now = now.Add(2 * time.Minute)
+	e.evaluateAll()
+	if len(*fired) != 2 || !(*fired)[1].Resolved || (*fired)[1].Requests != 0 {
+		t.Fatalf("Expected alert to resolve, got %+v", *fired)
+	}
+
+	if len(e.states) != 0 {
+		t.Fatalf("Expected the state of idle buckets to be discarded, got %v", e.states)
+	}
+}
+
+func TestRemovedBucketsAreForgotten(t *testing.T) {
+	rule := &Rule{Name: "misses", Metric: METRIC_MISS_RATE, Threshold: 0.2, Window: time.Minute, MinRequests: 1}
+	e, fired, _ := newTestEngine(rule)
+
+	e.HandleEvent(events.NewBucketMissedEvent("ns", "a", true))
+	e.HandleEvent(events.NewBucketMissedEvent("ns", "b", true))
+	e.HandleEvent(events.NewBucketRemovedEvent("ns", "a", true))
+
+	if len(*fired) != 3 || !(*fired)[2].Resolved || (*fired)[2].Bucket != "a" {
+		t.Fatalf("Expected the removed bucket's alert to resolve, got %+v", *fired)
+	}
+
+	if len(e.states) != 1 {
+		t.Fatalf("Expected only the remaining bucket's state to be kept, got %v", e.states)
+	}
+}
+
+func TestEvaluatedPeriodically(t *testing.T) {
+	alerts := make(chan *Alert, 2)
+	rule := &Rule{Name: "misses", Metric: METRIC_MISS_RATE, Threshold: 0.2, Window: 100 * time.Millisecond, MinRequests: 1}
+	e := NewEngine(func(a *Alert) { alerts <- a }, rule)
+	defer e.Close()
+
+	e.HandleEvent(events.NewBucketMissedEvent("ns", "b", true))
+	if a := <-alerts; a.Resolved {
+		t.Fatalf("Expected a firing alert, got %+v", a)
+	}
+
+	select {
+	case a := <-alerts:
+		if !a.Resolved {
+			t.Fatalf("Expected the alert to resolve, got %+v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the alert to resolve without further requests")
+	}
+}
@@ -0,0 +1,172 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package alerts
+
+import (
+	"math"
+	"time"
+
+	"github.com/square/quotaservice/events"
+)
+
+// Rules that alerts fired by an AnomalyDetector refer to. They aren't meant to be evaluated by an
+// Engine.
+var (
+	// TrafficSpikeRule is breached when a bucket's requests in an interval exceed its usual rate
+	// by AnomalyConfig.SpikeFactor. The alert's value is the ratio of requests to the usual rate.
+	TrafficSpikeRule = &Rule{Name: "traffic-spike"}
+	// SustainedMissRule is breached when all requests to a bucket have missed for
+	// AnomalyConfig.MissIntervals intervals in a row, e.g. because a client is misconfigured.
+	SustainedMissRule = &Rule{Name: "sustained-misses", Metric: METRIC_MISS_RATE, Threshold: 1}
+)
+
+// AnomalyConfig configures an AnomalyDetector.
+type AnomalyConfig struct {
+	// Interval is the period over which requests are counted.
+	Interval time.Duration
+	// Alpha is the weight, between 0 and 1, given to each interval when updating a bucket's usual
+	// rate, an exponentially weighted moving average of requests per interval.
+	Alpha float64
+	// SpikeFactor is how many times its usual rate a bucket's requests must exceed to be a spike.
+	SpikeFactor float64
+	// MinRequests is the number of requests an interval needs before it is evaluated, to avoid
+	// alerting on low traffic.
+	MinRequests int64
+	// WarmupIntervals is the number of intervals a bucket must be observed for before spikes are
+	// detected, so that its usual rate is established.
+	WarmupIntervals int
+	// MissIntervals is the number of consecutive intervals in which every request must miss to be
+	// alerted on. Intervals without requests are skipped.
+	MissIntervals int
+}
+
+// NewDefaultAnomalyConfig returns a config detecting a 5-fold spike in requests over 10 seconds,
+// and a minute of nothing but misses.
+func NewDefaultAnomalyConfig() AnomalyConfig {
+	return AnomalyConfig{
+		Interval:        10 * time.Second,
+		Alpha:           0.1,
+		SpikeFactor:     5,
+		MinRequests:     100,
+		WarmupIntervals: 30,
+		MissIntervals:   6}
+}
+
+type bucketTraffic struct {
+	interval         int64 // The interval being counted
+	requests, misses int64
+	// ewma is the usual number of requests per interval.
+	ewma              float64
+	observed          int
+	consecutiveMisses int
+	spiking, missing  bool
+}
+
+// AnomalyDetector flags sudden spikes in a bucket's traffic, and sustained 100% miss rates, calling
+// a Handler when an anomaly starts, and again, with Resolved set, once it ends. Each interval is
+// evaluated once it is over, when the bucket's next event arrives. Its HandleEvent function is an
+// events.Listener.
+type AnomalyDetector struct {
+	cfg     AnomalyConfig
+	handler Handler
+	buckets map[string]*bucketTraffic
+	now     func() time.Time
+}
+
+// NewAnomalyDetector creates an AnomalyDetector that passes alerts to handler.
+func NewAnomalyDetector(handler Handler, cfg AnomalyConfig) *AnomalyDetector {
+	if handler == nil {
+		panic("Cannot create an anomaly detector with a nil handler")
+	}
+
+	if cfg.Interval <= 0 || cfg.Alpha <= 0 || cfg.Alpha > 1 {
+		panic("Anomaly detection needs a positive interval, and an alpha between 0 and 1")
+	}
+
+	return &AnomalyDetector{
+		cfg:     cfg,
+		handler: handler,
+		buckets: make(map[string]*bucketTraffic),
+		now:     time.Now}
+}
+
+// HandleEvent is an events.Listener. It is not safe to call concurrently, which is consistent with
+// how the events package notifies listeners.
+func (d *AnomalyDetector) HandleEvent(event events.Event) {
+	isRequest, counts := classify(event)
+	if !isRequest {
+		return
+	}
+
+	now := d.now()
+	interval := now.UnixNano() / int64(d.cfg.Interval)
+	key := event.Namespace() + ":" + event.BucketName()
+
+	b, ok := d.buckets[key]
+	if !ok {
+		b = &bucketTraffic{interval: interval}
+		d.buckets[key] = b
+	} else if interval > b.interval {
+		d.evaluate(b, event, now)
+
+		// Intervals without requests decay the usual rate.
+		if idle := interval - b.interval - 1; idle > 0 {
+			b.ewma *= math.Pow(1-d.cfg.Alpha, float64(idle))
+			b.observed += int(idle)
+		}
+
+		b.interval = interval
+		b.requests, b.misses = 0, 0
+	}
+
+	b.requests++
+	if counts[METRIC_MISS_RATE] {
+		b.misses++
+	}
+}
+
+// evaluate checks the interval just counted for anomalies, and folds it into the usual rate.
+func (d *AnomalyDetector) evaluate(b *bucketTraffic, event events.Event, now time.Time) {
+	warm := b.observed >= d.cfg.WarmupIntervals
+	spike := warm && b.requests >= d.cfg.MinRequests && float64(b.requests) > d.cfg.SpikeFactor*b.ewma
+	if spike != b.spiking {
+		b.spiking = spike
+		value := 0.0
+		if b.ewma > 0 {
+			value = float64(b.requests) / b.ewma
+		}
+
+		d.fire(TrafficSpikeRule, event, value, b.requests, !spike, now)
+	}
+
+	if b.observed == 0 {
+		b.ewma = float64(b.requests)
+	} else {
+		b.ewma = d.cfg.Alpha*float64(b.requests) + (1-d.cfg.Alpha)*b.ewma
+	}
+	b.observed++
+
+	if b.requests >= d.cfg.MinRequests && b.misses == b.requests {
+		b.consecutiveMisses++
+	} else if b.misses < b.requests {
+		b.consecutiveMisses = 0
+	}
+
+	missing := d.cfg.MissIntervals > 0 && b.consecutiveMisses >= d.cfg.MissIntervals
+	if missing != b.missing {
+		b.missing = missing
+		d.fire(SustainedMissRule, event, float64(b.misses)/float64(b.requests), b.requests, !missing, now)
+	}
+}
+
+func (d *AnomalyDetector) fire(r *Rule, event events.Event, value float64, requests int64, resolved bool, now time.Time) {
+	d.handler(&Alert{
+		Rule:      r,
+		Namespace: event.Namespace(),
+		Bucket:    event.BucketName(),
+		Value:     value,
+		Requests:  requests,
+		Resolved:  resolved,
+		Time:      now})
+}
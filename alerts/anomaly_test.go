@@ -0,0 +1,120 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func newTestDetector() (*AnomalyDetector, *[]*Alert, *time.Time) {
+	fired := make([]*Alert, 0)
+	now := time.Unix(1000, 0)
+	d := NewAnomalyDetector(func(a *Alert) { fired = append(fired, a) }, AnomalyConfig{
+		Interval:        time.Second,
+		Alpha:           0.5,
+		SpikeFactor:     3,
+		MinRequests:     5,
+		WarmupIntervals: 3,
+		MissIntervals:   2})
+	d.now = func() time.Time { return now }
+	return d, &fired, &now
+}
+
+// send sends n events to the detector, then moves on to the next interval.
+func send(d *AnomalyDetector, now *time.Time, n int, e events.Event) {
+	for i := 0; i < n; i++ {
+		d.HandleEvent(e)
+	}
+	*now = now.Add(time.Second)
+}
+
+func TestTrafficSpike(t *testing.T) {
+	d, fired, now := newTestDetector()
+	served := events.NewTokensServedEvent("ns", "b", false, 1, 0)
+
+	for i := 0; i < 4; i++ {
+		send(d, now, 10, served)
+	}
+
+	if len(*fired) != 0 {
+		t.Fatalf("Expected no alerts for steady traffic, got %+v", *fired)
+	}
+
+	send(d, now, 50, served)
+	send(d, now, 10, served)
+	if len(*fired) != 1 || (*fired)[0].Rule != TrafficSpikeRule || (*fired)[0].Resolved || (*fired)[0].Value != 5 {
+		t.Fatalf("Expected a spike alert, got %+v", *fired)
+	}
+
+	send(d, now, 1, served)
+	if len(*fired) != 2 || !(*fired)[1].Resolved {
+		t.Fatalf("Expected the spike to resolve, got %+v", *fired)
+	}
+}
+
+func TestNoSpikeBeforeWarmup(t *testing.T) {
+	d, fired, now := newTestDetector()
+	served := events.NewTokensServedEvent("ns", "b", false, 1, 0)
+
+	send(d, now, 1, served)
+	send(d, now, 50, served)
+	send(d, now, 1, served)
+	if len(*fired) != 0 {
+		t.Fatalf("Expected no alerts while warming up, got %+v", *fired)
+	}
+}
+
+func TestIdleIntervalsDecayUsualRate(t *testing.T) {
+	d, fired, now := newTestDetector()
+	served := events.NewTokensServedEvent("ns", "b", false, 1, 0)
+
+	for i := 0; i < 4; i++ {
+		send(d, now, 10, served)
+	}
+
+	// After a long pause, ordinary traffic is a spike relative to the decayed rate.
+	*now = now.Add(10 * time.Second)
+	send(d, now, 10, served)
+	send(d, now, 1, served)
+	if len(*fired) != 1 || (*fired)[0].Rule != TrafficSpikeRule {
+		t.Fatalf("Expected a spike alert, got %+v", *fired)
+	}
+}
+
+func TestSustainedMisses(t *testing.T) {
+	d, fired, now := newTestDetector()
+	missed := events.NewBucketMissedEvent("ns", "missing", false)
+
+	send(d, now, 5, missed)
+	send(d, now, 5, missed)
+	if len(*fired) != 0 {
+		t.Fatalf("Expected no alerts yet, got %+v", *fired)
+	}
+
+	send(d, now, 5, missed)
+	if len(*fired) != 1 || (*fired)[0].Rule != SustainedMissRule || (*fired)[0].Bucket != "missing" || (*fired)[0].Value != 1 {
+		t.Fatalf("Expected a miss alert, got %+v", *fired)
+	}
+
+	d.HandleEvent(events.NewTokensServedEvent("ns", "missing", false, 1, 0))
+	send(d, now, 0, missed)
+	d.HandleEvent(missed)
+	if len(*fired) != 2 || !(*fired)[1].Resolved {
+		t.Fatalf("Expected the miss alert to resolve, got %+v", *fired)
+	}
+}
+
+func TestInvalidAnomalyConfig(t *testing.T) {
+	helpers.ExpectingPanic(t, func() {
+		NewAnomalyDetector(func(*Alert) {}, AnomalyConfig{Interval: time.Second})
+	})
+
+	helpers.ExpectingPanic(t, func() {
+		NewAnomalyDetector(nil, NewDefaultAnomalyConfig())
+	})
+}
@@ -4,13 +4,21 @@
 package quotaservice
 
 import (
+	"io"
 	"net/http"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/square/quotaservice/admin"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/leader"
 	"github.com/square/quotaservice/logging"
+	"github.com/square/quotaservice/recommend"
+	"github.com/square/quotaservice/registry"
+	"github.com/square/quotaservice/slo"
 	"github.com/square/quotaservice/stats"
+	"github.com/square/quotaservice/usage"
 )
 
 // The Server interface is what you get when you create a new quotaservice.
@@ -21,10 +29,114 @@ type Server interface {
 	ServeAdminConsole(*http.ServeMux, string, bool)
 	SetListener(listener events.Listener, eventQueueBufSize int)
 	SetStatsListener(listener stats.Listener)
+	// SetStatsSnapshotStore periodically saves the stats listener's stats to a store, every interval
+	// and when the server stops, and reloads them when it starts, so that they survive restarts.
+	// Only applies to stats listeners that implement stats.Snapshotter, such as the memory listener.
+	SetStatsSnapshotStore(store stats.SnapshotStore, interval time.Duration)
+	// SetTokenSnapshots emits an EVENT_TOKEN_SNAPSHOT event every interval for each of the topN
+	// buckets that saw the most requests in that interval, reporting the tokens they hold, so that
+	// listeners can track how close buckets are to being exhausted. topN defaults to 10. Only
+	// buckets that implement TokenInspector are snapshotted. Disabled by default, or if interval
+	// isn't positive.
+	SetTokenSnapshots(interval time.Duration, topN int)
+	// SetRecommendationRecorder records traffic to buckets, from which the admin API's
+	// /api/recommendations suggests fill rates and sizes. Disabled by default.
+	SetRecommendationRecorder(recorder *recommend.Recorder)
+	// SetUsageExporter aggregates each bucket's usage, and periodically exports it to a warehouse
+	// sink. Disabled by default. The server closes the exporter, writing the usage recorded since
+	// its last write, when it stops.
+	SetUsageExporter(exporter *usage.Exporter)
+	// SetSLOTracker tracks how often requests granted by each bucket wait longer than a latency
+	// budget, reported by the admin API's /api/slo, and optionally emitted as EVENT_SLO_BREACHED
+	// events. Disabled by default.
+	SetSLOTracker(tracker *slo.Tracker)
+	// SetDynamicBucketRegistry records the dynamic buckets that exist, listed by the admin API's
+	// /api/dynamicbuckets/{namespace}. A registry shared by a fleet, such as
+	// registry.NewRedisRegistry(), lists the dynamic buckets of all its servers. Disabled by
+	// default. The server closes the registry when it stops.
+	SetDynamicBucketRegistry(r registry.Registry)
 	GetServerAdministrable() admin.Administrable
+	// SetFollower makes the server a read-only follower, which serves requests with configs read
+	// from its persister, but never persists configs itself, rejecting config changes and changes
+	// to the state of buckets made through the admin API, and never purging deleted namespaces. This
+	// guards against changes made through the wrong instance in a fleet sharing a persister. It
+	// should be called before the server is started.
+	SetFollower(follower bool)
+	// SetLeaderElector elects one instance of a fleet sharing a persister and bucket backend to run
+	// singleton maintenance tasks: purging deleted namespaces, saving stats snapshots and periodic
+	// stale bucket cleanup. Instances that aren't the leader skip them. Every instance is its own
+	// leader by default. The server closes the elector when it stops. It should be called before the
+	// server is started.
+	SetLeaderElector(elector leader.Elector)
+	// SetStaleBucketCleanupInterval periodically deletes the state of stale buckets from the bucket
+	// factory's backend, as the admin API's cleanup does, on the leader only. Only applies to
+	// bucket factories that implement StaleBucketCleaner. Disabled by default, or if interval isn't
+	// positive.
+	SetStaleBucketCleanupInterval(interval time.Duration)
+	// SetReadOnlyAdmins sets the users allowed to toggle the admin API's read-only mode, identified
+	// as they are by the admin API. No one is allowed by default.
+	SetReadOnlyAdmins(users ...string)
+	// SetResolver sets the Resolver that maps incoming requests to buckets. Defaults to a
+	// PassThroughResolver.
+	SetResolver(resolver Resolver)
+	// SetAccessLog writes a sample of Allow decisions to w as JSON, one per line, for debugging.
+	// Disabled by default, or if w is nil.
+	SetAccessLog(w io.Writer, cfg AccessLogConfig)
+	// SetApprovers enables two-person approval of config changes made through the admin API, if
+	// any users are given. Changes are then held until approved by one of these users, other than
+	// the one who made them. Disabled by default.
+	SetApprovers(users ...string)
+	// SetConfigBundleKey enables exporting and importing the config as bundles signed with key, via
+	// the admin API's /api/bundle, e.g. to promote configs from staging to production. Servers
+	// importing a bundle must share the key of the server that exported it. Disabled by default.
+	SetConfigBundleKey(key []byte)
+	// SetAdminRateLimit limits each identity's requests to change configs, or the state of buckets,
+	// through the admin API to requestsPerSecond, with bursts of up to burst requests, so that
+	// misbehaving automation can't thrash config reloads across a fleet. Requests over the limit are
+	// rejected with a 429. Identities are users, as identified by the admin API, or client addresses
+	// for requests without users. Disabled by default, or if requestsPerSecond isn't positive.
+	SetAdminRateLimit(requestsPerSecond float64, burst int)
+	// AddPreApplyConfigHook registers a hook called with each config change made through this
+	// server, e.g. through the admin API, once it has been validated and before it is persisted, to
+	// enforce policies such as internal validation rules. A hook vetoes a change by returning an
+	// error, which is returned to the user as an admin.VetoedError. Hooks are called in the order
+	// registered, and must not modify the configs they are passed.
+	AddPreApplyConfigHook(hook ConfigHook)
+	// AddPostApplyConfigHook registers a hook called with each config change made through this
+	// server once it has been persisted, e.g. to sync it to a CMDB. Errors returned by post-apply
+	// hooks are logged, since the change has already been made.
+	AddPostApplyConfigHook(hook ConfigHook)
+}
+
+// NewServer creates a new quotaservice server, which has yet to be started, configured by options.
+// At least one RPC endpoint must be given with WithEndpoints. Unless set with WithReaperConfig, the
+// default reaper config is used.
+func NewServer(bucketFactory BucketFactory, persister config.ConfigPersister, opts ...Option) (Server, error) {
+	if bucketFactory == nil {
+		return nil, errors.New("a bucket factory is required")
+	}
+
+	if persister == nil {
+		return nil, errors.New("a config persister is required")
+	}
+
+	s := newServer(bucketFactory, persister, config.NewReaperConfig(), 0, nil)
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.rpcEndpoints) == 0 {
+		return nil, errors.New("need at least 1 RPC endpoint to run the quota service")
+	}
+
+	return s, nil
 }
 
 // NewWithDefaultConfig creates a new quotaservice server with an empty in-memory config and default reaper.
+//
+// Deprecated: Use NewServer with config.NewMemoryConfig(config.NewDefaultServiceConfig()).
 func NewWithDefaultConfig(bucketFactory BucketFactory, rpcEndpoints ...RpcEndpoint) Server {
 	return New(bucketFactory,
 		config.NewMemoryConfig(config.NewDefaultServiceConfig()),
@@ -33,17 +145,37 @@ func NewWithDefaultConfig(bucketFactory BucketFactory, rpcEndpoints ...RpcEndpoi
 		rpcEndpoints...)
 }
 
-// New creates a new quotaservice server.
+// New creates a new quotaservice server, panicking if it is misconfigured. A negative
+// maxCfgReloadJitterMs disables jitter, as 0 does.
+//
+// Deprecated: Use NewServer, which returns misconfiguration errors.
 func New(bucketFactory BucketFactory, persister config.ConfigPersister, reaperConfig config.ReaperConfig, maxCfgReloadJitterMs int, rpcEndpoints ...RpcEndpoint) Server {
-	if len(rpcEndpoints) == 0 {
-		panic("Need at least 1 RPC endpoint to run the quota service.")
+	if maxCfgReloadJitterMs < 0 {
+		maxCfgReloadJitterMs = 0
+	}
+
+	s, err := NewServer(bucketFactory, persister,
+		WithReaperConfig(reaperConfig),
+		WithMaxConfigReloadJitter(time.Duration(maxCfgReloadJitterMs)*time.Millisecond),
+		WithEndpoints(rpcEndpoints...))
+	if err != nil {
+		panic(err.Error())
 	}
 
-	s := &server{
+	return s
+}
+
+func newServer(bucketFactory BucketFactory, persister config.ConfigPersister, reaperConfig config.ReaperConfig, maxCfgReloadJitterMs int, rpcEndpoints []RpcEndpoint) *server {
+	return &server{
 		persister:       persister,
 		bucketFactory:   bucketFactory,
 		rpcEndpoints:    rpcEndpoints,
 		maxJitterMillis: maxCfgReloadJitterMs,
-		reaperConfig:    reaperConfig}
-	return s
+		reaperConfig:    reaperConfig,
+		broadcaster:     events.NewBroadcaster(),
+		history:         events.NewHistory(eventHistorySize),
+		thresholds:      newThresholdTracker(),
+		dashboardRates:  newDashboardRates(),
+		now:             time.Now,
+		resolver:        PassThroughResolver{}}
 }
@@ -0,0 +1,277 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+// approvalQueue holds config changes awaiting approval by a second user. Changes are held in
+// memory, on the server they were made on, and are lost if it restarts.
+type approvalQueue struct {
+	approvers map[string]bool
+	pending   map[string]*pendingChange
+	nextID    int64
+	sync.Mutex
+}
+
+type pendingChange struct {
+	admin.PendingChange
+	// approving is set while the change is being applied, so that it is only applied once.
+	approving bool
+}
+
+// required returns whether two-person approval is enabled.
+func (q *approvalQueue) required() bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.approvers) > 0
+}
+
+func (q *approvalQueue) setApprovers(users []string) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.approvers = make(map[string]bool, len(users))
+	for _, user := range users {
+		q.approvers[user] = true
+	}
+}
+
+// propose queues a change from the config at version base to proposed, made at created.
+func (q *approvalQueue) propose(user, description string, base *pb.ServiceConfig, proposed *pb.ServiceConfig, created time.Time) *admin.PendingApprovalError {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.pending == nil {
+		q.pending = make(map[string]*pendingChange)
+	}
+
+	q.nextID++
+	id := strconv.FormatInt(q.nextID, 10)
+	q.pending[id] = &pendingChange{
+		PendingChange: admin.PendingChange{
+			ID:          id,
+			User:        user,
+			Description: description,
+			Created:     created.Unix(),
+			BaseVersion: base.Version,
+			Changes:     configChanges(base, proposed),
+			Config:      proposed}}
+
+	logging.Printf("Config change %v (%v) by %v is pending approval", id, description, user)
+	return &admin.PendingApprovalError{ChangeID: id}
+}
+
+// begin starts approving or rejecting a pending change on behalf of a user, who must be an
+// approver other than the user who made the change. It must be followed by finish.
+func (q *approvalQueue) begin(id, user string) (*pendingChange, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if !q.approvers[user] {
+		return nil, admin.ErrNotApprover
+	}
+
+	c := q.pending[id]
+	if c == nil || c.approving {
+		return nil, admin.ErrNoSuchChange
+	}
+
+	if c.User == user {
+		return nil, admin.ErrSelfApproval
+	}
+
+	c.approving = true
+	return c, nil
+}
+
+// finish removes a change once it is applied or rejected, or else leaves it pending.
+func (q *approvalQueue) finish(id string, done bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if done {
+		delete(q.pending, id)
+	} else if c := q.pending[id]; c != nil {
+		c.approving = false
+	}
+}
+
+func (q *approvalQueue) list() []*admin.PendingChange {
+	q.Lock()
+	defer q.Unlock()
+
+	changes := make([]*admin.PendingChange, 0, len(q.pending))
+	for _, c := range q.pending {
+		pc := c.PendingChange
+		changes = append(changes, &pc)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, _ := strconv.ParseInt(changes[i].ID, 10, 64)
+		b, _ := strconv.ParseInt(changes[j].ID, 10, 64)
+		return a < b
+	})
+
+	return changes
+}
+
+// SetApprovers enables two-person approval, if any users are given, so that config changes made
+// through the admin API must be approved by one of these users, other than the one who made them,
+// before they are applied.
+func (s *server) SetApprovers(users ...string) {
+	s.approvals.setApprovers(users)
+}
+
+func (s *server) PendingChanges() []*admin.PendingChange {
+	return s.approvals.list()
+}
+
+func (s *server) ApproveChange(id, user string) error {
+	c, err := s.approvals.begin(id, user)
+	if err != nil {
+		return err
+	}
+
+	// The change is applied as reviewed, so is only applied to the config it was made to. If it
+	// can't be applied, it remains pending, and can be rejected.
+	err = s.applyConfigUpdate(c.User+", approved by "+user, func(cfg *pb.ServiceConfig) error {
+		if cfg.Version != c.BaseVersion {
+			return admin.ErrStaleChange
+		}
+
+		*cfg = *config.CloneConfig(c.Config)
+		return nil
+	})
+	s.approvals.finish(id, err == nil)
+
+	if err != nil {
+		logging.Printf("Config change %v (%v) by %v couldn't be applied: %v", id, c.Description, c.User, err)
+		return err
+	}
+
+	logging.Printf("Config change %v (%v) by %v approved by %v", id, c.Description, c.User, user)
+	return nil
+}
+
+func (s *server) RejectChange(id, user string) error {
+	c, err := s.approvals.begin(id, user)
+	if err != nil {
+		return err
+	}
+
+	s.approvals.finish(id, true)
+	logging.Printf("Config change %v (%v) by %v rejected by %v", id, c.Description, c.User, user)
+	return nil
+}
+
+// proposeConfigUpdate applies a config change to a copy of the current config, validates it, and
+// queues the resulting config for approval.
+func (s *server) proposeConfigUpdate(user, description string, updater func(*pb.ServiceConfig) error) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	base := s.Configs()
+	proposed := config.CloneConfig(base)
+	err := updater(proposed)
+	if err == errConfigUnchanged {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	config.ApplyDefaults(proposed)
+	if err := validateServiceConfig(proposed); err != nil {
+		return err
+	}
+
+	return s.approvals.propose(user, description, base, proposed, s.now())
+}
+
+// configChanges summarizes the namespaces and buckets added, removed or changed between two
+// configs, for approvers to review.
+func configChanges(from, to *pb.ServiceConfig) []string {
+	var changes []string
+	for _, name := range union(config.NamespaceNames(from), config.NamespaceNames(to)) {
+		n1, n2 := from.Namespaces[name], to.Namespaces[name]
+		switch {
+		case n1 == nil:
+			changes = append(changes, "added namespace "+name)
+			continue
+		case n2 == nil:
+			changes = append(changes, "removed namespace "+name)
+			continue
+		}
+
+		// Compare namespace settings separately from their buckets.
+		s1, s2 := proto.Clone(n1).(*pb.NamespaceConfig), proto.Clone(n2).(*pb.NamespaceConfig)
+		s1.Buckets, s2.Buckets = nil, nil
+		if !proto.Equal(s1, s2) {
+			changes = append(changes, "changed namespace "+name)
+		}
+
+		for _, bucket := range union(bucketNames(n1), bucketNames(n2)) {
+			b1, b2 := n1.Buckets[bucket], n2.Buckets[bucket]
+			fqn := config.FullyQualifiedName(name, bucket)
+			switch {
+			case b1 == nil:
+				changes = append(changes, "added bucket "+fqn)
+			case b2 == nil:
+				changes = append(changes, "removed bucket "+fqn)
+			case !proto.Equal(b1, b2):
+				changes = append(changes, "changed bucket "+fqn)
+			}
+		}
+	}
+
+	// Compare everything else, except for when and by whom the configs were made.
+	c1, c2 := config.CloneConfig(from), config.CloneConfig(to)
+	for _, c := range []*pb.ServiceConfig{c1, c2} {
+		c.Namespaces, c.Version, c.User, c.Date = nil, 0, "", 0
+	}
+
+	if !proto.Equal(c1, c2) {
+		changes = append(changes, "changed service settings")
+	}
+
+	return changes
+}
+
+func bucketNames(n *pb.NamespaceConfig) []string {
+	names := make([]string, 0, len(n.Buckets))
+	for name := range n.Buckets {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// union returns the sorted, distinct names in two lists.
+func union(names1, names2 []string) []string {
+	seen := make(map[string]bool, len(names1)+len(names2))
+	var names []string
+	for _, name := range append(names1, names2...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
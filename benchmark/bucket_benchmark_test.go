@@ -11,6 +11,7 @@ import (
 	"github.com/square/quotaservice"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
 
 	pbconfig "github.com/square/quotaservice/protos/config"
 )
@@ -30,7 +31,11 @@ var benchmarkCfg = func() *pbconfig.ServiceConfig {
 	return c
 }()
 
-var benchmarkContainer, _, _ = quotaservice.NewBucketContainerWithMocks(benchmarkCfg)
+var benchmarkContainer = quotaservice.NewBucketContainer(&qstesting.MockBucketFactory{}, &qstesting.MockEmitter{}, qstesting.NewReaperConfig())
+
+func init() {
+	benchmarkContainer.Init(benchmarkCfg)
+}
 
 func BenchmarkDynamicBucket(b *testing.B) {
 	for i := 0; i < b.N; i++ {
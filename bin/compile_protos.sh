@@ -9,6 +9,8 @@ go get -u github.com/golang/protobuf/{proto,protoc-gen-go}
 
 protoc --go_out=plugins=grpc:. ./protos/*.proto --proto_path ./
 protoc --go_out=plugins=grpc:. ./protos/config/*.proto --proto_path ./
+protoc --go_out=plugins=grpc:. ./protos/rls/*.proto --proto_path ./
+protoc --go_out=plugins=grpc:. ./protos/rlqs/*.proto --proto_path ./
 
 # need the .2 extension so that this works on os x and linux equally
 sed -i.2 -e 's/\(json:"\([^,]*\),omitempty"\)/\1 yaml:"\2"/' ./protos/config/configs.pb.go
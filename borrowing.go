@@ -0,0 +1,136 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// borrowingBucket borrows unused tokens from sibling buckets in its namespace when it can't grant a
+// request itself. Each sibling is asked for the tokens without waiting, so a single Take on the
+// sibling either grants them from its unused capacity or leaves it untouched.
+//
+// Tokens borrowed are outstanding until the bucket repays them, at its own fill rate. With
+// max_borrowed_tokens set, tokens are reserved against that cap before any sibling is asked, so
+// concurrent requests can't together borrow more than it allows.
+type borrowingBucket struct {
+	Bucket
+	ns  *namespace
+	cfg *pbconfig.BucketConfig
+	now func() time.Time
+
+	sync.Mutex
+	// borrowed is the number of tokens outstanding, as of repaidAt.
+	borrowed int64
+	repaidAt time.Time
+}
+
+// withBorrowing decorates b to borrow from its siblings in ns, if its config names any.
+func withBorrowing(b Bucket, ns *namespace, cfg *pbconfig.BucketConfig) Bucket {
+	if b == nil || len(cfg.BorrowFrom) == 0 {
+		return b
+	}
+
+	return &borrowingBucket{Bucket: b, ns: ns, cfg: cfg, now: time.Now}
+}
+
+func (b *borrowingBucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	wait, ok, err := b.Bucket.Take(ctx, numTokens, maxWaitTime)
+	if err != nil || ok {
+		return wait, ok, err
+	}
+
+	if !b.reserve(numTokens) {
+		return wait, ok, err
+	}
+
+	for _, name := range b.cfg.BorrowFrom {
+		b.ns.RLock()
+		sibling := b.ns.buckets[name]
+		b.ns.RUnlock()
+
+		// Siblings lend their own tokens, rather than borrowing in turn.
+		if s, isBorrower := sibling.(*borrowingBucket); isBorrower {
+			sibling = s.Bucket
+		}
+
+		if sibling == nil {
+			continue
+		}
+
+		if _, lent, err := sibling.Take(ctx, numTokens, 0); err != nil || !lent {
+			continue
+		}
+
+		// If the request was abandoned while borrowing, the caller won't use the tokens.
+		if ctx.Err() != nil {
+			_ = sibling.Charge(context.Background(), -numTokens)
+			break
+		}
+
+		return 0, true, nil
+	}
+
+	b.release(numTokens)
+	return wait, ok, err
+}
+
+// reserve records numTokens as borrowed, returning false if that would exceed max_borrowed_tokens.
+func (b *borrowingBucket) reserve(numTokens int64) bool {
+	limit := b.cfg.GetMaxBorrowedTokens()
+	if limit <= 0 {
+		return true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.repay()
+	if b.borrowed+numTokens > limit {
+		return false
+	}
+
+	b.borrowed += numTokens
+	return true
+}
+
+// release returns tokens reserved, but not borrowed, to the allowance of max_borrowed_tokens.
+func (b *borrowingBucket) release(numTokens int64) {
+	if b.cfg.GetMaxBorrowedTokens() <= 0 {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.borrowed -= numTokens
+	if b.borrowed < 0 {
+		b.borrowed = 0
+	}
+}
+
+// repay reduces the tokens outstanding by those the bucket has refilled since they were last
+// repaid. Must be called with the lock held.
+func (b *borrowingBucket) repay() {
+	now := b.now()
+	fillRate := b.cfg.GetFillRate()
+	if b.borrowed == 0 || fillRate <= 0 {
+		b.repaidAt = now
+		return
+	}
+
+	repaid := int64(now.Sub(b.repaidAt).Seconds() * float64(fillRate))
+	if repaid >= b.borrowed {
+		b.borrowed, b.repaidAt = 0, now
+		return
+	}
+
+	// Carry over time that hasn't yet repaid a whole token.
+	b.borrowed -= repaid
+	b.repaidAt = b.repaidAt.Add(time.Duration(float64(repaid) / float64(fillRate) * float64(time.Second)))
+}
@@ -0,0 +1,126 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func newBorrowingTestContainer() (*bucketContainer, MockBucketFactory) {
+	c := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig("ns")
+	bursty := config.NewDefaultBucketConfig("bursty")
+	bursty.BorrowFrom = []string{"busy", "quiet"}
+	bursty.MaxBorrowedTokens = proto.Int64(5)
+	quiet := config.NewDefaultBucketConfig("quiet")
+	quiet.BorrowFrom = []string{"bursty"}
+	helpers.PanicError(config.AddBucket(ns, bursty))
+	helpers.PanicError(config.AddBucket(ns, quiet))
+	helpers.PanicError(config.AddBucket(ns, config.NewDefaultBucketConfig("busy")))
+	helpers.PanicError(config.AddNamespace(c, ns))
+
+	bc, bf := NewBucketContainerWithMocks(c)
+	bf.SetWaitTime("ns", "bursty", time.Minute)
+	bf.SetWaitTime("ns", "busy", time.Minute)
+	return bc, bf
+}
+
+func TestBorrowing(t *testing.T) {
+	bc, bf := newBorrowingTestContainer()
+	b, _ := bc.FindBucket("ns", "bursty")
+	take := func(numTokens int64) bool {
+		_, ok, err := b.Take(context.Background(), numTokens, 0)
+		helpers.CheckError(t, err)
+		return ok
+	}
+
+	if !take(5) {
+		t.Fatal("Expected tokens to be borrowed from a quiet sibling")
+	}
+
+	// Start with nothing outstanding, so that only the size of the request exceeds the cap.
+	b.(*borrowingBucket).borrowed = 0
+	if take(6) {
+		t.Fatal("Expected borrowing to be limited to max_borrowed_tokens")
+	}
+
+	// quiet can't borrow back from bursty, which would borrow from quiet in turn.
+	bf.SetWaitTime("ns", "quiet", time.Minute)
+	if take(1) {
+		t.Fatal("Expected no tokens to be borrowed from busy siblings")
+	}
+
+	if b.(*borrowingBucket).borrowed != 0 {
+		t.Fatalf("Expected tokens not borrowed to be released, got %v", b.(*borrowingBucket).borrowed)
+	}
+
+	bf.SetWaitTime("ns", "bursty", 0)
+	if !take(10) {
+		t.Fatal("Expected a bucket to grant its own tokens regardless of borrowing")
+	}
+}
+
+func TestOutstandingBorrowedTokens(t *testing.T) {
+	bc, _ := newBorrowingTestContainer()
+	bucket, _ := bc.FindBucket("ns", "bursty")
+	b := bucket.(*borrowingBucket)
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+	take := func(numTokens int64) bool {
+		_, ok, err := b.Take(context.Background(), numTokens, 0)
+		helpers.CheckError(t, err)
+		return ok
+	}
+
+	if !take(3) || take(3) {
+		t.Fatal("Expected max_borrowed_tokens to cap the tokens outstanding across requests")
+	}
+
+	if !take(2) {
+		t.Fatal("Expected the rest of max_borrowed_tokens to be borrowed")
+	}
+
+	// Borrowed tokens are repaid at the bucket's fill rate of 50 tokens a second.
+	now = now.Add(50 * time.Millisecond)
+	if !take(2) || take(2) {
+		t.Fatalf("Expected 2 borrowed tokens to have been repaid, %v outstanding", b.borrowed)
+	}
+
+	now = now.Add(time.Hour)
+	if !take(5) {
+		t.Fatal("Expected all borrowed tokens to have been repaid")
+	}
+}
+
+func TestBorrowingRefundsAbandonedRequests(t *testing.T) {
+	bc, bf := newBorrowingTestContainer()
+	b, _ := bc.FindBucket("ns", "bursty")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok, _ := b.Take(ctx, 4, 0); ok {
+		t.Fatal("Expected an abandoned request not to borrow tokens")
+	}
+
+	if charged := bf.Charged("ns", "quiet"); charged != -4 {
+		t.Fatalf("Expected the lender to be refunded 4 tokens, got %v", charged)
+	}
+
+	if b.(*borrowingBucket).borrowed != 0 {
+		t.Fatalf("Expected no tokens to be outstanding, got %v", b.(*borrowingBucket).borrowed)
+	}
+}
+
+func TestBorrowingBackingBucket(t *testing.T) {
+	delegate := &countingBucket{}
+	if b, err := backingBucket(&borrowingBucket{Bucket: delegate}); err != nil || b != delegate {
+		t.Fatalf("Expected multi-bucket takes to use the underlying bucket, got %v, %v", b, err)
+	}
+}
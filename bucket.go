@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/square/quotaservice/admin"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/events"
 	"github.com/square/quotaservice/logging"
@@ -26,6 +27,7 @@ type bucketContainer struct {
 	n             notifier
 	namespaces    map[string]*namespace
 	defaultBucket Bucket
+	quotaGroups   map[string]Bucket
 	r             *reaper
 	sync.RWMutex  // Embedded mutex
 }
@@ -34,10 +36,16 @@ type namespace struct {
 	n                  notifier
 	name               string
 	cfg                *pbconfig.NamespaceConfig
+	serviceCfg         *pbconfig.ServiceConfig // For resolving bucket templates
 	buckets            map[string]Bucket
 	dynamicBucketCount int32
-	defaultBucket      Bucket
-	sync.RWMutex       // Embedded mutex
+	// Sum of the fair share weights of the namespace's dynamic buckets.
+	dynamicBucketWeights int64
+	// Fair share weights of dynamic buckets when they were created, which the config may since
+	// have changed.
+	fairShareWeights map[string]int64
+	defaultBucket    Bucket
+	sync.RWMutex     // Embedded mutex
 }
 
 type notifier interface {
@@ -51,6 +59,10 @@ type Bucket interface {
 	// necessary. Success is true if tokens can be obtained, false if cannot be obtained within
 	// the specified maximum wait time.
 	Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (waitTime time.Duration, success bool, err error)
+	// Charge unconditionally takes tokens from a token bucket, without waiting and regardless of
+	// max debt, or returns tokens to it if numTokens is negative. It is used to reconcile tokens
+	// reserved by Take with the actual cost of an operation.
+	Charge(ctx context.Context, numTokens int64) error
 	Config() *pbconfig.BucketConfig
 	// Dynamic indicates whether a bucket is a dynamic one, or one that is statically defined in
 	// configuration.
@@ -65,6 +77,13 @@ type Bucket interface {
 type DefaultBucket struct {
 }
 
+// ErrChargeNotSupported is returned by bucket implementations that don't support Charge.
+var ErrChargeNotSupported = errors.New("bucket does not support charging")
+
+func (d DefaultBucket) Charge(_ context.Context, _ int64) error {
+	return ErrChargeNotSupported
+}
+
 func (d DefaultBucket) Destroy() {
 	// no-op
 }
@@ -82,8 +101,10 @@ func (ns *namespace) removeBucket(bucketName string) {
 		delete(ns.buckets, bucketName)
 		if bucket.Dynamic() {
 			ns.dynamicBucketCount--
+			ns.dynamicBucketWeights -= ns.fairShareWeights[bucketName]
+			delete(ns.fairShareWeights, bucketName)
 		}
-		ns.n.Emit(events.NewBucketRemovedEvent(ns.name, bucketName, bucket.Dynamic()))
+		ns.n.Emit(events.WithBucketConfig(events.NewBucketRemovedEvent(ns.name, bucketName, bucket.Dynamic()), bucket.Config()))
 		bucket.Destroy()
 	}
 }
@@ -102,10 +123,11 @@ func (ns *namespace) destroy() {
 }
 
 // swapCfg swaps the bucket config for the namespace.
-func (ns *namespace) swapCfg(newCfg *pbconfig.NamespaceConfig) {
+func (ns *namespace) swapCfg(newCfg *pbconfig.NamespaceConfig, newServiceCfg *pbconfig.ServiceConfig) {
 	ns.Lock()
 	defer ns.Unlock()
 	ns.cfg = newCfg
+	ns.serviceCfg = newServiceCfg
 }
 
 // BucketFactory creates buckets.
@@ -120,12 +142,76 @@ type BucketFactory interface {
 	Client() interface{}
 }
 
+// BucketFactoryCloser is optionally implemented by BucketFactories that need to release resources,
+// or save state, when the server stops.
+type BucketFactoryCloser interface {
+	Close()
+}
+
+// TokenInspector may be implemented by Buckets that can report the tokens they hold, for
+// EVENT_TOKEN_SNAPSHOT events.
+type TokenInspector interface {
+	// Tokens returns the tokens available, or, if negative, the tokens owed by a bucket in debt.
+	Tokens(ctx context.Context) (int64, error)
+}
+
+// BucketWarmer may be implemented by Buckets that load their state lazily, e.g. from a datastore,
+// so that static buckets can be loaded when a config is applied, if the config sets
+// eager_static_buckets.
+type BucketWarmer interface {
+	// Warm loads the bucket's state, so that its first request doesn't wait for it.
+	Warm(ctx context.Context) error
+}
+
+// DebtForgiver may be implemented by Buckets that can forgive their debt, so that a bucket put into
+// debt by an accidentally large request isn't locked out until the debt is paid back.
+type DebtForgiver interface {
+	// ForgiveDebt clears the bucket's debt, if any, so that tokens accumulate again from now.
+	ForgiveDebt(ctx context.Context) error
+}
+
+// BucketResetter may be implemented by Buckets that can be restored to their initial state, e.g.
+// after a config mistake or while mitigating an incident.
+type BucketResetter interface {
+	// Reset restores the bucket to full capacity, clearing any debt.
+	Reset(ctx context.Context) error
+}
+
+// ErrNotSupported is returned by buckets decorating other buckets, e.g. those created by the
+// factories in buckets/shedding, when the buckets they decorate don't implement TokenInspector,
+// BucketWarmer, DebtForgiver or BucketResetter.
+var ErrNotSupported = errors.New("bucket does not support this operation")
+
+// BucketTake is a number of tokens to take from a bucket, as part of a MultiBucketTaker.TakeAll.
+type BucketTake struct {
+	Bucket Bucket
+	Tokens int64
+}
+
+// MultiBucketTaker is optionally implemented by BucketFactories that can take tokens from several
+// of their buckets atomically, for operations that consume several resources at once.
+type MultiBucketTaker interface {
+	// TakeAll takes tokens from each of the given buckets, all created by this factory, such that
+	// either tokens are taken from all of them, or from none. The wait time returned is the longest
+	// of the buckets' wait times. Success is false, and nothing is taken, if any bucket can't grant
+	// its tokens within maxWaitTime.
+	TakeAll(ctx context.Context, takes []BucketTake, maxWaitTime time.Duration) (waitTime time.Duration, success bool, err error)
+}
+
+// StaleBucketCleaner is optionally implemented by BucketFactories that store bucket state in an
+// external datastore, to delete state left behind by buckets that no longer exist, or by earlier
+// config versions. In a dry run, nothing is deleted.
+type StaleBucketCleaner interface {
+	CleanStaleBuckets(ctx context.Context, dryRun bool) (*admin.CleanupReport, error)
+}
+
 // NewBucketContainer creates a new bucket container.
 func NewBucketContainer(bf BucketFactory, n notifier, r config.ReaperConfig) (bc *bucketContainer) {
 	bc = &bucketContainer{
-		bf:         bf,
-		n:          n,
-		namespaces: make(map[string]*namespace)}
+		bf:          bf,
+		n:           n,
+		namespaces:  make(map[string]*namespace),
+		quotaGroups: make(map[string]Bucket)}
 
 	bc.r = newReaper(bc, r)
 
@@ -144,6 +230,8 @@ func (bc *bucketContainer) initLocked(cfg *pbconfig.ServiceConfig) {
 		logging.Fatal("BucketContainer already has a config; cannot be re-initialized")
 	}
 	bc.cfg = cfg
+	bc.updateQuotaGroupsLocked(cfg.QuotaGroups)
+
 	if cfg.GlobalDefaultBucket != nil {
 		if bc.defaultBucket != nil {
 			logging.Fatal("Global default bucket already exists when initializing")
@@ -161,23 +249,11 @@ func (bc *bucketContainer) initLocked(cfg *pbconfig.ServiceConfig) {
 }
 
 func (bc *bucketContainer) createNamespaceLocked(nsCfg *pbconfig.NamespaceConfig) {
-	nsp := &namespace{n: bc.n, name: nsCfg.Name, cfg: nsCfg, buckets: make(map[string]Bucket)}
-	if nsCfg.DefaultBucket != nil {
-		nsp.defaultBucket = bc.bf.NewBucket(nsCfg.Name, config.DefaultBucketName, nsCfg.DefaultBucket, false)
-	}
-
-	nsp.Lock()
-	defer nsp.Unlock()
-
-	for bucketName, bucketCfg := range nsCfg.Buckets {
-		bc.createNewNamedBucketFromCfg(nsCfg.Name, bucketName, nsp, bucketCfg, false)
-	}
-
-	bc.namespaces[nsCfg.Name] = nsp
+	bc.namespaces[nsCfg.Name] = bc.newNamespace(nsCfg, bc.cfg)
 }
 
 func (bc *bucketContainer) createGlobalDefaultBucketLocked(cfg *pbconfig.BucketConfig) {
-	bc.defaultBucket = bc.bf.NewBucket(config.GlobalNamespace, config.DefaultBucketName, cfg, false)
+	bc.defaultBucket = bc.newBucket(config.GlobalNamespace, config.DefaultBucketName, config.ResolveBucketTemplate(bc.cfg, cfg), false)
 }
 
 // FindBucket locates a bucket for a given name and namespace. If the namespace doesn't exist, and
@@ -266,10 +342,28 @@ func (bc *bucketContainer) countDynamicBuckets(namespace string) int32 {
 	return c
 }
 
+// countBuckets counts the buckets that exist in a namespace, or in all namespaces if the namespace
+// is empty.
+func (bc *bucketContainer) countBuckets(namespace string) int64 {
+	bc.RLock()
+	defer bc.RUnlock()
+
+	var c int64
+	for name, ns := range bc.namespaces {
+		if namespace == "" || name == namespace {
+			ns.RLock()
+			c += int64(len(ns.buckets))
+			ns.RUnlock()
+		}
+	}
+	return c
+}
+
 func (bc *bucketContainer) createNewNamedBucketFromCfg(namespace, bucketName string, ns *namespace, bCfg *pbconfig.BucketConfig, dyn bool) Bucket {
-	bc.n.Emit(events.NewBucketCreatedEvent(namespace, bucketName, dyn))
+	bCfg = config.ResolveBucketConfig(ns.serviceCfg, ns.cfg, bCfg)
+	bc.n.Emit(events.WithBucketConfig(events.NewBucketCreatedEvent(namespace, bucketName, dyn), bCfg))
 	var bucket Bucket
-	bucket = bc.bf.NewBucket(namespace, bucketName, bCfg, dyn)
+	bucket = withBorrowing(bc.newBucket(namespace, bucketName, bCfg, dyn), ns, bCfg)
 
 	if bucket == nil {
 		// TODO(manik) why would this ever happen? Should we panic?
@@ -277,6 +371,15 @@ func (bc *bucketContainer) createNewNamedBucketFromCfg(namespace, bucketName str
 	}
 
 	if dyn {
+		weight := config.FairShareWeight(ns.cfg, bucketName)
+		if ns.cfg.FairShareFillRate > 0 {
+			bucket = newFairShareBucket(bucket, ns, weight)
+		}
+
+		if ns.cfg.NegativeCacheMillis > 0 {
+			bucket = newNegativeCachedBucket(bucket, time.Duration(ns.cfg.NegativeCacheMillis)*time.Millisecond)
+		}
+
 		// Apply a watcher if a bucket is dynamic. We don't expire
 		// static buckets since FindBucket won't create a new bucket
 		// for static buckets. Also, removing idle static buckets
@@ -284,6 +387,11 @@ func (bc *bucketContainer) createNewNamedBucketFromCfg(namespace, bucketName str
 		// small.
 		bucket, _ = bc.r.applyWatch(bucket, namespace, bucketName, bCfg)
 		ns.dynamicBucketCount++
+		ns.dynamicBucketWeights += weight
+		if ns.fairShareWeights == nil {
+			ns.fairShareWeights = make(map[string]int64)
+		}
+		ns.fairShareWeights[bucketName] = weight
 	}
 	ns.buckets[bucketName] = bucket
 
@@ -291,6 +399,60 @@ func (bc *bucketContainer) createNewNamedBucketFromCfg(namespace, bucketName str
 	return bucket
 }
 
+// staticBucket is a bucket created with the config, rather than on demand.
+type staticBucket struct {
+	namespace, name string
+	Bucket
+}
+
+// staticBuckets returns the buckets that are created with the config: default buckets, statically
+// defined buckets, and quota groups' shared pools.
+func (bc *bucketContainer) staticBuckets() []staticBucket {
+	bc.RLock()
+	defer bc.RUnlock()
+
+	var static []staticBucket
+	if bc.defaultBucket != nil {
+		static = append(static, staticBucket{config.GlobalNamespace, config.DefaultBucketName, bc.defaultBucket})
+	}
+
+	for name, pool := range bc.quotaGroups {
+		static = append(static, staticBucket{config.QuotaGroupNamespace, name, pool})
+	}
+
+	for nsName, ns := range bc.namespaces {
+		ns.RLock()
+		if ns.defaultBucket != nil {
+			static = append(static, staticBucket{nsName, config.DefaultBucketName, ns.defaultBucket})
+		}
+
+		for name, b := range ns.buckets {
+			if !b.Dynamic() {
+				static = append(static, staticBucket{nsName, name, b})
+			}
+		}
+		ns.RUnlock()
+	}
+
+	return static
+}
+
+// findExistingBucket returns a bucket if it has been created, without creating dynamic buckets or
+// falling back to default buckets.
+func (bc *bucketContainer) findExistingBucket(namespace, bucketName string) Bucket {
+	bc.RLock()
+	ns := bc.namespaces[namespace]
+	bc.RUnlock()
+
+	if ns == nil {
+		return nil
+	}
+
+	ns.RLock()
+	defer ns.RUnlock()
+	return ns.buckets[bucketName]
+}
+
 func (bc *bucketContainer) NamespaceExists(namespace string) bool {
 	bc.RLock()
 	defer bc.RUnlock()
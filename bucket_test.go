@@ -5,9 +5,13 @@
 package quotaservice
 
 import (
+	"context"
+	"math"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/test/helpers"
 
@@ -44,9 +48,15 @@ var cfg = func() *pbconfig.ServiceConfig {
 	return c
 }()
 
-var container, _, _ = NewBucketContainerWithMocks(cfg)
+// newContainer creates a container for cfg. It can't be created when tests are initialized, before
+// the mocks are set up.
+func newContainer() *bucketContainer {
+	bc, _ := NewBucketContainerWithMocks(cfg)
+	return bc
+}
 
 func TestFallbackToGlobalDefaultBucket(t *testing.T) {
+	container := newContainer()
 	b, _ := container.FindBucket("nonexistent_namespace", "nonexistent_bucket")
 
 	if b == nil {
@@ -59,6 +69,7 @@ func TestFallbackToGlobalDefaultBucket(t *testing.T) {
 }
 
 func TestFallbackToDefaultBucket(t *testing.T) {
+	container := newContainer()
 	b, _ := container.FindBucket("x", "nonexistent_bucket")
 	if b == nil {
 		t.Fatal("Should fall back to default bucket.")
@@ -70,6 +81,7 @@ func TestFallbackToDefaultBucket(t *testing.T) {
 }
 
 func TestDynamicBucket(t *testing.T) {
+	container := newContainer()
 	initGoroutineCount := runtime.NumGoroutine()
 	b, _ := container.FindBucket("y", "new")
 	if b == nil {
@@ -96,6 +108,7 @@ func TestDynamicBucket(t *testing.T) {
 }
 
 func TestBucketNamespaces(t *testing.T) {
+	container := newContainer()
 	bx, _ := container.FindBucket("x", "a")
 	if bx == nil {
 		t.Fatal("Should create new bucket.")
@@ -120,6 +133,7 @@ func TestBucketNamespaces(t *testing.T) {
 }
 
 func TestMaxDynamic(t *testing.T) {
+	container := newContainer()
 	c := container.countDynamicBuckets("z")
 	if c != 0 {
 		t.Fatalf("Should have 0 dynamic buckets. Instead was %v", c)
@@ -139,3 +153,128 @@ func TestMaxDynamic(t *testing.T) {
 		t.Fatal("Should not have created dynamic bucket z:should_fail")
 	}
 }
+
+func TestQuotaGroup(t *testing.T) {
+	c := config.NewDefaultServiceConfig()
+	c.QuotaGroups = map[string]*pbconfig.BucketConfig{"shared": config.NewDefaultBucketConfig("shared")}
+
+	for _, name := range []string{"n1", "n2"} {
+		ns := config.NewDefaultNamespaceConfig(name)
+		b := config.NewDefaultBucketConfig("b")
+		b.QuotaGroup = "shared"
+		helpers.PanicError(config.AddBucket(ns, b))
+		helpers.PanicError(config.AddNamespace(c, ns))
+	}
+
+	bc, bf := NewBucketContainerWithMocks(c)
+
+	for _, name := range []string{"n1", "n2"} {
+		b, _ := bc.FindBucket(name, "b")
+		helpers.CheckError(t, b.Charge(context.Background(), 1))
+	}
+
+	if charged := bf.Charged(config.QuotaGroupNamespace, "shared"); charged != 2 {
+		t.Fatalf("Expected members to draw from the shared pool, but it was charged %v tokens", charged)
+	}
+
+	// Members pick up a replaced pool.
+	newGroup := config.NewDefaultBucketConfig("shared")
+	newGroup.Size = proto.Int64(5)
+	bc.Lock()
+	bc.updateQuotaGroupsLocked(map[string]*pbconfig.BucketConfig{"shared": newGroup})
+	bc.Unlock()
+
+	b, _ := bc.FindBucket("n1", "b")
+	helpers.CheckError(t, b.Charge(context.Background(), 1))
+	if charged := bf.Charged(config.QuotaGroupNamespace, "shared"); charged != 1 {
+		t.Fatalf("Expected members to draw from the new pool, but it was charged %v tokens", charged)
+	}
+
+	bc.Lock()
+	bc.updateQuotaGroupsLocked(nil)
+	bc.Unlock()
+
+	if b.Charge(context.Background(), 1) == nil {
+		t.Fatal("Expected an error drawing from a removed quota group")
+	}
+}
+
+// countingBucket records the tokens requested by Take, granting them if allow is set.
+type countingBucket struct {
+	DefaultBucket
+	requested []int64
+	allow     bool
+	cfg       *pbconfig.BucketConfig
+}
+
+func (b *countingBucket) Take(_ context.Context, numTokens int64, _ time.Duration) (time.Duration, bool, error) {
+	b.requested = append(b.requested, numTokens)
+	return 0, b.allow, nil
+}
+
+func (b *countingBucket) Config() *pbconfig.BucketConfig { return b.cfg }
+func (b *countingBucket) Dynamic() bool                  { return false }
+
+func TestSampledBucket(t *testing.T) {
+	delegate := &countingBucket{allow: true, cfg: &pbconfig.BucketConfig{Size: proto.Int64(100)}}
+	b := newSampledBucket(delegate, 10)
+	samples := []int64{3, 0, 5, 0, 1}
+	b.random = func(n int64) int64 {
+		if n != 10 {
+			t.Fatalf("Expected to sample 1 in 10 requests, got 1 in %v", n)
+		}
+
+		s := samples[0]
+		samples = samples[1:]
+		return s
+	}
+
+	expectations := []bool{true, true, true, false, false}
+	for i, expected := range expectations {
+		if i == 3 {
+			delegate.allow = false
+		}
+
+		_, ok, err := b.Take(context.Background(), 2, 0)
+		helpers.CheckError(t, err)
+		if ok != expected {
+			t.Fatalf("Request %v: expected %v, got %v", i, expected, ok)
+		}
+	}
+
+	if len(delegate.requested) != 2 || delegate.requested[0] != 20 || delegate.requested[1] != 20 {
+		t.Fatalf("Expected 2 sampled requests for 20 tokens each, got %v", delegate.requested)
+	}
+
+	// Requests too large to scale up are enforced exactly, rather than denied.
+	delegate.allow = true
+	for _, numTokens := range []int64{11, math.MaxInt64 / 2} {
+		delegate.requested = nil
+		if _, ok, _ := b.Take(context.Background(), numTokens, 0); !ok || len(delegate.requested) != 1 || delegate.requested[0] != numTokens {
+			t.Fatalf("Expected a request for %v tokens to be enforced exactly, got %v", numTokens, delegate.requested)
+		}
+	}
+}
+
+func TestSampledBucketsCreated(t *testing.T) {
+	c := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig("ns")
+	sampled := config.NewDefaultBucketConfig("sampled")
+	sampled.Size = proto.Int64(1000)
+	sampled.SampleRate = proto.Int64(10)
+	helpers.PanicError(config.AddBucket(ns, sampled))
+	helpers.PanicError(config.AddBucket(ns, config.NewDefaultBucketConfig("exact")))
+	helpers.PanicError(config.AddNamespace(c, ns))
+
+	bc, _ := NewBucketContainerWithMocks(c)
+
+	b, _ := bc.FindBucket("ns", "sampled")
+	if _, ok := b.(*sampledBucket); !ok {
+		t.Fatalf("Expected a sampled bucket, got %T", b)
+	}
+
+	b, _ = bc.FindBucket("ns", "exact")
+	if _, ok := b.(*sampledBucket); ok {
+		t.Fatal("Expected bucket without a sample rate not to be sampled")
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/events"
 	"github.com/square/quotaservice/logging"
 	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
 )
 
 func TestTokenAcquisition(t *testing.T, bucket quotaservice.Bucket) {
@@ -65,17 +67,207 @@ func TestTokenAcquisition(t *testing.T, bucket quotaservice.Bucket) {
 	}
 }
 
+func TestCharge(t *testing.T, bucket quotaservice.Bucket) {
+	// Assumes a bucket of size 10, filling at 1 token per second.
+	_, s, err := bucket.Take(context.Background(), 10, 0)
+	helpers.CheckError(t, err)
+	if !s {
+		t.Fatal("Expecting success to be true.")
+	}
+
+	// Refunded tokens are available immediately.
+	helpers.CheckError(t, bucket.Charge(context.Background(), -5))
+	wait, s, err := bucket.Take(context.Background(), 5, 0)
+	helpers.CheckError(t, err)
+	if wait != 0 || !s {
+		t.Fatalf("Expecting refunded tokens to be available. Was %v, %v", wait, s)
+	}
+
+	// Extra charges put the bucket into debt, regardless of availability.
+	helpers.CheckError(t, bucket.Charge(context.Background(), 3))
+	wait, s, err = bucket.Take(context.Background(), 1, 10*time.Second)
+	helpers.CheckError(t, err)
+	if wait < 2*time.Second || !s {
+		t.Fatalf("Expecting to wait to pay back debt. Was %v, %v", wait, s)
+	}
+
+	// Refunds pay back debt first.
+	helpers.CheckError(t, bucket.Charge(context.Background(), -4))
+	wait, s, err = bucket.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+	if wait != 0 || !s {
+		t.Fatalf("Expecting debt to be paid back. Was %v, %v", wait, s)
+	}
+}
+
+func TestTokens(t *testing.T, bucket quotaservice.Bucket) {
+	// Assumes a new bucket of size 10, filling at 1 token per second.
+	inspector, ok := bucket.(quotaservice.TokenInspector)
+	if !ok {
+		t.Fatalf("Expecting %T to implement TokenInspector", bucket)
+	}
+
+	tokens, err := inspector.Tokens(context.Background())
+	helpers.CheckError(t, err)
+	if tokens != 10 {
+		t.Fatalf("Expecting a new bucket to be full. Was %v", tokens)
+	}
+
+	helpers.CheckError(t, bucket.Charge(context.Background(), 4))
+	tokens, err = inspector.Tokens(context.Background())
+	helpers.CheckError(t, err)
+	if tokens != 6 {
+		t.Fatalf("Expecting 6 tokens. Was %v", tokens)
+	}
+
+	// Debt is reported as negative tokens.
+	helpers.CheckError(t, bucket.Charge(context.Background(), 9))
+	tokens, err = inspector.Tokens(context.Background())
+	helpers.CheckError(t, err)
+	if tokens != -3 {
+		t.Fatalf("Expecting 3 tokens of debt. Was %v", tokens)
+	}
+}
+
+func TestForgiveDebt(t *testing.T, bucket quotaservice.Bucket) {
+	// Assumes a new bucket of size 10, filling at 1 token per second.
+	forgiver, ok := bucket.(quotaservice.DebtForgiver)
+	if !ok {
+		t.Fatalf("Expecting %T to implement DebtForgiver", bucket)
+	}
+
+	helpers.CheckError(t, bucket.Charge(context.Background(), 100))
+	helpers.CheckError(t, forgiver.ForgiveDebt(context.Background()))
+
+	tokens, err := bucket.(quotaservice.TokenInspector).Tokens(context.Background())
+	helpers.CheckError(t, err)
+	if tokens != 0 {
+		t.Fatalf("Expecting the debt to be forgiven. Was %v", tokens)
+	}
+
+	// Forgiving a bucket that isn't in debt doesn't add tokens.
+	helpers.CheckError(t, bucket.Charge(context.Background(), -4))
+	helpers.CheckError(t, forgiver.ForgiveDebt(context.Background()))
+	tokens, err = bucket.(quotaservice.TokenInspector).Tokens(context.Background())
+	helpers.CheckError(t, err)
+	if tokens != 4 {
+		t.Fatalf("Expecting 4 tokens. Was %v", tokens)
+	}
+}
+
+func TestReset(t *testing.T, bucket quotaservice.Bucket) {
+	// Assumes a new bucket of size 10, filling at 1 token per second.
+	resetter, ok := bucket.(quotaservice.BucketResetter)
+	if !ok {
+		t.Fatalf("Expecting %T to implement BucketResetter", bucket)
+	}
+
+	helpers.CheckError(t, bucket.Charge(context.Background(), 100))
+	helpers.CheckError(t, resetter.Reset(context.Background()))
+
+	tokens, err := bucket.(quotaservice.TokenInspector).Tokens(context.Background())
+	helpers.CheckError(t, err)
+	if tokens != 10 {
+		t.Fatalf("Expecting the bucket to be full. Was %v", tokens)
+	}
+}
+
+func TestStrict(t *testing.T, bucket quotaservice.Bucket) {
+	// Assumes a new bucket of size 10, filling at 1 token per second, allowing debt.
+	wait, s, err := bucket.Take(context.Background(), 10, 0)
+	helpers.CheckError(t, err)
+	if wait != 0 || !s {
+		t.Fatalf("Expecting all tokens to be taken. Was %v, %v", wait, s)
+	}
+
+	strict := quotaservice.WithStrict(context.Background())
+	_, s, err = bucket.Take(strict, 1, time.Minute)
+	helpers.CheckError(t, err)
+	if s {
+		t.Fatal("Expecting a strict request not to go into debt.")
+	}
+
+	_, s, err = bucket.Take(context.Background(), 1, time.Minute)
+	helpers.CheckError(t, err)
+	if !s {
+		t.Fatal("Expecting a request that isn't strict to go into debt.")
+	}
+}
+
+func TestBlocked(t *testing.T, factory quotaservice.BucketFactory, open, blocked quotaservice.Bucket) {
+	// Assumes a new bucket with tokens available, and a bucket with a fill rate of 0.
+	_, s, err := blocked.Take(context.Background(), 1, time.Minute)
+	helpers.CheckError(t, err)
+	if s {
+		t.Fatal("Expecting a blocked bucket to deny requests.")
+	}
+
+	if taker, ok := factory.(quotaservice.MultiBucketTaker); ok {
+		_, s, err = taker.TakeAll(context.Background(), []quotaservice.BucketTake{{Bucket: open, Tokens: 1}, {Bucket: blocked, Tokens: 1}}, time.Minute)
+		helpers.CheckError(t, err)
+		if s {
+			t.Fatal("Expecting tokens not to be taken with a blocked bucket.")
+		}
+	}
+
+	_, s, err = open.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+	if !s {
+		t.Fatal("Expecting other buckets to grant requests.")
+	}
+}
+
+func TestTakeAll(t *testing.T, factory quotaservice.BucketFactory, a, b quotaservice.Bucket) {
+	// Assumes new buckets of size 10, filling at 1 token per second, with no max debt.
+	taker, ok := factory.(quotaservice.MultiBucketTaker)
+	if !ok {
+		t.Fatalf("Expecting %T to implement MultiBucketTaker", factory)
+	}
+
+	wait, s, err := taker.TakeAll(context.Background(), []quotaservice.BucketTake{{Bucket: a, Tokens: 4}, {Bucket: b, Tokens: 8}}, 0)
+	helpers.CheckError(t, err)
+	if wait != 0 || !s {
+		t.Fatalf("Expecting tokens to be taken from both buckets. Was %v, %v", wait, s)
+	}
+
+	// b can't grant 3 more, so none are taken from a either.
+	wait, s, err = taker.TakeAll(context.Background(), []quotaservice.BucketTake{{Bucket: a, Tokens: 3}, {Bucket: b, Tokens: 3}}, 0)
+	helpers.CheckError(t, err)
+	if s {
+		t.Fatal("Expecting success to be false.")
+	}
+
+	wait, s, err = a.Take(context.Background(), 6, 0)
+	helpers.CheckError(t, err)
+	if wait != 0 || !s {
+		t.Fatalf("Expecting no tokens to have been taken from a. Was %v, %v", wait, s)
+	}
+
+	// Tokens requested from the same bucket more than once are combined.
+	wait, s, err = taker.TakeAll(context.Background(), []quotaservice.BucketTake{{Bucket: b, Tokens: 1}, {Bucket: b, Tokens: 1}}, 0)
+	helpers.CheckError(t, err)
+	if wait != 0 || !s {
+		t.Fatalf("Expecting 2 tokens to be taken from b. Was %v, %v", wait, s)
+	}
+
+	wait, s, err = b.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+	if s {
+		t.Fatal("Expecting b to be empty.")
+	}
+}
+
 func TestGC(t *testing.T, factory quotaservice.BucketFactory, impl string) {
 	cfg := config.NewDefaultServiceConfig()
 	nsCfg := config.NewDefaultNamespaceConfig("n")
 	tpl := config.NewDefaultBucketConfig("")
 	// Times out every 250 millis.
-	tpl.MaxIdleMillis = 250
+	tpl.MaxIdleMillis = proto.Int64(250)
 	config.SetDynamicBucketTemplate(nsCfg, tpl)
 	helpers.CheckError(t, config.AddNamespace(cfg, nsCfg))
 
-	eventsEmitter := &quotaservice.MockEmitter{Events: make(chan events.Event, 100)}
-	container := quotaservice.NewBucketContainer(factory, eventsEmitter, quotaservice.NewReaperConfigForTests())
+	eventsEmitter := &qstesting.MockEmitter{Events: make(chan events.Event, 100)}
+	container := quotaservice.NewBucketContainer(factory, eventsEmitter, qstesting.NewReaperConfig())
 	container.Init(cfg)
 
 	// No GC should happen here as long as we are in use.
@@ -0,0 +1,113 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package cassandra
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// ErrTooMuchContention is returned when a bucket can't be updated within Config.MaxCASAttempts
+// attempts, due to concurrent updates.
+var ErrTooMuchContention = errors.New("too much contention updating bucket")
+
+type bucket struct {
+	factory    *bucketFactory
+	name       string
+	cfg        *pbconfig.BucketConfig
+	dynamic    bool
+	ttlSeconds int64
+	now        func() time.Time
+	quotaservice.DefaultBucket
+}
+
+// update reads the bucket's state, applies f to it, and writes it back if f returns true, retrying
+// if the bucket is updated concurrently.
+func (b *bucket) update(ctx context.Context, f func(buckets.TokenState, int64) (buckets.TokenState, bool)) error {
+	bf := b.factory
+
+	for attempt := 0; attempt < bf.cfg.MaxCASAttempts; attempt++ {
+		state := buckets.NewTokenState(b.cfg)
+		var version int64
+
+		found, err := bf.session.Scan(ctx, bf.cfg.ReadConsistency, bf.selectStmt, []interface{}{b.name},
+			&state.AccumulatedTokens, &state.TokensNextAvailableNanos, &version)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read bucket %v", b.name)
+		}
+
+		next, write := f(state, b.now().UnixNano())
+		if !write {
+			return nil
+		}
+
+		var applied bool
+		if found {
+			applied, err = bf.session.ExecCAS(ctx, bf.cfg.WriteConsistency, bf.cfg.SerialConsistency, bf.updateStmt,
+				b.ttlSeconds, next.AccumulatedTokens, next.TokensNextAvailableNanos, version+1, b.name, version)
+		} else {
+			applied, err = bf.session.ExecCAS(ctx, bf.cfg.WriteConsistency, bf.cfg.SerialConsistency, bf.insertStmt,
+				b.name, next.AccumulatedTokens, next.TokensNextAvailableNanos, int64(1), b.ttlSeconds)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "failed to update bucket %v", b.name)
+		}
+
+		if applied {
+			return nil
+		}
+	}
+
+	return ErrTooMuchContention
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	var waitNanos int64
+	var success bool
+
+	err := b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		state, waitNanos, success = state.Take(b.cfg, nowNanos, numTokens, maxWaitTime.Nanoseconds(), buckets.MaxDebtNanos(ctx, b.cfg))
+		return state, success
+	})
+
+	if err != nil || !success {
+		return 0, false, err
+	}
+
+	return time.Duration(waitNanos), true, nil
+}
+
+func (b *bucket) Charge(ctx context.Context, numTokens int64) error {
+	return b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		return state.Charge(b.cfg, nowNanos, numTokens), true
+	})
+}
+
+// ForgiveDebt implements quotaservice.DebtForgiver.
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	return b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		return state.ForgiveDebt(b.cfg, nowNanos), true
+	})
+}
+
+// Reset implements quotaservice.BucketResetter.
+func (b *bucket) Reset(ctx context.Context) error {
+	return b.update(ctx, func(buckets.TokenState, int64) (buckets.TokenState, bool) {
+		return buckets.NewTokenState(b.cfg), true
+	})
+}
+
+func (b *bucket) Config() *pbconfig.BucketConfig {
+	return b.cfg
+}
+
+func (b *bucket) Dynamic() bool {
+	return b.dynamic
+}
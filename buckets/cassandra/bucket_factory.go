@@ -0,0 +1,137 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package cassandra implements token buckets stored in Cassandra or Scylla, using lightweight
+// transactions to update bucket state. The package doesn't depend on a Cassandra driver; instead,
+// callers adapt their driver's session to the Session interface. See the README for an adapter for
+// gocql.
+package cassandra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// Consistency is a Cassandra consistency level.
+type Consistency string
+
+// Consistency levels, named as they are in CQL.
+const (
+	One         Consistency = "ONE"
+	LocalOne    Consistency = "LOCAL_ONE"
+	Quorum      Consistency = "QUORUM"
+	LocalQuorum Consistency = "LOCAL_QUORUM"
+	EachQuorum  Consistency = "EACH_QUORUM"
+	All         Consistency = "ALL"
+	Serial      Consistency = "SERIAL"
+	LocalSerial Consistency = "LOCAL_SERIAL"
+)
+
+// Session is the subset of a Cassandra driver's session used by the bucket factory.
+type Session interface {
+	// Scan runs a query returning at most one row, scanning its columns into dest. Returns false if
+	// there is no row.
+	Scan(ctx context.Context, consistency Consistency, stmt string, values []interface{}, dest ...interface{}) (bool, error)
+	// ExecCAS runs a lightweight transaction, i.e. a statement with an IF clause, returning whether
+	// it was applied.
+	ExecCAS(ctx context.Context, consistency, serialConsistency Consistency, stmt string, values ...interface{}) (bool, error)
+}
+
+// Config configures a Cassandra bucket factory.
+type Config struct {
+	// Keyspace and Table that bucket state is stored in. The table is created with the statement
+	// returned by Schema.
+	Keyspace string
+	Table    string
+	// ReadConsistency is used to read bucket state. Reads at a serial consistency level see the
+	// results of in-progress lightweight transactions, reducing contention.
+	ReadConsistency Consistency
+	// WriteConsistency is used for the commit phase of lightweight transactions.
+	WriteConsistency Consistency
+	// SerialConsistency is used for the Paxos phase of lightweight transactions; either Serial or
+	// LocalSerial.
+	SerialConsistency Consistency
+	// MaxCASAttempts is how many times an update is attempted, if it conflicts with concurrent
+	// updates to the same bucket, before giving up.
+	MaxCASAttempts int
+	// KeyMaxIdleTime is the TTL of bucket state, unless overridden by a bucket's MaxIdleMillis. Expired
+	// buckets start full.
+	KeyMaxIdleTime time.Duration
+}
+
+// NewDefaultConfig returns a config with quorum reads and writes, within a single data center.
+func NewDefaultConfig() Config {
+	return Config{
+		Keyspace:          "quotaservice",
+		Table:             "buckets",
+		ReadConsistency:   LocalSerial,
+		WriteConsistency:  LocalQuorum,
+		SerialConsistency: LocalSerial,
+		MaxCASAttempts:    5,
+		KeyMaxIdleTime:    24 * time.Hour}
+}
+
+// Schema returns the CQL statement creating the table that bucket state is stored in.
+func Schema(cfg Config) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+	name text PRIMARY KEY,
+	accumulated_tokens bigint,
+	tokens_next_available bigint,
+	version bigint
+)`, cfg.Keyspace, cfg.Table)
+}
+
+type bucketFactory struct {
+	session Session
+	cfg     Config
+
+	selectStmt, insertStmt, updateStmt string
+}
+
+// NewBucketFactory creates a bucket factory storing bucket state in Cassandra.
+func NewBucketFactory(session Session, cfg Config) quotaservice.BucketFactory {
+	if cfg.MaxCASAttempts < 1 {
+		cfg.MaxCASAttempts = 1
+	}
+
+	if cfg.KeyMaxIdleTime <= 0 {
+		cfg.KeyMaxIdleTime = 24 * time.Hour
+	}
+
+	table := cfg.Keyspace + "." + cfg.Table
+	return &bucketFactory{
+		session: session,
+		cfg:     cfg,
+		selectStmt: fmt.Sprintf(
+			"SELECT accumulated_tokens, tokens_next_available, version FROM %s WHERE name = ?", table),
+		insertStmt: fmt.Sprintf(
+			"INSERT INTO %s (name, accumulated_tokens, tokens_next_available, version) VALUES (?, ?, ?, ?) IF NOT EXISTS USING TTL ?", table),
+		updateStmt: fmt.Sprintf(
+			"UPDATE %s USING TTL ? SET accumulated_tokens = ?, tokens_next_available = ?, version = ? WHERE name = ? IF version = ?", table)}
+}
+
+func (bf *bucketFactory) Init(_ *pbconfig.ServiceConfig) {}
+
+func (bf *bucketFactory) Client() interface{} {
+	return bf.session
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	ttl := bf.cfg.KeyMaxIdleTime
+	if cfg.GetMaxIdleMillis() > 0 {
+		ttl = time.Duration(cfg.GetMaxIdleMillis()) * time.Millisecond
+	}
+
+	return &bucket{
+		factory:    bf,
+		name:       config.FullyQualifiedName(namespace, bucketName),
+		cfg:        cfg,
+		dynamic:    dyn,
+		ttlSeconds: int64((ttl + time.Second - 1) / time.Second),
+		now:        time.Now}
+}
@@ -0,0 +1,134 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package cassandra
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/buckets"
+	"github.com/square/quotaservice/config"
+)
+
+type row struct {
+	accumulatedTokens, tokensNextAvailable, version, ttl int64
+}
+
+// fakeSession stores rows in memory, understanding only the statements used by the bucket factory.
+type fakeSession struct {
+	rows map[string]*row
+	// conflicts is the number of lightweight transactions to fail, simulating concurrent updates.
+	conflicts   int
+	consistency Consistency
+	sync.Mutex
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{rows: make(map[string]*row)}
+}
+
+func (s *fakeSession) Scan(_ context.Context, consistency Consistency, stmt string, values []interface{}, dest ...interface{}) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.consistency = consistency
+	r, ok := s.rows[values[0].(string)]
+	if !ok {
+		return false, nil
+	}
+
+	*dest[0].(*int64), *dest[1].(*int64), *dest[2].(*int64) = r.accumulatedTokens, r.tokensNextAvailable, r.version
+	return true, nil
+}
+
+func (s *fakeSession) ExecCAS(_ context.Context, _, _ Consistency, stmt string, values ...interface{}) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conflicts > 0 {
+		s.conflicts--
+		return false, nil
+	}
+
+	if strings.HasPrefix(stmt, "INSERT") {
+		name := values[0].(string)
+		if _, exists := s.rows[name]; exists {
+			return false, nil
+		}
+
+		s.rows[name] = &row{values[1].(int64), values[2].(int64), values[3].(int64), values[4].(int64)}
+		return true, nil
+	}
+
+	name := values[4].(string)
+	if r := s.rows[name]; r == nil || r.version != values[5].(int64) {
+		return false, nil
+	}
+
+	s.rows[name] = &row{values[1].(int64), values[2].(int64), values[3].(int64), values[0].(int64)}
+	return true, nil
+}
+
+func TestTokenAcquisition(t *testing.T) {
+	bf := NewBucketFactory(newFakeSession(), NewDefaultConfig())
+	buckets.TestTokenAcquisition(t, bf.NewBucket("cassandra", "cassandra", config.NewDefaultBucketConfig(""), false))
+}
+
+func TestCharge(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	bf := NewBucketFactory(newFakeSession(), NewDefaultConfig())
+	buckets.TestCharge(t, bf.NewBucket("cassandra", "charge", cfg, false))
+}
+
+func TestContention(t *testing.T) {
+	session := newFakeSession()
+	cfg := NewDefaultConfig()
+	cfg.MaxCASAttempts = 3
+	b := NewBucketFactory(session, cfg).NewBucket("cassandra", "contended", config.NewDefaultBucketConfig(""), false)
+
+	session.conflicts = 2
+	if _, ok, err := b.Take(context.Background(), 1, 0); err != nil || !ok {
+		t.Fatalf("Expected update to succeed after retrying, got %v, %v", ok, err)
+	}
+
+	session.conflicts = 3
+	if _, _, err := b.Take(context.Background(), 1, 0); err != ErrTooMuchContention {
+		t.Fatalf("Expected ErrTooMuchContention, got %v", err)
+	}
+
+	if session.consistency != LocalSerial {
+		t.Fatalf("Expected reads at the configured consistency, got %v", session.consistency)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	session := newFakeSession()
+	bf := NewBucketFactory(session, NewDefaultConfig())
+
+	bCfg := config.NewDefaultBucketConfig("")
+	bCfg.MaxIdleMillis = proto.Int64(1500)
+	_, _, err := bf.NewBucket("cassandra", "dyn", bCfg, true).Take(context.Background(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = bf.NewBucket("cassandra", "static", config.NewDefaultBucketConfig(""), false).Take(context.Background(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := session.rows["cassandra:dyn"].ttl; ttl != 2 {
+		t.Errorf("Expected TTL rounded up to 2 seconds, got %v", ttl)
+	}
+
+	if ttl := session.rows["cassandra:static"].ttl; ttl != int64(24*time.Hour/time.Second) {
+		t.Errorf("Expected default TTL, got %v", ttl)
+	}
+}
@@ -0,0 +1,221 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package coalescing decorates a BucketFactory to coalesce concurrent calls to Take on the same
+// bucket. Calls arriving within a short window are combined into a single call to the underlying
+// bucket for the sum of their tokens, and its result is distributed to all of them, reducing
+// round trips to a backend such as Redis under bursty load.
+package coalescing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// Config configures request coalescing.
+type Config struct {
+	// Window is how long the first call in a batch waits for others to join it. This is added to the
+	// latency of every coalesced call.
+	Window time.Duration
+	// MaxBatchTokens is the most tokens requested by a batch. A batch is sent as soon as it reaches
+	// this size, and calls requesting at least this many tokens aren't coalesced.
+	MaxBatchTokens int64
+}
+
+// NewDefaultConfig creates a Config with sensible defaults.
+func NewDefaultConfig() Config {
+	return Config{
+		Window:         time.Millisecond,
+		MaxBatchTokens: 100}
+}
+
+type bucketFactory struct {
+	delegate quotaservice.BucketFactory
+	cfg      Config
+}
+
+// NewBucketFactory decorates a BucketFactory with request coalescing.
+func NewBucketFactory(delegate quotaservice.BucketFactory, cfg Config) quotaservice.BucketFactory {
+	if cfg.Window <= 0 || cfg.MaxBatchTokens < 2 {
+		panic("Window must be positive, and MaxBatchTokens must be at least 2")
+	}
+
+	return &bucketFactory{delegate: delegate, cfg: cfg}
+}
+
+func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	bf.delegate.Init(cfg)
+}
+
+func (bf *bucketFactory) Client() interface{} {
+	return bf.delegate.Client()
+}
+
+// Close closes the delegate, if it implements quotaservice.BucketFactoryCloser.
+func (bf *bucketFactory) Close() {
+	if closer, ok := bf.delegate.(quotaservice.BucketFactoryCloser); ok {
+		closer.Close()
+	}
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	return &bucket{
+		Bucket:  bf.delegate.NewBucket(namespace, bucketName, cfg, dyn),
+		cfg:     bf.cfg,
+		batches: make(map[time.Duration]*batch)}
+}
+
+type result struct {
+	waitTime time.Duration
+	success  bool
+	err      error
+	// retry indicates that the call should be made on its own.
+	retry bool
+}
+
+type call struct {
+	numTokens int64
+	result    chan result
+}
+
+// batch is a set of calls with the same max wait time, which are coalesced.
+type batch struct {
+	maxWaitTime time.Duration
+	calls       []*call
+	numTokens   int64
+	timer       *time.Timer
+}
+
+type bucket struct {
+	quotaservice.Bucket
+	cfg Config
+	// batches are the open batches, keyed on max wait time, protected by the embedded mutex.
+	batches map[time.Duration]*batch
+	sync.Mutex
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	_, hasDeadline := ctx.Deadline()
+	if numTokens >= b.cfg.MaxBatchTokens || quotaservice.StrictFromContext(ctx) ||
+		quotaservice.RequestIDFromContext(ctx) != "" || hasDeadline {
+		// Strict requests can't share a batch's debt. Batches are taken without any one call's
+		// context, which would lose request IDs making grants idempotent, and deadlines capping
+		// waits.
+		return b.Bucket.Take(ctx, numTokens, maxWaitTime)
+	}
+
+	c := &call{numTokens: numTokens, result: make(chan result, 1)}
+
+	b.Lock()
+	bt := b.batches[maxWaitTime]
+	if bt != nil && bt.numTokens+numTokens > b.cfg.MaxBatchTokens {
+		// Send the open batch now, and start a new one.
+		b.closeLocked(bt)
+		go b.send(bt)
+		bt = nil
+	}
+
+	if bt == nil {
+		bt = &batch{maxWaitTime: maxWaitTime}
+		bt.timer = time.AfterFunc(b.cfg.Window, func() { b.flush(bt) })
+		b.batches[maxWaitTime] = bt
+	}
+
+	bt.calls = append(bt.calls, c)
+	bt.numTokens += numTokens
+	full := bt.numTokens == b.cfg.MaxBatchTokens
+	if full {
+		b.closeLocked(bt)
+	}
+	b.Unlock()
+
+	if full {
+		b.send(bt)
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, false, ctx.Err()
+	case r := <-c.result:
+		if r.retry {
+			return b.Bucket.Take(ctx, numTokens, maxWaitTime)
+		}
+
+		return r.waitTime, r.success, r.err
+	}
+}
+
+// closeLocked stops a batch from accepting more calls. Callers must hold the lock.
+func (b *bucket) closeLocked(bt *batch) {
+	bt.timer.Stop()
+	delete(b.batches, bt.maxWaitTime)
+}
+
+// flush sends a batch once its window elapses, unless it has already been sent.
+func (b *bucket) flush(bt *batch) {
+	b.Lock()
+	open := b.batches[bt.maxWaitTime] == bt
+	if open {
+		b.closeLocked(bt)
+	}
+	b.Unlock()
+
+	if open {
+		b.send(bt)
+	}
+}
+
+// send takes the tokens for a batch, distributing the result to its calls. If the batch can't be
+// satisfied as a whole, some of its calls might still be, so each call is retried on its own.
+func (b *bucket) send(bt *batch) {
+	if len(bt.calls) == 1 {
+		bt.calls[0].result <- result{retry: true}
+		return
+	}
+
+	// Not bound to any one call's context, since the batch is shared.
+	waitTime, success, err := b.Bucket.Take(context.Background(), bt.numTokens, bt.maxWaitTime)
+	r := result{waitTime: waitTime, success: success, err: err, retry: err == nil && !success}
+	for _, c := range bt.calls {
+		c.result <- r
+	}
+}
+
+// Tokens, Warm, ForgiveDebt and Reset are forwarded to the underlying bucket, failing with
+// quotaservice.ErrNotSupported if it doesn't implement them.
+func (b *bucket) Tokens(ctx context.Context) (int64, error) {
+	if inspector, ok := b.Bucket.(quotaservice.TokenInspector); ok {
+		return inspector.Tokens(ctx)
+	}
+
+	return 0, quotaservice.ErrNotSupported
+}
+
+func (b *bucket) Warm(ctx context.Context) error {
+	if warmer, ok := b.Bucket.(quotaservice.BucketWarmer); ok {
+		return warmer.Warm(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
+
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	if forgiver, ok := b.Bucket.(quotaservice.DebtForgiver); ok {
+		return forgiver.ForgiveDebt(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
+
+func (b *bucket) Reset(ctx context.Context) error {
+	if resetter, ok := b.Bucket.(quotaservice.BucketResetter); ok {
+		return resetter.Reset(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
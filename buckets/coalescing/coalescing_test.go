@@ -0,0 +1,177 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package coalescing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// countingBucket records the tokens requested by each call to Take, granting up to available
+// tokens in total.
+type countingBucket struct {
+	quotaservice.DefaultBucket
+	requested []int64
+	available int64
+	sync.Mutex
+}
+
+func (b *countingBucket) Take(_ context.Context, numTokens int64, _ time.Duration) (time.Duration, bool, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.requested = append(b.requested, numTokens)
+	if numTokens > b.available {
+		return 0, false, nil
+	}
+
+	b.available -= numTokens
+	return 0, true, nil
+}
+
+func (b *countingBucket) Config() *pbconfig.BucketConfig { return nil }
+func (b *countingBucket) Dynamic() bool                  { return false }
+
+type countingBucketFactory struct {
+	bucket *countingBucket
+}
+
+func (bf *countingBucketFactory) Init(_ *pbconfig.ServiceConfig) {}
+func (bf *countingBucketFactory) Client() interface{}            { return nil }
+func (bf *countingBucketFactory) NewBucket(_, _ string, _ *pbconfig.BucketConfig, _ bool) quotaservice.Bucket {
+	return bf.bucket
+}
+
+// takeConcurrently makes n concurrent calls to Take for 1 token with ctx, returning how many
+// succeeded.
+func takeConcurrently(ctx context.Context, t *testing.T, b quotaservice.Bucket, n int) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := b.Take(ctx, 1, 0)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if ok {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return granted
+}
+
+func newTestBucket(available int64) (quotaservice.Bucket, *countingBucket) {
+	delegate := &countingBucket{available: available}
+	cfg := NewDefaultConfig()
+	cfg.Window = 50 * time.Millisecond
+	cfg.MaxBatchTokens = 10
+	bf := NewBucketFactory(&countingBucketFactory{delegate}, cfg)
+	return bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false), delegate
+}
+
+func TestCoalescesConcurrentTakes(t *testing.T) {
+	b, delegate := newTestBucket(100)
+
+	if granted := takeConcurrently(context.Background(), t, b, 20); granted != 20 {
+		t.Fatalf("Expected all calls to be granted, got %v", granted)
+	}
+
+	if len(delegate.requested) != 2 || delegate.requested[0] != 10 || delegate.requested[1] != 10 {
+		t.Fatalf("Expected 2 calls for 10 tokens each, got %v", delegate.requested)
+	}
+}
+
+func TestRetriesFailedBatchesIndividually(t *testing.T) {
+	b, delegate := newTestBucket(3)
+
+	if granted := takeConcurrently(context.Background(), t, b, 10); granted != 3 {
+		t.Fatalf("Expected remaining tokens to be granted, got %v", granted)
+	}
+
+	if len(delegate.requested) != 11 || delegate.requested[0] != 10 {
+		t.Fatalf("Expected a failed batch followed by individual calls, got %v", delegate.requested)
+	}
+}
+
+func TestLoneCallsAreNotCoalesced(t *testing.T) {
+	b, delegate := newTestBucket(100)
+
+	if _, ok, err := b.Take(context.Background(), 1, 0); !ok || err != nil {
+		t.Fatalf("Expected call to be granted, got %v, %v", ok, err)
+	}
+
+	if _, ok, err := b.Take(context.Background(), 10, 0); !ok || err != nil {
+		t.Fatalf("Expected call to be granted, got %v, %v", ok, err)
+	}
+
+	if len(delegate.requested) != 2 || delegate.requested[0] != 1 || delegate.requested[1] != 10 {
+		t.Fatalf("Expected calls to be made on their own, got %v", delegate.requested)
+	}
+}
+
+func TestRequestsBoundToTheirContextAreNotCoalesced(t *testing.T) {
+	withDeadline, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for name, ctx := range map[string]context.Context{
+		"strict":     quotaservice.WithStrict(context.Background()),
+		"request ID": quotaservice.WithRequestID(context.Background(), "id"),
+		"deadline":   withDeadline,
+	} {
+		b, delegate := newTestBucket(100)
+		if granted := takeConcurrently(ctx, t, b, 20); granted != 20 {
+			t.Fatalf("Expected all %v calls to be granted, got %v", name, granted)
+		}
+
+		if len(delegate.requested) != 20 {
+			t.Fatalf("Expected %v calls to be made on their own, got %v", name, delegate.requested)
+		}
+	}
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	delegate := &qstesting.MockBucketFactory{}
+	b := NewBucketFactory(delegate, NewDefaultConfig()).NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	helpers.CheckError(t, b.(quotaservice.BucketWarmer).Warm(ctx))
+	if warmed := delegate.Warmed("ns", "b"); warmed != 1 {
+		t.Fatalf("Expected the underlying bucket to be warmed, got %v", warmed)
+	}
+
+	helpers.CheckError(t, delegate.Bucket("ns", "b").Charge(ctx, 150))
+	helpers.CheckError(t, b.(quotaservice.DebtForgiver).ForgiveDebt(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 0 {
+		t.Fatalf("Expected the debt to be forgiven, got %v, %v", tokens, err)
+	}
+
+	helpers.CheckError(t, b.(quotaservice.BucketResetter).Reset(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 100 {
+		t.Fatalf("Expected the bucket to be reset, got %v, %v", tokens, err)
+	}
+
+	unsupported, _ := newTestBucket(100)
+	if _, err := unsupported.(quotaservice.TokenInspector).Tokens(ctx); err != quotaservice.ErrNotSupported {
+		t.Fatalf("Expected reporting tokens to be unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// ErrTooMuchContention is returned when a bucket can't be updated within Config.MaxCASAttempts
+// attempts, due to concurrent updates.
+var ErrTooMuchContention = errors.New("too much contention updating bucket")
+
+// value is how bucket state is encoded in etcd.
+type value struct {
+	AccumulatedTokens        int64 `json:"accumulatedTokens"`
+	TokensNextAvailableNanos int64 `json:"tokensNextAvailableNanos"`
+}
+
+type bucket struct {
+	factory *bucketFactory
+	key     string
+	cfg     *pbconfig.BucketConfig
+	dynamic bool
+	ttl     time.Duration
+	now     func() time.Time
+	quotaservice.DefaultBucket
+}
+
+// update reads the bucket's state, applies f to it, and writes it back if f returns true, retrying
+// if the bucket is updated concurrently.
+func (b *bucket) update(ctx context.Context, f func(buckets.TokenState, int64) (buckets.TokenState, bool)) error {
+	bf := b.factory
+
+	for attempt := 0; attempt < bf.cfg.MaxCASAttempts; attempt++ {
+		raw, modRevision, err := bf.kv.Get(ctx, b.key)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read bucket %v", b.key)
+		}
+
+		state := buckets.NewTokenState(b.cfg)
+		if modRevision != 0 {
+			var v value
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return errors.Wrapf(err, "failed to decode bucket %v", b.key)
+			}
+
+			state = buckets.TokenState{
+				AccumulatedTokens:        v.AccumulatedTokens,
+				TokensNextAvailableNanos: v.TokensNextAvailableNanos}
+		}
+
+		next, write := f(state, b.now().UnixNano())
+		if !write {
+			return nil
+		}
+
+		raw, err = json.Marshal(value{next.AccumulatedTokens, next.TokensNextAvailableNanos})
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode bucket %v", b.key)
+		}
+
+		applied, err := bf.kv.CompareAndPut(ctx, b.key, raw, modRevision, b.ttl)
+		if err != nil {
+			return errors.Wrapf(err, "failed to update bucket %v", b.key)
+		}
+
+		if applied {
+			return nil
+		}
+	}
+
+	return ErrTooMuchContention
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	var waitNanos int64
+	var success bool
+
+	err := b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		state, waitNanos, success = state.Take(b.cfg, nowNanos, numTokens, maxWaitTime.Nanoseconds(), buckets.MaxDebtNanos(ctx, b.cfg))
+		return state, success
+	})
+
+	if err != nil || !success {
+		return 0, false, err
+	}
+
+	return time.Duration(waitNanos), true, nil
+}
+
+func (b *bucket) Charge(ctx context.Context, numTokens int64) error {
+	return b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		return state.Charge(b.cfg, nowNanos, numTokens), true
+	})
+}
+
+// ForgiveDebt implements quotaservice.DebtForgiver.
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	return b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		return state.ForgiveDebt(b.cfg, nowNanos), true
+	})
+}
+
+// Reset implements quotaservice.BucketResetter.
+func (b *bucket) Reset(ctx context.Context) error {
+	return b.update(ctx, func(buckets.TokenState, int64) (buckets.TokenState, bool) {
+		return buckets.NewTokenState(b.cfg), true
+	})
+}
+
+func (b *bucket) Config() *pbconfig.BucketConfig {
+	return b.cfg
+}
+
+func (b *bucket) Dynamic() bool {
+	return b.dynamic
+}
@@ -0,0 +1,87 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package etcd implements token buckets stored in etcd, for deployments that need linearizable
+// quota decisions and already operate etcd. Bucket state is updated with transactions that compare
+// the key's mod revision. The package doesn't depend on an etcd client; instead, callers adapt
+// their client to the KV interface. See the README for an adapter for clientv3.
+package etcd
+
+import (
+	"context"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// KV is the subset of an etcd client used by the bucket factory.
+type KV interface {
+	// Get returns a key's value and mod revision, or a mod revision of 0 if the key doesn't exist.
+	// Reads must be linearizable.
+	Get(ctx context.Context, key string) (value []byte, modRevision int64, err error)
+	// CompareAndPut puts a value, attached to a lease expiring after ttl, in a transaction that only
+	// succeeds if the key's mod revision is still modRevision, returning whether it succeeded. A mod
+	// revision of 0 means the key must not exist.
+	CompareAndPut(ctx context.Context, key string, value []byte, modRevision int64, ttl time.Duration) (bool, error)
+}
+
+// Config configures an etcd bucket factory.
+type Config struct {
+	// Prefix of the keys that bucket state is stored under.
+	Prefix string
+	// MaxCASAttempts is how many times an update is attempted, if it conflicts with concurrent
+	// updates to the same bucket, before giving up.
+	MaxCASAttempts int
+	// KeyMaxIdleTime is the TTL of bucket state, unless overridden by a bucket's MaxIdleMillis. Expired
+	// buckets start full.
+	KeyMaxIdleTime time.Duration
+}
+
+// NewDefaultConfig returns a config storing bucket state under /quotaservice/buckets/.
+func NewDefaultConfig() Config {
+	return Config{
+		Prefix:         "/quotaservice/buckets/",
+		MaxCASAttempts: 5,
+		KeyMaxIdleTime: 24 * time.Hour}
+}
+
+type bucketFactory struct {
+	kv  KV
+	cfg Config
+}
+
+// NewBucketFactory creates a bucket factory storing bucket state in etcd.
+func NewBucketFactory(kv KV, cfg Config) quotaservice.BucketFactory {
+	if cfg.MaxCASAttempts < 1 {
+		cfg.MaxCASAttempts = 1
+	}
+
+	if cfg.KeyMaxIdleTime <= 0 {
+		cfg.KeyMaxIdleTime = 24 * time.Hour
+	}
+
+	return &bucketFactory{kv: kv, cfg: cfg}
+}
+
+func (bf *bucketFactory) Init(_ *pbconfig.ServiceConfig) {}
+
+func (bf *bucketFactory) Client() interface{} {
+	return bf.kv
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	ttl := bf.cfg.KeyMaxIdleTime
+	if cfg.GetMaxIdleMillis() > 0 {
+		ttl = time.Duration(cfg.GetMaxIdleMillis()) * time.Millisecond
+	}
+
+	return &bucket{
+		factory: bf,
+		key:     bf.cfg.Prefix + config.FullyQualifiedName(namespace, bucketName),
+		cfg:     cfg,
+		dynamic: dyn,
+		ttl:     ttl,
+		now:     time.Now}
+}
@@ -0,0 +1,150 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package etcd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/buckets"
+	"github.com/square/quotaservice/config"
+)
+
+type kv struct {
+	value       []byte
+	modRevision int64
+	ttl         time.Duration
+}
+
+// fakeKV stores keys in memory, with a single revision counter as etcd does.
+type fakeKV struct {
+	keys     map[string]*kv
+	revision int64
+	// conflicts is the number of transactions to fail, simulating concurrent updates.
+	conflicts int
+	sync.Mutex
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{keys: make(map[string]*kv)}
+}
+
+func (f *fakeKV) Get(_ context.Context, key string) ([]byte, int64, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	k, ok := f.keys[key]
+	if !ok {
+		return nil, 0, nil
+	}
+
+	return k.value, k.modRevision, nil
+}
+
+func (f *fakeKV) CompareAndPut(_ context.Context, key string, value []byte, modRevision int64, ttl time.Duration) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.conflicts > 0 {
+		f.conflicts--
+		return false, nil
+	}
+
+	current := int64(0)
+	if k, ok := f.keys[key]; ok {
+		current = k.modRevision
+	}
+
+	if current != modRevision {
+		return false, nil
+	}
+
+	f.revision++
+	f.keys[key] = &kv{value, f.revision, ttl}
+	return true, nil
+}
+
+func TestTokenAcquisition(t *testing.T) {
+	bf := NewBucketFactory(newFakeKV(), NewDefaultConfig())
+	buckets.TestTokenAcquisition(t, bf.NewBucket("etcd", "etcd", config.NewDefaultBucketConfig(""), false))
+}
+
+func TestCharge(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	bf := NewBucketFactory(newFakeKV(), NewDefaultConfig())
+	buckets.TestCharge(t, bf.NewBucket("etcd", "charge", cfg, false))
+}
+
+func TestContention(t *testing.T) {
+	store := newFakeKV()
+	cfg := NewDefaultConfig()
+	cfg.MaxCASAttempts = 3
+	b := NewBucketFactory(store, cfg).NewBucket("etcd", "contended", config.NewDefaultBucketConfig(""), false)
+
+	store.conflicts = 2
+	if _, ok, err := b.Take(context.Background(), 1, 0); err != nil || !ok {
+		t.Fatalf("Expected update to succeed after retrying, got %v, %v", ok, err)
+	}
+
+	store.conflicts = 3
+	if _, _, err := b.Take(context.Background(), 1, 0); err != ErrTooMuchContention {
+		t.Fatalf("Expected ErrTooMuchContention, got %v", err)
+	}
+}
+
+func TestConcurrentTakes(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.MaxCASAttempts = 1000
+	bCfg := config.NewDefaultBucketConfig("")
+	bCfg.FillRate = proto.Int64(1)
+	bCfg.MaxDebtMillis = proto.Int64(0)
+	b := NewBucketFactory(newFakeKV(), cfg).NewBucket("etcd", "concurrent", bCfg, false)
+
+	results := make(chan bool, 2*bCfg.GetSize())
+	for i := int64(0); i < 2*bCfg.GetSize(); i++ {
+		go func() {
+			_, ok, err := b.Take(context.Background(), 1, 0)
+			results <- ok && err == nil
+		}()
+	}
+
+	taken := int64(0)
+	for i := int64(0); i < 2*bCfg.GetSize(); i++ {
+		if <-results {
+			taken++
+		}
+	}
+
+	if taken != bCfg.GetSize() {
+		t.Fatalf("Expected %v tokens to be taken, got %v", bCfg.GetSize(), taken)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	store := newFakeKV()
+	bf := NewBucketFactory(store, NewDefaultConfig())
+
+	bCfg := config.NewDefaultBucketConfig("")
+	bCfg.MaxIdleMillis = proto.Int64(1500)
+	if _, _, err := bf.NewBucket("etcd", "dyn", bCfg, true).Take(context.Background(), 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := bf.NewBucket("etcd", "static", config.NewDefaultBucketConfig(""), false).Take(context.Background(), 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := store.keys["/quotaservice/buckets/etcd:dyn"].ttl; ttl != 1500*time.Millisecond {
+		t.Errorf("Expected bucket's max idle time as TTL, got %v", ttl)
+	}
+
+	if ttl := store.keys["/quotaservice/buckets/etcd:static"].ttl; ttl != 24*time.Hour {
+		t.Errorf("Expected default TTL, got %v", ttl)
+	}
+}
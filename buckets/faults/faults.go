@@ -0,0 +1,279 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package faults decorates a BucketFactory with fault injection, for soak and chaos testing in
+// tests and staging. Calls to Take and Charge on the underlying buckets are randomly delayed or
+// failed, and, if the underlying factory is backed by Redis, its connection is dropped or its
+// scripts evicted, so that circuit breakers, retries, reconnection and fallbacks can be exercised
+// without breaking the backend itself. Faults are drawn from a seeded source, so a run with the
+// same seed and the same sequence of calls injects the same faults.
+package faults
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/logging"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// ErrInjected is returned by calls failed by an injected error.
+var ErrInjected = errors.New("injected fault")
+
+// ErrConnectionDropped is returned by calls whose connection was dropped, if the underlying factory
+// has no Redis connection to drop.
+var ErrConnectionDropped = errors.New("injected fault: connection dropped")
+
+// Config configures the faults injected. Rates are the probability, between 0 and 1, that each call
+// suffers a fault.
+type Config struct {
+	// LatencyRate is the rate of calls delayed, by up to MaxLatency.
+	LatencyRate float64
+	MaxLatency  time.Duration
+	// ErrorRate is the rate of calls failed with ErrInjected, without reaching the backend.
+	ErrorRate float64
+	// DropRate is the rate of calls whose Redis connection is closed before they are made, as if it
+	// had been dropped. Other backends' calls fail with ErrConnectionDropped instead.
+	DropRate float64
+	// EvictionRate is the rate of calls preceded by flushing Redis's script cache, as if the scripts
+	// had been evicted, e.g. by a failover or restart. Has no effect on other backends.
+	EvictionRate float64
+	// Seed seeds the source faults are drawn from.
+	Seed int64
+}
+
+// NewDefaultConfig creates a Config injecting no faults.
+func NewDefaultConfig() Config {
+	return Config{MaxLatency: 100 * time.Millisecond, Seed: 1}
+}
+
+// Status reports the faults injected.
+type Status struct {
+	// Calls is the number of calls to Take and Charge.
+	Calls int64
+	// Delayed, Errors, Drops and Evictions are the number of calls that suffered each fault.
+	Delayed   int64
+	Errors    int64
+	Drops     int64
+	Evictions int64
+}
+
+type bucketFactory struct {
+	// Counters for Status, accessed atomically. These come first for 64-bit alignment.
+	calls     int64
+	delayed   int64
+	errors    int64
+	drops     int64
+	evictions int64
+	delegate  quotaservice.BucketFactory
+	cfg       Config
+	random    *rand.Rand
+	sync.Mutex
+}
+
+// NewBucketFactory decorates a BucketFactory with fault injection.
+func NewBucketFactory(delegate quotaservice.BucketFactory, cfg Config) quotaservice.BucketFactory {
+	validate(cfg)
+	return &bucketFactory{delegate: delegate, cfg: cfg, random: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+func validate(cfg Config) {
+	for _, rate := range []float64{cfg.LatencyRate, cfg.ErrorRate, cfg.DropRate, cfg.EvictionRate} {
+		if rate < 0 || rate > 1 {
+			panic("Fault rates must be between 0 and 1")
+		}
+	}
+
+	if cfg.MaxLatency < 0 {
+		panic("MaxLatency must not be negative")
+	}
+}
+
+// SetConfig changes the faults injected by a factory created by NewBucketFactory, e.g. to start or
+// stop injecting them during a soak test, and reseeds the source they are drawn from. Returns false
+// if bf wasn't created by NewBucketFactory.
+func SetConfig(bf quotaservice.BucketFactory, cfg Config) bool {
+	f, ok := bf.(*bucketFactory)
+	if !ok {
+		return false
+	}
+
+	validate(cfg)
+	f.Lock()
+	f.cfg = cfg
+	f.random = rand.New(rand.NewSource(cfg.Seed))
+	f.Unlock()
+
+	return true
+}
+
+// Stats returns the faults injected, and false if bf wasn't created by NewBucketFactory.
+func Stats(bf quotaservice.BucketFactory) (Status, bool) {
+	f, ok := bf.(*bucketFactory)
+	if !ok {
+		return Status{}, false
+	}
+
+	return Status{
+		Calls:     atomic.LoadInt64(&f.calls),
+		Delayed:   atomic.LoadInt64(&f.delayed),
+		Errors:    atomic.LoadInt64(&f.errors),
+		Drops:     atomic.LoadInt64(&f.drops),
+		Evictions: atomic.LoadInt64(&f.evictions)}, true
+}
+
+func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	bf.delegate.Init(cfg)
+}
+
+func (bf *bucketFactory) Client() interface{} {
+	return bf.delegate.Client()
+}
+
+// Close closes the delegate, if it implements quotaservice.BucketFactoryCloser.
+func (bf *bucketFactory) Close() {
+	if closer, ok := bf.delegate.(quotaservice.BucketFactoryCloser); ok {
+		closer.Close()
+	}
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	return &bucket{
+		Bucket:  bf.delegate.NewBucket(namespace, bucketName, cfg, dyn),
+		factory: bf}
+}
+
+// faults are the faults drawn for a call.
+type faults struct {
+	latency           time.Duration
+	fail, drop, evict bool
+}
+
+// draw draws the faults a call suffers. Every fault is drawn on every call, so that changing one
+// rate doesn't change which calls suffer the others.
+func (bf *bucketFactory) draw() faults {
+	bf.Lock()
+	defer bf.Unlock()
+
+	var f faults
+	delay := bf.random.Float64() < bf.cfg.LatencyRate
+	if bf.cfg.MaxLatency > 0 {
+		if latency := time.Duration(bf.random.Int63n(int64(bf.cfg.MaxLatency))); delay {
+			f.latency = latency
+		}
+	}
+	f.fail = bf.random.Float64() < bf.cfg.ErrorRate
+	f.drop = bf.random.Float64() < bf.cfg.DropRate
+	f.evict = bf.random.Float64() < bf.cfg.EvictionRate
+
+	return f
+}
+
+// inject injects the faults drawn for a call, returning the error the call should fail with, if
+// any.
+func (bf *bucketFactory) inject(ctx context.Context) error {
+	atomic.AddInt64(&bf.calls, 1)
+	f := bf.draw()
+
+	if f.latency > 0 {
+		atomic.AddInt64(&bf.delayed, 1)
+		t := time.NewTimer(f.latency)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	if f.fail {
+		atomic.AddInt64(&bf.errors, 1)
+		return ErrInjected
+	}
+
+	client, isRedis := bf.delegate.Client().(redis.UniversalClient)
+	if f.drop {
+		atomic.AddInt64(&bf.drops, 1)
+		if !isRedis {
+			return ErrConnectionDropped
+		}
+
+		// The factory finds the client closed when the call is made, and reconnects.
+		if err := client.Close(); err != nil {
+			logging.Printf("Unable to drop connection to Redis: %v", err)
+		}
+	}
+
+	if f.evict && isRedis {
+		atomic.AddInt64(&bf.evictions, 1)
+		if err := client.ScriptFlush(ctx).Err(); err != nil {
+			logging.Printf("Unable to evict scripts from Redis: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// bucket injects faults into calls to Take and Charge.
+type bucket struct {
+	quotaservice.Bucket
+	factory *bucketFactory
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	if err := b.factory.inject(ctx); err != nil {
+		return 0, false, err
+	}
+
+	return b.Bucket.Take(ctx, numTokens, maxWaitTime)
+}
+
+func (b *bucket) Charge(ctx context.Context, numTokens int64) error {
+	if err := b.factory.inject(ctx); err != nil {
+		return err
+	}
+
+	return b.Bucket.Charge(ctx, numTokens)
+}
+
+// Tokens, Warm, ForgiveDebt and Reset are forwarded to the underlying bucket, failing with
+// quotaservice.ErrNotSupported if it doesn't implement them.
+func (b *bucket) Tokens(ctx context.Context) (int64, error) {
+	if inspector, ok := b.Bucket.(quotaservice.TokenInspector); ok {
+		return inspector.Tokens(ctx)
+	}
+
+	return 0, quotaservice.ErrNotSupported
+}
+
+func (b *bucket) Warm(ctx context.Context) error {
+	if warmer, ok := b.Bucket.(quotaservice.BucketWarmer); ok {
+		return warmer.Warm(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
+
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	if forgiver, ok := b.Bucket.(quotaservice.DebtForgiver); ok {
+		return forgiver.ForgiveDebt(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
+
+func (b *bucket) Reset(ctx context.Context) error {
+	if resetter, ok := b.Bucket.(quotaservice.BucketResetter); ok {
+		return resetter.Reset(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
@@ -0,0 +1,173 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package faults
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets/memory"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+)
+
+func newTestBucket(cfg Config) (quotaservice.BucketFactory, quotaservice.Bucket) {
+	bf := NewBucketFactory(&qstesting.MockBucketFactory{}, cfg)
+	bf.Init(config.NewDefaultServiceConfig())
+
+	return bf, bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+}
+
+func TestNoFaults(t *testing.T) {
+	bf, b := newTestBucket(NewDefaultConfig())
+	for i := 0; i < 100; i++ {
+		_, granted, err := b.Take(context.Background(), 1, 0)
+		helpers.CheckError(t, err)
+		if !granted {
+			t.Fatal("Expected tokens to be granted")
+		}
+		helpers.CheckError(t, b.Charge(context.Background(), 1))
+	}
+
+	if status, _ := Stats(bf); status != (Status{Calls: 200}) {
+		t.Fatalf("Expected no faults to be injected, got %+v", status)
+	}
+}
+
+func TestInjectedErrors(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.ErrorRate = 1
+	bf, b := newTestBucket(cfg)
+
+	if _, _, err := b.Take(context.Background(), 1, 0); err != ErrInjected {
+		t.Fatalf("Expected an injected error, got %v", err)
+	}
+
+	if err := b.Charge(context.Background(), 1); err != ErrInjected {
+		t.Fatalf("Expected an injected error, got %v", err)
+	}
+
+	if status, _ := Stats(bf); status != (Status{Calls: 2, Errors: 2}) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+
+	cfg.ErrorRate = 0
+	if !SetConfig(bf, cfg) {
+		t.Fatal("Expected the config to be changed")
+	}
+
+	_, _, err := b.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+}
+
+func TestDroppedConnections(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.DropRate = 1
+	cfg.EvictionRate = 1
+	bf, b := newTestBucket(cfg)
+
+	// Without a Redis connection to drop, calls fail instead, and there are no scripts to evict.
+	if _, _, err := b.Take(context.Background(), 1, 0); err != ErrConnectionDropped {
+		t.Fatalf("Expected a dropped connection, got %v", err)
+	}
+
+	if status, _ := Stats(bf); status != (Status{Calls: 1, Drops: 1}) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
+
+func TestInjectedLatency(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.LatencyRate = 1
+	cfg.MaxLatency = time.Hour
+	bf, b := newTestBucket(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := b.Take(ctx, 1, 0); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the delay to be cut short by the deadline, got %v", err)
+	}
+
+	if status, _ := Stats(bf); status != (Status{Calls: 1, Delayed: 1}) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
+
+func TestDeterministicFaults(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.ErrorRate = 0.5
+	cfg.LatencyRate = 0.5
+	cfg.MaxLatency = time.Microsecond
+
+	failures := func() []bool {
+		_, b := newTestBucket(cfg)
+		failed := make([]bool, 100)
+		for i := range failed {
+			_, _, err := b.Take(context.Background(), 1, 0)
+			failed[i] = err != nil
+		}
+
+		return failed
+	}
+
+	first, second := failures(), failures()
+	errors := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected the same faults with the same seed, call %v differed", i)
+		}
+
+		if first[i] {
+			errors++
+		}
+	}
+
+	if errors < 30 || errors > 70 {
+		t.Fatalf("Expected about half of calls to fail, got %v", errors)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.DropRate = 2
+	helpers.ExpectingPanic(t, func() {
+		NewBucketFactory(&qstesting.MockBucketFactory{}, cfg)
+	})
+
+	if SetConfig(&qstesting.MockBucketFactory{}, NewDefaultConfig()) {
+		t.Fatal("Expected only fault-injecting factories to be configured")
+	}
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	delegate := &qstesting.MockBucketFactory{}
+	b := NewBucketFactory(delegate, NewDefaultConfig()).NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	helpers.CheckError(t, b.(quotaservice.BucketWarmer).Warm(ctx))
+	if warmed := delegate.Warmed("ns", "b"); warmed != 1 {
+		t.Fatalf("Expected the underlying bucket to be warmed, got %v", warmed)
+	}
+
+	helpers.CheckError(t, delegate.Bucket("ns", "b").Charge(ctx, 150))
+	helpers.CheckError(t, b.(quotaservice.DebtForgiver).ForgiveDebt(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 0 {
+		t.Fatalf("Expected the debt to be forgiven, got %v, %v", tokens, err)
+	}
+
+	helpers.CheckError(t, b.(quotaservice.BucketResetter).Reset(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 100 {
+		t.Fatalf("Expected the bucket to be reset, got %v, %v", tokens, err)
+	}
+
+	// Memory buckets can't be warmed.
+	unsupported := NewBucketFactory(memory.NewBucketFactory(), NewDefaultConfig()).NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+	defer unsupported.Destroy()
+	if err := unsupported.(quotaservice.BucketWarmer).Warm(ctx); err != quotaservice.ErrNotSupported {
+		t.Fatalf("Expected warming to be unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package hedged replicates buckets across two independent backends, such as two Redis instances,
+// for deployments that prefer slightly lax enforcement to failed requests. Takes go to a primary
+// backend, and are hedged: if the primary hasn't answered within a delay, or fails, the Take is
+// also sent to a secondary backend, and whichever answers first decides. The other backend is then
+// brought in step with the decision in the background, so that the two only diverge by requests in
+// flight, or while one of them is unavailable.
+package hedged
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/square/quotaservice"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// Config configures a hedged bucket factory.
+type Config struct {
+	// Delay is how long a Take waits for the primary before also sending it to the secondary. The
+	// secondary's latency is added to requests the primary doesn't answer within this delay.
+	Delay time.Duration
+	// Timeout bounds calls to either backend, including those keeping the backends in step after
+	// a request has returned.
+	Timeout time.Duration
+}
+
+// NewDefaultConfig creates a Config hedging after 10 millis, with calls timing out after a second.
+func NewDefaultConfig() Config {
+	return Config{
+		Delay:   10 * time.Millisecond,
+		Timeout: time.Second}
+}
+
+// Status reports how Takes were decided.
+type Status struct {
+	// Takes is the number of Takes decided by either backend.
+	Takes int64
+	// Hedged is the number of Takes also sent to the secondary.
+	Hedged int64
+	// SecondaryDecisions is the number of Takes decided by the secondary.
+	SecondaryDecisions int64
+	// Divergences is the number of hedged Takes granted by one backend and denied by the other.
+	Divergences int64
+	// ReconcileErrors is the number of errors returned by the backend that didn't decide a Take,
+	// or by Charges, while keeping the backends in step. Until the backend recovers, its buckets
+	// diverge from the other's.
+	ReconcileErrors int64
+}
+
+type bucketFactory struct {
+	// Counters for Status, accessed atomically. These come first for 64-bit alignment.
+	takes              int64
+	hedged             int64
+	secondaryDecisions int64
+	divergences        int64
+	reconcileErrors    int64
+	primary, secondary quotaservice.BucketFactory
+	cfg                Config
+}
+
+// NewBucketFactory creates a bucket factory that hedges Takes on primary with secondary.
+func NewBucketFactory(primary, secondary quotaservice.BucketFactory, cfg Config) quotaservice.BucketFactory {
+	if primary == nil || secondary == nil {
+		panic("Both primary and secondary bucket factories are required")
+	}
+
+	if cfg.Delay <= 0 || cfg.Timeout <= 0 {
+		panic("Delay and Timeout must be positive")
+	}
+
+	return &bucketFactory{primary: primary, secondary: secondary, cfg: cfg}
+}
+
+// Stats returns how Takes were decided, and false if bf wasn't created by NewBucketFactory.
+func Stats(bf quotaservice.BucketFactory) (Status, bool) {
+	h, ok := bf.(*bucketFactory)
+	if !ok {
+		return Status{}, false
+	}
+
+	return Status{
+		Takes:              atomic.LoadInt64(&h.takes),
+		Hedged:             atomic.LoadInt64(&h.hedged),
+		SecondaryDecisions: atomic.LoadInt64(&h.secondaryDecisions),
+		Divergences:        atomic.LoadInt64(&h.divergences),
+		ReconcileErrors:    atomic.LoadInt64(&h.reconcileErrors)}, true
+}
+
+func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	bf.primary.Init(cfg)
+	bf.secondary.Init(cfg)
+}
+
+// Client returns the primary factory's client.
+func (bf *bucketFactory) Client() interface{} {
+	return bf.primary.Client()
+}
+
+// Close closes both factories, if they implement quotaservice.BucketFactoryCloser.
+func (bf *bucketFactory) Close() {
+	for _, delegate := range []quotaservice.BucketFactory{bf.primary, bf.secondary} {
+		if closer, ok := delegate.(quotaservice.BucketFactoryCloser); ok {
+			closer.Close()
+		}
+	}
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	return &bucket{
+		primary:   bf.primary.NewBucket(namespace, bucketName, cfg, dyn),
+		secondary: bf.secondary.NewBucket(namespace, bucketName, cfg, dyn),
+		factory:   bf}
+}
+
+type bucket struct {
+	primary, secondary quotaservice.Bucket
+	factory            *bucketFactory
+}
+
+type result struct {
+	waitTime  time.Duration
+	granted   bool
+	err       error
+	secondary bool
+}
+
+// detachedContext carries a request's values, such as whether it is strict, without its deadline
+// or cancellation, so that calls outlive the request that started them.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	callCtx, cancel := context.WithTimeout(detachedContext{ctx}, b.factory.cfg.Timeout)
+	results := make(chan result, 2)
+	take := func(bkt quotaservice.Bucket, secondary bool) {
+		w, granted, err := bkt.Take(callCtx, numTokens, maxWaitTime)
+		results <- result{w, granted, err, secondary}
+	}
+
+	go take(b.primary, false)
+	pending, hedged := 1, false
+	hedge := func() {
+		if !hedged {
+			hedged = true
+			pending++
+			atomic.AddInt64(&b.factory.hedged, 1)
+			go take(b.secondary, true)
+		}
+	}
+
+	timer := time.NewTimer(b.factory.cfg.Delay)
+	defer timer.Stop()
+
+	var err error
+	failed := int64(0)
+	for pending > 0 {
+		select {
+		case <-ctx.Done():
+			go b.reconcile(callCtx, cancel, nil, results, pending, numTokens)
+			return 0, false, ctx.Err()
+		case <-timer.C:
+			hedge()
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				err = r.err
+				failed++
+				hedge()
+				continue
+			}
+
+			// A backend that failed missed the decision.
+			atomic.AddInt64(&b.factory.reconcileErrors, failed)
+			atomic.AddInt64(&b.factory.takes, 1)
+			if r.secondary {
+				atomic.AddInt64(&b.factory.secondaryDecisions, 1)
+			}
+
+			if !hedged && r.granted {
+				// The secondary wasn't asked, so charge it with the tokens granted.
+				go b.charge(callCtx, cancel, b.secondary, numTokens)
+			} else {
+				go b.reconcile(callCtx, cancel, &r, results, pending, numTokens)
+			}
+
+			return r.waitTime, r.granted, nil
+		}
+	}
+
+	cancel()
+	return 0, false, err
+}
+
+// reconcile waits for the pending results of a Take that has been decided, and brings the backends
+// that disagree with the decision in step with it. A Take that wasn't decided is undone.
+func (b *bucket) reconcile(ctx context.Context, cancel context.CancelFunc, decision *result, results chan result, pending int, numTokens int64) {
+	defer cancel()
+
+	for ; pending > 0; pending-- {
+		r := <-results
+		if r.err != nil {
+			atomic.AddInt64(&b.factory.reconcileErrors, 1)
+			continue
+		}
+
+		granted := decision != nil && decision.granted
+		if r.granted == granted {
+			continue
+		}
+
+		if decision != nil {
+			atomic.AddInt64(&b.factory.divergences, 1)
+		}
+
+		bkt := b.primary
+		if r.secondary {
+			bkt = b.secondary
+		}
+
+		delta := numTokens
+		if r.granted {
+			delta = -numTokens
+		}
+
+		if err := bkt.Charge(ctx, delta); err != nil {
+			atomic.AddInt64(&b.factory.reconcileErrors, 1)
+		}
+	}
+}
+
+func (b *bucket) charge(ctx context.Context, cancel context.CancelFunc, bkt quotaservice.Bucket, numTokens int64) {
+	defer cancel()
+
+	if err := bkt.Charge(ctx, numTokens); err != nil {
+		atomic.AddInt64(&b.factory.reconcileErrors, 1)
+	}
+}
+
+// Charge charges both backends, succeeding if either does.
+func (b *bucket) Charge(ctx context.Context, numTokens int64) error {
+	return b.both(ctx,
+		func(ctx context.Context) error { return b.primary.Charge(ctx, numTokens) },
+		func(ctx context.Context) error { return b.secondary.Charge(ctx, numTokens) })
+}
+
+// Tokens returns the tokens of the primary bucket, or of the secondary if the primary fails.
+func (b *bucket) Tokens(ctx context.Context) (int64, error) {
+	primary, ok := b.primary.(quotaservice.TokenInspector)
+	secondary, secondaryOk := b.secondary.(quotaservice.TokenInspector)
+	if !ok || !secondaryOk {
+		return 0, quotaservice.ErrNotSupported
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.factory.cfg.Timeout)
+	defer cancel()
+
+	tokens, err := primary.Tokens(ctx)
+	if err != nil {
+		return secondary.Tokens(ctx)
+	}
+
+	return tokens, nil
+}
+
+// Warm warms both buckets, succeeding if either does.
+func (b *bucket) Warm(ctx context.Context) error {
+	primary, ok := b.primary.(quotaservice.BucketWarmer)
+	secondary, secondaryOk := b.secondary.(quotaservice.BucketWarmer)
+	if !ok || !secondaryOk {
+		return quotaservice.ErrNotSupported
+	}
+
+	return b.both(ctx, primary.Warm, secondary.Warm)
+}
+
+// ForgiveDebt forgives the debt of both buckets, succeeding if either does.
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	primary, ok := b.primary.(quotaservice.DebtForgiver)
+	secondary, secondaryOk := b.secondary.(quotaservice.DebtForgiver)
+	if !ok || !secondaryOk {
+		return quotaservice.ErrNotSupported
+	}
+
+	return b.both(ctx, primary.ForgiveDebt, secondary.ForgiveDebt)
+}
+
+// Reset resets both buckets, succeeding if either does.
+func (b *bucket) Reset(ctx context.Context) error {
+	primary, ok := b.primary.(quotaservice.BucketResetter)
+	secondary, secondaryOk := b.secondary.(quotaservice.BucketResetter)
+	if !ok || !secondaryOk {
+		return quotaservice.ErrNotSupported
+	}
+
+	return b.both(ctx, primary.Reset, secondary.Reset)
+}
+
+// both calls primary and secondary concurrently, succeeding if either does. A call only one
+// backend succeeded at is counted as a reconcile error.
+func (b *bucket) both(ctx context.Context, primary, secondary func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, b.factory.cfg.Timeout)
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- secondary(ctx)
+	}()
+
+	primaryErr := primary(ctx)
+	secondaryErr := <-errs
+	if primaryErr != nil && secondaryErr != nil {
+		return primaryErr
+	}
+
+	if primaryErr != nil || secondaryErr != nil {
+		atomic.AddInt64(&b.factory.reconcileErrors, 1)
+	}
+
+	return nil
+}
+
+func (b *bucket) Config() *pbconfig.BucketConfig {
+	return b.primary.Config()
+}
+
+func (b *bucket) Dynamic() bool {
+	return b.primary.Dynamic()
+}
+
+func (b *bucket) Destroy() {
+	b.primary.Destroy()
+	b.secondary.Destroy()
+}
+
+func (b *bucket) ReportActivity() {
+	b.primary.ReportActivity()
+	b.secondary.ReportActivity()
+}
@@ -0,0 +1,185 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package hedged
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// slowBucketFactory creates buckets that take delay to answer Takes.
+type slowBucketFactory struct {
+	qstesting.MockBucketFactory
+	delay time.Duration
+}
+
+func (bf *slowBucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	return &slowBucket{Bucket: bf.MockBucketFactory.NewBucket(namespace, bucketName, cfg, dyn), delay: bf.delay}
+}
+
+type slowBucket struct {
+	quotaservice.Bucket
+	delay time.Duration
+}
+
+func (b *slowBucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	time.Sleep(b.delay)
+	return b.Bucket.Take(ctx, numTokens, maxWaitTime)
+}
+
+func newTestFactory(primary, secondary quotaservice.BucketFactory) (quotaservice.BucketFactory, quotaservice.Bucket) {
+	bf := NewBucketFactory(primary, secondary, Config{Delay: 10 * time.Millisecond, Timeout: time.Second})
+	bf.Init(config.NewDefaultServiceConfig())
+
+	return bf, bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+}
+
+// eventually waits for a condition met by calls made in the background.
+func eventually(t *testing.T, cond func() bool, msg string) {
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+	}
+}
+
+func TestPrimaryDecides(t *testing.T) {
+	primary, secondary := &qstesting.MockBucketFactory{}, &qstesting.MockBucketFactory{}
+	bf, b := newTestFactory(primary, secondary)
+
+	_, granted, err := b.Take(context.Background(), 3, 0)
+	helpers.CheckError(t, err)
+	if !granted {
+		t.Fatal("Expected tokens to be granted")
+	}
+
+	eventually(t, func() bool { return secondary.Charged("ns", "b") == 3 },
+		"Expected the tokens granted to be charged to the secondary")
+
+	// Denials leave the secondary alone.
+	primary.SetWaitTime("ns", "b", time.Hour)
+	_, granted, err = b.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+	if granted {
+		t.Fatal("Expected the primary to decide")
+	}
+
+	if status, ok := Stats(bf); !ok || status != (Status{Takes: 2}) || secondary.Charged("ns", "b") != 3 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
+
+func TestSlowPrimary(t *testing.T) {
+	primary := &slowBucketFactory{delay: 100 * time.Millisecond}
+	secondary := &qstesting.MockBucketFactory{}
+	bf, b := newTestFactory(primary, secondary)
+	primary.SetWaitTime("ns", "b", time.Hour)
+
+	start := time.Now()
+	_, granted, err := b.Take(context.Background(), 3, 0)
+	helpers.CheckError(t, err)
+	if !granted || time.Since(start) >= 100*time.Millisecond {
+		t.Fatal("Expected the secondary to decide without waiting for the primary")
+	}
+
+	// The primary denied, so it is charged with the tokens the secondary granted.
+	eventually(t, func() bool { return primary.Charged("ns", "b") == 3 },
+		"Expected the primary to be brought in step")
+
+	if status, _ := Stats(bf); status != (Status{Takes: 1, Hedged: 1, SecondaryDecisions: 1, Divergences: 1}) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
+
+func TestFailingPrimary(t *testing.T) {
+	primary := &qstesting.MockBucketFactory{SimulateFailure: true}
+	secondary := &qstesting.MockBucketFactory{}
+	bf, b := newTestFactory(primary, secondary)
+
+	_, granted, err := b.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+	if !granted {
+		t.Fatal("Expected the secondary to decide")
+	}
+
+	if status, _ := Stats(bf); status != (Status{Takes: 1, Hedged: 1, SecondaryDecisions: 1, ReconcileErrors: 1}) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+
+	// Charges succeed if either backend does.
+	helpers.CheckError(t, b.Charge(context.Background(), 2))
+	if charged := secondary.Charged("ns", "b"); charged != 2 {
+		t.Fatalf("Expected the secondary to be charged, got %v", charged)
+	}
+}
+
+func TestBothFailing(t *testing.T) {
+	_, b := newTestFactory(&qstesting.MockBucketFactory{SimulateFailure: true}, &qstesting.MockBucketFactory{SimulateFailure: true})
+
+	if _, _, err := b.Take(context.Background(), 1, 0); err == nil {
+		t.Fatal("Expected an error when both backends fail")
+	}
+
+	if err := b.Charge(context.Background(), 1); err == nil {
+		t.Fatal("Expected an error when both backends fail")
+	}
+}
+
+func TestCancelledTakeIsUndone(t *testing.T) {
+	primary := &slowBucketFactory{delay: 50 * time.Millisecond}
+	secondary := &slowBucketFactory{delay: 50 * time.Millisecond}
+	_, b := newTestFactory(primary, secondary)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := b.Take(ctx, 2, 0); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the request's deadline to be exceeded, got %v", err)
+	}
+
+	eventually(t, func() bool { return primary.Charged("ns", "b") == -2 && secondary.Charged("ns", "b") == -2 },
+		"Expected tokens granted after the request returned to be returned")
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := &qstesting.MockBucketFactory{}, &qstesting.MockBucketFactory{}
+	bf, b := newTestFactory(primary, secondary)
+
+	helpers.CheckError(t, b.(quotaservice.BucketWarmer).Warm(ctx))
+	if primary.Warmed("ns", "b") != 1 || secondary.Warmed("ns", "b") != 1 {
+		t.Fatal("Expected both buckets to be warmed")
+	}
+
+	helpers.CheckError(t, b.Charge(ctx, 150))
+	helpers.CheckError(t, b.(quotaservice.DebtForgiver).ForgiveDebt(ctx))
+	if primary.Charged("ns", "b") != 100 || secondary.Charged("ns", "b") != 100 {
+		t.Fatal("Expected the debt of both buckets to be forgiven")
+	}
+
+	// The secondary answers while the primary fails.
+	primary.SetError("ns", "b", errors.New("unavailable"))
+	helpers.CheckError(t, b.(quotaservice.BucketResetter).Reset(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 100 {
+		t.Fatalf("Expected the secondary to be reset, got %v, %v", tokens, err)
+	}
+
+	if status, _ := Stats(bf); status.ReconcileErrors != 1 {
+		t.Fatalf("Expected the failed reset to be counted, got %+v", status)
+	}
+
+	// Slow buckets don't implement any optional interfaces.
+	_, unsupported := newTestFactory(primary, &slowBucketFactory{})
+	if err := unsupported.(quotaservice.BucketResetter).Reset(ctx); err != quotaservice.ErrNotSupported {
+		t.Fatalf("Expected resetting to be unsupported, got %v", err)
+	}
+}
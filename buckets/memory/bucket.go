@@ -10,9 +10,12 @@ package memory
 
 import (
 	"context"
+	"sort"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/logging"
 
@@ -21,6 +24,8 @@ import (
 
 type bucketFactory struct {
 	cfg *pbconfig.ServiceConfig
+	// checkpoints is set if bucket state is checkpointed.
+	checkpoints *checkpointer
 }
 
 func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
@@ -36,12 +41,17 @@ func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.B
 	bucket := &tokenBucket{
 		dynamic:            dyn,
 		cfg:                cfg,
-		nanosBetweenTokens: 1e9 / cfg.FillRate,
-		accumulatedTokens:  cfg.Size, // Start full
+		nanosBetweenTokens: config.NanosBetweenTokens(cfg),
+		accumulatedTokens:  cfg.GetSize(), // Start full
 		fullName:           config.FullyQualifiedName(namespace, bucketName),
 		waitTimer:          make(chan *waitTimeReq),
+		snapshots:          make(chan chan bucketState),
 		closer:             make(chan struct{})}
 
+	if bf.checkpoints != nil {
+		bf.checkpoints.register(bucket)
+	}
+
 	go bucket.waitTimeLoop()
 
 	return bucket
@@ -51,7 +61,76 @@ func NewBucketFactory() quotaservice.BucketFactory {
 	return &bucketFactory{}
 }
 
+// TakeAll implements quotaservice.MultiBucketTaker with a two-phase commit: each bucket in turn,
+// in order of name so that concurrent calls can't deadlock, tentatively takes its tokens and holds
+// off other requests, until all buckets have, at which point they keep the tokens, or one can't,
+// at which point those that took tokens return them.
+func (bf *bucketFactory) TakeAll(ctx context.Context, takes []quotaservice.BucketTake, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	bs := make([]*tokenBucket, len(takes))
+	tokens := make(map[*tokenBucket]int64, len(takes))
+	for i, t := range takes {
+		b, ok := t.Bucket.(*tokenBucket)
+		if !ok {
+			return 0, false, errors.Errorf("not a memory bucket: %T", t.Bucket)
+		}
+
+		if config.Blocked(b.cfg) {
+			return 0, false, nil
+		}
+
+		bs[i] = b
+		tokens[b] += t.Tokens
+	}
+
+	sort.Slice(bs, func(i, j int) bool { return bs[i].fullName < bs[j].fullName })
+
+	var longest time.Duration
+	prepared := make([]chan bool, 0, len(bs))
+	decide := func(commit bool) {
+		for _, decision := range prepared {
+			decision <- commit
+		}
+	}
+
+	for i, b := range bs {
+		if i > 0 && b == bs[i-1] {
+			continue
+		}
+
+		req := &waitTimeReq{
+			requested:        tokens[b],
+			maxWaitTimeNanos: maxWaitTime.Nanoseconds(),
+			maxDebtNanos:     buckets.MaxDebtNanos(ctx, b.cfg),
+			response:         make(chan int64, 1),
+			decision:         make(chan bool, 1)}
+		select {
+		case b.waitTimer <- req:
+		case <-b.closer:
+			decide(false)
+			return 0, false, errors.Errorf("bucket %v has been destroyed", b.fullName)
+		}
+
+		waitTimeNanos := <-req.response
+		if waitTimeNanos < 0 {
+			decide(false)
+			return 0, false, nil
+		}
+
+		prepared = append(prepared, req.decision)
+		if w := time.Duration(waitTimeNanos); w > longest {
+			longest = w
+		}
+	}
+
+	decide(true)
+	return longest, true, nil
+}
+
 var _ quotaservice.Bucket = (*tokenBucket)(nil)
+var _ quotaservice.TokenInspector = (*tokenBucket)(nil)
+var _ quotaservice.DebtForgiver = (*tokenBucket)(nil)
+var _ quotaservice.BucketResetter = (*tokenBucket)(nil)
+var _ quotaservice.MultiBucketTaker = (*bucketFactory)(nil)
 
 // tokenBucket is a single-threaded implementation. A single goroutine updates the values of
 // tokensNextAvailable and accumulatedTokens. When requesting tokens, Take() puts a request on
@@ -66,20 +145,41 @@ type tokenBucket struct {
 	accumulatedTokens          int64
 	fullName                   string
 	waitTimer                  chan *waitTimeReq
+	snapshots                  chan chan bucketState
 	closer                     chan struct{}
-	quotaservice.DefaultBucket // Extension for default methods on interface
+	checkpoints                *checkpointer // Set if bucket state is checkpointed
+	quotaservice.DefaultBucket               // Extension for default methods on interface
 }
 
 // waitTimeReq is a request that you put on the channel for the waitTimer goroutine to pick up and
 // process.
 type waitTimeReq struct {
 	requested, maxWaitTimeNanos int64
-	response                    chan int64
+	// maxDebtNanos is how far into debt taking tokens may put the bucket.
+	maxDebtNanos int64
+	// charge indicates that requested tokens should be charged unconditionally.
+	charge bool
+	// forgive indicates that the bucket's debt should be cleared.
+	forgive bool
+	// reset indicates that the bucket should be restored to full capacity.
+	reset    bool
+	response chan int64
+	// decision is set on requests that prepare to take tokens as part of a TakeAll. If tokens can
+	// be taken, the bucket serves nothing else until told on decision whether to keep them.
+	decision chan bool
 }
 
-func (b *tokenBucket) Take(_ context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+func (b *tokenBucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	if config.Blocked(b.cfg) {
+		return 0, false, nil
+	}
+
 	rsp := make(chan int64, 1)
-	b.waitTimer <- &waitTimeReq{numTokens, maxWaitTime.Nanoseconds(), rsp}
+	b.waitTimer <- &waitTimeReq{
+		requested:        numTokens,
+		maxWaitTimeNanos: maxWaitTime.Nanoseconds(),
+		maxDebtNanos:     buckets.MaxDebtNanos(ctx, b.cfg),
+		response:         rsp}
 	waitTimeNanos := <-rsp
 
 	if waitTimeNanos < 0 {
@@ -90,8 +190,80 @@ func (b *tokenBucket) Take(_ context.Context, numTokens int64, maxWaitTime time.
 	return time.Duration(waitTimeNanos) * time.Nanosecond, true, nil
 }
 
+func (b *tokenBucket) Charge(_ context.Context, numTokens int64) error {
+	rsp := make(chan int64, 1)
+	select {
+	case b.waitTimer <- &waitTimeReq{requested: numTokens, charge: true, response: rsp}:
+	case <-b.closer:
+		return errors.Errorf("bucket %v has been destroyed", b.fullName)
+	}
+	<-rsp
+
+	return nil
+}
+
+// ForgiveDebt implements quotaservice.DebtForgiver.
+func (b *tokenBucket) ForgiveDebt(_ context.Context) error {
+	rsp := make(chan int64, 1)
+	select {
+	case b.waitTimer <- &waitTimeReq{forgive: true, response: rsp}:
+	case <-b.closer:
+		return errors.Errorf("bucket %v has been destroyed", b.fullName)
+	}
+	<-rsp
+
+	return nil
+}
+
+// Reset implements quotaservice.BucketResetter.
+func (b *tokenBucket) Reset(_ context.Context) error {
+	rsp := make(chan int64, 1)
+	select {
+	case b.waitTimer <- &waitTimeReq{reset: true, response: rsp}:
+	case <-b.closer:
+		return errors.Errorf("bucket %v has been destroyed", b.fullName)
+	}
+	<-rsp
+
+	return nil
+}
+
+// charge is designed to run in a single event loop and is not thread-safe.
+func (b *tokenBucket) charge(numTokens int64) {
+	currentTimeNanos := time.Now().UnixNano()
+
+	if currentTimeNanos > b.tokensNextAvailableNanos {
+		freshTokens := (currentTimeNanos - b.tokensNextAvailableNanos) / b.nanosBetweenTokens
+		b.accumulatedTokens = min(b.cfg.GetSize(), b.accumulatedTokens+freshTokens)
+		b.tokensNextAvailableNanos = currentTimeNanos
+	}
+
+	if numTokens >= 0 {
+		// Use accumulated tokens first, then go into debt for the rest.
+		accumulatedTokensUsed := min(b.accumulatedTokens, numTokens)
+		b.accumulatedTokens -= accumulatedTokensUsed
+		b.tokensNextAvailableNanos += (numTokens - accumulatedTokensUsed) * b.nanosBetweenTokens
+	} else {
+		// Pay back any debt first, then accumulate the rest.
+		refund := -numTokens
+		debtRepaidNanos := min(b.tokensNextAvailableNanos-currentTimeNanos, refund*b.nanosBetweenTokens)
+		b.tokensNextAvailableNanos -= debtRepaidNanos
+		tokensRepaid := (debtRepaidNanos + b.nanosBetweenTokens - 1) / b.nanosBetweenTokens
+		b.accumulatedTokens = min(b.cfg.GetSize(), b.accumulatedTokens+refund-tokensRepaid)
+	}
+}
+
+// forgiveDebt is designed to run in a single event loop and is not thread-safe.
+func (b *tokenBucket) forgiveDebt() {
+	// Charging nothing refills the bucket up to now.
+	b.charge(0)
+	if currentTimeNanos := time.Now().UnixNano(); b.tokensNextAvailableNanos > currentTimeNanos {
+		b.tokensNextAvailableNanos = currentTimeNanos
+	}
+}
+
 // calcWaitTime is designed to run in a single event loop and is not thread-safe.
-func (b *tokenBucket) calcWaitTime(requested, maxWaitTimeNanos int64) (waitTimeNanos int64) {
+func (b *tokenBucket) calcWaitTime(requested, maxWaitTimeNanos, maxDebtNanos int64) (waitTimeNanos int64) {
 	currentTimeNanos := time.Now().UnixNano()
 	tna := b.tokensNextAvailableNanos
 	ac := b.accumulatedTokens
@@ -100,7 +272,7 @@ func (b *tokenBucket) calcWaitTime(requested, maxWaitTimeNanos int64) (waitTimeN
 
 	if currentTimeNanos > tna {
 		freshTokens = (currentTimeNanos - tna) / b.nanosBetweenTokens
-		ac = min(b.cfg.Size, ac+freshTokens)
+		ac = min(b.cfg.GetSize(), ac+freshTokens)
 		tna = currentTimeNanos
 	}
 
@@ -112,7 +284,7 @@ func (b *tokenBucket) calcWaitTime(requested, maxWaitTimeNanos int64) (waitTimeN
 	tna += futureWaitNanos
 	ac -= accumulatedTokensUsed
 
-	if (tna-currentTimeNanos > b.cfg.MaxDebtMillis*1e6) || (waitTimeNanos > 0 && waitTimeNanos > maxWaitTimeNanos) {
+	if (tna-currentTimeNanos > maxDebtNanos) || (waitTimeNanos > 0 && waitTimeNanos > maxWaitTimeNanos) {
 		waitTimeNanos = -1
 	} else {
 		b.tokensNextAvailableNanos = tna
@@ -129,12 +301,55 @@ func min(x, y int64) int64 {
 	return y
 }
 
+// prepare tentatively takes tokens for a TakeAll, and if they can be taken, waits to be told whether
+// to keep them, restoring the bucket's state if not. Returns false if the bucket is destroyed while
+// waiting. It is designed to run in the event loop.
+func (b *tokenBucket) prepare(req *waitTimeReq) bool {
+	tokensNextAvailableNanos, accumulatedTokens := b.tokensNextAvailableNanos, b.accumulatedTokens
+	waitTimeNanos := b.calcWaitTime(req.requested, req.maxWaitTimeNanos, req.maxDebtNanos)
+	req.response <- waitTimeNanos
+	if waitTimeNanos < 0 {
+		// Nothing was taken, so there's nothing to decide.
+		return true
+	}
+
+	select {
+	case commit := <-req.decision:
+		if !commit {
+			b.tokensNextAvailableNanos, b.accumulatedTokens = tokensNextAvailableNanos, accumulatedTokens
+		}
+
+		return true
+	case <-b.closer:
+		logging.Printf("Garbage collecting bucket %v", b.fullName)
+		return false
+	}
+}
+
 // waitTimeLoop is the single event loop that claims tokens on a given bucket.
 func (b *tokenBucket) waitTimeLoop() {
 	for {
 		select {
 		case req := <-b.waitTimer:
-			req.response <- b.calcWaitTime(req.requested, req.maxWaitTimeNanos)
+			if req.charge {
+				b.charge(req.requested)
+				req.response <- 0
+			} else if req.forgive {
+				b.forgiveDebt()
+				req.response <- 0
+			} else if req.reset {
+				b.accumulatedTokens = b.cfg.GetSize()
+				b.tokensNextAvailableNanos = time.Now().UnixNano()
+				req.response <- 0
+			} else if req.decision != nil {
+				if !b.prepare(req) {
+					return
+				}
+			} else {
+				req.response <- b.calcWaitTime(req.requested, req.maxWaitTimeNanos, req.maxDebtNanos)
+			}
+		case rsp := <-b.snapshots:
+			rsp <- bucketState{b.accumulatedTokens, b.tokensNextAvailableNanos}
 		case <-b.closer:
 			logging.Printf("Garbage collecting bucket %v", b.fullName)
 			// TODO(manik) properly notify goroutines who are currently trying to write to waitTimer
@@ -152,6 +367,33 @@ func (b *tokenBucket) Dynamic() bool {
 }
 
 func (b *tokenBucket) Destroy() {
+	if b.checkpoints != nil {
+		b.checkpoints.deregister(b)
+	}
+
 	// Signal the waitTimeLoop to exit
 	close(b.closer)
 }
+
+// Tokens implements quotaservice.TokenInspector.
+func (b *tokenBucket) Tokens(_ context.Context) (int64, error) {
+	s, ok := b.state()
+	if !ok {
+		return 0, errors.Errorf("bucket %v has been destroyed", b.fullName)
+	}
+
+	state := buckets.TokenState{AccumulatedTokens: s.AccumulatedTokens, TokensNextAvailableNanos: s.TokensNextAvailableNanos}
+	return state.Available(b.cfg, time.Now().UnixNano()), nil
+}
+
+// state returns the current state of the bucket, or false if the bucket has been destroyed.
+func (b *tokenBucket) state() (bucketState, bool) {
+	rsp := make(chan bucketState, 1)
+
+	select {
+	case b.snapshots <- rsp:
+		return <-rsp, true
+	case <-b.closer:
+		return bucketState{}, false
+	}
+}
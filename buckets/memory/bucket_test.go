@@ -4,9 +4,12 @@
 package memory
 
 import (
+	"context"
 	"os"
 	"testing"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice"
 	"github.com/square/quotaservice/buckets"
 	"github.com/square/quotaservice/config"
 )
@@ -28,6 +31,80 @@ func TestTokenAcquisition(t *testing.T) {
 	buckets.TestTokenAcquisition(t, bucket)
 }
 
+func TestCharge(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	buckets.TestCharge(t, factory.NewBucket("memory", "charge", cfg, false))
+}
+
+func TestTokens(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	buckets.TestTokens(t, factory.NewBucket("memory", "tokens", cfg, false))
+}
+
 func TestGC(t *testing.T) {
 	buckets.TestGC(t, factory, "memory")
 }
+
+func TestForgiveDebt(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	buckets.TestForgiveDebt(t, factory.NewBucket("memory", "forgive", cfg, false))
+}
+
+func TestReset(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	buckets.TestReset(t, factory.NewBucket("memory", "reset", cfg, false))
+}
+
+func TestStrict(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	cfg.MaxDebtMillis = proto.Int64(10000)
+	buckets.TestStrict(t, factory.NewBucket("memory", "strict", cfg, false))
+}
+
+func TestTakeAll(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	cfg.MaxDebtMillis = proto.Int64(0)
+	buckets.TestTakeAll(t, factory, factory.NewBucket("memory", "takeall_a", cfg, false), factory.NewBucket("memory", "takeall_b", cfg, false))
+}
+
+func TestBlocked(t *testing.T) {
+	blocked := config.NewDefaultBucketConfig("")
+	blocked.FillRate = proto.Int64(0)
+	buckets.TestBlocked(t, factory, factory.NewBucket("memory", "open", config.NewDefaultBucketConfig(""), false), factory.NewBucket("memory", "blocked", blocked, false))
+}
+
+func TestChargeDestroyedBucket(t *testing.T) {
+	b := factory.NewBucket("memory", "destroyed", config.NewDefaultBucketConfig(""), false)
+	b.Destroy()
+	if b.Charge(context.Background(), 1) == nil {
+		t.Fatal("Expected an error charging a destroyed bucket")
+	}
+}
+
+func TestForgiveDebtDestroyedBucket(t *testing.T) {
+	b := factory.NewBucket("memory", "destroyed", config.NewDefaultBucketConfig(""), false)
+	b.Destroy()
+	if b.(quotaservice.DebtForgiver).ForgiveDebt(context.Background()) == nil {
+		t.Fatal("Expected an error forgiving the debt of a destroyed bucket")
+	}
+}
+
+func TestResetDestroyedBucket(t *testing.T) {
+	b := factory.NewBucket("memory", "destroyed", config.NewDefaultBucketConfig(""), false)
+	b.Destroy()
+	if b.(quotaservice.BucketResetter).Reset(context.Background()) == nil {
+		t.Fatal("Expected an error resetting a destroyed bucket")
+	}
+}
@@ -0,0 +1,175 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package memory
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/logging"
+)
+
+// bucketState is the state of a bucket that is checkpointed.
+type bucketState struct {
+	AccumulatedTokens        int64 `json:"accumulatedTokens"`
+	TokensNextAvailableNanos int64 `json:"tokensNextAvailableNanos"`
+}
+
+// checkpointer periodically saves the state of live buckets to a file, keyed on their fully
+// qualified names, and restores buckets from the last checkpoint when they are created.
+type checkpointer struct {
+	path string
+	// buckets are the live buckets, protected by the embedded mutex.
+	buckets map[string]*tokenBucket
+	// restored is the state of buckets in the last checkpoint that haven't yet been recreated,
+	// protected by the embedded mutex.
+	restored map[string]bucketState
+	stop     chan struct{}
+	stopped  sync.Once
+	sync.Mutex
+}
+
+// NewCheckpointingBucketFactory creates a bucket factory that saves the state of its buckets to a
+// file every interval, and when the server stops. Buckets are restored from the file when they are
+// next created, e.g. after a restart, so that quotas aren't reset on every deploy of a single-node
+// deployment. Tokens continue to accumulate, up to each bucket's size, while the server is down.
+func NewCheckpointingBucketFactory(path string, interval time.Duration) (quotaservice.BucketFactory, error) {
+	restored, e := readCheckpoint(path)
+	if e != nil {
+		return nil, e
+	}
+
+	c := &checkpointer{
+		path:     path,
+		buckets:  make(map[string]*tokenBucket),
+		restored: restored,
+		stop:     make(chan struct{})}
+
+	go c.checkpointLoop(interval)
+
+	return &bucketFactory{checkpoints: c}, nil
+}
+
+// Close saves a final checkpoint, implementing quotaservice.BucketFactoryCloser.
+func (bf *bucketFactory) Close() {
+	if bf.checkpoints != nil {
+		bf.checkpoints.close()
+	}
+}
+
+func readCheckpoint(path string) (map[string]bucketState, error) {
+	restored := make(map[string]bucketState)
+
+	b, e := os.ReadFile(path)
+	if os.IsNotExist(e) {
+		return restored, nil
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	if e := json.Unmarshal(b, &restored); e != nil {
+		return nil, e
+	}
+
+	return restored, nil
+}
+
+// register tracks a new bucket, restoring its state from the last checkpoint if there is one.
+// Must be called before the bucket's event loop starts.
+func (c *checkpointer) register(b *tokenBucket) {
+	c.Lock()
+	defer c.Unlock()
+
+	b.checkpoints = c
+	c.buckets[b.fullName] = b
+
+	state, ok := c.restored[b.fullName]
+	if !ok {
+		return
+	}
+
+	// Only restored once; buckets recreated later, e.g. after being garbage-collected, start full.
+	delete(c.restored, b.fullName)
+
+	now := time.Now().UnixNano()
+	maxTokensNextAvailableNanos := int64(math.MaxInt64)
+	if debt := config.MaxDebtNanos(b.cfg); debt < math.MaxInt64-now {
+		maxTokensNextAvailableNanos = now + debt
+	}
+	b.accumulatedTokens = min(b.cfg.GetSize(), state.AccumulatedTokens)
+	b.tokensNextAvailableNanos = min(maxTokensNextAvailableNanos, state.TokensNextAvailableNanos)
+}
+
+func (c *checkpointer) deregister(b *tokenBucket) {
+	c.Lock()
+	defer c.Unlock()
+
+	// The bucket may already have been replaced by a new one with the same name.
+	if c.buckets[b.fullName] == b {
+		delete(c.buckets, b.fullName)
+	}
+}
+
+func (c *checkpointer) checkpointLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if e := c.checkpoint(); e != nil {
+				logging.Printf("Unable to checkpoint buckets to %v: %v", c.path, e)
+			}
+		}
+	}
+}
+
+func (c *checkpointer) close() {
+	c.stopped.Do(func() {
+		close(c.stop)
+
+		if e := c.checkpoint(); e != nil {
+			logging.Printf("Unable to checkpoint buckets to %v: %v", c.path, e)
+		}
+	})
+}
+
+// checkpoint saves the state of all live buckets.
+func (c *checkpointer) checkpoint() error {
+	c.Lock()
+	buckets := make([]*tokenBucket, 0, len(c.buckets))
+	for _, b := range c.buckets {
+		buckets = append(buckets, b)
+	}
+	c.Unlock()
+
+	states := make(map[string]bucketState, len(buckets))
+	for _, b := range buckets {
+		if state, ok := b.state(); ok {
+			states[b.fullName] = state
+		}
+	}
+
+	b, e := json.Marshal(states)
+	if e != nil {
+		return e
+	}
+
+	// Written to a temporary file first, so a crash mid-write doesn't corrupt the last checkpoint.
+	tmp := c.path + ".tmp"
+	if e := os.WriteFile(tmp, b, 0644); e != nil {
+		return e
+	}
+
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,70 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestCheckpointing(t *testing.T) {
+	dir, e := os.MkdirTemp("", "qs_memory_checkpoint")
+	helpers.CheckError(t, e)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "buckets.json")
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+
+	bf, e := NewCheckpointingBucketFactory(path, time.Hour)
+	helpers.CheckError(t, e)
+	bf.Init(config.NewDefaultServiceConfig())
+
+	b := bf.NewBucket("memory", "checkpointed", cfg, false)
+	expectTake(t, b, 8, true)
+	bf.(quotaservice.BucketFactoryCloser).Close()
+
+	bf, e = NewCheckpointingBucketFactory(path, time.Hour)
+	helpers.CheckError(t, e)
+	defer bf.(quotaservice.BucketFactoryCloser).Close()
+	bf.Init(config.NewDefaultServiceConfig())
+
+	// Only 2 tokens remain after the restart.
+	b = bf.NewBucket("memory", "checkpointed", cfg, false)
+	expectAccumulatedTokens(t, b, 2)
+	b.Destroy()
+
+	// Buckets are only restored once.
+	b = bf.NewBucket("memory", "checkpointed", cfg, false)
+	expectAccumulatedTokens(t, b, 10)
+	b.Destroy()
+}
+
+func expectTake(t *testing.T, b quotaservice.Bucket, tokens int64, expected bool) {
+	t.Helper()
+
+	_, success, e := b.Take(context.Background(), tokens, 0)
+	helpers.CheckError(t, e)
+	if success != expected {
+		t.Fatalf("Expected taking %v tokens to succeed=%v", tokens, expected)
+	}
+}
+
+func expectAccumulatedTokens(t *testing.T, b quotaservice.Bucket, expected int64) {
+	t.Helper()
+
+	state, ok := b.(*tokenBucket).state()
+	if !ok || state.AccumulatedTokens != expected {
+		t.Fatalf("Expected %v accumulated tokens, got %+v", expected, state)
+	}
+}
@@ -0,0 +1,257 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package migration moves buckets from one backend to another, such as from Redis to Redis
+// Cluster, or from memory to Redis, without resetting quotas. Takes and Charges are executed
+// against both an old and a new bucket factory. One factory is authoritative, and decides whether
+// tokens are granted; the other is a shadow, which is kept in step with the tokens the
+// authoritative factory grants. Decisions on which the two disagree are counted, so that the new
+// backend can be verified before it is made authoritative with SetNewAuthoritative.
+package migration
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/logging"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// Status reports the progress of a migration.
+type Status struct {
+	// NewAuthoritative is true once the new factory decides whether tokens are granted.
+	NewAuthoritative bool
+	// Takes is the number of Takes executed against both factories.
+	Takes int64
+	// Divergences is the number of Takes granted by one factory and denied by the other.
+	Divergences int64
+	// ShadowErrors is the number of errors returned by the shadow factory's buckets. These don't
+	// fail requests.
+	ShadowErrors int64
+}
+
+type bucketFactory struct {
+	// Counters for Status, accessed atomically. These come first for 64-bit alignment.
+	takes        int64
+	divergences  int64
+	shadowErrors int64
+	// newAuthoritative is 1 if the new factory is authoritative; accessed atomically.
+	newAuthoritative int32
+	old, new         quotaservice.BucketFactory
+}
+
+// NewBucketFactory creates a bucket factory that executes Takes and Charges against both old and
+// new, with old authoritative.
+func NewBucketFactory(old, new quotaservice.BucketFactory) quotaservice.BucketFactory {
+	if old == nil || new == nil {
+		panic("Both old and new bucket factories are required")
+	}
+
+	return &bucketFactory{old: old, new: new}
+}
+
+// SetNewAuthoritative makes the new factory authoritative, or, to roll back, the old one. It
+// returns false if bf wasn't created by NewBucketFactory.
+func SetNewAuthoritative(bf quotaservice.BucketFactory, newAuthoritative bool) bool {
+	m, ok := bf.(*bucketFactory)
+	if !ok {
+		return false
+	}
+
+	var v int32
+	if newAuthoritative {
+		v = 1
+	}
+
+	if atomic.SwapInt32(&m.newAuthoritative, v) != v {
+		logging.Printf("Migration: new bucket factory authoritative=%v", newAuthoritative)
+	}
+
+	return true
+}
+
+// Progress returns the status of a migration, and false if bf wasn't created by NewBucketFactory.
+func Progress(bf quotaservice.BucketFactory) (Status, bool) {
+	m, ok := bf.(*bucketFactory)
+	if !ok {
+		return Status{}, false
+	}
+
+	return Status{
+		NewAuthoritative: atomic.LoadInt32(&m.newAuthoritative) == 1,
+		Takes:            atomic.LoadInt64(&m.takes),
+		Divergences:      atomic.LoadInt64(&m.divergences),
+		ShadowErrors:     atomic.LoadInt64(&m.shadowErrors)}, true
+}
+
+func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	bf.old.Init(cfg)
+	bf.new.Init(cfg)
+}
+
+// Client returns the authoritative factory's client.
+func (bf *bucketFactory) Client() interface{} {
+	if atomic.LoadInt32(&bf.newAuthoritative) == 1 {
+		return bf.new.Client()
+	}
+
+	return bf.old.Client()
+}
+
+// Close closes both factories, if they implement quotaservice.BucketFactoryCloser.
+func (bf *bucketFactory) Close() {
+	for _, delegate := range []quotaservice.BucketFactory{bf.old, bf.new} {
+		if closer, ok := delegate.(quotaservice.BucketFactoryCloser); ok {
+			closer.Close()
+		}
+	}
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	return &bucket{
+		old:     bf.old.NewBucket(namespace, bucketName, cfg, dyn),
+		new:     bf.new.NewBucket(namespace, bucketName, cfg, dyn),
+		factory: bf}
+}
+
+type bucket struct {
+	old, new quotaservice.Bucket
+	factory  *bucketFactory
+}
+
+// buckets returns the authoritative and shadow buckets.
+func (b *bucket) buckets() (authoritative, shadow quotaservice.Bucket) {
+	if atomic.LoadInt32(&b.factory.newAuthoritative) == 1 {
+		return b.new, b.old
+	}
+
+	return b.old, b.new
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	authoritative, shadow := b.buckets()
+
+	w, granted, err := authoritative.Take(ctx, numTokens, maxWaitTime)
+	if err != nil {
+		return w, granted, err
+	}
+
+	atomic.AddInt64(&b.factory.takes, 1)
+	_, shadowGranted, shadowErr := shadow.Take(ctx, numTokens, maxWaitTime)
+	if shadowErr != nil {
+		// Counted rather than logged, since an unavailable shadow backend would flood the logs.
+		atomic.AddInt64(&b.factory.shadowErrors, 1)
+		return w, granted, nil
+	}
+
+	if granted == shadowGranted {
+		return w, granted, nil
+	}
+
+	atomic.AddInt64(&b.factory.divergences, 1)
+
+	// Keep the shadow in step with the tokens the authoritative bucket granted.
+	delta := numTokens
+	if !granted {
+		delta = -numTokens
+	}
+
+	if err := shadow.Charge(ctx, delta); err != nil {
+		atomic.AddInt64(&b.factory.shadowErrors, 1)
+	}
+
+	return w, granted, nil
+}
+
+func (b *bucket) Charge(ctx context.Context, numTokens int64) error {
+	authoritative, shadow := b.buckets()
+	if err := authoritative.Charge(ctx, numTokens); err != nil {
+		return err
+	}
+
+	if err := shadow.Charge(ctx, numTokens); err != nil {
+		atomic.AddInt64(&b.factory.shadowErrors, 1)
+	}
+
+	return nil
+}
+
+// Tokens returns the tokens of the authoritative bucket.
+func (b *bucket) Tokens(ctx context.Context) (int64, error) {
+	authoritative, _ := b.buckets()
+	if inspector, ok := authoritative.(quotaservice.TokenInspector); ok {
+		return inspector.Tokens(ctx)
+	}
+
+	return 0, quotaservice.ErrNotSupported
+}
+
+// Warm warms both buckets, failing only if the authoritative bucket does.
+func (b *bucket) Warm(ctx context.Context) error {
+	return b.both(func(bkt quotaservice.Bucket) error {
+		if warmer, ok := bkt.(quotaservice.BucketWarmer); ok {
+			return warmer.Warm(ctx)
+		}
+
+		return quotaservice.ErrNotSupported
+	})
+}
+
+// ForgiveDebt forgives the debt of both buckets, failing only if the authoritative bucket does.
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	return b.both(func(bkt quotaservice.Bucket) error {
+		if forgiver, ok := bkt.(quotaservice.DebtForgiver); ok {
+			return forgiver.ForgiveDebt(ctx)
+		}
+
+		return quotaservice.ErrNotSupported
+	})
+}
+
+// Reset resets both buckets, failing only if the authoritative bucket does.
+func (b *bucket) Reset(ctx context.Context) error {
+	return b.both(func(bkt quotaservice.Bucket) error {
+		if resetter, ok := bkt.(quotaservice.BucketResetter); ok {
+			return resetter.Reset(ctx)
+		}
+
+		return quotaservice.ErrNotSupported
+	})
+}
+
+// both calls op on the authoritative bucket and then, if it succeeds, on the shadow, counting the
+// shadow's errors rather than returning them.
+func (b *bucket) both(op func(quotaservice.Bucket) error) error {
+	authoritative, shadow := b.buckets()
+	if err := op(authoritative); err != nil {
+		return err
+	}
+
+	if err := op(shadow); err != nil {
+		atomic.AddInt64(&b.factory.shadowErrors, 1)
+	}
+
+	return nil
+}
+
+func (b *bucket) Config() *pbconfig.BucketConfig {
+	authoritative, _ := b.buckets()
+	return authoritative.Config()
+}
+
+func (b *bucket) Dynamic() bool {
+	return b.old.Dynamic()
+}
+
+func (b *bucket) Destroy() {
+	b.old.Destroy()
+	b.new.Destroy()
+}
+
+func (b *bucket) ReportActivity() {
+	b.old.ReportActivity()
+	b.new.ReportActivity()
+}
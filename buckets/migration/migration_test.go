@@ -0,0 +1,141 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package migration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets/memory"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+)
+
+func newTestFactory() (quotaservice.BucketFactory, *qstesting.MockBucketFactory, *qstesting.MockBucketFactory) {
+	old := &qstesting.MockBucketFactory{}
+	new := &qstesting.MockBucketFactory{}
+	bf := NewBucketFactory(old, new)
+	bf.Init(config.NewDefaultServiceConfig())
+
+	return bf, old, new
+}
+
+func TestOldAuthoritative(t *testing.T) {
+	bf, old, new := newTestFactory()
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	_, granted, err := b.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+	if !granted {
+		t.Fatal("Expected tokens to be granted")
+	}
+
+	// The new backend denies, but the old one is authoritative.
+	new.SetWaitTime("ns", "b", time.Hour)
+	_, granted, err = b.Take(context.Background(), 3, 0)
+	helpers.CheckError(t, err)
+	if !granted {
+		t.Fatal("Expected the old bucket to decide")
+	}
+
+	if charged := new.Charged("ns", "b"); charged != 3 {
+		t.Fatalf("Expected the granted tokens to be charged to the shadow bucket, got %v", charged)
+	}
+
+	helpers.CheckError(t, b.Charge(context.Background(), 2))
+	if old.Charged("ns", "b") != 2 || new.Charged("ns", "b") != 5 {
+		t.Fatalf("Expected charges to both buckets, got %v and %v", old.Charged("ns", "b"), new.Charged("ns", "b"))
+	}
+
+	if status, ok := Progress(bf); !ok || status != (Status{Takes: 2, Divergences: 1}) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
+
+func TestNewAuthoritative(t *testing.T) {
+	bf, old, new := newTestFactory()
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	if !SetNewAuthoritative(bf, true) {
+		t.Fatal("Expected the factory to be a migration factory")
+	}
+
+	new.SetWaitTime("ns", "b", time.Hour)
+	_, granted, err := b.Take(context.Background(), 3, 0)
+	helpers.CheckError(t, err)
+	if granted {
+		t.Fatal("Expected the new bucket to decide")
+	}
+
+	if charged := old.Charged("ns", "b"); charged != -3 {
+		t.Fatalf("Expected the tokens taken from the shadow bucket to be returned, got %v", charged)
+	}
+
+	if status, _ := Progress(bf); !status.NewAuthoritative || status.Divergences != 1 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
+
+func TestShadowErrors(t *testing.T) {
+	old := &qstesting.MockBucketFactory{}
+	bf := NewBucketFactory(old, &qstesting.MockBucketFactory{SimulateFailure: true})
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	_, granted, err := b.Take(context.Background(), 1, 0)
+	if err != nil || !granted {
+		t.Fatalf("Expected shadow errors not to fail requests, got %v, %v", granted, err)
+	}
+
+	if status, _ := Progress(bf); status.ShadowErrors != 1 {
+		t.Fatalf("Expected a shadow error, got %+v", status)
+	}
+
+	if _, ok := Progress(old); ok {
+		t.Fatal("Expected no status for other factories")
+	}
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	bf, old, new := newTestFactory()
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	helpers.CheckError(t, b.(quotaservice.BucketWarmer).Warm(ctx))
+	if old.Warmed("ns", "b") != 1 || new.Warmed("ns", "b") != 1 {
+		t.Fatal("Expected both buckets to be warmed")
+	}
+
+	helpers.CheckError(t, b.Charge(ctx, 150))
+	helpers.CheckError(t, b.(quotaservice.DebtForgiver).ForgiveDebt(ctx))
+	if old.Charged("ns", "b") != 100 || new.Charged("ns", "b") != 100 {
+		t.Fatal("Expected the debt of both buckets to be forgiven")
+	}
+
+	// Only the authoritative bucket's tokens are reported, and only its failures fail calls.
+	old.SetError("ns", "b", errors.New("unavailable"))
+	if _, err := b.(quotaservice.TokenInspector).Tokens(ctx); err == nil {
+		t.Fatal("Expected the old bucket's failure to be returned")
+	}
+
+	SetNewAuthoritative(bf, true)
+	helpers.CheckError(t, b.(quotaservice.BucketResetter).Reset(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 100 {
+		t.Fatalf("Expected the new bucket to be reset, got %v, %v", tokens, err)
+	}
+
+	if status, _ := Progress(bf); status.ShadowErrors != 1 {
+		t.Fatalf("Expected the shadow's failure to be counted, got %+v", status)
+	}
+
+	// Memory buckets can't be warmed.
+	unsupported := NewBucketFactory(memory.NewBucketFactory(), new).NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+	defer unsupported.Destroy()
+	if err := unsupported.(quotaservice.BucketWarmer).Warm(ctx); err != quotaservice.ErrNotSupported {
+		t.Fatalf("Expected warming to be unsupported, got %v", err)
+	}
+}
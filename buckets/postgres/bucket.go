@@ -0,0 +1,127 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+type bucket struct {
+	factory *bucketFactory
+	name    string
+	lockKey int64
+	cfg     *pbconfig.BucketConfig
+	dynamic bool
+	ttl     time.Duration
+	now     func() time.Time
+	quotaservice.DefaultBucket
+}
+
+// lockKey returns the advisory lock key for a bucket. Hash collisions only cause unrelated buckets
+// to be updated serially.
+func lockKey(table, name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(table + ":" + name))
+	return int64(h.Sum64())
+}
+
+// update reads the bucket's state, applies f to it, and writes it back if f returns true, all within
+// a transaction holding the bucket's advisory lock.
+func (b *bucket) update(ctx context.Context, f func(buckets.TokenState, int64) (buckets.TokenState, bool)) (err error) {
+	bf := b.factory
+
+	tx, err := bf.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update bucket %v", b.name)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", b.lockKey); err != nil {
+		return errors.Wrapf(err, "failed to lock bucket %v", b.name)
+	}
+
+	now := b.now()
+	state := buckets.NewTokenState(b.cfg)
+	err = tx.QueryRowContext(ctx, bf.selectStmt, b.name, now).
+		Scan(&state.AccumulatedTokens, &state.TokensNextAvailableNanos)
+	if err == sql.ErrNoRows {
+		err = nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to read bucket %v", b.name)
+	}
+
+	next, write := f(state, now.UnixNano())
+	if !write {
+		return tx.Commit()
+	}
+
+	_, err = tx.ExecContext(ctx, bf.upsertStmt,
+		b.name, next.AccumulatedTokens, next.TokensNextAvailableNanos, now.Add(b.ttl))
+	if err != nil {
+		return errors.Wrapf(err, "failed to update bucket %v", b.name)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrapf(err, "failed to update bucket %v", b.name)
+	}
+
+	return nil
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	var waitNanos int64
+	var success bool
+
+	err := b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		state, waitNanos, success = state.Take(b.cfg, nowNanos, numTokens, maxWaitTime.Nanoseconds(), buckets.MaxDebtNanos(ctx, b.cfg))
+		return state, success
+	})
+
+	if err != nil || !success {
+		return 0, false, err
+	}
+
+	return time.Duration(waitNanos), true, nil
+}
+
+func (b *bucket) Charge(ctx context.Context, numTokens int64) error {
+	return b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		return state.Charge(b.cfg, nowNanos, numTokens), true
+	})
+}
+
+// ForgiveDebt implements quotaservice.DebtForgiver.
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	return b.update(ctx, func(state buckets.TokenState, nowNanos int64) (buckets.TokenState, bool) {
+		return state.ForgiveDebt(b.cfg, nowNanos), true
+	})
+}
+
+// Reset implements quotaservice.BucketResetter.
+func (b *bucket) Reset(ctx context.Context) error {
+	return b.update(ctx, func(buckets.TokenState, int64) (buckets.TokenState, bool) {
+		return buckets.NewTokenState(b.cfg), true
+	})
+}
+
+func (b *bucket) Config() *pbconfig.BucketConfig {
+	return b.cfg
+}
+
+func (b *bucket) Dynamic() bool {
+	return b.dynamic
+}
@@ -0,0 +1,82 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package postgres implements token buckets stored in PostgreSQL, for small deployments that
+// already run Postgres and want durable buckets without running Redis. Updates to a bucket are
+// serialized with a transaction-scoped advisory lock on the bucket's name. Callers open the
+// *sql.DB with a Postgres driver, e.g. github.com/lib/pq, and create the bucket table with Migrate.
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// Config configures a Postgres bucket factory.
+type Config struct {
+	// Table that bucket state is stored in, optionally qualified by a schema. Created by Migrate.
+	Table string
+	// KeyMaxIdleTime is how long bucket state is kept after it was last updated, unless overridden
+	// by a bucket's MaxIdleMillis. Expired buckets start full, and are deleted by PurgeExpired.
+	KeyMaxIdleTime time.Duration
+}
+
+// NewDefaultConfig returns a config storing bucket state in the quotaservice_buckets table.
+func NewDefaultConfig() Config {
+	return Config{
+		Table:          "quotaservice_buckets",
+		KeyMaxIdleTime: 24 * time.Hour}
+}
+
+type bucketFactory struct {
+	db  *sql.DB
+	cfg Config
+
+	selectStmt, upsertStmt string
+}
+
+// NewBucketFactory creates a bucket factory storing bucket state in Postgres. The table must have
+// been created with Migrate.
+func NewBucketFactory(db *sql.DB, cfg Config) quotaservice.BucketFactory {
+	if cfg.KeyMaxIdleTime <= 0 {
+		cfg.KeyMaxIdleTime = 24 * time.Hour
+	}
+
+	return &bucketFactory{
+		db:  db,
+		cfg: cfg,
+		selectStmt: fmt.Sprintf(
+			"SELECT accumulated_tokens, tokens_next_available FROM %s WHERE name = $1 AND expires_at > $2", cfg.Table),
+		upsertStmt: fmt.Sprintf(
+			`INSERT INTO %s (name, accumulated_tokens, tokens_next_available, expires_at) VALUES ($1, $2, $3, $4)
+ON CONFLICT (name) DO UPDATE SET accumulated_tokens = EXCLUDED.accumulated_tokens,
+	tokens_next_available = EXCLUDED.tokens_next_available, expires_at = EXCLUDED.expires_at`, cfg.Table)}
+}
+
+func (bf *bucketFactory) Init(_ *pbconfig.ServiceConfig) {}
+
+func (bf *bucketFactory) Client() interface{} {
+	return bf.db
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	ttl := bf.cfg.KeyMaxIdleTime
+	if cfg.GetMaxIdleMillis() > 0 {
+		ttl = time.Duration(cfg.GetMaxIdleMillis()) * time.Millisecond
+	}
+
+	name := config.FullyQualifiedName(namespace, bucketName)
+	return &bucket{
+		factory: bf,
+		name:    name,
+		lockKey: lockKey(bf.cfg.Table, name),
+		cfg:     cfg,
+		dynamic: dyn,
+		ttl:     ttl,
+		now:     time.Now}
+}
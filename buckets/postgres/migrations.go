@@ -0,0 +1,111 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// migrations are the statements creating and upgrading the bucket table, applied in order. %[1]s
+// is the table name, and %[2]s the table name without its schema. Append new migrations; never
+// edit or reorder existing ones.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS %[1]s (
+	name text PRIMARY KEY,
+	accumulated_tokens bigint NOT NULL,
+	tokens_next_available bigint NOT NULL,
+	expires_at timestamptz NOT NULL
+)`,
+	`CREATE INDEX IF NOT EXISTS %[2]s_expires_at_idx ON %[1]s (expires_at)`,
+}
+
+// Migrations returns the statements that Migrate applies, in order, for DBAs who manage schemas
+// themselves.
+func Migrations(cfg Config) []string {
+	stmts := make([]string, len(migrations))
+	for i, m := range migrations {
+		stmts[i] = fmt.Sprintf(m, cfg.Table, unqualified(cfg.Table))
+	}
+
+	return stmts
+}
+
+// Migrate creates or upgrades the bucket table, recording the migrations applied in a
+// <table>_migrations table. Safe to call concurrently, e.g. from every instance on startup.
+func Migrate(ctx context.Context, db *sql.DB, cfg Config) (err error) {
+	versionsTable := cfg.Table + "_migrations"
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate bucket table")
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Serializes concurrent migrations of the same table.
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", lockKey(versionsTable, "")); err != nil {
+		return errors.Wrap(err, "failed to lock bucket table for migration")
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version integer PRIMARY KEY, applied_at timestamptz NOT NULL)", versionsTable))
+	if err != nil {
+		return errors.Wrap(err, "failed to create migrations table")
+	}
+
+	var applied int
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", versionsTable)).Scan(&applied)
+	if err != nil {
+		return errors.Wrap(err, "failed to read applied migrations")
+	}
+
+	for i, stmt := range Migrations(cfg) {
+		version := i + 1
+		if version <= applied {
+			continue
+		}
+
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return errors.Wrapf(err, "failed to apply migration %v", version)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (version, applied_at) VALUES ($1, $2)", versionsTable), version, time.Now())
+		if err != nil {
+			return errors.Wrapf(err, "failed to record migration %v", version)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to migrate bucket table")
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes the state of buckets that have been idle for longer than their max idle
+// time, returning how many were deleted. Expired buckets are ignored when read, so this only
+// reclaims space; run it periodically, e.g. from a cron job.
+func PurgeExpired(ctx context.Context, db *sql.DB, cfg Config) (int64, error) {
+	res, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at <= $1", cfg.Table), time.Now())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge expired buckets")
+	}
+
+	return res.RowsAffected()
+}
+
+func unqualified(table string) string {
+	return table[strings.LastIndex(table, ".")+1:]
+}
@@ -0,0 +1,90 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"math"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+)
+
+// Backoff determines how long to wait between successive attempts at an operation.
+type Backoff interface {
+	// Delay returns how long to wait after the given attempt, numbered from 0, has failed.
+	Delay(attempt int) time.Duration
+}
+
+// ExponentialBackoff is a Backoff whose delay grows exponentially, up to a maximum, with random
+// jitter so that many clients don't retry in lockstep.
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, by which each delay is randomly reduced.
+	Jitter float64
+	random func() float64
+}
+
+// NewDefaultExponentialBackoff creates an ExponentialBackoff with the given initial and maximum
+// delays, doubling on each attempt with 20% jitter.
+func NewDefaultExponentialBackoff(initial, max time.Duration) *ExponentialBackoff {
+	return &ExponentialBackoff{
+		Initial:    initial,
+		Max:        max,
+		Multiplier: 2,
+		Jitter:     0.2}
+}
+
+func (b *ExponentialBackoff) Delay(attempt int) time.Duration {
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if delay > float64(b.Max) || math.IsInf(delay, 0) || math.IsNaN(delay) {
+		delay = float64(b.Max)
+	}
+
+	random := b.random
+	if random == nil {
+		random = rand.Float64
+	}
+
+	return time.Duration(delay * (1 - b.Jitter*random()))
+}
+
+// RetryConfig configures how a Redis bucketFactory retries failed calls and re-establishes broken
+// connections.
+type RetryConfig struct {
+	// Reconnect is the backoff between attempts to re-establish a connection to Redis. Reconnection
+	// happens in the background, and is retried until it succeeds.
+	Reconnect Backoff
+	// Request is the backoff between attempts made by a single call to Take. The number of attempts
+	// is bounded by the connectionRetries passed to the factory's constructor.
+	Request Backoff
+}
+
+// NewDefaultRetryConfig creates a RetryConfig with sensible defaults.
+func NewDefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Reconnect: NewDefaultExponentialBackoff(time.Second, 3*time.Minute),
+		Request:   NewDefaultExponentialBackoff(10*time.Millisecond, 100*time.Millisecond)}
+}
+
+// SetRetryConfig replaces the retry configuration on a Redis bucketFactory, or on every shard of a
+// sharded one. It should be called before the factory is used.
+func SetRetryConfig(bf quotaservice.BucketFactory, cfg RetryConfig) {
+	for _, f := range redisFactories(bf) {
+		f.Lock()
+		f.retries = cfg
+		f.Unlock()
+	}
+}
+
+// isRetryable returns whether a failed call to Redis is worth retrying. Only network errors, such
+// as timeouts and reset connections, are retried; errors returned by Redis itself are not.
+func isRetryable(err error) bool {
+	_, ok := errors.Cause(err).(net.Error)
+	return ok
+}
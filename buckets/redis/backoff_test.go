@@ -0,0 +1,48 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := NewDefaultExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	b.random = func() float64 { return 0 }
+
+	for attempt, expected := range []time.Duration{
+		10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond} {
+		if d := b.Delay(attempt); d != expected {
+			t.Fatalf("Expected delay %v for attempt %v, got %v", expected, attempt, d)
+		}
+	}
+
+	if d := b.Delay(10000); d != 50*time.Millisecond {
+		t.Fatalf("Expected delay to be capped at 50ms, got %v", d)
+	}
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	b := NewDefaultExponentialBackoff(100*time.Millisecond, time.Second)
+	b.random = func() float64 { return 1 }
+
+	if d := b.Delay(0); d != 80*time.Millisecond {
+		t.Fatalf("Expected delay to be reduced by 20%% jitter to 80ms, got %v", d)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	if !isRetryable(errors.Wrap(netErr, "wrapped")) {
+		t.Fatal("Network errors should be retryable")
+	}
+
+	if isRetryable(errors.New(redisClientClosedError)) {
+		t.Fatal("Closed client errors should not be retryable")
+	}
+}
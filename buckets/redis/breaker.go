@@ -0,0 +1,215 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/logging"
+)
+
+type BreakerState int
+
+const (
+	// Calls to Redis are allowed.
+	BREAKER_CLOSED BreakerState = iota
+	// Calls to Redis are rejected without being attempted.
+	BREAKER_OPEN
+	// A limited number of probe calls to Redis are allowed, to determine whether it has recovered.
+	BREAKER_HALF_OPEN
+)
+
+var breakerStateNames = []string{
+	BREAKER_CLOSED:    "BREAKER_CLOSED",
+	BREAKER_OPEN:      "BREAKER_OPEN",
+	BREAKER_HALF_OPEN: "BREAKER_HALF_OPEN",
+}
+
+func (s BreakerState) String() string {
+	return breakerStateNames[s]
+}
+
+// ErrCircuitOpen is returned by Take when the circuit breaker is open.
+var ErrCircuitOpen = errors.New("redis circuit breaker is open")
+
+// BreakerConfig configures the circuit breaker around calls to Redis.
+type BreakerConfig struct {
+	// Disabled turns off the circuit breaker.
+	Disabled bool
+	// FailureRateThreshold is the fraction of failed calls, within Window, that opens the breaker.
+	FailureRateThreshold float64
+	// SlowCallThreshold is the latency above which a call counts as failed. 0 disables this.
+	SlowCallThreshold time.Duration
+	// MinRequests is the number of calls needed within Window before the failure rate is considered.
+	MinRequests int64
+	Window      time.Duration
+	// OpenDuration is how long the breaker stays open before allowing probes.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of concurrent probe calls allowed while half-open.
+	HalfOpenProbes int
+	// OnStateChange, if set, is called on every state transition, e.g. to feed health checks or metrics.
+	// It is called with the breaker's lock held, and must not block.
+	OnStateChange func(from, to BreakerState)
+}
+
+// NewDefaultBreakerConfig creates a BreakerConfig with sensible defaults.
+func NewDefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureRateThreshold: 0.5,
+		MinRequests:          20,
+		Window:               10 * time.Second,
+		OpenDuration:         5 * time.Second,
+		HalfOpenProbes:       1}
+}
+
+type circuitBreaker struct {
+	cfg              BreakerConfig
+	state            BreakerState
+	windowStart      time.Time
+	requests         int64
+	failures         int64
+	openedAt         time.Time
+	probesInProgress int
+	now              func() time.Time
+	sync.Mutex
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg, now: time.Now}
+}
+
+// allow returns whether a call should be attempted. Every allowed call must be followed by a call
+// to record.
+func (cb *circuitBreaker) allow() bool {
+	if cb.cfg.Disabled {
+		return true
+	}
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	switch cb.state {
+	case BREAKER_OPEN:
+		if cb.now().Sub(cb.openedAt) < cb.cfg.OpenDuration {
+			return false
+		}
+		cb.transitionLocked(BREAKER_HALF_OPEN)
+		fallthrough
+	case BREAKER_HALF_OPEN:
+		if cb.probesInProgress >= cb.cfg.HalfOpenProbes {
+			return false
+		}
+		cb.probesInProgress++
+	}
+
+	return true
+}
+
+// record records the outcome of a call allowed by allow.
+func (cb *circuitBreaker) record(err error, latency time.Duration) {
+	if cb.cfg.Disabled {
+		return
+	}
+
+	failed := err != nil || (cb.cfg.SlowCallThreshold > 0 && latency > cb.cfg.SlowCallThreshold)
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	now := cb.now()
+	switch cb.state {
+	case BREAKER_HALF_OPEN:
+		if cb.probesInProgress > 0 {
+			cb.probesInProgress--
+		}
+
+		if failed {
+			cb.openLocked(now)
+		} else {
+			cb.transitionLocked(BREAKER_CLOSED)
+			cb.resetWindowLocked(now)
+		}
+	case BREAKER_CLOSED:
+		if now.Sub(cb.windowStart) > cb.cfg.Window {
+			cb.resetWindowLocked(now)
+		}
+
+		cb.requests++
+		if failed {
+			cb.failures++
+		}
+
+		if cb.requests >= cb.cfg.MinRequests &&
+			float64(cb.failures)/float64(cb.requests) >= cb.cfg.FailureRateThreshold {
+			cb.openLocked(now)
+		}
+	}
+}
+
+func (cb *circuitBreaker) openLocked(now time.Time) {
+	cb.openedAt = now
+	cb.transitionLocked(BREAKER_OPEN)
+}
+
+func (cb *circuitBreaker) resetWindowLocked(now time.Time) {
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+}
+
+func (cb *circuitBreaker) transitionLocked(to BreakerState) {
+	from := cb.state
+	if from == to {
+		return
+	}
+
+	cb.state = to
+	if to != BREAKER_HALF_OPEN {
+		cb.probesInProgress = 0
+	}
+
+	logging.Printf("Redis circuit breaker transitioned from %v to %v", from, to)
+	if cb.cfg.OnStateChange != nil {
+		cb.cfg.OnStateChange(from, to)
+	}
+}
+
+func (cb *circuitBreaker) currentState() BreakerState {
+	cb.Lock()
+	defer cb.Unlock()
+
+	return cb.state
+}
+
+func (cb *circuitBreaker) String() string {
+	cb.Lock()
+	defer cb.Unlock()
+
+	return fmt.Sprintf("circuitBreaker{state: %v, requests: %v, failures: %v}", cb.state, cb.requests, cb.failures)
+}
+
+// SetBreakerConfig replaces the circuit breaker on a Redis bucketFactory, or gives every shard of a
+// sharded one its own. It should be called before the factory is used.
+func SetBreakerConfig(bf quotaservice.BucketFactory, cfg BreakerConfig) {
+	for _, f := range redisFactories(bf) {
+		f.Lock()
+		f.breaker = newCircuitBreaker(cfg)
+		f.Unlock()
+	}
+}
+
+// CircuitBreakerState returns the state of the circuit breaker on a Redis bucketFactory. The
+// breakers of a sharded factory's shards are reported by ShardHealth.
+func CircuitBreakerState(bf quotaservice.BucketFactory) BreakerState {
+	f, ok := bf.(*bucketFactory)
+	if !ok {
+		panic(fmt.Sprintf("Not a Redis bucket factory: %T", bf))
+	}
+
+	return f.circuitBreaker().currentState()
+}
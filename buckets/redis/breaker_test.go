@@ -0,0 +1,101 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newTestBreaker() (*circuitBreaker, *time.Time, *[]BreakerState) {
+	transitions := make([]BreakerState, 0)
+	cfg := NewDefaultBreakerConfig()
+	cfg.MinRequests = 4
+	cfg.SlowCallThreshold = 100 * time.Millisecond
+	cfg.OnStateChange = func(_, to BreakerState) { transitions = append(transitions, to) }
+
+	now := time.Unix(1000, 0)
+	cb := newCircuitBreaker(cfg)
+	cb.now = func() time.Time { return now }
+	return cb, &now, &transitions
+}
+
+func TestBreakerOpensOnFailureRate(t *testing.T) {
+	cb, _, _ := newTestBreaker()
+	failure := errors.New("failed")
+
+	for _, err := range []error{nil, failure, nil} {
+		if !cb.allow() {
+			t.Fatal("Breaker should allow calls while closed")
+		}
+		cb.record(err, time.Millisecond)
+	}
+
+	if cb.currentState() != BREAKER_CLOSED {
+		t.Fatalf("Breaker should not open below MinRequests: %v", cb)
+	}
+
+	cb.allow()
+	cb.record(failure, time.Millisecond)
+
+	if cb.currentState() != BREAKER_OPEN || cb.allow() {
+		t.Fatalf("Breaker should be open and reject calls: %v", cb)
+	}
+}
+
+func TestBreakerCountsSlowCallsAsFailures(t *testing.T) {
+	cb, _, _ := newTestBreaker()
+
+	for i := 0; i < 4; i++ {
+		cb.allow()
+		cb.record(nil, time.Second)
+	}
+
+	if cb.currentState() != BREAKER_OPEN {
+		t.Fatalf("Breaker should open on slow calls: %v", cb)
+	}
+}
+
+func TestBreakerHalfOpenProbing(t *testing.T) {
+	cb, now, transitions := newTestBreaker()
+	for i := 0; i < 4; i++ {
+		cb.allow()
+		cb.record(errors.New("failed"), time.Millisecond)
+	}
+
+	*now = now.Add(cb.cfg.OpenDuration)
+	if !cb.allow() {
+		t.Fatal("Breaker should allow a probe after OpenDuration")
+	}
+
+	if cb.allow() {
+		t.Fatal("Breaker should only allow HalfOpenProbes concurrent probes")
+	}
+
+	// Failed probe re-opens the breaker
+	cb.record(errors.New("failed"), time.Millisecond)
+	if cb.currentState() != BREAKER_OPEN {
+		t.Fatalf("Failed probe should re-open the breaker: %v", cb)
+	}
+
+	*now = now.Add(cb.cfg.OpenDuration)
+	cb.allow()
+	cb.record(nil, time.Millisecond)
+	if cb.currentState() != BREAKER_CLOSED {
+		t.Fatalf("Successful probe should close the breaker: %v", cb)
+	}
+
+	expected := []BreakerState{BREAKER_OPEN, BREAKER_HALF_OPEN, BREAKER_OPEN, BREAKER_HALF_OPEN, BREAKER_CLOSED}
+	if len(*transitions) != len(expected) {
+		t.Fatalf("Expected transitions %v, got %v", expected, *transitions)
+	}
+
+	for i, s := range expected {
+		if (*transitions)[i] != s {
+			t.Fatalf("Expected transitions %v, got %v", expected, *transitions)
+		}
+	}
+}
@@ -15,12 +15,14 @@ import (
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets"
+	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/logging"
 	pbconfig "github.com/square/quotaservice/protos/config"
 )
 
 // configAttributes represents certain values from a pbconfig.BucketConfig, represented as strings, for easy use as
-// parameters to a Redis call.
+// parameters to a Redis call. Times are in the factory's TimeUnit.
 type configAttributes struct {
 	nanosBetweenTokens          string
 	maxTokensToAccumulate       string
@@ -42,29 +44,36 @@ func (a *abstractBucket) Config() *pbconfig.BucketConfig {
 }
 
 func (a *abstractBucket) Take(ctx context.Context, requested int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
-	maxIdleTimeMillis := a.maxIdleTimeMillis
-	if a.maxIdleTimeMillis == "0" {
-		// bucket MaxIdleMillis was not set; fall back to factory setting
-		maxIdleTimeMillis = strconv.FormatInt(int64(a.factory.keyMaxIdleTime/time.Millisecond), 10)
+	if config.Blocked(a.cfg) {
+		return 0, false, nil
 	}
-	args := []interface{}{a.nanosBetweenTokens, a.maxTokensToAccumulate,
-		strconv.FormatInt(requested, 10), strconv.FormatInt(maxWaitTime.Nanoseconds(), 10),
-		maxIdleTimeMillis, a.maxDebtNanos}
 
-	client := a.factory.Client().(redis.UniversalClient)
-	res := a.takeFromRedis(ctx, client, args)
-	if err := res.Err(); err != nil {
-		if isRedisClientClosedError(err) {
-			logging.Print("Failed to take token from redis because the client was closed, reconnecting")
-			a.factory.handleConnectionFailure(client)
-		}
-		return 0, false, errors.Wrap(err, "failed to take token from redis bucket")
+	// The script rejects, without taking tokens, requests that would wait past the caller's
+	// deadline.
+	maxWaitTime, beforeDeadline := quotaservice.MaxWaitWithinDeadline(ctx, maxWaitTime)
+	if !beforeDeadline {
+		return 0, false, nil
+	}
+
+	args := a.scriptArgs(requested, maxWaitTime)
+	if quotaservice.StrictFromContext(ctx) {
+		args[5] = "0"
+	}
+
+	keys := a.keys
+	if id := quotaservice.RequestIDFromContext(ctx); id != "" {
+		keys = []string{a.keys[0], toIdempotencyKey(a.keys[0], id)}
+	}
+
+	res, err := a.runWithRetries(ctx, a.factory.script, keys, args, "take token from")
+	if err != nil {
+		return 0, false, err
 	}
 
 	var waitTime time.Duration
 	switch val := res.Val().(type) {
 	case int64:
-		waitTime = time.Nanosecond * time.Duration(val)
+		waitTime = a.factory.timeUnit.Duration() * time.Duration(val)
 	default:
 		return 0, false, errors.Errorf("unknown response of type %[1]T: %[1]v", val)
 	}
@@ -77,13 +86,129 @@ func (a *abstractBucket) Take(ctx context.Context, requested int64, maxWaitTime
 	return waitTime, true, nil
 }
 
-func (a *abstractBucket) takeFromRedis(ctx context.Context, client redis.UniversalClient, args []interface{}) *redis.Cmd {
+func (a *abstractBucket) Charge(ctx context.Context, numTokens int64) error {
+	_, err := a.runWithRetries(ctx, a.factory.chargeScript, a.keys, a.scriptArgs(numTokens, 0), "charge")
+	return err
+}
+
+// ForgiveDebt implements quotaservice.DebtForgiver.
+func (a *abstractBucket) ForgiveDebt(ctx context.Context) error {
+	_, err := a.runWithRetries(ctx, a.factory.forgiveDebtScript, a.keys, a.scriptArgs(0, 0), "forgive debt of")
+	return err
+}
+
+// Reset implements quotaservice.BucketResetter.
+func (a *abstractBucket) Reset(ctx context.Context) error {
+	_, err := a.runWithRetries(ctx, a.factory.resetScript, a.keys, nil, "reset")
+	return err
+}
+
+// Tokens implements quotaservice.TokenInspector. The bucket's state is read without being updated,
+// and refilled according to the local clock.
+func (a *abstractBucket) Tokens(ctx context.Context) (int64, error) {
+	client := a.factory.Client().(redis.UniversalClient)
+	vals, err := client.HMGet(ctx, a.keys[0], tokensNextAvblNanosField, accumulatedTokensField, epochSecondsField,
+		unitNanosField).Result()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read redis bucket")
+	}
+
+	// Buckets without state are full.
+	state := buckets.NewTokenState(a.cfg)
+	var epochSeconds int64
+	unitNanos := int64(1)
+	for i, field := range []*int64{&state.TokensNextAvailableNanos, &state.AccumulatedTokens, &epochSeconds, &unitNanos} {
+		s, ok := vals[i].(string)
+		if !ok {
+			continue
+		}
+
+		if *field, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, errors.Wrap(err, "failed to parse redis bucket state")
+		}
+	}
+
+	// Times are stored in the bucket's time unit, relative to its epoch.
+	state.TokensNextAvailableNanos = state.TokensNextAvailableNanos*unitNanos + epochSeconds*int64(time.Second)
+	return state.Available(a.cfg, time.Now().UnixNano()), nil
+}
+
+// Warm implements quotaservice.BucketWarmer. Reading the bucket's state establishes connections
+// to the Redis node holding it, so that connection errors surface when a config is applied.
+func (a *abstractBucket) Warm(ctx context.Context) error {
+	_, err := a.Tokens(ctx)
+	return err
+}
+
+// scriptArgs returns the arguments expected by the Lua scripts.
+func (a *abstractBucket) scriptArgs(requested int64, maxWaitTime time.Duration) []interface{} {
+	return []interface{}{a.nanosBetweenTokens, a.maxTokensToAccumulate,
+		strconv.FormatInt(requested, 10), a.factory.timeUnit.toUnits(maxWaitTime.Nanoseconds()),
+		a.lifespanMillis(), a.maxDebtNanos, a.factory.timeSource.String(),
+		strconv.FormatInt(time.Now().UnixNano(), 10),
+		strconv.FormatInt(int64(a.factory.idempotencyTTL/time.Millisecond), 10),
+		strconv.FormatInt(int64(a.factory.timeUnit.Duration()), 10)}
+}
+
+// lifespanMillis returns how long the bucket's key lives without being used.
+func (a *abstractBucket) lifespanMillis() string {
+	if a.maxIdleTimeMillis == "0" {
+		// bucket MaxIdleMillis was not set; fall back to factory setting
+		return strconv.FormatInt(int64(a.factory.keyMaxIdleTime/time.Millisecond), 10)
+	}
+
+	return a.maxIdleTimeMillis
+}
+
+// runWithRetries runs a script, retrying transient failures with backoff up to the factory's
+// connectionRetries attempts, or until ctx is done. op describes the operation, for errors.
+func (a *abstractBucket) runWithRetries(ctx context.Context, script *redis.Script, keys []string, args []interface{}, op string) (*redis.Cmd, error) {
+	breaker := a.factory.circuitBreaker()
+	backoff := a.factory.requestBackoff()
+
+	for attempt := 0; ; attempt++ {
+		if !breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		client := a.factory.Client().(redis.UniversalClient)
+		start := time.Now()
+		res := a.runScript(ctx, client, script, keys, args)
+		breaker.record(res.Err(), time.Since(start))
+
+		err := res.Err()
+		if err == nil {
+			return res, nil
+		}
+
+		if isRedisClientClosedError(err) {
+			logging.Printf("Failed to %v redis because the client was closed, reconnecting", op)
+			a.factory.handleConnectionFailure(client)
+		}
+
+		if attempt+1 >= a.factory.connectionRetries || !isRetryable(err) {
+			return nil, errors.Wrapf(err, "failed to %v redis bucket", op)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(err, "failed to %v redis bucket", op)
+		case <-time.After(backoff.Delay(attempt)):
+		}
+	}
+}
+
+func (a *abstractBucket) runScript(ctx context.Context, client redis.UniversalClient, script *redis.Script, keys []string, args []interface{}) *redis.Cmd {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "script.Run")
 	defer span.Finish()
-	return a.factory.script.Run(ctx, client, a.keys, args...)
+	return script.Run(ctx, client, keys, args...)
 }
 
 var _ quotaservice.Bucket = (*staticBucket)(nil)
+var _ quotaservice.TokenInspector = (*staticBucket)(nil)
+var _ quotaservice.DebtForgiver = (*staticBucket)(nil)
+var _ quotaservice.BucketResetter = (*staticBucket)(nil)
+var _ quotaservice.BucketWarmer = (*staticBucket)(nil)
 
 // staticBucket is an implementation of quotaservice.Bucket for use with static, named buckets.
 type staticBucket struct {
@@ -95,6 +220,9 @@ func (s *staticBucket) Dynamic() bool {
 }
 
 var _ quotaservice.Bucket = (*dynamicBucket)(nil)
+var _ quotaservice.TokenInspector = (*dynamicBucket)(nil)
+var _ quotaservice.DebtForgiver = (*dynamicBucket)(nil)
+var _ quotaservice.BucketResetter = (*dynamicBucket)(nil)
 
 // dynamicBucket is an implementation of quotaservice.Bucket for use with dynamic buckets created from a template.
 type dynamicBucket struct {
@@ -16,27 +16,98 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/logging"
 	pbconfig "github.com/square/quotaservice/protos/config"
 )
 
-const luaScript = `
-local tokensNextAvailableNanos = tonumber(redis.call("GET", KEYS[1]))
+// luaTime is shared by the Lua scripts. Lua numbers are doubles, which only hold integers up to
+// 2^53 exactly; in nanos, that is about 104 days. Times are therefore kept relative to an epoch, in
+// whole seconds, stored with each bucket and moved up to the current second whenever its state is
+// saved, so that the nanos the scripts store and compute stay small and exact however long a
+// bucket lives. Though named for nanos, times and durations are in the factory's TimeUnit, passed
+// to the scripts as its length in nanos.
+var luaTime = `
+-- currentTime returns the current time as seconds since the Unix epoch, and units within the
+-- second. The client's time, in nanos, is split as a string so that it isn't rounded to a double.
+local function currentTime(timeSource, clientTimeNanos, unitNanos)
+	if timeSource == "` + TIME_SOURCE_CLIENT.String() + `" then
+		return tonumber(string.sub(clientTimeNanos, 1, -10)) or 0,
+			math.floor(tonumber(string.sub(clientTimeNanos, -9)) / unitNanos)
+	end
+
+	-- Redis doesn't allow non-deterministic functions unless we use replicating commands instead of scripts
+	redis.replicate_commands()
+	local redisTime = redis.call("TIME")
+	return tonumber(redisTime[1]), math.floor(tonumber(redisTime[2]) * 1e+3 / unitNanos)
+end
+
+-- rebase returns a new epoch, at the second of currentTimeNanos, and the units to subtract from
+-- times relative to the old epoch to make them relative to the new one.
+local function rebase(epochSeconds, currentTimeNanos, unitsPerSecond)
+	local elapsedSeconds = math.floor(currentTimeNanos / unitsPerSecond)
+	return epochSeconds + elapsedSeconds, elapsedSeconds * unitsPerSecond
+end
+
+-- convert converts a time saved in another unit, rounding up or down.
+local function convert(t, savedUnitNanos, unitNanos, round)
+	if not t or savedUnitNanos == unitNanos then
+		return t
+	end
+
+	return round(t * savedUnitNanos / unitNanos)
+end
+`
+
+// luaBucketState is shared by the Lua scripts. It loads the state of a bucket stored as a single
+// Redis hash, holding the time at which tokens are next available and the number of accumulated
+// tokens, refilled up to the current time. Keeping both in one key means they always expire
+// together, and live in the same cluster slot.
+var luaBucketState = luaTime + `
+local state = redis.call("HMGET", KEYS[1], "` + tokensNextAvblNanosField + `", "` + accumulatedTokensField + `",
+	"` + lastTimeNanosField + `", "` + epochSecondsField + `", "` + unitNanosField + `")
+
+local timeSource = ARGV[7]
+local unitNanos = tonumber(ARGV[10])
+local unitsPerSecond = 1e+9 / unitNanos
+local currentSeconds, currentUnits = currentTime(timeSource, ARGV[8], unitNanos)
+
+-- New buckets start at the current second. State saved without an epoch holds nanos since the
+-- Unix epoch, and is rebased when it is saved.
+local epochSeconds = tonumber(state[4])
+if not state[1] then
+	epochSeconds = currentSeconds
+elseif not epochSeconds then
+	epochSeconds = 0
+end
+
+-- State saved without a time unit is in nanos. State saved in another unit is converted, rounding
+-- so that tokens are never made available earlier.
+local savedUnitNanos = tonumber(state[5])
+if not savedUnitNanos then
+	savedUnitNanos = 1
+end
+
+local tokensNextAvailableNanos = convert(tonumber(state[1]), savedUnitNanos, unitNanos, math.ceil)
 if not tokensNextAvailableNanos then
 	tokensNextAvailableNanos = 0
 end
 
 local maxTokensToAccumulate = tonumber(ARGV[2])
 
-local accumulatedTokens = redis.call("GET", KEYS[2])
+local accumulatedTokens = tonumber(state[2])
 if not accumulatedTokens then
 	accumulatedTokens = maxTokensToAccumulate
 end
 
-local redisTime = redis.call("TIME")
-local second = tonumber(redisTime[1])
-local microsecond = tonumber(redisTime[2])
-local currentTimeNanos = second * 1e+9 + microsecond * 1e+3
+local currentTimeNanos = (currentSeconds - epochSeconds) * unitsPerSecond + currentUnits
+
+-- Never let time go backwards, e.g. after failing over to a replica with a skewed clock.
+local lastTimeNanos = convert(tonumber(state[3]), savedUnitNanos, unitNanos, math.floor)
+if timeSource == "` + TIME_SOURCE_REDIS_MONOTONIC.String() + `" and lastTimeNanos and currentTimeNanos < lastTimeNanos then
+	currentTimeNanos = lastTimeNanos
+end
+
 local nanosBetweenTokens = tonumber(ARGV[1])
 local requested = tonumber(ARGV[3])
 local maxWaitTime = tonumber(ARGV[4])
@@ -50,6 +121,34 @@ if currentTimeNanos > tokensNextAvailableNanos then
 	tokensNextAvailableNanos = currentTimeNanos
 end
 
+-- Numbers are formatted explicitly, since Redis otherwise converts them to strings with only 14
+-- significant digits, losing precision for large values such as byte counts or nanos.
+local function saveState()
+	local newEpochSeconds, shift = rebase(epochSeconds, currentTimeNanos, unitsPerSecond)
+	redis.call("HSET", KEYS[1],
+		"` + tokensNextAvblNanosField + `", string.format("%.0f", tokensNextAvailableNanos - shift),
+		"` + accumulatedTokensField + `", string.format("%.0f", math.floor(accumulatedTokens)),
+		"` + lastTimeNanosField + `", string.format("%.0f", currentTimeNanos - shift),
+		"` + epochSecondsField + `", string.format("%.0f", newEpochSeconds),
+		"` + unitNanosField + `", string.format("%.0f", unitNanos))
+	if lifespan > 0 then
+		redis.call("PEXPIRE", KEYS[1], lifespan)
+	else
+		redis.call("PERSIST", KEYS[1])
+	end
+end
+`
+
+// luaScript takes tokens from a bucket.
+var luaScript = `
+-- If the request carries an ID that has been seen recently, return the original result.
+if KEYS[2] then
+	local previousWaitTime = redis.call("GET", KEYS[2])
+	if previousWaitTime then
+		return tonumber(previousWaitTime)
+	end
+end
+` + luaBucketState + `
 local waitTime = tokensNextAvailableNanos - currentTimeNanos
 local accumulatedTokensUsed = math.min(accumulatedTokens, requested)
 local tokensToWaitFor = requested - accumulatedTokensUsed
@@ -61,26 +160,73 @@ accumulatedTokens = accumulatedTokens - accumulatedTokensUsed
 if (tokensNextAvailableNanos - currentTimeNanos > maxDebtNanos) or (waitTime > 0 and waitTime > maxWaitTime) then
 	waitTime = -1
 else
-	-- Redis doesn't allow non-deterministic functions unless we use replicating commands instead of scripts
-	redis.replicate_commands()
-	if lifespan > 0 then
-		redis.call("SET", KEYS[1], tokensNextAvailableNanos, "PX", lifespan)
-		redis.call("SET", KEYS[2], math.floor(accumulatedTokens), "PX", lifespan)
-	else
-		redis.call("SET", KEYS[1], tokensNextAvailableNanos)
-		redis.call("SET", KEYS[2], math.floor(accumulatedTokens))
-	end
+	saveState()
+end
+
+if KEYS[2] then
+	redis.call("SET", KEYS[2], string.format("%.0f", waitTime), "PX", tonumber(ARGV[9]))
 end
 
 return waitTime
 `
 
-// Suffixes for Redis keys
+// luaChargeScript unconditionally takes tokens from a bucket, or returns them if the number of
+// tokens requested is negative.
+var luaChargeScript = `
+` + luaBucketState + `
+if requested >= 0 then
+	-- Use accumulated tokens first, then go into debt for the rest.
+	local accumulatedTokensUsed = math.min(accumulatedTokens, requested)
+	accumulatedTokens = accumulatedTokens - accumulatedTokensUsed
+	tokensNextAvailableNanos = tokensNextAvailableNanos + (requested - accumulatedTokensUsed) * nanosBetweenTokens
+else
+	-- Pay back any debt first, then accumulate the rest.
+	local refund = -requested
+	local debtRepaidNanos = math.min(tokensNextAvailableNanos - currentTimeNanos, refund * nanosBetweenTokens)
+	tokensNextAvailableNanos = tokensNextAvailableNanos - debtRepaidNanos
+	local tokensRepaid = math.ceil(debtRepaidNanos / nanosBetweenTokens)
+	accumulatedTokens = math.min(maxTokensToAccumulate, accumulatedTokens + refund - tokensRepaid)
+end
+
+saveState()
+return 0
+`
+
+// luaForgiveDebtScript clears a bucket's debt, if any.
+var luaForgiveDebtScript = `
+` + luaBucketState + `
+if tokensNextAvailableNanos > currentTimeNanos then
+	tokensNextAvailableNanos = currentTimeNanos
+end
+
+saveState()
+return 0
+`
+
+// luaResetScript deletes a bucket's state, so that it is full again. A script, rather than a plain
+// DEL, so that it is retried and guarded by the circuit breaker like other calls.
+var luaResetScript = `
+redis.call("DEL", KEYS[1])
+return 0
+`
+
+// Fields of the Redis hash holding a bucket's state
 const (
-	tokensNextAvblNanosSuffix = "TNA"
-	accumulatedTokensSuffix   = "AT"
+	tokensNextAvblNanosField = "TNA"
+	accumulatedTokensField   = "AT"
+	lastTimeNanosField       = "LT"
+	// epochSecondsField holds the time, in seconds since the Unix epoch, that the other times are
+	// relative to.
+	epochSecondsField = "EP"
+	// unitNanosField holds the length, in nanos, of the time unit the other times are in.
+	unitNanosField = "TU"
 )
 
+const defaultIdempotencyTTL = time.Minute
+
+// idempotencyKeyInfix separates a bucket's key from a request ID in the keys recording requests.
+const idempotencyKeyInfix = ":req:"
+
 // defaultBucket is a "const"
 var defaultBucket = &quotaservice.DefaultBucket{}
 
@@ -109,7 +255,12 @@ type bucketFactory struct {
 	redisOpts        *redis.Options
 	redisClusterOpts *redis.ClusterOptions
 
-	script                    *redis.Script
+	script            *redis.Script
+	chargeScript      *redis.Script
+	takeAllScript     *redis.Script
+	forgiveDebtScript *redis.Script
+	resetScript       *redis.Script
+	// connectionRetries is the maximum number of attempts a single call to Take makes against Redis.
 	connectionRetries         int
 	connectionNeedsResolution bool
 	numTimesConnResolved      int // For testing and debugging purposes
@@ -117,6 +268,27 @@ type bucketFactory struct {
 	// keyMaxIdleTime will be set as the Redis key TTL unless it is overridden by the per bucket
 	// config MaxIdleMillis
 	keyMaxIdleTime time.Duration
+
+	// breaker guards calls to Redis, so a sick Redis isn't hammered with requests.
+	breaker *circuitBreaker
+
+	retries RetryConfig
+
+	timeSource TimeSource
+	timeUnit   TimeUnit
+
+	// idempotencyTTL is how long request IDs are remembered, to deduplicate retried requests.
+	idempotencyTTL time.Duration
+
+	// redisVersion is the version of Redis detected at startup.
+	redisVersion string
+
+	cleanup   CleanupConfig
+	keyLayout KeyLayout
+
+	// owns reports whether a bucket is held by this factory, if it is a shard of a sharded factory.
+	// Nil if the factory holds every bucket.
+	owns func(namespace, bucketName string) bool
 }
 
 // NewBucketFactory creates a new bucketFactory instance backed by a standalone Redis.
@@ -137,6 +309,11 @@ func NewBucketFactory(redisOpts *redis.Options, connectionRetries int, keyMaxIdl
 		connectionNeedsResolution: false,
 		numTimesConnResolved:      0,
 		keyMaxIdleTime:            keyMaxIdleTime,
+		breaker:                   newCircuitBreaker(NewDefaultBreakerConfig()),
+		retries:                   NewDefaultRetryConfig(),
+		idempotencyTTL:            defaultIdempotencyTTL,
+		cleanup:                   NewDefaultCleanupConfig(),
+		keyLayout:                 NewDefaultKeyLayout(),
 	}
 }
 
@@ -158,6 +335,11 @@ func NewClusterBucketFactory(redisClusterOpts *redis.ClusterOptions, connectionR
 		connectionNeedsResolution: false,
 		numTimesConnResolved:      0,
 		keyMaxIdleTime:            keyMaxIdleTime,
+		breaker:                   newCircuitBreaker(NewDefaultBreakerConfig()),
+		retries:                   NewDefaultRetryConfig(),
+		idempotencyTTL:            defaultIdempotencyTTL,
+		cleanup:                   NewDefaultCleanupConfig(),
+		keyLayout:                 NewDefaultKeyLayout(),
 	}
 }
 
@@ -177,19 +359,20 @@ func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
 	}
 
 	bf.script = redis.NewScript(luaScript)
+	bf.chargeScript = redis.NewScript(luaChargeScript)
+	bf.takeAllScript = redis.NewScript(luaTakeAllScript)
+	bf.forgiveDebtScript = redis.NewScript(luaForgiveDebtScript)
+	bf.resetScript = redis.NewScript(luaResetScript)
+
+	if bf.redisVersion == "" {
+		bf.checkCapabilitiesLocked()
+	}
 
 	logging.Printf("Initialized redis.BucketFactory in %v", time.Since(start))
 }
 
 func (bf *bucketFactory) connectToRedisLocked() {
-	// Set up connection to Redis
-	if bf.redisOpts != nil {
-		bf.client = redis.NewClient(bf.redisOpts)
-	} else if bf.redisClusterOpts != nil {
-		bf.client = redis.NewClusterClient(bf.redisClusterOpts)
-	} else {
-		logging.Fatal("Cannot connect to Redis because no connection options have been provided.")
-	}
+	bf.client = bf.newClient()
 
 	_, err := bf.client.Touch(context.TODO(), "areYouAlive?").Result()
 	if err != nil {
@@ -199,18 +382,37 @@ func (bf *bucketFactory) connectToRedisLocked() {
 	}
 }
 
-func (bf *bucketFactory) reconnectToRedis(oldClient redis.UniversalClient) {
-	bf.Lock()
-	defer bf.Unlock()
+// checkCapabilitiesLocked fails fast if Redis doesn't support the factory's scripts. If Redis can't
+// be reached, the check is skipped, and repeated on the next config change.
+func (bf *bucketFactory) checkCapabilitiesLocked() {
+	ctx, cancel := context.WithTimeout(context.Background(), capabilityCheckTimeout)
+	defer cancel()
 
-	// Always close connections on errors to prevent results leaking.
-	if err := bf.client.Close(); err != nil && !isRedisClientClosedError(err) {
-		logging.Printf("Received error on Redis client close: %+v", err)
+	if err := bf.client.Ping(ctx).Err(); err != nil {
+		logging.Printf("Cannot check Redis capabilities, since PING returned %v", err)
+		return
 	}
 
-	if oldClient == bf.client {
-		bf.connectToRedisLocked()
+	version, err := checkCapabilities(ctx, bf.client, bf.script, bf.chargeScript, bf.takeAllScript, bf.forgiveDebtScript,
+		bf.resetScript)
+	if err != nil {
+		logging.Fatalf("Unsupported Redis: %v", err)
 	}
+
+	logging.Printf("Detected Redis version %v", version)
+	bf.redisVersion = version
+}
+
+func (bf *bucketFactory) newClient() redis.UniversalClient {
+	// Set up connection to Redis
+	if bf.redisOpts != nil {
+		return redis.NewClient(bf.redisOpts)
+	} else if bf.redisClusterOpts != nil {
+		return redis.NewClusterClient(bf.redisClusterOpts)
+	}
+
+	logging.Fatal("Cannot connect to Redis because no connection options have been provided.")
+	return nil
 }
 
 func (bf *bucketFactory) handleConnectionFailure(oldClient redis.UniversalClient) {
@@ -220,54 +422,45 @@ func (bf *bucketFactory) handleConnectionFailure(oldClient redis.UniversalClient
 	if oldClient == bf.client && !bf.connectionNeedsResolution {
 		logging.Print("Attempting to establish new connection to redis")
 		bf.connectionNeedsResolution = true
-		go bf.establishNewConnectionToRedis(oldClient)
+		go bf.establishNewConnectionToRedis(bf.retries.Reconnect)
 	}
 }
 
-func (bf *bucketFactory) establishNewConnectionToRedis(oldClient redis.UniversalClient) {
-	client := oldClient
-	numsTried := 0
-	exponentialDelay := 1 * time.Second
-	exponentialDelayCeiling := 3 * time.Minute
-
-	for disconnected := true; disconnected; {
-		attemptsRemaining := bf.connectionRetries
-
-		for attemptsRemaining > 0 {
-			attemptsRemaining--
-			numsTried++
-			bf.reconnectToRedis(client)
-
-			client = bf.Client().(redis.UniversalClient)
-			_, err := client.Ping(context.TODO()).Result()
-			if err == nil {
-				disconnected = false
-				break
-			}
-			logging.Print("Unable to reconnect to redis. Will retry again in 1s.")
-			time.Sleep(1 * time.Second)
+// establishNewConnectionToRedis repeatedly attempts to connect to Redis, waiting between attempts as
+// determined by backoff. New clients are connected without holding the factory's mutex, so requests
+// aren't blocked while Redis is unavailable; the client is only swapped in once it responds.
+func (bf *bucketFactory) establishNewConnectionToRedis(backoff Backoff) {
+	var client redis.UniversalClient
+	attempt := 0
+	for ; ; attempt++ {
+		client = bf.newClient()
+		_, err := client.Ping(context.TODO()).Result()
+		if err == nil {
+			break
 		}
 
-		if disconnected {
-			logging.Printf("Attempted to reconnect %v times. Will sleep for %v seconds", bf.connectionRetries, exponentialDelay)
-			time.Sleep(exponentialDelay)
-			exponentialDelay *= 2
-
-			if exponentialDelay > exponentialDelayCeiling {
-				logging.Printf("Resetting exponential delay for sleep because it exceeds the ceiling value of %v seconds", exponentialDelayCeiling)
-				exponentialDelay = 1 * time.Second
-			}
+		// Always close connections on errors to prevent results leaking.
+		if err := client.Close(); err != nil && !isRedisClientClosedError(err) {
+			logging.Printf("Received error on Redis client close: %+v", err)
 		}
 
+		delay := backoff.Delay(attempt)
+		logging.Printf("Unable to reconnect to redis: %v. Will retry again in %v.", err, delay)
+		time.Sleep(delay)
 	}
 
-	logging.Printf("Established connection after attempting %v times", numsTried)
+	logging.Printf("Established connection after attempting %v times", attempt+1)
 	bf.Lock()
-	defer bf.Unlock()
+	oldClient := bf.client
+	bf.client = client
 	bf.connectionNeedsResolution = false
 	bf.numTimesConnResolved++
-	exponentialDelay = 1 * time.Second
 	logging.Printf("Handler has resolved %v connection(s) so far", bf.numTimesConnResolved)
+	bf.Unlock()
+
+	if err := oldClient.Close(); err != nil && !isRedisClientClosedError(err) {
+		logging.Printf("Received error on Redis client close: %+v", err)
+	}
 }
 
 func (bf *bucketFactory) getNumTimesConnResolved() int {
@@ -277,6 +470,20 @@ func (bf *bucketFactory) getNumTimesConnResolved() int {
 	return bf.numTimesConnResolved
 }
 
+func (bf *bucketFactory) requestBackoff() Backoff {
+	bf.Lock()
+	defer bf.Unlock()
+
+	return bf.retries.Request
+}
+
+func (bf *bucketFactory) circuitBreaker() *circuitBreaker {
+	bf.Lock()
+	defer bf.Unlock()
+
+	return bf.breaker
+}
+
 // Client returns a reference to the underlying client instance, implementing Client() on the quotaservice.BucketFactory
 // interface
 func (bf *bucketFactory) Client() interface{} {
@@ -290,14 +497,11 @@ func (bf *bucketFactory) Client() interface{} {
 // quotaservice.BucketFactory interface
 func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
 	idle := "0"
-	if cfg.MaxIdleMillis > 0 {
-		idle = strconv.FormatInt(int64(cfg.MaxIdleMillis), 10)
+	if cfg.GetMaxIdleMillis() > 0 {
+		idle = strconv.FormatInt(int64(cfg.GetMaxIdleMillis()), 10)
 	}
 
-	keys := []string{
-		toRedisKey(namespace, bucketName, tokensNextAvblNanosSuffix, bf.cfg.Version),
-		toRedisKey(namespace, bucketName, accumulatedTokensSuffix, bf.cfg.Version),
-	}
+	keys := []string{bf.keyLayout.bucketKey(namespace, bucketName, bf.cfg.Version)}
 
 	if dyn {
 		bf.Lock()
@@ -305,7 +509,7 @@ func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.B
 
 		attribs, exists := bf.sharedAttributes[namespace]
 		if !exists {
-			attribs = newConfigAttributes(cfg, idle, dyn)
+			attribs = newConfigAttributes(cfg, idle, dyn, bf.timeUnit)
 			bf.sharedAttributes[namespace] = attribs
 			bf.refcounts[namespace] = 0
 		}
@@ -323,7 +527,7 @@ func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.B
 		// Create a staticBucket with its own non-shared configAttributes
 		return &staticBucket{
 			abstractBucket: &abstractBucket{
-				configAttributes: newConfigAttributes(cfg, idle, dyn),
+				configAttributes: newConfigAttributes(cfg, idle, dyn, bf.timeUnit),
 				cfg:              cfg,
 				factory:          bf,
 				keys:             keys,
@@ -331,18 +535,54 @@ func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.B
 	}
 }
 
-func newConfigAttributes(cfg *pbconfig.BucketConfig, idle string, dyn bool) *configAttributes {
+func newConfigAttributes(cfg *pbconfig.BucketConfig, idle string, dyn bool, unit TimeUnit) *configAttributes {
+	// Buckets refill at most a token per unit.
+	between := unit.toUnits(config.NanosBetweenTokens(cfg))
+	if between == "0" {
+		between = "1"
+	}
+
 	return &configAttributes{
-		strconv.FormatInt(1e9/cfg.FillRate, 10),
-		strconv.FormatInt(cfg.Size, 10),
+		between,
+		strconv.FormatInt(cfg.GetSize(), 10),
 		idle,
-		// Convert millis to nanos
-		strconv.FormatInt(cfg.MaxDebtMillis*1e6, 10),
+		unit.toUnits(config.MaxDebtNanos(cfg)),
 		defaultBucket}
 }
 
-func toRedisKey(namespace, bucketName, suffix string, version int32) string {
-	return fmt.Sprintf("{%s:%s}:%s:%v", namespace, bucketName, suffix, version)
+// toIdempotencyKey returns the key recording the result of a request, in the same cluster slot as
+// the bucket's key.
+func toIdempotencyKey(bucketKey, requestID string) string {
+	return bucketKey + idempotencyKeyInfix + requestID
+}
+
+// SetIdempotencyTTL sets how long a Redis bucketFactory remembers request IDs, within which
+// retried requests return the original result rather than taking tokens again. It should be
+// called before the factory is used.
+func SetIdempotencyTTL(bf quotaservice.BucketFactory, ttl time.Duration) {
+	for _, f := range redisFactories(bf) {
+		f.Lock()
+		f.idempotencyTTL = ttl
+		f.Unlock()
+	}
+}
+
+// redisFactories returns the Redis bucketFactories behind a factory: the factory itself, or every
+// shard of a sharded factory. Panics if bf isn't a Redis bucket factory.
+func redisFactories(bf quotaservice.BucketFactory) []*bucketFactory {
+	switch f := bf.(type) {
+	case *bucketFactory:
+		return []*bucketFactory{f}
+	case *shardedBucketFactory:
+		factories := make([]*bucketFactory, len(f.shards))
+		for i, s := range f.shards {
+			factories[i] = s.factory
+		}
+
+		return factories
+	default:
+		panic(fmt.Sprintf("Not a Redis bucket factory: %T", bf))
+	}
 }
 
 const redisClientClosedError = "redis: client is closed"
@@ -6,11 +6,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/golang/protobuf/proto"
 
+	"github.com/square/quotaservice"
 	"github.com/square/quotaservice/buckets"
 	"github.com/square/quotaservice/config"
 	quotaservice_configs "github.com/square/quotaservice/protos/config"
@@ -34,7 +37,7 @@ func TestMain(m *testing.M) {
 func setUp() {
 	dynNs := config.NewDefaultNamespaceConfig("dynNs")
 	dynTpl := config.NewDefaultBucketConfig(config.DynamicBucketTemplateName)
-	dynTpl.MaxDebtMillis = dynMaxDebtMillis
+	dynTpl.MaxDebtMillis = proto.Int64(dynMaxDebtMillis)
 	config.SetDynamicBucketTemplate(dynNs, dynTpl)
 
 	cfg = config.NewDefaultServiceConfig()
@@ -102,10 +105,269 @@ func TestFailingRedisConn(t *testing.T) {
 	}
 }
 
+func TestRedisKey(t *testing.T) {
+	if k := NewDefaultKeyLayout().bucketKey("ns", "b", 3); k != "{ns:b}:3" {
+		t.Fatalf("Unexpected Redis key %v", k)
+	}
+
+	if len(bucket.keys) != 1 {
+		t.Fatalf("Expected a single Redis key per bucket, got %v", bucket.keys)
+	}
+}
+
+func TestTimeSources(t *testing.T) {
+	defer SetTimeSource(factory, TIME_SOURCE_REDIS)
+
+	for _, ts := range []TimeSource{TIME_SOURCE_REDIS_MONOTONIC, TIME_SOURCE_CLIENT} {
+		SetTimeSource(factory, ts)
+		b := factory.NewBucket("redis", "timeSource"+ts.String(), config.NewDefaultBucketConfig(""), false)
+		w, s, err := b.Take(context.Background(), 1, 0)
+		if err != nil {
+			t.Fatalf("Expected nil error with %v, got: %v", ts, err)
+		}
+		if w != 0 || !s {
+			t.Fatalf("Expected token to be granted immediately with %v. Was %v, %v", ts, w, s)
+		}
+	}
+}
+
+func TestIdempotentTake(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(1)
+	cfg.FillRate = proto.Int64(1)
+	b := factory.NewBucket("redis", "idempotent", cfg, false)
+	ctx := quotaservice.WithRequestID(context.Background(), "req1")
+
+	for i := 0; i < 3; i++ {
+		w, s, err := b.Take(ctx, 1, 0)
+		if err != nil {
+			t.Fatalf("Expected nil error, got: %v", err)
+		}
+		if w != 0 || !s {
+			t.Fatalf("Expected retries of a request to return the original grant. Was %v, %v", w, s)
+		}
+	}
+
+	// A different request should find the bucket empty.
+	_, s, err := b.Take(quotaservice.WithRequestID(context.Background(), "req2"), 1, 0)
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+	if s {
+		t.Fatal("Expected a new request to be rejected")
+	}
+}
+
 func TestTokenAcquisition(t *testing.T) {
 	buckets.TestTokenAcquisition(t, bucket)
 }
 
+func TestCharge(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	buckets.TestCharge(t, factory.NewBucket("redis", "charge", cfg, false))
+}
+
+func TestTokens(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	buckets.TestTokens(t, factory.NewBucket("redis", "tokens", cfg, false))
+}
+
+func TestForgiveDebt(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	buckets.TestForgiveDebt(t, factory.NewBucket("redis", "forgive", cfg, false))
+}
+
+func TestReset(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	buckets.TestReset(t, factory.NewBucket("redis", "reset", cfg, false))
+}
+
+func TestWarm(t *testing.T) {
+	b := factory.NewBucket("redis", "warm", config.NewDefaultBucketConfig(""), false)
+	if err := b.(quotaservice.BucketWarmer).Warm(context.Background()); err != nil {
+		t.Fatalf("Warm errored: %v", err)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	cfg.MaxDebtMillis = proto.Int64(10000)
+	buckets.TestStrict(t, factory.NewBucket("redis", "strict", cfg, false))
+}
+
+func TestTakeAll(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	cfg.MaxDebtMillis = proto.Int64(0)
+	buckets.TestTakeAll(t, factory, factory.NewBucket("redis", "takeall_a", cfg, false), factory.NewBucket("redis", "takeall_b", cfg, false))
+}
+
+func TestBlocked(t *testing.T) {
+	blocked := config.NewDefaultBucketConfig("")
+	blocked.FillRate = proto.Int64(0)
+	buckets.TestBlocked(t, factory, factory.NewBucket("redis", "open", config.NewDefaultBucketConfig(""), false), factory.NewBucket("redis", "blocked", blocked, false))
+}
+
+// takeAt runs the take script against b with the client's time set to nanos, returning the wait
+// time, or -1 if tokens were denied.
+func takeAt(t *testing.T, b quotaservice.Bucket, nanos int64, requested int64, maxWaitTime time.Duration) int64 {
+	a := b.(*staticBucket).abstractBucket
+	args := a.scriptArgs(requested, maxWaitTime)
+	args[6] = TIME_SOURCE_CLIENT.String()
+	args[7] = strconv.FormatInt(nanos, 10)
+
+	w, err := factory.script.Run(context.Background(), factory.client, a.keys, args...).Int64()
+	if err != nil {
+		t.Fatalf("Expected nil error at %v, got: %v", nanos, err)
+	}
+
+	return w
+}
+
+// Times beyond 2^53 nanos can't be represented exactly as the doubles Lua uses, so these check
+// that buckets neither grant tokens a nanosecond early nor drift, whenever they were created.
+func TestPreciseTime(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(1)
+	cfg.FillRate = proto.Int64(1000)
+	cfg.MaxDebtMillis = proto.Int64(0)
+
+	for _, start := range []int64{1 << 53, time.Now().UnixNano(), 9000000000123456789} {
+		b := factory.NewBucket("redis", "precise"+strconv.FormatInt(start, 10), cfg, false)
+		if w := takeAt(t, b, start, 1, 0); w != 0 {
+			t.Fatalf("Expected a token to be granted at %v, was %v", start, w)
+		}
+
+		for i := int64(1); i <= 100; i++ {
+			next := start + i*int64(time.Millisecond)
+			if w := takeAt(t, b, next-1, 1, 0); w != -1 {
+				t.Fatalf("Expected a token to be denied 1ns before %v, was %v", next, w)
+			}
+			if w := takeAt(t, b, next, 1, 0); w != 0 {
+				t.Fatalf("Expected a token to be granted at %v, was %v", next, w)
+			}
+		}
+	}
+}
+
+func TestPreciseWaitTime(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1000)
+	cfg.MaxDebtMillis = proto.Int64(1000)
+	b := factory.NewBucket("redis", "preciseWait", cfg, false)
+
+	start := int64(9000000000123456789)
+	takeAt(t, b, start, 10, 0)
+	// Goes into debt for a token, available 1ms later.
+	takeAt(t, b, start+1, 1, time.Second)
+	if w := takeAt(t, b, start+2, 1, time.Second); w != 999999 {
+		t.Fatalf("Expected to wait exactly 999999ns, was %v", w)
+	}
+}
+
+func TestStateWithoutEpoch(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(1)
+	cfg.FillRate = proto.Int64(1000)
+	b := factory.NewBucket("redis", "withoutEpoch", cfg, false)
+	key := b.(*staticBucket).keys[0]
+
+	// State saved before times were relative to an epoch.
+	start := time.Now().Truncate(time.Second).Add(500 * time.Millisecond).UnixNano()
+	if err := factory.client.HSet(context.Background(), key, tokensNextAvblNanosField, start,
+		accumulatedTokensField, 0, lastTimeNanosField, start).Err(); err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	// Nanos since the Unix epoch are rounded, so leave room for an extra token.
+	now := start + 2*int64(time.Millisecond)
+	if w := takeAt(t, b, now, 1, 0); w != 0 {
+		t.Fatalf("Expected a token to be granted, was %v", w)
+	}
+
+	vals, err := factory.client.HMGet(context.Background(), key, tokensNextAvblNanosField, epochSecondsField).Result()
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	tna, _ := strconv.ParseInt(vals[0].(string), 10, 64)
+	epoch, _ := strconv.ParseInt(vals[1].(string), 10, 64)
+	if tna < 0 || tna >= int64(time.Second) || epoch != now/int64(time.Second) {
+		t.Fatalf("Expected state to be rebased to the current second, got %v, %v", tna, epoch)
+	}
+}
+
+func TestTimeUnits(t *testing.T) {
+	defer SetTimeUnit(factory, TIME_UNIT_NANOS)
+
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(1)
+	cfg.FillRate = proto.Int64(10)
+	cfg.MaxDebtMillis = proto.Int64(0)
+	start := int64(9000000000123456789)
+
+	for _, u := range []TimeUnit{TIME_UNIT_MICROS, TIME_UNIT_MILLIS} {
+		SetTimeUnit(factory, u)
+		b := factory.NewBucket("redis", "timeUnit"+u.String(), cfg, false)
+		if w := takeAt(t, b, start, 1, 0); w != 0 {
+			t.Fatalf("Expected a token to be granted in %v, was %v", u, w)
+		}
+
+		next := start + 100*int64(time.Millisecond)
+		if w := takeAt(t, b, next-int64(u.Duration()), 1, 0); w != -1 {
+			t.Fatalf("Expected a token to be denied a unit early in %v, was %v", u, w)
+		}
+		if w := takeAt(t, b, next, 1, 0); w != 0 {
+			t.Fatalf("Expected a token to be granted in %v, was %v", u, w)
+		}
+
+		unitNanos, err := factory.client.HGet(context.Background(), b.(*staticBucket).keys[0], unitNanosField).Int64()
+		if err != nil || unitNanos != int64(u.Duration()) {
+			t.Fatalf("Expected state saved in %v, got %v, %v", u, unitNanos, err)
+		}
+	}
+}
+
+func TestChangeTimeUnit(t *testing.T) {
+	defer SetTimeUnit(factory, TIME_UNIT_NANOS)
+
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	cfg.MaxDebtMillis = proto.Int64(10000)
+	start := int64(9000000000123000000)
+
+	b := factory.NewBucket("redis", "changeTimeUnit", cfg, false)
+	takeAt(t, b, start, 10, 0)
+	// Goes into debt for a token, available a second later.
+	takeAt(t, b, start, 1, time.Second)
+
+	// The bucket is reconfigured, as it would be by a new factory.
+	SetTimeUnit(factory, TIME_UNIT_MILLIS)
+	b = factory.NewBucket("redis", "changeTimeUnit", cfg, false)
+	if w := takeAt(t, b, start+int64(500*time.Millisecond), 1, time.Minute); w != 500 {
+		t.Fatalf("Expected to wait 500ms for the debt, was %v", w)
+	}
+
+	// In debt for another second, for the token just taken.
+	vals, err := factory.client.HMGet(context.Background(), b.(*staticBucket).keys[0], tokensNextAvblNanosField, unitNanosField).Result()
+	if err != nil || vals[0] != "2123" || vals[1] != "1000000" {
+		t.Fatalf("Expected state to be converted to millis, got %v, %v", vals, err)
+	}
+}
+
 func TestGC(t *testing.T) {
 	buckets.TestGC(t, factory, "redis")
 }
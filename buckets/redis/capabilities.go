@@ -0,0 +1,152 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// MinRedisVersion is the oldest Redis version the bucket factory supports. The Lua scripts set
+// several hash fields with one HSET, and replicate script effects rather than scripts, both of
+// which require Redis 4.
+const MinRedisVersion = "4.0.0"
+
+// capabilityCheckTimeout bounds the capability check made when the factory is initialized.
+const capabilityCheckTimeout = 5 * time.Second
+
+// redisVersion is a parsed Redis version, e.g. [6 2 7].
+type redisVersion [3]int
+
+func parseRedisVersion(s string) (redisVersion, error) {
+	var v redisVersion
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) != 3 {
+		return v, errors.Errorf("invalid Redis version %q", s)
+	}
+
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, errors.Errorf("invalid Redis version %q", s)
+		}
+
+		v[i] = n
+	}
+
+	return v, nil
+}
+
+func (v redisVersion) less(o redisVersion) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] < o[i]
+		}
+	}
+
+	return false
+}
+
+// infoField returns a field of the output of the INFO command, or an empty string if it is missing.
+func infoField(info, field string) string {
+	for _, line := range strings.Split(info, "\n") {
+		if strings.HasPrefix(line, field+":") {
+			return strings.TrimSpace(strings.TrimPrefix(line, field+":"))
+		}
+	}
+
+	return ""
+}
+
+// checkNode checks that a Redis node is a supported version, and whether it runs in cluster mode
+// matches whether the factory expects a cluster. Returns the node's version.
+func checkNode(ctx context.Context, c *redis.Client, cluster bool) (string, error) {
+	info, err := c.Info(ctx, "server", "cluster").Result()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read Redis version")
+	}
+
+	version := infoField(info, "redis_version")
+	v, err := parseRedisVersion(version)
+	if err != nil {
+		return "", err
+	}
+
+	if min, _ := parseRedisVersion(MinRedisVersion); v.less(min) {
+		return "", errors.Errorf("Redis %v at %v is not supported; Redis %v or later is required", version, c.Options().Addr, MinRedisVersion)
+	}
+
+	if enabled := infoField(info, "cluster_enabled") == "1"; enabled != cluster {
+		if enabled {
+			return "", errors.Errorf("Redis at %v runs in cluster mode; use NewClusterBucketFactory", c.Options().Addr)
+		}
+
+		return "", errors.Errorf("Redis at %v doesn't run in cluster mode; use NewBucketFactory", c.Options().Addr)
+	}
+
+	return version, nil
+}
+
+// checkCapabilities checks that every Redis node, or every master of a cluster, supports the
+// bucket factory's scripts, and that the scripts load. Returns the lowest version found.
+func checkCapabilities(ctx context.Context, client redis.UniversalClient, scripts ...*redis.Script) (string, error) {
+	var version string
+	var lowest redisVersion
+
+	switch c := client.(type) {
+	case *redis.Client:
+		v, err := checkNode(ctx, c, false)
+		if err != nil {
+			return "", err
+		}
+
+		version = v
+	case *redis.ClusterClient:
+		var mu sync.Mutex
+		err := c.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			v, err := checkNode(ctx, node, true)
+			if err != nil {
+				return err
+			}
+
+			parsed, _ := parseRedisVersion(v)
+			mu.Lock()
+			defer mu.Unlock()
+			if version == "" || parsed.less(lowest) {
+				version, lowest = v, parsed
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", errors.Errorf("unsupported Redis client %T", client)
+	}
+
+	for _, s := range scripts {
+		if err := s.Load(ctx, client).Err(); err != nil {
+			return "", errors.Wrap(err, "cannot load Lua script")
+		}
+	}
+
+	return version, nil
+}
+
+// BackendVersion returns the version of Redis detected when the factory was initialized, or the
+// lowest version of the cluster's masters. Empty if it couldn't be detected.
+func (bf *bucketFactory) BackendVersion() string {
+	bf.Lock()
+	defer bf.Unlock()
+
+	return bf.redisVersion
+}
@@ -0,0 +1,58 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"testing"
+)
+
+func TestParseRedisVersion(t *testing.T) {
+	min, err := parseRedisVersion(MinRedisVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		version   string
+		supported bool
+	}{
+		{"3.2.12", false},
+		{"4.0.0", true},
+		{"4.0.14", true},
+		{"6.2.7", true},
+		{"10.0.0", true}}
+
+	for _, test := range tests {
+		v, err := parseRedisVersion(test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if supported := !v.less(min); supported != test.supported {
+			t.Errorf("Expected %v to be supported: %v", test.version, test.supported)
+		}
+	}
+
+	for _, invalid := range []string{"", "7", "7.x.1"} {
+		if _, err := parseRedisVersion(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestInfoField(t *testing.T) {
+	info := "# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n# Cluster\r\ncluster_enabled:0\r\n"
+
+	if v := infoField(info, "redis_version"); v != "7.2.4" {
+		t.Errorf("Expected 7.2.4, got %q", v)
+	}
+
+	if v := infoField(info, "cluster_enabled"); v != "0" {
+		t.Errorf("Expected 0, got %q", v)
+	}
+
+	if v := infoField(info, "redis_git_sha1"); v != "" {
+		t.Errorf("Expected no field, got %q", v)
+	}
+}
@@ -0,0 +1,232 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/logging"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// CleanupConfig configures the cleanup of stale buckets, i.e. the state of buckets that no longer
+// exist, or of earlier config versions.
+type CleanupConfig struct {
+	// BatchSize is the number of keys requested per SCAN, and deleted per round trip.
+	BatchSize int64
+	// MaxKeysPerSecond limits the rate at which each Redis node is scanned, to limit the load
+	// cleanup puts on Redis. Unlimited if 0.
+	MaxKeysPerSecond int
+	// MaxReportedKeys limits the number of stale keys listed in a cleanup's report.
+	MaxReportedKeys int
+	// AllowUnprefixed allows cleaning up when the KeyLayout has no prefix. Every key in Redis is then
+	// scanned, and keys of other applications sharing the Redis that happen to look like bucket
+	// keys would be deleted, so cleanup is refused unless this is set.
+	AllowUnprefixed bool
+}
+
+// NewDefaultCleanupConfig returns a config scanning up to 5000 keys per second, per node.
+func NewDefaultCleanupConfig() CleanupConfig {
+	return CleanupConfig{
+		BatchSize:        500,
+		MaxKeysPerSecond: 5000,
+		MaxReportedKeys:  1000}
+}
+
+// SetCleanupConfig configures how a Redis bucketFactory, or every shard of a sharded one, cleans up
+// stale buckets.
+func SetCleanupConfig(bf quotaservice.BucketFactory, cfg CleanupConfig) {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+
+	for _, f := range redisFactories(bf) {
+		f.Lock()
+		f.cleanup = cfg
+		f.Unlock()
+	}
+}
+
+// CleanStaleBuckets deletes the state of buckets that no longer exist in the current config, or of
+// earlier config versions, implementing quotaservice.StaleBucketCleaner. Keys are found with SCAN,
+// on every master of a cluster, in batches, at a limited rate. Only keys written by the bucket
+// factory, i.e. with its KeyLayout's prefix, are considered, along with keys of the legacy layout
+// that stored each bucket in two keys, which are always stale. Without a prefix, cleanup is refused
+// unless CleanupConfig.AllowUnprefixed is set. A shard of a sharded factory also deletes keys of
+// buckets held by other shards. In a dry run, stale keys are only reported.
+func (bf *bucketFactory) CleanStaleBuckets(ctx context.Context, dryRun bool) (*admin.CleanupReport, error) {
+	bf.Lock()
+	client, cfg, cleanup, layout, owns := bf.client, bf.cfg, bf.cleanup, bf.keyLayout, bf.owns
+	bf.Unlock()
+
+	if client == nil || cfg == nil {
+		return nil, errors.New("bucket factory not initialized")
+	}
+
+	if layout.Prefix == "" && !cleanup.AllowUnprefixed {
+		return nil, errors.New("refusing to clean up keys without a key prefix, which may belong to " +
+			"other applications; set a prefix with SetKeyLayout, or set CleanupConfig.AllowUnprefixed")
+	}
+
+	report := &admin.CleanupReport{DryRun: dryRun, Keys: []string{}}
+	var mu sync.Mutex
+	scans := []scan{{layout.scanPattern(), func(key string) bool {
+		return isLegacyBucketKey(key) || isStaleKey(cfg, layout, key) || isDisownedKey(layout, key, owns)
+	}}}
+
+	// Without a prefix, every key is already scanned.
+	if layout.Prefix != "" {
+		for _, pattern := range legacyScanPatterns() {
+			scans = append(scans, scan{pattern, isLegacyBucketKey})
+		}
+	}
+
+	clean := func(ctx context.Context, node redis.Cmdable) error {
+		for _, s := range scans {
+			if err := cleanNode(ctx, node, s, cleanup, dryRun, report, &mu); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var err error
+	if c, ok := client.(*redis.ClusterClient); ok {
+		err = c.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return clean(ctx, node)
+		})
+	} else {
+		err = clean(ctx, client)
+	}
+
+	logging.Printf("Stale bucket cleanup (dry run: %v) scanned %v keys, found %v stale, deleted %v",
+		dryRun, report.Scanned, report.Stale, report.Deleted)
+	return report, err
+}
+
+// scan finds stale keys among those matching a SCAN MATCH pattern.
+type scan struct {
+	pattern string
+	isStale func(key string) bool
+}
+
+// cleanNode scans a single Redis node for stale keys, and deletes them unless dryRun is set.
+func cleanNode(ctx context.Context, node redis.Cmdable, s scan, cleanup CleanupConfig, dryRun bool, report *admin.CleanupReport, mu *sync.Mutex) error {
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, s.pattern, cleanup.BatchSize).Result()
+		if err != nil {
+			return errors.Wrap(err, "cannot scan keys")
+		}
+
+		var stale []string
+		for _, k := range keys {
+			if s.isStale(k) {
+				stale = append(stale, k)
+			}
+		}
+
+		var deleted int64
+		if !dryRun && len(stale) > 0 {
+			// Keys are unlinked one by one, since keys on a cluster node may be in different slots.
+			pipe := node.Pipeline()
+			cmds := make([]*redis.IntCmd, len(stale))
+			for i, k := range stale {
+				cmds[i] = pipe.Unlink(ctx, k)
+			}
+
+			if _, err := pipe.Exec(ctx); err != nil {
+				return errors.Wrap(err, "cannot delete keys")
+			}
+
+			for _, cmd := range cmds {
+				deleted += cmd.Val()
+			}
+		}
+
+		mu.Lock()
+		report.Scanned += int64(len(keys))
+		report.Stale += int64(len(stale))
+		report.Deleted += deleted
+		for _, k := range stale {
+			if len(report.Keys) < cleanup.MaxReportedKeys {
+				report.Keys = append(report.Keys, k)
+			}
+		}
+		mu.Unlock()
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+
+		if cleanup.MaxKeysPerSecond > 0 && len(keys) > 0 {
+			select {
+			case <-time.After(time.Duration(len(keys)) * time.Second / time.Duration(cleanup.MaxKeysPerSecond)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// isStaleKey returns whether a key holds the state of a bucket that can no longer be used with the
+// given config. Keys of later config versions, which may have been written by servers that have
+// already applied a newer config, and keys that can't be parsed, are never stale.
+func isStaleKey(cfg *pbconfig.ServiceConfig, layout KeyLayout, key string) bool {
+	namespace, bucketName, version, ok := layout.parseBucketKey(key)
+	if !ok || version > cfg.Version {
+		return false
+	}
+
+	if version < cfg.Version {
+		return true
+	}
+
+	// A bucket tracking another's soft limit is stale if that bucket no longer has a soft limit.
+	baseName := strings.TrimSuffix(bucketName, quotaservice.SoftLimitBucketSuffix)
+	softLimit := baseName != bucketName
+
+	switch namespace {
+	case config.GlobalNamespace:
+		return isStaleBucket(cfg.GlobalDefaultBucket, softLimit)
+	case config.QuotaGroupNamespace:
+		return cfg.QuotaGroups[bucketName] == nil
+	}
+
+	ns, exists := cfg.Namespaces[namespace]
+	if !exists {
+		return true
+	}
+
+	if baseName == config.DefaultBucketName {
+		return isStaleBucket(ns.DefaultBucket, softLimit)
+	}
+
+	if b, exists := ns.Buckets[baseName]; exists {
+		return isStaleBucket(b, softLimit)
+	}
+
+	// Any other bucket may be a dynamic bucket.
+	return isStaleBucket(ns.DynamicBucketTemplate, softLimit)
+}
+
+// isStaleBucket returns whether the state of a bucket configured by cfg, or of the bucket tracking
+// its soft limit if softLimit is set, is stale. Members of quota groups have no soft limit.
+func isStaleBucket(cfg *pbconfig.BucketConfig, softLimit bool) bool {
+	if cfg == nil {
+		return true
+	}
+
+	return softLimit && (cfg.GetSoftLimitPercent() <= 0 || cfg.QuotaGroup != "")
+}
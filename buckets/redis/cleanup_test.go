@@ -0,0 +1,89 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/square/quotaservice/config"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+func TestIsStaleKey(t *testing.T) {
+	l := NewDefaultKeyLayout()
+	cfg := config.NewDefaultServiceConfig()
+	cfg.Version = 2
+	cfg.GlobalDefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
+	cfg.QuotaGroups = map[string]*pbconfig.BucketConfig{"group": config.NewDefaultBucketConfig("group")}
+
+	static := config.NewDefaultNamespaceConfig("static")
+	config.AddBucket(static, config.NewDefaultBucketConfig("b"))
+	softLimited := config.NewDefaultBucketConfig("soft")
+	softLimited.SoftLimitPercent = proto.Int64(80)
+	config.AddBucket(static, softLimited)
+	config.AddNamespace(cfg, static)
+
+	dyn := config.NewDefaultNamespaceConfig("dyn")
+	config.SetDynamicBucketTemplate(dyn, config.NewDefaultBucketConfig(""))
+	config.AddNamespace(cfg, dyn)
+
+	for key, stale := range map[string]bool{
+		l.bucketKey("static", "b", 2):                                    false,
+		l.bucketKey("static", "b", 1):                                    true,
+		l.bucketKey("static", "b", 3):                                    false,
+		l.bucketKey("static", "removed", 2):                              true,
+		l.bucketKey("static", config.DefaultBucketName, 2):               true,
+		l.bucketKey("dyn", "anything", 2):                                false,
+		l.bucketKey("removed", "b", 2):                                   true,
+		l.bucketKey(config.GlobalNamespace, config.DefaultBucketName, 2): false,
+		l.bucketKey(config.QuotaGroupNamespace, "group", 2):              false,
+		l.bucketKey(config.QuotaGroupNamespace, "removed", 2):            true,
+		l.bucketKey("static", "b", 1) + ":req:id":                        false,
+		l.bucketKey("static", "soft#soft_limit", 2):                      false,
+		l.bucketKey("static", "soft#soft_limit", 1):                      true,
+		l.bucketKey("static", "b#soft_limit", 2):                         true,
+		l.bucketKey("static", "removed#soft_limit", 2):                   true,
+		l.bucketKey("dyn", "anything#soft_limit", 2):                     true,
+	} {
+		if isStaleKey(cfg, l, key) != stale {
+			t.Errorf("Expected %v to be stale: %v", key, stale)
+		}
+	}
+}
+
+func TestLegacyBucketKeys(t *testing.T) {
+	for key, legacy := range map[string]bool{
+		"{ns:b}:TNA:2": true,
+		"{ns:b}:AT:2":  true,
+		"{ns:b}:2":     false,
+		"{ns:b}:TNA:x": false,
+		"{nsb}:AT:2":   false,
+		"{ns:b}:ATX:2": false,
+		NewDefaultKeyLayout().bucketKey("ns", "b", 2): false,
+	} {
+		if isLegacyBucketKey(key) != legacy {
+			t.Errorf("Expected %v to be a legacy key: %v", key, legacy)
+		}
+	}
+
+	if p := legacyScanPatterns(); len(p) != 2 || p[0] != "{*}:TNA:*" || p[1] != "{*}:AT:*" {
+		t.Errorf("Unexpected legacy patterns %v", p)
+	}
+}
+
+func TestCleanupRefusedWithoutPrefix(t *testing.T) {
+	bf := NewBucketFactory(&redis.Options{Addr: "localhost:0"}, 1, 0).(*bucketFactory)
+	// Initialized without connecting, since the cleanup is refused before any keys are scanned.
+	bf.client = redis.NewClient(bf.redisOpts)
+	defer bf.client.Close()
+	bf.cfg = config.NewDefaultServiceConfig()
+
+	if _, err := bf.CleanStaleBuckets(context.Background(), true); err == nil {
+		t.Fatal("Expected cleanup without a key prefix to be refused")
+	}
+}
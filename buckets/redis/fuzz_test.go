@@ -0,0 +1,54 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+//go:build go1.18
+// +build go1.18
+
+package redis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// FuzzScriptArgs checks that the arguments passed to the Lua scripts are integers the scripts can
+// use for any bucket config, including ones with zero fill rates and extreme or negative values,
+// which would otherwise divide by zero or overflow.
+func FuzzScriptArgs(f *testing.F) {
+	f.Add(int64(100), int64(50), int64(10000), int64(1), int64(0))
+	f.Add(int64(0), int64(0), int64(0), int64(0), int64(0))
+	f.Add(int64(-1), int64(-1), int64(-1), int64(-1), int64(-1))
+	f.Add(int64(1<<53), int64(1e9), int64(1<<62), int64(1<<53), int64(1<<62))
+	f.Add(int64(1), int64(1e10), int64(9223372036854775807), int64(9223372036854775807), int64(9223372036854775807))
+
+	f.Fuzz(func(t *testing.T, size, fillRate, maxDebtMillis, requested int64, maxWaitNanos int64) {
+		cfg := &pbconfig.BucketConfig{Size: proto.Int64(size), FillRate: proto.Int64(fillRate), MaxDebtMillis: proto.Int64(maxDebtMillis)}
+		for _, unit := range []TimeUnit{TIME_UNIT_NANOS, TIME_UNIT_MICROS, TIME_UNIT_MILLIS} {
+			b := &abstractBucket{configAttributes: newConfigAttributes(cfg, "0", false, unit), cfg: cfg, factory: factory}
+
+			args := b.scriptArgs(requested, time.Duration(maxWaitNanos))
+			for i, arg := range args {
+				s, ok := arg.(string)
+				if !ok {
+					t.Fatalf("Expected argument %v to be a string, got %T", i, arg)
+				}
+
+				if _, err := strconv.ParseInt(s, 10, 64); err != nil && i != 6 {
+					t.Fatalf("Expected argument %v to be an integer, got %q", i, s)
+				}
+			}
+
+			if n, _ := strconv.ParseInt(b.nanosBetweenTokens, 10, 64); n <= 0 {
+				t.Fatalf("Expected a positive interval between tokens for fill rate %v in %v, got %v", fillRate, unit, n)
+			}
+
+			if n, _ := strconv.ParseInt(b.maxDebtNanos, 10, 64); n < 0 {
+				t.Fatalf("Expected a non-negative max debt for %v millis in %v, got %v", maxDebtMillis, unit, n)
+			}
+		}
+	})
+}
@@ -0,0 +1,211 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+)
+
+// HashTag determines which part of a bucket's key is its Redis Cluster hash tag, and so which
+// buckets share a cluster slot.
+type HashTag int
+
+const (
+	// Each bucket is hashed to its own slot: <prefix>{<namespace>:<bucket>}:<version>. Spreads
+	// buckets most evenly across a cluster.
+	HASH_TAG_BUCKET HashTag = iota
+	// All buckets in a namespace share a slot: <prefix>{<namespace>}:<bucket>:<version>.
+	HASH_TAG_NAMESPACE
+	// All buckets share the slot of the hash tag in the prefix, e.g. "qs:{env}:", which is
+	// required: <prefix><namespace>:<bucket>:<version>.
+	HASH_TAG_PREFIX
+)
+
+var hashTagNames = []string{
+	HASH_TAG_BUCKET:    "HASH_TAG_BUCKET",
+	HASH_TAG_NAMESPACE: "HASH_TAG_NAMESPACE",
+	HASH_TAG_PREFIX:    "HASH_TAG_PREFIX",
+}
+
+func (h HashTag) String() string {
+	return hashTagNames[h]
+}
+
+// KeyLayout determines the names of the keys a Redis bucketFactory writes.
+type KeyLayout struct {
+	// Prefix prefixes every key, e.g. "qs:staging:", so that several environments can share a
+	// Redis without their keys colliding. Only keys with the prefix are ever cleaned up. Empty by
+	// default, as keys were before prefixes could be set.
+	Prefix  string
+	HashTag HashTag
+}
+
+// NewDefaultKeyLayout returns a layout without a prefix, hashing each bucket to its own slot, which
+// keeps the keys bucket state was stored under before layouts could be configured.
+func NewDefaultKeyLayout() KeyLayout {
+	return KeyLayout{HashTag: HASH_TAG_BUCKET}
+}
+
+// Validate checks that every bucket's keys, including those recording request IDs, hash to the
+// same cluster slot.
+func (l KeyLayout) Validate() error {
+	switch l.HashTag {
+	case HASH_TAG_BUCKET, HASH_TAG_NAMESPACE:
+		// Redis only considers the first "{" of a key, so a brace in the prefix would stop the
+		// bucket's hash tag from being used.
+		if strings.ContainsAny(l.Prefix, "{}") {
+			return errors.Errorf("prefix %q may not contain braces with %v", l.Prefix, l.HashTag)
+		}
+	case HASH_TAG_PREFIX:
+		if !hasHashTag(l.Prefix) {
+			return errors.Errorf("prefix %q must contain a hash tag, e.g. \"qs:{env}:\", with %v", l.Prefix, l.HashTag)
+		}
+	default:
+		return errors.Errorf("unknown hash tag %v", int(l.HashTag))
+	}
+
+	return nil
+}
+
+// hasHashTag returns whether s contains a non-empty hash tag, as defined by Redis Cluster.
+func hasHashTag(s string) bool {
+	start := strings.Index(s, "{")
+	if start < 0 {
+		return false
+	}
+
+	end := strings.Index(s[start+1:], "}")
+	return end > 0
+}
+
+// bucketKey returns the key holding a bucket's state.
+func (l KeyLayout) bucketKey(namespace, bucketName string, version int32) string {
+	switch l.HashTag {
+	case HASH_TAG_NAMESPACE:
+		return fmt.Sprintf("%s{%s}:%s:%v", l.Prefix, namespace, bucketName, version)
+	case HASH_TAG_PREFIX:
+		return fmt.Sprintf("%s%s:%s:%v", l.Prefix, namespace, bucketName, version)
+	default:
+		return fmt.Sprintf("%s{%s:%s}:%v", l.Prefix, namespace, bucketName, version)
+	}
+}
+
+// parseBucketKey parses a key returned by bucketKey. Returns false for other keys, such as those
+// recording request IDs.
+func (l KeyLayout) parseBucketKey(key string) (namespace, bucketName string, version int32, ok bool) {
+	if !strings.HasPrefix(key, l.Prefix) || strings.Contains(key, idempotencyKeyInfix) {
+		return
+	}
+
+	rest := key[len(l.Prefix):]
+	switch l.HashTag {
+	case HASH_TAG_BUCKET:
+		if !strings.HasPrefix(rest, "{") {
+			return
+		}
+
+		// {namespace:bucket}:version
+		end := strings.Index(rest, "}:")
+		if end < 0 {
+			return
+		}
+
+		rest = rest[1:end] + rest[end+1:]
+	case HASH_TAG_NAMESPACE:
+		if !strings.HasPrefix(rest, "{") {
+			return
+		}
+
+		// {namespace}:bucket:version
+		end := strings.Index(rest, "}:")
+		if end < 0 {
+			return
+		}
+
+		rest = rest[1:end] + rest[end+1:]
+	}
+
+	// namespace:bucket:version
+	i := strings.Index(rest, ":")
+	j := strings.LastIndex(rest, ":")
+	if i < 0 || i == j {
+		return
+	}
+
+	v, err := strconv.ParseInt(rest[j+1:], 10, 32)
+	if err != nil {
+		return
+	}
+
+	return rest[:i], rest[i+1 : j], int32(v), true
+}
+
+// legacyKeyFields name the two keys each bucket's state was stored in before it was stored in a
+// single hash: {<namespace>:<bucket>}:TNA:<version> and {<namespace>:<bucket>}:AT:<version>.
+var legacyKeyFields = []string{tokensNextAvblNanosField, accumulatedTokensField}
+
+// legacyScanPatterns returns SCAN MATCH patterns matching keys of the legacy two-key layout.
+func legacyScanPatterns() []string {
+	patterns := make([]string, len(legacyKeyFields))
+	for i, f := range legacyKeyFields {
+		patterns[i] = "{*}:" + f + ":*"
+	}
+
+	return patterns
+}
+
+// isLegacyBucketKey returns whether a key holds half of a bucket's state in the legacy two-key
+// layout, which is never read since bucket state moved to a single hash.
+func isLegacyBucketKey(key string) bool {
+	end := strings.Index(key, "}:")
+	if !strings.HasPrefix(key, "{") || end < 0 || !strings.Contains(key[1:end], ":") {
+		return false
+	}
+
+	rest := key[end+2:]
+	for _, f := range legacyKeyFields {
+		if strings.HasPrefix(rest, f+":") {
+			_, err := strconv.ParseInt(rest[len(f)+1:], 10, 32)
+			return err == nil
+		}
+	}
+
+	return false
+}
+
+// scanPattern returns a SCAN MATCH pattern matching all keys with the layout's prefix.
+func (l KeyLayout) scanPattern() string {
+	var b strings.Builder
+	for _, r := range l.Prefix {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	b.WriteString("*")
+	return b.String()
+}
+
+// SetKeyLayout sets the KeyLayout used by a Redis bucketFactory, or by every shard of a sharded
+// one, panicking if it isn't valid. It should be called before the factory is used, since buckets
+// created with a different layout are orphaned.
+func SetKeyLayout(bf quotaservice.BucketFactory, layout KeyLayout) {
+	factories := redisFactories(bf)
+
+	if err := layout.Validate(); err != nil {
+		panic(fmt.Sprintf("Invalid key layout: %v", err))
+	}
+
+	for _, f := range factories {
+		f.Lock()
+		f.keyLayout = layout
+		f.Unlock()
+	}
+}
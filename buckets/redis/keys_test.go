@@ -0,0 +1,78 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"testing"
+
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestKeyLayouts(t *testing.T) {
+	for _, tc := range []struct {
+		layout KeyLayout
+		key    string
+	}{
+		{NewDefaultKeyLayout(), "{ns:b}:3"},
+		{KeyLayout{"quotaservice:", HASH_TAG_BUCKET}, "quotaservice:{ns:b}:3"},
+		{KeyLayout{"qs:staging:", HASH_TAG_NAMESPACE}, "qs:staging:{ns}:b:3"},
+		{KeyLayout{"qs:{staging}:", HASH_TAG_PREFIX}, "qs:{staging}:ns:b:3"},
+	} {
+		if err := tc.layout.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		key := tc.layout.bucketKey("ns", "b", 3)
+		if key != tc.key {
+			t.Errorf("Expected key %v with %v, got %v", tc.key, tc.layout.HashTag, key)
+		}
+
+		ns, b, v, ok := tc.layout.parseBucketKey(key)
+		if !ok || ns != "ns" || b != "b" || v != 3 {
+			t.Errorf("Unexpected parse of %v: %v %v %v %v", key, ns, b, v, ok)
+		}
+
+		if _, _, _, ok := tc.layout.parseBucketKey(toIdempotencyKey(key, "42")); ok {
+			t.Errorf("Expected request ID key of %v not to parse", key)
+		}
+	}
+}
+
+func TestParseBucketKeyRejectsOtherKeys(t *testing.T) {
+	l := KeyLayout{"quotaservice:", HASH_TAG_BUCKET}
+	for _, k := range []string{
+		"{ns:b}:3",
+		"other:{ns:b}:3",
+		l.Prefix + "{nsb}:3",
+		l.Prefix + "{ns:b}:x",
+		l.Prefix + "other"} {
+		if _, _, _, ok := l.parseBucketKey(k); ok {
+			t.Errorf("Expected %v not to parse", k)
+		}
+	}
+}
+
+func TestInvalidKeyLayouts(t *testing.T) {
+	for _, l := range []KeyLayout{
+		{"qs:{env}:", HASH_TAG_BUCKET},
+		{"qs:{env}:", HASH_TAG_NAMESPACE},
+		{"qs:env:", HASH_TAG_PREFIX},
+		{"qs:{}:", HASH_TAG_PREFIX},
+		{"qs:", HashTag(10)},
+	} {
+		if l.Validate() == nil {
+			t.Errorf("Expected %+v to be invalid", l)
+		}
+	}
+
+	helpers.ExpectingPanic(t, func() {
+		SetKeyLayout(factory, KeyLayout{"qs:env:", HASH_TAG_PREFIX})
+	})
+}
+
+func TestScanPattern(t *testing.T) {
+	if p := (KeyLayout{Prefix: `qs:[a]*?\:`}).scanPattern(); p != `qs:\[a\]\*\?\\:*` {
+		t.Errorf("Unexpected pattern %v", p)
+	}
+}
@@ -0,0 +1,222 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+)
+
+// luaTakeAllScript takes tokens from several buckets, or from none of them. KEYS are the buckets'
+// keys. ARGV holds the time source, the client's time, the maximum wait time and the length of the
+// time unit, followed by the time between tokens, the maximum tokens to accumulate, the tokens requested, the lifespan and
+// the maximum debt of each bucket. Returns the longest wait time, or -1 if any bucket can't grant
+// its tokens.
+var luaTakeAllScript = luaTime + `
+local timeSource = ARGV[1]
+local maxWaitTime = tonumber(ARGV[3])
+local unitNanos = tonumber(ARGV[4])
+local unitsPerSecond = 1e+9 / unitNanos
+local currentSeconds, currentUnits = currentTime(timeSource, ARGV[2], unitNanos)
+
+local states = {}
+local longestWaitTime = 0
+
+for i, key in ipairs(KEYS) do
+	local arg = 4 + (i - 1) * 5
+	local nanosBetweenTokens = tonumber(ARGV[arg + 1])
+	local maxTokensToAccumulate = tonumber(ARGV[arg + 2])
+	local requested = tonumber(ARGV[arg + 3])
+	local lifespan = tonumber(ARGV[arg + 4])
+	local maxDebtNanos = tonumber(ARGV[arg + 5])
+
+	local state = redis.call("HMGET", key, "` + tokensNextAvblNanosField + `", "` + accumulatedTokensField + `",
+		"` + lastTimeNanosField + `", "` + epochSecondsField + `", "` + unitNanosField + `")
+
+	-- New buckets start at the current second. State saved without an epoch holds nanos since the
+	-- Unix epoch, and is rebased when it is saved.
+	local epochSeconds = tonumber(state[4])
+	if not state[1] then
+		epochSeconds = currentSeconds
+	elseif not epochSeconds then
+		epochSeconds = 0
+	end
+
+	-- State saved without a time unit is in nanos. State saved in another unit is converted,
+	-- rounding so that tokens are never made available earlier.
+	local savedUnitNanos = tonumber(state[5])
+	if not savedUnitNanos then
+		savedUnitNanos = 1
+	end
+
+	local tokensNextAvailableNanos = convert(tonumber(state[1]), savedUnitNanos, unitNanos, math.ceil)
+	if not tokensNextAvailableNanos then
+		tokensNextAvailableNanos = 0
+	end
+
+	local accumulatedTokens = tonumber(state[2])
+	if not accumulatedTokens then
+		accumulatedTokens = maxTokensToAccumulate
+	end
+
+	local currentTimeNanos = (currentSeconds - epochSeconds) * unitsPerSecond + currentUnits
+
+	-- Never let time go backwards, e.g. after failing over to a replica with a skewed clock.
+	local lastTimeNanos = convert(tonumber(state[3]), savedUnitNanos, unitNanos, math.floor)
+	if timeSource == "` + TIME_SOURCE_REDIS_MONOTONIC.String() + `" and lastTimeNanos and currentTimeNanos < lastTimeNanos then
+		currentTimeNanos = lastTimeNanos
+	end
+
+	if currentTimeNanos > tokensNextAvailableNanos then
+		local freshTokens = math.floor((currentTimeNanos - tokensNextAvailableNanos) / nanosBetweenTokens)
+		accumulatedTokens = math.min(maxTokensToAccumulate, accumulatedTokens + freshTokens)
+		tokensNextAvailableNanos = currentTimeNanos
+	end
+
+	local waitTime = tokensNextAvailableNanos - currentTimeNanos
+	local accumulatedTokensUsed = math.min(accumulatedTokens, requested)
+	tokensNextAvailableNanos = tokensNextAvailableNanos + (requested - accumulatedTokensUsed) * nanosBetweenTokens
+	accumulatedTokens = accumulatedTokens - accumulatedTokensUsed
+
+	-- Nothing has been written yet, so there is nothing to undo.
+	if (tokensNextAvailableNanos - currentTimeNanos > maxDebtNanos) or (waitTime > 0 and waitTime > maxWaitTime) then
+		return -1
+	end
+
+	if waitTime > longestWaitTime then
+		longestWaitTime = waitTime
+	end
+
+	local newEpochSeconds, shift = rebase(epochSeconds, currentTimeNanos, unitsPerSecond)
+	states[i] = {tokensNextAvailableNanos - shift, accumulatedTokens, currentTimeNanos - shift, newEpochSeconds, lifespan}
+end
+
+for i, key in ipairs(KEYS) do
+	local state = states[i]
+	redis.call("HSET", key,
+		"` + tokensNextAvblNanosField + `", string.format("%.0f", state[1]),
+		"` + accumulatedTokensField + `", string.format("%.0f", math.floor(state[2])),
+		"` + lastTimeNanosField + `", string.format("%.0f", state[3]),
+		"` + epochSecondsField + `", string.format("%.0f", state[4]),
+		"` + unitNanosField + `", string.format("%.0f", unitNanos))
+	if state[5] > 0 then
+		redis.call("PEXPIRE", key, state[5])
+	else
+		redis.call("PERSIST", key)
+	end
+end
+
+return longestWaitTime
+`
+
+var _ quotaservice.MultiBucketTaker = (*bucketFactory)(nil)
+
+// TakeAll implements quotaservice.MultiBucketTaker, taking tokens from every bucket in a single
+// script. With Redis Cluster, every bucket's key must hash to the same slot, so buckets must be in
+// the same namespace with HASH_TAG_NAMESPACE, or any namespace with HASH_TAG_PREFIX.
+func (bf *bucketFactory) TakeAll(ctx context.Context, takes []quotaservice.BucketTake, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	if len(takes) == 0 {
+		return 0, true, nil
+	}
+
+	requested := make(map[*abstractBucket]int64, len(takes))
+	for _, t := range takes {
+		a, err := toAbstractBucket(t.Bucket)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if config.Blocked(a.cfg) {
+			return 0, false, nil
+		}
+
+		requested[a] += t.Tokens
+	}
+
+	// Order keys consistently, so the script sees the same keys for the same buckets.
+	bkts := make([]*abstractBucket, 0, len(requested))
+	for a := range requested {
+		bkts = append(bkts, a)
+	}
+	sort.Slice(bkts, func(i, j int) bool { return bkts[i].keys[0] < bkts[j].keys[0] })
+
+	maxWaitTime, beforeDeadline := quotaservice.MaxWaitWithinDeadline(ctx, maxWaitTime)
+	if !beforeDeadline {
+		return 0, false, nil
+	}
+
+	keys := make([]string, len(bkts))
+	args := []interface{}{bf.timeSource.String(), strconv.FormatInt(time.Now().UnixNano(), 10),
+		bf.timeUnit.toUnits(maxWaitTime.Nanoseconds()), strconv.FormatInt(int64(bf.timeUnit.Duration()), 10)}
+	for i, a := range bkts {
+		maxDebtNanos := a.maxDebtNanos
+		if quotaservice.StrictFromContext(ctx) {
+			maxDebtNanos = "0"
+		}
+
+		keys[i] = a.keys[0]
+		args = append(args, a.nanosBetweenTokens, a.maxTokensToAccumulate,
+			strconv.FormatInt(requested[a], 10), a.lifespanMillis(), maxDebtNanos)
+	}
+
+	if bf.redisClusterOpts != nil {
+		for _, k := range keys[1:] {
+			if clusterHashTag(k) != clusterHashTag(keys[0]) {
+				return 0, false, errors.Errorf("keys %v and %v may be in different cluster slots; "+
+					"use HASH_TAG_NAMESPACE or HASH_TAG_PREFIX to take from several buckets at once", keys[0], k)
+			}
+		}
+	}
+
+	res, err := bkts[0].runWithRetries(ctx, bf.takeAllScript, keys, args, "take tokens from")
+	if err != nil {
+		return 0, false, err
+	}
+
+	val, ok := res.Val().(int64)
+	if !ok {
+		return 0, false, errors.Errorf("unknown response of type %[1]T: %[1]v", res.Val())
+	}
+
+	if val < 0 {
+		// Timed out
+		return 0, false, nil
+	}
+
+	return bf.timeUnit.Duration() * time.Duration(val), true, nil
+}
+
+// toAbstractBucket returns the abstractBucket underlying a bucket created by a bucketFactory.
+func toAbstractBucket(b quotaservice.Bucket) (*abstractBucket, error) {
+	switch t := b.(type) {
+	case *staticBucket:
+		return t.abstractBucket, nil
+	case *dynamicBucket:
+		return t.abstractBucket, nil
+	default:
+		return nil, errors.Errorf("not a Redis bucket: %T", b)
+	}
+}
+
+// clusterHashTag returns the part of a key Redis Cluster hashes to find its slot.
+func clusterHashTag(key string) string {
+	start := strings.Index(key, "{")
+	if start < 0 {
+		return key
+	}
+
+	end := strings.Index(key[start+1:], "}")
+	if end <= 0 {
+		return key
+	}
+
+	return key[start+1 : start+1+end]
+}
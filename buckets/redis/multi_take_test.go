@@ -0,0 +1,24 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"testing"
+)
+
+func TestClusterHashTag(t *testing.T) {
+	for _, tc := range []struct {
+		key, tag string
+	}{
+		{"quotaservice:{ns:b}:3", "ns:b"},
+		{"qs:staging:{ns}:b:3", "ns"},
+		{"qs:{staging}:ns:b:3", "staging"},
+		{"qs:{}:ns:b:3", "qs:{}:ns:b:3"},
+		{"qs:ns:b:3", "qs:ns:b:3"},
+	} {
+		if tag := clusterHashTag(tc.key); tag != tc.tag {
+			t.Errorf("Expected hash tag %q for %v, got %q", tc.tag, tc.key, tag)
+		}
+	}
+}
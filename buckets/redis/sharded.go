@@ -0,0 +1,272 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/logging"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// shardReplicas is the number of points each shard has on the hash ring. More points spread buckets
+// more evenly across shards.
+const shardReplicas = 160
+
+// Shard is a standalone Redis instance holding a share of a sharded factory's buckets.
+type Shard struct {
+	// Name places the shard on the hash ring, so buckets stay on the same shard if its address
+	// changes, or shards are listed in another order. Defaults to the shard's address.
+	Name    string
+	Options *redis.Options
+}
+
+// ShardStatus reports the health of a shard of a sharded factory.
+type ShardStatus struct {
+	Name    string
+	Addr    string
+	Breaker BreakerState
+}
+
+type shard struct {
+	name    string
+	factory *bucketFactory
+}
+
+// ringPoint is a point on the hash ring, owned by the shard at index shard.
+type ringPoint struct {
+	hash  uint32
+	shard int
+}
+
+// shardedBucketFactory distributes buckets across several standalone Redis instances by consistent
+// hashing of their namespace and name. Each shard is a bucketFactory of its own, with its own
+// connections and circuit breaker, so a shard that is unavailable only fails the buckets it holds.
+type shardedBucketFactory struct {
+	shards []*shard
+	ring   []ringPoint
+}
+
+// NewShardedBucketFactory creates a bucket factory backed by several standalone Redis instances,
+// each holding a share of the buckets, to scale beyond the throughput of a single instance.
+// Buckets are placed on shards by consistent hashing of <namespace>:<bucket>, so adding or removing
+// a shard only moves the buckets on its share of the ring. Keys are named as they are by a factory
+// backed by a single Redis, without reference to the shard holding them, so a bucket that moves
+// starts full on its new shard, and its state on the old shard is deleted by stale bucket cleanup
+// rather than picked up again if it moves back.
+func NewShardedBucketFactory(shards []Shard, connectionRetries int, keyMaxIdleTime time.Duration) quotaservice.BucketFactory {
+	if len(shards) == 0 {
+		logging.Fatal("Cannot create a sharded Redis bucket factory without shards.")
+	}
+
+	sf := &shardedBucketFactory{}
+	names := make(map[string]bool, len(shards))
+	for i, s := range shards {
+		name := s.Name
+		if name == "" {
+			name = s.Options.Addr
+		}
+
+		if names[name] {
+			logging.Fatalf("Redis shard %v is listed more than once.", name)
+		}
+		names[name] = true
+
+		i := i
+		f := NewBucketFactory(s.Options, connectionRetries, keyMaxIdleTime).(*bucketFactory)
+		f.owns = func(namespace, bucketName string) bool {
+			return sf.ring[sf.locate(namespace, bucketName)].shard == i
+		}
+
+		sf.shards = append(sf.shards, &shard{name, f})
+		for r := 0; r < shardReplicas; r++ {
+			sf.ring = append(sf.ring, ringPoint{crc32.ChecksumIEEE([]byte(name + "#" + strconv.Itoa(r))), i})
+		}
+	}
+
+	// Ties, which are unlikely, are broken by shard name, so that they don't depend on the order
+	// shards are listed in.
+	sort.Slice(sf.ring, func(i, j int) bool {
+		if sf.ring[i].hash != sf.ring[j].hash {
+			return sf.ring[i].hash < sf.ring[j].hash
+		}
+
+		return sf.shards[sf.ring[i].shard].name < sf.shards[sf.ring[j].shard].name
+	})
+
+	return sf
+}
+
+// locate returns the index of the ring point owning a bucket: the first at or after its hash.
+func (sf *shardedBucketFactory) locate(namespace, bucketName string) int {
+	h := crc32.ChecksumIEEE([]byte(config.FullyQualifiedName(namespace, bucketName)))
+	i := sort.Search(len(sf.ring), func(i int) bool { return sf.ring[i].hash >= h })
+	if i == len(sf.ring) {
+		i = 0
+	}
+
+	return i
+}
+
+// shardOf returns the shard holding a bucket.
+func (sf *shardedBucketFactory) shardOf(namespace, bucketName string) *shard {
+	return sf.shards[sf.ring[sf.locate(namespace, bucketName)].shard]
+}
+
+// Init initializes every shard, implementing Init() on the quotaservice.BucketFactory interface
+func (sf *shardedBucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	for _, s := range sf.shards {
+		s.factory.Init(cfg)
+	}
+}
+
+// NewBucket creates a bucket on the shard holding it, implementing NewBucket() on the
+// quotaservice.BucketFactory interface
+func (sf *shardedBucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	return sf.shardOf(namespace, bucketName).factory.NewBucket(namespace, bucketName, cfg, dyn)
+}
+
+// Client returns the clients of every shard, keyed on shard name, implementing Client() on the
+// quotaservice.BucketFactory interface
+func (sf *shardedBucketFactory) Client() interface{} {
+	clients := make(map[string]redis.UniversalClient, len(sf.shards))
+	for _, s := range sf.shards {
+		clients[s.name] = s.factory.Client().(redis.UniversalClient)
+	}
+
+	return clients
+}
+
+var _ quotaservice.MultiBucketTaker = (*shardedBucketFactory)(nil)
+
+// TakeAll implements quotaservice.MultiBucketTaker. Buckets on the same shard are taken from in a
+// single script. Buckets on different shards can't be taken from atomically, so shards are taken
+// from in turn, and tokens taken from earlier shards are returned if a later shard can't grant
+// them.
+func (sf *shardedBucketFactory) TakeAll(ctx context.Context, takes []quotaservice.BucketTake, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	var order []*bucketFactory
+	byShard := make(map[*bucketFactory][]quotaservice.BucketTake)
+	for _, t := range takes {
+		a, err := toAbstractBucket(t.Bucket)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if _, ok := byShard[a.factory]; !ok {
+			order = append(order, a.factory)
+		}
+		byShard[a.factory] = append(byShard[a.factory], t)
+	}
+
+	var longest time.Duration
+	for i, f := range order {
+		w, success, err := f.TakeAll(ctx, byShard[f], maxWaitTime)
+		if err != nil || !success {
+			for _, taken := range order[:i] {
+				returnTokens(ctx, byShard[taken])
+			}
+
+			return 0, false, err
+		}
+
+		if w > longest {
+			longest = w
+		}
+	}
+
+	return longest, true, nil
+}
+
+// returnTokens returns the tokens taken from buckets, logging rather than failing if they can't be
+// returned.
+func returnTokens(ctx context.Context, takes []quotaservice.BucketTake) {
+	for _, t := range takes {
+		if err := t.Bucket.Charge(ctx, -t.Tokens); err != nil {
+			logging.Printf("Unable to return %v tokens to bucket %v: %v", t.Tokens,
+				config.FullyQualifiedName(t.Bucket.Config().Namespace, t.Bucket.Config().Name), err)
+		}
+	}
+}
+
+var _ quotaservice.StaleBucketCleaner = (*shardedBucketFactory)(nil)
+
+// CleanStaleBuckets cleans up every shard, implementing quotaservice.StaleBucketCleaner. As well as
+// the keys of buckets that no longer exist, keys of buckets that have moved to another shard are
+// stale.
+func (sf *shardedBucketFactory) CleanStaleBuckets(ctx context.Context, dryRun bool) (*admin.CleanupReport, error) {
+	report := &admin.CleanupReport{DryRun: dryRun, Keys: []string{}}
+	for _, s := range sf.shards {
+		r, err := s.factory.CleanStaleBuckets(ctx, dryRun)
+		if r != nil {
+			report.Scanned += r.Scanned
+			report.Stale += r.Stale
+			report.Deleted += r.Deleted
+			report.Keys = append(report.Keys, r.Keys...)
+		}
+
+		if err != nil {
+			return report, errors.Wrapf(err, "failed to clean up shard %v", s.name)
+		}
+	}
+
+	return report, nil
+}
+
+// BackendVersion returns the lowest version of Redis detected on the shards. Empty if it couldn't
+// be detected on every shard.
+func (sf *shardedBucketFactory) BackendVersion() string {
+	var lowest string
+	var lowestVersion redisVersion
+	for _, s := range sf.shards {
+		version := s.factory.BackendVersion()
+		v, err := parseRedisVersion(version)
+		if err != nil {
+			return ""
+		}
+
+		if lowest == "" || v.less(lowestVersion) {
+			lowest, lowestVersion = version, v
+		}
+	}
+
+	return lowest
+}
+
+// isDisownedKey returns whether a key holds the state of a bucket that a shard doesn't hold, e.g.
+// after shards are added or removed. Keys that can't be parsed are never disowned.
+func isDisownedKey(layout KeyLayout, key string, owns func(namespace, bucketName string) bool) bool {
+	if owns == nil {
+		return false
+	}
+
+	namespace, bucketName, _, ok := layout.parseBucketKey(key)
+	return ok && !owns(namespace, bucketName)
+}
+
+// ShardHealth returns the health of every shard of a sharded Redis bucket factory, in the order
+// they were listed in.
+func ShardHealth(bf quotaservice.BucketFactory) []ShardStatus {
+	sf, ok := bf.(*shardedBucketFactory)
+	if !ok {
+		panic(fmt.Sprintf("Not a sharded Redis bucket factory: %T", bf))
+	}
+
+	statuses := make([]ShardStatus, len(sf.shards))
+	for i, s := range sf.shards {
+		statuses[i] = ShardStatus{s.name, s.factory.redisOpts.Addr, s.factory.circuitBreaker().currentState()}
+	}
+
+	return statuses
+}
@@ -0,0 +1,114 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func newTestShards(names ...string) []Shard {
+	shards := make([]Shard, len(names))
+	for i, name := range names {
+		shards[i] = Shard{Options: &redis.Options{Addr: name + ":6379"}}
+	}
+
+	return shards
+}
+
+// placements returns the shard holding each of a number of buckets.
+func placements(sf *shardedBucketFactory, buckets int) map[string]string {
+	p := make(map[string]string, buckets)
+	for i := 0; i < buckets; i++ {
+		b := fmt.Sprintf("b%v", i)
+		p[b] = sf.shardOf("ns", b).name
+	}
+
+	return p
+}
+
+func TestShardPlacement(t *testing.T) {
+	sf := NewShardedBucketFactory(newTestShards("a", "b", "c"), 1, 0).(*shardedBucketFactory)
+	counts := make(map[string]int)
+	for _, shard := range placements(sf, 3000) {
+		counts[shard]++
+	}
+
+	for _, name := range []string{"a:6379", "b:6379", "c:6379"} {
+		if counts[name] < 700 || counts[name] > 1300 {
+			t.Errorf("Expected buckets to be spread evenly across shards, got %v", counts)
+		}
+	}
+
+	// Placement depends on shard names, not the order shards are listed in.
+	reordered := NewShardedBucketFactory(newTestShards("c", "a", "b"), 1, 0).(*shardedBucketFactory)
+	before, after := placements(sf, 3000), placements(reordered, 3000)
+	for b, shard := range before {
+		if after[b] != shard {
+			t.Fatalf("Expected %v to stay on %v when shards are reordered, got %v", b, shard, after[b])
+		}
+	}
+}
+
+func TestShardRebalance(t *testing.T) {
+	before := placements(NewShardedBucketFactory(newTestShards("a", "b", "c"), 1, 0).(*shardedBucketFactory), 3000)
+	after := placements(NewShardedBucketFactory(newTestShards("a", "b", "c", "d"), 1, 0).(*shardedBucketFactory), 3000)
+
+	moved := 0
+	for b, shard := range after {
+		if shard != before[b] {
+			if shard != "d:6379" {
+				t.Fatalf("Expected %v to only move to the new shard, got %v", b, shard)
+			}
+			moved++
+		}
+	}
+
+	if moved < 450 || moved > 1050 {
+		t.Errorf("Expected about a quarter of buckets to move to the new shard, got %v", moved)
+	}
+}
+
+func TestShardOwnsKeys(t *testing.T) {
+	sf := NewShardedBucketFactory(newTestShards("a", "b"), 1, 0).(*shardedBucketFactory)
+	l := NewDefaultKeyLayout()
+	for i := 0; i < 100; i++ {
+		b := fmt.Sprintf("b%v", i)
+		key := l.bucketKey("ns", b, 1)
+		for _, s := range sf.shards {
+			if disowned := isDisownedKey(l, key, s.factory.owns); disowned != (s != sf.shardOf("ns", b)) {
+				t.Fatalf("Expected %v to be disowned by %v: %v", key, s.name, !disowned)
+			}
+		}
+	}
+
+	if isDisownedKey(l, "unparseable", sf.shards[0].factory.owns) || isDisownedKey(l, l.bucketKey("ns", "b", 1), nil) {
+		t.Fatal("Expected unparseable keys, and keys of unsharded factories, never to be disowned")
+	}
+}
+
+func TestShardSettings(t *testing.T) {
+	sf := NewShardedBucketFactory([]Shard{
+		{Name: "first", Options: &redis.Options{Addr: "a:6379"}},
+		{Options: &redis.Options{Addr: "b:6379"}}}, 1, 0)
+
+	SetTimeSource(sf, TIME_SOURCE_CLIENT)
+	for _, f := range redisFactories(sf) {
+		if f.timeSource != TIME_SOURCE_CLIENT {
+			t.Fatalf("Expected settings to apply to every shard, got %v", f.timeSource)
+		}
+	}
+
+	health := ShardHealth(sf)
+	if len(health) != 2 || health[0].Name != "first" || health[1].Name != "b:6379" || health[1].Breaker != BREAKER_CLOSED {
+		t.Fatalf("Unexpected shard health %+v", health)
+	}
+
+	helpers.ExpectingPanic(t, func() {
+		ShardHealth(factory)
+	})
+}
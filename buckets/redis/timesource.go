@@ -0,0 +1,41 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import "github.com/square/quotaservice"
+
+// TimeSource determines where the Lua script gets the current time from when refilling buckets.
+type TimeSource int
+
+const (
+	// The script uses Redis' TIME, so all quotaservice replicas agree on the time regardless of
+	// their own clocks. Requires Redis 3.2 or later, for replicate_commands.
+	TIME_SOURCE_REDIS TimeSource = iota
+	// As TIME_SOURCE_REDIS, but the time is never allowed to go backwards for a bucket, e.g. when
+	// failing over to a Redis replica with a skewed clock.
+	TIME_SOURCE_REDIS_MONOTONIC
+	// The quotaservice replica making the call supplies the time. This makes the script
+	// deterministic, but makes bucket state sensitive to clock skew between replicas.
+	TIME_SOURCE_CLIENT
+)
+
+var timeSourceNames = []string{
+	TIME_SOURCE_REDIS:           "TIME_SOURCE_REDIS",
+	TIME_SOURCE_REDIS_MONOTONIC: "TIME_SOURCE_REDIS_MONOTONIC",
+	TIME_SOURCE_CLIENT:          "TIME_SOURCE_CLIENT",
+}
+
+func (t TimeSource) String() string {
+	return timeSourceNames[t]
+}
+
+// SetTimeSource sets the TimeSource used by a Redis bucketFactory, or by every shard of a sharded
+// one. It should be called before the factory is used.
+func SetTimeSource(bf quotaservice.BucketFactory, ts TimeSource) {
+	for _, f := range redisFactories(bf) {
+		f.Lock()
+		f.timeSource = ts
+		f.Unlock()
+	}
+}
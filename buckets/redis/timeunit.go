@@ -0,0 +1,76 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/quotaservice"
+)
+
+// TimeUnit is the unit of the times and durations the Lua scripts account buckets in. Coarser
+// units store smaller values, and keep further from the 2^53 integers Lua's doubles hold exactly,
+// at the cost of rounding intervals between tokens, wait times and debt down to the unit.
+type TimeUnit int
+
+const (
+	// Nanoseconds, the default.
+	TIME_UNIT_NANOS TimeUnit = iota
+	// Microseconds; buckets refill at most a token per microsecond.
+	TIME_UNIT_MICROS
+	// Milliseconds; buckets refill at most a token per millisecond.
+	TIME_UNIT_MILLIS
+)
+
+var timeUnitNames = []string{
+	TIME_UNIT_NANOS:  "TIME_UNIT_NANOS",
+	TIME_UNIT_MICROS: "TIME_UNIT_MICROS",
+	TIME_UNIT_MILLIS: "TIME_UNIT_MILLIS",
+}
+
+var timeUnitDurations = []time.Duration{
+	TIME_UNIT_NANOS:  time.Nanosecond,
+	TIME_UNIT_MICROS: time.Microsecond,
+	TIME_UNIT_MILLIS: time.Millisecond,
+}
+
+func (u TimeUnit) String() string {
+	return timeUnitNames[u]
+}
+
+// Duration returns the length of the unit.
+func (u TimeUnit) Duration() time.Duration {
+	return timeUnitDurations[u]
+}
+
+// ParseTimeUnit parses "nanos", "micros" or "millis", or a TimeUnit's name.
+func ParseTimeUnit(s string) (TimeUnit, error) {
+	for u, name := range timeUnitNames {
+		if strings.EqualFold(s, name) || strings.EqualFold("TIME_UNIT_"+s, name) {
+			return TimeUnit(u), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown time unit %q; expected nanos, micros or millis", s)
+}
+
+// toUnits returns a number of nanos in the unit, as a string for use as a script argument.
+func (u TimeUnit) toUnits(nanos int64) string {
+	return strconv.FormatInt(nanos/int64(u.Duration()), 10)
+}
+
+// SetTimeUnit sets the TimeUnit used by a Redis bucketFactory, or by every shard of a sharded one.
+// It should be called before the factory is used. Bucket state saved with another unit is
+// converted the next time the bucket is updated, so the unit can be changed without resetting
+// buckets.
+func SetTimeUnit(bf quotaservice.BucketFactory, u TimeUnit) {
+	for _, f := range redisFactories(bf) {
+		f.Lock()
+		f.timeUnit = u
+		f.Unlock()
+	}
+}
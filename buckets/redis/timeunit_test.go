@@ -0,0 +1,45 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package redis
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/config"
+)
+
+func TestParseTimeUnit(t *testing.T) {
+	for s, expected := range map[string]TimeUnit{
+		"nanos":            TIME_UNIT_NANOS,
+		"MICROS":           TIME_UNIT_MICROS,
+		"millis":           TIME_UNIT_MILLIS,
+		"TIME_UNIT_MILLIS": TIME_UNIT_MILLIS,
+	} {
+		if u, err := ParseTimeUnit(s); err != nil || u != expected {
+			t.Errorf("Expected %v for %q, got %v, %v", expected, s, u, err)
+		}
+	}
+
+	if _, err := ParseTimeUnit("seconds"); err == nil {
+		t.Error("Expected an error for an unknown time unit")
+	}
+}
+
+func TestConfigAttributesInTimeUnit(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.FillRate = proto.Int64(3)
+	cfg.MaxDebtMillis = proto.Int64(1500)
+
+	a := newConfigAttributes(cfg, "0", false, TIME_UNIT_MILLIS)
+	if a.nanosBetweenTokens != "333" || a.maxDebtNanos != "1500" {
+		t.Fatalf("Expected attributes in millis, got %v, %v", a.nanosBetweenTokens, a.maxDebtNanos)
+	}
+
+	// At most a token per unit.
+	cfg.FillRate = proto.Int64(1000000)
+	if a := newConfigAttributes(cfg, "0", false, TIME_UNIT_MILLIS); a.nanosBetweenTokens != "1" {
+		t.Fatalf("Expected a token per millisecond, got %v", a.nanosBetweenTokens)
+	}
+}
@@ -0,0 +1,191 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package shedding decorates a BucketFactory with adaptive load shedding. The latency of calls to
+// Take on the underlying buckets is tracked, and once it exceeds a threshold, a configurable
+// fraction of requests is short-circuited according to the namespace's degradation policy,
+// protecting a congested backend such as Redis from collapse.
+package shedding
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/logging"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// Config configures load shedding.
+type Config struct {
+	// LatencyThreshold is the average Take latency above which requests are shed.
+	LatencyThreshold time.Duration
+	// ShedFraction is the fraction, at least 0 and less than 1, of requests short-circuited while
+	// shedding. The rest still reach the backend, so that the average latency is updated, and
+	// shedding stops once the backend recovers.
+	ShedFraction float64
+	// Smoothing is the weight, between 0 and 1, given to each new latency sample when updating the
+	// exponentially weighted moving average.
+	Smoothing float64
+}
+
+// NewDefaultConfig creates a Config with sensible defaults.
+func NewDefaultConfig() Config {
+	return Config{
+		LatencyThreshold: 50 * time.Millisecond,
+		ShedFraction:     0.5,
+		Smoothing:        0.1}
+}
+
+type bucketFactory struct {
+	delegate quotaservice.BucketFactory
+	cfg      Config
+	// avgLatencyNanos is an exponentially weighted moving average of Take latency.
+	avgLatencyNanos float64
+	shedding        bool
+	policies        map[string]pbconfig.DegradationPolicy
+	now             func() time.Time
+	random          func() float64
+	sync.RWMutex
+}
+
+// NewBucketFactory decorates a BucketFactory with load shedding.
+func NewBucketFactory(delegate quotaservice.BucketFactory, cfg Config) quotaservice.BucketFactory {
+	if cfg.ShedFraction < 0 || cfg.ShedFraction >= 1 || cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		panic("ShedFraction must be at least 0 and less than 1, and Smoothing must be greater than 0 and at most 1")
+	}
+
+	return &bucketFactory{
+		delegate: delegate,
+		cfg:      cfg,
+		policies: make(map[string]pbconfig.DegradationPolicy),
+		now:      time.Now,
+		random:   rand.Float64}
+}
+
+func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	policies := make(map[string]pbconfig.DegradationPolicy, len(cfg.Namespaces))
+	for name, ns := range cfg.Namespaces {
+		policies[name] = ns.DegradationPolicy
+	}
+
+	bf.Lock()
+	bf.policies = policies
+	bf.Unlock()
+
+	bf.delegate.Init(cfg)
+}
+
+func (bf *bucketFactory) Client() interface{} {
+	return bf.delegate.Client()
+}
+
+// Close closes the delegate, if it implements quotaservice.BucketFactoryCloser.
+func (bf *bucketFactory) Close() {
+	if closer, ok := bf.delegate.(quotaservice.BucketFactoryCloser); ok {
+		closer.Close()
+	}
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	return &bucket{
+		Bucket:    bf.delegate.NewBucket(namespace, bucketName, cfg, dyn),
+		namespace: namespace,
+		factory:   bf}
+}
+
+// shouldShed decides whether a request should be short-circuited, returning the degradation
+// policy to apply if so.
+func (bf *bucketFactory) shouldShed(namespace string) (bool, pbconfig.DegradationPolicy) {
+	bf.RLock()
+	defer bf.RUnlock()
+
+	if !bf.shedding || bf.random() >= bf.cfg.ShedFraction {
+		return false, pbconfig.DegradationPolicy_FAIL_OPEN
+	}
+
+	return true, bf.policies[namespace]
+}
+
+func (bf *bucketFactory) recordLatency(d time.Duration) {
+	bf.Lock()
+	defer bf.Unlock()
+
+	bf.avgLatencyNanos = bf.cfg.Smoothing*float64(d.Nanoseconds()) + (1-bf.cfg.Smoothing)*bf.avgLatencyNanos
+	shedding := bf.avgLatencyNanos > float64(bf.cfg.LatencyThreshold.Nanoseconds())
+	if shedding != bf.shedding {
+		bf.shedding = shedding
+		logging.Printf("Average Take latency is %v; load shedding enabled=%v",
+			time.Duration(math.Round(bf.avgLatencyNanos)), shedding)
+	}
+}
+
+// Shedding returns whether requests are currently being shed, along with the current average
+// Take latency.
+func Shedding(bf quotaservice.BucketFactory) (bool, time.Duration) {
+	s, ok := bf.(*bucketFactory)
+	if !ok {
+		return false, 0
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+	return s.shedding, time.Duration(math.Round(s.avgLatencyNanos))
+}
+
+type bucket struct {
+	quotaservice.Bucket
+	namespace string
+	factory   *bucketFactory
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	if shed, policy := b.factory.shouldShed(b.namespace); shed {
+		// Short-circuit, without consulting the backend.
+		return 0, policy == pbconfig.DegradationPolicy_FAIL_OPEN, nil
+	}
+
+	start := b.factory.now()
+	w, success, err := b.Bucket.Take(ctx, numTokens, maxWaitTime)
+	b.factory.recordLatency(b.factory.now().Sub(start))
+
+	return w, success, err
+}
+
+// Tokens, Warm, ForgiveDebt and Reset are forwarded to the underlying bucket, failing with
+// quotaservice.ErrNotSupported if it doesn't implement them.
+func (b *bucket) Tokens(ctx context.Context) (int64, error) {
+	if inspector, ok := b.Bucket.(quotaservice.TokenInspector); ok {
+		return inspector.Tokens(ctx)
+	}
+
+	return 0, quotaservice.ErrNotSupported
+}
+
+func (b *bucket) Warm(ctx context.Context) error {
+	if warmer, ok := b.Bucket.(quotaservice.BucketWarmer); ok {
+		return warmer.Warm(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
+
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	if forgiver, ok := b.Bucket.(quotaservice.DebtForgiver); ok {
+		return forgiver.ForgiveDebt(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
+
+func (b *bucket) Reset(ctx context.Context) error {
+	if resetter, ok := b.Bucket.(quotaservice.BucketResetter); ok {
+		return resetter.Reset(ctx)
+	}
+
+	return quotaservice.ErrNotSupported
+}
@@ -0,0 +1,177 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package shedding
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets/memory"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// newTestFactory creates a factory where each Take on the underlying bucket appears to take latency.
+func newTestFactory(latency *time.Duration) (*bucketFactory, *qstesting.MockBucketFactory) {
+	delegate := &qstesting.MockBucketFactory{}
+	cfg := NewDefaultConfig()
+	cfg.LatencyThreshold = 10 * time.Millisecond
+	cfg.ShedFraction = 0.5
+	cfg.Smoothing = 1
+	bf := NewBucketFactory(delegate, cfg).(*bucketFactory)
+
+	now := time.Unix(0, 0)
+	bf.now = func() time.Time {
+		now = now.Add(*latency)
+		return now
+	}
+
+	sc := config.NewDefaultServiceConfig()
+	open := config.NewDefaultNamespaceConfig("open")
+	closed := config.NewDefaultNamespaceConfig("closed")
+	closed.DegradationPolicy = pbconfig.DegradationPolicy_FAIL_CLOSED
+	helpers.PanicError(config.AddNamespace(sc, open))
+	helpers.PanicError(config.AddNamespace(sc, closed))
+	bf.Init(sc)
+
+	return bf, delegate
+}
+
+func TestShedsWhenLatencyExceedsThreshold(t *testing.T) {
+	latency := time.Millisecond
+	bf, delegate := newTestFactory(&latency)
+	b := bf.NewBucket("closed", "b", config.NewDefaultBucketConfig("b"), false)
+	// Make the underlying bucket reject everything, so short-circuited requests are distinguishable.
+	delegate.SetWaitTime("closed", "b", time.Hour)
+
+	_, _, err := b.Take(context.Background(), 1, time.Second)
+	helpers.CheckError(t, err)
+	if shedding, _ := Shedding(bf); shedding {
+		t.Fatal("Should not be shedding under the latency threshold")
+	}
+
+	latency = 20 * time.Millisecond
+	_, _, err = b.Take(context.Background(), 1, time.Second)
+	helpers.CheckError(t, err)
+	if shedding, avg := Shedding(bf); !shedding || avg != 20*time.Millisecond {
+		t.Fatalf("Should be shedding, with average latency 20ms. Was %v, %v", shedding, avg)
+	}
+
+	// Requests below ShedFraction are short-circuited, others hit the backend.
+	bf.random = func() float64 { return 0.9 }
+	if _, _, err := b.Take(context.Background(), 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	latency = time.Millisecond
+	bf.random = func() float64 { return 0.1 }
+	_, success, err := b.Take(context.Background(), 1, time.Second)
+	helpers.CheckError(t, err)
+	if success {
+		t.Fatal("Expected FAIL_CLOSED namespace to reject short-circuited requests")
+	}
+
+	if shedding, _ := Shedding(bf); !shedding {
+		t.Fatal("Short-circuited requests should not update latency")
+	}
+
+	// Once latency recovers, shedding stops.
+	bf.random = func() float64 { return 0.9 }
+	_, _, err = b.Take(context.Background(), 1, time.Second)
+	helpers.CheckError(t, err)
+	if shedding, _ := Shedding(bf); shedding {
+		t.Fatal("Should stop shedding once latency recovers")
+	}
+}
+
+func TestFailOpen(t *testing.T) {
+	latency := 20 * time.Millisecond
+	bf, delegate := newTestFactory(&latency)
+	b := bf.NewBucket("open", "b", config.NewDefaultBucketConfig("b"), false)
+	delegate.SetWaitTime("open", "b", time.Hour)
+
+	_, _, err := b.Take(context.Background(), 1, time.Second)
+	helpers.CheckError(t, err)
+
+	bf.random = func() float64 { return 0.1 }
+	w, success, err := b.Take(context.Background(), 1, time.Second)
+	helpers.CheckError(t, err)
+	if !success || w != 0 {
+		t.Fatalf("Expected FAIL_OPEN namespace to grant short-circuited requests. Was %v, %v", success, w)
+	}
+}
+
+func TestRecoversWhileSheddingMostRequests(t *testing.T) {
+	latency := 20 * time.Millisecond
+	bf, _ := newTestFactory(&latency)
+	bf.cfg.ShedFraction = 0.99
+	b := bf.NewBucket("closed", "b", config.NewDefaultBucketConfig("b"), false)
+
+	_, _, err := b.Take(context.Background(), 1, time.Second)
+	helpers.CheckError(t, err)
+	if shedding, _ := Shedding(bf); !shedding {
+		t.Fatal("Should be shedding over the latency threshold")
+	}
+
+	// Even while shedding nearly every request, the few let through see the backend recover.
+	latency = time.Millisecond
+	draws := []float64{0.1, 0.5, 0.995}
+	bf.random = func() float64 {
+		next := draws[0]
+		draws = draws[1:]
+		return next
+	}
+
+	for range draws {
+		_, _, err = b.Take(context.Background(), 1, time.Second)
+		helpers.CheckError(t, err)
+	}
+
+	if shedding, _ := Shedding(bf); shedding {
+		t.Fatal("Should stop shedding once latency recovers")
+	}
+}
+
+func TestInvalidShedFraction(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.ShedFraction = 1
+	// Shedding every request would never see the backend recover.
+	helpers.ExpectingPanic(t, func() {
+		NewBucketFactory(&qstesting.MockBucketFactory{}, cfg)
+	})
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	delegate := &qstesting.MockBucketFactory{}
+	b := NewBucketFactory(delegate, NewDefaultConfig()).NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	helpers.CheckError(t, b.(quotaservice.BucketWarmer).Warm(ctx))
+	if warmed := delegate.Warmed("ns", "b"); warmed != 1 {
+		t.Fatalf("Expected the underlying bucket to be warmed, got %v", warmed)
+	}
+
+	helpers.CheckError(t, delegate.Bucket("ns", "b").Charge(ctx, 150))
+	helpers.CheckError(t, b.(quotaservice.DebtForgiver).ForgiveDebt(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 0 {
+		t.Fatalf("Expected the debt to be forgiven, got %v, %v", tokens, err)
+	}
+
+	helpers.CheckError(t, b.(quotaservice.BucketResetter).Reset(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 100 {
+		t.Fatalf("Expected the bucket to be reset, got %v, %v", tokens, err)
+	}
+
+	// Memory buckets can't be warmed.
+	unsupported := NewBucketFactory(memory.NewBucketFactory(), NewDefaultConfig()).NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+	defer unsupported.Destroy()
+	if err := unsupported.(quotaservice.BucketWarmer).Warm(ctx); err != quotaservice.ErrNotSupported {
+		t.Fatalf("Expected warming to be unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package tiered composes a local bucket factory, typically in-memory, with a remote one such as
+// Redis. Each instance's local buckets are conservative replicas of the remote buckets, holding
+// 1/Replicas of their size and fill rate, and are consulted first; the remote bucket is only
+// consulted once the local one is exhausted. Tokens granted locally are charged to the remote
+// bucket in batches, so that traffic far below the limit rarely touches the backend, while traffic
+// near the limit is still enforced globally.
+package tiered
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/logging"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// Config configures a tiered bucket factory.
+type Config struct {
+	// Replicas is the number of quota service instances sharing the remote buckets. Each local
+	// bucket holds 1/Replicas of the remote bucket's size and fill rate.
+	Replicas int
+	// FlushInterval is how often tokens granted by local buckets are charged to remote buckets.
+	// Until they are, the remote buckets over-admit by up to the tokens granted locally since the
+	// last flush.
+	FlushInterval time.Duration
+}
+
+// NewDefaultConfig creates a Config for a single instance, flushing every 100 millis.
+func NewDefaultConfig() Config {
+	return Config{
+		Replicas:      1,
+		FlushInterval: 100 * time.Millisecond}
+}
+
+type bucketFactory struct {
+	local, remote quotaservice.BucketFactory
+	cfg           Config
+	// buckets are the live buckets, whose locally granted tokens are flushed, protected by the
+	// embedded mutex.
+	buckets map[*bucket]struct{}
+	stop    chan struct{}
+	stopped sync.Once
+	sync.Mutex
+}
+
+// NewBucketFactory creates a bucket factory that pre-filters requests to remote buckets with local
+// ones. The remote factory's buckets must support Charge.
+func NewBucketFactory(local, remote quotaservice.BucketFactory, cfg Config) quotaservice.BucketFactory {
+	if cfg.Replicas < 1 || cfg.FlushInterval <= 0 {
+		panic("Replicas must be at least 1, and FlushInterval must be positive")
+	}
+
+	bf := &bucketFactory{
+		local:   local,
+		remote:  remote,
+		cfg:     cfg,
+		buckets: make(map[*bucket]struct{}),
+		stop:    make(chan struct{})}
+
+	go bf.flushLoop()
+
+	return bf
+}
+
+func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	bf.local.Init(cfg)
+	bf.remote.Init(cfg)
+}
+
+func (bf *bucketFactory) Client() interface{} {
+	return bf.remote.Client()
+}
+
+// Close flushes tokens granted locally, and closes both factories if they implement
+// quotaservice.BucketFactoryCloser.
+func (bf *bucketFactory) Close() {
+	bf.stopped.Do(func() {
+		close(bf.stop)
+		bf.flush()
+
+		for _, delegate := range []quotaservice.BucketFactory{bf.local, bf.remote} {
+			if closer, ok := delegate.(quotaservice.BucketFactoryCloser); ok {
+				closer.Close()
+			}
+		}
+	})
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	b := &bucket{
+		local:     bf.local.NewBucket(namespace, bucketName, localConfig(cfg, bf.cfg.Replicas), dyn),
+		remote:    bf.remote.NewBucket(namespace, bucketName, cfg, dyn),
+		namespace: namespace,
+		name:      bucketName,
+		factory:   bf}
+
+	bf.Lock()
+	bf.buckets[b] = struct{}{}
+	bf.Unlock()
+
+	return b
+}
+
+// localConfig returns the config of a local replica of a bucket. Local buckets never go into debt,
+// so that requests that would are decided by the remote bucket. The local replica of a blocked
+// bucket is blocked too.
+func localConfig(cfg *pbconfig.BucketConfig, replicas int) *pbconfig.BucketConfig {
+	local := proto.Clone(cfg).(*pbconfig.BucketConfig)
+	local.MaxDebtMillis = proto.Int64(0)
+	if config.Blocked(cfg) {
+		local.Size = proto.Int64(0)
+		local.FillRate = proto.Int64(0)
+		return local
+	}
+
+	local.Size = proto.Int64(max(1, cfg.GetSize()/int64(replicas)))
+	local.FillRate = proto.Int64(max(1, cfg.GetFillRate()/int64(replicas)))
+
+	return local
+}
+
+func (bf *bucketFactory) flushLoop() {
+	ticker := time.NewTicker(bf.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bf.stop:
+			return
+		case <-ticker.C:
+			bf.flush()
+		}
+	}
+}
+
+// flush charges tokens granted locally to the remote buckets.
+func (bf *bucketFactory) flush() {
+	bf.Lock()
+	buckets := make([]*bucket, 0, len(bf.buckets))
+	for b := range bf.buckets {
+		buckets = append(buckets, b)
+	}
+	bf.Unlock()
+
+	for _, b := range buckets {
+		b.flush()
+	}
+}
+
+type bucket struct {
+	local, remote   quotaservice.Bucket
+	namespace, name string
+	factory         *bucketFactory
+	// unflushed is the number of tokens granted locally and not yet charged to the remote bucket.
+	unflushed int64
+}
+
+func (b *bucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	if _, ok, err := b.local.Take(ctx, numTokens, 0); err == nil && ok {
+		atomic.AddInt64(&b.unflushed, numTokens)
+		return 0, true, nil
+	}
+
+	return b.remote.Take(ctx, numTokens, maxWaitTime)
+}
+
+// Charge charges the remote bucket, which is authoritative.
+func (b *bucket) Charge(ctx context.Context, numTokens int64) error {
+	return b.remote.Charge(ctx, numTokens)
+}
+
+func (b *bucket) flush() {
+	n := atomic.SwapInt64(&b.unflushed, 0)
+	if n == 0 {
+		return
+	}
+
+	if err := b.remote.Charge(context.Background(), n); err != nil {
+		// Retried on the next flush.
+		atomic.AddInt64(&b.unflushed, n)
+		logging.Printf("Unable to charge %v locally granted tokens to bucket %v:%v: %v", n, b.namespace, b.name, err)
+	}
+}
+
+// Tokens returns the tokens of the remote bucket, less those granted locally and not yet charged
+// to it.
+func (b *bucket) Tokens(ctx context.Context) (int64, error) {
+	inspector, ok := b.remote.(quotaservice.TokenInspector)
+	if !ok {
+		return 0, quotaservice.ErrNotSupported
+	}
+
+	tokens, err := inspector.Tokens(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return tokens - atomic.LoadInt64(&b.unflushed), nil
+}
+
+// Warm warms the remote bucket. Local buckets are held in memory.
+func (b *bucket) Warm(ctx context.Context) error {
+	warmer, ok := b.remote.(quotaservice.BucketWarmer)
+	if !ok {
+		return quotaservice.ErrNotSupported
+	}
+
+	return warmer.Warm(ctx)
+}
+
+// ForgiveDebt forgives the debt of the remote bucket, once tokens granted locally have been charged
+// to it, so that they don't put it back into debt. Local buckets never go into debt.
+func (b *bucket) ForgiveDebt(ctx context.Context) error {
+	forgiver, ok := b.remote.(quotaservice.DebtForgiver)
+	if !ok {
+		return quotaservice.ErrNotSupported
+	}
+
+	b.flush()
+	return forgiver.ForgiveDebt(ctx)
+}
+
+// Reset resets the remote bucket, discarding tokens granted locally and not yet charged to it, and
+// the local bucket, if it can be reset.
+func (b *bucket) Reset(ctx context.Context) error {
+	resetter, ok := b.remote.(quotaservice.BucketResetter)
+	if !ok {
+		return quotaservice.ErrNotSupported
+	}
+
+	atomic.StoreInt64(&b.unflushed, 0)
+	if err := resetter.Reset(ctx); err != nil {
+		return err
+	}
+
+	if local, ok := b.local.(quotaservice.BucketResetter); ok {
+		return local.Reset(ctx)
+	}
+
+	return nil
+}
+
+func (b *bucket) Config() *pbconfig.BucketConfig {
+	return b.remote.Config()
+}
+
+func (b *bucket) Dynamic() bool {
+	return b.remote.Dynamic()
+}
+
+func (b *bucket) Destroy() {
+	b.factory.Lock()
+	delete(b.factory.buckets, b)
+	b.factory.Unlock()
+
+	b.flush()
+	b.local.Destroy()
+	b.remote.Destroy()
+}
+
+func (b *bucket) ReportActivity() {
+	b.local.ReportActivity()
+	b.remote.ReportActivity()
+}
+
+func max(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
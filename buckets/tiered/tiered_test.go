@@ -0,0 +1,163 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package tiered
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/buckets/memory"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+)
+
+func newTestFactory(remote quotaservice.BucketFactory) *bucketFactory {
+	cfg := NewDefaultConfig()
+	cfg.Replicas = 2
+	// Flushed explicitly by tests.
+	cfg.FlushInterval = time.Hour
+	return NewBucketFactory(memory.NewBucketFactory(), remote, cfg).(*bucketFactory)
+}
+
+func TestLocalBucketsPrefilter(t *testing.T) {
+	remote := &qstesting.MockBucketFactory{}
+	bf := newTestFactory(remote)
+	defer bf.Close()
+
+	cfg := config.NewDefaultBucketConfig("b")
+	cfg.FillRate = proto.Int64(1)
+	b := bf.NewBucket("ns", "b", cfg, false)
+
+	if local := b.(*bucket).local.Config(); local.GetSize() != cfg.GetSize()/2 || local.GetFillRate() != 1 || local.GetMaxDebtMillis() != 0 {
+		t.Fatalf("Unexpected local bucket config %+v", local)
+	}
+
+	for i := int64(0); i < cfg.GetSize()/2; i++ {
+		_, ok, err := b.Take(context.Background(), 1, 0)
+		helpers.CheckError(t, err)
+		if !ok {
+			t.Fatalf("Expected token %v to be granted locally", i)
+		}
+	}
+
+	// The local bucket is exhausted, so this is decided by the remote bucket.
+	remote.SetWaitTime("ns", "b", time.Hour)
+	if _, ok, _ := b.Take(context.Background(), 1, 0); ok {
+		t.Fatal("Expected remote bucket to be consulted once the local bucket is exhausted")
+	}
+
+	if charged := remote.Charged("ns", "b"); charged != 0 {
+		t.Fatalf("Expected no tokens to be charged before flushing, got %v", charged)
+	}
+
+	bf.flush()
+	if charged := remote.Charged("ns", "b"); charged != cfg.GetSize()/2 {
+		t.Fatalf("Expected %v locally granted tokens to be charged, got %v", cfg.GetSize()/2, charged)
+	}
+
+	bf.flush()
+	if charged := remote.Charged("ns", "b"); charged != cfg.GetSize()/2 {
+		t.Fatalf("Expected tokens to be charged once, got %v", charged)
+	}
+}
+
+func TestBlockedBucketStaysBlocked(t *testing.T) {
+	bf := newTestFactory(memory.NewBucketFactory())
+	defer bf.Close()
+
+	cfg := config.NewDefaultBucketConfig("b")
+	cfg.FillRate = proto.Int64(0)
+	b := bf.NewBucket("ns", "b", cfg, false)
+
+	if local := b.(*bucket).local.Config(); local.GetSize() != 0 || local.GetFillRate() != 0 {
+		t.Fatalf("Expected the local bucket to be blocked, got %+v", local)
+	}
+
+	if _, ok, err := b.Take(context.Background(), 1, time.Second); err != nil || ok {
+		t.Fatalf("Expected a blocked bucket to deny requests, got %v, %v", ok, err)
+	}
+}
+
+func TestFailedFlushesAreRetried(t *testing.T) {
+	remote := &qstesting.MockBucketFactory{SimulateFailure: true}
+	bf := newTestFactory(remote)
+	defer bf.Close()
+
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false).(*bucket)
+	_, _, err := b.Take(context.Background(), 3, 0)
+	helpers.CheckError(t, err)
+
+	bf.flush()
+	if b.unflushed != 3 {
+		t.Fatalf("Expected tokens to remain unflushed, got %v", b.unflushed)
+	}
+}
+
+func TestDestroyFlushes(t *testing.T) {
+	remote := &qstesting.MockBucketFactory{}
+	bf := newTestFactory(remote)
+	defer bf.Close()
+
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+	_, _, err := b.Take(context.Background(), 3, 0)
+	helpers.CheckError(t, err)
+
+	b.Destroy()
+	if charged := remote.Charged("ns", "b"); charged != 3 {
+		t.Fatalf("Expected tokens to be charged on destroy, got %v", charged)
+	}
+
+	if len(bf.buckets) != 0 {
+		t.Fatalf("Expected destroyed bucket to be forgotten, got %v", bf.buckets)
+	}
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	remote := &qstesting.MockBucketFactory{}
+	bf := newTestFactory(remote)
+	defer bf.Close()
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	helpers.CheckError(t, b.(quotaservice.BucketWarmer).Warm(ctx))
+	if warmed := remote.Warmed("ns", "b"); warmed != 1 {
+		t.Fatalf("Expected the remote bucket to be warmed, got %v", warmed)
+	}
+
+	// Tokens granted locally count against the remote bucket before they are flushed.
+	_, _, err := b.Take(ctx, 1, 0)
+	helpers.CheckError(t, err)
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 99 {
+		t.Fatalf("Expected 99 tokens, got %v, %v", tokens, err)
+	}
+
+	helpers.CheckError(t, b.Charge(ctx, 150))
+	helpers.CheckError(t, b.(quotaservice.DebtForgiver).ForgiveDebt(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 0 {
+		t.Fatalf("Expected the debt, including locally granted tokens, to be forgiven, got %v, %v", tokens, err)
+	}
+
+	_, _, err = b.Take(ctx, 1, 0)
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, b.(quotaservice.BucketResetter).Reset(ctx))
+	if tokens, err := b.(quotaservice.TokenInspector).Tokens(ctx); err != nil || tokens != 100 {
+		t.Fatalf("Expected the bucket to be reset, got %v, %v", tokens, err)
+	}
+
+	bf.flush()
+	if charged := remote.Charged("ns", "b"); charged != 0 {
+		t.Fatalf("Expected locally granted tokens to be discarded by the reset, got %v", charged)
+	}
+
+	// Memory buckets can't be warmed.
+	unsupported := newTestFactory(memory.NewBucketFactory())
+	defer unsupported.Close()
+	if err := unsupported.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false).(quotaservice.BucketWarmer).Warm(ctx); err != quotaservice.ErrNotSupported {
+		t.Fatalf("Expected warming to be unsupported, got %v", err)
+	}
+}
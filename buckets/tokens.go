@@ -0,0 +1,125 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package buckets
+
+import (
+	"context"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// TokenState is the state of a token bucket, for bucket implementations that store it in an
+// external datastore and update it with compare-and-swap operations. Its methods implement the
+// same algorithm as the memory bucket implementation.
+type TokenState struct {
+	// AccumulatedTokens are tokens available immediately.
+	AccumulatedTokens int64
+	// TokensNextAvailableNanos is when, in nanos since the epoch, the next token becomes available.
+	// If in the future, the bucket is in debt.
+	TokensNextAvailableNanos int64
+}
+
+// NewTokenState returns the state of a full bucket.
+func NewTokenState(cfg *pbconfig.BucketConfig) TokenState {
+	return TokenState{AccumulatedTokens: cfg.GetSize()}
+}
+
+// Available returns the tokens available at nowNanos or, if negative, the tokens owed by a bucket in
+// debt.
+func (s TokenState) Available(cfg *pbconfig.BucketConfig, nowNanos int64) int64 {
+	s = s.refill(cfg, nowNanos)
+	if debtNanos := s.TokensNextAvailableNanos - nowNanos; debtNanos > 0 {
+		between := nanosBetweenTokens(cfg)
+		return -((debtNanos + between - 1) / between)
+	}
+
+	return s.AccumulatedTokens
+}
+
+func nanosBetweenTokens(cfg *pbconfig.BucketConfig) int64 {
+	return config.NanosBetweenTokens(cfg)
+}
+
+// refill returns the state with tokens accumulated since TokensNextAvailableNanos added.
+func (s TokenState) refill(cfg *pbconfig.BucketConfig, nowNanos int64) TokenState {
+	if nowNanos > s.TokensNextAvailableNanos {
+		freshTokens := (nowNanos - s.TokensNextAvailableNanos) / nanosBetweenTokens(cfg)
+		s.AccumulatedTokens = min(cfg.GetSize(), s.AccumulatedTokens+freshTokens)
+		s.TokensNextAvailableNanos = nowNanos
+	}
+
+	return s
+}
+
+// MaxDebtNanos returns the debt, in nanos, a request may put a bucket into: none for strict
+// requests, or the bucket's max debt otherwise.
+func MaxDebtNanos(ctx context.Context, cfg *pbconfig.BucketConfig) int64 {
+	if quotaservice.StrictFromContext(ctx) {
+		return 0
+	}
+
+	return config.MaxDebtNanos(cfg)
+}
+
+// Take returns the state after taking tokens at nowNanos, and how long, in nanos, to wait before
+// using them. Returns false, and the state unchanged, if tokens can't be obtained within
+// maxWaitNanos, or without exceeding maxDebtNanos, or if the bucket is blocked.
+func (s TokenState) Take(cfg *pbconfig.BucketConfig, nowNanos, requested, maxWaitNanos, maxDebtNanos int64) (TokenState, int64, bool) {
+	if config.Blocked(cfg) {
+		return s, 0, false
+	}
+
+	next := s.refill(cfg, nowNanos)
+
+	waitNanos := next.TokensNextAvailableNanos - nowNanos
+	accumulatedTokensUsed := min(next.AccumulatedTokens, requested)
+	next.AccumulatedTokens -= accumulatedTokensUsed
+	next.TokensNextAvailableNanos += (requested - accumulatedTokensUsed) * nanosBetweenTokens(cfg)
+
+	if next.TokensNextAvailableNanos-nowNanos > maxDebtNanos || (waitNanos > 0 && waitNanos > maxWaitNanos) {
+		return s, 0, false
+	}
+
+	return next, waitNanos, true
+}
+
+// ForgiveDebt returns the state at nowNanos with any debt cleared.
+func (s TokenState) ForgiveDebt(cfg *pbconfig.BucketConfig, nowNanos int64) TokenState {
+	s = s.refill(cfg, nowNanos)
+	if s.TokensNextAvailableNanos > nowNanos {
+		s.TokensNextAvailableNanos = nowNanos
+	}
+
+	return s
+}
+
+// Charge returns the state after unconditionally taking tokens at nowNanos, regardless of max
+// debt, or returning tokens if numTokens is negative. Returned tokens pay back debt first.
+func (s TokenState) Charge(cfg *pbconfig.BucketConfig, nowNanos, numTokens int64) TokenState {
+	s = s.refill(cfg, nowNanos)
+	between := nanosBetweenTokens(cfg)
+
+	if numTokens >= 0 {
+		accumulatedTokensUsed := min(s.AccumulatedTokens, numTokens)
+		s.AccumulatedTokens -= accumulatedTokensUsed
+		s.TokensNextAvailableNanos += (numTokens - accumulatedTokensUsed) * between
+	} else {
+		refund := -numTokens
+		debtRepaidNanos := min(s.TokensNextAvailableNanos-nowNanos, refund*between)
+		s.TokensNextAvailableNanos -= debtRepaidNanos
+		tokensRepaid := (debtRepaidNanos + between - 1) / between
+		s.AccumulatedTokens = min(cfg.GetSize(), s.AccumulatedTokens+refund-tokensRepaid)
+	}
+
+	return s
+}
+
+func min(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
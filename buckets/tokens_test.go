@@ -0,0 +1,120 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package buckets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+)
+
+func TestTokenState(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+	cfg.MaxDebtMillis = proto.Int64(5000)
+
+	var now int64 = 1e12
+	s := NewTokenState(cfg)
+
+	s, wait, ok := s.Take(cfg, now, 10, 0, 5e9)
+	if !ok || wait != 0 || s.AccumulatedTokens != 0 {
+		t.Fatalf("Expected to take all tokens, got %+v, %v, %v", s, wait, ok)
+	}
+
+	// Going into debt is allowed, but the next caller has to wait.
+	s, wait, ok = s.Take(cfg, now, 2, 0, 5e9)
+	if !ok || wait != 0 || s.TokensNextAvailableNanos != now+2e9 {
+		t.Fatalf("Expected to go into debt, got %+v, %v, %v", s, wait, ok)
+	}
+
+	if _, _, ok := s.Take(cfg, now, 1, 1e9, 5e9); ok {
+		t.Fatal("Expected to time out waiting for tokens")
+	}
+
+	if _, _, ok := s.Take(cfg, now, 4, 1e10, 5e9); ok {
+		t.Fatal("Expected to exceed max debt")
+	}
+
+	if _, _, ok := s.Take(cfg, now, 1, 1e10, 0); ok {
+		t.Fatal("Expected a strict request not to go into debt")
+	}
+
+	s = s.Charge(cfg, now, -5)
+	if s.TokensNextAvailableNanos != now || s.AccumulatedTokens != 3 {
+		t.Fatalf("Expected refund to pay back debt first, got %+v", s)
+	}
+
+	// Tokens accumulate over time, up to the bucket size.
+	s = s.refill(cfg, now+100e9)
+	if s.AccumulatedTokens != 10 {
+		t.Fatalf("Expected a full bucket, got %+v", s)
+	}
+}
+
+func TestTokenStateAvailable(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1000)
+	cfg.MaxDebtMillis = proto.Int64(10000)
+
+	var now int64 = 1e12
+	s := NewTokenState(cfg)
+
+	if a := s.Available(cfg, now); a != 10 {
+		t.Fatalf("Expected a full bucket, got %v", a)
+	}
+
+	s = s.Charge(cfg, now, 15)
+	if a := s.Available(cfg, now); a != -5 {
+		t.Fatalf("Expected 5 tokens of debt, got %v", a)
+	}
+
+	if a := s.Available(cfg, now+8e6); a != 3 {
+		t.Fatalf("Expected debt to be repaid, got %v", a)
+	}
+}
+
+func TestTokenStateForgiveDebt(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = proto.Int64(10)
+	cfg.FillRate = proto.Int64(1)
+
+	var now int64 = 1e12
+	s := NewTokenState(cfg).Charge(cfg, now, 100)
+	if s = s.ForgiveDebt(cfg, now); s.TokensNextAvailableNanos != now || s.AccumulatedTokens != 0 {
+		t.Fatalf("Expected the debt to be forgiven, got %+v", s)
+	}
+
+	// Tokens accumulated are kept.
+	if s = s.ForgiveDebt(cfg, now+3e9); s.Available(cfg, now+3e9) != 3 {
+		t.Fatalf("Expected 3 tokens, got %+v", s)
+	}
+}
+
+func TestTokenStateBlocked(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.FillRate = proto.Int64(0)
+	s := NewTokenState(cfg)
+
+	if next, _, ok := s.Take(cfg, 1e9, 1, 1e9, 1e9); ok || next != s {
+		t.Fatalf("Expected a blocked bucket to deny requests, got %v, %+v", ok, next)
+	}
+}
+
+func TestMaxDebtNanos(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.MaxDebtMillis = proto.Int64(5000)
+
+	if d := MaxDebtNanos(context.Background(), cfg); d != 5e9 {
+		t.Fatalf("Expected the bucket's max debt, got %v", d)
+	}
+
+	if d := MaxDebtNanos(quotaservice.WithStrict(context.Background()), cfg); d != 0 {
+		t.Fatalf("Expected no debt for a strict request, got %v", d)
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/square/quotaservice/protos"
+)
+
+// AllowBytes reserves numBytes tokens on a byte-based bucket, blocking if necessary until they are
+// available, as AllowBlocking does.
+func (c *Client) AllowBytes(namespace, bucket string, numBytes int64) error {
+	if numBytes < 1 {
+		// Requests for 0 tokens are invalid, so reserve at least 1.
+		numBytes = 1
+	}
+
+	return c.AllowBlocking(&quotaservice.AllowRequest{
+		Namespace:       namespace,
+		BucketName:      bucket,
+		TokensRequested: numBytes})
+}
+
+// ChargeBytes reconciles bytes reserved with AllowBytes with the actual number of bytes used.
+func (c *Client) ChargeBytes(namespace, bucket string, reservedBytes, actualBytes int64) error {
+	if reservedBytes < 1 {
+		reservedBytes = 1
+	}
+
+	rsp, err := c.Charge(&quotaservice.ChargeRequest{
+		Namespace:      namespace,
+		BucketName:     bucket,
+		TokensReserved: reservedBytes,
+		ActualCost:     actualBytes})
+	if err != nil {
+		return err
+	}
+
+	if rsp.Status != quotaservice.ChargeResponse_OK {
+		return errors.New(quotaservice.ChargeResponse_Status_name[int32(rsp.Status)])
+	}
+
+	return nil
+}
+
+// LimitBytes wraps an http.Handler, charging the size of each request and response body to a
+// byte-based bucket. The request's Content-Length is reserved before calling next, and requests
+// that can't be granted get a 429. Once next returns, the reservation is reconciled with the number
+// of bytes actually read and written.
+func (c *Client) LimitBytes(namespace, bucket string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reserved := r.ContentLength
+		if err := c.AllowBytes(namespace, bucket, reserved); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		cw := &countingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+
+		// The response has been sent, so there's nothing useful to do with an error here.
+		_ = c.ChargeBytes(namespace, bucket, reserved, body.n+cw.n)
+	})
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
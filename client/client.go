@@ -11,21 +11,42 @@ import (
 
 // Client is a QuotaService client class, adding syntactic sugar over the raw gRPC calls.
 type Client struct {
-	cc       *grpc.ClientConn
-	qsClient quotaservice.QuotaServiceClient
+	cc        *grpc.ClientConn
+	qsClient  quotaservice.QuotaServiceClient
+	throttler Throttler
+}
+
+// SetThrottler sets a Throttler that can reject Allow requests without calling the server, such as
+// one created by NewAdaptiveThrottler. Requests it rejects get a REJECTED_TIMEOUT response. It must
+// be called before the client is used.
+func (c *Client) SetThrottler(t Throttler) {
+	c.throttler = t
 }
 
 // Allow invokes "Allow()" on the "AllowService", taking in a raw AllowRequest message and
 // returning the raw AllowResponse message, and optionally any error encountered.
 func (c *Client) Allow(request *quotaservice.AllowRequest) (*quotaservice.AllowResponse, error) {
-	return c.qsClient.Allow(context.Background(), request)
+	if c.throttler == nil {
+		return c.qsClient.Allow(context.Background(), request)
+	}
+
+	if c.throttler.Throttle(request.Namespace, request.BucketName) {
+		return &quotaservice.AllowResponse{Status: quotaservice.AllowResponse_REJECTED_TIMEOUT}, nil
+	}
+
+	response, err := c.qsClient.Allow(context.Background(), request)
+	if err == nil {
+		c.throttler.Observe(request.Namespace, request.BucketName, response.Status == quotaservice.AllowResponse_OK)
+	}
+
+	return response, err
 }
 
 // AllowBlocking adds some syntactic sugar, parsing the response from the QuotaService and blocking,
 // if necessary, until the requested quota is available. If this method doesn't return an error
 // response, it means quota has been granted and is usable by the time the method returns.
 func (c *Client) AllowBlocking(request *quotaservice.AllowRequest) error {
-	response, err := c.qsClient.Allow(context.Background(), request)
+	response, err := c.Allow(request)
 	if err != nil {
 		return err
 	}
@@ -42,6 +63,12 @@ func (c *Client) AllowBlocking(request *quotaservice.AllowRequest) error {
 	return nil
 }
 
+// Charge invokes "Charge()" on the "QuotaService", taking in a raw ChargeRequest message and
+// returning the raw ChargeResponse message, and optionally any error encountered.
+func (c *Client) Charge(request *quotaservice.ChargeRequest) (*quotaservice.ChargeResponse, error) {
+	return c.qsClient.Charge(context.Background(), request)
+}
+
 // Close releases any resources associated with client connections.
 func (c *Client) Close() error {
 	return c.cc.Close()
@@ -56,5 +83,5 @@ func New(target string, opts ...grpc.DialOption) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{conn, quotaservice.NewQuotaServiceClient(conn)}, nil
+	return &Client{cc: conn, qsClient: quotaservice.NewQuotaServiceClient(conn)}, nil
 }
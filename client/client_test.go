@@ -1,19 +1,28 @@
 package client
 
 import (
+	"io/ioutil"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice"
 	"github.com/square/quotaservice/buckets/memory"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/events"
 	pb "github.com/square/quotaservice/protos"
+	pbconfig "github.com/square/quotaservice/protos/config"
 	qsgrpc "github.com/square/quotaservice/rpc/grpc"
 	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 const target = "localhost:10990"
@@ -33,15 +42,25 @@ func setUp() {
 	cfg.GlobalDefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
 	nsc := config.NewDefaultNamespaceConfig("delaying")
 	bc := config.NewDefaultBucketConfig("delaying")
-	bc.Size = 1 // Very small.
-	bc.FillRate = 100
+	bc.Size = proto.Int64(1) // Very small.
+	bc.FillRate = proto.Int64(100)
 
 	helpers.PanicError(config.AddBucket(nsc, bc))
 	helpers.PanicError(config.AddNamespace(cfg, nsc))
 
+	bytesNsc := config.NewDefaultNamespaceConfig("bytes")
+	bytesNsc.TokenUnit = pbconfig.TokenUnit_BYTES
+	bytesBc := config.NewDefaultBucketConfig("bytes")
+	bytesBc.Size = proto.Int64(1000)
+	bytesBc.FillRate = proto.Int64(1)
+	bytesBc.MaxTokensPerRequest = proto.Int64(1000)
+	bytesBc.MaxDebtMillis = proto.Int64(1) // Effectively no debt.
+	helpers.PanicError(config.AddBucket(bytesNsc, bytesBc))
+	helpers.PanicError(config.AddNamespace(cfg, bytesNsc))
+
 	server = quotaservice.New(memory.NewBucketFactory(),
 		config.NewMemoryConfig(cfg),
-		quotaservice.NewReaperConfigForTests(),
+		qstesting.NewReaperConfig(),
 		0,
 		qsgrpc.New(target, events.NewNilProducer()))
 
@@ -102,3 +121,99 @@ func TestBlockingClient(t *testing.T) {
 	}
 
 }
+
+func TestHealthCheck(t *testing.T) {
+	conn, err := grpc.Dial(target, grpc.WithInsecure())
+	helpers.CheckError(t, err)
+	defer conn.Close()
+
+	for _, service := range []string{"", "quotaservice.QuotaService"} {
+		resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		helpers.CheckError(t, err)
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Fatalf("Expected %q to be SERVING. Was %v", service, resp.Status)
+		}
+	}
+}
+
+func TestLimitBytes(t *testing.T) {
+	client, err := New(target, grpc.WithInsecure())
+	helpers.CheckError(t, err)
+
+	handler := client.LimitBytes("bytes", "bytes", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		_, _ = w.Write([]byte(strings.Repeat("x", 50)))
+	}))
+
+	// Reserves the 100 byte request, then charges for the 50 byte response too.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 100))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected request to be allowed. Was %v", rec.Code)
+	}
+
+	allow := func(n int64) pb.AllowResponse_Status {
+		resp, err := client.Allow(&pb.AllowRequest{Namespace: "bytes", BucketName: "bytes", TokensRequested: n, MaxWaitTimeOverride: true})
+		helpers.CheckError(t, err)
+		return resp.Status
+	}
+
+	if s := allow(851); s != pb.AllowResponse_REJECTED_TIMEOUT {
+		t.Fatalf("Expected only 850 bytes to remain. Was %v", s)
+	}
+	if s := allow(850); s != pb.AllowResponse_OK {
+		t.Fatalf("Expected 850 bytes to remain. Was %v", s)
+	}
+}
+
+func TestAdaptiveThrottler(t *testing.T) {
+	th := NewAdaptiveThrottler(2, time.Minute).(*adaptiveThrottler)
+	now := time.Unix(1000, 0)
+	th.now = func() time.Time { return now }
+	th.random = func() float64 { return 0.5 }
+
+	// Granted requests are never throttled.
+	for i := 0; i < 100; i++ {
+		if th.Throttle("ns", "b") {
+			t.Fatal("Expected requests not to be throttled while they're granted")
+		}
+		th.Observe("ns", "b", true)
+	}
+
+	// Sustained denials are throttled, for this bucket only.
+	throttled := 0
+	for i := 0; i < 1000; i++ {
+		if th.Throttle("ns", "b") {
+			throttled++
+		} else {
+			th.Observe("ns", "b", false)
+		}
+	}
+
+	if throttled == 0 || th.Throttle("ns", "other") {
+		t.Fatalf("Expected only denied requests to be throttled, throttled %v", throttled)
+	}
+
+	// Counts decay, so throttling stops.
+	now = now.Add(time.Hour)
+	if th.Throttle("ns", "b") {
+		t.Fatal("Expected throttling to stop once denials are forgotten")
+	}
+}
+
+type rejectingThrottler struct{}
+
+func (rejectingThrottler) Throttle(_, _ string) bool   { return true }
+func (rejectingThrottler) Observe(_, _ string, _ bool) {}
+
+func TestClientThrottling(t *testing.T) {
+	client, err := New(target, grpc.WithInsecure())
+	helpers.CheckError(t, err)
+	client.SetThrottler(rejectingThrottler{})
+
+	resp, err := client.Allow(&pb.AllowRequest{Namespace: "delaying", BucketName: "delaying", TokensRequested: 1})
+	helpers.CheckError(t, err)
+	if resp.Status != pb.AllowResponse_REJECTED_TIMEOUT {
+		t.Fatalf("Expected the request to be rejected locally. Was %v", resp.Status)
+	}
+}
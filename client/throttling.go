@@ -0,0 +1,101 @@
+package client
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Throttler decides whether to reject requests on the client, without calling the server.
+type Throttler interface {
+	// Throttle returns true if a request for tokens from a bucket should be rejected locally.
+	Throttle(namespace, bucket string) bool
+	// Observe records whether the server granted a request that wasn't throttled.
+	Observe(namespace, bucket string, granted bool)
+}
+
+// adaptiveThrottler implements client-side adaptive throttling, as described in the "Handling
+// Overload" chapter of the Google SRE book. For each bucket, it tracks the requests made and the
+// requests the server granted over a recent window, and rejects requests locally with probability
+// max(0, (requests - k * granted) / (requests + 1)).
+type adaptiveThrottler struct {
+	k      float64
+	window time.Duration
+	now    func() time.Time
+	random func() float64
+
+	sync.Mutex
+	buckets map[string]*throttleState
+}
+
+type throttleState struct {
+	// Exponentially decaying counts of requests and grants.
+	requests, granted float64
+	updated           time.Time
+}
+
+// NewAdaptiveThrottler creates a Throttler that rejects requests locally as a bucket's recent
+// grant rate falls, so that a caller in sustained overage doesn't waste round trips on requests the
+// server is bound to reject. Counts decay over window, e.g. 2 minutes. k is the multiple of granted
+// requests that can be sent before requests are throttled; lower values throttle more
+// aggressively. 2 is a reasonable default.
+func NewAdaptiveThrottler(k float64, window time.Duration) Throttler {
+	if k < 1 {
+		panic("k must be at least 1")
+	}
+
+	if window <= 0 {
+		panic("window must be positive")
+	}
+
+	return &adaptiveThrottler{
+		k:       k,
+		window:  window,
+		now:     time.Now,
+		random:  rand.Float64,
+		buckets: make(map[string]*throttleState)}
+}
+
+// state returns a bucket's state, with its counts decayed to now. The throttler must be locked.
+func (t *adaptiveThrottler) state(namespace, bucket string) *throttleState {
+	key := namespace + ":" + bucket
+	now := t.now()
+	s := t.buckets[key]
+	if s == nil {
+		s = &throttleState{updated: now}
+		t.buckets[key] = s
+		return s
+	}
+
+	decay := math.Exp(-float64(now.Sub(s.updated)) / float64(t.window))
+	s.requests *= decay
+	s.granted *= decay
+	s.updated = now
+
+	return s
+}
+
+func (t *adaptiveThrottler) Throttle(namespace, bucket string) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	s := t.state(namespace, bucket)
+	p := (s.requests - t.k*s.granted) / (s.requests + 1)
+	// Requests rejected locally still count, so that rejection eases off once the server grants
+	// requests again.
+	s.requests++
+
+	return p > 0 && t.random() < p
+}
+
+func (t *adaptiveThrottler) Observe(namespace, bucket string, granted bool) {
+	if !granted {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.state(namespace, bucket).granted++
+}
@@ -0,0 +1,92 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Command quotaservice runs a quota server assembled from a config file, environment variables and
+// flags, as described by package serverconfig. For example:
+//
+//	quotaservice -config /etc/quotaservice/server.yaml
+//
+// On SIGHUP, the service config file is re-read and any changes applied. Settings are re-read too,
+// but changes to them are only logged, as they take effect on restart.
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/square/quotaservice/logging"
+	"github.com/square/quotaservice/serverconfig"
+)
+
+const (
+	shutdownTimeout = 10 * time.Second
+
+	// reloadUser is recorded as the user making config updates reloaded on SIGHUP.
+	reloadUser = "sighup"
+)
+
+func main() {
+	settings, err := serverconfig.Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		logging.Fatalf("Unable to load settings: %v", err)
+	}
+
+	server, err := settings.NewServer(nil)
+	if err != nil {
+		logging.Fatalf("Unable to create server: %v", err)
+	}
+
+	if _, err := server.Start(); err != nil {
+		logging.Fatalf("Unable to start server: %v", err)
+	}
+
+	var admin *http.Server
+	if settings.AdminAddress != "" {
+		logging.Printf("Starting admin server on %v", settings.AdminAddress)
+		mux := http.NewServeMux()
+		server.ServeAdminConsole(mux, settings.AdminAssets, false)
+		admin = &http.Server{Addr: settings.AdminAddress, Handler: mux}
+
+		go func() {
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logging.Fatalf("Admin server failed: %v", err)
+			}
+		}()
+	}
+
+	// Reload the service config file on SIGHUP, e.g. after a mounted config map changes, and block
+	// until SIGTERM or SIGINT
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	for sig := <-sigs; sig == syscall.SIGHUP; sig = <-sigs {
+		if reloaded, err := serverconfig.Load(os.Args[1:], os.LookupEnv); err != nil {
+			logging.Printf("Unable to reload settings, keeping the current ones: %v", err)
+		} else if changed := settings.ChangedSettings(reloaded); len(changed) > 0 {
+			logging.Printf("Ignoring changes to settings %v, which only take effect on restart", changed)
+		}
+
+		updated, err := settings.ReloadServiceConfig(server.GetServerAdministrable(), reloadUser)
+		switch {
+		case err != nil:
+			logging.Printf("Unable to reload %v: %v", settings.ServiceConfigFile, err)
+		case updated:
+			logging.Printf("Reloaded %v", settings.ServiceConfigFile)
+		default:
+			logging.Printf("No changes to reload")
+		}
+	}
+
+	if admin != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		_ = admin.Shutdown(ctx)
+		cancel()
+	}
+
+	if _, err := server.Stop(); err != nil {
+		logging.Printf("Error stopping server: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+// BundleFormatVersion is the version of the bundle format produced by NewBundle.
+const BundleFormatVersion = 1
+
+var (
+	// ErrBundleSignature is returned when opening a bundle that wasn't signed with the expected
+	// key, or has been modified since it was signed.
+	ErrBundleSignature = errors.New("config bundle signature is invalid")
+	// ErrBundleFormat is returned when opening a bundle of an unsupported format version.
+	ErrBundleFormat = errors.New("unsupported config bundle format")
+)
+
+// Bundle is a complete ServiceConfig, with metadata, signed so that it can be promoted between
+// environments (e.g. from staging to production) without being tampered with.
+type Bundle struct {
+	FormatVersion int    `json:"formatVersion"`
+	ConfigVersion int32  `json:"configVersion"`
+	ExportedAt    int64  `json:"exportedAt"`
+	ExportedBy    string `json:"exportedBy"`
+	// Config is the serialized ServiceConfig.
+	Config []byte `json:"config"`
+	// Signature is the hex-encoded HMAC-SHA256 of the bundle's other fields.
+	Signature string `json:"signature"`
+}
+
+// NewBundle exports cfg as a bundle signed with key, on behalf of user.
+func NewBundle(cfg *pb.ServiceConfig, key []byte, user string, now time.Time) (*Bundle, error) {
+	if len(key) == 0 {
+		return nil, errors.New("a key is needed to sign config bundles")
+	}
+
+	serialized, err := proto.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		FormatVersion: BundleFormatVersion,
+		ConfigVersion: cfg.Version,
+		ExportedAt:    now.Unix(),
+		ExportedBy:    user,
+		Config:        serialized}
+	b.Signature = b.sign(key)
+
+	return b, nil
+}
+
+// OpenBundle verifies that a bundle was signed with key, returning the config it contains.
+func OpenBundle(b *Bundle, key []byte) (*pb.ServiceConfig, error) {
+	if len(key) == 0 {
+		return nil, errors.New("a key is needed to verify config bundles")
+	}
+
+	if b.FormatVersion != BundleFormatVersion {
+		return nil, ErrBundleFormat
+	}
+
+	if !hmac.Equal([]byte(b.Signature), []byte(b.sign(key))) {
+		return nil, ErrBundleSignature
+	}
+
+	return UnmarshalBytes(b.Config)
+}
+
+func (b *Bundle) sign(key []byte) string {
+	var payload bytes.Buffer
+	fmt.Fprintf(&payload, "%d\n%d\n%d\n%q\n", b.FormatVersion, b.ConfigVersion, b.ExportedAt, b.ExportedBy)
+	payload.Write(b.Config)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload.Bytes())
+	return hex.EncodeToString(mac.Sum(nil))
+}
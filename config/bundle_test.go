@@ -0,0 +1,61 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestBundle(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Version = 12
+	key := []byte("secret")
+
+	b, err := NewBundle(cfg, key, "alice", time.Unix(1000, 0))
+	if err != nil {
+		t.Fatalf("NewBundle errored: %+v", err)
+	}
+
+	if b.FormatVersion != BundleFormatVersion || b.ConfigVersion != 12 || b.ExportedAt != 1000 || b.ExportedBy != "alice" {
+		t.Fatalf("Unexpected bundle metadata: %+v", b)
+	}
+
+	opened, err := OpenBundle(b, key)
+	if err != nil {
+		t.Fatalf("OpenBundle errored: %+v", err)
+	}
+
+	if !proto.Equal(opened, cfg) {
+		t.Fatalf("Expected %+v, got %+v", cfg, opened)
+	}
+
+	if _, err := OpenBundle(b, []byte("wrong")); err != ErrBundleSignature {
+		t.Errorf("Expected ErrBundleSignature with the wrong key, got %v", err)
+	}
+
+	tampered := *b
+	tampered.ExportedBy = "mallory"
+	if _, err := OpenBundle(&tampered, key); err != ErrBundleSignature {
+		t.Errorf("Expected ErrBundleSignature for tampered metadata, got %v", err)
+	}
+
+	tampered = *b
+	tampered.Config = append(append([]byte{}, b.Config...), 0)
+	if _, err := OpenBundle(&tampered, key); err != ErrBundleSignature {
+		t.Errorf("Expected ErrBundleSignature for a tampered config, got %v", err)
+	}
+
+	tampered = *b
+	tampered.FormatVersion = BundleFormatVersion + 1
+	if _, err := OpenBundle(&tampered, key); err != ErrBundleFormat {
+		t.Errorf("Expected ErrBundleFormat, got %v", err)
+	}
+
+	if _, err := NewBundle(cfg, nil, "alice", time.Now()); err == nil {
+		t.Error("Expected an error signing without a key")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/config/cloudpersisters/google"
 	pb "github.com/square/quotaservice/protos/config"
@@ -108,7 +109,7 @@ func consume(c <-chan struct{}, maxWait time.Duration) {
 
 func updateConfig(cfg *pb.ServiceConfig) {
 	cfg.GlobalDefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
-	cfg.GlobalDefaultBucket.FillRate = rand.Int63()
+	cfg.GlobalDefaultBucket.FillRate = proto.Int64(rand.Int63())
 	counter++
 	cfg.User = fmt.Sprintf("user-%v", counter)
 	cfg.Date = time.Now().Unix()
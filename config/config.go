@@ -12,9 +12,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"path"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/events"
 	"github.com/square/quotaservice/logging"
 	pb "github.com/square/quotaservice/protos/config"
 	"gopkg.in/yaml.v2"
@@ -24,17 +27,55 @@ const (
 	GlobalNamespace           = "___GLOBAL___"
 	DefaultBucketName         = "___DEFAULT_BUCKET___"
 	DynamicBucketTemplateName = "___DYNAMIC_BUCKET_TPL___"
+	QuotaGroupNamespace       = "___QUOTA_GROUP___"
 	initialVersion            = 0
 	initialHash               = "___INITIAL_HASH___"
 )
 
 func ApplyDefaults(sc *pb.ServiceConfig) {
+	for name, t := range sc.BucketTemplates {
+		if t == nil {
+			t = &pb.BucketConfig{}
+			sc.BucketTemplates[name] = t
+		}
+
+		// Templates are partial; defaults are applied once they are resolved against a bucket.
+		t.Name = name
+	}
+
+	for name, t := range sc.NamespaceTemplates {
+		if t == nil {
+			t = &pb.NamespaceConfig{}
+			sc.NamespaceTemplates[name] = t
+		}
+
+		// Defaults are applied once a namespace is created from the template.
+		t.Name = name
+	}
+
 	if sc.GlobalDefaultBucket != nil {
-		ApplyBucketDefaults(sc.GlobalDefaultBucket)
+		applyUntemplatedBucketDefaults(sc.GlobalDefaultBucket)
 		sc.GlobalDefaultBucket.Name = DefaultBucketName
 	}
 
+	for name, g := range sc.QuotaGroups {
+		if g == nil {
+			g = &pb.BucketConfig{}
+			sc.QuotaGroups[name] = g
+		}
+
+		ApplyBucketDefaults(g)
+		g.Name = name
+		g.Namespace = QuotaGroupNamespace
+	}
+
 	for name, ns := range sc.Namespaces {
+		// Entries without settings, e.g. "name:" in YAML, are empty rather than nil.
+		if ns == nil {
+			ns = &pb.NamespaceConfig{}
+			sc.Namespaces[name] = ns
+		}
+
 		ns.Name = name
 		if ns.DefaultBucket != nil && ns.DynamicBucketTemplate != nil {
 			panic(fmt.Sprintf("Namespace %v is not allowed to have a default bucket as well as allow dynamic buckets.", name))
@@ -45,20 +86,32 @@ func ApplyDefaults(sc *pb.ServiceConfig) {
 			ns.Buckets = make(map[string]*pb.BucketConfig)
 		}
 
+		// Buckets in namespaces that inherit defaults are kept sparse, so that unset settings are
+		// inherited when they are resolved.
+		applyDefaults := applyUntemplatedBucketDefaults
+		if ns.InheritDefaults {
+			applyDefaults = func(*pb.BucketConfig) {}
+		}
+
 		if ns.DefaultBucket != nil {
-			ApplyBucketDefaults(ns.DefaultBucket)
+			applyDefaults(ns.DefaultBucket)
 			ns.DefaultBucket.Name = DefaultBucketName
 			ns.DefaultBucket.Namespace = ns.Name
 		}
 
 		if ns.DynamicBucketTemplate != nil {
-			ApplyBucketDefaults(ns.DynamicBucketTemplate)
+			applyDefaults(ns.DynamicBucketTemplate)
 			ns.DynamicBucketTemplate.Name = DynamicBucketTemplateName
 			ns.DynamicBucketTemplate.Namespace = ns.Name
 		}
 
 		for n, b := range ns.Buckets {
-			ApplyBucketDefaults(b)
+			if b == nil {
+				b = &pb.BucketConfig{}
+				ns.Buckets[n] = b
+			}
+
+			applyDefaults(b)
 			b.Name = n
 			b.Namespace = ns.Name
 		}
@@ -79,29 +132,512 @@ func NamespaceNames(sc *pb.ServiceConfig) []string {
 }
 
 func ApplyBucketDefaults(b *pb.BucketConfig) {
-	if b.Size == 0 {
-		b.Size = 100
+	if b.Size == nil {
+		b.Size = proto.Int64(100)
+	}
+
+	if b.FillRate == nil {
+		b.FillRate = proto.Int64(50)
+	}
+
+	if b.WaitTimeoutMillis == nil {
+		b.WaitTimeoutMillis = proto.Int64(1000)
+	}
+
+	if b.MaxIdleMillis == nil {
+		b.MaxIdleMillis = proto.Int64(-1)
+	}
+
+	if b.MaxDebtMillis == nil {
+		b.MaxDebtMillis = proto.Int64(10000)
+	}
+
+	if b.MaxTokensPerRequest == nil {
+		b.MaxTokensPerRequest = proto.Int64(b.GetFillRate())
+	}
+}
+
+// overrideBucketSettings overrides dst's settings with those set on src.
+func overrideBucketSettings(dst, src *pb.BucketConfig) {
+	for _, f := range []struct {
+		dst **int64
+		src *int64
+	}{
+		{&dst.Size, src.Size},
+		{&dst.FillRate, src.FillRate},
+		{&dst.WaitTimeoutMillis, src.WaitTimeoutMillis},
+		{&dst.MaxIdleMillis, src.MaxIdleMillis},
+		{&dst.MaxDebtMillis, src.MaxDebtMillis},
+		{&dst.MaxTokensPerRequest, src.MaxTokensPerRequest},
+		{&dst.SampleRate, src.SampleRate},
+		{&dst.MaxBorrowedTokens, src.MaxBorrowedTokens},
+		{&dst.SoftLimitPercent, src.SoftLimitPercent},
+		{&dst.NotificationWindowMillis, src.NotificationWindowMillis},
+		{&dst.MaxWaitOverrideMillis, src.MaxWaitOverrideMillis},
+	} {
+		if f.src != nil {
+			*f.dst = proto.Int64(*f.src)
+		}
+	}
+
+	if src.QuotaGroup != "" {
+		dst.QuotaGroup = src.QuotaGroup
+	}
+
+	if len(src.BorrowFrom) > 0 {
+		dst.BorrowFrom = src.BorrowFrom
+	}
+
+	if len(src.NotificationThresholds) > 0 {
+		dst.NotificationThresholds = src.NotificationThresholds
+	}
+
+	if len(src.Metadata) > 0 {
+		dst.Metadata = MergeMetadata(dst.Metadata, src.Metadata)
+	}
+
+	if len(src.Labels) > 0 {
+		dst.Labels = MergeMetadata(dst.Labels, src.Labels)
+	}
+}
+
+// MergeMetadata returns the entries of base overridden by those of overrides. Neither map is
+// modified, and either is returned as is if the other is empty.
+func MergeMetadata(base, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+
+	if len(base) == 0 {
+		return overrides
+	}
+
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+
+	for k, v := range overrides {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// BucketLabels returns the labels attributing usage of a bucket: those of its namespace, overridden
+// by those of the bucket serving requests for bucketName, which is the statically defined bucket,
+// a dynamic bucket created from the namespace's template, or the namespace's default bucket. Buckets
+// in namespaces that don't exist are served by the global default bucket.
+func BucketLabels(sc *pb.ServiceConfig, namespace, bucketName string) map[string]string {
+	n := sc.Namespaces[namespace]
+	if n == nil {
+		return ResolveBucketTemplate(sc, sc.GlobalDefaultBucket).GetLabels()
+	}
+
+	b := n.Buckets[bucketName]
+	if b == nil {
+		b = n.DynamicBucketTemplate
+	}
+
+	if b == nil {
+		b = n.DefaultBucket
+	}
+
+	return MergeMetadata(n.Labels, ResolveBucketConfig(sc, n, b).GetLabels())
+}
+
+// applyUntemplatedBucketDefaults applies defaults to a bucket, unless it references a bucket
+// template, in which case unset fields must remain unset so they are inherited from the template.
+func applyUntemplatedBucketDefaults(b *pb.BucketConfig) {
+	if b.Template == "" {
+		ApplyBucketDefaults(b)
+	}
+}
+
+// ResolveBucketTemplate returns the effective config of a bucket: a copy of the bucket template it
+// references, overridden by any fields set on the bucket itself, with defaults applied. Buckets
+// that don't reference a template are returned as is.
+func ResolveBucketTemplate(sc *pb.ServiceConfig, b *pb.BucketConfig) *pb.BucketConfig {
+	if b == nil || b.Template == "" {
+		return b
+	}
+
+	resolved := &pb.BucketConfig{}
+	if t := sc.BucketTemplates[b.Template]; t != nil {
+		resolved = proto.Clone(t).(*pb.BucketConfig)
+	}
+
+	resolved.Name = b.Name
+	resolved.Namespace = b.Namespace
+	resolved.Template = b.Template
+	overrideBucketSettings(resolved, b)
+
+	ApplyBucketDefaults(resolved)
+	return resolved
+}
+
+// ResolveBucketConfig returns the effective config of a bucket in a namespace. In namespaces that
+// inherit defaults, the bucket's settings are layered, from lowest to highest precedence, on the
+// built-in defaults, the global default bucket, the namespace's default bucket, and the bucket's
+// template. Otherwise, it is the same as ResolveBucketTemplate.
+func ResolveBucketConfig(sc *pb.ServiceConfig, n *pb.NamespaceConfig, b *pb.BucketConfig) *pb.BucketConfig {
+	if b == nil || !n.GetInheritDefaults() {
+		return ResolveBucketTemplate(sc, b)
+	}
+
+	layers := []*pb.BucketConfig{ResolveBucketTemplate(sc, sc.GlobalDefaultBucket)}
+	if n.DefaultBucket != nil && n.DefaultBucket != b {
+		layers = append(layers, sc.BucketTemplates[n.DefaultBucket.Template], n.DefaultBucket)
+	}
+	layers = append(layers, sc.BucketTemplates[b.Template], b)
+
+	resolved := &pb.BucketConfig{}
+	for _, l := range layers {
+		if l != nil {
+			overrideBucketSettings(resolved, l)
+		}
+	}
+
+	resolved.Name = b.Name
+	resolved.Namespace = b.Namespace
+	resolved.Template = b.Template
+
+	ApplyBucketDefaults(resolved)
+	return resolved
+}
+
+// ValidateBucketTemplates checks that every bucket that references a bucket template refers to one
+// that exists, and that templates don't themselves reference templates.
+func ValidateBucketTemplates(sc *pb.ServiceConfig) error {
+	for name, t := range sc.BucketTemplates {
+		if t.Template != "" {
+			return fmt.Errorf("bucket template %v cannot reference another template", name)
+		}
+	}
+
+	for _, b := range allBuckets(sc) {
+		if b.Template == "" {
+			continue
+		}
+
+		if _, exists := sc.BucketTemplates[b.Template]; !exists {
+			return fmt.Errorf("bucket %v: no such bucket template %v", FQN(b), b.Template)
+		}
+	}
+
+	return nil
+}
+
+// ValidateBuckets checks that the resolved config of every bucket is valid, including the global
+// default bucket, namespaces' default buckets and dynamic bucket templates, as are bucket templates
+// themselves.
+func ValidateBuckets(sc *pb.ServiceConfig) error {
+	for _, t := range sc.BucketTemplates {
+		if t == nil {
+			continue
+		}
+
+		if err := ValidateBucketConfig(t); err != nil {
+			return err
+		}
+	}
+
+	if sc.GlobalDefaultBucket != nil {
+		if err := ValidateBucketConfig(ResolveBucketTemplate(sc, sc.GlobalDefaultBucket)); err != nil {
+			return err
+		}
+	}
+
+	for _, ns := range sc.Namespaces {
+		if ns == nil {
+			continue
+		}
+
+		for _, b := range namespaceBuckets(ns) {
+			if b == nil {
+				continue
+			}
+
+			if err := ValidateBucketConfig(ResolveBucketConfig(sc, ns, b)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ChangedBucketTemplates returns the names of bucket templates that were added, removed or changed
+// between two configs.
+func ChangedBucketTemplates(c1, c2 *pb.ServiceConfig) map[string]bool {
+	changed := make(map[string]bool)
+	for name, t1 := range c1.GetBucketTemplates() {
+		if DifferentBucketConfigs(t1, c2.GetBucketTemplates()[name]) {
+			changed[name] = true
+		}
+	}
+
+	for name := range c2.GetBucketTemplates() {
+		if _, exists := c1.GetBucketTemplates()[name]; !exists {
+			changed[name] = true
+		}
+	}
+
+	return changed
+}
+
+// UsesBucketTemplates returns whether any of a namespace's buckets reference one of the given
+// bucket templates.
+func UsesBucketTemplates(n *pb.NamespaceConfig, templates map[string]bool) bool {
+	if len(templates) == 0 {
+		return false
+	}
+
+	for _, b := range namespaceBuckets(n) {
+		if templates[b.Template] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allBuckets returns the configs of the global default bucket and all buckets in all namespaces,
+// including default buckets and dynamic bucket templates.
+func allBuckets(sc *pb.ServiceConfig) []*pb.BucketConfig {
+	var buckets []*pb.BucketConfig
+	if sc.GlobalDefaultBucket != nil {
+		buckets = append(buckets, sc.GlobalDefaultBucket)
+	}
+
+	for _, ns := range sc.Namespaces {
+		buckets = append(buckets, namespaceBuckets(ns)...)
+	}
+
+	return buckets
+}
+
+// namespaceBuckets returns the configs of a namespace's buckets, including its default bucket and
+// dynamic bucket template.
+func namespaceBuckets(n *pb.NamespaceConfig) []*pb.BucketConfig {
+	var buckets []*pb.BucketConfig
+	for _, b := range []*pb.BucketConfig{n.DefaultBucket, n.DynamicBucketTemplate} {
+		if b != nil {
+			buckets = append(buckets, b)
+		}
+	}
+
+	for _, b := range n.Buckets {
+		buckets = append(buckets, b)
+	}
+
+	return buckets
+}
+
+const (
+	// MaxFillRate is the highest supported fill rate, of one token per nanosecond.
+	MaxFillRate = int64(time.Second)
+	// MaxTokens is the largest supported bucket size or number of tokens per request. Bucket state is
+	// held in double-precision floats in Redis' Lua scripts, which can only represent integers up to
+	// 2^53 exactly.
+	MaxTokens = int64(1) << 53
+)
+
+// NanosBetweenTokens returns the interval, in nanos, at which a bucket is refilled. Fill rates
+// outside the supported range are clamped, so bucket implementations never divide by zero. Buckets
+// with a fill rate of 0 are blocked, and should deny requests before refilling; the interval
+// returned for them is that of 1 token a second.
+func NanosBetweenTokens(b *pb.BucketConfig) int64 {
+	if b.GetFillRate() <= 0 {
+		return int64(time.Second)
+	}
+
+	if b.GetFillRate() > MaxFillRate {
+		return 1
+	}
+
+	return int64(time.Second) / b.GetFillRate()
+}
+
+// MaxDebtNanos returns a bucket's max debt in nanos, clamped so that it neither overflows nor is
+// negative.
+func MaxDebtNanos(b *pb.BucketConfig) int64 {
+	if b.GetMaxDebtMillis() <= 0 {
+		return 0
+	}
+
+	if b.GetMaxDebtMillis() > math.MaxInt64/int64(time.Millisecond) {
+		return math.MaxInt64
+	}
+
+	return b.GetMaxDebtMillis() * int64(time.Millisecond)
+}
+
+// Blocked returns whether a bucket denies every request, because its fill rate is 0. Bucket
+// implementations check this defensively, since a bucket whose fill rate is unset gets a default
+// one.
+func Blocked(b *pb.BucketConfig) bool {
+	return b.GetFillRate() <= 0
+}
+
+// ValidateBucketConfig checks that a bucket's settings are in range, and that its size and fill
+// rate can be represented without overflowing or losing precision, which matters for byte-based
+// quotas with very large values. A fill rate explicitly set to zero is valid, and blocks the bucket.
+func ValidateBucketConfig(b *pb.BucketConfig) error {
+	if b.GetSize() < 0 || b.GetFillRate() < 0 || b.GetMaxTokensPerRequest() < 0 || b.GetSampleRate() < 0 || b.GetMaxBorrowedTokens() < 0 {
+		return fmt.Errorf("bucket %v: size, fill rate, max tokens per request, sample rate and max borrowed tokens cannot be negative", b.Name)
+	}
+
+	if b.GetSoftLimitPercent() < 0 || b.GetSoftLimitPercent() >= 100 {
+		return fmt.Errorf("bucket %v: soft limit percent %v must be between 0 and 99", b.Name, b.GetSoftLimitPercent())
+	}
+
+	for _, threshold := range b.NotificationThresholds {
+		if threshold < 1 || threshold > 100 {
+			return fmt.Errorf("bucket %v: notification threshold %v must be between 1 and 100", b.Name, threshold)
+		}
+	}
+
+	if b.GetNotificationWindowMillis() < 0 {
+		return fmt.Errorf("bucket %v: notification window cannot be negative", b.Name)
+	}
+
+	if b.GetWaitTimeoutMillis() < 0 || b.GetMaxDebtMillis() < 0 || b.GetMaxWaitOverrideMillis() < 0 {
+		return fmt.Errorf("bucket %v: wait timeout, max wait override and max debt cannot be negative", b.Name)
 	}
 
-	if b.FillRate == 0 {
-		b.FillRate = 50
+	if b.GetFillRate() > MaxFillRate {
+		return fmt.Errorf("bucket %v: fill rate %v exceeds the maximum of %v tokens/sec", b.Name, b.GetFillRate(), MaxFillRate)
 	}
 
-	if b.WaitTimeoutMillis == 0 {
-		b.WaitTimeoutMillis = 1000
+	// Durations are converted to nanos, which must not overflow.
+	maxMillis := math.MaxInt64 / int64(time.Millisecond)
+	if b.GetWaitTimeoutMillis() > maxMillis || b.GetMaxIdleMillis() > maxMillis || b.GetMaxDebtMillis() > maxMillis ||
+		b.GetNotificationWindowMillis() > maxMillis || b.GetMaxWaitOverrideMillis() > maxMillis {
+		return fmt.Errorf("bucket %v: wait timeout, max idle, max debt, notification window and max wait override cannot exceed %v millis",
+			b.Name, maxMillis)
 	}
 
-	if b.MaxIdleMillis == 0 {
-		b.MaxIdleMillis = -1
+	if b.GetSize() > MaxTokens || b.GetMaxTokensPerRequest() > MaxTokens {
+		return fmt.Errorf("bucket %v: size and max tokens per request cannot exceed %v", b.Name, MaxTokens)
 	}
 
-	if b.MaxDebtMillis == 0 {
-		b.MaxDebtMillis = 10000
+	// Sampled requests take SampleRate times the tokens requested, which must fit in the bucket.
+	if b.GetSampleRate() > 1 && b.GetMaxTokensPerRequest() > b.GetSize()/b.GetSampleRate() {
+		return fmt.Errorf("bucket %v: sample rate %v times max tokens per request %v exceeds the size %v", b.Name, b.GetSampleRate(), b.GetMaxTokensPerRequest(), b.GetSize())
 	}
 
-	if b.MaxTokensPerRequest == 0 {
-		b.MaxTokensPerRequest = b.FillRate
+	if b.GetFillRate() > 0 {
+		// Waiting for a full bucket's worth of tokens, in nanos, must not overflow.
+		nanosBetweenTokens := MaxFillRate / b.GetFillRate()
+		if b.GetSize() > math.MaxInt64/nanosBetweenTokens || b.GetMaxTokensPerRequest() > math.MaxInt64/nanosBetweenTokens {
+			return fmt.Errorf("bucket %v: size and max tokens per request are too large for fill rate %v", b.Name, b.GetFillRate())
+		}
 	}
+
+	return nil
+}
+
+// ValidateQuotaGroups checks that every bucket that draws from a quota group refers to one that
+// exists, and that quota groups don't themselves draw from other quota groups.
+func ValidateQuotaGroups(sc *pb.ServiceConfig) error {
+	for name, g := range sc.QuotaGroups {
+		if g.QuotaGroup != "" {
+			return fmt.Errorf("quota group %v cannot draw from another quota group", name)
+		}
+	}
+
+	for _, b := range allBuckets(sc) {
+		b = ResolveBucketConfig(sc, sc.Namespaces[b.Namespace], b)
+		if b.QuotaGroup == "" {
+			continue
+		}
+
+		if _, exists := sc.QuotaGroups[b.QuotaGroup]; !exists {
+			return fmt.Errorf("bucket %v: no such quota group %v", FQN(b), b.QuotaGroup)
+		}
+	}
+
+	return nil
+}
+
+// ValidateBorrowing checks that buckets only borrow tokens from other buckets statically defined
+// in the same namespace.
+func ValidateBorrowing(sc *pb.ServiceConfig) error {
+	for _, ns := range sc.Namespaces {
+		for _, b := range namespaceBuckets(ns) {
+			b = ResolveBucketConfig(sc, ns, b)
+			for _, sibling := range b.BorrowFrom {
+				if _, exists := ns.Buckets[sibling]; !exists || sibling == b.Name {
+					return fmt.Errorf("bucket %v: cannot borrow from %v, which isn't another bucket in namespace %v", FQN(b), sibling, ns.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateBucketPatterns checks that a namespace's deny-list and allow-list are valid path.Match
+// patterns.
+func ValidateBucketPatterns(n *pb.NamespaceConfig) error {
+	for _, patterns := range [][]string{n.DeniedBuckets, n.AllowedBuckets} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("namespace %v: invalid bucket pattern %q: %v", n.Name, p, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateSuppressedEvents checks that the event types a namespace suppresses exist.
+func ValidateSuppressedEvents(n *pb.NamespaceConfig) error {
+	for _, name := range n.SuppressedEvents {
+		if _, ok := events.ParseEventType(name); !ok {
+			return fmt.Errorf("namespace %v: unknown event type %q", n.Name, name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateFairShare checks that a namespace's fair-share rate and weights aren't negative.
+func ValidateFairShare(n *pb.NamespaceConfig) error {
+	if n.FairShareFillRate < 0 {
+		return fmt.Errorf("namespace %v: fair_share_fill_rate cannot be negative", n.Name)
+	}
+
+	for name, w := range n.FairShareWeights {
+		if w <= 0 {
+			return fmt.Errorf("namespace %v: fair share weight of bucket %v must be positive", n.Name, name)
+		}
+	}
+
+	return nil
+}
+
+// FairShareWeight returns the weight of a dynamic bucket's share of its namespace's
+// fair_share_fill_rate.
+func FairShareWeight(n *pb.NamespaceConfig, bucketName string) int64 {
+	if w, ok := n.FairShareWeights[bucketName]; ok {
+		return w
+	}
+
+	return 1
+}
+
+// MatchesBucketPattern returns whether a bucket name matches any of the given names or path.Match
+// patterns.
+func MatchesBucketPattern(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matched, _ := path.Match(p, name); matched {
+			return true
+		}
+	}
+
+	return false
 }
 
 func FQN(b *pb.BucketConfig) string {
@@ -131,15 +667,42 @@ func ReadConfig(yamlStream io.Reader) *pb.ServiceConfig {
 	return readConfigFromBytes(bytes)
 }
 
+// ParseConfigFile reads a YAML config, like ReadConfigFromFile, but returns errors rather than
+// panicking, for files that may be edited while the service runs.
+func ParseConfigFile(filename string) (*pb.ServiceConfig, error) {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseConfig(bytes)
+}
+
 func readConfigFromBytes(bytes []byte) *pb.ServiceConfig {
+	cfg, err := parseConfig(bytes)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read YAML. Error: %v", err))
+	}
+
+	return cfg
+}
+
+func parseConfig(bytes []byte) (*pb.ServiceConfig, error) {
 	cfg := NewDefaultServiceConfig()
 	cfg.GlobalDefaultBucket = nil
 	if err := yaml.Unmarshal(bytes, cfg); err != nil {
-		panic(fmt.Sprintf("Unable to read YAML. Error: %v", err))
+		return nil, err
+	}
+
+	// ApplyDefaults panics on this, which a file being edited shouldn't cause.
+	for name, ns := range cfg.Namespaces {
+		if ns != nil && ns.DefaultBucket != nil && ns.DynamicBucketTemplate != nil {
+			return nil, fmt.Errorf("namespace %v cannot have a default bucket as well as allow dynamic buckets", name)
+		}
 	}
 
 	ApplyDefaults(cfg)
-	return cfg
+	return cfg, nil
 }
 
 func NewDefaultServiceConfig() *pb.ServiceConfig {
@@ -159,11 +722,11 @@ func NewDefaultNamespaceConfig(name string) *pb.NamespaceConfig {
 
 func NewDefaultBucketConfig(name string) *pb.BucketConfig {
 	return &pb.BucketConfig{
-		Size:              100,
-		FillRate:          50,
-		WaitTimeoutMillis: 1000,
-		MaxIdleMillis:     -1,
-		MaxDebtMillis:     10000,
+		Size:              proto.Int64(100),
+		FillRate:          proto.Int64(50),
+		WaitTimeoutMillis: proto.Int64(1000),
+		MaxIdleMillis:     proto.Int64(-1),
+		MaxDebtMillis:     proto.Int64(10000),
 		Name:              name}
 }
 
@@ -234,6 +797,9 @@ func AddBucket(n *pb.NamespaceConfig, b *pb.BucketConfig) error {
 	if b.Name == "" {
 		return errors.New("Bucket name cannot be nil or empty.")
 	}
+	if err := ValidateBucketConfig(b); err != nil {
+		return err
+	}
 	n.Buckets[b.Name] = b
 	b.Namespace = n.Name
 	return nil
@@ -249,6 +815,19 @@ func AddNamespace(s *pb.ServiceConfig, n *pb.NamespaceConfig) error {
 	if n.Name == "" {
 		return errors.New("Namespace name cannot be nil or empty.")
 	}
+
+	if err := ValidateBucketPatterns(n); err != nil {
+		return err
+	}
+
+	if err := ValidateSuppressedEvents(n); err != nil {
+		return err
+	}
+
+	if err := ValidateFairShare(n); err != nil {
+		return err
+	}
+
 	s.Namespaces[n.Name] = n
 	return nil
 }
@@ -266,17 +845,97 @@ func DifferentBucketConfigs(c1, c2 *pb.BucketConfig) bool {
 
 	return c1.Name != c2.Name ||
 		c1.Namespace != c2.Namespace ||
-		c1.Size != c2.Size ||
-		c1.FillRate != c2.FillRate ||
-		c1.WaitTimeoutMillis != c2.WaitTimeoutMillis ||
-		c1.MaxIdleMillis != c2.MaxIdleMillis ||
-		c1.MaxDebtMillis != c2.MaxDebtMillis ||
-		c1.MaxTokensPerRequest != c2.MaxTokensPerRequest
+		!sameInt64(c1.Size, c2.Size) ||
+		!sameInt64(c1.FillRate, c2.FillRate) ||
+		!sameInt64(c1.WaitTimeoutMillis, c2.WaitTimeoutMillis) ||
+		!sameInt64(c1.MaxIdleMillis, c2.MaxIdleMillis) ||
+		!sameInt64(c1.MaxDebtMillis, c2.MaxDebtMillis) ||
+		!sameInt64(c1.MaxTokensPerRequest, c2.MaxTokensPerRequest) ||
+		c1.QuotaGroup != c2.QuotaGroup ||
+		c1.Template != c2.Template ||
+		!sameInt64(c1.SampleRate, c2.SampleRate) ||
+		!sameInt64(c1.MaxBorrowedTokens, c2.MaxBorrowedTokens) ||
+		!sameInt64(c1.SoftLimitPercent, c2.SoftLimitPercent) ||
+		!sameInt64(c1.NotificationWindowMillis, c2.NotificationWindowMillis) ||
+		!sameInt64(c1.MaxWaitOverrideMillis, c2.MaxWaitOverrideMillis) ||
+		!sameInt64s(c1.NotificationThresholds, c2.NotificationThresholds) ||
+		!sameStrings(c1.BorrowFrom, c2.BorrowFrom) ||
+		!sameStringMaps(c1.Metadata, c2.Metadata) ||
+		!sameStringMaps(c1.Labels, c2.Labels)
+}
+
+// sameInt64 compares optional settings, which differ if only one is set.
+func sameInt64(i1, i2 *int64) bool {
+	if i1 == nil || i2 == nil {
+		return i1 == i2
+	}
+
+	return *i1 == *i2
+}
+
+func sameStrings(s1, s2 []string) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+
+	for i := range s1 {
+		if s1[i] != s2[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameInt64s(i1, i2 []int64) bool {
+	if len(i1) != len(i2) {
+		return false
+	}
+
+	for i := range i1 {
+		if i1[i] != i2[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameWeights(m1, m2 map[string]int64) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+
+	for k, v := range m1 {
+		if w, ok := m2[k]; !ok || w != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameStringMaps(m1, m2 map[string]string) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+
+	for k, v1 := range m1 {
+		if v2, exists := m2[k]; !exists || v1 != v2 {
+			return false
+		}
+	}
+
+	return true
 }
 
 func DifferentNamespaceConfigs(c1, c2 *pb.NamespaceConfig) bool {
 	different := c1.Name != c2.Name ||
 		c1.MaxDynamicBuckets != c2.MaxDynamicBuckets ||
+		c1.InheritDefaults != c2.InheritDefaults ||
+		c1.NegativeCacheMillis != c2.NegativeCacheMillis ||
+		c1.FairShareFillRate != c2.FairShareFillRate ||
+		!sameWeights(c1.FairShareWeights, c2.FairShareWeights) ||
 		DifferentBucketConfigs(c1.DefaultBucket, c2.DefaultBucket) ||
 		DifferentBucketConfigs(c1.DynamicBucketTemplate, c2.DynamicBucketTemplate) ||
 		len(c1.Buckets) != len(c2.Buckets)
@@ -4,13 +4,18 @@
 package config
 
 import (
+	"io/ioutil"
+	"math"
+	"os"
 	"testing"
 
 	"github.com/square/quotaservice/test/helpers"
 
 	"strings"
 
+	"github.com/golang/protobuf/proto"
 	pbconfig "github.com/square/quotaservice/protos/config"
+	"gopkg.in/yaml.v2"
 )
 
 const cfgYaml = `namespaces:
@@ -107,28 +112,28 @@ func assertBucket(t *testing.T, name, namespace string, b *pbconfig.BucketConfig
 		t.Fatalf("bucket.Namespace is %v and not %v", b.Namespace, namespace)
 	}
 
-	if b.FillRate != fillRate {
-		t.Fatalf("Expected fill_rate of %v; was %v", fillRate, b.FillRate)
+	if b.GetFillRate() != fillRate {
+		t.Fatalf("Expected fill_rate of %v; was %v", fillRate, b.GetFillRate())
 	}
 
-	if b.WaitTimeoutMillis != waitTimeoutMillis {
-		t.Fatalf("Expected wait_timeout_millis of %v; was %v", waitTimeoutMillis, b.WaitTimeoutMillis)
+	if b.GetWaitTimeoutMillis() != waitTimeoutMillis {
+		t.Fatalf("Expected wait_timeout_millis of %v; was %v", waitTimeoutMillis, b.GetWaitTimeoutMillis())
 	}
 
-	if b.MaxIdleMillis != maxIdleMillis {
-		t.Fatalf("Expected max_idle_millis of %v; was %v", maxIdleMillis, b.MaxIdleMillis)
+	if b.GetMaxIdleMillis() != maxIdleMillis {
+		t.Fatalf("Expected max_idle_millis of %v; was %v", maxIdleMillis, b.GetMaxIdleMillis())
 	}
 
-	if b.MaxDebtMillis != maxDebtMillis {
-		t.Fatalf("Expected max_debt_millis of %v; was %v", maxDebtMillis, b.MaxDebtMillis)
+	if b.GetMaxDebtMillis() != maxDebtMillis {
+		t.Fatalf("Expected max_debt_millis of %v; was %v", maxDebtMillis, b.GetMaxDebtMillis())
 	}
 
-	if b.Size != size {
-		t.Fatalf("Expected bucket size of %v; was %v", size, b.Size)
+	if b.GetSize() != size {
+		t.Fatalf("Expected bucket size of %v; was %v", size, b.GetSize())
 	}
 
-	if b.MaxTokensPerRequest != maxTokensPerRequest {
-		t.Fatalf("Expected max tokens per request of %v; was %v", maxTokensPerRequest, b.MaxTokensPerRequest)
+	if b.GetMaxTokensPerRequest() != maxTokensPerRequest {
+		t.Fatalf("Expected max tokens per request of %v; was %v", maxTokensPerRequest, b.GetMaxTokensPerRequest())
 	}
 }
 
@@ -137,3 +142,405 @@ func TestNonexistentFile(t *testing.T) {
 		_ = ReadConfigFromFile("/does/not/exist")
 	})
 }
+
+func TestParseConfigFile(t *testing.T) {
+	if _, err := ParseConfigFile("/does/not/exist"); err == nil {
+		t.Error("Expected an error for a nonexistent file")
+	}
+
+	f, err := ioutil.TempFile("", "config")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	_, err = f.WriteString("namespaces:\n  ns:\n    name: ns\n")
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, f.Close())
+
+	cfg, err := ParseConfigFile(f.Name())
+	helpers.CheckError(t, err)
+	if cfg.Namespaces["ns"] == nil {
+		t.Fatalf("Expected namespace ns, got %+v", cfg)
+	}
+
+	helpers.CheckError(t, ioutil.WriteFile(f.Name(), []byte("namespaces: [unclosed"), 0644))
+	if _, err := ParseConfigFile(f.Name()); err == nil {
+		t.Error("Expected an error for invalid YAML")
+	}
+}
+
+func TestValidateBucketConfig(t *testing.T) {
+	b := NewDefaultBucketConfig("b")
+	b.Size = proto.Int64(1 << 40) // A terabyte
+	b.FillRate = proto.Int64(1 << 29)
+	b.MaxTokensPerRequest = proto.Int64(1 << 40)
+	if err := ValidateBucketConfig(b); err != nil {
+		t.Fatalf("Expected large byte-based bucket to be valid, got %v", err)
+	}
+
+	b.FillRate = proto.Int64(MaxFillRate + 1)
+	if ValidateBucketConfig(b) == nil {
+		t.Fatal("Expected fill rate above MaxFillRate to be invalid")
+	}
+
+	b.FillRate = proto.Int64(1)
+	if ValidateBucketConfig(b) == nil {
+		t.Fatal("Expected size whose wait time overflows to be invalid")
+	}
+
+	b.FillRate = proto.Int64(MaxFillRate)
+	b.Size = proto.Int64(MaxTokens + 1)
+	if ValidateBucketConfig(b) == nil {
+		t.Fatal("Expected size above MaxTokens to be invalid")
+	}
+
+	b.Size = proto.Int64(0)
+	helpers.CheckError(t, ValidateBucketConfig(b))
+
+	b.WaitTimeoutMillis = proto.Int64(-1)
+	if ValidateBucketConfig(b) == nil {
+		t.Fatal("Expected a negative wait timeout to be invalid")
+	}
+
+	b.WaitTimeoutMillis = proto.Int64(math.MaxInt64)
+	if ValidateBucketConfig(b) == nil {
+		t.Fatal("Expected a wait timeout that overflows in nanos to be invalid")
+	}
+
+	b.WaitTimeoutMillis = proto.Int64(0)
+	b.SoftLimitPercent = proto.Int64(100)
+	if ValidateBucketConfig(b) == nil {
+		t.Fatal("Expected a soft limit of 100 percent to be invalid")
+	}
+
+	b.SoftLimitPercent = nil
+	b.NotificationThresholds = []int64{80, 101}
+	if ValidateBucketConfig(b) == nil {
+		t.Fatal("Expected a notification threshold above 100 percent to be invalid")
+	}
+
+	b.NotificationThresholds = nil
+	b.MaxWaitOverrideMillis = proto.Int64(-1)
+	if ValidateBucketConfig(b) == nil {
+		t.Fatal("Expected a negative max wait override to be invalid")
+	}
+}
+
+func TestBucketArithmetic(t *testing.T) {
+	b := NewDefaultBucketConfig("b")
+	for fillRate, expected := range map[int64]int64{0: 1e9, -1: 1e9, 50: 2e7, MaxFillRate: 1, MaxFillRate + 1: 1} {
+		b.FillRate = proto.Int64(fillRate)
+		if n := NanosBetweenTokens(b); n != expected {
+			t.Errorf("Expected %v nanos between tokens at fill rate %v, got %v", expected, fillRate, n)
+		}
+	}
+
+	for maxDebtMillis, expected := range map[int64]int64{-1: 0, 0: 0, 1: 1e6, math.MaxInt64: math.MaxInt64} {
+		b.MaxDebtMillis = proto.Int64(maxDebtMillis)
+		if n := MaxDebtNanos(b); n != expected {
+			t.Errorf("Expected max debt of %v nanos for %v millis, got %v", expected, maxDebtMillis, n)
+		}
+	}
+}
+
+func TestBucketPatterns(t *testing.T) {
+	n := NewDefaultNamespaceConfig("n")
+	n.DeniedBuckets = []string{"abuser", "batch_*"}
+	n.AllowedBuckets = []string{"critical"}
+	if err := ValidateBucketPatterns(n); err != nil {
+		t.Fatalf("Expected patterns to be valid, got %v", err)
+	}
+
+	for name, expected := range map[string]bool{"abuser": true, "batch_1": true, "batch": false, "critical": false} {
+		if MatchesBucketPattern(n.DeniedBuckets, name) != expected {
+			t.Errorf("Expected %v to match deny-list: %v", name, expected)
+		}
+	}
+
+	n.AllowedBuckets = []string{"["}
+	if ValidateBucketPatterns(n) == nil {
+		t.Fatal("Expected malformed pattern to be invalid")
+	}
+}
+
+func TestValidateSuppressedEvents(t *testing.T) {
+	n := NewDefaultNamespaceConfig("n")
+	n.SuppressedEvents = []string{"EVENT_TOKENS_SERVED", "EVENT_BUCKET_CREATED"}
+	if err := ValidateSuppressedEvents(n); err != nil {
+		t.Fatalf("Expected suppressed events to be valid, got %v", err)
+	}
+
+	n.SuppressedEvents = []string{"EVENT_TOKENS_SERVED", "EVENT_NONEXISTENT"}
+	if ValidateSuppressedEvents(n) == nil {
+		t.Fatal("Expected unknown event type to be invalid")
+	}
+
+	if UpdateNamespace(NewDefaultServiceConfig(), n) == nil {
+		t.Fatal("Expected UpdateNamespace to reject unknown event types")
+	}
+}
+
+func TestValidateQuotaGroups(t *testing.T) {
+	c := NewDefaultServiceConfig()
+	ns := NewDefaultNamespaceConfig("n")
+	b := NewDefaultBucketConfig("b")
+	b.QuotaGroup = "shared"
+	helpers.PanicError(AddBucket(ns, b))
+	helpers.PanicError(AddNamespace(c, ns))
+
+	if ValidateQuotaGroups(c) == nil {
+		t.Fatal("Expected reference to a nonexistent quota group to be invalid")
+	}
+
+	c.QuotaGroups = map[string]*pbconfig.BucketConfig{"shared": NewDefaultBucketConfig("shared")}
+	if err := ValidateQuotaGroups(c); err != nil {
+		t.Fatalf("Expected quota group to be valid, got %v", err)
+	}
+
+	c.QuotaGroups["shared"].QuotaGroup = "shared"
+	if ValidateQuotaGroups(c) == nil {
+		t.Fatal("Expected nested quota group to be invalid")
+	}
+}
+
+func TestValidateBorrowing(t *testing.T) {
+	c := NewDefaultServiceConfig()
+	ns := NewDefaultNamespaceConfig("n")
+	b := NewDefaultBucketConfig("b")
+	b.BorrowFrom = []string{"sibling"}
+	helpers.PanicError(AddBucket(ns, b))
+	helpers.PanicError(AddNamespace(c, ns))
+
+	if ValidateBorrowing(c) == nil {
+		t.Fatal("Expected borrowing from a nonexistent bucket to be invalid")
+	}
+
+	helpers.PanicError(AddBucket(ns, NewDefaultBucketConfig("sibling")))
+	if err := ValidateBorrowing(c); err != nil {
+		t.Fatalf("Expected borrowing from a sibling to be valid, got %v", err)
+	}
+
+	b.BorrowFrom = []string{"b"}
+	if ValidateBorrowing(c) == nil {
+		t.Fatal("Expected borrowing from itself to be invalid")
+	}
+}
+
+func TestValidateFairShare(t *testing.T) {
+	ns := NewDefaultNamespaceConfig("n")
+	ns.FairShareWeights = map[string]int64{"b": 0}
+	if AddNamespace(NewDefaultServiceConfig(), ns) == nil {
+		t.Fatal("Expected a zero fair share weight to be invalid")
+	}
+
+	ns.FairShareWeights["b"] = 2
+	if w := FairShareWeight(ns, "b"); w != 2 {
+		t.Fatalf("Expected weight 2, got %v", w)
+	}
+
+	if w := FairShareWeight(ns, "other"); w != 1 {
+		t.Fatalf("Expected unlisted buckets to have weight 1, got %v", w)
+	}
+}
+
+func TestParseConfigEmptyEntries(t *testing.T) {
+	cfg, err := parseConfig([]byte("namespaces:\n  ns:\n    buckets:\n      b:\nquota_groups:\n  g:\n"))
+	helpers.CheckError(t, err)
+	assertBucket(t, "b", "ns", cfg.Namespaces["ns"].Buckets["b"], 100, 50, 1000, -1, 10000, 50)
+
+	if cfg.QuotaGroups["g"] == nil {
+		t.Fatal("Expected an empty quota group to get defaults")
+	}
+
+	if _, err := parseConfig([]byte("namespaces:\n  ns:\n    default_bucket: {}\n    dynamic_bucket_template: {}\n")); err == nil {
+		t.Fatal("Expected a namespace with a default bucket and dynamic buckets to be invalid")
+	}
+}
+
+func TestBucketTemplates(t *testing.T) {
+	c := NewDefaultServiceConfig()
+	c.BucketTemplates = map[string]*pbconfig.BucketConfig{"tpl": {Size: proto.Int64(500), FillRate: proto.Int64(5)}}
+	ns := NewDefaultNamespaceConfig("n")
+	b := &pbconfig.BucketConfig{Name: "b", Template: "tpl", FillRate: proto.Int64(10)}
+	helpers.PanicError(AddBucket(ns, b))
+	helpers.PanicError(AddNamespace(c, ns))
+	ApplyDefaults(c)
+
+	if b.GetSize() != 0 || b.GetWaitTimeoutMillis() != 0 {
+		t.Fatalf("Expected defaults not to be applied to a templated bucket: %+v", b)
+	}
+
+	helpers.CheckError(t, ValidateBucketTemplates(c))
+	assertBucket(t, "b", "n", ResolveBucketTemplate(c, b), 500, 10, 1000, -1, 10000, 10)
+
+	if r := ResolveBucketTemplate(c, ns.Buckets["b"]); r == b || b.GetSize() != 0 {
+		t.Fatal("Expected resolving a template not to modify the bucket")
+	}
+
+	if changed := ChangedBucketTemplates(c, c); len(changed) != 0 {
+		t.Fatalf("Expected no changed templates, got %v", changed)
+	}
+
+	c2 := CloneConfig(c)
+	c2.BucketTemplates["tpl"].Size = proto.Int64(1000)
+	if changed := ChangedBucketTemplates(c, c2); !changed["tpl"] || !UsesBucketTemplates(c2.Namespaces["n"], changed) {
+		t.Fatalf("Expected template change to be detected, got %v", changed)
+	}
+
+	b.Template = "nonexistent"
+	if ValidateBucketTemplates(c) == nil {
+		t.Fatal("Expected reference to a nonexistent template to be invalid")
+	}
+}
+
+func TestValidateBuckets(t *testing.T) {
+	for name, invalidate := range map[string]func(c *pbconfig.ServiceConfig, ns *pbconfig.NamespaceConfig){
+		"bucket": func(_ *pbconfig.ServiceConfig, ns *pbconfig.NamespaceConfig) { ns.Buckets["b"].Size = proto.Int64(-1) },
+		"default bucket": func(_ *pbconfig.ServiceConfig, ns *pbconfig.NamespaceConfig) {
+			ns.DefaultBucket.FillRate = proto.Int64(-1)
+		},
+		"dynamic bucket template": func(_ *pbconfig.ServiceConfig, ns *pbconfig.NamespaceConfig) {
+			ns.DynamicBucketTemplate.MaxDebtMillis = proto.Int64(-1)
+		},
+		"global default bucket": func(c *pbconfig.ServiceConfig, _ *pbconfig.NamespaceConfig) {
+			c.GlobalDefaultBucket.WaitTimeoutMillis = proto.Int64(-1)
+		},
+		"template": func(c *pbconfig.ServiceConfig, _ *pbconfig.NamespaceConfig) {
+			c.BucketTemplates["tpl"].FillRate = proto.Int64(MaxFillRate + 1)
+		},
+	} {
+		c := NewDefaultServiceConfig()
+		c.GlobalDefaultBucket = NewDefaultBucketConfig(DefaultBucketName)
+		c.BucketTemplates = map[string]*pbconfig.BucketConfig{"tpl": {Size: proto.Int64(500)}}
+		ns := NewDefaultNamespaceConfig("n")
+		ns.DefaultBucket = NewDefaultBucketConfig(DefaultBucketName)
+		ns.DynamicBucketTemplate = NewDefaultBucketConfig(DynamicBucketTemplateName)
+		helpers.PanicError(AddBucket(ns, NewDefaultBucketConfig("b")))
+		helpers.PanicError(AddNamespace(c, ns))
+		helpers.CheckError(t, ValidateBuckets(c))
+
+		invalidate(c, ns)
+		if ValidateBuckets(c) == nil {
+			t.Errorf("Expected an invalid %v to be rejected", name)
+		}
+	}
+}
+
+func TestMetadataInheritedFromTemplate(t *testing.T) {
+	c := NewDefaultServiceConfig()
+	c.BucketTemplates = map[string]*pbconfig.BucketConfig{"tpl": {Metadata: map[string]string{"docs": "d", "tier": "free"}}}
+	b := &pbconfig.BucketConfig{Name: "b", Template: "tpl", Metadata: map[string]string{"tier": "paid"}}
+
+	md := ResolveBucketTemplate(c, b).Metadata
+	if len(md) != 2 || md["docs"] != "d" || md["tier"] != "paid" {
+		t.Fatalf("Expected template metadata overridden by the bucket's, got %v", md)
+	}
+
+	if c.BucketTemplates["tpl"].Metadata["tier"] != "free" {
+		t.Fatal("Expected resolving metadata not to modify the template")
+	}
+
+	b2 := proto.Clone(b).(*pbconfig.BucketConfig)
+	b2.Metadata["tier"] = "enterprise"
+	if !DifferentBucketConfigs(b, b2) {
+		t.Fatal("Expected metadata change to be detected")
+	}
+}
+
+func TestBucketLabels(t *testing.T) {
+	c := NewDefaultServiceConfig()
+	c.GlobalDefaultBucket = &pbconfig.BucketConfig{Labels: map[string]string{"team": "infra"}}
+	c.BucketTemplates = map[string]*pbconfig.BucketConfig{"tpl": {Labels: map[string]string{"tier": "free"}}}
+	ns := NewDefaultNamespaceConfig("n")
+	ns.Labels = map[string]string{"team": "payments", "cost_center": "42"}
+	ns.DefaultBucket = &pbconfig.BucketConfig{Labels: map[string]string{"tier": "default"}}
+	ns.Buckets["b"] = &pbconfig.BucketConfig{Template: "tpl", Labels: map[string]string{"team": "risk"}}
+	c.Namespaces["n"] = ns
+
+	for _, tc := range []struct {
+		namespace, bucket string
+		labels            map[string]string
+	}{
+		{"n", "b", map[string]string{"team": "risk", "cost_center": "42", "tier": "free"}},
+		{"n", "other", map[string]string{"team": "payments", "cost_center": "42", "tier": "default"}},
+		{"other", "b", map[string]string{"team": "infra"}},
+	} {
+		if l := BucketLabels(c, tc.namespace, tc.bucket); !sameStringMaps(l, tc.labels) {
+			t.Errorf("Expected labels %v for %v:%v, got %v", tc.labels, tc.namespace, tc.bucket, l)
+		}
+	}
+
+	ns.DynamicBucketTemplate = &pbconfig.BucketConfig{Labels: map[string]string{"tier": "dynamic"}}
+	if l := BucketLabels(c, "n", "other"); l["tier"] != "dynamic" {
+		t.Errorf("Expected dynamic buckets to be labeled by their template, got %v", l)
+	}
+}
+
+func TestInheritDefaults(t *testing.T) {
+	c := NewDefaultServiceConfig()
+	c.GlobalDefaultBucket = &pbconfig.BucketConfig{Size: proto.Int64(1000), WaitTimeoutMillis: proto.Int64(5)}
+	c.BucketTemplates = map[string]*pbconfig.BucketConfig{"tpl": {FillRate: proto.Int64(20)}}
+	ns := NewDefaultNamespaceConfig("n")
+	ns.InheritDefaults = true
+	ns.DefaultBucket = &pbconfig.BucketConfig{FillRate: proto.Int64(10), MaxDebtMillis: proto.Int64(200)}
+	b := &pbconfig.BucketConfig{Name: "b", Size: proto.Int64(300), MaxDebtMillis: proto.Int64(0)}
+	templated := &pbconfig.BucketConfig{Name: "templated", Template: "tpl"}
+	helpers.PanicError(AddBucket(ns, b))
+	helpers.PanicError(AddBucket(ns, templated))
+	helpers.PanicError(AddNamespace(c, ns))
+	ApplyDefaults(c)
+
+	if b.GetFillRate() != 0 || ns.DefaultBucket.GetSize() != 0 {
+		t.Fatalf("Expected defaults not to be applied in a namespace that inherits defaults: %+v", b)
+	}
+
+	helpers.CheckError(t, ValidateBucketTemplates(c))
+
+	// Size from the bucket, fill rate from the namespace's default bucket, wait timeout from the global
+	// default bucket, and max debt explicitly zero.
+	assertBucket(t, "b", "n", ResolveBucketConfig(c, ns, b), 300, 10, 5, -1, 0, 50)
+	assertBucket(t, "templated", "n", ResolveBucketConfig(c, ns, templated), 1000, 20, 5, -1, 200, 50)
+	assertBucket(t, DefaultBucketName, "n", ResolveBucketConfig(c, ns, ns.DefaultBucket), 1000, 10, 5, -1, 200, 50)
+
+	// Namespaces that don't inherit defaults resolve as before.
+	ns.InheritDefaults = false
+	assertBucket(t, "templated", "n", ResolveBucketConfig(c, ns, templated), 100, 20, 1000, -1, 10000, 20)
+}
+
+func TestZeroSettings(t *testing.T) {
+	b := &pbconfig.BucketConfig{Name: "b", WaitTimeoutMillis: proto.Int64(0), MaxDebtMillis: proto.Int64(0)}
+	ApplyBucketDefaults(b)
+	assertBucket(t, "b", "", b, 100, 50, 0, -1, 0, 50)
+	helpers.CheckError(t, ValidateBucketConfig(b))
+
+	// Settings set to zero survive being persisted.
+	bytes, err := proto.Marshal(&pbconfig.BucketConfig{Name: "b", MaxDebtMillis: proto.Int64(0)})
+	helpers.CheckError(t, err)
+	persisted := &pbconfig.BucketConfig{}
+	helpers.CheckError(t, proto.Unmarshal(bytes, persisted))
+	if persisted.MaxDebtMillis == nil || persisted.Size != nil {
+		t.Errorf("Expected only max debt to be set, got %+v", persisted)
+	}
+
+	var parsed pbconfig.BucketConfig
+	helpers.CheckError(t, yaml.Unmarshal([]byte("fill_rate: 0\n"), &parsed))
+	if parsed.FillRate == nil || parsed.Size != nil {
+		t.Errorf("Expected only the fill rate to be set, got %+v", &parsed)
+	}
+
+	blocked := &pbconfig.BucketConfig{Name: "b", FillRate: proto.Int64(0)}
+	ApplyBucketDefaults(blocked)
+	if err := ValidateBucketConfig(blocked); err != nil || !Blocked(blocked) {
+		t.Errorf("Expected an explicitly zero fill rate to block the bucket, got %v", err)
+	}
+
+	sampled := &pbconfig.BucketConfig{Name: "b", Size: proto.Int64(100), MaxTokensPerRequest: proto.Int64(10), SampleRate: proto.Int64(10)}
+	helpers.CheckError(t, ValidateBucketConfig(sampled))
+	sampled.MaxTokensPerRequest = proto.Int64(11)
+	if ValidateBucketConfig(sampled) == nil {
+		t.Error("Expected sampled requests larger than the bucket to be invalid")
+	}
+
+	if !DifferentBucketConfigs(b, &pbconfig.BucketConfig{Name: "b", Size: proto.Int64(100), FillRate: proto.Int64(50), MaxIdleMillis: proto.Int64(-1), MaxTokensPerRequest: proto.Int64(50)}) {
+		t.Error("Expected settings set to zero to differ from unset ones")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/golang/protobuf/proto"
 	pbconfig "github.com/square/quotaservice/protos/config"
 	"github.com/square/quotaservice/test/helpers"
 )
@@ -23,7 +24,7 @@ func TestDiskPersistence(t *testing.T) {
 	}
 
 	s := &pbconfig.ServiceConfig{
-		GlobalDefaultBucket: &pbconfig.BucketConfig{Size: 300, FillRate: 400, WaitTimeoutMillis: 123456},
+		GlobalDefaultBucket: &pbconfig.BucketConfig{Size: proto.Int64(300), FillRate: proto.Int64(400), WaitTimeoutMillis: proto.Int64(123456)},
 		Namespaces:          make(map[string]*pbconfig.NamespaceConfig, 1),
 		Version:             92}
 
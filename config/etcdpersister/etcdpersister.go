@@ -0,0 +1,331 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package etcdpersister implements a config persister that stores configs in etcd, through the
+// JSON gateway of etcd's v3 API, which etcd 3.4 and later serve on their client URLs.
+package etcdpersister
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/config/internal"
+	"github.com/square/quotaservice/logging"
+	qsc "github.com/square/quotaservice/protos/config"
+)
+
+var ErrDuplicateConfig = errors.New("config with provided version number already exists")
+
+// Config configures an EtcdPersister.
+type Config struct {
+	// Endpoints are etcd client URLs, e.g. http://etcd-0:2379, tried in turn until one responds.
+	Endpoints []string
+	// Prefix namespaces the keys configs are stored under, as <prefix>/configs/<version>.
+	Prefix string
+	// PollingInterval is how often etcd is checked for new configs.
+	PollingInterval time.Duration
+	// Timeout bounds each request to etcd.
+	Timeout time.Duration
+	// Client makes requests, and can be configured for TLS. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// NewDefaultConfig creates a Config storing configs under /quotaservice in etcd, polling for new
+// ones every second.
+func NewDefaultConfig(endpoints ...string) Config {
+	return Config{
+		Endpoints:       endpoints,
+		Prefix:          "/quotaservice",
+		PollingInterval: time.Second,
+		Timeout:         5 * time.Second}
+}
+
+type EtcdPersister struct {
+	cfg           Config
+	latestVersion int
+	m             *sync.RWMutex
+
+	notifier        *internal.Notifier
+	shutdown        chan struct{}
+	fetcherShutdown chan struct{}
+
+	configs map[int]*qsc.ServiceConfig
+}
+
+// kv is a key-value pair as encoded by the JSON gateway, with base64-encoded bytes.
+type kv struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+func New(cfg Config) (*EtcdPersister, error) {
+	if len(cfg.Endpoints) == 0 || cfg.Prefix == "" {
+		return nil, errors.New("etcd endpoints and a prefix are required")
+	}
+
+	if cfg.PollingInterval <= 0 || cfg.Timeout <= 0 {
+		return nil, errors.New("the polling interval and timeout must be positive")
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	ep := &EtcdPersister{
+		cfg:             cfg,
+		configs:         make(map[int]*qsc.ServiceConfig),
+		m:               &sync.RWMutex{},
+		notifier:        internal.NewNotifier(),
+		shutdown:        make(chan struct{}),
+		fetcherShutdown: make(chan struct{}),
+		latestVersion:   -1,
+	}
+
+	logging.Print("Pulling configs from etcd")
+	if _, err := ep.pullConfigs(); err != nil {
+		return nil, err
+	}
+
+	ep.m.RLock()
+	v := ep.latestVersion
+	ep.m.RUnlock()
+	logging.Printf("Pulling configs from etcd: OK; Latest Version: %v", v)
+
+	ep.notifier.Notify()
+
+	go ep.configFetcher()
+
+	return ep, nil
+}
+
+// key returns the key a config version is stored under. Versions are zero-padded so that keys sort
+// in version order.
+func (ep *EtcdPersister) key(version int) string {
+	return fmt.Sprintf("%v/configs/%010d", strings.TrimSuffix(ep.cfg.Prefix, "/"), version)
+}
+
+// rangeEnd returns the end of the range of keys configs are stored under.
+func (ep *EtcdPersister) rangeEnd() string {
+	// The first key after every config key, since '0' is followed by '/' in ASCII.
+	return fmt.Sprintf("%v/configs0", strings.TrimSuffix(ep.cfg.Prefix, "/"))
+}
+
+func (ep *EtcdPersister) configFetcher() {
+	defer func() {
+		close(ep.fetcherShutdown)
+	}()
+
+	for {
+		select {
+		case <-time.After(ep.cfg.PollingInterval):
+			if newConf, err := ep.pullConfigs(); err != nil {
+				logging.Printf("Received an error trying to fetch config updates: %s", err)
+			} else if newConf {
+				logging.Print("New config(s) found in etcd")
+				ep.notifier.Notify()
+			}
+		case <-ep.shutdown:
+			logging.Print("Received shutdown signal, shutting down etcd watcher")
+			return
+		}
+	}
+}
+
+// pullConfigs reads configs newer than the latest one read, and returns true if there are any.
+func (ep *EtcdPersister) pullConfigs() (bool, error) {
+	ep.m.RLock()
+	v := ep.latestVersion
+	ep.m.RUnlock()
+
+	var resp struct {
+		Kvs []kv `json:"kvs"`
+	}
+	err := ep.call("/v3/kv/range", map[string]interface{}{
+		"key":       []byte(ep.key(v + 1)),
+		"range_end": []byte(ep.rangeEnd())}, &resp)
+	if err != nil {
+		return false, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return false, nil
+	}
+
+	maxVersion := v
+	for _, kv := range resp.Kvs {
+		var c qsc.ServiceConfig
+		if err := proto.Unmarshal(kv.Value, &c); err != nil {
+			logging.Printf("Could not unmarshal config %s, error: %s", kv.Key, err)
+			continue
+		}
+
+		version := int(c.GetVersion())
+		ep.m.Lock()
+		ep.configs[version] = &c
+		ep.m.Unlock()
+
+		if version > maxVersion {
+			maxVersion = version
+		}
+	}
+
+	if maxVersion == v {
+		return false, nil
+	}
+
+	logging.Printf("Upgrading from version %v to %v", v, maxVersion)
+
+	ep.m.Lock()
+	ep.latestVersion = maxVersion
+	ep.m.Unlock()
+
+	return true, nil
+}
+
+// call POSTs a request to the JSON gateway, trying each endpoint in turn until one responds.
+func (ep *EtcdPersister) call(path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range ep.cfg.Endpoints {
+		if err = ep.callEndpoint(strings.TrimSuffix(endpoint, "/")+path, body, response); err == nil {
+			return nil
+		}
+
+		logging.Printf("etcd request to %v failed: %v", endpoint, err)
+	}
+
+	return err
+}
+
+func (ep *EtcdPersister) callEndpoint(url string, body []byte, response interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ep.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ep.cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v: %s", resp.Status, b)
+	}
+
+	return json.Unmarshal(b, response)
+}
+
+// PersistAndNotify persists a configuration passed in, unless its version has already been
+// persisted, which is checked atomically, so that concurrent updates from different servers can't
+// overwrite each other.
+func (ep *EtcdPersister) PersistAndNotify(_ string, c *qsc.ServiceConfig) error {
+	logging.Printf("Persisting version %v", c.GetVersion())
+	b, err := proto.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	key := []byte(ep.key(int(c.GetVersion())))
+	var resp struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	err = ep.call("/v3/kv/txn", map[string]interface{}{
+		"compare": []map[string]interface{}{{
+			"key":             key,
+			"target":          "CREATE",
+			"result":          "EQUAL",
+			"create_revision": "0"}},
+		"success": []map[string]interface{}{{
+			"request_put": kv{Key: key, Value: b}}}}, &resp)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Succeeded {
+		return ErrDuplicateConfig
+	}
+
+	logging.Printf("Persisting version %v: OK", c.GetVersion())
+
+	// Read it back now, rather than waiting to poll for it.
+	if newConf, err := ep.pullConfigs(); err != nil {
+		logging.Printf("Received an error trying to fetch config updates: %s", err)
+	} else if newConf {
+		ep.notifier.Notify()
+	}
+
+	return nil
+}
+
+// ConfigChangedWatcher returns a channel that is notified whenever a new config is available.
+func (ep *EtcdPersister) ConfigChangedWatcher() <-chan struct{} {
+	return ep.notifier.Watcher
+}
+
+// ReadPersistedConfig provides a config previously persisted.
+func (ep *EtcdPersister) ReadPersistedConfig() (*qsc.ServiceConfig, error) {
+	ep.m.RLock()
+	defer ep.m.RUnlock()
+	c := ep.configs[ep.latestVersion]
+	if c == nil {
+		return nil, errors.New("persister has a nil config")
+	}
+
+	return config.CloneConfig(c), nil
+}
+
+// ReadHistoricalConfigs returns an array of previously persisted configs
+func (ep *EtcdPersister) ReadHistoricalConfigs() ([]*qsc.ServiceConfig, error) {
+	var configs []*qsc.ServiceConfig
+
+	ep.m.RLock()
+	defer ep.m.RUnlock()
+
+	var versions []int
+	for k := range ep.configs {
+		versions = append(versions, k)
+	}
+
+	sort.Ints(versions)
+
+	for _, v := range versions {
+		configs = append(configs, config.CloneConfig(ep.configs[v]))
+	}
+
+	return configs, nil
+}
+
+// Close stops polling etcd, and closes the notification channel.
+func (ep *EtcdPersister) Close() {
+	logging.Print("Shutting down etcd persister")
+	close(ep.shutdown)
+	<-ep.fetcherShutdown
+
+	close(ep.notifier.Watcher)
+	logging.Print("Shutting down etcd persister: OK")
+}
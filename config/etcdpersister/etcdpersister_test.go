@@ -0,0 +1,147 @@
+package etcdpersister
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	r "github.com/stretchr/testify/require"
+
+	qsc "github.com/square/quotaservice/protos/config"
+)
+
+const pollingInterval = 10 * time.Millisecond
+
+// fakeEtcd implements the parts of etcd's JSON gateway used by the persister.
+type fakeEtcd struct {
+	sync.Mutex
+	kvs map[string][]byte
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch req.URL.Path {
+	case "/v3/kv/range":
+		var body struct {
+			Key      []byte `json:"key"`
+			RangeEnd []byte `json:"range_end"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+
+		var keys []string
+		for k := range f.kvs {
+			if k >= string(body.Key) && k < string(body.RangeEnd) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var kvs []kv
+		for _, k := range keys {
+			kvs = append(kvs, kv{Key: []byte(k), Value: f.kvs[k]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"kvs": kvs})
+	case "/v3/kv/txn":
+		var body struct {
+			Compare []struct {
+				Key []byte `json:"key"`
+			} `json:"compare"`
+			Success []struct {
+				RequestPut kv `json:"request_put"`
+			} `json:"success"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+
+		if _, exists := f.kvs[string(body.Compare[0].Key)]; exists {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+			return
+		}
+
+		put := body.Success[0].RequestPut
+		f.kvs[string(put.Key)] = put.Value
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"succeeded": true})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestPersister(require *r.Assertions, endpoints ...string) *EtcdPersister {
+	cfg := NewDefaultConfig(endpoints...)
+	cfg.PollingInterval = pollingInterval
+	p, err := New(cfg)
+	require.NoError(err)
+	return p
+}
+
+func TestPersistAndRead(t *testing.T) {
+	require := r.New(t)
+	ts := httptest.NewServer(&fakeEtcd{kvs: make(map[string][]byte)})
+	defer ts.Close()
+
+	p := newTestPersister(require, ts.URL)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	_, err := p.ReadPersistedConfig()
+	require.Error(err, "Expected no config to have been persisted")
+
+	require.NoError(p.PersistAndNotify("", &qsc.ServiceConfig{Version: 1}))
+	require.NoError(p.PersistAndNotify("", &qsc.ServiceConfig{Version: 2}))
+	require.Equal(ErrDuplicateConfig, p.PersistAndNotify("", &qsc.ServiceConfig{Version: 2}))
+
+	select {
+	case <-p.ConfigChangedWatcher():
+	case <-time.After(time.Second):
+		t.Fatal("Expected to be notified of new configs")
+	}
+
+	c, err := p.ReadPersistedConfig()
+	require.NoError(err)
+	require.Equal(int32(2), c.Version)
+
+	configs, err := p.ReadHistoricalConfigs()
+	require.NoError(err)
+	require.Len(configs, 2)
+	require.Equal(int32(1), configs[0].Version)
+}
+
+func TestConfigsFromOtherServers(t *testing.T) {
+	require := r.New(t)
+	ts := httptest.NewServer(&fakeEtcd{kvs: make(map[string][]byte)})
+	defer ts.Close()
+
+	p1 := newTestPersister(require, ts.URL)
+	defer p1.Close()
+
+	// Unreachable endpoints are skipped.
+	p2 := newTestPersister(require, "http://127.0.0.1:1", ts.URL)
+	defer p2.Close()
+	<-p2.ConfigChangedWatcher()
+
+	require.NoError(p1.PersistAndNotify("", &qsc.ServiceConfig{Version: 1}))
+
+	select {
+	case <-p2.ConfigChangedWatcher():
+	case <-time.After(time.Second):
+		t.Fatal("Expected to be notified of a config persisted by another server")
+	}
+
+	c, err := p2.ReadPersistedConfig()
+	require.NoError(err)
+	require.Equal(int32(1), c.Version)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	require := r.New(t)
+	_, err := New(NewDefaultConfig())
+	require.Error(err)
+
+	_, err = New(NewDefaultConfig("http://127.0.0.1:1"))
+	require.Error(err, "Expected an error when etcd is unreachable")
+}
@@ -0,0 +1,100 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+//go:build go1.18
+// +build go1.18
+
+package config
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// FuzzParseConfig checks that malformed YAML configs are rejected with errors, and that configs
+// that parse can be validated and their buckets resolved, without panicking.
+func FuzzParseConfig(f *testing.F) {
+	f.Add([]byte(cfgYaml))
+	f.Add([]byte("namespaces:\n  ns:\n    buckets:\n      b:\n        fill_rate: 0\n"))
+	f.Add([]byte("namespaces:\n  ns:\n    buckets:\n      b:\n        size: -1\n        max_debt_millis: 9223372036854775807\n"))
+	f.Add([]byte("global_default_bucket:\n  fill_rate: 1000000001\n"))
+	f.Add([]byte("namespaces:\n  ns:\nquota_groups:\n  g:\n"))
+	f.Add([]byte("namespaces:\n  ns:\n    default_bucket: {}\n    dynamic_bucket_template: {}\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cfg, err := parseConfig(data)
+		if err != nil {
+			return
+		}
+
+		_ = ValidateBucketTemplates(cfg)
+		_ = ValidateBuckets(cfg)
+		_ = ValidateQuotaGroups(cfg)
+		_ = ValidateBorrowing(cfg)
+
+		for _, ns := range cfg.Namespaces {
+			if ns == nil {
+				continue
+			}
+
+			for _, b := range namespaceBuckets(ns) {
+				if b == nil {
+					continue
+				}
+
+				resolved := ResolveBucketConfig(cfg, ns, b)
+				if ValidateBucketConfig(resolved) != nil {
+					continue
+				}
+
+				if n := NanosBetweenTokens(resolved); n <= 0 {
+					t.Fatalf("Expected a positive interval between tokens for %+v, got %v", resolved, n)
+				}
+
+				if d := MaxDebtNanos(resolved); d < 0 {
+					t.Fatalf("Expected non-negative max debt for %+v, got %v", resolved, d)
+				}
+			}
+		}
+	})
+}
+
+// FuzzBucketArithmetic checks that any bucket config, valid or not, yields a positive interval
+// between tokens and a non-negative max debt, and that valid configs that aren't blocked don't
+// overflow when waiting for a full bucket's worth of tokens.
+func FuzzBucketArithmetic(f *testing.F) {
+	f.Add(int64(100), int64(50), int64(10000))
+	f.Add(int64(0), int64(0), int64(0))
+	f.Add(int64(-1), int64(-1), int64(-1))
+	f.Add(MaxTokens, MaxFillRate, int64(1<<62))
+	f.Add(MaxTokens, int64(1), int64(9223372036854))
+
+	f.Fuzz(func(t *testing.T, size, fillRate, maxDebtMillis int64) {
+		b := NewDefaultBucketConfig("b")
+		b.Size = proto.Int64(size)
+		b.FillRate = proto.Int64(fillRate)
+		b.MaxTokensPerRequest = proto.Int64(size)
+		b.MaxDebtMillis = proto.Int64(maxDebtMillis)
+
+		between := NanosBetweenTokens(b)
+		if between <= 0 || between > MaxFillRate {
+			t.Fatalf("Expected an interval between tokens of 1ns to 1s for fill rate %v, got %v", fillRate, between)
+		}
+
+		if MaxDebtNanos(b) < 0 {
+			t.Fatalf("Expected non-negative max debt for %v millis, got %v", maxDebtMillis, MaxDebtNanos(b))
+		}
+
+		// Blocked buckets, with a zero fill rate, deny requests rather than waiting for tokens.
+		ApplyBucketDefaults(b)
+		if ValidateBucketConfig(b) != nil || Blocked(b) {
+			return
+		}
+
+		between = NanosBetweenTokens(b)
+		if b.GetSize() > 0 && (b.GetSize()*between)/between != b.GetSize() {
+			t.Fatalf("Waiting for %v tokens at fill rate %v overflows", b.GetSize(), b.GetFillRate())
+		}
+	})
+}
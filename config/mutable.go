@@ -5,11 +5,19 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"time"
 
+	"github.com/golang/protobuf/proto"
 	pbconfig "github.com/square/quotaservice/protos/config"
 )
 
 func CreateBucket(clonedCfg *pbconfig.ServiceConfig, namespace string, b *pbconfig.BucketConfig) error {
+	if err := ValidateBucketConfig(b); err != nil {
+		return err
+	}
+
 	if namespace == GlobalNamespace {
 		if clonedCfg.GlobalDefaultBucket != nil {
 			return errors.New("GlobalDefaultBucket already exists")
@@ -49,6 +57,10 @@ func CreateBucket(clonedCfg *pbconfig.ServiceConfig, namespace string, b *pbconf
 }
 
 func UpdateBucket(clonedCfg *pbconfig.ServiceConfig, namespace string, b *pbconfig.BucketConfig) error {
+	if err := ValidateBucketConfig(b); err != nil {
+		return err
+	}
+
 	if namespace == GlobalNamespace {
 		clonedCfg.GlobalDefaultBucket = b
 	} else {
@@ -102,6 +114,103 @@ func DeleteNamespace(clonedCfg *pbconfig.ServiceConfig, n string) error {
 	return nil
 }
 
+// DefaultDeletedNamespaceRetention is how long soft-deleted namespaces are retained, unless
+// configured otherwise.
+const DefaultDeletedNamespaceRetention = 7 * 24 * time.Hour
+
+// SoftDeleteNamespace moves a namespace to the config's deleted namespaces, from which it can be
+// restored until it is purged. Deleted namespaces are keyed by name and config version, e.g.
+// "ns@12", so that a namespace deleted, recreated and deleted again doesn't overwrite its earlier
+// archive.
+func SoftDeleteNamespace(clonedCfg *pbconfig.ServiceConfig, n string, now time.Time) error {
+	nsCfg := clonedCfg.Namespaces[n]
+	if nsCfg == nil {
+		return errors.New("No such namespace " + n)
+	}
+
+	key := fmt.Sprintf("%v@%v", n, clonedCfg.Version)
+	if clonedCfg.DeletedNamespaces[key] != nil {
+		return errors.New("Namespace " + n + " has already been deleted in this config version.")
+	}
+
+	delete(clonedCfg.Namespaces, n)
+	nsCfg.DeletedAt = now.Unix()
+
+	if clonedCfg.DeletedNamespaces == nil {
+		clonedCfg.DeletedNamespaces = make(map[string]*pbconfig.NamespaceConfig)
+	}
+
+	clonedCfg.DeletedNamespaces[key] = nsCfg
+
+	return nil
+}
+
+// RestoreNamespace restores a soft-deleted namespace. n is either the key of a deleted namespace,
+// e.g. "ns@12", or a namespace name, in which case its most recently deleted archive is restored.
+func RestoreNamespace(clonedCfg *pbconfig.ServiceConfig, n string) error {
+	key := deletedNamespaceKey(clonedCfg, n)
+	nsCfg := clonedCfg.DeletedNamespaces[key]
+	if nsCfg == nil {
+		return errors.New("No such deleted namespace " + n)
+	}
+
+	if clonedCfg.Namespaces[nsCfg.Name] != nil {
+		return errors.New("Namespace " + nsCfg.Name + " already exists.")
+	}
+
+	delete(clonedCfg.DeletedNamespaces, key)
+	nsCfg.DeletedAt = 0
+
+	return UpdateNamespace(clonedCfg, nsCfg)
+}
+
+// deletedNamespaceKey returns the key of a deleted namespace, given either its key or the name of
+// the namespace, in which case the most recently deleted archive of the namespace is chosen.
+// Returns an empty string if there is no such deleted namespace.
+func deletedNamespaceKey(clonedCfg *pbconfig.ServiceConfig, n string) string {
+	if clonedCfg.DeletedNamespaces[n] != nil {
+		return n
+	}
+
+	var latest string
+	for key, nsCfg := range clonedCfg.DeletedNamespaces {
+		if nsCfg.Name != n {
+			continue
+		}
+
+		// Keys of the same namespace only differ by version, so the longer key is the later one.
+		if l := clonedCfg.DeletedNamespaces[latest]; l == nil || nsCfg.DeletedAt > l.DeletedAt ||
+			nsCfg.DeletedAt == l.DeletedAt && (len(key) > len(latest) || len(key) == len(latest) && key > latest) {
+			latest = key
+		}
+	}
+
+	return latest
+}
+
+// PurgeDeletedNamespaces permanently removes soft-deleted namespaces whose retention period has
+// passed, returning the names of namespaces purged.
+func PurgeDeletedNamespaces(clonedCfg *pbconfig.ServiceConfig, now time.Time) []string {
+	retention := time.Duration(clonedCfg.DeletedNamespaceRetentionSeconds) * time.Second
+	if retention < 0 {
+		return nil
+	}
+
+	if retention == 0 {
+		retention = DefaultDeletedNamespaceRetention
+	}
+
+	var purged []string
+	for n, nsCfg := range clonedCfg.DeletedNamespaces {
+		if now.Sub(time.Unix(nsCfg.DeletedAt, 0)) >= retention {
+			delete(clonedCfg.DeletedNamespaces, n)
+			purged = append(purged, n)
+		}
+	}
+
+	return purged
+}
+
 func CreateNamespace(clonedCfg *pbconfig.ServiceConfig, nsCfg *pbconfig.NamespaceConfig) error {
 	if clonedCfg.Namespaces[nsCfg.Name] != nil {
 		return errors.New("Namespace " + nsCfg.Name + " already exists.")
@@ -110,7 +219,83 @@ func CreateNamespace(clonedCfg *pbconfig.ServiceConfig, nsCfg *pbconfig.Namespac
 	return UpdateNamespace(clonedCfg, nsCfg)
 }
 
+// CreateNamespaceFromTemplate creates a namespace as a copy of a namespace template.
+func CreateNamespaceFromTemplate(clonedCfg *pbconfig.ServiceConfig, name, template string) error {
+	tpl := clonedCfg.NamespaceTemplates[template]
+	if tpl == nil {
+		return errors.New("No such namespace template " + template)
+	}
+
+	nsCfg := proto.Clone(tpl).(*pbconfig.NamespaceConfig)
+	nsCfg.Name = name
+	for _, b := range namespaceBuckets(nsCfg) {
+		b.Namespace = name
+	}
+
+	return CreateNamespace(clonedCfg, nsCfg)
+}
+
+// CloneOverrides customizes the buckets of a cloned namespace.
+type CloneOverrides struct {
+	// RateScale, if positive, scales the size and fill rate of every bucket in the clone, so that
+	// e.g. a staging namespace can be given a tenth of production's capacity. Scaled values are
+	// never less than 1.
+	RateScale float64
+}
+
+// CloneNamespace creates a namespace named dst with a copy of the configuration of namespace src.
+func CloneNamespace(clonedCfg *pbconfig.ServiceConfig, src, dst string, overrides CloneOverrides) error {
+	srcCfg := clonedCfg.Namespaces[src]
+	if srcCfg == nil {
+		return errors.New("No such namespace " + src)
+	}
+
+	nsCfg := proto.Clone(srcCfg).(*pbconfig.NamespaceConfig)
+	nsCfg.Name = dst
+	for _, b := range namespaceBuckets(nsCfg) {
+		b.Namespace = dst
+		if overrides.RateScale > 0 {
+			b.Size = proto.Int64(scaleRate(b.GetSize(), overrides.RateScale))
+			b.FillRate = proto.Int64(scaleRate(b.GetFillRate(), overrides.RateScale))
+		}
+	}
+
+	return CreateNamespace(clonedCfg, nsCfg)
+}
+
+func scaleRate(rate int64, scale float64) int64 {
+	if rate <= 0 {
+		// Unset values are inherited from defaults, and shouldn't be scaled.
+		return rate
+	}
+
+	scaled := int64(math.Round(float64(rate) * scale))
+	if scaled < 1 {
+		return 1
+	}
+
+	return scaled
+}
+
 func UpdateNamespace(clonedCfg *pbconfig.ServiceConfig, nsCfg *pbconfig.NamespaceConfig) error {
+	if err := ValidateBucketPatterns(nsCfg); err != nil {
+		return err
+	}
+
+	if err := ValidateSuppressedEvents(nsCfg); err != nil {
+		return err
+	}
+
+	if err := ValidateFairShare(nsCfg); err != nil {
+		return err
+	}
+
+	for _, b := range namespaceBuckets(nsCfg) {
+		if err := ValidateBucketConfig(b); err != nil {
+			return err
+		}
+	}
+
 	if clonedCfg.Namespaces == nil {
 		clonedCfg.Namespaces = make(map[string]*pbconfig.NamespaceConfig)
 	}
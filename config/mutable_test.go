@@ -5,8 +5,11 @@ package config
 
 import (
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
 	pb "github.com/square/quotaservice/protos/config"
+	"github.com/square/quotaservice/test/helpers"
 )
 
 func defaultConfig() *pb.ServiceConfig {
@@ -312,3 +315,165 @@ func TestUpdateNamespace(t *testing.T) {
 		t.Error("UpdateNamespace did not update testNamespace")
 	}
 }
+
+func TestCreateNamespaceFromTemplate(t *testing.T) {
+	cfg := defaultConfig()
+	tpl := NewDefaultNamespaceConfig("")
+	tpl.Buckets["b"] = NewDefaultBucketConfig("b")
+	cfg.NamespaceTemplates = map[string]*pb.NamespaceConfig{"tpl": tpl}
+
+	if err := CreateNamespaceFromTemplate(cfg, "newNamespace", "tpl"); err != nil {
+		t.Fatalf("CreateNamespaceFromTemplate errored: %+v", err)
+	}
+
+	ns := cfg.Namespaces["newNamespace"]
+	if ns == nil || ns.Name != "newNamespace" || ns.Buckets["b"].Namespace != "newNamespace" {
+		t.Fatalf("Namespace was not created from template: %+v", ns)
+	}
+
+	if tpl.Name != "" || tpl.Buckets["b"].Namespace != "" {
+		t.Error("Template should not be modified")
+	}
+
+	if CreateNamespaceFromTemplate(cfg, "newNamespace", "tpl") == nil {
+		t.Error("Expected an error creating an existing namespace")
+	}
+
+	if CreateNamespaceFromTemplate(cfg, "otherNamespace", "nonexistent") == nil {
+		t.Error("Expected an error for a nonexistent template")
+	}
+}
+
+func TestCloneNamespace(t *testing.T) {
+	cfg := defaultConfig()
+	src := cfg.Namespaces["testNamespace"]
+	src.Buckets["testBucket"].Size = proto.Int64(100)
+	src.Buckets["testBucket"].FillRate = proto.Int64(50)
+	src.Buckets["small"] = NewDefaultBucketConfig("small")
+	src.Buckets["small"].Size = proto.Int64(2)
+	src.Buckets["small"].FillRate = proto.Int64(1)
+
+	if err := CloneNamespace(cfg, "testNamespace", "staging", CloneOverrides{RateScale: 0.1}); err != nil {
+		t.Fatalf("CloneNamespace errored: %+v", err)
+	}
+
+	ns := cfg.Namespaces["staging"]
+	if ns == nil || ns.Name != "staging" || len(ns.Buckets) != len(src.Buckets) {
+		t.Fatalf("Namespace was not cloned: %+v", ns)
+	}
+
+	b := ns.Buckets["testBucket"]
+	if b.Namespace != "staging" || b.GetSize() != 10 || b.GetFillRate() != 5 {
+		t.Errorf("Bucket was not scaled: %+v", b)
+	}
+
+	if small := ns.Buckets["small"]; small.GetSize() != 1 || small.GetFillRate() != 1 {
+		t.Errorf("Scaled values should be at least 1: %+v", small)
+	}
+
+	if src.Buckets["testBucket"].Namespace == "staging" || src.Buckets["testBucket"].GetSize() != 100 {
+		t.Error("Source namespace should not be modified")
+	}
+
+	if err := CloneNamespace(cfg, "testNamespace", "unscaled", CloneOverrides{}); err != nil {
+		t.Fatalf("CloneNamespace errored: %+v", err)
+	}
+
+	if b := cfg.Namespaces["unscaled"].Buckets["testBucket"]; b.GetSize() != 100 || b.GetFillRate() != 50 {
+		t.Errorf("Bucket should not be scaled without overrides: %+v", b)
+	}
+
+	if CloneNamespace(cfg, "testNamespace", "staging", CloneOverrides{}) == nil {
+		t.Error("Expected an error cloning into an existing namespace")
+	}
+
+	if CloneNamespace(cfg, "nonexistent", "other", CloneOverrides{}) == nil {
+		t.Error("Expected an error for a nonexistent source namespace")
+	}
+}
+
+func TestSoftDeleteAndRestoreNamespace(t *testing.T) {
+	cfg := defaultConfig()
+	now := time.Unix(1000000, 0)
+
+	if SoftDeleteNamespace(cfg, "nonexistent", now) == nil {
+		t.Error("SoftDeleteNamespace did not error on nonexistent namespace")
+	}
+
+	if err := SoftDeleteNamespace(cfg, "testNamespace", now); err != nil {
+		t.Fatalf("SoftDeleteNamespace errored: %+v", err)
+	}
+
+	if cfg.Namespaces["testNamespace"] != nil || cfg.DeletedNamespaces["testNamespace@0"].GetDeletedAt() != now.Unix() {
+		t.Fatal("SoftDeleteNamespace did not archive testNamespace")
+	}
+
+	if err := RestoreNamespace(cfg, "testNamespace"); err != nil {
+		t.Fatalf("RestoreNamespace errored: %+v", err)
+	}
+
+	ns := cfg.Namespaces["testNamespace"]
+	if ns == nil || ns.DeletedAt != 0 || ns.Buckets["testBucket"] == nil || len(cfg.DeletedNamespaces) != 0 {
+		t.Fatalf("RestoreNamespace did not restore testNamespace: %+v", ns)
+	}
+
+	if RestoreNamespace(cfg, "testNamespace") == nil {
+		t.Error("RestoreNamespace did not error on namespace that isn't deleted")
+	}
+}
+
+func TestSoftDeleteRecreatedNamespace(t *testing.T) {
+	cfg := defaultConfig()
+	now := time.Unix(1000000, 0)
+	helpers.CheckError(t, SoftDeleteNamespace(cfg, "testNamespace", now))
+
+	cfg.Version = 1
+	helpers.CheckError(t, CreateNamespace(cfg, NewDefaultNamespaceConfig("testNamespace")))
+	if SoftDeleteNamespace(cfg, "testNamespace", now) != nil {
+		t.Fatal("SoftDeleteNamespace errored on a recreated namespace")
+	}
+
+	helpers.CheckError(t, CreateNamespace(cfg, NewDefaultNamespaceConfig("testNamespace")))
+	if SoftDeleteNamespace(cfg, "testNamespace", now) == nil {
+		t.Fatal("SoftDeleteNamespace did not error on a namespace deleted twice in one version")
+	}
+
+	if len(cfg.DeletedNamespaces) != 2 || cfg.DeletedNamespaces["testNamespace@0"].Buckets["testBucket"] == nil {
+		t.Fatalf("Expected both deleted namespaces to be retained: %+v", cfg.DeletedNamespaces)
+	}
+
+	// The namespace was deleted at the same time both times, so the later version is restored.
+	helpers.CheckError(t, DeleteNamespace(cfg, "testNamespace"))
+	helpers.CheckError(t, RestoreNamespace(cfg, "testNamespace"))
+	if cfg.Namespaces["testNamespace"].Buckets["testBucket"] != nil || cfg.DeletedNamespaces["testNamespace@1"] != nil {
+		t.Fatal("Expected the most recently deleted namespace to be restored")
+	}
+
+	helpers.CheckError(t, DeleteNamespace(cfg, "testNamespace"))
+	helpers.CheckError(t, RestoreNamespace(cfg, "testNamespace@0"))
+	if cfg.Namespaces["testNamespace"].Buckets["testBucket"] == nil || len(cfg.DeletedNamespaces) != 0 {
+		t.Fatal("Expected the namespace deleted first to be restored by key")
+	}
+}
+
+func TestPurgeDeletedNamespaces(t *testing.T) {
+	cfg := defaultConfig()
+	now := time.Unix(1000000, 0)
+	if err := SoftDeleteNamespace(cfg, "testNamespace", now); err != nil {
+		t.Fatalf("SoftDeleteNamespace errored: %+v", err)
+	}
+
+	if purged := PurgeDeletedNamespaces(cfg, now.Add(DefaultDeletedNamespaceRetention-time.Second)); len(purged) != 0 {
+		t.Fatalf("Purged %v before the retention period passed", purged)
+	}
+
+	cfg.DeletedNamespaceRetentionSeconds = -1
+	if purged := PurgeDeletedNamespaces(cfg, now.Add(100*DefaultDeletedNamespaceRetention)); len(purged) != 0 {
+		t.Fatalf("Purged %v despite indefinite retention", purged)
+	}
+
+	cfg.DeletedNamespaceRetentionSeconds = 60
+	if purged := PurgeDeletedNamespaces(cfg, now.Add(time.Minute)); len(purged) != 1 || cfg.DeletedNamespaces["testNamespace"] != nil {
+		t.Fatalf("Expected testNamespace to be purged, purged %v", purged)
+	}
+}
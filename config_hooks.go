@@ -0,0 +1,48 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+// ConfigHook is called with the config in use and the config a change made on behalf of a user
+// results in. Neither config may be modified.
+type ConfigHook func(current, changed *pb.ServiceConfig, user string) error
+
+func (s *server) AddPreApplyConfigHook(hook ConfigHook) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.preApplyHooks = append(s.preApplyHooks, hook)
+}
+
+func (s *server) AddPostApplyConfigHook(hook ConfigHook) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.postApplyHooks = append(s.postApplyHooks, hook)
+}
+
+// runPreApplyHooks calls each hook in turn, until one vetoes the change.
+func runPreApplyHooks(hooks []ConfigHook, current, changed *pb.ServiceConfig, user string) error {
+	for _, hook := range hooks {
+		if err := hook(current, changed, user); err != nil {
+			logging.Printf("Config version %v by %v vetoed: %v", changed.Version, user, err)
+			return &admin.VetoedError{Err: err}
+		}
+	}
+
+	return nil
+}
+
+func runPostApplyHooks(hooks []ConfigHook, current, changed *pb.ServiceConfig, user string) {
+	for _, hook := range hooks {
+		if err := hook(current, changed, user); err != nil {
+			logging.Printf("Post-apply hook failed for config version %v by %v: %v", changed.Version, user, err)
+		}
+	}
+}
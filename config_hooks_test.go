@@ -0,0 +1,68 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/config"
+	pb "github.com/square/quotaservice/protos/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+)
+
+func TestConfigHooks(t *testing.T) {
+	p := config.NewMemoryConfig(config.NewDefaultServiceConfig())
+	s := quotaservice.New(&qstesting.MockBucketFactory{}, p, qstesting.NewReaperConfig(), 0, &qstesting.MockEndpoint{})
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer func() {
+		_, err := s.Stop()
+		helpers.CheckError(t, err)
+	}()
+
+	administrable := s.GetServerAdministrable()
+	var calls []string
+	s.AddPreApplyConfigHook(func(current, changed *pb.ServiceConfig, user string) error {
+		calls = append(calls, "pre")
+		if _, exists := changed.Namespaces["forbidden"]; exists {
+			return errors.New("namespace names must be approved by the platform team")
+		}
+
+		return nil
+	})
+	s.AddPostApplyConfigHook(func(current, changed *pb.ServiceConfig, user string) error {
+		calls = append(calls, "post")
+		if current.Version+1 != changed.Version || user != "alice" {
+			t.Errorf("Unexpected post-apply hook call for version %v by %v", changed.Version, user)
+		}
+
+		return errors.New("post-apply hook errors are ignored")
+	})
+
+	err = administrable.AddNamespace(config.NewDefaultNamespaceConfig("forbidden"), "alice")
+	if vetoed, ok := err.(*admin.VetoedError); !ok || vetoed.Err == nil {
+		t.Fatalf("Expected the change to be vetoed, got %v", err)
+	}
+
+	persisted, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	if persisted.Namespaces["forbidden"] != nil {
+		t.Fatal("Expected a vetoed change not to be persisted")
+	}
+
+	helpers.CheckError(t, administrable.AddNamespace(config.NewDefaultNamespaceConfig("ns"), "alice"))
+	persisted, err = p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	if persisted.Namespaces["ns"] == nil {
+		t.Fatal("Expected the change to be persisted")
+	}
+
+	if len(calls) != 3 || calls[0] != "pre" || calls[1] != "pre" || calls[2] != "post" {
+		t.Fatalf("Expected hooks to be called before and after applying changes, got %v", calls)
+	}
+}
@@ -0,0 +1,67 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/metrics"
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+// configApplyHistorySize is the number of most recently applied configs whose propagation is kept.
+const configApplyHistorySize = 10
+
+// configPropagation records how long the configs applied on this instance took to propagate, from
+// being saved, and from this instance being notified of them, to being applied.
+type configPropagation struct {
+	applies []*metrics.ConfigApply
+	sync.Mutex
+}
+
+func (c *configPropagation) record(cfg *pb.ServiceConfig, notifiedAt, appliedAt time.Time) {
+	apply := &metrics.ConfigApply{
+		Version:         cfg.Version,
+		Hash:            config.HashConfig(cfg),
+		SavedAt:         cfg.Date,
+		AppliedAtMillis: appliedAt.UnixNano() / int64(time.Millisecond),
+		ApplyMillis:     appliedAt.Sub(notifiedAt).Nanoseconds() / int64(time.Millisecond)}
+
+	if cfg.Date > 0 {
+		apply.PropagationMillis = apply.AppliedAtMillis - cfg.Date*1000
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.applies = append(c.applies, apply)
+	if len(c.applies) > configApplyHistorySize {
+		c.applies = c.applies[len(c.applies)-configApplyHistorySize:]
+	}
+}
+
+// status reports the config currently applied, and the propagation of recent configs, most recent
+// first. Returns nil if no config has been applied.
+func (c *configPropagation) status() *metrics.ConfigStatus {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.applies) == 0 {
+		return nil
+	}
+
+	current := c.applies[len(c.applies)-1]
+	status := &metrics.ConfigStatus{
+		Version: current.Version,
+		Hash:    current.Hash,
+		Recent:  make([]*metrics.ConfigApply, 0, len(c.applies))}
+
+	for i := len(c.applies) - 1; i >= 0; i-- {
+		status.Recent = append(status.Recent, c.applies[i])
+	}
+
+	return status
+}
@@ -0,0 +1,65 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestConfigPropagationHistory(t *testing.T) {
+	c := &configPropagation{}
+	if c.status() != nil {
+		t.Fatal("Expected no status before a config is applied")
+	}
+
+	now := time.Now()
+	for i := 1; i <= configApplyHistorySize+5; i++ {
+		cfg := config.NewDefaultServiceConfig()
+		cfg.Version = int32(i)
+		cfg.Date = now.Unix() - 2
+		c.record(cfg, now.Add(-50*time.Millisecond), now)
+	}
+
+	status := c.status()
+	if status.Version != configApplyHistorySize+5 || status.Hash == "" || len(status.Recent) != configApplyHistorySize {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+
+	latest := status.Recent[0]
+	if latest.Version != status.Version || latest.ApplyMillis != 50 || latest.PropagationMillis < 2000 || latest.PropagationMillis >= 3000 {
+		t.Fatalf("Unexpected propagation %+v", latest)
+	}
+}
+
+func TestConfigPropagationReported(t *testing.T) {
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	initial := s.HealthMetrics().Config
+	if initial == nil || len(initial.Recent) != 1 {
+		t.Fatalf("Expected the initial config to be reported, got %+v", initial)
+	}
+
+	helpers.CheckError(t, s.UpdateConfig(config.NewDefaultServiceConfig(), "test"))
+
+	start := time.Now()
+	for s.HealthMetrics().Config.Version == initial.Version {
+		if time.Since(start) > time.Second {
+			t.Fatal("Timeout waiting for config to be applied!")
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	status := s.HealthMetrics().Config
+	if status.Hash == initial.Hash || len(status.Recent) != 2 || status.Recent[0].SavedAt == 0 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
@@ -0,0 +1,132 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/events"
+)
+
+const (
+	// dashboardMinutes is the number of minutes of grant and deny rates kept for dashboards.
+	dashboardMinutes = 60
+	// dashboardConfigChanges is the number of recent config changes reported on dashboards.
+	dashboardConfigChanges = 10
+)
+
+// minuteRates counts the requests granted and denied in a minute, identified by its start in Unix
+// seconds.
+type minuteRates struct {
+	minute          int64
+	granted, denied int64
+}
+
+// dashboardRates counts the requests each namespace grants and denies per minute, in a ring of the
+// last dashboardMinutes minutes.
+type dashboardRates struct {
+	sync.Mutex
+	namespaces map[string]*[dashboardMinutes]minuteRates
+	now        func() time.Time
+}
+
+func newDashboardRates() *dashboardRates {
+	return &dashboardRates{namespaces: make(map[string]*[dashboardMinutes]minuteRates), now: time.Now}
+}
+
+// HandleEvent counts granted and denied requests. Other events are ignored.
+func (d *dashboardRates) HandleEvent(e events.Event) {
+	var granted, denied int64
+	switch e.EventType() {
+	case events.EVENT_TOKENS_SERVED:
+		granted = 1
+	case events.EVENT_TIMEOUT_SERVING_TOKENS, events.EVENT_TOO_MANY_TOKENS_REQUESTED:
+		denied = 1
+	default:
+		return
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	ring := d.namespaces[e.Namespace()]
+	if ring == nil {
+		ring = new([dashboardMinutes]minuteRates)
+		d.namespaces[e.Namespace()] = ring
+	}
+
+	minute := d.now().Unix() / 60 * 60
+	r := &ring[minute/60%dashboardMinutes]
+	if r.minute != minute {
+		*r = minuteRates{minute: minute}
+	}
+
+	r.granted += granted
+	r.denied += denied
+}
+
+// namespace returns the rates of a namespace for every minute of the window, oldest first.
+func (d *dashboardRates) namespace(namespace string) *admin.NamespaceDashboard {
+	d.Lock()
+	defer d.Unlock()
+
+	nd := &admin.NamespaceDashboard{Namespace: namespace, Rates: make([]*admin.RatePoint, dashboardMinutes)}
+	ring := d.namespaces[namespace]
+	now := d.now().Unix() / 60 * 60
+	for i := range nd.Rates {
+		minute := now - int64(dashboardMinutes-1-i)*60
+		p := &admin.RatePoint{Time: minute}
+		if ring != nil {
+			if r := ring[minute/60%dashboardMinutes]; r.minute == minute {
+				p.Granted, p.Denied = r.granted, r.denied
+			}
+		}
+
+		nd.Granted += p.Granted
+		nd.Denied += p.Denied
+		nd.Rates[i] = p
+	}
+
+	return nd
+}
+
+// Dashboard aggregates the rates, top buckets and config changes the admin UI plots.
+func (s *server) Dashboard(namespace string) (*admin.Dashboard, error) {
+	var namespaces []string
+	if namespace != "" {
+		namespaces = []string{namespace}
+	} else {
+		for name := range s.Configs().Namespaces {
+			namespaces = append(namespaces, name)
+		}
+		sort.Strings(namespaces)
+	}
+
+	d := &admin.Dashboard{WindowMinutes: dashboardMinutes, Namespaces: make([]*admin.NamespaceDashboard, len(namespaces))}
+	for i, name := range namespaces {
+		nd := s.dashboardRates.namespace(name)
+		nd.TopHits = s.TopDynamicHits(name)
+		nd.TopMisses = s.TopDynamicMisses(name)
+		d.Namespaces[i] = nd
+	}
+
+	configs, err := s.HistoricalConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configs) > dashboardConfigChanges {
+		configs = configs[:dashboardConfigChanges]
+	}
+
+	d.ConfigChanges = make([]*admin.ConfigChange, len(configs))
+	for i, cfg := range configs {
+		d.ConfigChanges[i] = &admin.ConfigChange{Version: cfg.Version, User: cfg.User, Date: cfg.Date}
+	}
+
+	return d, nil
+}
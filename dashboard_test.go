@@ -0,0 +1,69 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestDashboardRates(t *testing.T) {
+	d := newDashboardRates()
+	now := time.Unix(6000, 0)
+	d.now = func() time.Time { return now }
+
+	d.HandleEvent(events.NewTokensServedEvent("ns", "b", false, 1, 0))
+	d.HandleEvent(events.NewTimedOutEvent("ns", "b", false, 1))
+	now = now.Add(time.Minute)
+	d.HandleEvent(events.NewTokensServedEvent("ns", "b", false, 5, 0))
+	d.HandleEvent(events.NewBucketMissedEvent("ns", "b", false))
+
+	nd := d.namespace("ns")
+	if len(nd.Rates) != dashboardMinutes || nd.Granted != 2 || nd.Denied != 1 {
+		t.Fatalf("Expected an hour of rates with 2 grants and 1 denial, got %+v", nd)
+	}
+
+	last, previous := nd.Rates[dashboardMinutes-1], nd.Rates[dashboardMinutes-2]
+	if last.Time != 6060 || last.Granted != 1 || previous.Time != 6000 || previous.Granted != 1 || previous.Denied != 1 {
+		t.Fatalf("Expected rates for the last 2 minutes, got %+v and %+v", previous, last)
+	}
+
+	// Rates older than the window are dropped, even once their slot is reused.
+	now = now.Add(dashboardMinutes * time.Minute)
+	if nd = d.namespace("ns"); nd.Granted != 0 || nd.Denied != 0 {
+		t.Fatalf("Expected rates older than the window to be dropped, got %+v", nd)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	for _, name := range []string{"b", "a"} {
+		nsc := config.NewDefaultNamespaceConfig(name)
+		helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("b")))
+		helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+	}
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	d, err := s.Dashboard("")
+	helpers.CheckError(t, err)
+	if len(d.Namespaces) != 2 || d.Namespaces[0].Namespace != "a" || d.Namespaces[1].Namespace != "b" {
+		t.Fatalf("Expected dashboards of all namespaces, sorted, got %+v", d.Namespaces)
+	}
+
+	if len(d.ConfigChanges) == 0 {
+		t.Fatal("Expected recent config changes")
+	}
+
+	if d, err = s.Dashboard("a"); err != nil || len(d.Namespaces) != 1 {
+		t.Fatalf("Expected the dashboard of one namespace, got %+v, %v", d, err)
+	}
+}
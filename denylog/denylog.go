@@ -0,0 +1,137 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package denylog logs requests denied by the quota service, limiting the lines it logs for each
+// bucket so that a storm of throttled requests doesn't flood the logs.
+package denylog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+)
+
+// pruneInterval is how often state is dropped for buckets that have stopped denying requests.
+const pruneInterval = time.Minute
+
+// Config configures a Listener.
+type Config struct {
+	// LinesPerSecond is the most lines logged for each bucket per second. Further denials are
+	// counted, and reported when the bucket's next line is logged.
+	LinesPerSecond int
+	// Logger is logged to. Defaults to the quota service's logger.
+	Logger logging.Logger
+}
+
+// NewDefaultConfig returns a config logging at most 5 lines per bucket per second.
+func NewDefaultConfig() Config {
+	return Config{LinesPerSecond: 5}
+}
+
+type bucketLog struct {
+	windowStart time.Time
+	lines       int
+	suppressed  int64
+}
+
+// Listener logs denied requests. Its HandleEvent function is an events.Listener.
+type Listener struct {
+	events.BaseVisitor
+	cfg       Config
+	buckets   map[string]*bucketLog
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// New creates a Listener.
+func New(cfg Config) *Listener {
+	if cfg.LinesPerSecond < 1 {
+		panic(fmt.Sprintf("LinesPerSecond must be positive, was %v", cfg.LinesPerSecond))
+	}
+
+	return &Listener{
+		cfg:     cfg,
+		buckets: make(map[string]*bucketLog),
+		now:     time.Now}
+}
+
+// HandleEvent is an events.Listener. It is not safe to call concurrently, which is consistent
+// with how the events package notifies listeners.
+func (l *Listener) HandleEvent(e events.Event) {
+	events.Visit(e, l)
+}
+
+// TokensDenied logs a denied request, unless too many lines have already been logged for its
+// bucket in the last second. It implements events.Visitor.
+func (l *Listener) TokensDenied(e *events.TokensDenied) {
+	reason := "requested more tokens than allowed per request"
+	if e.TimedOut {
+		reason = "timed out waiting for tokens"
+	}
+
+	now := l.now()
+	l.prune(now)
+
+	fqn := config.FullyQualifiedName(e.Namespace, e.Bucket)
+	b, ok := l.buckets[fqn]
+	if !ok {
+		b = &bucketLog{}
+		l.buckets[fqn] = b
+	}
+
+	if now.Sub(b.windowStart) >= time.Second {
+		b.windowStart = now
+		b.lines = 0
+	}
+
+	if b.lines >= l.cfg.LinesPerSecond {
+		b.suppressed++
+		return
+	}
+
+	b.lines++
+	caller := e.Caller
+	if caller == "" {
+		caller = "unknown caller"
+	}
+
+	msg := fmt.Sprintf("Denied %v tokens from %v to %v: %v", e.Tokens, fqn, caller, reason)
+	if b.suppressed > 0 {
+		msg += fmt.Sprintf(" (%v similar denials suppressed)", b.suppressed)
+		b.suppressed = 0
+	}
+
+	l.print(msg)
+}
+
+// prune drops state for buckets that haven't denied requests for a while, first reporting any
+// denials suppressed since their last line.
+func (l *Listener) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for fqn, b := range l.buckets {
+		if now.Sub(b.windowStart) < pruneInterval {
+			continue
+		}
+
+		if b.suppressed > 0 {
+			l.print(fmt.Sprintf("%v further denials from %v suppressed", b.suppressed, fqn))
+		}
+
+		delete(l.buckets, fqn)
+	}
+}
+
+func (l *Listener) print(msg string) {
+	if l.cfg.Logger != nil {
+		l.cfg.Logger.Print(msg)
+	} else {
+		logging.Print(msg)
+	}
+}
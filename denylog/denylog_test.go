@@ -0,0 +1,97 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package denylog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (r *recordingLogger) Fatal(args ...interface{})                 { r.Print(args...) }
+func (r *recordingLogger) Fatalf(format string, args ...interface{}) { r.Printf(format, args...) }
+func (r *recordingLogger) Fatalln(args ...interface{})               { r.Print(args...) }
+func (r *recordingLogger) Print(args ...interface{})                 { r.lines = append(r.lines, fmt.Sprint(args...)) }
+func (r *recordingLogger) Println(args ...interface{})               { r.Print(args...) }
+func (r *recordingLogger) Printf(format string, args ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprintf(format, args...))
+}
+
+func newTestListener(linesPerSecond int) (*Listener, *recordingLogger, *time.Time) {
+	logger := &recordingLogger{}
+	now := time.Unix(1000, 0)
+	l := New(Config{LinesPerSecond: linesPerSecond, Logger: logger})
+	l.now = func() time.Time { return now }
+	return l, logger, &now
+}
+
+func TestLogsDenials(t *testing.T) {
+	l, logger, _ := newTestListener(5)
+
+	l.HandleEvent(events.WithCaller(events.NewTimedOutEvent("ns", "b", false, 3), "10.0.0.1:1234"))
+	l.HandleEvent(events.NewTooManyTokensRequestedEvent("ns", "b", false, 100))
+	l.HandleEvent(events.NewTokensServedEvent("ns", "b", false, 1, 0))
+	l.HandleEvent(events.NewBucketMissedEvent("ns", "b", false))
+
+	if len(logger.lines) != 2 {
+		t.Fatalf("Expected only denials to be logged, got %v", logger.lines)
+	}
+
+	if !strings.Contains(logger.lines[0], "3 tokens from ns:b to 10.0.0.1:1234: timed out") {
+		t.Errorf("Unexpected line %q", logger.lines[0])
+	}
+
+	if !strings.Contains(logger.lines[1], "100 tokens from ns:b to unknown caller: requested more tokens") {
+		t.Errorf("Unexpected line %q", logger.lines[1])
+	}
+}
+
+func TestRateLimitsPerBucket(t *testing.T) {
+	l, logger, now := newTestListener(2)
+
+	for i := 0; i < 10; i++ {
+		l.HandleEvent(events.NewTimedOutEvent("ns", "a", false, 1))
+	}
+	l.HandleEvent(events.NewTimedOutEvent("ns", "b", false, 1))
+
+	if len(logger.lines) != 3 {
+		t.Fatalf("Expected 2 lines for a and 1 for b, got %v", logger.lines)
+	}
+
+	*now = now.Add(time.Second)
+	l.HandleEvent(events.NewTimedOutEvent("ns", "a", false, 1))
+	if len(logger.lines) != 4 || !strings.HasSuffix(logger.lines[3], "(8 similar denials suppressed)") {
+		t.Fatalf("Expected suppressed denials to be reported, got %v", logger.lines)
+	}
+
+	l.HandleEvent(events.NewTimedOutEvent("ns", "a", false, 1))
+	if strings.Contains(logger.lines[4], "suppressed") {
+		t.Fatalf("Expected suppression count to be reset, got %v", logger.lines)
+	}
+}
+
+func TestPrunesIdleBuckets(t *testing.T) {
+	l, logger, now := newTestListener(1)
+
+	l.HandleEvent(events.NewTimedOutEvent("ns", "a", false, 1))
+	l.HandleEvent(events.NewTimedOutEvent("ns", "a", false, 1))
+
+	*now = now.Add(2 * pruneInterval)
+	l.HandleEvent(events.NewTimedOutEvent("ns", "b", false, 1))
+
+	if len(logger.lines) != 3 || logger.lines[1] != "1 further denials from ns:a suppressed" {
+		t.Fatalf("Expected suppressed denials to be reported when pruning, got %v", logger.lines)
+	}
+
+	if _, ok := l.buckets["ns:a"]; ok {
+		t.Fatal("Expected idle bucket to be pruned")
+	}
+}
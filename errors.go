@@ -7,6 +7,7 @@ package quotaservice
 
 import (
 	"errors"
+	"fmt"
 )
 
 // ErrorReason provides details on why calls to Allow may fail.
@@ -24,8 +25,31 @@ const (
 
 	// Too many tokens requested
 	ER_TOO_MANY_TOKENS_REQUESTED
+
+	// Too many requests in flight, either globally or in the namespace
+	ER_OVERLOADED
+
+	// Bucket is on the namespace's deny-list
+	ER_DENIED
 )
 
+var reasonNames = []string{
+	ER_TIMEOUT:                   "TIMEOUT",
+	ER_NO_BUCKET:                 "NO_BUCKET",
+	ER_TOO_MANY_BUCKETS:          "TOO_MANY_BUCKETS",
+	ER_TOO_MANY_TOKENS_REQUESTED: "TOO_MANY_TOKENS_REQUESTED",
+	ER_OVERLOADED:                "OVERLOADED",
+	ER_DENIED:                    "DENIED",
+}
+
+func (r ErrorReason) String() string {
+	if int(r) < 0 || int(r) >= len(reasonNames) {
+		return fmt.Sprintf("ErrorReason(%d)", int(r))
+	}
+
+	return reasonNames[r]
+}
+
 type QuotaServiceError struct {
 	error
 	Reason ErrorReason
@@ -0,0 +1,53 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package events
+
+import (
+	"sync"
+)
+
+// Broadcaster fans events out to any number of subscribers. Subscribers that can't keep up miss
+// events, rather than holding up the event loop.
+type Broadcaster struct {
+	subscribers map[chan Event]struct{}
+	sync.RWMutex
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: make(map[chan Event]struct{})}
+}
+
+// HandleEvent sends an event to all subscribers. It can be used as, or called from, a Listener.
+func (b *Broadcaster) HandleEvent(e Event) {
+	b.RLock()
+	defer b.RUnlock()
+
+	for c := range b.subscribers {
+		select {
+		case c <- e:
+		default:
+			// Subscriber's buffer is full; drop the event.
+		}
+	}
+}
+
+// Subscribe returns a channel on which events are delivered, buffering up to bufSize events, and a
+// function to call to unsubscribe, which closes the channel.
+func (b *Broadcaster) Subscribe(bufSize int) (<-chan Event, func()) {
+	c := make(chan Event, bufSize)
+
+	b.Lock()
+	b.subscribers[c] = struct{}{}
+	b.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.Lock()
+			delete(b.subscribers, c)
+			b.Unlock()
+			close(c)
+		})
+	}
+}
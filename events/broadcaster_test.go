@@ -0,0 +1,36 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package events
+
+import (
+	"testing"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster()
+	c1, unsubscribe1 := b.Subscribe(1)
+	c2, unsubscribe2 := b.Subscribe(1)
+	defer unsubscribe2()
+
+	b.HandleEvent(NewBucketCreatedEvent("ns", "b1", false))
+	// Buffers are full, so this is dropped.
+	b.HandleEvent(NewBucketCreatedEvent("ns", "b2", false))
+
+	for _, c := range []<-chan Event{c1, c2} {
+		if e := <-c; e.BucketName() != "b1" {
+			t.Fatalf("Expected event for b1, got %v", e)
+		}
+	}
+
+	unsubscribe1()
+	unsubscribe1()
+	if _, ok := <-c1; ok {
+		t.Fatal("Expected channel to be closed after unsubscribing")
+	}
+
+	b.HandleEvent(NewBucketCreatedEvent("ns", "b3", false))
+	if e := <-c2; e.BucketName() != "b3" {
+		t.Fatalf("Expected event for b3, got %v", e)
+	}
+}
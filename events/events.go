@@ -5,9 +5,11 @@ package events
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/square/quotaservice/logging"
+	pbconfig "github.com/square/quotaservice/protos/config"
 )
 
 type EventType int
@@ -21,6 +23,13 @@ const (
 	EVENT_BUCKET_REMOVED
 	EVENT_SERVER_ERROR
 	EVENT_BUCKET_ERROR
+	EVENT_TOKEN_SNAPSHOT
+	EVENT_SLO_BREACHED
+	EVENT_BUCKET_RESET
+	EVENT_CONFIG_APPLIED
+	EVENT_CONFIG_REJECTED
+	EVENT_OVER_SOFT_LIMIT
+	EVENT_THRESHOLD_CROSSED
 )
 
 var eventNames = []string{
@@ -32,6 +41,13 @@ var eventNames = []string{
 	EVENT_BUCKET_REMOVED:            "EVENT_BUCKET_REMOVED",
 	EVENT_SERVER_ERROR:              "EVENT_SERVER_ERROR",
 	EVENT_BUCKET_ERROR:              "EVENT_BUCKET_ERROR",
+	EVENT_TOKEN_SNAPSHOT:            "EVENT_TOKEN_SNAPSHOT",
+	EVENT_SLO_BREACHED:              "EVENT_SLO_BREACHED",
+	EVENT_BUCKET_RESET:              "EVENT_BUCKET_RESET",
+	EVENT_CONFIG_APPLIED:            "EVENT_CONFIG_APPLIED",
+	EVENT_CONFIG_REJECTED:           "EVENT_CONFIG_REJECTED",
+	EVENT_OVER_SOFT_LIMIT:           "EVENT_OVER_SOFT_LIMIT",
+	EVENT_THRESHOLD_CROSSED:         "EVENT_THRESHOLD_CROSSED",
 }
 
 func (et EventType) String() string {
@@ -43,6 +59,17 @@ func (et EventType) String() string {
 	return name
 }
 
+// ParseEventType returns the event type with the given name, such as "EVENT_TOKENS_SERVED".
+func ParseEventType(name string) (EventType, bool) {
+	for et, n := range eventNames {
+		if n == name {
+			return EventType(et), true
+		}
+	}
+
+	return 0, false
+}
+
 type Event interface {
 	EventType() EventType
 	Namespace() string
@@ -55,21 +82,44 @@ type Event interface {
 // EventProducer is a hook into the notification system, to inform listeners that certain events
 // take place.
 type EventProducer struct {
-	c chan Event
+	c chan queuedEvent
+	// lagNanos is how long the most recently delivered event spent queued.
+	lagNanos int64
+}
+
+type queuedEvent struct {
+	Event
+	queued time.Time
 }
 
 func (e *EventProducer) Emit(event Event) {
 	select {
-	case e.c <- event:
+	case e.c <- queuedEvent{event, time.Now()}:
 	// OK
 	default:
 		logging.Printf("Event buffer full; dropping %s event for %s.%s", event.EventType(), event.Namespace(), event.BucketName())
 	}
 }
 
+// QueueDepth returns the number of events waiting to be delivered to listeners.
+func (e *EventProducer) QueueDepth() int {
+	return len(e.c)
+}
+
+// QueueCapacity returns the number of events that can be queued before events are dropped.
+func (e *EventProducer) QueueCapacity() int {
+	return cap(e.c)
+}
+
+// Lag returns how long the most recently delivered event waited to be delivered to listeners.
+func (e *EventProducer) Lag() time.Duration {
+	return time.Duration(atomic.LoadInt64(&e.lagNanos))
+}
+
 func (e *EventProducer) notifyListeners(l Listener) {
 	for event := range e.c {
-		l(event)
+		atomic.StoreInt64(&e.lagNanos, int64(time.Since(event.queued)))
+		l(event.Event)
 	}
 }
 
@@ -83,7 +133,7 @@ func RegisterListener(listener Listener, bufsize int) *EventProducer {
 		panic("Cannot register a nil listener")
 	}
 
-	ep := &EventProducer{make(chan Event, bufsize)}
+	ep := &EventProducer{c: make(chan queuedEvent, bufsize)}
 
 	go ep.notifyListeners(listener)
 
@@ -203,6 +253,240 @@ func NewBucketErrorEvent(namespace, bucketName string, dynamic bool) Event {
 	return newNamedEvent(namespace, bucketName, dynamic, EVENT_BUCKET_ERROR)
 }
 
+// NewTokenSnapshotEvent creates a new event with type EVENT_TOKEN_SNAPSHOT. It reports the tokens
+// available in a bucket, or, if negative, the tokens owed by a bucket in debt.
+func NewTokenSnapshotEvent(namespace, bucketName string, dynamic bool, tokens int64) Event {
+	return &tokenEvent{
+		namedEvent: newNamedEvent(namespace, bucketName, dynamic, EVENT_TOKEN_SNAPSHOT),
+		numTokens:  tokens}
+}
+
+// NewOverSoftLimitEvent creates a new event with type EVENT_OVER_SOFT_LIMIT. It indicates that
+// tokens were granted, but took the bucket past its soft limit.
+func NewOverSoftLimitEvent(namespace, bucketName string, dynamic bool, numTokens int64) Event {
+	return &tokenEvent{
+		namedEvent: newNamedEvent(namespace, bucketName, dynamic, EVENT_OVER_SOFT_LIMIT),
+		numTokens:  numTokens}
+}
+
+// NewSLOBreachedEvent creates a new event with type EVENT_SLO_BREACHED. It indicates that more
+// of the requests a bucket granted waited longer than threshold than its SLO allows. NumTokens
+// is the number of such requests, and WaitTime the threshold.
+func NewSLOBreachedEvent(namespace, bucketName string, dynamic bool, slowRequests int64, threshold time.Duration) Event {
+	return &tokenWaitEvent{
+		tokenEvent: &tokenEvent{
+			namedEvent: newNamedEvent(namespace, bucketName, dynamic, EVENT_SLO_BREACHED),
+			numTokens:  slowRequests},
+		waitTime: threshold}
+}
+
+// NewBucketResetEvent creates a new event with type EVENT_BUCKET_RESET. It indicates that an admin
+// restored a bucket to full capacity.
+func NewBucketResetEvent(namespace, bucketName string, dynamic bool) Event {
+	return newNamedEvent(namespace, bucketName, dynamic, EVENT_BUCKET_RESET)
+}
+
+type configEvent struct {
+	*namedEvent
+	version int32
+	err     error
+}
+
+func (c *configEvent) String() string {
+	return fmt.Sprintf("configEvent{type: %v, version: %v, err: %v}", c.eventType, c.version, c.err)
+}
+
+// NewConfigAppliedEvent creates a new event with type EVENT_CONFIG_APPLIED. It indicates that this
+// instance started using a new config. Config events have no namespace or bucket.
+func NewConfigAppliedEvent(version int32) Event {
+	return &configEvent{namedEvent: newNamedEvent("", "", false, EVENT_CONFIG_APPLIED), version: version}
+}
+
+// NewConfigRejectedEvent creates a new event with type EVENT_CONFIG_REJECTED. It indicates that
+// this instance couldn't read, validate or apply a config, and kept using its current one. The
+// version is 0 if the config couldn't be read.
+func NewConfigRejectedEvent(version int32, err error) Event {
+	return &configEvent{namedEvent: newNamedEvent("", "", false, EVENT_CONFIG_REJECTED), version: version, err: err}
+}
+
+// ConfigVersionOf returns the config version of an EVENT_CONFIG_APPLIED or EVENT_CONFIG_REJECTED
+// event, or 0 for other events.
+func ConfigVersionOf(e Event) int32 {
+	if c, ok := unwrap(e).(*configEvent); ok {
+		return c.version
+	}
+
+	return 0
+}
+
+// ConfigErrorOf returns the reason for an EVENT_CONFIG_REJECTED event, or nil for other events.
+func ConfigErrorOf(e Event) error {
+	if c, ok := unwrap(e).(*configEvent); ok {
+		return c.err
+	}
+
+	return nil
+}
+
+type thresholdEvent struct {
+	*tokenEvent
+	threshold int64
+}
+
+func (t *thresholdEvent) String() string {
+	return fmt.Sprintf("thresholdEvent{type: %v, namespace: %v, name: %v, dynamic: %v, numTokens: %v, threshold: %v}",
+		t.eventType, t.namespace, t.bucketName, t.dynamic, t.numTokens, t.threshold)
+}
+
+// NewThresholdCrossedEvent creates a new event with type EVENT_THRESHOLD_CROSSED. It indicates that
+// the tokens consumed from a bucket within its notification window, reported as NumTokens, crossed
+// one of its notification thresholds, a percentage of its size.
+func NewThresholdCrossedEvent(namespace, bucketName string, dynamic bool, consumed, threshold int64) Event {
+	return &thresholdEvent{
+		tokenEvent: &tokenEvent{
+			namedEvent: newNamedEvent(namespace, bucketName, dynamic, EVENT_THRESHOLD_CROSSED),
+			numTokens:  consumed},
+		threshold: threshold}
+}
+
+// ThresholdOf returns the notification threshold crossed by an EVENT_THRESHOLD_CROSSED event, or 0
+// for other events.
+func ThresholdOf(e Event) int64 {
+	if t, ok := unwrap(e).(*thresholdEvent); ok {
+		return t.threshold
+	}
+
+	return 0
+}
+
+// wrapper is implemented by events that attach details, such as a caller or labels, to another.
+type wrapper interface {
+	wrapped() Event
+}
+
+// next returns the event e attaches details to, or nil if e doesn't wrap another event.
+func next(e Event) Event {
+	if w, ok := e.(wrapper); ok {
+		return w.wrapped()
+	}
+
+	return nil
+}
+
+// unwrap returns the event that details were attached to, or e if none were.
+func unwrap(e Event) Event {
+	for w := next(e); w != nil; w = next(e) {
+		e = w
+	}
+
+	return e
+}
+
+type callerEvent struct {
+	Event
+	caller string
+}
+
+func (c *callerEvent) String() string {
+	return fmt.Sprintf("%v{caller: %v}", c.Event, c.caller)
+}
+
+func (c *callerEvent) wrapped() Event {
+	return c.Event
+}
+
+// WithCaller attaches the identity of the caller whose request caused an event, such as its
+// network address, to the event. Callers can be read with CallerOf.
+func WithCaller(e Event, caller string) Event {
+	if caller == "" {
+		return e
+	}
+
+	return &callerEvent{Event: e, caller: caller}
+}
+
+// CallerOf returns the caller attached to an event by WithCaller, or an empty string if none was.
+func CallerOf(e Event) string {
+	for ; e != nil; e = next(e) {
+		if c, ok := e.(*callerEvent); ok {
+			return c.caller
+		}
+	}
+
+	return ""
+}
+
+type labeledEvent struct {
+	Event
+	labels map[string]string
+}
+
+func (l *labeledEvent) String() string {
+	return fmt.Sprintf("%v{labels: %v}", l.Event, l.labels)
+}
+
+func (l *labeledEvent) wrapped() Event {
+	return l.Event
+}
+
+// WithLabels attaches the labels of the namespace and bucket an event concerns, such as team or
+// cost center, to the event, so that listeners can attribute usage. Labels can be read with
+// LabelsOf, and must not be modified.
+func WithLabels(e Event, labels map[string]string) Event {
+	if len(labels) == 0 {
+		return e
+	}
+
+	return &labeledEvent{Event: e, labels: labels}
+}
+
+// LabelsOf returns the labels attached to an event by WithLabels, or nil if none were.
+func LabelsOf(e Event) map[string]string {
+	for ; e != nil; e = next(e) {
+		if l, ok := e.(*labeledEvent); ok {
+			return l.labels
+		}
+	}
+
+	return nil
+}
+
+type configuredEvent struct {
+	Event
+	cfg *pbconfig.BucketConfig
+}
+
+func (c *configuredEvent) String() string {
+	return fmt.Sprintf("%v{config: %v}", c.Event, c.cfg)
+}
+
+func (c *configuredEvent) wrapped() Event {
+	return c.Event
+}
+
+// WithBucketConfig attaches the resolved config of the bucket an event concerns, with the settings
+// it inherits from its namespace and template, to the event. It is attached to EVENT_BUCKET_CREATED
+// and EVENT_BUCKET_REMOVED events, so that listeners can track the quota new callers are given.
+func WithBucketConfig(e Event, cfg *pbconfig.BucketConfig) Event {
+	if cfg == nil {
+		return e
+	}
+
+	return &configuredEvent{Event: e, cfg: cfg}
+}
+
+// BucketConfigOf returns the bucket config attached to an event by WithBucketConfig, or nil if none
+// was. It must not be modified.
+func BucketConfigOf(e Event) *pbconfig.BucketConfig {
+	for ; e != nil; e = next(e) {
+		if c, ok := e.(*configuredEvent); ok {
+			return c.cfg
+		}
+	}
+
+	return nil
+}
+
 func newNamedEvent(namespace, bucketName string, dynamic bool, eventType EventType) *namedEvent {
 	return &namedEvent{
 		eventType:  eventType,
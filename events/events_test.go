@@ -0,0 +1,69 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package events
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+func TestWithCaller(t *testing.T) {
+	e := NewTimedOutEvent("ns", "b", false, 5)
+	if WithCaller(e, "") != e || CallerOf(e) != "" {
+		t.Fatal("Expected no caller to be attached")
+	}
+
+	withCaller := WithCaller(e, "10.0.0.1:1234")
+	if CallerOf(withCaller) != "10.0.0.1:1234" {
+		t.Fatalf("Expected caller 10.0.0.1:1234, got %q", CallerOf(withCaller))
+	}
+
+	if withCaller.EventType() != EVENT_TIMEOUT_SERVING_TOKENS || withCaller.BucketName() != "b" || withCaller.NumTokens() != 5 {
+		t.Fatalf("Expected the event's details to be preserved, got %v", withCaller)
+	}
+}
+
+func TestWithLabels(t *testing.T) {
+	e := NewTimedOutEvent("ns", "b", false, 5)
+	if WithLabels(e, nil) != e || LabelsOf(e) != nil {
+		t.Fatal("Expected no labels to be attached")
+	}
+
+	labeled := WithLabels(WithCaller(e, "10.0.0.1:1234"), map[string]string{"team": "payments"})
+	if LabelsOf(labeled)["team"] != "payments" || CallerOf(labeled) != "10.0.0.1:1234" {
+		t.Fatalf("Expected labels and the caller to be attached, got %v", labeled)
+	}
+
+	config := WithLabels(NewConfigRejectedEvent(3, nil), map[string]string{"team": "payments"})
+	if ConfigVersionOf(config) != 3 || labeled.NumTokens() != 5 {
+		t.Fatalf("Expected the events' details to be preserved, got %v and %v", config, labeled)
+	}
+}
+
+func TestWithBucketConfig(t *testing.T) {
+	e := NewBucketCreatedEvent("ns", "b", true)
+	if WithBucketConfig(e, nil) != e || BucketConfigOf(e) != nil {
+		t.Fatal("Expected no config to be attached")
+	}
+
+	cfg := &pbconfig.BucketConfig{Name: "b", Size: proto.Int64(100)}
+	configured := WithLabels(WithBucketConfig(e, cfg), map[string]string{"team": "payments"})
+	if BucketConfigOf(configured) != cfg || configured.EventType() != EVENT_BUCKET_CREATED {
+		t.Fatalf("Expected the config to be attached, got %v", configured)
+	}
+}
+
+func TestParseEventType(t *testing.T) {
+	for _, et := range []EventType{EVENT_TOKENS_SERVED, EVENT_BUCKET_MISS, EVENT_BUCKET_RESET} {
+		if parsed, ok := ParseEventType(et.String()); !ok || parsed != et {
+			t.Errorf("Expected %v, got %v, %v", et, parsed, ok)
+		}
+	}
+
+	if _, ok := ParseEventType("EVENT_NONEXISTENT"); ok {
+		t.Error("Expected unknown event type not to parse")
+	}
+}
@@ -0,0 +1,69 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// RecordedEvent is an event kept by a History, with the time it was recorded.
+type RecordedEvent struct {
+	Event
+	Time time.Time
+}
+
+// History keeps the most recent events in a ring buffer, so that they can be inspected without a
+// streaming consumer.
+type History struct {
+	events []RecordedEvent
+	next   int
+	full   bool
+	now    func() time.Time
+	sync.RWMutex
+}
+
+// NewHistory creates a History keeping the last size events.
+func NewHistory(size int) *History {
+	if size < 1 {
+		size = 1
+	}
+
+	return &History{events: make([]RecordedEvent, size), now: time.Now}
+}
+
+// HandleEvent records an event, evicting the oldest if the history is full. It can be used as, or
+// called from, a Listener.
+func (h *History) HandleEvent(e Event) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.events[h.next] = RecordedEvent{Event: e, Time: h.now()}
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Recent returns up to limit of the most recent events in namespace, or in all namespaces if
+// namespace is empty, newest first. All matching events are returned if limit isn't positive.
+func (h *History) Recent(namespace string, limit int) []RecordedEvent {
+	h.RLock()
+	defer h.RUnlock()
+
+	n := h.next
+	if h.full {
+		n = len(h.events)
+	}
+
+	var recent []RecordedEvent
+	for i := 1; i <= n && (limit < 1 || len(recent) < limit); i++ {
+		e := h.events[(h.next-i+len(h.events))%len(h.events)]
+		if namespace == "" || e.Namespace() == namespace {
+			recent = append(recent, e)
+		}
+	}
+
+	return recent
+}
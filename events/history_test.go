@@ -0,0 +1,43 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package events
+
+import (
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(3)
+	if recent := h.Recent("", 10); len(recent) != 0 {
+		t.Fatalf("Expected no events, got %v", recent)
+	}
+
+	h.HandleEvent(NewBucketCreatedEvent("ns1", "a", false))
+	h.HandleEvent(NewBucketCreatedEvent("ns2", "b", false))
+	if recent := h.Recent("", 0); len(recent) != 2 || recent[0].BucketName() != "b" || recent[1].BucketName() != "a" {
+		t.Fatalf("Expected b then a, got %v", recent)
+	}
+
+	// Evicts a.
+	h.HandleEvent(NewBucketCreatedEvent("ns1", "c", false))
+	h.HandleEvent(NewBucketCreatedEvent("ns1", "d", false))
+
+	recent := h.Recent("", 0)
+	if len(recent) != 3 || recent[0].BucketName() != "d" || recent[2].BucketName() != "b" {
+		t.Fatalf("Expected d, c, b, got %v", recent)
+	}
+
+	if recent[0].Time.IsZero() {
+		t.Error("Expected events to be timestamped")
+	}
+
+	recent = h.Recent("ns1", 1)
+	if len(recent) != 1 || recent[0].BucketName() != "d" {
+		t.Fatalf("Expected d, got %v", recent)
+	}
+
+	if recent := h.Recent("ns2", 10); len(recent) != 1 || recent[0].BucketName() != "b" {
+		t.Fatalf("Expected b, got %v", recent)
+	}
+}
@@ -0,0 +1,138 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package events
+
+import (
+	"time"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// TokensGranted is a typed EVENT_TOKENS_SERVED event.
+type TokensGranted struct {
+	Namespace string
+	Bucket    string
+	Dynamic   bool
+	Tokens    int64
+	// Wait is how long the caller was told to wait before using the tokens.
+	Wait time.Duration
+	// Labels attribute the bucket's usage, if any are configured. See WithLabels.
+	Labels map[string]string
+}
+
+// TokensDenied is a typed EVENT_TIMEOUT_SERVING_TOKENS or EVENT_TOO_MANY_TOKENS_REQUESTED event.
+type TokensDenied struct {
+	Namespace string
+	Bucket    string
+	Dynamic   bool
+	Tokens    int64
+	// TimedOut is true if the tokens couldn't be granted within the max wait time, and false if
+	// more tokens were requested than the bucket allows per request.
+	TimedOut bool
+	// Caller is the caller that requested the tokens, if known. See WithCaller.
+	Caller string
+	// Labels attribute the bucket's usage, if any are configured. See WithLabels.
+	Labels map[string]string
+}
+
+// BucketCreated is a typed EVENT_BUCKET_CREATED event.
+type BucketCreated struct {
+	Namespace string
+	Bucket    string
+	Dynamic   bool
+	// Config is the bucket's resolved config, if known. See WithBucketConfig.
+	Config *pbconfig.BucketConfig
+}
+
+// BucketRemoved is a typed EVENT_BUCKET_REMOVED event. Dynamic buckets are removed when they
+// expire, after being idle for their max idle time.
+type BucketRemoved struct {
+	Namespace string
+	Bucket    string
+	Dynamic   bool
+	// Config is the bucket's resolved config, if known. See WithBucketConfig.
+	Config *pbconfig.BucketConfig
+}
+
+// ConfigApplied is a typed EVENT_CONFIG_APPLIED event.
+type ConfigApplied struct {
+	Version int32
+}
+
+// ConfigRejected is a typed EVENT_CONFIG_REJECTED event.
+type ConfigRejected struct {
+	// Version is the rejected config's version, or 0 if it couldn't be read.
+	Version int32
+	Err     error
+}
+
+// Visitor handles events as typed structs, rather than switching on their EventType. Embed
+// BaseVisitor to only handle some events.
+type Visitor interface {
+	TokensGranted(*TokensGranted)
+	TokensDenied(*TokensDenied)
+	BucketCreated(*BucketCreated)
+	BucketRemoved(*BucketRemoved)
+	ConfigApplied(*ConfigApplied)
+	ConfigRejected(*ConfigRejected)
+	// Other handles events without typed structs.
+	Other(Event)
+}
+
+// BaseVisitor ignores all events.
+type BaseVisitor struct{}
+
+func (BaseVisitor) TokensGranted(*TokensGranted)   {}
+func (BaseVisitor) TokensDenied(*TokensDenied)     {}
+func (BaseVisitor) BucketCreated(*BucketCreated)   {}
+func (BaseVisitor) BucketRemoved(*BucketRemoved)   {}
+func (BaseVisitor) ConfigApplied(*ConfigApplied)   {}
+func (BaseVisitor) ConfigRejected(*ConfigRejected) {}
+func (BaseVisitor) Other(Event)                    {}
+
+var _ Visitor = BaseVisitor{}
+
+// Visit passes an event to the Visitor method for its type.
+func Visit(e Event, v Visitor) {
+	switch e.EventType() {
+	case EVENT_TOKENS_SERVED:
+		v.TokensGranted(&TokensGranted{
+			Namespace: e.Namespace(),
+			Bucket:    e.BucketName(),
+			Dynamic:   e.Dynamic(),
+			Tokens:    e.NumTokens(),
+			Wait:      e.WaitTime(),
+			Labels:    LabelsOf(e)})
+	case EVENT_TIMEOUT_SERVING_TOKENS, EVENT_TOO_MANY_TOKENS_REQUESTED:
+		v.TokensDenied(&TokensDenied{
+			Namespace: e.Namespace(),
+			Bucket:    e.BucketName(),
+			Dynamic:   e.Dynamic(),
+			Tokens:    e.NumTokens(),
+			TimedOut:  e.EventType() == EVENT_TIMEOUT_SERVING_TOKENS,
+			Caller:    CallerOf(e),
+			Labels:    LabelsOf(e)})
+	case EVENT_BUCKET_CREATED:
+		v.BucketCreated(&BucketCreated{Namespace: e.Namespace(), Bucket: e.BucketName(), Dynamic: e.Dynamic(), Config: BucketConfigOf(e)})
+	case EVENT_BUCKET_REMOVED:
+		v.BucketRemoved(&BucketRemoved{Namespace: e.Namespace(), Bucket: e.BucketName(), Dynamic: e.Dynamic(), Config: BucketConfigOf(e)})
+	case EVENT_CONFIG_APPLIED:
+		v.ConfigApplied(&ConfigApplied{Version: ConfigVersionOf(e)})
+	case EVENT_CONFIG_REJECTED:
+		v.ConfigRejected(&ConfigRejected{Version: ConfigVersionOf(e), Err: ConfigErrorOf(e)})
+	default:
+		v.Other(e)
+	}
+}
+
+// NewVisitorListener creates a Listener that passes events to a Visitor.
+func NewVisitorListener(v Visitor) Listener {
+	if v == nil {
+		panic("Cannot create a listener with a nil visitor")
+	}
+
+	return func(e Event) {
+		Visit(e, v)
+	}
+}
@@ -0,0 +1,50 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package events
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type recordingVisitor struct {
+	BaseVisitor
+	visited []interface{}
+}
+
+func (r *recordingVisitor) TokensGranted(e *TokensGranted) { r.visited = append(r.visited, e) }
+func (r *recordingVisitor) TokensDenied(e *TokensDenied)   { r.visited = append(r.visited, e) }
+func (r *recordingVisitor) ConfigRejected(e *ConfigRejected) {
+	r.visited = append(r.visited, e)
+}
+func (r *recordingVisitor) Other(e Event) { r.visited = append(r.visited, e) }
+
+func TestVisit(t *testing.T) {
+	v := &recordingVisitor{}
+	l := NewVisitorListener(v)
+
+	missed := NewBucketMissedEvent("ns", "b", true)
+	rejectedErr := errors.New("no such quota group")
+	l(WithLabels(NewTokensServedEvent("ns", "b", true, 3, time.Second), map[string]string{"team": "t"}))
+	l(WithCaller(NewTimedOutEvent("ns", "b", false, 4), "10.0.0.1:1234"))
+	l(NewTooManyTokensRequestedEvent("ns", "b", false, 100))
+	// Handled by BaseVisitor.
+	l(NewConfigRejectedEvent(7, rejectedErr))
+	l(NewBucketCreatedEvent("ns", "b", true))
+	l(NewConfigAppliedEvent(8))
+	l(missed)
+
+	expected := []interface{}{
+		&TokensGranted{Namespace: "ns", Bucket: "b", Dynamic: true, Tokens: 3, Wait: time.Second, Labels: map[string]string{"team": "t"}},
+		&TokensDenied{Namespace: "ns", Bucket: "b", Tokens: 4, TimedOut: true, Caller: "10.0.0.1:1234"},
+		&TokensDenied{Namespace: "ns", Bucket: "b", Tokens: 100},
+		&ConfigRejected{Version: 7, Err: rejectedErr},
+		missed}
+
+	if !reflect.DeepEqual(v.visited, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, v.visited)
+	}
+}
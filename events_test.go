@@ -6,9 +6,11 @@ package quotaservice
 import (
 	"context"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/events"
 	"github.com/square/quotaservice/test/helpers"
@@ -17,7 +19,7 @@ import (
 var s Server
 var qs QuotaService
 var eventsChan <-chan events.Event
-var mbf *MockBucketFactory
+var mbf MockBucketFactory
 
 func TestMain(m *testing.M) {
 	setUp()
@@ -32,8 +34,8 @@ func setUp() {
 	// Namespace "dyn"
 	ns := config.NewDefaultNamespaceConfig("dyn")
 	tpl := config.NewDefaultBucketConfig("")
-	tpl.MaxTokensPerRequest = 5
-	tpl.MaxIdleMillis = -1
+	tpl.MaxTokensPerRequest = proto.Int64(5)
+	tpl.MaxIdleMillis = proto.Int64(-1)
 	config.SetDynamicBucketTemplate(ns, tpl)
 	ns.MaxDynamicBuckets = 2
 	helpers.PanicError(config.AddNamespace(cfg, ns))
@@ -41,31 +43,35 @@ func setUp() {
 	// Namespace "dyn_gc"
 	ns = config.NewDefaultNamespaceConfig("dyn_gc")
 	tpl = config.NewDefaultBucketConfig("")
-	tpl.MaxTokensPerRequest = 5
-	tpl.MaxIdleMillis = 100
+	tpl.MaxTokensPerRequest = proto.Int64(5)
+	tpl.MaxIdleMillis = proto.Int64(100)
 	config.SetDynamicBucketTemplate(ns, tpl)
 	ns.MaxDynamicBuckets = 3
 	helpers.PanicError(config.AddNamespace(cfg, ns))
 
 	// Namespace "nodyn"
 	ns = config.NewDefaultNamespaceConfig("nodyn")
+	ns.Labels = map[string]string{"team": "quota", "tier": "2"}
 	b := config.NewDefaultBucketConfig("b")
-	b.MaxTokensPerRequest = 10
+	b.MaxTokensPerRequest = proto.Int64(10)
+	b.Labels = map[string]string{"tier": "1"}
 	helpers.PanicError(config.AddBucket(ns, b))
 	helpers.PanicError(config.AddNamespace(cfg, ns))
 
-	mbf = &MockBucketFactory{}
-	me := &MockEndpoint{}
+	mbf = NewMockBucketFactory()
 	p := config.NewMemoryConfig(cfg)
-	s = New(mbf, p, NewReaperConfigForTests(), 0, me)
+	s = New(mbf, p, NewReaperConfigForTests(), 0, NewMockEndpoint())
 	ecLocal := make(chan events.Event, 100)
 	s.SetListener(func(e events.Event) {
-		ecLocal <- e
+		// Config events are tested separately.
+		if e.EventType() != events.EVENT_CONFIG_APPLIED {
+			ecLocal <- e
+		}
 	}, 100)
 	if _, e := s.Start(); e != nil {
 		helpers.PanicError(e)
 	}
-	qs = me.QuotaService
+	qs = s.(QuotaService)
 	// EVENTS_BUCKET_CREATED event
 	eventsChan = ecLocal
 	<-ecLocal
@@ -78,6 +84,27 @@ func TestTokens(t *testing.T) {
 	checkEvent("nodyn", "b", false, events.EVENT_TOKENS_SERVED, 1, 0, <-eventsChan, t)
 }
 
+func TestLabels(t *testing.T) {
+	if _, _, e := qs.Allow(context.Background(), "nodyn", "b", 1, 0, false); e != nil {
+		t.Fatalf("Not expecting error %+v", e)
+	}
+	evt := <-eventsChan
+	checkEvent("nodyn", "b", false, events.EVENT_TOKENS_SERVED, 1, 0, evt, t)
+	if labels := events.LabelsOf(evt); !reflect.DeepEqual(labels, map[string]string{"team": "quota", "tier": "1"}) {
+		t.Fatalf("Expected the bucket's labels to be attached to the event, got %v", labels)
+	}
+
+	// Buckets that aren't statically defined have the namespace's labels.
+	if _, _, e := qs.Allow(context.Background(), "nodyn", "x", 1, 0, false); e == nil {
+		t.Fatal("Expecting error \"No such bucket\"")
+	}
+	evt = <-eventsChan
+	checkEvent("nodyn", "x", false, events.EVENT_BUCKET_MISS, 0, 0, evt, t)
+	if labels := events.LabelsOf(evt); !reflect.DeepEqual(labels, map[string]string{"team": "quota", "tier": "2"}) {
+		t.Fatalf("Expected the namespace's labels to be attached to the event, got %v", labels)
+	}
+}
+
 func TestTooManyTokens(t *testing.T) {
 	if _, _, e := qs.Allow(context.Background(), "nodyn", "b", 100, 0, false); e == nil {
 		t.Fatal("Expecting error \"Too many tokens requested.\"")
@@ -94,6 +121,20 @@ func TestTimeout(t *testing.T) {
 	mbf.SetWaitTime("nodyn", "b", 0)
 }
 
+func TestTimeoutCaller(t *testing.T) {
+	mbf.SetWaitTime("nodyn", "b", 2*time.Minute)
+	ctx := WithCaller(context.Background(), "10.0.0.1:1234")
+	if _, _, e := qs.Allow(ctx, "nodyn", "b", 1, 1, false); e == nil {
+		t.Fatal("Expecting error \"Timed out waiting\"")
+	}
+	evt := <-eventsChan
+	checkEvent("nodyn", "b", false, events.EVENT_TIMEOUT_SERVING_TOKENS, 1, 0, evt, t)
+	if caller := events.CallerOf(evt); caller != "10.0.0.1:1234" {
+		t.Fatalf("Expected the caller to be attached to the event, got %q", caller)
+	}
+	mbf.SetWaitTime("nodyn", "b", 0)
+}
+
 func TestWithWait(t *testing.T) {
 	mbf.SetWaitTime("nodyn", "b", 2*time.Nanosecond)
 	if _, _, e := qs.Allow(context.Background(), "nodyn", "b", 1, 10, false); e != nil {
@@ -114,8 +155,14 @@ func TestNewDynBucket(t *testing.T) {
 	if _, _, e := qs.Allow(context.Background(), "dyn", "b", 1, 0, false); e != nil {
 		t.Fatalf("Not expecting error %+v", e)
 	}
-	checkEvent("dyn", "b", true, events.EVENT_BUCKET_CREATED, 0, 0, <-eventsChan, t)
+	created := <-eventsChan
+	checkEvent("dyn", "b", true, events.EVENT_BUCKET_CREATED, 0, 0, created, t)
 	checkEvent("dyn", "b", true, events.EVENT_TOKENS_SERVED, 1, 0, <-eventsChan, t)
+
+	// The config is resolved, with the settings the bucket inherits from its template.
+	if cfg := events.BucketConfigOf(created); cfg.GetMaxTokensPerRequest() != 5 {
+		t.Fatalf("Expected the bucket's resolved config, got %v", cfg)
+	}
 }
 
 func TestTooManyDynBuckets(t *testing.T) {
@@ -152,6 +199,9 @@ func TestBucketRemoval(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		e := <-eventsChan
 		checkEvent("dyn_gc", e.BucketName(), true, events.EVENT_BUCKET_REMOVED, 0, 0, e, t)
+		if events.BucketConfigOf(e).GetMaxIdleMillis() != 100 {
+			t.Fatalf("Expected the removed bucket's config, got %v", events.BucketConfigOf(e))
+		}
 	}
 }
 
@@ -0,0 +1,46 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// The mocks in package testing import this package, so tests of its internals can't import them.
+// They are handed over by setup_test.go, in the external test package, before tests run instead.
+
+// MockBucketFactory is the part of testing.MockBucketFactory used by tests of internals.
+type MockBucketFactory interface {
+	BucketFactory
+	SetWaitTime(namespace, name string, d time.Duration)
+	SetError(namespace, name string, err error)
+	Charged(namespace, name string) int64
+	Warmed(namespace, name string) int
+}
+
+var (
+	// NewMockBucketFactory creates a testing.MockBucketFactory.
+	NewMockBucketFactory func() MockBucketFactory
+	// NewMockEmitter creates a testing.MockEmitter.
+	NewMockEmitter func() interface{ Emit(e events.Event) }
+	// NewMockEndpoint creates a testing.MockEndpoint.
+	NewMockEndpoint func() RpcEndpoint
+	// NewReaperConfigForTests is testing.NewReaperConfig.
+	NewReaperConfigForTests func() config.ReaperConfig
+)
+
+// NewBucketContainerWithMocks creates a bucket container for cfg, whose buckets are created by a
+// mock factory.
+func NewBucketContainerWithMocks(cfg *pbconfig.ServiceConfig) (*bucketContainer, MockBucketFactory) {
+	bf := NewMockBucketFactory()
+	bc := NewBucketContainer(bf, NewMockEmitter(), NewReaperConfigForTests())
+	bc.Init(cfg)
+
+	return bc, bf
+}
@@ -0,0 +1,59 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// fairShareBucket gives a dynamic bucket its weighted share of its namespace's fair_share_fill_rate,
+// rather than the dynamic bucket template's fill rate. Buckets are created with the template's fill
+// rate, so requests are scaled by the ratio of that rate to the bucket's current share, which
+// changes as dynamic buckets are created and reaped.
+type fairShareBucket struct {
+	Bucket
+	ns     *namespace
+	weight int64
+}
+
+func newFairShareBucket(b Bucket, ns *namespace, weight int64) *fairShareBucket {
+	return &fairShareBucket{Bucket: b, ns: ns, weight: weight}
+}
+
+// scale returns the tokens to take from the underlying bucket for numTokens. Requests the bucket
+// could hold are scaled to at most its size, so that a bucket with a small share still grants them,
+// once it is full.
+func (b *fairShareBucket) scale(numTokens int64) int64 {
+	b.ns.RLock()
+	totalRate := b.ns.cfg.FairShareFillRate
+	totalWeight := b.ns.dynamicBucketWeights
+	b.ns.RUnlock()
+
+	templateRate := b.Config().GetFillRate()
+	if totalRate <= 0 || totalWeight <= 0 || templateRate <= 0 {
+		return numTokens
+	}
+
+	share := float64(totalRate) * float64(b.weight) / float64(totalWeight)
+	scaled := math.Ceil(math.Abs(float64(numTokens)) * float64(templateRate) / share)
+	if limit := math.Max(float64(b.Config().GetSize()), math.Abs(float64(numTokens))); scaled > limit {
+		scaled = limit
+	}
+
+	if numTokens < 0 {
+		return -int64(scaled)
+	}
+
+	return int64(scaled)
+}
+
+func (b *fairShareBucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	return b.Bucket.Take(ctx, b.scale(numTokens), maxWaitTime)
+}
+
+func (b *fairShareBucket) Charge(ctx context.Context, numTokens int64) error {
+	return b.Bucket.Charge(ctx, b.scale(numTokens))
+}
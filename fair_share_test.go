@@ -0,0 +1,59 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestFairShare(t *testing.T) {
+	c := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig("ns")
+	ns.FairShareFillRate = 100
+	ns.FairShareWeights = map[string]int64{"heavy": 3}
+	ns.DynamicBucketTemplate = config.NewDefaultBucketConfig(config.DynamicBucketTemplateName)
+	ns.DynamicBucketTemplate.FillRate = proto.Int64(100)
+	helpers.PanicError(config.AddNamespace(c, ns))
+
+	bc, _ := NewBucketContainerWithMocks(c)
+	tokens := func(name string) int64 {
+		b, err := bc.FindBucket("ns", name)
+		helpers.CheckError(t, err)
+		_, scaled, err := unwrapBucket(b, 10)
+		helpers.CheckError(t, err)
+		return scaled
+	}
+
+	if scaled := tokens("light"); scaled != 10 {
+		t.Fatalf("Expected a lone bucket to get the namespace's whole rate, took %v tokens", scaled)
+	}
+
+	// heavy gets 3/4 of the rate, and light 1/4.
+	if scaled := tokens("heavy"); scaled != 14 {
+		t.Fatalf("Expected heavy to take 14 tokens, took %v", scaled)
+	}
+
+	if scaled := tokens("light"); scaled != 40 {
+		t.Fatalf("Expected light to take 40 tokens, took %v", scaled)
+	}
+
+	// Requests are scaled to at most the bucket's size, so that they can still be granted.
+	b, err := bc.FindBucket("ns", "light")
+	helpers.CheckError(t, err)
+	if _, scaled, _ := unwrapBucket(b, 50); scaled != 100 {
+		t.Fatalf("Expected light to take its whole size, took %v tokens", scaled)
+	}
+
+	// Buckets are removed with the weight they were created with, even if the config has changed
+	// since.
+	bc.namespaces["ns"].cfg.FairShareWeights = map[string]int64{"heavy": 10}
+	bc.namespaces["ns"].removeBucket("heavy")
+	if scaled := tokens("light"); scaled != 10 {
+		t.Fatalf("Expected shares to be rebalanced when a bucket is removed, took %v tokens", scaled)
+	}
+}
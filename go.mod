@@ -12,7 +12,7 @@ require (
 	github.com/golang/protobuf v1.5.2
 	github.com/googleapis/gax-go v0.0.0-20170305230405-8c5154c0fe5b // indirect
 	github.com/kr/pretty v0.1.0 // indirect
-	github.com/lib/pq v1.0.0 // indirect
+	github.com/lib/pq v1.0.0
 	github.com/mattn/go-sqlite3 v1.9.0 // indirect
 	github.com/opentracing/opentracing-go v1.0.2
 	github.com/ory/dockertest/v3 v3.6.0
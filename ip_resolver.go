@@ -0,0 +1,85 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// IPResolver is a Resolver that charges requests to buckets named after the network the caller's
+// IP address is in, such as "10.1.2.0/24" or "2001:db8::/48", so that abusive networks can be
+// throttled without an external component. Networks are aggregated by prefix length, separately
+// for IPv4 and IPv6; IPv4-mapped IPv6 addresses are treated as IPv4.
+//
+// The caller's address is read from the context, as attached by WithCaller, which the gRPC and
+// Thrift endpoints do. Requests without a caller address are rejected with ER_NO_BUCKET. The
+// requested namespace is kept, and should have a dynamic bucket template, from which a bucket is
+// created for each network.
+type IPResolver struct {
+	ipv4Mask, ipv6Mask net.IPMask
+	// namespaces to resolve, or all namespaces if empty.
+	namespaces map[string]bool
+}
+
+// NewIPResolver creates an IPResolver aggregating IPv4 addresses by ipv4PrefixLen bits, e.g. 32 for
+// each address, or 24 or 16 for networks, and IPv6 addresses by ipv6PrefixLen bits, e.g. 128, 64 or
+// 48. Only requests to the given namespaces are resolved, or to all namespaces if none are given.
+// Requests to other namespaces pass through.
+func NewIPResolver(ipv4PrefixLen, ipv6PrefixLen int, namespaces ...string) *IPResolver {
+	if ipv4PrefixLen < 1 || ipv4PrefixLen > 32 || ipv6PrefixLen < 1 || ipv6PrefixLen > 128 {
+		panic(fmt.Sprintf("Invalid prefix lengths /%v and /%v", ipv4PrefixLen, ipv6PrefixLen))
+	}
+
+	r := &IPResolver{
+		ipv4Mask:   net.CIDRMask(ipv4PrefixLen, 32),
+		ipv6Mask:   net.CIDRMask(ipv6PrefixLen, 128),
+		namespaces: make(map[string]bool)}
+
+	for _, ns := range namespaces {
+		r.namespaces[ns] = true
+	}
+
+	return r
+}
+
+func (r *IPResolver) Resolve(ctx context.Context, namespace, name string, tokens int64) (string, string, int64, error) {
+	if len(r.namespaces) > 0 && !r.namespaces[namespace] {
+		return namespace, name, tokens, nil
+	}
+
+	network, err := r.network(CallerFromContext(ctx))
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	return namespace, network, tokens, nil
+}
+
+// network returns the network a caller's address, with or without a port, belongs to.
+func (r *IPResolver) network(caller string) (string, error) {
+	if caller == "" {
+		return "", errors.New("caller address unknown")
+	}
+
+	host := caller
+	if h, _, err := net.SplitHostPort(caller); err == nil {
+		host = h
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", errors.Errorf("caller address %v isn't an IP address", caller)
+	}
+
+	mask := r.ipv6Mask
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, r.ipv4Mask
+	}
+
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String(), nil
+}
@@ -0,0 +1,83 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestIPResolverAggregation(t *testing.T) {
+	for _, tc := range []struct {
+		ipv4, ipv6     int
+		caller, bucket string
+	}{
+		{32, 128, "10.1.2.3:1234", "10.1.2.3/32"},
+		{24, 128, "10.1.2.3:1234", "10.1.2.0/24"},
+		{16, 128, "10.1.2.3", "10.1.0.0/16"},
+		{24, 64, "[2001:db8:1:2:3::4]:1234", "2001:db8:1:2::/64"},
+		{24, 48, "2001:db8:1:2:3::4", "2001:db8:1::/48"},
+		{24, 48, "[::ffff:10.1.2.3]:1234", "10.1.2.0/24"},
+	} {
+		r := NewIPResolver(tc.ipv4, tc.ipv6)
+		ns, name, tokens, err := r.Resolve(WithCaller(context.Background(), tc.caller), "ns", "b", 3)
+		helpers.CheckError(t, err)
+		if ns != "ns" || name != tc.bucket || tokens != 3 {
+			t.Errorf("Expected %v to resolve to %v, got %v:%v, %v tokens", tc.caller, tc.bucket, ns, name, tokens)
+		}
+	}
+}
+
+func TestIPResolverNamespaces(t *testing.T) {
+	r := NewIPResolver(24, 64, "by-ip")
+	ctx := WithCaller(context.Background(), "10.1.2.3:1234")
+
+	if _, name, _, _ := r.Resolve(ctx, "other", "b", 1); name != "b" {
+		t.Errorf("Expected other namespaces to pass through, got %v", name)
+	}
+
+	if _, name, _, _ := r.Resolve(ctx, "by-ip", "b", 1); name != "10.1.2.0/24" {
+		t.Errorf("Expected the namespace to be resolved, got %v", name)
+	}
+}
+
+func TestIPResolverInvalid(t *testing.T) {
+	helpers.ExpectingPanic(t, func() { NewIPResolver(33, 64) })
+	helpers.ExpectingPanic(t, func() { NewIPResolver(24, 0) })
+
+	r := NewIPResolver(24, 64)
+	for _, caller := range []string{"", "not-an-ip:1234"} {
+		if _, _, _, err := r.Resolve(WithCaller(context.Background(), caller), "ns", "b", 1); err == nil {
+			t.Errorf("Expected caller %q not to resolve", caller)
+		}
+	}
+}
+
+func TestIPResolverDynamicBuckets(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("by-ip")
+	config.SetDynamicBucketTemplate(nsc, config.NewDefaultBucketConfig(""))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetResolver(NewIPResolver(24, 64))
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	_, dynamic, err := s.Allow(WithCaller(context.Background(), "10.1.2.3:1234"), "by-ip", "any", 1, 0, false)
+	helpers.CheckError(t, err)
+	if !dynamic || !s.bucketContainer.Exists("by-ip", "10.1.2.0/24") {
+		t.Fatal("Expected a dynamic bucket for the caller's network")
+	}
+
+	_, _, err = s.Allow(context.Background(), "by-ip", "any", 1, 0, false)
+	if qsErr, ok := err.(QuotaServiceError); !ok || qsErr.Reason != ER_NO_BUCKET {
+		t.Fatalf("Expected ER_NO_BUCKET without a caller address, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+// eventLabels are the labels attached to events, resolved once per config rather than for every
+// event emitted.
+type eventLabels struct {
+	namespaces map[string]*namespaceLabels
+	// global are the labels of buckets in namespaces that don't exist.
+	global map[string]string
+}
+
+type namespaceLabels struct {
+	// buckets are the labels of the namespace's statically defined buckets.
+	buckets map[string]map[string]string
+	// other are the labels of every other bucket in the namespace, which are dynamic buckets or
+	// the namespace's default bucket.
+	other map[string]string
+}
+
+func newEventLabels(cfg *pb.ServiceConfig) *eventLabels {
+	l := &eventLabels{
+		namespaces: make(map[string]*namespaceLabels, len(cfg.Namespaces)),
+		global:     config.BucketLabels(cfg, "", "")}
+
+	for name, nsCfg := range cfg.Namespaces {
+		nl := &namespaceLabels{
+			buckets: make(map[string]map[string]string, len(nsCfg.Buckets)),
+			other:   config.BucketLabels(cfg, name, "")}
+
+		for bucketName := range nsCfg.Buckets {
+			nl.buckets[bucketName] = config.BucketLabels(cfg, name, bucketName)
+		}
+
+		l.namespaces[name] = nl
+	}
+
+	return l
+}
+
+func (l *eventLabels) labels(namespace, bucketName string) map[string]string {
+	nl := l.namespaces[namespace]
+	if nl == nil {
+		return l.global
+	}
+
+	if labels, exists := nl.buckets[bucketName]; exists {
+		return labels
+	}
+
+	return nl.other
+}
+
+// setEventLabels records the labels attached to events of each bucket. Like suppressed events, they
+// are read without locks.
+func (s *server) setEventLabels(cfg *pb.ServiceConfig) {
+	s.eventLabels.Store(newEventLabels(cfg))
+}
+
+// withLabels attaches the labels of the bucket an event concerns to it. Events that don't concern a
+// bucket, such as config events, aren't labeled.
+func (s *server) withLabels(e events.Event) events.Event {
+	l, _ := s.eventLabels.Load().(*eventLabels)
+	if l == nil || e.Namespace() == "" {
+		return e
+	}
+
+	return events.WithLabels(e, l.labels(e.Namespace(), e.BucketName()))
+}
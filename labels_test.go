@@ -0,0 +1,42 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestEventLabels(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	cfg.GlobalDefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
+	cfg.GlobalDefaultBucket.Labels = map[string]string{"team": "unowned"}
+
+	ns := config.NewDefaultNamespaceConfig("ns")
+	ns.Labels = map[string]string{"team": "quota", "tier": "2"}
+	b := config.NewDefaultBucketConfig("b")
+	b.Labels = map[string]string{"tier": "1"}
+	helpers.CheckError(t, config.AddBucket(ns, b))
+	tpl := config.NewDefaultBucketConfig("")
+	tpl.Labels = map[string]string{"tier": "3"}
+	config.SetDynamicBucketTemplate(ns, tpl)
+	helpers.CheckError(t, config.AddNamespace(cfg, ns))
+
+	l := newEventLabels(cfg)
+	for _, tc := range []struct {
+		namespace, bucketName string
+		expected              map[string]string
+	}{
+		{"ns", "b", map[string]string{"team": "quota", "tier": "1"}},
+		{"ns", "dyn", map[string]string{"team": "quota", "tier": "3"}},
+		{"other", "b", map[string]string{"team": "unowned"}},
+	} {
+		if labels := l.labels(tc.namespace, tc.bucketName); !reflect.DeepEqual(labels, tc.expected) {
+			t.Fatalf("Expected labels %v for %v:%v, got %v", tc.expected, tc.namespace, tc.bucketName, labels)
+		}
+	}
+}
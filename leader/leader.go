@@ -0,0 +1,31 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package leader elects one of the instances sharing a backend to run singleton maintenance tasks,
+// such as purging deleted namespaces, saving stats snapshots and cleaning up stale buckets, so that
+// a fleet doesn't run them once per instance.
+package leader
+
+// Elector reports whether this instance is the leader. Leadership may change at any time, so
+// tasks check IsLeader each time they run, rather than once.
+type Elector interface {
+	// IsLeader is true if this instance should run singleton tasks.
+	IsLeader() bool
+	// Close stops taking part in elections, giving up leadership if held, so that another instance
+	// can take over without waiting for it to expire.
+	Close()
+}
+
+type staticElector bool
+
+// NewStaticElector creates an Elector that always, or never, reports this instance as the
+// leader. An instance that isn't sharing a backend is always its own leader.
+func NewStaticElector(leader bool) Elector {
+	return staticElector(leader)
+}
+
+func (e staticElector) IsLeader() bool {
+	return bool(e)
+}
+
+func (staticElector) Close() {}
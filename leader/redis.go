@@ -0,0 +1,160 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package leader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/square/quotaservice/logging"
+)
+
+// campaignScript acquires the lock if no one holds it, or extends its expiry if this instance
+// does, returning 1 if this instance holds the lock.
+var campaignScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if not holder then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+if holder == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0`)
+
+// releaseScript deletes the lock if this instance still holds it.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// RedisConfig configures an Elector backed by a lock in Redis.
+type RedisConfig struct {
+	// Key is the key holding the lock. Instances electing a leader among themselves share a key.
+	Key string
+	// ID identifies this instance, and must be unique among instances sharing Key.
+	ID string
+	// TTL is how long the lock is held without being renewed. The leader renews it every third of
+	// the TTL, so another instance takes over within TTL of the leader going away.
+	TTL time.Duration
+}
+
+// NewDefaultRedisConfig creates a RedisConfig for the instance identified by id, with a 30 second
+// TTL.
+func NewDefaultRedisConfig(id string) RedisConfig {
+	return RedisConfig{
+		Key: "quotaservice:leader",
+		ID:  id,
+		TTL: 30 * time.Second}
+}
+
+type redisElector struct {
+	// leaseExpiry is the Unix time in nanos until which this instance holds the lock, accessed
+	// atomically. It comes first for 64-bit alignment.
+	leaseExpiry int64
+	client      redis.UniversalClient
+	cfg         RedisConfig
+	stop        chan struct{}
+	done        chan struct{}
+	closer      sync.Once
+}
+
+// NewRedisElector creates an Elector that campaigns for a lock in Redis, and is the leader while it
+// holds the lock. Leadership is judged by the local clock, and given up before the lock expires in
+// Redis, so that two instances never both consider themselves leaders unless a lock renewal takes
+// longer than the TTL to reach Redis.
+func NewRedisElector(client redis.UniversalClient, cfg RedisConfig) Elector {
+	if client == nil {
+		panic("A Redis client is required")
+	}
+
+	if cfg.Key == "" || cfg.ID == "" {
+		panic("Key and ID are required")
+	}
+
+	if cfg.TTL <= 0 {
+		panic("TTL must be positive")
+	}
+
+	e := &redisElector{
+		client: client,
+		cfg:    cfg,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{})}
+
+	go e.run()
+	return e
+}
+
+func (e *redisElector) IsLeader() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&e.leaseExpiry)
+}
+
+func (e *redisElector) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.cfg.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		e.campaign()
+
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign acquires the lock, or renews it if already held.
+func (e *redisElector) campaign() {
+	wasLeader := e.IsLeader()
+	// The lease is measured from before the request, as Redis may set the expiry at any point
+	// during it.
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.TTL/3)
+	defer cancel()
+
+	held, err := campaignScript.Run(ctx, e.client, []string{e.cfg.Key}, e.cfg.ID, e.cfg.TTL.Milliseconds()).Int64()
+	if err != nil {
+		// Leadership lapses with the lease, unless a later renewal succeeds.
+		logging.Printf("Unable to campaign for leadership of %v: %v", e.cfg.Key, err)
+		return
+	}
+
+	if held == 1 {
+		atomic.StoreInt64(&e.leaseExpiry, start.Add(e.cfg.TTL).UnixNano())
+		if !wasLeader {
+			logging.Printf("%v is now the leader of %v", e.cfg.ID, e.cfg.Key)
+		}
+	} else {
+		atomic.StoreInt64(&e.leaseExpiry, 0)
+		if wasLeader {
+			logging.Printf("%v lost leadership of %v", e.cfg.ID, e.cfg.Key)
+		}
+	}
+}
+
+func (e *redisElector) Close() {
+	e.closer.Do(func() {
+		close(e.stop)
+		<-e.done
+
+		// The lock may still be held in Redis after the local lease has lapsed, so release it
+		// regardless.
+		atomic.StoreInt64(&e.leaseExpiry, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), e.cfg.TTL/3)
+		defer cancel()
+		if err := releaseScript.Run(ctx, e.client, []string{e.cfg.Key}, e.cfg.ID).Err(); err != nil {
+			logging.Printf("Unable to give up leadership of %v: %v", e.cfg.Key, err)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/square/quotaservice/test/helpers"
+)
+
+const testKey = "quotaservice:leader:test"
+
+func newTestClient(t *testing.T) redis.UniversalClient {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	if err := client.Del(context.Background(), testKey).Err(); err != nil {
+		t.Fatalf("Unable to connect to Redis: %v", err)
+	}
+
+	return client
+}
+
+func waitForLeader(t *testing.T, e Elector, leader bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); e.IsLeader() != leader; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected IsLeader to be %v", leader)
+		}
+	}
+}
+
+func TestOneLeader(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+
+	first := NewRedisElector(client, RedisConfig{Key: testKey, ID: "first", TTL: 300 * time.Millisecond})
+	waitForLeader(t, first, true)
+
+	second := NewRedisElector(client, RedisConfig{Key: testKey, ID: "second", TTL: 300 * time.Millisecond})
+	defer second.Close()
+
+	// The leader renews its lock, so holds on to leadership.
+	time.Sleep(500 * time.Millisecond)
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatal("Expected the first instance to remain the only leader")
+	}
+
+	// Closing gives up leadership, so the second instance takes over on its next campaign.
+	first.Close()
+	if first.IsLeader() {
+		t.Fatal("Expected a closed elector not to be the leader")
+	}
+
+	waitForLeader(t, second, true)
+}
+
+func TestLostLock(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+
+	e := NewRedisElector(client, RedisConfig{Key: testKey, ID: "first", TTL: 300 * time.Millisecond})
+	defer e.Close()
+	waitForLeader(t, e, true)
+
+	// Another instance takes the lock, say after this one was partitioned from Redis.
+	if err := client.Set(context.Background(), testKey, "second", time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForLeader(t, e, false)
+
+	// Closing doesn't release another instance's lock.
+	e.Close()
+	if holder, err := client.Get(context.Background(), testKey).Result(); err != nil || holder != "second" {
+		t.Fatalf("Expected the lock to remain held by the second instance, got %v, %v", holder, err)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, cfg := range []RedisConfig{
+		{ID: "id", TTL: time.Second},
+		{Key: testKey, TTL: time.Second},
+		{Key: testKey, ID: "id"}} {
+		cfg := cfg
+		helpers.ExpectingPanic(t, func() {
+			NewRedisElector(redis.NewClient(&redis.Options{}), cfg)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package metrics reports on the health of the quota service itself, as opposed to the quota
+// traffic it serves.
+package metrics
+
+import (
+	"runtime"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Health is a point-in-time report on the health of a quota service.
+type Health struct {
+	Runtime *Runtime `json:"runtime"`
+	// EventQueueDepth is the number of events waiting to be delivered to listeners. Events are
+	// dropped once EventQueueCapacity is reached.
+	EventQueueDepth    int `json:"eventQueueDepth"`
+	EventQueueCapacity int `json:"eventQueueCapacity"`
+	// ListenerLagMillis is how long the most recently delivered event waited to be delivered.
+	ListenerLagMillis int64 `json:"listenerLagMillis"`
+	// Waiters is the number of requests currently taking tokens, including any waiting for tokens to
+	// become available.
+	Waiters int64 `json:"waiters"`
+	// ConfigReloads is the number of configs applied since the server started.
+	ConfigReloads int64 `json:"configReloads"`
+	// BucketPool reports on the bucket factory's connection pool, if it has one.
+	BucketPool *PoolStats `json:"bucketPool,omitempty"`
+	// BucketBackendVersion is the version of the bucket factory's backend, e.g. Redis, if known.
+	BucketBackendVersion string `json:"bucketBackendVersion,omitempty"`
+	// Config reports on the config applied, once one has been.
+	Config *ConfigStatus `json:"config,omitempty"`
+}
+
+// ConfigStatus reports on the config applied by a quota service, so that operators can verify that
+// every instance has converged on the same version after a change.
+type ConfigStatus struct {
+	Version int32  `json:"version"`
+	Hash    string `json:"hash"`
+	// Recent lists the most recently applied configs, most recent first.
+	Recent []*ConfigApply `json:"recent"`
+}
+
+// ConfigApply reports how long a config took to be applied.
+type ConfigApply struct {
+	Version int32  `json:"version"`
+	Hash    string `json:"hash"`
+	// SavedAt is when the config was saved, in seconds since the epoch.
+	SavedAt int64 `json:"savedAt"`
+	// AppliedAtMillis is when the config was applied, in millis since the epoch.
+	AppliedAtMillis int64 `json:"appliedAtMillis"`
+	// PropagationMillis is how long after being saved the config was applied. Since configs are
+	// stamped to the second, this is only accurate to within a second.
+	PropagationMillis int64 `json:"propagationMillis"`
+	// ApplyMillis is how long after the quota service was notified of the config it was applied,
+	// including reading it, any reload jitter, and rebuilding buckets.
+	ApplyMillis int64 `json:"applyMillis"`
+}
+
+// Runtime reports on the Go runtime.
+type Runtime struct {
+	Goroutines        int    `json:"goroutines"`
+	HeapAllocBytes    uint64 `json:"heapAllocBytes"`
+	HeapObjects       uint64 `json:"heapObjects"`
+	NumGC             uint32 `json:"numGC"`
+	GCPauseTotalNanos uint64 `json:"gcPauseTotalNanos"`
+	LastGCPauseNanos  uint64 `json:"lastGCPauseNanos"`
+}
+
+// PoolStats reports on a connection pool.
+type PoolStats struct {
+	Hits       uint32 `json:"hits"`
+	Misses     uint32 `json:"misses"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"totalConns"`
+	IdleConns  uint32 `json:"idleConns"`
+	StaleConns uint32 `json:"staleConns"`
+}
+
+// ReadRuntime reads the current state of the Go runtime. Note that this briefly stops the world.
+func ReadRuntime() *Runtime {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	r := &Runtime{
+		Goroutines:        runtime.NumGoroutine(),
+		HeapAllocBytes:    m.HeapAlloc,
+		HeapObjects:       m.HeapObjects,
+		NumGC:             m.NumGC,
+		GCPauseTotalNanos: m.PauseTotalNs}
+
+	if m.NumGC > 0 {
+		r.LastGCPauseNanos = m.PauseNs[(m.NumGC+255)%256]
+	}
+
+	return r
+}
+
+// ReadPoolStats reads the connection pool stats of a bucket factory's client, as returned by
+// BucketFactory.Client(). Returns nil if the client doesn't have a connection pool.
+func ReadPoolStats(client interface{}) *PoolStats {
+	c, ok := client.(interface{ PoolStats() *redis.PoolStats })
+	if !ok {
+		return nil
+	}
+
+	s := c.PoolStats()
+	if s == nil {
+		return nil
+	}
+
+	return &PoolStats{
+		Hits:       s.Hits,
+		Misses:     s.Misses,
+		Timeouts:   s.Timeouts,
+		TotalConns: s.TotalConns,
+		IdleConns:  s.IdleConns,
+		StaleConns: s.StaleConns}
+}
+
+// ReadBackendVersion reads the version of a bucket factory's backend, if the factory reports it.
+// Returns an empty string otherwise.
+func ReadBackendVersion(bucketFactory interface{}) string {
+	bf, ok := bucketFactory.(interface{ BackendVersion() string })
+	if !ok {
+		return ""
+	}
+
+	return bf.BackendVersion()
+}
@@ -0,0 +1,43 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestReadRuntime(t *testing.T) {
+	if r := ReadRuntime(); r.Goroutines == 0 || r.HeapAllocBytes == 0 {
+		t.Fatalf("Expected runtime metrics, got %+v", r)
+	}
+}
+
+func TestReadPoolStats(t *testing.T) {
+	if s := ReadPoolStats(nil); s != nil {
+		t.Fatalf("Expected no pool stats for a nil client, got %+v", s)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	defer func() { _ = client.Close() }()
+
+	if s := ReadPoolStats(client); s == nil || s.TotalConns != 0 {
+		t.Fatalf("Expected empty pool stats, got %+v", s)
+	}
+}
+
+type versionedFactory struct{}
+
+func (versionedFactory) BackendVersion() string { return "7.2.4" }
+
+func TestReadBackendVersion(t *testing.T) {
+	if v := ReadBackendVersion(nil); v != "" {
+		t.Fatalf("Expected no version, got %v", v)
+	}
+
+	if v := ReadBackendVersion(versionedFactory{}); v != "7.2.4" {
+		t.Fatalf("Expected 7.2.4, got %v", v)
+	}
+}
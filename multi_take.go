@@ -0,0 +1,231 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+)
+
+// multiTakeTarget is a bucket that AllowAll takes tokens from.
+type multiTakeTarget struct {
+	namespace, name string
+	bucket          Bucket
+	tokens          int64
+}
+
+// AllowAll implements MultiBucketQuotaService. Buckets on their namespace's allow-list are granted
+// without taking tokens, and a bucket on a deny-list rejects the whole request. The request counts
+// once towards in-flight limits, in the first bucket's namespace. Sampling isn't applied.
+func (s *server) AllowAll(ctx context.Context, requests []BucketTokens, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (time.Duration, error) {
+	targets := make([]*multiTakeTarget, 0, len(requests))
+	maxWaitTime := time.Duration(-1)
+
+	for _, r := range requests {
+		namespace, name, tokens, e := resolve(s.resolver, ctx, r.Namespace, r.Name, r.Tokens)
+		if e != nil {
+			return 0, e
+		}
+
+		s.RLock()
+		denied, allowed := s.accessListsLocked(namespace, name)
+		s.RUnlock()
+
+		if denied {
+			return 0, newError("Bucket "+config.FullyQualifiedName(namespace, name)+" is denied", ER_DENIED)
+		}
+
+		if allowed {
+			continue
+		}
+
+		s.RLock()
+		b, e := s.bucketContainer.FindBucket(namespace, name)
+		s.RUnlock()
+
+		if e != nil {
+			s.Emit(events.NewBucketMissedEvent(namespace, name, true))
+			return 0, newError("Cannot create dynamic bucket "+config.FullyQualifiedName(namespace, name), ER_TOO_MANY_BUCKETS)
+		}
+
+		if b == nil {
+			s.Emit(events.NewBucketMissedEvent(namespace, name, false))
+			return 0, newError("No such bucket "+config.FullyQualifiedName(namespace, name), ER_NO_BUCKET)
+		}
+
+		if b.Config().GetMaxTokensPerRequest() < tokens && b.Config().GetMaxTokensPerRequest() > 0 {
+			s.Emit(events.WithCaller(events.NewTooManyTokensRequestedEvent(namespace, name, b.Dynamic(), tokens), CallerFromContext(ctx)))
+			return 0, newError(fmt.Sprintf("Too many tokens requested. Bucket %v:%v, tokensRequested=%v, maxTokensPerRequest=%v",
+				namespace, name, tokens, b.Config().GetMaxTokensPerRequest()),
+				ER_TOO_MANY_TOKENS_REQUESTED)
+		}
+
+		// The request can wait no longer than the least patient bucket allows.
+		bucketMaxWait := bucketMaxWaitTime(b.Config(), maxWaitMillisOverride, maxWaitTimeOverride)
+		if maxWaitTime < 0 || bucketMaxWait < maxWaitTime {
+			maxWaitTime = bucketMaxWait
+		}
+
+		targets = append(targets, &multiTakeTarget{namespace, name, b, tokens})
+	}
+
+	if len(targets) == 0 {
+		// Nothing to take, e.g. every bucket is allow-listed.
+		return 0, nil
+	}
+
+	s.RLock()
+	globalLimit, namespaceLimit := s.inFlightLimitsLocked(targets[0].namespace)
+	s.RUnlock()
+
+	release, e := s.admission.admit(targets[0].namespace, globalLimit, namespaceLimit)
+	if e != nil {
+		return 0, e
+	}
+	defer release()
+
+	maxWaitTime, beforeDeadline := MaxWaitWithinDeadline(ctx, maxWaitTime)
+	if !beforeDeadline {
+		// The caller has given up, so don't take tokens it can't use.
+		for _, t := range targets {
+			s.Emit(events.WithCaller(events.NewTimedOutEvent(t.namespace, t.name, t.bucket.Dynamic(), t.tokens), CallerFromContext(ctx)))
+		}
+
+		return 0, newError(fmt.Sprintf("Deadline exceeded before taking tokens from %v buckets", len(targets)), ER_TIMEOUT)
+	}
+
+	takes, e := backingTakes(targets)
+	if e != nil {
+		return 0, e
+	}
+
+	atomic.AddInt64(&s.waiters, 1)
+	var w time.Duration
+	var success bool
+	var err error
+	if taker, ok := s.bucketFactory.(MultiBucketTaker); ok {
+		w, success, err = taker.TakeAll(ctx, takes, maxWaitTime)
+	} else {
+		w, success, err = takeAllSequentially(ctx, takes, maxWaitTime)
+	}
+	atomic.AddInt64(&s.waiters, -1)
+
+	for _, t := range targets {
+		switch {
+		case err != nil:
+			s.Emit(events.NewBucketErrorEvent(t.namespace, t.name, t.bucket.Dynamic()))
+		case !success:
+			s.Emit(events.WithCaller(events.NewTimedOutEvent(t.namespace, t.name, t.bucket.Dynamic(), t.tokens), CallerFromContext(ctx)))
+		default:
+			s.Emit(events.NewTokensServedEvent(t.namespace, t.name, t.bucket.Dynamic(), t.tokens, w))
+		}
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to take tokens")
+	}
+
+	if !success {
+		return 0, newError(fmt.Sprintf("Timed out waiting on %v buckets", len(targets)), ER_TIMEOUT)
+	}
+
+	return w, nil
+}
+
+// backingTakes returns the tokens to take from the buckets created by the bucket factory that back
+// each target, unwrapping buckets that are reaped, sampled, negatively cached, borrowing, fair
+// share, or draw from a quota group. Tokens for targets backed by the same bucket are combined, and
+// aren't borrowed.
+func backingTakes(targets []*multiTakeTarget) ([]BucketTake, error) {
+	takes := make([]BucketTake, 0, len(targets))
+
+targets:
+	for _, t := range targets {
+		b, tokens, err := unwrapBucket(t.bucket, t.tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range takes {
+			if takes[i].Bucket == b {
+				takes[i].Tokens += tokens
+				continue targets
+			}
+		}
+
+		takes = append(takes, BucketTake{Bucket: b, Tokens: tokens})
+	}
+
+	return takes, nil
+}
+
+// backingBucket returns the bucket created by the bucket factory that backs b.
+func backingBucket(b Bucket) (Bucket, error) {
+	b, _, err := unwrapBucket(b, 0)
+	return b, err
+}
+
+// unwrapBucket returns the bucket created by the bucket factory that backs b, and the tokens to take
+// from it for numTokens taken from b.
+func unwrapBucket(b Bucket, numTokens int64) (Bucket, int64, error) {
+	for {
+		switch w := b.(type) {
+		case *reapableBucket:
+			b = w.Bucket
+		case *sampledBucket:
+			b = w.Bucket
+		case *negativeCachedBucket:
+			b = w.Bucket
+		case *borrowingBucket:
+			b = w.Bucket
+		case *softLimitedBucket:
+			b = w.Bucket
+		case *fairShareBucket:
+			numTokens = w.scale(numTokens)
+			b = w.Bucket
+		case *quotaGroupMember:
+			pool, err := w.pool()
+			if err != nil {
+				return nil, 0, err
+			}
+
+			b = pool
+		default:
+			return b, numTokens, nil
+		}
+	}
+}
+
+// takeAllSequentially takes tokens from each bucket in turn, returning those already taken if a
+// bucket can't grant its tokens, for bucket factories that don't implement MultiBucketTaker. Unlike
+// TakeAll, concurrent requests may see tokens that are taken and then returned.
+func takeAllSequentially(ctx context.Context, takes []BucketTake, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	var longest time.Duration
+	for i, t := range takes {
+		w, success, err := t.Bucket.Take(ctx, t.Tokens, maxWaitTime)
+		if err != nil || !success {
+			for _, taken := range takes[:i] {
+				if e := taken.Bucket.Charge(ctx, -taken.Tokens); e != nil {
+					logging.Printf("Unable to return %v tokens to bucket %v: %v", taken.Tokens,
+						config.FullyQualifiedName(taken.Bucket.Config().Namespace, taken.Bucket.Config().Name), e)
+				}
+			}
+
+			return 0, false, err
+		}
+
+		if w > longest {
+			longest = w
+		}
+	}
+
+	return longest, true, nil
+}
@@ -0,0 +1,67 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+)
+
+func TestAllowAll(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	nsc.DeniedBuckets = []string{"abuser"}
+	nsc.AllowedBuckets = []string{"critical"}
+	for _, name := range []string{"cpu", "memory", "abuser"} {
+		helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig(name)))
+	}
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := &qstesting.MockBucketFactory{}
+	endpoint := &qstesting.MockEndpoint{}
+	s := quotaservice.New(bf, config.NewMemoryConfig(cfg), qstesting.NewReaperConfig(), 0, endpoint)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer func() {
+		_, err := s.Stop()
+		helpers.CheckError(t, err)
+	}()
+
+	qs := endpoint.QuotaService.(quotaservice.MultiBucketQuotaService)
+
+	bf.SetWaitTime("dummy", "memory", 5*time.Millisecond)
+	w, err := qs.AllowAll(context.Background(), []quotaservice.BucketTokens{
+		{"dummy", "cpu", 2}, {"dummy", "memory", 3}, {"dummy", "critical", 100}}, 0, false)
+	helpers.CheckError(t, err)
+	if w != 5*time.Millisecond {
+		t.Fatalf("Expected the longest wait time of 5ms, was %v", w)
+	}
+
+	// memory times out, so the tokens taken from cpu are returned.
+	bf.SetWaitTime("dummy", "memory", time.Minute)
+	_, err = qs.AllowAll(context.Background(), []quotaservice.BucketTokens{{"dummy", "cpu", 2}, {"dummy", "memory", 3}}, 0, false)
+	if qsErr, ok := err.(quotaservice.QuotaServiceError); !ok || qsErr.Reason != quotaservice.ER_TIMEOUT {
+		t.Fatalf("Expected ER_TIMEOUT, got %v", err)
+	}
+
+	if charged := bf.Charged("dummy", "cpu"); charged != -2 {
+		t.Fatalf("Expected 2 tokens to be returned to cpu, was %v", charged)
+	}
+
+	_, err = qs.AllowAll(context.Background(), []quotaservice.BucketTokens{{"dummy", "cpu", 1}, {"dummy", "abuser", 1}}, 0, false)
+	if qsErr, ok := err.(quotaservice.QuotaServiceError); !ok || qsErr.Reason != quotaservice.ER_DENIED {
+		t.Fatalf("Expected ER_DENIED, got %v", err)
+	}
+
+	_, err = qs.AllowAll(context.Background(), []quotaservice.BucketTokens{{"dummy", "cpu", 1}, {"dummy", "nonexistent", 1}}, 0, false)
+	if qsErr, ok := err.(quotaservice.QuotaServiceError); !ok || qsErr.Reason != quotaservice.ER_NO_BUCKET {
+		t.Fatalf("Expected ER_NO_BUCKET, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxNegativeCacheBackoff is the most the negative cache duration is multiplied by while a bucket
+// keeps denying requests.
+const maxNegativeCacheBackoff = 8
+
+// negativeCachedBucket remembers that a bucket denied a request, and denies similar requests
+// locally until the denial expires, so that a throttling storm doesn't hit the backend with
+// requests that are bound to be denied. Requests for fewer tokens, or willing to wait longer, than
+// the denied request still consult the bucket.
+type negativeCachedBucket struct {
+	Bucket
+	base time.Duration
+	now  func() time.Time
+
+	sync.Mutex
+	// duration is how long the last denial is cached for; 0 if the bucket last granted tokens.
+	duration      time.Duration
+	deniedUntil   time.Time
+	deniedTokens  int64
+	deniedMaxWait time.Duration
+}
+
+func newNegativeCachedBucket(b Bucket, base time.Duration) *negativeCachedBucket {
+	return &negativeCachedBucket{Bucket: b, base: base, now: time.Now}
+}
+
+func (b *negativeCachedBucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	now := b.now()
+
+	b.Lock()
+	cached := now.Before(b.deniedUntil) && numTokens >= b.deniedTokens && maxWaitTime <= b.deniedMaxWait
+	b.Unlock()
+
+	if cached {
+		return 0, false, nil
+	}
+
+	wait, ok, err := b.Bucket.Take(ctx, numTokens, maxWaitTime)
+	if err != nil {
+		return wait, ok, err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if ok {
+		b.duration = 0
+		b.deniedUntil = time.Time{}
+		return wait, ok, err
+	}
+
+	if now.Before(b.deniedUntil) {
+		// Denied while an earlier denial is cached, so cache this one too, without backing off.
+		if numTokens < b.deniedTokens {
+			b.deniedTokens = numTokens
+		}
+		if maxWaitTime > b.deniedMaxWait {
+			b.deniedMaxWait = maxWaitTime
+		}
+		return wait, ok, err
+	}
+
+	// Back off if the bucket is still denying requests soon after the last denial expired.
+	if b.duration > 0 && now.Sub(b.deniedUntil) < b.duration {
+		b.duration *= 2
+		if b.duration > maxNegativeCacheBackoff*b.base {
+			b.duration = maxNegativeCacheBackoff * b.base
+		}
+	} else {
+		b.duration = b.base
+	}
+
+	b.deniedUntil = now.Add(b.duration)
+	b.deniedTokens = numTokens
+	b.deniedMaxWait = maxWaitTime
+
+	return wait, ok, err
+}
+
+// Charge forgets a cached denial when tokens are returned to the bucket.
+func (b *negativeCachedBucket) Charge(ctx context.Context, numTokens int64) error {
+	if numTokens < 0 {
+		b.Lock()
+		b.deniedUntil = time.Time{}
+		b.Unlock()
+	}
+
+	return b.Bucket.Charge(ctx, numTokens)
+}
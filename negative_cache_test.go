@@ -0,0 +1,122 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestNegativeCache(t *testing.T) {
+	delegate := &countingBucket{}
+	b := newNegativeCachedBucket(delegate, 100*time.Millisecond)
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+
+	take := func(numTokens int64, maxWaitTime time.Duration) bool {
+		_, ok, err := b.Take(context.Background(), numTokens, maxWaitTime)
+		helpers.CheckError(t, err)
+		return ok
+	}
+
+	take(2, 0)
+	// Cached.
+	take(2, 0)
+	take(3, 0)
+	// Fewer tokens, or a longer wait, consult the bucket.
+	take(1, 0)
+	take(2, time.Second)
+
+	if expected := []int64{2, 1, 2}; !reflect.DeepEqual(delegate.requested, expected) {
+		t.Fatalf("Expected requests %v to reach the bucket, got %v", expected, delegate.requested)
+	}
+
+	// Still denying once the denial expires, so the next one is cached for longer.
+	now = now.Add(100 * time.Millisecond)
+	take(2, 0)
+	now = now.Add(150 * time.Millisecond)
+	take(2, 0)
+	if len(delegate.requested) != 4 {
+		t.Fatalf("Expected the cached denial to back off, got %v", delegate.requested)
+	}
+
+	now = now.Add(50 * time.Millisecond)
+	delegate.allow = true
+	if !take(2, 0) {
+		t.Fatal("Expected tokens to be granted once the denial expired")
+	}
+
+	if b.duration != 0 || !take(2, 0) || len(delegate.requested) != 6 {
+		t.Fatalf("Expected a grant to reset the cache, got %v", delegate.requested)
+	}
+}
+
+func TestNegativeCacheBackoffLimit(t *testing.T) {
+	b := newNegativeCachedBucket(&countingBucket{}, time.Millisecond)
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		_, _, err := b.Take(context.Background(), 1, 0)
+		helpers.CheckError(t, err)
+		now = b.deniedUntil
+	}
+
+	if b.duration != maxNegativeCacheBackoff*time.Millisecond {
+		t.Fatalf("Expected the cache duration to be limited, was %v", b.duration)
+	}
+}
+
+// chargeableBucket is a countingBucket that supports Charge.
+type chargeableBucket struct {
+	countingBucket
+}
+
+func (b *chargeableBucket) Charge(_ context.Context, _ int64) error { return nil }
+
+func TestNegativeCacheForgetsRefunds(t *testing.T) {
+	delegate := &chargeableBucket{}
+	b := newNegativeCachedBucket(delegate, time.Hour)
+
+	_, _, err := b.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, b.Charge(context.Background(), -1))
+	_, _, err = b.Take(context.Background(), 1, 0)
+	helpers.CheckError(t, err)
+
+	if len(delegate.requested) != 2 {
+		t.Fatalf("Expected a refund to clear the cached denial, got %v", delegate.requested)
+	}
+}
+
+func TestNegativeCacheOnlyForDynamicBuckets(t *testing.T) {
+	c := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig("ns")
+	ns.NegativeCacheMillis = 100
+	ns.DynamicBucketTemplate = config.NewDefaultBucketConfig(config.DynamicBucketTemplateName)
+	helpers.PanicError(config.AddBucket(ns, config.NewDefaultBucketConfig("static")))
+	helpers.PanicError(config.AddNamespace(c, ns))
+
+	bc, _ := NewBucketContainerWithMocks(c)
+
+	if b, _ := bc.FindBucket("ns", "static"); reflect.TypeOf(b) == reflect.TypeOf(&negativeCachedBucket{}) {
+		t.Fatal("Expected static buckets not to be negatively cached")
+	}
+
+	if b, _ := bc.FindBucket("ns", "dyn"); reflect.TypeOf(b) != reflect.TypeOf(&negativeCachedBucket{}) {
+		t.Fatalf("Expected dynamic buckets to be negatively cached, got %T", b)
+	}
+}
+
+func TestNegativeCachedBackingBucket(t *testing.T) {
+	delegate := &countingBucket{}
+	if b, err := backingBucket(newNegativeCachedBucket(delegate, time.Second)); err != nil || b != delegate {
+		t.Fatalf("Expected multi-bucket takes to use the underlying bucket, got %v, %v", b, err)
+	}
+}
@@ -0,0 +1,85 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// maxIdleThresholdBuckets is how many buckets the threshold tracker tracks before forgetting those
+// whose notification windows have ended.
+const maxIdleThresholdBuckets = 1024
+
+// windowConsumption is the tokens consumed from a bucket within its current notification window.
+type windowConsumption struct {
+	windowEnd time.Time
+	consumed  int64
+}
+
+// thresholdTracker counts the tokens each bucket with notification thresholds grants within its
+// notification windows, to find the requests that cross a threshold. Consumption is counted by
+// each server, so in a fleet, thresholds apply to the share of a bucket's requests each server
+// serves.
+type thresholdTracker struct {
+	sync.Mutex
+	windows map[string]*windowConsumption
+	now     func() time.Time
+}
+
+func newThresholdTracker() *thresholdTracker {
+	return &thresholdTracker{windows: make(map[string]*windowConsumption), now: time.Now}
+}
+
+// record counts tokens granted from a bucket, returning the tokens consumed within its current
+// notification window and the thresholds, as percentages of its size, that they crossed.
+func (t *thresholdTracker) record(namespace, bucketName string, cfg *pbconfig.BucketConfig, numTokens int64) (int64, []int64) {
+	window := time.Duration(cfg.GetNotificationWindowMillis()) * time.Millisecond
+	if len(cfg.NotificationThresholds) == 0 || window <= 0 || numTokens <= 0 {
+		return 0, nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.now()
+	fqn := config.FullyQualifiedName(namespace, bucketName)
+	w := t.windows[fqn]
+	if w == nil || !now.Before(w.windowEnd) {
+		if len(t.windows) >= maxIdleThresholdBuckets {
+			t.forgetEnded(now)
+		}
+
+		// Windows are aligned to the Unix epoch, so that they agree across servers.
+		start := now.UnixNano() - now.UnixNano()%int64(window)
+		w = &windowConsumption{windowEnd: time.Unix(0, start).Add(window)}
+		t.windows[fqn] = w
+	}
+
+	before := w.consumed
+	w.consumed += numTokens
+
+	var crossed []int64
+	for _, threshold := range cfg.NotificationThresholds {
+		limit := percentOf(cfg.GetSize(), threshold)
+		if before < limit && w.consumed >= limit {
+			crossed = append(crossed, threshold)
+		}
+	}
+
+	return w.consumed, crossed
+}
+
+// forgetEnded forgets buckets whose notification windows have ended, which are treated the same as
+// buckets that haven't consumed tokens in their current window.
+func (t *thresholdTracker) forgetEnded(now time.Time) {
+	for fqn, w := range t.windows {
+		if !now.Before(w.windowEnd) {
+			delete(t.windows, fqn)
+		}
+	}
+}
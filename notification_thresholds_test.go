@@ -0,0 +1,51 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/config"
+)
+
+func TestThresholdTracker(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("b")
+	cfg.Size = proto.Int64(100)
+	cfg.NotificationThresholds = []int64{50, 80, 100}
+	cfg.NotificationWindowMillis = proto.Int64(int64(24 * time.Hour / time.Millisecond))
+
+	tracker := newThresholdTracker()
+	now := time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	for _, step := range []struct {
+		tokens   int64
+		consumed int64
+		crossed  []int64
+	}{
+		{40, 40, nil},
+		{45, 85, []int64{50, 80}},
+		{10, 95, nil},
+		{5, 100, []int64{100}},
+		{5, 105, nil},
+	} {
+		consumed, crossed := tracker.record("ns", "b", cfg, step.tokens)
+		if consumed != step.consumed || !reflect.DeepEqual(crossed, step.crossed) {
+			t.Fatalf("Expected %v tokens consumed crossing %v, got %v crossing %v", step.consumed, step.crossed, consumed, crossed)
+		}
+	}
+
+	// Daily windows start at midnight UTC.
+	now = now.Add(time.Hour)
+	if consumed, crossed := tracker.record("ns", "b", cfg, 50); consumed != 50 || !reflect.DeepEqual(crossed, []int64{50}) {
+		t.Fatalf("Expected consumption to start afresh in a new window, got %v crossing %v", consumed, crossed)
+	}
+
+	if _, crossed := tracker.record("ns", "other", config.NewDefaultBucketConfig("other"), 1000); crossed != nil {
+		t.Fatalf("Expected no thresholds for a bucket without any, got %v", crossed)
+	}
+}
@@ -0,0 +1,116 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+	"github.com/square/quotaservice/stats"
+)
+
+// Option configures a server when it is created by NewServer, returning an error if the server
+// would be misconfigured.
+type Option func(s *server) error
+
+// WithEndpoints adds RPC endpoints serving the quota service. At least one is required.
+func WithEndpoints(endpoints ...RpcEndpoint) Option {
+	return func(s *server) error {
+		for _, e := range endpoints {
+			if e == nil {
+				return errors.New("RPC endpoints must not be nil")
+			}
+		}
+
+		s.rpcEndpoints = append(s.rpcEndpoints, endpoints...)
+		return nil
+	}
+}
+
+// WithListener sets the listener events are delivered to, through a queue holding up to
+// eventQueueBufSize events. Events are dropped while the queue is full.
+func WithListener(listener events.Listener, eventQueueBufSize int) Option {
+	return func(s *server) error {
+		if listener == nil {
+			return errors.New("listener must not be nil")
+		}
+
+		if eventQueueBufSize < 1 {
+			return errors.New("event queue buffer size must be greater than 0")
+		}
+
+		s.listener = listener
+		s.eventQueueBufSize = eventQueueBufSize
+		return nil
+	}
+}
+
+// WithStatsListener sets the listener collecting the stats reported by the admin API.
+func WithStatsListener(listener stats.Listener) Option {
+	return func(s *server) error {
+		if listener == nil {
+			return errors.New("stats listener must not be nil")
+		}
+
+		s.statsListener = listener
+		return nil
+	}
+}
+
+// WithClock sets the clock config changes, pending approvals, namespace deletions and config bundles
+// are dated by, and dashboard rates and admin rate limits are counted by, e.g. to control time in
+// tests. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *server) error {
+		if now == nil {
+			return errors.New("clock must not be nil")
+		}
+
+		s.now = now
+		s.dashboardRates.now = now
+		return nil
+	}
+}
+
+// WithLogger sets the logger. As with Server.SetLogger, the logger is shared by every server in the
+// process.
+func WithLogger(logger logging.Logger) Option {
+	return func(s *server) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+
+		logging.SetLogger(logger)
+		return nil
+	}
+}
+
+// WithReaperConfig sets how idle dynamic buckets are reaped. Defaults to config.NewReaperConfig().
+func WithReaperConfig(cfg config.ReaperConfig) Option {
+	return func(s *server) error {
+		if cfg.MinFrequency <= 0 || cfg.InitSleep < 0 || cfg.BucketWatcherBuffer < 0 {
+			return errors.Errorf("invalid reaper config %+v: MinFrequency must be positive, and "+
+				"InitSleep and BucketWatcherBuffer must not be negative", cfg)
+		}
+
+		s.reaperConfig = cfg
+		return nil
+	}
+}
+
+// WithMaxConfigReloadJitter spreads reloads of configs changed by other servers over up to max, so
+// that a fleet sharing a persister doesn't reload at once. Disabled by default.
+func WithMaxConfigReloadJitter(max time.Duration) Option {
+	return func(s *server) error {
+		if max < 0 {
+			return errors.New("max config reload jitter must not be negative")
+		}
+
+		s.maxJitterMillis = int(max / time.Millisecond)
+		return nil
+	}
+}
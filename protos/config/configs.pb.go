@@ -6,9 +6,11 @@
 Package quotaservice_configs is a generated protocol buffer package.
 
 It is generated from these files:
+
 	protos/config/configs.proto
 
 It has these top-level messages:
+
 	ServiceConfig
 	NamespaceConfig
 	BucketConfig
@@ -30,6 +32,48 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type TokenUnit int32
+
+const (
+	TokenUnit_REQUESTS TokenUnit = 0
+	TokenUnit_BYTES    TokenUnit = 1
+)
+
+var TokenUnit_name = map[int32]string{
+	0: "REQUESTS",
+	1: "BYTES",
+}
+var TokenUnit_value = map[string]int32{
+	"REQUESTS": 0,
+	"BYTES":    1,
+}
+
+func (x TokenUnit) String() string {
+	return proto.EnumName(TokenUnit_name, int32(x))
+}
+func (TokenUnit) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type DegradationPolicy int32
+
+const (
+	DegradationPolicy_FAIL_OPEN   DegradationPolicy = 0
+	DegradationPolicy_FAIL_CLOSED DegradationPolicy = 1
+)
+
+var DegradationPolicy_name = map[int32]string{
+	0: "FAIL_OPEN",
+	1: "FAIL_CLOSED",
+}
+var DegradationPolicy_value = map[string]int32{
+	"FAIL_OPEN":   0,
+	"FAIL_CLOSED": 1,
+}
+
+func (x DegradationPolicy) String() string {
+	return proto.EnumName(DegradationPolicy_name, int32(x))
+}
+func (DegradationPolicy) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
 // Representations of configuration elements, for persisting and sharing across nodes.
 type ServiceConfig struct {
 	GlobalDefaultBucket *BucketConfig               `protobuf:"bytes,1,opt,name=global_default_bucket,json=globalDefaultBucket" json:"global_default_bucket,omitempty" yaml:"global_default_bucket"`
@@ -38,6 +82,25 @@ type ServiceConfig struct {
 	Version int32  `protobuf:"varint,3,opt,name=version" json:"version,omitempty" yaml:"version"`
 	User    string `protobuf:"bytes,4,opt,name=user" json:"user,omitempty" yaml:"user"`
 	Date    int64  `protobuf:"varint,5,opt,name=date" json:"date,omitempty" yaml:"date"`
+	// Max number of concurrent Allow requests across all namespaces. 0 means unlimited.
+	MaxInFlightRequests int64 `protobuf:"varint,6,opt,name=max_in_flight_requests,json=maxInFlightRequests" json:"max_in_flight_requests,omitempty" yaml:"max_in_flight_requests"`
+	// Shared token pools, keyed on name, that buckets in any namespace can draw from by setting
+	// quota_group.
+	QuotaGroups map[string]*BucketConfig `protobuf:"bytes,7,rep,name=quota_groups,json=quotaGroups" json:"quota_groups,omitempty" yaml:"quota_groups" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Partial bucket configs, keyed on name, that buckets can inherit settings from by setting
+	// template.
+	BucketTemplates map[string]*BucketConfig `protobuf:"bytes,8,rep,name=bucket_templates,json=bucketTemplates" json:"bucket_templates,omitempty" yaml:"bucket_templates" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Namespace configs, keyed on name, that new namespaces can be provisioned from.
+	NamespaceTemplates map[string]*NamespaceConfig `protobuf:"bytes,9,rep,name=namespace_templates,json=namespaceTemplates" json:"namespace_templates,omitempty" yaml:"namespace_templates" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Soft-deleted namespaces, keyed on name. These are excluded from routing, and can be restored
+	// until they are purged.
+	DeletedNamespaces map[string]*NamespaceConfig `protobuf:"bytes,10,rep,name=deleted_namespaces,json=deletedNamespaces" json:"deleted_namespaces,omitempty" yaml:"deleted_namespaces" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// How long soft-deleted namespaces are retained before being purged. 0 means the default of 7
+	// days, and a negative value means they are retained indefinitely.
+	DeletedNamespaceRetentionSeconds int64 `protobuf:"varint,11,opt,name=deleted_namespace_retention_seconds,json=deletedNamespaceRetentionSeconds" json:"deleted_namespace_retention_seconds,omitempty" yaml:"deleted_namespace_retention_seconds"`
+	// Whether statically defined buckets load their state, e.g. from Redis, as soon as a config is
+	// applied, rather than on their first request.
+	EagerStaticBuckets bool `protobuf:"varint,12,opt,name=eager_static_buckets,json=eagerStaticBuckets" json:"eager_static_buckets,omitempty" yaml:"eager_static_buckets"`
 }
 
 func (m *ServiceConfig) Reset()                    { *m = ServiceConfig{} }
@@ -80,12 +143,100 @@ func (m *ServiceConfig) GetDate() int64 {
 	return 0
 }
 
+func (m *ServiceConfig) GetMaxInFlightRequests() int64 {
+	if m != nil {
+		return m.MaxInFlightRequests
+	}
+	return 0
+}
+
+func (m *ServiceConfig) GetQuotaGroups() map[string]*BucketConfig {
+	if m != nil {
+		return m.QuotaGroups
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetBucketTemplates() map[string]*BucketConfig {
+	if m != nil {
+		return m.BucketTemplates
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetNamespaceTemplates() map[string]*NamespaceConfig {
+	if m != nil {
+		return m.NamespaceTemplates
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetDeletedNamespaces() map[string]*NamespaceConfig {
+	if m != nil {
+		return m.DeletedNamespaces
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetDeletedNamespaceRetentionSeconds() int64 {
+	if m != nil {
+		return m.DeletedNamespaceRetentionSeconds
+	}
+	return 0
+}
+
+func (m *ServiceConfig) GetEagerStaticBuckets() bool {
+	if m != nil {
+		return m.EagerStaticBuckets
+	}
+	return false
+}
+
 type NamespaceConfig struct {
 	Name                  string                   `protobuf:"bytes,1,opt,name=name" json:"name,omitempty" yaml:"name"`
 	DefaultBucket         *BucketConfig            `protobuf:"bytes,2,opt,name=default_bucket,json=defaultBucket" json:"default_bucket,omitempty" yaml:"default_bucket"`
 	DynamicBucketTemplate *BucketConfig            `protobuf:"bytes,3,opt,name=dynamic_bucket_template,json=dynamicBucketTemplate" json:"dynamic_bucket_template,omitempty" yaml:"dynamic_bucket_template"`
 	MaxDynamicBuckets     int32                    `protobuf:"varint,4,opt,name=max_dynamic_buckets,json=maxDynamicBuckets" json:"max_dynamic_buckets,omitempty" yaml:"max_dynamic_buckets"`
 	Buckets               map[string]*BucketConfig `protobuf:"bytes,5,rep,name=buckets" json:"buckets,omitempty" yaml:"buckets" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Max number of concurrent Allow requests in this namespace. 0 means unlimited.
+	MaxInFlightRequests int64 `protobuf:"varint,6,opt,name=max_in_flight_requests,json=maxInFlightRequests" json:"max_in_flight_requests,omitempty" yaml:"max_in_flight_requests"`
+	// How requests are handled when they are short-circuited because the backend is degraded.
+	DegradationPolicy DegradationPolicy `protobuf:"varint,7,opt,name=degradation_policy,json=degradationPolicy,enum=quotaservice.configs.DegradationPolicy" json:"degradation_policy,omitempty" yaml:"degradation_policy"`
+	// What tokens represent in this namespace's buckets.
+	TokenUnit TokenUnit `protobuf:"varint,8,opt,name=token_unit,json=tokenUnit,enum=quotaservice.configs.TokenUnit" json:"token_unit,omitempty" yaml:"token_unit"`
+	// Bucket names, or path.Match patterns such as "batch_*", whose requests are always rejected,
+	// regardless of tokens available. Takes precedence over allowed_buckets.
+	DeniedBuckets []string `protobuf:"bytes,9,rep,name=denied_buckets,json=deniedBuckets" json:"denied_buckets,omitempty" yaml:"denied_buckets"`
+	// Bucket names, or path.Match patterns, whose requests are always granted, without taking tokens.
+	AllowedBuckets []string `protobuf:"bytes,10,rep,name=allowed_buckets,json=allowedBuckets" json:"allowed_buckets,omitempty" yaml:"allowed_buckets"`
+	// When the namespace was soft-deleted, in seconds since the epoch. 0 if it isn't deleted.
+	DeletedAt int64 `protobuf:"varint,11,opt,name=deleted_at,json=deletedAt" json:"deleted_at,omitempty" yaml:"deleted_at"`
+	// If true, the namespace's buckets, including its default bucket and dynamic bucket template,
+	// inherit settings they don't set from the namespace's default bucket, then the global default
+	// bucket, rather than from the built-in defaults. Buckets in such namespaces are stored as given,
+	// without defaults applied.
+	InheritDefaults bool `protobuf:"varint,12,opt,name=inherit_defaults,json=inheritDefaults" json:"inherit_defaults,omitempty" yaml:"inherit_defaults"`
+	// Arbitrary key-value pairs, such as a documentation URL, owner contact or tier name, returned to
+	// callers in Allow responses for buckets in this namespace. Buckets can add to or override these.
+	Metadata map[string]string `protobuf:"bytes,13,rep,name=metadata" json:"metadata,omitempty" yaml:"metadata" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Names of event types, such as EVENT_TOKENS_SERVED, that aren't emitted for this namespace, e.g.
+	// to relieve listeners of hits in extremely hot namespaces while keeping misses and timeouts.
+	SuppressedEvents []string `protobuf:"bytes,14,rep,name=suppressed_events,json=suppressedEvents" json:"suppressed_events,omitempty" yaml:"suppressed_events"`
+	// If positive, once a request to a dynamic bucket is denied, requests to it for as many tokens or
+	// more, with as long or a shorter max wait, are denied locally for this many millis, without
+	// consulting the backend. The duration doubles each time the bucket is still denying requests
+	// when it expires, up to 8 times this value.
+	NegativeCacheMillis int64 `protobuf:"varint,15,opt,name=negative_cache_millis,json=negativeCacheMillis" json:"negative_cache_millis,omitempty" yaml:"negative_cache_millis"`
+	// If positive, the namespace's dynamic buckets share this many tokens per second between them,
+	// rather than each filling at the dynamic bucket template's rate. Each bucket's share is
+	// rebalanced as dynamic buckets are created and reaped.
+	FairShareFillRate int64 `protobuf:"varint,16,opt,name=fair_share_fill_rate,json=fairShareFillRate" json:"fair_share_fill_rate,omitempty" yaml:"fair_share_fill_rate"`
+	// Weights of dynamic buckets' shares of fair_share_fill_rate, by bucket name. Buckets not listed
+	// have a weight of 1.
+	FairShareWeights map[string]int64 `protobuf:"bytes,17,rep,name=fair_share_weights,json=fairShareWeights" json:"fair_share_weights,omitempty" yaml:"fair_share_weights" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// Arbitrary key-value pairs, such as team, cost center or tier, attributing usage of the
+	// namespace's buckets in events, stats and usage exports. Buckets can add to or override these.
+	Labels map[string]string `protobuf:"bytes,18,rep,name=labels" json:"labels,omitempty" yaml:"labels" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 }
 
 func (m *NamespaceConfig) Reset()                    { *m = NamespaceConfig{} }
@@ -128,15 +279,146 @@ func (m *NamespaceConfig) GetBuckets() map[string]*BucketConfig {
 	return nil
 }
 
+func (m *NamespaceConfig) GetMaxInFlightRequests() int64 {
+	if m != nil {
+		return m.MaxInFlightRequests
+	}
+	return 0
+}
+
+func (m *NamespaceConfig) GetDegradationPolicy() DegradationPolicy {
+	if m != nil {
+		return m.DegradationPolicy
+	}
+	return DegradationPolicy_FAIL_OPEN
+}
+
+func (m *NamespaceConfig) GetTokenUnit() TokenUnit {
+	if m != nil {
+		return m.TokenUnit
+	}
+	return TokenUnit_REQUESTS
+}
+
+func (m *NamespaceConfig) GetDeniedBuckets() []string {
+	if m != nil {
+		return m.DeniedBuckets
+	}
+	return nil
+}
+
+func (m *NamespaceConfig) GetAllowedBuckets() []string {
+	if m != nil {
+		return m.AllowedBuckets
+	}
+	return nil
+}
+
+func (m *NamespaceConfig) GetDeletedAt() int64 {
+	if m != nil {
+		return m.DeletedAt
+	}
+	return 0
+}
+
+func (m *NamespaceConfig) GetInheritDefaults() bool {
+	if m != nil {
+		return m.InheritDefaults
+	}
+	return false
+}
+
+func (m *NamespaceConfig) GetMetadata() map[string]string {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *NamespaceConfig) GetSuppressedEvents() []string {
+	if m != nil {
+		return m.SuppressedEvents
+	}
+	return nil
+}
+
+func (m *NamespaceConfig) GetNegativeCacheMillis() int64 {
+	if m != nil {
+		return m.NegativeCacheMillis
+	}
+	return 0
+}
+
+func (m *NamespaceConfig) GetFairShareFillRate() int64 {
+	if m != nil {
+		return m.FairShareFillRate
+	}
+	return 0
+}
+
+func (m *NamespaceConfig) GetFairShareWeights() map[string]int64 {
+	if m != nil {
+		return m.FairShareWeights
+	}
+	return nil
+}
+
+func (m *NamespaceConfig) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
 type BucketConfig struct {
-	Name                string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty" yaml:"name"`
-	Namespace           string `protobuf:"bytes,2,opt,name=namespace" json:"namespace,omitempty" yaml:"namespace"`
-	Size                int64  `protobuf:"varint,3,opt,name=size" json:"size,omitempty" yaml:"size"`
-	FillRate            int64  `protobuf:"varint,4,opt,name=fill_rate,json=fillRate" json:"fill_rate,omitempty" yaml:"fill_rate"`
-	WaitTimeoutMillis   int64  `protobuf:"varint,5,opt,name=wait_timeout_millis,json=waitTimeoutMillis" json:"wait_timeout_millis,omitempty" yaml:"wait_timeout_millis"`
-	MaxIdleMillis       int64  `protobuf:"varint,6,opt,name=max_idle_millis,json=maxIdleMillis" json:"max_idle_millis,omitempty" yaml:"max_idle_millis"`
-	MaxDebtMillis       int64  `protobuf:"varint,7,opt,name=max_debt_millis,json=maxDebtMillis" json:"max_debt_millis,omitempty" yaml:"max_debt_millis"`
-	MaxTokensPerRequest int64  `protobuf:"varint,8,opt,name=max_tokens_per_request,json=maxTokensPerRequest" json:"max_tokens_per_request,omitempty" yaml:"max_tokens_per_request"`
+	Name      string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty" yaml:"name"`
+	Namespace string `protobuf:"bytes,2,opt,name=namespace" json:"namespace,omitempty" yaml:"namespace"`
+	// Numeric settings are optional: unset settings are inherited or defaulted, while settings set to
+	// zero, e.g. max_debt_millis to disable debt, are kept as zero.
+	Size                *int64 `protobuf:"varint,3,opt,name=size" json:"size,omitempty" yaml:"size"`
+	FillRate            *int64 `protobuf:"varint,4,opt,name=fill_rate,json=fillRate" json:"fill_rate,omitempty" yaml:"fill_rate"`
+	WaitTimeoutMillis   *int64 `protobuf:"varint,5,opt,name=wait_timeout_millis,json=waitTimeoutMillis" json:"wait_timeout_millis,omitempty" yaml:"wait_timeout_millis"`
+	MaxIdleMillis       *int64 `protobuf:"varint,6,opt,name=max_idle_millis,json=maxIdleMillis" json:"max_idle_millis,omitempty" yaml:"max_idle_millis"`
+	MaxDebtMillis       *int64 `protobuf:"varint,7,opt,name=max_debt_millis,json=maxDebtMillis" json:"max_debt_millis,omitempty" yaml:"max_debt_millis"`
+	MaxTokensPerRequest *int64 `protobuf:"varint,8,opt,name=max_tokens_per_request,json=maxTokensPerRequest" json:"max_tokens_per_request,omitempty" yaml:"max_tokens_per_request"`
+	// If set, the bucket draws tokens from the named quota group's shared pool rather than its own,
+	// so its size, fill rate, max idle and max debt are ignored. Wait timeout and max tokens per
+	// request still apply to the bucket.
+	QuotaGroup string `protobuf:"bytes,9,opt,name=quota_group,json=quotaGroup" json:"quota_group,omitempty" yaml:"quota_group"`
+	// If set, the bucket inherits any settings it doesn't set itself from the named bucket template.
+	// Edits to the template apply to all buckets that reference it.
+	Template string `protobuf:"bytes,10,opt,name=template" json:"template,omitempty" yaml:"template"`
+	// If greater than 1, only 1 in sample_rate requests, chosen at random, consults the bucket, taking
+	// sample_rate times the tokens requested. Other requests reuse the outcome of the last sampled
+	// request. Trades accuracy for fewer backend calls on very hot buckets.
+	SampleRate *int64 `protobuf:"varint,11,opt,name=sample_rate,json=sampleRate" json:"sample_rate,omitempty" yaml:"sample_rate"`
+	// Arbitrary key-value pairs returned to callers in Allow responses for this bucket, merged over
+	// the namespace's metadata. Buckets inherit entries from their template.
+	Metadata map[string]string `protobuf:"bytes,13,rep,name=metadata" json:"metadata,omitempty" yaml:"metadata" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Names of buckets statically defined in the same namespace that this bucket borrows unused
+	// tokens from, in order, when it can't grant a request itself. Tokens are only borrowed if a
+	// sibling can grant them without waiting, so the namespace's total stays bounded.
+	BorrowFrom []string `protobuf:"bytes,14,rep,name=borrow_from,json=borrowFrom" json:"borrow_from,omitempty" yaml:"borrow_from"`
+	// The most borrowed tokens a bucket can have outstanding on each server, which it repays at its
+	// fill rate. 0 means unlimited.
+	MaxBorrowedTokens *int64 `protobuf:"varint,15,opt,name=max_borrowed_tokens,json=maxBorrowedTokens" json:"max_borrowed_tokens,omitempty" yaml:"max_borrowed_tokens"`
+	// Arbitrary key-value pairs attributing usage of this bucket, merged over the namespace's labels.
+	// Buckets inherit entries from their template.
+	Labels map[string]string `protobuf:"bytes,16,rep,name=labels" json:"labels,omitempty" yaml:"labels" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// If set, requests are granted as usual, but are over the bucket's soft limit once they consume
+	// more than this percentage of its size or fill rate. Such requests emit EVENT_OVER_SOFT_LIMIT and
+	// return over-soft-limit in their response metadata, warning callers before they're cut off.
+	SoftLimitPercent *int64 `protobuf:"varint,17,opt,name=soft_limit_percent,json=softLimitPercent" json:"soft_limit_percent,omitempty" yaml:"soft_limit_percent"`
+	// Percentages of the bucket's size that, once consumed within a notification window, emit
+	// EVENT_THRESHOLD_CROSSED, e.g. to tell callers they've used 80% of their daily quota.
+	NotificationThresholds []int64 `protobuf:"varint,18,rep,name=notification_thresholds,json=notificationThresholds" json:"notification_thresholds,omitempty" yaml:"notification_thresholds"`
+	// The length of the windows notification thresholds apply to, which are aligned to the Unix
+	// epoch, so that daily windows start at midnight UTC.
+	NotificationWindowMillis *int64 `protobuf:"varint,19,opt,name=notification_window_millis,json=notificationWindowMillis" json:"notification_window_millis,omitempty" yaml:"notification_window_millis"`
+	// If set, caps how long the service lets any caller wait for tokens from the bucket, whatever max
+	// wait the caller requests or wait_timeout_millis is inherited, so that callers can't hold long
+	// waits, and the debt they are accounted as, against the bucket.
+	MaxWaitOverrideMillis *int64 `protobuf:"varint,20,opt,name=max_wait_override_millis,json=maxWaitOverrideMillis" json:"max_wait_override_millis,omitempty" yaml:"max_wait_override_millis"`
 }
 
 func (m *BucketConfig) Reset()                    { *m = BucketConfig{} }
@@ -159,43 +441,120 @@ func (m *BucketConfig) GetNamespace() string {
 }
 
 func (m *BucketConfig) GetSize() int64 {
-	if m != nil {
-		return m.Size
+	if m != nil && m.Size != nil {
+		return *m.Size
 	}
 	return 0
 }
 
 func (m *BucketConfig) GetFillRate() int64 {
-	if m != nil {
-		return m.FillRate
+	if m != nil && m.FillRate != nil {
+		return *m.FillRate
 	}
 	return 0
 }
 
 func (m *BucketConfig) GetWaitTimeoutMillis() int64 {
-	if m != nil {
-		return m.WaitTimeoutMillis
+	if m != nil && m.WaitTimeoutMillis != nil {
+		return *m.WaitTimeoutMillis
 	}
 	return 0
 }
 
 func (m *BucketConfig) GetMaxIdleMillis() int64 {
-	if m != nil {
-		return m.MaxIdleMillis
+	if m != nil && m.MaxIdleMillis != nil {
+		return *m.MaxIdleMillis
 	}
 	return 0
 }
 
 func (m *BucketConfig) GetMaxDebtMillis() int64 {
-	if m != nil {
-		return m.MaxDebtMillis
+	if m != nil && m.MaxDebtMillis != nil {
+		return *m.MaxDebtMillis
 	}
 	return 0
 }
 
 func (m *BucketConfig) GetMaxTokensPerRequest() int64 {
+	if m != nil && m.MaxTokensPerRequest != nil {
+		return *m.MaxTokensPerRequest
+	}
+	return 0
+}
+
+func (m *BucketConfig) GetQuotaGroup() string {
 	if m != nil {
-		return m.MaxTokensPerRequest
+		return m.QuotaGroup
+	}
+	return ""
+}
+
+func (m *BucketConfig) GetTemplate() string {
+	if m != nil {
+		return m.Template
+	}
+	return ""
+}
+
+func (m *BucketConfig) GetSampleRate() int64 {
+	if m != nil && m.SampleRate != nil {
+		return *m.SampleRate
+	}
+	return 0
+}
+
+func (m *BucketConfig) GetMetadata() map[string]string {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *BucketConfig) GetBorrowFrom() []string {
+	if m != nil {
+		return m.BorrowFrom
+	}
+	return nil
+}
+
+func (m *BucketConfig) GetMaxBorrowedTokens() int64 {
+	if m != nil && m.MaxBorrowedTokens != nil {
+		return *m.MaxBorrowedTokens
+	}
+	return 0
+}
+
+func (m *BucketConfig) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *BucketConfig) GetSoftLimitPercent() int64 {
+	if m != nil && m.SoftLimitPercent != nil {
+		return *m.SoftLimitPercent
+	}
+	return 0
+}
+
+func (m *BucketConfig) GetNotificationThresholds() []int64 {
+	if m != nil {
+		return m.NotificationThresholds
+	}
+	return nil
+}
+
+func (m *BucketConfig) GetNotificationWindowMillis() int64 {
+	if m != nil && m.NotificationWindowMillis != nil {
+		return *m.NotificationWindowMillis
+	}
+	return 0
+}
+
+func (m *BucketConfig) GetMaxWaitOverrideMillis() int64 {
+	if m != nil && m.MaxWaitOverrideMillis != nil {
+		return *m.MaxWaitOverrideMillis
 	}
 	return 0
 }
@@ -204,42 +563,101 @@ func init() {
 	proto.RegisterType((*ServiceConfig)(nil), "quotaservice.configs.ServiceConfig")
 	proto.RegisterType((*NamespaceConfig)(nil), "quotaservice.configs.NamespaceConfig")
 	proto.RegisterType((*BucketConfig)(nil), "quotaservice.configs.BucketConfig")
+	proto.RegisterEnum("quotaservice.configs.TokenUnit", TokenUnit_name, TokenUnit_value)
+	proto.RegisterEnum("quotaservice.configs.DegradationPolicy", DegradationPolicy_name, DegradationPolicy_value)
 }
 
 func init() { proto.RegisterFile("protos/config/configs.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 509 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x8c, 0x54, 0x4d, 0x6f, 0xd3, 0x40,
-	0x10, 0x95, 0xed, 0xa4, 0x69, 0xa6, 0x84, 0xd2, 0x2d, 0x05, 0xab, 0xe5, 0x10, 0x45, 0x02, 0xe5,
-	0x64, 0xa4, 0xe4, 0x52, 0xc1, 0x0d, 0xc2, 0xa1, 0x12, 0x20, 0xb4, 0x8d, 0x38, 0x70, 0xc0, 0xda,
-	0xc4, 0x93, 0x6a, 0x95, 0xb5, 0x9d, 0x7a, 0xd7, 0x21, 0xe1, 0x07, 0x71, 0xe0, 0x77, 0xf1, 0x43,
-	0xd0, 0x7e, 0x38, 0xd8, 0x55, 0x84, 0x72, 0xca, 0x64, 0xde, 0x9b, 0x37, 0xbb, 0xef, 0xad, 0x0c,
-	0x57, 0xab, 0x22, 0x57, 0xb9, 0x7c, 0x3d, 0xcf, 0xb3, 0x05, 0xbf, 0x73, 0x3f, 0x32, 0x32, 0x5d,
-	0xf2, 0xf4, 0xbe, 0xcc, 0x15, 0x93, 0x58, 0xac, 0xf9, 0x1c, 0x23, 0x87, 0x0d, 0xfe, 0xf8, 0xd0,
-	0xbb, 0xb5, 0xbd, 0xf7, 0xa6, 0x45, 0xbe, 0xc2, 0xc5, 0x9d, 0xc8, 0x67, 0x4c, 0xc4, 0x09, 0x2e,
-	0x58, 0x29, 0x54, 0x3c, 0x2b, 0xe7, 0x4b, 0x54, 0xa1, 0xd7, 0xf7, 0x86, 0x27, 0xa3, 0x41, 0xb4,
-	0x4f, 0x27, 0x7a, 0x67, 0x38, 0x56, 0x82, 0x9e, 0x5b, 0x81, 0x89, 0x9d, 0xb7, 0x10, 0xb9, 0x05,
-	0xc8, 0x58, 0x8a, 0x72, 0xc5, 0xe6, 0x28, 0x43, 0xbf, 0x1f, 0x0c, 0x4f, 0x46, 0xe3, 0xfd, 0x62,
-	0x8d, 0x03, 0x45, 0x9f, 0x77, 0x53, 0x1f, 0x32, 0x55, 0x6c, 0x69, 0x4d, 0x86, 0x84, 0xd0, 0x59,
-	0x63, 0x21, 0x79, 0x9e, 0x85, 0x41, 0xdf, 0x1b, 0xb6, 0x69, 0xf5, 0x97, 0x10, 0x68, 0x95, 0x12,
-	0x8b, 0xb0, 0xd5, 0xf7, 0x86, 0x5d, 0x6a, 0x6a, 0xdd, 0x4b, 0x98, 0xc2, 0xb0, 0xdd, 0xf7, 0x86,
-	0x01, 0x35, 0xf5, 0x65, 0x02, 0xa7, 0x0f, 0x16, 0x90, 0x27, 0x10, 0x2c, 0x71, 0x6b, 0xee, 0xdb,
-	0xa5, 0xba, 0x24, 0x6f, 0xa1, 0xbd, 0x66, 0xa2, 0xc4, 0xd0, 0x37, 0x1e, 0xbc, 0xdc, 0x7f, 0xec,
-	0x9d, 0x8e, 0xb3, 0xc1, 0xce, 0xbc, 0xf1, 0xaf, 0xbd, 0xc1, 0xef, 0xa0, 0xb6, 0xc6, 0x19, 0x4d,
-	0xa0, 0xa5, 0x6f, 0xe2, 0xf6, 0x98, 0x9a, 0xdc, 0xc0, 0xe3, 0x07, 0xae, 0xfb, 0x07, 0xbb, 0xde,
-	0x4b, 0x1a, 0x7e, 0x7f, 0x83, 0xe7, 0xc9, 0x36, 0x63, 0x29, 0x9f, 0x3b, 0xa9, 0x58, 0x61, 0xba,
-	0x12, 0xfa, 0xfe, 0xc1, 0xc1, 0x9a, 0x17, 0x4e, 0xc2, 0x36, 0xa7, 0x4e, 0x80, 0x44, 0x70, 0x9e,
-	0xb2, 0x4d, 0xdc, 0xd4, 0x97, 0xc6, 0xeb, 0x36, 0x3d, 0x4b, 0xd9, 0x66, 0x52, 0x1f, 0x93, 0xe4,
-	0x23, 0x74, 0x2a, 0x4e, 0xdb, 0x04, 0x3f, 0x3a, 0xc8, 0x41, 0x77, 0x16, 0x97, 0x7b, 0x25, 0x71,
-	0xf9, 0x1d, 0x1e, 0xd5, 0x81, 0x3d, 0x79, 0x5d, 0x37, 0xf3, 0x3a, 0xe4, 0xa6, 0xb5, 0xb0, 0x7e,
-	0xf9, 0xd5, 0x82, 0xff, 0x24, 0xf5, 0x02, 0xba, 0xbb, 0x77, 0x68, 0xd6, 0x74, 0xe9, 0xbf, 0x86,
-	0x9e, 0x90, 0xfc, 0xa7, 0x75, 0x3a, 0xa0, 0xa6, 0x26, 0x57, 0xd0, 0x5d, 0x70, 0x21, 0xe2, 0x42,
-	0x47, 0xd0, 0x32, 0xc0, 0xb1, 0x6e, 0x50, 0xe7, 0xe8, 0x0f, 0xc6, 0x55, 0xac, 0x78, 0x8a, 0x79,
-	0xa9, 0xe2, 0x94, 0x0b, 0xc1, 0xa5, 0x7b, 0xa9, 0x67, 0x1a, 0x9a, 0x5a, 0xe4, 0x93, 0x01, 0xc8,
-	0x2b, 0x38, 0xd5, 0x09, 0xf0, 0x44, 0x60, 0xc5, 0x3d, 0x32, 0xdc, 0x5e, 0xca, 0x36, 0x37, 0x89,
-	0xc0, 0x26, 0x2f, 0xc1, 0xd9, 0x4e, 0xb3, 0xb3, 0xe3, 0x4d, 0x70, 0x56, 0xe9, 0x8d, 0xe1, 0x99,
-	0xe6, 0xa9, 0x7c, 0x89, 0x99, 0x8c, 0x57, 0x58, 0xc4, 0x05, 0xde, 0x97, 0x28, 0x55, 0x78, 0x6c,
-	0xe8, 0x3a, 0xef, 0xa9, 0x01, 0xbf, 0x60, 0x41, 0x2d, 0x34, 0x3b, 0x32, 0x5f, 0x96, 0xf1, 0xdf,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x29, 0xba, 0x7e, 0x7d, 0x78, 0x04, 0x00, 0x00,
+	// 1421 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x58, 0xeb, 0x4e, 0x1b, 0x47,
+	0x14, 0x8e, 0x31, 0x06, 0xef, 0xb1, 0x8d, 0xd7, 0xc3, 0x6d, 0x43, 0x1a, 0xc5, 0xa2, 0x89, 0x42,
+	0x13, 0x89, 0x24, 0x50, 0xa9, 0x34, 0xa9, 0x2a, 0xc5, 0x60, 0x0a, 0x15, 0x09, 0x64, 0x4d, 0x82,
+	0xda, 0x1f, 0x1d, 0x8d, 0xbd, 0x63, 0x33, 0x62, 0x2f, 0xce, 0xce, 0x98, 0x4b, 0x9f, 0xa0, 0x8f,
+	0xd8, 0x37, 0xe8, 0x4b, 0xf4, 0x47, 0x35, 0x33, 0xbb, 0xeb, 0xb5, 0x59, 0x12, 0x27, 0x4d, 0x7e,
+	0xb1, 0x3e, 0xdf, 0x39, 0xdf, 0x99, 0x39, 0x97, 0x6f, 0x57, 0xc0, 0x9d, 0x7e, 0x18, 0x88, 0x80,
+	0x3f, 0xe9, 0x04, 0x7e, 0x97, 0xf5, 0xa2, 0x3f, 0x7c, 0x5d, 0x59, 0xd1, 0xc2, 0xfb, 0x41, 0x20,
+	0x08, 0xa7, 0xe1, 0x39, 0xeb, 0xd0, 0xf5, 0x08, 0x5b, 0xfd, 0x1b, 0xa0, 0xd2, 0xd2, 0xb6, 0x6d,
+	0x65, 0x42, 0xef, 0x60, 0xb1, 0xe7, 0x06, 0x6d, 0xe2, 0x62, 0x87, 0x76, 0xc9, 0xc0, 0x15, 0xb8,
+	0x3d, 0xe8, 0x9c, 0x51, 0x61, 0xe5, 0xea, 0xb9, 0xb5, 0xd2, 0xc6, 0xea, 0x7a, 0x16, 0xcf, 0x7a,
+	0x43, 0xf9, 0x68, 0x0a, 0x7b, 0x5e, 0x13, 0xec, 0xe8, 0x78, 0x0d, 0xa1, 0x16, 0x80, 0x4f, 0x3c,
+	0xca, 0xfb, 0xa4, 0x43, 0xb9, 0x35, 0x55, 0xcf, 0xaf, 0x95, 0x36, 0x36, 0xb3, 0xc9, 0x46, 0x0e,
+	0xb4, 0xfe, 0x3a, 0x89, 0x6a, 0xfa, 0x22, 0xbc, 0xb2, 0x53, 0x34, 0xc8, 0x82, 0xd9, 0x73, 0x1a,
+	0x72, 0x16, 0xf8, 0x56, 0xbe, 0x9e, 0x5b, 0x2b, 0xd8, 0xf1, 0x4f, 0x84, 0x60, 0x7a, 0xc0, 0x69,
+	0x68, 0x4d, 0xd7, 0x73, 0x6b, 0x86, 0xad, 0x9e, 0xa5, 0xcd, 0x21, 0x82, 0x5a, 0x85, 0x7a, 0x6e,
+	0x2d, 0x6f, 0xab, 0x67, 0xb4, 0x09, 0x4b, 0x1e, 0xb9, 0xc4, 0xcc, 0xc7, 0x5d, 0x97, 0xf5, 0x4e,
+	0x05, 0x0e, 0xe9, 0xfb, 0x01, 0xe5, 0x82, 0x5b, 0x33, 0xca, 0x6b, 0xde, 0x23, 0x97, 0xfb, 0xfe,
+	0xae, 0xc2, 0xec, 0x08, 0x42, 0x27, 0x50, 0x56, 0x07, 0xc7, 0xbd, 0x30, 0x18, 0xf4, 0xb9, 0x35,
+	0xab, 0x6e, 0xf3, 0xfd, 0x24, 0xb7, 0x79, 0x23, 0x5d, 0x7e, 0x51, 0x61, 0xfa, 0x3a, 0xa5, 0xf7,
+	0x43, 0x0b, 0xea, 0x80, 0xa9, 0xab, 0x8d, 0x05, 0xf5, 0xfa, 0x2e, 0x11, 0x94, 0x5b, 0x45, 0x45,
+	0xbe, 0x35, 0x09, 0xb9, 0x2e, 0xf5, 0x71, 0x1c, 0xaa, 0x13, 0x54, 0xdb, 0xa3, 0x56, 0xe4, 0xc2,
+	0x7c, 0x52, 0xc2, 0x54, 0x1e, 0x43, 0xe5, 0x79, 0xf1, 0x49, 0x2d, 0x19, 0x4b, 0x85, 0xfc, 0x6b,
+	0x00, 0x62, 0x80, 0x1c, 0xea, 0x52, 0x41, 0x1d, 0x9c, 0xea, 0x3f, 0xa8, 0x64, 0xcf, 0x27, 0x49,
+	0xb6, 0xa3, 0xa3, 0xc7, 0xc7, 0xa0, 0xe6, 0x8c, 0xdb, 0xd1, 0x2b, 0xf8, 0xf6, 0x5a, 0x2a, 0x1c,
+	0x52, 0x41, 0x7d, 0xc1, 0x02, 0x1f, 0x73, 0xda, 0x09, 0x7c, 0x87, 0x5b, 0x25, 0xd5, 0xd8, 0xfa,
+	0x78, 0xbc, 0x1d, 0x3b, 0xb6, 0xb4, 0x1f, 0x7a, 0x0a, 0x0b, 0x94, 0xf4, 0x68, 0x88, 0xb9, 0x20,
+	0x82, 0x75, 0xa2, 0x3d, 0xe0, 0x56, 0xb9, 0x9e, 0x5b, 0x2b, 0xda, 0x48, 0x61, 0x2d, 0x05, 0xe9,
+	0xba, 0xf3, 0x15, 0x07, 0xaa, 0x63, 0xc7, 0x44, 0x26, 0xe4, 0xcf, 0xe8, 0x95, 0x5a, 0x1e, 0xc3,
+	0x96, 0x8f, 0xe8, 0x05, 0x14, 0xce, 0x89, 0x3b, 0xa0, 0xd6, 0x94, 0x5a, 0xa8, 0x07, 0xd9, 0x35,
+	0x48, 0x78, 0xa2, 0x9d, 0xd2, 0x31, 0xcf, 0xa7, 0xb6, 0x72, 0x2b, 0x6d, 0x30, 0xc7, 0xa7, 0x28,
+	0x23, 0xcd, 0xd6, 0x68, 0x9a, 0x49, 0xf6, 0x36, 0x95, 0xa3, 0x0b, 0x0b, 0x59, 0xc3, 0xf4, 0xc5,
+	0xf3, 0xb8, 0xb0, 0x7c, 0xc3, 0x30, 0x7d, 0x8d, 0xca, 0x9d, 0xc1, 0x52, 0xf6, 0x34, 0x7d, 0x85,
+	0x64, 0xab, 0xff, 0x00, 0x54, 0xc7, 0x60, 0xa9, 0x40, 0x72, 0x32, 0xa3, 0x3c, 0xea, 0x19, 0xed,
+	0xc3, 0xdc, 0x98, 0xd2, 0x4e, 0x5e, 0xc9, 0x8a, 0x33, 0xa2, 0xb1, 0xbf, 0xc3, 0xb2, 0x73, 0xe5,
+	0x13, 0x2f, 0x19, 0xd6, 0x64, 0xbd, 0xad, 0xfc, 0xc4, 0x9c, 0x8b, 0x11, 0xc5, 0x68, 0xff, 0xd1,
+	0x3a, 0x48, 0x29, 0xc4, 0xa3, 0xfc, 0x5c, 0xe9, 0x6b, 0xc1, 0xae, 0x79, 0xe4, 0x72, 0x27, 0x1d,
+	0xc6, 0xd1, 0x01, 0xcc, 0xc6, 0x3e, 0x05, 0xb5, 0xec, 0x1b, 0x13, 0x55, 0x30, 0x3a, 0x4b, 0xb4,
+	0xe4, 0x31, 0xc5, 0xe7, 0xc9, 0xf4, 0x3b, 0x29, 0x3d, 0xbd, 0x90, 0x38, 0x44, 0xed, 0x7f, 0x3f,
+	0x70, 0x59, 0xe7, 0xca, 0x9a, 0xad, 0xe7, 0xd6, 0xe6, 0x36, 0x1e, 0x66, 0x9f, 0x66, 0x67, 0xe8,
+	0x7f, 0xa4, 0xdc, 0xa5, 0xce, 0x8c, 0x99, 0xd0, 0xcf, 0x00, 0x22, 0x38, 0xa3, 0x3e, 0x1e, 0xf8,
+	0x4c, 0x58, 0x45, 0xc5, 0x77, 0x2f, 0x9b, 0xef, 0x58, 0xfa, 0xbd, 0xf5, 0x99, 0xb0, 0x0d, 0x11,
+	0x3f, 0xa2, 0x07, 0xb2, 0xe3, 0x3e, 0xa3, 0x4e, 0x52, 0x45, 0xa9, 0xbd, 0x86, 0x5d, 0xd1, 0xd6,
+	0xb8, 0x82, 0x0f, 0xa1, 0x4a, 0x5c, 0x37, 0xb8, 0x48, 0xf9, 0x81, 0xf2, 0x9b, 0x8b, 0xcc, 0xb1,
+	0xe3, 0x5d, 0x80, 0x58, 0xf7, 0x88, 0x88, 0xe4, 0xcd, 0x88, 0x2c, 0x2f, 0x05, 0xfa, 0x0e, 0x4c,
+	0xe6, 0x9f, 0xd2, 0x90, 0x89, 0xf8, 0x95, 0x1e, 0x6b, 0x58, 0x35, 0xb2, 0x47, 0x6f, 0x6a, 0x8e,
+	0x0e, 0xa1, 0xe8, 0x51, 0x21, 0x6f, 0x4b, 0xac, 0xca, 0x87, 0x5e, 0xd1, 0xe3, 0x5d, 0x7b, 0x15,
+	0x45, 0xe9, 0xb6, 0x25, 0x24, 0xe8, 0x31, 0xd4, 0xf8, 0xa0, 0xdf, 0x0f, 0x29, 0xe7, 0xd4, 0xc1,
+	0xf4, 0x9c, 0xfa, 0x82, 0x5b, 0x73, 0xea, 0x16, 0xe6, 0x10, 0x68, 0x2a, 0x3b, 0xda, 0x80, 0x45,
+	0x9f, 0xf6, 0x88, 0x60, 0xe7, 0x14, 0x77, 0x48, 0xe7, 0x94, 0x62, 0x8f, 0xb9, 0x2e, 0xe3, 0x56,
+	0x55, 0xf7, 0x38, 0x06, 0xb7, 0x25, 0xf6, 0x4a, 0x41, 0xe8, 0x09, 0x2c, 0x74, 0x09, 0x0b, 0x31,
+	0x3f, 0x25, 0x21, 0xc5, 0x5d, 0xe6, 0xba, 0x38, 0x94, 0xf3, 0x6e, 0xaa, 0x90, 0x9a, 0xc4, 0x5a,
+	0x12, 0xda, 0x65, 0xae, 0x6b, 0xcb, 0x39, 0x66, 0x80, 0x52, 0x01, 0x17, 0x54, 0x4e, 0x0c, 0xb7,
+	0x6a, 0x1f, 0x7a, 0xf9, 0x8d, 0x5f, 0x76, 0x37, 0x26, 0x3d, 0xd1, 0xd1, 0xfa, 0xd2, 0x66, 0x77,
+	0xcc, 0x8c, 0xf6, 0x61, 0xc6, 0x25, 0x6d, 0xea, 0x72, 0x0b, 0x29, 0xfa, 0x67, 0x93, 0xd1, 0x1f,
+	0xa8, 0x18, 0x4d, 0x1a, 0x11, 0xac, 0xfc, 0x01, 0xe5, 0xf4, 0x62, 0x7c, 0x71, 0x1d, 0x7e, 0x01,
+	0x95, 0x91, 0x16, 0x66, 0x24, 0x58, 0x48, 0x27, 0x30, 0xd2, 0xc1, 0xdb, 0xb0, 0x98, 0x59, 0x92,
+	0x8f, 0x91, 0xe4, 0xd3, 0x24, 0x3f, 0x42, 0x29, 0x75, 0xf1, 0x4f, 0xc9, 0xbf, 0xfa, 0xaf, 0x01,
+	0xe5, 0xf4, 0xc5, 0x32, 0x65, 0xf6, 0x1b, 0x30, 0x92, 0x8f, 0x82, 0x88, 0x62, 0x68, 0x40, 0xcb,
+	0x30, 0xcd, 0xd9, 0x9f, 0x5a, 0x26, 0xf3, 0x7b, 0xb7, 0x6c, 0xf5, 0xeb, 0xaf, 0x5c, 0x0e, 0xd5,
+	0xc1, 0x18, 0x0e, 0xd5, 0xb4, 0x42, 0x73, 0x76, 0xb1, 0x1b, 0x4d, 0x93, 0xf4, 0xd8, 0x84, 0xf9,
+	0x0b, 0xc2, 0x04, 0x16, 0xcc, 0xa3, 0xc1, 0x40, 0xc4, 0x33, 0xab, 0x3e, 0x32, 0xf7, 0xa6, 0xec,
+	0x9a, 0x04, 0x8f, 0x35, 0xa6, 0x67, 0x56, 0x06, 0x3d, 0x86, 0xaa, 0xd2, 0x33, 0xc7, 0x4d, 0x86,
+	0x5c, 0x09, 0xd9, 0x5e, 0xde, 0xae, 0x48, 0x29, 0x73, 0x5c, 0x7a, 0xcd, 0xd9, 0xa1, 0xed, 0x84,
+	0x7d, 0x56, 0x39, 0x4f, 0x2b, 0xe7, 0x1d, 0xda, 0x4e, 0x31, 0x6f, 0x69, 0xa5, 0x54, 0x6a, 0xc3,
+	0x71, 0x9f, 0x86, 0xb1, 0x54, 0x2a, 0xa1, 0xca, 0xef, 0x15, 0x94, 0x56, 0x2a, 0x5d, 0xe2, 0x47,
+	0x34, 0x8c, 0xc4, 0x52, 0x46, 0xde, 0x83, 0x52, 0xea, 0xab, 0xd6, 0x32, 0x54, 0x8d, 0x60, 0xf8,
+	0x79, 0x8a, 0x56, 0xa0, 0x98, 0xbc, 0x4f, 0x40, 0xa1, 0xc9, 0x6f, 0x74, 0x1f, 0x4a, 0x9c, 0x78,
+	0x7d, 0x97, 0xea, 0x4a, 0x29, 0x11, 0xda, 0x9b, 0xb1, 0x41, 0x1b, 0xe3, 0x5a, 0x1d, 0x5c, 0xd3,
+	0x97, 0xa7, 0x1f, 0x9f, 0xd3, 0x1b, 0xc5, 0xe5, 0x1e, 0x94, 0xda, 0x41, 0x18, 0x06, 0x17, 0xb8,
+	0x1b, 0x06, 0x5e, 0x24, 0x2b, 0xa0, 0x4d, 0xbb, 0x61, 0xe0, 0xc9, 0xd6, 0xc8, 0x5a, 0x68, 0x0b,
+	0x75, 0xa2, 0xa2, 0x68, 0x39, 0xd9, 0x9b, 0x55, 0x6f, 0xad, 0x46, 0x84, 0xe9, 0x82, 0xc8, 0x33,
+	0xee, 0x26, 0x5b, 0x6b, 0xaa, 0x13, 0xae, 0x4f, 0x70, 0xc2, 0x8c, 0x95, 0x45, 0xcf, 0x00, 0xf1,
+	0xa0, 0x2b, 0xb0, 0xcb, 0x3c, 0x26, 0x64, 0x23, 0x3a, 0xd4, 0x17, 0x56, 0x4d, 0xe5, 0x2e, 0xda,
+	0xa6, 0xc4, 0x0e, 0x24, 0x74, 0xa4, 0x11, 0x99, 0xfa, 0x07, 0x58, 0xf6, 0x03, 0xc1, 0xba, 0xac,
+	0xa3, 0xdf, 0x58, 0xe2, 0x34, 0xa4, 0xfc, 0x34, 0x70, 0x1d, 0xad, 0x20, 0x79, 0x7b, 0x29, 0x0d,
+	0x1f, 0x27, 0x28, 0x7a, 0x09, 0x2b, 0x23, 0x81, 0x17, 0xcc, 0x77, 0x82, 0x8b, 0x78, 0x58, 0xe6,
+	0x55, 0x4e, 0xc3, 0xb6, 0xd2, 0x3e, 0x27, 0xca, 0x65, 0x38, 0x37, 0x3f, 0x81, 0x25, 0x6b, 0xa5,
+	0x46, 0x39, 0x38, 0xa7, 0x61, 0xc8, 0x9c, 0x64, 0x34, 0x17, 0x14, 0x01, 0xd8, 0x8b, 0x1e, 0xb9,
+	0x3c, 0x21, 0x4c, 0x1c, 0x46, 0x78, 0x12, 0xfd, 0xff, 0xf4, 0xe3, 0xf3, 0x57, 0xbf, 0x31, 0x0b,
+	0x05, 0x2c, 0x57, 0xb5, 0x51, 0x06, 0x18, 0xaa, 0x7f, 0x63, 0x09, 0x16, 0x70, 0xc6, 0x52, 0x36,
+	0x10, 0x98, 0x78, 0x6c, 0xef, 0x12, 0x5b, 0x6a, 0xbd, 0x1a, 0xb7, 0x61, 0x19, 0x67, 0x6f, 0x51,
+	0x63, 0x0e, 0xca, 0x38, 0x35, 0xe9, 0x2a, 0x55, 0xc6, 0x90, 0x35, 0x16, 0x61, 0x1e, 0x5f, 0xef,
+	0x7f, 0xe3, 0x2e, 0xdc, 0xc1, 0x37, 0xb7, 0xaa, 0x71, 0x07, 0x6e, 0xe3, 0x9b, 0xda, 0xf0, 0xeb,
+	0x74, 0xb1, 0x6c, 0x56, 0xec, 0x2a, 0xbd, 0xec, 0xbb, 0xac, 0xc3, 0x04, 0xee, 0x32, 0xea, 0x3a,
+	0xfc, 0xd1, 0x7d, 0x30, 0x92, 0xcf, 0x0c, 0x54, 0x86, 0xa2, 0xdd, 0x7c, 0xf3, 0xb6, 0xd9, 0x3a,
+	0x6e, 0x99, 0xb7, 0x90, 0x01, 0x85, 0xc6, 0x6f, 0xc7, 0xcd, 0x96, 0x99, 0x7b, 0xb4, 0x09, 0xb5,
+	0x6b, 0x1f, 0x37, 0xa8, 0x02, 0xc6, 0xee, 0xcb, 0xfd, 0x03, 0x7c, 0x78, 0xd4, 0x7c, 0x6d, 0xde,
+	0x42, 0x55, 0x28, 0xa9, 0x9f, 0xdb, 0x07, 0x87, 0xad, 0xe6, 0x8e, 0x99, 0x6b, 0xcf, 0xa8, 0xff,
+	0x1d, 0x6c, 0xfe, 0x37, 0x00, 0x0e, 0x01, 0x59, 0x0a, 0x5a, 0x10, 0x00, 0x00,
 }
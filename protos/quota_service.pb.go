@@ -11,6 +11,16 @@ It is generated from these files:
 It has these top-level messages:
 	AllowRequest
 	AllowResponse
+	AllowV2Response
+	Lease
+	AllowAllRequest
+	BucketTokens
+	ChargeRequest
+	ChargeResponse
+	ReconcileRequest
+	BucketUsage
+	ReconcileResponse
+	BucketShare
 */
 package quotaservice
 
@@ -44,6 +54,8 @@ const (
 	AllowResponse_REJECTED_TOO_MANY_TOKENS_REQUESTED AllowResponse_Status = 4
 	AllowResponse_REJECTED_INVALID_REQUEST           AllowResponse_Status = 5
 	AllowResponse_REJECTED_SERVER_ERROR              AllowResponse_Status = 6
+	AllowResponse_REJECTED_OVERLOADED                AllowResponse_Status = 7
+	AllowResponse_REJECTED_DENIED                    AllowResponse_Status = 8
 )
 
 var AllowResponse_Status_name = map[int32]string{
@@ -54,6 +66,8 @@ var AllowResponse_Status_name = map[int32]string{
 	4: "REJECTED_TOO_MANY_TOKENS_REQUESTED",
 	5: "REJECTED_INVALID_REQUEST",
 	6: "REJECTED_SERVER_ERROR",
+	7: "REJECTED_OVERLOADED",
+	8: "REJECTED_DENIED",
 }
 var AllowResponse_Status_value = map[string]int32{
 	"OK":                                 0,
@@ -63,6 +77,8 @@ var AllowResponse_Status_value = map[string]int32{
 	"REJECTED_TOO_MANY_TOKENS_REQUESTED": 4,
 	"REJECTED_INVALID_REQUEST":           5,
 	"REJECTED_SERVER_ERROR":              6,
+	"REJECTED_OVERLOADED":                7,
+	"REJECTED_DENIED":                    8,
 }
 
 func (x AllowResponse_Status) String() string {
@@ -70,6 +86,104 @@ func (x AllowResponse_Status) String() string {
 }
 func (AllowResponse_Status) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1, 0} }
 
+type AllowV2Response_Reason int32
+
+const (
+	AllowV2Response_GRANTED                   AllowV2Response_Reason = 0
+	AllowV2Response_FAILED_OPEN               AllowV2Response_Reason = 1
+	AllowV2Response_ALLOW_LISTED              AllowV2Response_Reason = 2
+	AllowV2Response_TIMEOUT                   AllowV2Response_Reason = 3
+	AllowV2Response_NO_BUCKET                 AllowV2Response_Reason = 4
+	AllowV2Response_TOO_MANY_BUCKETS          AllowV2Response_Reason = 5
+	AllowV2Response_TOO_MANY_TOKENS_REQUESTED AllowV2Response_Reason = 6
+	AllowV2Response_INVALID_REQUEST           AllowV2Response_Reason = 7
+	AllowV2Response_OVERLOADED                AllowV2Response_Reason = 8
+	AllowV2Response_DENIED                    AllowV2Response_Reason = 9
+)
+
+var AllowV2Response_Reason_name = map[int32]string{
+	0: "GRANTED",
+	1: "FAILED_OPEN",
+	2: "ALLOW_LISTED",
+	3: "TIMEOUT",
+	4: "NO_BUCKET",
+	5: "TOO_MANY_BUCKETS",
+	6: "TOO_MANY_TOKENS_REQUESTED",
+	7: "INVALID_REQUEST",
+	8: "OVERLOADED",
+	9: "DENIED",
+}
+var AllowV2Response_Reason_value = map[string]int32{
+	"GRANTED":                   0,
+	"FAILED_OPEN":               1,
+	"ALLOW_LISTED":              2,
+	"TIMEOUT":                   3,
+	"NO_BUCKET":                 4,
+	"TOO_MANY_BUCKETS":          5,
+	"TOO_MANY_TOKENS_REQUESTED": 6,
+	"INVALID_REQUEST":           7,
+	"OVERLOADED":                8,
+	"DENIED":                    9,
+}
+
+func (x AllowV2Response_Reason) String() string {
+	return proto.EnumName(AllowV2Response_Reason_name, int32(x))
+}
+func (AllowV2Response_Reason) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{2, 0} }
+
+type ChargeResponse_Status int32
+
+const (
+	ChargeResponse_OK                       ChargeResponse_Status = 0
+	ChargeResponse_REJECTED_NO_BUCKET       ChargeResponse_Status = 1
+	ChargeResponse_REJECTED_INVALID_REQUEST ChargeResponse_Status = 2
+	ChargeResponse_REJECTED_SERVER_ERROR    ChargeResponse_Status = 3
+)
+
+var ChargeResponse_Status_name = map[int32]string{
+	0: "OK",
+	1: "REJECTED_NO_BUCKET",
+	2: "REJECTED_INVALID_REQUEST",
+	3: "REJECTED_SERVER_ERROR",
+}
+var ChargeResponse_Status_value = map[string]int32{
+	"OK":                       0,
+	"REJECTED_NO_BUCKET":       1,
+	"REJECTED_INVALID_REQUEST": 2,
+	"REJECTED_SERVER_ERROR":    3,
+}
+
+func (x ChargeResponse_Status) String() string {
+	return proto.EnumName(ChargeResponse_Status_name, int32(x))
+}
+func (ChargeResponse_Status) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{7, 0} }
+
+type ReconcileResponse_Status int32
+
+const (
+	ReconcileResponse_OK                       ReconcileResponse_Status = 0
+	ReconcileResponse_REJECTED_INVALID_REQUEST ReconcileResponse_Status = 1
+	ReconcileResponse_REJECTED_SERVER_ERROR    ReconcileResponse_Status = 2
+)
+
+var ReconcileResponse_Status_name = map[int32]string{
+	0: "OK",
+	1: "REJECTED_INVALID_REQUEST",
+	2: "REJECTED_SERVER_ERROR",
+}
+var ReconcileResponse_Status_value = map[string]int32{
+	"OK":                       0,
+	"REJECTED_INVALID_REQUEST": 1,
+	"REJECTED_SERVER_ERROR":    2,
+}
+
+func (x ReconcileResponse_Status) String() string {
+	return proto.EnumName(ReconcileResponse_Status_name, int32(x))
+}
+func (ReconcileResponse_Status) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{10, 0}
+}
+
 type AllowRequest struct {
 	Namespace  string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
 	BucketName string `protobuf:"bytes,2,opt,name=bucket_name,json=bucketName" json:"bucket_name,omitempty"`
@@ -81,8 +195,19 @@ type AllowRequest struct {
 	MaxWaitMillisOverride int64 `protobuf:"varint,4,opt,name=max_wait_millis_override,json=maxWaitMillisOverride" json:"max_wait_millis_override,omitempty"`
 	// *
 	// Whether to override max wait time with the above value.
-	// Defaults to false, which falls back to the bucket's configured value.
+	// Defaults to false, which falls back to the time remaining until the request's gRPC deadline if
+	// one is set, or the bucket's configured value otherwise. Either way, the max wait time is capped
+	// by the bucket's configured value.
 	MaxWaitTimeOverride bool `protobuf:"varint,5,opt,name=max_wait_time_override,json=maxWaitTimeOverride" json:"max_wait_time_override,omitempty"`
+	// *
+	// Optional, caller-supplied ID for this request. Retries of a request with the same ID within a
+	// short window return the original result instead of taking tokens again, on bucket
+	// implementations that support it.
+	RequestId string `protobuf:"bytes,6,opt,name=request_id,json=requestId" json:"request_id,omitempty"`
+	// *
+	// Whether to grant tokens only if the bucket has accumulated them, without going into debt, even
+	// if the bucket allows debt. For callers that must never borrow against future capacity.
+	Strict bool `protobuf:"varint,7,opt,name=strict" json:"strict,omitempty"`
 }
 
 func (m *AllowRequest) Reset()                    { *m = AllowRequest{} }
@@ -125,6 +250,20 @@ func (m *AllowRequest) GetMaxWaitTimeOverride() bool {
 	return false
 }
 
+func (m *AllowRequest) GetRequestId() string {
+	if m != nil {
+		return m.RequestId
+	}
+	return ""
+}
+
+func (m *AllowRequest) GetStrict() bool {
+	if m != nil {
+		return m.Strict
+	}
+	return false
+}
+
 type AllowResponse struct {
 	Status AllowResponse_Status `protobuf:"varint,1,opt,name=status,enum=quotaservice.AllowResponse_Status" json:"status,omitempty"`
 	// *
@@ -133,6 +272,10 @@ type AllowResponse struct {
 	// *
 	// Wait for this many millis before proceeding, if status == OK. 0 if no waiting is required.
 	WaitMillis int64 `protobuf:"varint,3,opt,name=wait_millis,json=waitMillis" json:"wait_millis,omitempty"`
+	// *
+	// Metadata configured on the namespace and bucket, such as a documentation URL or contact, for
+	// clients to surface to callers, particularly when rejected.
+	Metadata map[string]string `protobuf:"bytes,4,rep,name=metadata" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 }
 
 func (m *AllowResponse) Reset()                    { *m = AllowResponse{} }
@@ -161,10 +304,403 @@ func (m *AllowResponse) GetWaitMillis() int64 {
 	return 0
 }
 
+func (m *AllowResponse) GetMetadata() map[string]string {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type AllowV2Response struct {
+	// *
+	// Whether tokens were granted. If so, they are described by lease.
+	Granted bool                   `protobuf:"varint,1,opt,name=granted" json:"granted,omitempty"`
+	Reason  AllowV2Response_Reason `protobuf:"varint,2,opt,name=reason,enum=quotaservice.AllowV2Response_Reason" json:"reason,omitempty"`
+	// *
+	// Human-readable detail on why the request was rejected, if it was.
+	Message string `protobuf:"bytes,3,opt,name=message" json:"message,omitempty"`
+	// *
+	// The tokens granted, if granted is true.
+	Lease *Lease `protobuf:"bytes,4,opt,name=lease" json:"lease,omitempty"`
+	// *
+	// Tokens left in the bucket after this request, if has_remaining_tokens is true. Negative if the
+	// bucket is in debt. Not all bucket implementations report this.
+	RemainingTokens    int64 `protobuf:"varint,5,opt,name=remaining_tokens,json=remainingTokens" json:"remaining_tokens,omitempty"`
+	HasRemainingTokens bool  `protobuf:"varint,6,opt,name=has_remaining_tokens,json=hasRemainingTokens" json:"has_remaining_tokens,omitempty"`
+	// *
+	// Metadata configured on the namespace and bucket, such as a documentation URL or contact.
+	Metadata map[string]string `protobuf:"bytes,7,rep,name=metadata" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *AllowV2Response) Reset()                    { *m = AllowV2Response{} }
+func (m *AllowV2Response) String() string            { return proto.CompactTextString(m) }
+func (*AllowV2Response) ProtoMessage()               {}
+func (*AllowV2Response) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *AllowV2Response) GetGranted() bool {
+	if m != nil {
+		return m.Granted
+	}
+	return false
+}
+
+func (m *AllowV2Response) GetReason() AllowV2Response_Reason {
+	if m != nil {
+		return m.Reason
+	}
+	return AllowV2Response_GRANTED
+}
+
+func (m *AllowV2Response) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *AllowV2Response) GetLease() *Lease {
+	if m != nil {
+		return m.Lease
+	}
+	return nil
+}
+
+func (m *AllowV2Response) GetRemainingTokens() int64 {
+	if m != nil {
+		return m.RemainingTokens
+	}
+	return 0
+}
+
+func (m *AllowV2Response) GetHasRemainingTokens() bool {
+	if m != nil {
+		return m.HasRemainingTokens
+	}
+	return false
+}
+
+func (m *AllowV2Response) GetMetadata() map[string]string {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type Lease struct {
+	Tokens int64 `protobuf:"varint,1,opt,name=tokens" json:"tokens,omitempty"`
+	// *
+	// Wait for this many millis before proceeding. 0 if no waiting is required.
+	WaitMillis int64 `protobuf:"varint,2,opt,name=wait_millis,json=waitMillis" json:"wait_millis,omitempty"`
+	// *
+	// The time, in millis since the epoch, from which the tokens may be used, so clients needn't
+	// account for the time the response took to arrive.
+	NotBeforeUnixMillis int64 `protobuf:"varint,3,opt,name=not_before_unix_millis,json=notBeforeUnixMillis" json:"not_before_unix_millis,omitempty"`
+}
+
+func (m *Lease) Reset()                    { *m = Lease{} }
+func (m *Lease) String() string            { return proto.CompactTextString(m) }
+func (*Lease) ProtoMessage()               {}
+func (*Lease) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *Lease) GetTokens() int64 {
+	if m != nil {
+		return m.Tokens
+	}
+	return 0
+}
+
+func (m *Lease) GetWaitMillis() int64 {
+	if m != nil {
+		return m.WaitMillis
+	}
+	return 0
+}
+
+func (m *Lease) GetNotBeforeUnixMillis() int64 {
+	if m != nil {
+		return m.NotBeforeUnixMillis
+	}
+	return 0
+}
+
+// *
+// Requests tokens from several buckets at once, such that either all are granted, or none are. For
+// operations that consume several resources at once.
+type AllowAllRequest struct {
+	Buckets []*BucketTokens `protobuf:"bytes,1,rep,name=buckets" json:"buckets,omitempty"`
+	// *
+	// Max wait time, in millis, as in AllowRequest. Capped by the lowest of the buckets' configured
+	// values.
+	MaxWaitMillisOverride int64 `protobuf:"varint,2,opt,name=max_wait_millis_override,json=maxWaitMillisOverride" json:"max_wait_millis_override,omitempty"`
+	MaxWaitTimeOverride   bool  `protobuf:"varint,3,opt,name=max_wait_time_override,json=maxWaitTimeOverride" json:"max_wait_time_override,omitempty"`
+}
+
+func (m *AllowAllRequest) Reset()                    { *m = AllowAllRequest{} }
+func (m *AllowAllRequest) String() string            { return proto.CompactTextString(m) }
+func (*AllowAllRequest) ProtoMessage()               {}
+func (*AllowAllRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *AllowAllRequest) GetBuckets() []*BucketTokens {
+	if m != nil {
+		return m.Buckets
+	}
+	return nil
+}
+
+func (m *AllowAllRequest) GetMaxWaitMillisOverride() int64 {
+	if m != nil {
+		return m.MaxWaitMillisOverride
+	}
+	return 0
+}
+
+func (m *AllowAllRequest) GetMaxWaitTimeOverride() bool {
+	if m != nil {
+		return m.MaxWaitTimeOverride
+	}
+	return false
+}
+
+type BucketTokens struct {
+	Namespace  string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	BucketName string `protobuf:"bytes,2,opt,name=bucket_name,json=bucketName" json:"bucket_name,omitempty"`
+	// *
+	// Number of tokens requested. Defaults to 1, cannot be 0.
+	TokensRequested int64 `protobuf:"varint,3,opt,name=tokens_requested,json=tokensRequested" json:"tokens_requested,omitempty"`
+}
+
+func (m *BucketTokens) Reset()                    { *m = BucketTokens{} }
+func (m *BucketTokens) String() string            { return proto.CompactTextString(m) }
+func (*BucketTokens) ProtoMessage()               {}
+func (*BucketTokens) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *BucketTokens) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *BucketTokens) GetBucketName() string {
+	if m != nil {
+		return m.BucketName
+	}
+	return ""
+}
+
+func (m *BucketTokens) GetTokensRequested() int64 {
+	if m != nil {
+		return m.TokensRequested
+	}
+	return 0
+}
+
+// *
+// Reconciles tokens reserved by an earlier Allow with the actual cost of an operation, for
+// operations whose cost isn't known upfront. If the actual cost exceeds the tokens reserved, the
+// difference is taken from the bucket, regardless of availability; otherwise the difference is
+// refunded.
+type ChargeRequest struct {
+	Namespace  string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	BucketName string `protobuf:"bytes,2,opt,name=bucket_name,json=bucketName" json:"bucket_name,omitempty"`
+	// *
+	// Number of tokens reserved by the earlier Allow, typically an estimate of the cost.
+	TokensReserved int64 `protobuf:"varint,3,opt,name=tokens_reserved,json=tokensReserved" json:"tokens_reserved,omitempty"`
+	// *
+	// Actual cost, in tokens, of the operation.
+	ActualCost int64 `protobuf:"varint,4,opt,name=actual_cost,json=actualCost" json:"actual_cost,omitempty"`
+}
+
+func (m *ChargeRequest) Reset()                    { *m = ChargeRequest{} }
+func (m *ChargeRequest) String() string            { return proto.CompactTextString(m) }
+func (*ChargeRequest) ProtoMessage()               {}
+func (*ChargeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *ChargeRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *ChargeRequest) GetBucketName() string {
+	if m != nil {
+		return m.BucketName
+	}
+	return ""
+}
+
+func (m *ChargeRequest) GetTokensReserved() int64 {
+	if m != nil {
+		return m.TokensReserved
+	}
+	return 0
+}
+
+func (m *ChargeRequest) GetActualCost() int64 {
+	if m != nil {
+		return m.ActualCost
+	}
+	return 0
+}
+
+type ChargeResponse struct {
+	Status ChargeResponse_Status `protobuf:"varint,1,opt,name=status,enum=quotaservice.ChargeResponse_Status" json:"status,omitempty"`
+}
+
+func (m *ChargeResponse) Reset()                    { *m = ChargeResponse{} }
+func (m *ChargeResponse) String() string            { return proto.CompactTextString(m) }
+func (*ChargeResponse) ProtoMessage()               {}
+func (*ChargeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *ChargeResponse) GetStatus() ChargeResponse_Status {
+	if m != nil {
+		return m.Status
+	}
+	return ChargeResponse_OK
+}
+
+// *
+// Sent periodically by agents, i.e. quota service instances that serve Allow from local buckets, to
+// report the tokens they granted to the central quota service, which charges them to its buckets.
+type ReconcileRequest struct {
+	// *
+	// Identifies the agent, e.g. by hostname. Must be stable across calls.
+	AgentId string         `protobuf:"bytes,1,opt,name=agent_id,json=agentId" json:"agent_id,omitempty"`
+	Usage   []*BucketUsage `protobuf:"bytes,2,rep,name=usage" json:"usage,omitempty"`
+}
+
+func (m *ReconcileRequest) Reset()                    { *m = ReconcileRequest{} }
+func (m *ReconcileRequest) String() string            { return proto.CompactTextString(m) }
+func (*ReconcileRequest) ProtoMessage()               {}
+func (*ReconcileRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *ReconcileRequest) GetAgentId() string {
+	if m != nil {
+		return m.AgentId
+	}
+	return ""
+}
+
+func (m *ReconcileRequest) GetUsage() []*BucketUsage {
+	if m != nil {
+		return m.Usage
+	}
+	return nil
+}
+
+type BucketUsage struct {
+	Namespace  string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	BucketName string `protobuf:"bytes,2,opt,name=bucket_name,json=bucketName" json:"bucket_name,omitempty"`
+	// *
+	// Net tokens consumed from the agent's local bucket since its last report.
+	TokensConsumed int64 `protobuf:"varint,3,opt,name=tokens_consumed,json=tokensConsumed" json:"tokens_consumed,omitempty"`
+}
+
+func (m *BucketUsage) Reset()                    { *m = BucketUsage{} }
+func (m *BucketUsage) String() string            { return proto.CompactTextString(m) }
+func (*BucketUsage) ProtoMessage()               {}
+func (*BucketUsage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *BucketUsage) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *BucketUsage) GetBucketName() string {
+	if m != nil {
+		return m.BucketName
+	}
+	return ""
+}
+
+func (m *BucketUsage) GetTokensConsumed() int64 {
+	if m != nil {
+		return m.TokensConsumed
+	}
+	return 0
+}
+
+type ReconcileResponse struct {
+	Status ReconcileResponse_Status `protobuf:"varint,1,opt,name=status,enum=quotaservice.ReconcileResponse_Status" json:"status,omitempty"`
+	// *
+	// The agent's share of each bucket it reported usage for.
+	Shares []*BucketShare `protobuf:"bytes,2,rep,name=shares" json:"shares,omitempty"`
+}
+
+func (m *ReconcileResponse) Reset()                    { *m = ReconcileResponse{} }
+func (m *ReconcileResponse) String() string            { return proto.CompactTextString(m) }
+func (*ReconcileResponse) ProtoMessage()               {}
+func (*ReconcileResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *ReconcileResponse) GetStatus() ReconcileResponse_Status {
+	if m != nil {
+		return m.Status
+	}
+	return ReconcileResponse_OK
+}
+
+func (m *ReconcileResponse) GetShares() []*BucketShare {
+	if m != nil {
+		return m.Shares
+	}
+	return nil
+}
+
+type BucketShare struct {
+	Namespace  string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	BucketName string `protobuf:"bytes,2,opt,name=bucket_name,json=bucketName" json:"bucket_name,omitempty"`
+	// *
+	// Fraction, between 0 and 1, of the bucket's size and fill rate that the agent may grant from its
+	// local bucket.
+	Share float64 `protobuf:"fixed64,3,opt,name=share" json:"share,omitempty"`
+}
+
+func (m *BucketShare) Reset()                    { *m = BucketShare{} }
+func (m *BucketShare) String() string            { return proto.CompactTextString(m) }
+func (*BucketShare) ProtoMessage()               {}
+func (*BucketShare) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *BucketShare) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *BucketShare) GetBucketName() string {
+	if m != nil {
+		return m.BucketName
+	}
+	return ""
+}
+
+func (m *BucketShare) GetShare() float64 {
+	if m != nil {
+		return m.Share
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*AllowRequest)(nil), "quotaservice.AllowRequest")
 	proto.RegisterType((*AllowResponse)(nil), "quotaservice.AllowResponse")
+	proto.RegisterType((*AllowV2Response)(nil), "quotaservice.AllowV2Response")
+	proto.RegisterType((*Lease)(nil), "quotaservice.Lease")
+	proto.RegisterType((*AllowAllRequest)(nil), "quotaservice.AllowAllRequest")
+	proto.RegisterType((*BucketTokens)(nil), "quotaservice.BucketTokens")
+	proto.RegisterType((*ChargeRequest)(nil), "quotaservice.ChargeRequest")
+	proto.RegisterType((*ChargeResponse)(nil), "quotaservice.ChargeResponse")
+	proto.RegisterType((*ReconcileRequest)(nil), "quotaservice.ReconcileRequest")
+	proto.RegisterType((*BucketUsage)(nil), "quotaservice.BucketUsage")
+	proto.RegisterType((*ReconcileResponse)(nil), "quotaservice.ReconcileResponse")
+	proto.RegisterType((*BucketShare)(nil), "quotaservice.BucketShare")
 	proto.RegisterEnum("quotaservice.AllowResponse_Status", AllowResponse_Status_name, AllowResponse_Status_value)
+	proto.RegisterEnum("quotaservice.AllowV2Response_Reason", AllowV2Response_Reason_name, AllowV2Response_Reason_value)
+	proto.RegisterEnum("quotaservice.ChargeResponse_Status", ChargeResponse_Status_name, ChargeResponse_Status_value)
+	proto.RegisterEnum("quotaservice.ReconcileResponse_Status", ReconcileResponse_Status_name, ReconcileResponse_Status_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -179,6 +715,8 @@ const _ = grpc.SupportPackageIsVersion4
 
 type QuotaServiceClient interface {
 	Allow(ctx context.Context, in *AllowRequest, opts ...grpc.CallOption) (*AllowResponse, error)
+	Charge(ctx context.Context, in *ChargeRequest, opts ...grpc.CallOption) (*ChargeResponse, error)
+	Reconcile(ctx context.Context, in *ReconcileRequest, opts ...grpc.CallOption) (*ReconcileResponse, error)
 }
 
 type quotaServiceClient struct {
@@ -198,10 +736,30 @@ func (c *quotaServiceClient) Allow(ctx context.Context, in *AllowRequest, opts .
 	return out, nil
 }
 
+func (c *quotaServiceClient) Charge(ctx context.Context, in *ChargeRequest, opts ...grpc.CallOption) (*ChargeResponse, error) {
+	out := new(ChargeResponse)
+	err := grpc.Invoke(ctx, "/quotaservice.QuotaService/Charge", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quotaServiceClient) Reconcile(ctx context.Context, in *ReconcileRequest, opts ...grpc.CallOption) (*ReconcileResponse, error) {
+	out := new(ReconcileResponse)
+	err := grpc.Invoke(ctx, "/quotaservice.QuotaService/Reconcile", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for QuotaService service
 
 type QuotaServiceServer interface {
 	Allow(context.Context, *AllowRequest) (*AllowResponse, error)
+	Charge(context.Context, *ChargeRequest) (*ChargeResponse, error)
+	Reconcile(context.Context, *ReconcileRequest) (*ReconcileResponse, error)
 }
 
 func RegisterQuotaServiceServer(s *grpc.Server, srv QuotaServiceServer) {
@@ -226,6 +784,42 @@ func _QuotaService_Allow_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _QuotaService_Charge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChargeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotaServiceServer).Charge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quotaservice.QuotaService/Charge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotaServiceServer).Charge(ctx, req.(*ChargeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuotaService_Reconcile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReconcileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotaServiceServer).Reconcile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quotaservice.QuotaService/Reconcile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotaServiceServer).Reconcile(ctx, req.(*ReconcileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _QuotaService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "quotaservice.QuotaService",
 	HandlerType: (*QuotaServiceServer)(nil),
@@ -234,6 +828,119 @@ var _QuotaService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Allow",
 			Handler:    _QuotaService_Allow_Handler,
 		},
+		{
+			MethodName: "Charge",
+			Handler:    _QuotaService_Charge_Handler,
+		},
+		{
+			MethodName: "Reconcile",
+			Handler:    _QuotaService_Reconcile_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "protos/quota_service.proto",
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for QuotaServiceV2 service
+
+type QuotaServiceV2Client interface {
+	Allow(ctx context.Context, in *AllowRequest, opts ...grpc.CallOption) (*AllowV2Response, error)
+	AllowAll(ctx context.Context, in *AllowAllRequest, opts ...grpc.CallOption) (*AllowV2Response, error)
+}
+
+type quotaServiceV2Client struct {
+	cc *grpc.ClientConn
+}
+
+func NewQuotaServiceV2Client(cc *grpc.ClientConn) QuotaServiceV2Client {
+	return &quotaServiceV2Client{cc}
+}
+
+func (c *quotaServiceV2Client) Allow(ctx context.Context, in *AllowRequest, opts ...grpc.CallOption) (*AllowV2Response, error) {
+	out := new(AllowV2Response)
+	err := grpc.Invoke(ctx, "/quotaservice.QuotaServiceV2/Allow", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quotaServiceV2Client) AllowAll(ctx context.Context, in *AllowAllRequest, opts ...grpc.CallOption) (*AllowV2Response, error) {
+	out := new(AllowV2Response)
+	err := grpc.Invoke(ctx, "/quotaservice.QuotaServiceV2/AllowAll", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for QuotaServiceV2 service
+
+type QuotaServiceV2Server interface {
+	Allow(context.Context, *AllowRequest) (*AllowV2Response, error)
+	AllowAll(context.Context, *AllowAllRequest) (*AllowV2Response, error)
+}
+
+func RegisterQuotaServiceV2Server(s *grpc.Server, srv QuotaServiceV2Server) {
+	s.RegisterService(&_QuotaServiceV2_serviceDesc, srv)
+}
+
+func _QuotaServiceV2_Allow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AllowRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotaServiceV2Server).Allow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quotaservice.QuotaServiceV2/Allow",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotaServiceV2Server).Allow(ctx, req.(*AllowRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuotaServiceV2_AllowAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AllowAllRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotaServiceV2Server).AllowAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/quotaservice.QuotaServiceV2/AllowAll",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotaServiceV2Server).AllowAll(ctx, req.(*AllowAllRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _QuotaServiceV2_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "quotaservice.QuotaServiceV2",
+	HandlerType: (*QuotaServiceV2Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Allow",
+			Handler:    _QuotaServiceV2_Allow_Handler,
+		},
+		{
+			MethodName: "AllowAll",
+			Handler:    _QuotaServiceV2_AllowAll_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "protos/quota_service.proto",
@@ -242,33 +949,81 @@ var _QuotaService_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("protos/quota_service.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 433 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x7c, 0x92, 0xd1, 0x6e, 0xd3, 0x30,
-	0x18, 0x85, 0x97, 0x74, 0x8d, 0xd8, 0x4f, 0x37, 0xac, 0x1f, 0x36, 0x65, 0x65, 0x88, 0x2a, 0x12,
-	0xa8, 0xdc, 0x14, 0x69, 0xbb, 0x40, 0xe2, 0xae, 0x5b, 0x2d, 0x54, 0x4a, 0x13, 0xcd, 0x49, 0x87,
-	0xb8, 0xb2, 0xbc, 0xce, 0x42, 0xd6, 0x9a, 0xa6, 0x8b, 0xdd, 0x75, 0x4f, 0xc7, 0x53, 0xf0, 0x0c,
-	0x3c, 0x07, 0xaa, 0xe3, 0xa6, 0x43, 0x20, 0x6e, 0xbf, 0x73, 0xce, 0xaf, 0x9c, 0x13, 0x43, 0x7b,
-	0x51, 0x16, 0xa6, 0xd0, 0xef, 0xef, 0x96, 0x85, 0x11, 0x5c, 0xcb, 0xf2, 0x5e, 0x4d, 0x65, 0xcf,
-	0x42, 0x6c, 0x59, 0xe8, 0x58, 0xf4, 0xcb, 0x83, 0x56, 0x7f, 0x36, 0x2b, 0x56, 0x4c, 0xde, 0x2d,
-	0xa5, 0x36, 0x78, 0x02, 0x7b, 0x73, 0x91, 0x4b, 0xbd, 0x10, 0x53, 0x19, 0x7a, 0x1d, 0xaf, 0xbb,
-	0xc7, 0xb6, 0x00, 0x5f, 0xc3, 0xd3, 0xeb, 0xe5, 0xf4, 0x56, 0x1a, 0xbe, 0x66, 0xa1, 0x6f, 0x75,
-	0xa8, 0x50, 0x2c, 0x72, 0x89, 0xef, 0x80, 0x98, 0xe2, 0x56, 0xce, 0x35, 0x2f, 0xab, 0x83, 0xf2,
-	0x26, 0x6c, 0x74, 0xbc, 0x6e, 0x83, 0x3d, 0xab, 0x38, 0xdb, 0x60, 0xfc, 0x00, 0x61, 0x2e, 0x1e,
-	0xf8, 0x4a, 0x28, 0xc3, 0x73, 0x35, 0x9b, 0x29, 0xcd, 0x8b, 0x7b, 0x59, 0x96, 0xea, 0x46, 0x86,
-	0xbb, 0x36, 0x72, 0x98, 0x8b, 0x87, 0xaf, 0x42, 0x99, 0xb1, 0x55, 0x13, 0x27, 0xe2, 0x19, 0x1c,
-	0xd5, 0x41, 0xa3, 0x72, 0xb9, 0x8d, 0x35, 0x3b, 0x5e, 0xf7, 0x09, 0x7b, 0xee, 0x62, 0x99, 0xca,
-	0xe5, 0x26, 0x14, 0xfd, 0xf4, 0x61, 0xdf, 0x15, 0xd5, 0x8b, 0x62, 0xae, 0x25, 0x7e, 0x84, 0x40,
-	0x1b, 0x61, 0x96, 0xda, 0xd6, 0x3c, 0x38, 0x8d, 0x7a, 0x8f, 0x97, 0xe9, 0xfd, 0x61, 0xee, 0xa5,
-	0xd6, 0xc9, 0x5c, 0x02, 0xdf, 0xc0, 0x81, 0xab, 0xf9, 0xbd, 0x14, 0xf3, 0x75, 0x49, 0xdf, 0x7e,
-	0xf1, 0x7e, 0x45, 0x3f, 0x55, 0x70, 0x3d, 0xd7, 0xa3, 0x7a, 0x6e, 0x08, 0x58, 0xd5, 0x95, 0xa2,
-	0x1f, 0x1e, 0x04, 0xd5, 0x69, 0x0c, 0xc0, 0x4f, 0x46, 0x64, 0x07, 0x5f, 0x00, 0x61, 0xf4, 0x33,
-	0xbd, 0xc8, 0xe8, 0x80, 0x67, 0xc3, 0x31, 0x4d, 0x26, 0x19, 0xf1, 0xf0, 0x08, 0xb0, 0xa6, 0x71,
-	0xc2, 0xcf, 0x27, 0x17, 0x23, 0x9a, 0x11, 0x1f, 0x5f, 0xc1, 0xf1, 0xd6, 0x9d, 0x24, 0x7c, 0xdc,
-	0x8f, 0xbf, 0x39, 0x35, 0x25, 0x0d, 0x7c, 0x0b, 0xd1, 0xdf, 0x72, 0x96, 0x8c, 0x68, 0x9c, 0x72,
-	0x46, 0x2f, 0x27, 0x34, 0xcd, 0xe8, 0x80, 0xec, 0xe2, 0x09, 0x84, 0xb5, 0x6f, 0x18, 0x5f, 0xf5,
-	0xbf, 0x0c, 0x07, 0x1b, 0x9d, 0x34, 0xf1, 0x18, 0x0e, 0x6b, 0x35, 0xa5, 0xec, 0x8a, 0x32, 0x4e,
-	0x19, 0x4b, 0x18, 0x09, 0x4e, 0x19, 0xb4, 0x2e, 0xd7, 0xab, 0xa5, 0xd5, 0x6a, 0x78, 0x0e, 0x4d,
-	0x3b, 0x1c, 0xb6, 0xff, 0xb9, 0xa6, 0xfd, 0xf7, 0xed, 0x97, 0xff, 0x59, 0x3a, 0xda, 0xb9, 0x0e,
-	0xec, 0x43, 0x3d, 0xfb, 0x1d, 0x00, 0x00, 0xff, 0xff, 0x66, 0x09, 0x72, 0xac, 0xc6, 0x02, 0x00,
-	0x00,
+	// 1203 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xbc, 0x57, 0xdf, 0x6e, 0xe3, 0xc4,
+	0x17, 0x8e, 0x9d, 0xc4, 0x49, 0x4e, 0xda, 0xc4, 0x3b, 0xed, 0xf6, 0x97, 0x76, 0x77, 0x7f, 0x5b,
+	0x79, 0x61, 0xe9, 0x0a, 0x29, 0x85, 0x2c, 0x12, 0x68, 0x17, 0x21, 0x25, 0x8d, 0xa9, 0xb2, 0x4d,
+	0x93, 0xee, 0x24, 0xed, 0x0a, 0x2e, 0xb0, 0xa6, 0xc9, 0x90, 0x5a, 0x8d, 0xed, 0xd6, 0x63, 0xb7,
+	0xdd, 0x0b, 0x6e, 0x79, 0x06, 0x6e, 0xb8, 0xe1, 0x09, 0xb8, 0xe1, 0x86, 0x87, 0x40, 0xe2, 0x31,
+	0x40, 0x3c, 0x04, 0xf2, 0x8c, 0xed, 0x38, 0x7f, 0x9a, 0x45, 0xb0, 0x70, 0x97, 0xf9, 0xce, 0x39,
+	0xe3, 0x39, 0xe7, 0xfb, 0xfc, 0x8d, 0x03, 0x5b, 0x17, 0xae, 0xe3, 0x39, 0x6c, 0xf7, 0xd2, 0x77,
+	0x3c, 0x62, 0x30, 0xea, 0x5e, 0x99, 0x03, 0x5a, 0xe5, 0x20, 0x5a, 0xe1, 0x60, 0x88, 0x69, 0xdf,
+	0xcb, 0xb0, 0x52, 0x1f, 0x8f, 0x9d, 0x6b, 0x4c, 0x2f, 0x7d, 0xca, 0x3c, 0x74, 0x1f, 0x0a, 0x36,
+	0xb1, 0x28, 0xbb, 0x20, 0x03, 0x5a, 0x91, 0xb6, 0xa5, 0x9d, 0x02, 0x9e, 0x00, 0xe8, 0x21, 0x14,
+	0x4f, 0xfd, 0xc1, 0x39, 0xf5, 0x8c, 0x00, 0xab, 0xc8, 0x3c, 0x0e, 0x02, 0xea, 0x10, 0x8b, 0xa2,
+	0x27, 0xa0, 0x7a, 0xce, 0x39, 0xb5, 0x99, 0xe1, 0x8a, 0x0d, 0xe9, 0xb0, 0x92, 0xde, 0x96, 0x76,
+	0xd2, 0xb8, 0x2c, 0x70, 0x1c, 0xc1, 0xe8, 0x63, 0xa8, 0x58, 0xe4, 0xc6, 0xb8, 0x26, 0xa6, 0x67,
+	0x58, 0xe6, 0x78, 0x6c, 0x32, 0xc3, 0xb9, 0xa2, 0xae, 0x6b, 0x0e, 0x69, 0x25, 0xc3, 0x4b, 0xee,
+	0x5a, 0xe4, 0xe6, 0x15, 0x31, 0xbd, 0x43, 0x1e, 0xed, 0x86, 0x41, 0xf4, 0x14, 0x36, 0xe2, 0x42,
+	0xcf, 0xb4, 0xe8, 0xa4, 0x2c, 0xbb, 0x2d, 0xed, 0xe4, 0xf1, 0x5a, 0x58, 0xd6, 0x37, 0x2d, 0x1a,
+	0x17, 0x3d, 0x00, 0x08, 0x4f, 0x64, 0x98, 0xc3, 0x8a, 0x22, 0x1a, 0x0b, 0x91, 0xd6, 0x10, 0x6d,
+	0x80, 0xc2, 0x3c, 0xd7, 0x1c, 0x78, 0x95, 0x1c, 0xdf, 0x23, 0x5c, 0x69, 0xdf, 0x66, 0x60, 0x35,
+	0x9c, 0x0f, 0xbb, 0x70, 0x6c, 0x46, 0xd1, 0xb3, 0x20, 0x93, 0x78, 0x3e, 0xe3, 0xd3, 0x29, 0xd5,
+	0xb4, 0x6a, 0x72, 0xa0, 0xd5, 0xa9, 0xe4, 0x6a, 0x8f, 0x67, 0xe2, 0xb0, 0x02, 0xbd, 0x0b, 0xa5,
+	0x70, 0x3a, 0x23, 0x97, 0xd8, 0xc1, 0x6c, 0x64, 0xde, 0xe8, 0xaa, 0x40, 0xf7, 0x05, 0x18, 0x4c,
+	0x39, 0x31, 0x95, 0x70, 0x7e, 0x70, 0x1d, 0x4f, 0x02, 0xe9, 0x90, 0xb7, 0xa8, 0x47, 0x86, 0xc4,
+	0x23, 0x95, 0xcc, 0x76, 0x7a, 0xa7, 0x58, 0x7b, 0xb2, 0xec, 0x14, 0x87, 0x61, 0xae, 0x6e, 0x7b,
+	0xee, 0x6b, 0x1c, 0x97, 0x6e, 0x3d, 0x87, 0xd5, 0xa9, 0x10, 0x52, 0x21, 0x7d, 0x4e, 0x5f, 0x87,
+	0xb4, 0x07, 0x3f, 0xd1, 0x3a, 0x64, 0xaf, 0xc8, 0xd8, 0x8f, 0xa8, 0x16, 0x8b, 0x67, 0xf2, 0x27,
+	0x92, 0xf6, 0x87, 0x04, 0x8a, 0x68, 0x0f, 0x29, 0x20, 0x77, 0x0f, 0xd4, 0x14, 0x5a, 0x07, 0x15,
+	0xeb, 0x2f, 0xf4, 0xbd, 0xbe, 0xde, 0x34, 0xfa, 0xad, 0x43, 0xbd, 0x7b, 0xdc, 0x57, 0x25, 0xb4,
+	0x01, 0x28, 0x46, 0x3b, 0x5d, 0xa3, 0x71, 0xbc, 0x77, 0xa0, 0xf7, 0x55, 0x19, 0x3d, 0x80, 0xcd,
+	0x49, 0x76, 0xb7, 0x6b, 0x1c, 0xd6, 0x3b, 0x5f, 0x84, 0xd1, 0x9e, 0x9a, 0x46, 0x8f, 0x41, 0x9b,
+	0x0f, 0xf7, 0xbb, 0x07, 0x7a, 0xa7, 0x67, 0x60, 0xfd, 0xe5, 0xb1, 0xde, 0xeb, 0xeb, 0x4d, 0x35,
+	0x83, 0xee, 0x43, 0x25, 0xce, 0x6b, 0x75, 0x4e, 0xea, 0xed, 0x56, 0x33, 0x8a, 0xab, 0x59, 0xb4,
+	0x09, 0x77, 0xe3, 0x68, 0x4f, 0xc7, 0x27, 0x3a, 0x36, 0x74, 0x8c, 0xbb, 0x58, 0x55, 0xd0, 0xff,
+	0x60, 0x2d, 0x0e, 0x75, 0x4f, 0x74, 0xdc, 0xee, 0xd6, 0x9b, 0x7a, 0x53, 0xcd, 0xa1, 0x35, 0x28,
+	0xc7, 0x81, 0xa6, 0xde, 0x69, 0xe9, 0x4d, 0x35, 0xaf, 0xfd, 0x92, 0x81, 0x32, 0x9f, 0xea, 0x49,
+	0x2d, 0x96, 0x42, 0x05, 0x72, 0x11, 0x8f, 0x12, 0x57, 0x4d, 0xb4, 0x44, 0x9f, 0x82, 0xe2, 0x52,
+	0xc2, 0x1c, 0x9b, 0xcf, 0xad, 0x54, 0x7b, 0x67, 0x01, 0x3d, 0x93, 0x8d, 0xaa, 0x98, 0xe7, 0xe2,
+	0xb0, 0x26, 0xd8, 0xd7, 0xa2, 0x8c, 0x91, 0x11, 0xe5, 0xdc, 0x17, 0x70, 0xb4, 0x44, 0x4f, 0x20,
+	0x3b, 0xa6, 0x84, 0x89, 0x17, 0xa4, 0x58, 0x5b, 0x9b, 0xde, 0xb6, 0x1d, 0x84, 0xb0, 0xc8, 0x08,
+	0xde, 0x44, 0x97, 0x5a, 0xc4, 0xb4, 0x4d, 0x7b, 0x64, 0x08, 0x7d, 0xf1, 0xf7, 0x23, 0x8d, 0xcb,
+	0x31, 0xde, 0xe7, 0x30, 0xfa, 0x00, 0xd6, 0xcf, 0x08, 0x33, 0x62, 0x38, 0x4a, 0x57, 0x78, 0x53,
+	0xe8, 0x8c, 0x30, 0x3c, 0x53, 0xb1, 0x9f, 0x10, 0x60, 0x8e, 0x0b, 0xf0, 0xfd, 0xe5, 0x1d, 0xfe,
+	0x2b, 0x12, 0xfc, 0x59, 0x02, 0x45, 0x8c, 0x0e, 0x15, 0x21, 0xb7, 0x8f, 0xeb, 0x9d, 0x40, 0x12,
+	0x29, 0x54, 0x86, 0xe2, 0xe7, 0xf5, 0x56, 0x3b, 0xe0, 0xf5, 0x48, 0xef, 0xa8, 0x12, 0x52, 0x61,
+	0xa5, 0xde, 0x6e, 0x77, 0x5f, 0x19, 0xed, 0x16, 0x57, 0x8d, 0x1c, 0xe4, 0x47, 0x0a, 0x4d, 0xa3,
+	0x55, 0x28, 0x4c, 0x84, 0x99, 0x09, 0x64, 0x3c, 0xa7, 0xc7, 0x6c, 0x20, 0xd7, 0xdb, 0x65, 0xa8,
+	0x04, 0xa2, 0x99, 0x55, 0x5f, 0x0e, 0x95, 0x00, 0x12, 0xca, 0xca, 0x23, 0x00, 0x25, 0x14, 0x54,
+	0x41, 0xf3, 0x21, 0xcb, 0xf9, 0x0a, 0xac, 0x27, 0x9c, 0xb7, 0xc4, 0xe9, 0x09, 0x57, 0xb3, 0x2e,
+	0x20, 0xcf, 0xb9, 0xc0, 0x53, 0xd8, 0xb0, 0x1d, 0xcf, 0x38, 0xa5, 0x5f, 0x3b, 0x2e, 0x35, 0x7c,
+	0xdb, 0xbc, 0x99, 0x76, 0x8c, 0x35, 0xdb, 0xf1, 0x1a, 0x3c, 0x78, 0x6c, 0x9b, 0x37, 0xa2, 0x48,
+	0xfb, 0x49, 0x0a, 0x75, 0x5c, 0x1f, 0x8f, 0x23, 0xcf, 0xff, 0x08, 0x72, 0xc2, 0xc2, 0x83, 0x23,
+	0x04, 0x64, 0x6e, 0x4d, 0x93, 0xd9, 0xe0, 0x41, 0x41, 0x3d, 0x8e, 0x52, 0x97, 0xfa, 0xb7, 0xfc,
+	0xf7, 0xfc, 0x3b, 0x7d, 0xab, 0x7f, 0x6b, 0x37, 0xb0, 0x92, 0x3c, 0xc6, 0x7f, 0x77, 0x4f, 0x69,
+	0xdf, 0x49, 0xb0, 0xba, 0x77, 0x46, 0xdc, 0x11, 0x7d, 0x4b, 0x77, 0xe4, 0x7b, 0x50, 0x8e, 0x9f,
+	0x1d, 0x8c, 0x38, 0x7e, 0x74, 0x29, 0x7a, 0xb4, 0x40, 0x83, 0x9d, 0xc8, 0xc0, 0xf3, 0xc9, 0xd8,
+	0x18, 0x38, 0xcc, 0x0b, 0x2f, 0x45, 0x10, 0xd0, 0x9e, 0xc3, 0x3c, 0xed, 0x47, 0x09, 0x4a, 0xd1,
+	0xd1, 0x42, 0x4f, 0x7a, 0x3e, 0x73, 0x3d, 0x3d, 0x9a, 0xa6, 0x72, 0x3a, 0x7b, 0xe6, 0x7e, 0xd2,
+	0xc8, 0x9c, 0xa5, 0x2f, 0x36, 0x6f, 0x69, 0xa9, 0xeb, 0xca, 0xb7, 0xbb, 0x6e, 0x5a, 0xfb, 0x0a,
+	0x54, 0x4c, 0x07, 0x8e, 0x3d, 0x30, 0xc7, 0xf1, 0x3c, 0x37, 0x21, 0x4f, 0x46, 0xd4, 0xe6, 0x37,
+	0xb3, 0x18, 0x67, 0x8e, 0xaf, 0x5b, 0x43, 0xb4, 0x0b, 0x59, 0x9f, 0x1b, 0xa1, 0xcc, 0x85, 0xb9,
+	0xb9, 0x48, 0x98, 0xc7, 0x41, 0x02, 0x16, 0x79, 0x9a, 0x0f, 0xc5, 0x04, 0xfa, 0xf6, 0xa8, 0x1a,
+	0x38, 0x36, 0xf3, 0xad, 0x59, 0xaa, 0xf6, 0x42, 0x54, 0xfb, 0x55, 0x82, 0x3b, 0x89, 0xbe, 0x42,
+	0x32, 0x3e, 0x9b, 0x21, 0xe3, 0xf1, 0xf4, 0xf1, 0xe7, 0x0a, 0x66, 0xbf, 0x17, 0x3e, 0x04, 0x85,
+	0x9d, 0x11, 0x97, 0xb2, 0x65, 0xed, 0xf7, 0x82, 0x0c, 0x1c, 0x26, 0x6a, 0xad, 0x39, 0x0a, 0x97,
+	0x51, 0x25, 0xdd, 0x4e, 0x95, 0xac, 0x9d, 0x42, 0x31, 0xf1, 0x84, 0x7f, 0x3a, 0xca, 0x75, 0xc8,
+	0xf2, 0x23, 0xf2, 0x01, 0x4a, 0x58, 0x2c, 0x6a, 0xbf, 0x49, 0xb0, 0xf2, 0x32, 0xe8, 0xa9, 0x27,
+	0x7a, 0x42, 0x0d, 0xc8, 0x72, 0x7b, 0x42, 0x5b, 0x0b, 0xbf, 0x68, 0xb8, 0x60, 0xb6, 0xee, 0x2d,
+	0xf9, 0xda, 0xd1, 0x52, 0x48, 0x07, 0x45, 0xe8, 0x1c, 0xdd, 0x5b, 0xac, 0x7e, 0xb1, 0xcb, 0xfd,
+	0x65, 0xaf, 0x86, 0x96, 0x42, 0x1d, 0x28, 0xc4, 0x0c, 0xa1, 0xff, 0xdf, 0x4a, 0x9d, 0xd8, 0xec,
+	0xe1, 0x1b, 0xa8, 0xd5, 0x52, 0xb5, 0x1f, 0x24, 0x28, 0x25, 0x7b, 0x3d, 0xa9, 0xa1, 0xe6, 0x5f,
+	0xe9, 0xf6, 0xc1, 0xd2, 0xab, 0x55, 0x4b, 0xa1, 0x17, 0x90, 0x8f, 0x2c, 0x1d, 0x2d, 0x4a, 0x9e,
+	0x58, 0xfd, 0x1b, 0xf7, 0x6a, 0x7c, 0x03, 0x8f, 0x06, 0x8e, 0x55, 0xb5, 0x88, 0x6d, 0x9e, 0x33,
+	0xdf, 0xf5, 0x88, 0x6d, 0x4e, 0x97, 0xf0, 0x7f, 0x11, 0x8d, 0x3b, 0xc9, 0x46, 0x8e, 0x02, 0xe8,
+	0x48, 0xfa, 0xb2, 0x36, 0x32, 0xbd, 0x33, 0xff, 0xb4, 0x3a, 0x70, 0xac, 0x5d, 0x76, 0xe9, 0x13,
+	0x97, 0xee, 0x26, 0x4b, 0x77, 0x79, 0x29, 0x7b, 0x9e, 0xc4, 0x7e, 0x97, 0xa7, 0xe8, 0x3f, 0x55,
+	0x78, 0xce, 0xd3, 0x3f, 0x01, 0x00, 0x00, 0xff, 0xff, 0x03, 0x00, 0xd5, 0x4c, 0x3e, 0xcc, 0xc2,
+	0x0c, 0x00, 0x00,
 }
@@ -0,0 +1,517 @@
+// Code generated by protoc-gen-go.
+// source: protos/rlqs/rlqs.proto
+// DO NOT EDIT!
+
+/*
+Package rlqs is a generated protocol buffer package.
+
+It is generated from these files:
+	protos/rlqs/rlqs.proto
+
+It has these top-level messages:
+	RateLimitQuotaUsageReports
+	BucketQuotaUsage
+	BucketId
+	RateLimitQuotaResponse
+	BucketAction
+	QuotaAssignmentAction
+	AbandonAction
+	RateLimitStrategy
+	TokenBucket
+	UInt32Value
+	Duration
+*/
+package rlqs
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type RateLimitStrategy_BlanketRule int32
+
+const (
+	RateLimitStrategy_ALLOW_ALL RateLimitStrategy_BlanketRule = 0
+	RateLimitStrategy_DENY_ALL  RateLimitStrategy_BlanketRule = 1
+)
+
+var RateLimitStrategy_BlanketRule_name = map[int32]string{
+	0: "ALLOW_ALL",
+	1: "DENY_ALL",
+}
+var RateLimitStrategy_BlanketRule_value = map[string]int32{
+	"ALLOW_ALL": 0,
+	"DENY_ALL":  1,
+}
+
+func (x RateLimitStrategy_BlanketRule) String() string {
+	return proto.EnumName(RateLimitStrategy_BlanketRule_name, int32(x))
+}
+func (RateLimitStrategy_BlanketRule) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{7, 0}
+}
+
+type RateLimitQuotaUsageReports struct {
+	// *
+	// Only set in the first report on a stream.
+	Domain            string              `protobuf:"bytes,1,opt,name=domain" json:"domain,omitempty"`
+	BucketQuotaUsages []*BucketQuotaUsage `protobuf:"bytes,2,rep,name=bucket_quota_usages,json=bucketQuotaUsages" json:"bucket_quota_usages,omitempty"`
+}
+
+func (m *RateLimitQuotaUsageReports) Reset()                    { *m = RateLimitQuotaUsageReports{} }
+func (m *RateLimitQuotaUsageReports) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitQuotaUsageReports) ProtoMessage()               {}
+func (*RateLimitQuotaUsageReports) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *RateLimitQuotaUsageReports) GetDomain() string {
+	if m != nil {
+		return m.Domain
+	}
+	return ""
+}
+
+func (m *RateLimitQuotaUsageReports) GetBucketQuotaUsages() []*BucketQuotaUsage {
+	if m != nil {
+		return m.BucketQuotaUsages
+	}
+	return nil
+}
+
+// *
+// envoy.service.rate_limit_quota.v3.RateLimitQuotaUsageReports.BucketQuotaUsage
+type BucketQuotaUsage struct {
+	BucketId           *BucketId `protobuf:"bytes,1,opt,name=bucket_id,json=bucketId" json:"bucket_id,omitempty"`
+	TimeElapsed        *Duration `protobuf:"bytes,2,opt,name=time_elapsed,json=timeElapsed" json:"time_elapsed,omitempty"`
+	NumRequestsAllowed uint64    `protobuf:"varint,3,opt,name=num_requests_allowed,json=numRequestsAllowed" json:"num_requests_allowed,omitempty"`
+	NumRequestsDenied  uint64    `protobuf:"varint,4,opt,name=num_requests_denied,json=numRequestsDenied" json:"num_requests_denied,omitempty"`
+}
+
+func (m *BucketQuotaUsage) Reset()                    { *m = BucketQuotaUsage{} }
+func (m *BucketQuotaUsage) String() string            { return proto.CompactTextString(m) }
+func (*BucketQuotaUsage) ProtoMessage()               {}
+func (*BucketQuotaUsage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *BucketQuotaUsage) GetBucketId() *BucketId {
+	if m != nil {
+		return m.BucketId
+	}
+	return nil
+}
+
+func (m *BucketQuotaUsage) GetTimeElapsed() *Duration {
+	if m != nil {
+		return m.TimeElapsed
+	}
+	return nil
+}
+
+func (m *BucketQuotaUsage) GetNumRequestsAllowed() uint64 {
+	if m != nil {
+		return m.NumRequestsAllowed
+	}
+	return 0
+}
+
+func (m *BucketQuotaUsage) GetNumRequestsDenied() uint64 {
+	if m != nil {
+		return m.NumRequestsDenied
+	}
+	return 0
+}
+
+type BucketId struct {
+	Bucket map[string]string `protobuf:"bytes,1,rep,name=bucket" json:"bucket,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *BucketId) Reset()                    { *m = BucketId{} }
+func (m *BucketId) String() string            { return proto.CompactTextString(m) }
+func (*BucketId) ProtoMessage()               {}
+func (*BucketId) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *BucketId) GetBucket() map[string]string {
+	if m != nil {
+		return m.Bucket
+	}
+	return nil
+}
+
+type RateLimitQuotaResponse struct {
+	BucketAction []*BucketAction `protobuf:"bytes,1,rep,name=bucket_action,json=bucketAction" json:"bucket_action,omitempty"`
+}
+
+func (m *RateLimitQuotaResponse) Reset()                    { *m = RateLimitQuotaResponse{} }
+func (m *RateLimitQuotaResponse) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitQuotaResponse) ProtoMessage()               {}
+func (*RateLimitQuotaResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *RateLimitQuotaResponse) GetBucketAction() []*BucketAction {
+	if m != nil {
+		return m.BucketAction
+	}
+	return nil
+}
+
+// *
+// envoy.service.rate_limit_quota.v3.RateLimitQuotaResponse.BucketAction. Exactly one of
+// quota_assignment_action and abandon_action is set.
+type BucketAction struct {
+	BucketId              *BucketId              `protobuf:"bytes,1,opt,name=bucket_id,json=bucketId" json:"bucket_id,omitempty"`
+	QuotaAssignmentAction *QuotaAssignmentAction `protobuf:"bytes,2,opt,name=quota_assignment_action,json=quotaAssignmentAction" json:"quota_assignment_action,omitempty"`
+	AbandonAction         *AbandonAction         `protobuf:"bytes,3,opt,name=abandon_action,json=abandonAction" json:"abandon_action,omitempty"`
+}
+
+func (m *BucketAction) Reset()                    { *m = BucketAction{} }
+func (m *BucketAction) String() string            { return proto.CompactTextString(m) }
+func (*BucketAction) ProtoMessage()               {}
+func (*BucketAction) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *BucketAction) GetBucketId() *BucketId {
+	if m != nil {
+		return m.BucketId
+	}
+	return nil
+}
+
+func (m *BucketAction) GetQuotaAssignmentAction() *QuotaAssignmentAction {
+	if m != nil {
+		return m.QuotaAssignmentAction
+	}
+	return nil
+}
+
+func (m *BucketAction) GetAbandonAction() *AbandonAction {
+	if m != nil {
+		return m.AbandonAction
+	}
+	return nil
+}
+
+// *
+// envoy.service.rate_limit_quota.v3.RateLimitQuotaResponse.BucketAction.QuotaAssignmentAction
+type QuotaAssignmentAction struct {
+	AssignmentTimeToLive *Duration          `protobuf:"bytes,2,opt,name=assignment_time_to_live,json=assignmentTimeToLive" json:"assignment_time_to_live,omitempty"`
+	RateLimitStrategy    *RateLimitStrategy `protobuf:"bytes,3,opt,name=rate_limit_strategy,json=rateLimitStrategy" json:"rate_limit_strategy,omitempty"`
+}
+
+func (m *QuotaAssignmentAction) Reset()                    { *m = QuotaAssignmentAction{} }
+func (m *QuotaAssignmentAction) String() string            { return proto.CompactTextString(m) }
+func (*QuotaAssignmentAction) ProtoMessage()               {}
+func (*QuotaAssignmentAction) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *QuotaAssignmentAction) GetAssignmentTimeToLive() *Duration {
+	if m != nil {
+		return m.AssignmentTimeToLive
+	}
+	return nil
+}
+
+func (m *QuotaAssignmentAction) GetRateLimitStrategy() *RateLimitStrategy {
+	if m != nil {
+		return m.RateLimitStrategy
+	}
+	return nil
+}
+
+// *
+// envoy.service.rate_limit_quota.v3.RateLimitQuotaResponse.BucketAction.AbandonAction
+type AbandonAction struct {
+}
+
+func (m *AbandonAction) Reset()                    { *m = AbandonAction{} }
+func (m *AbandonAction) String() string            { return proto.CompactTextString(m) }
+func (*AbandonAction) ProtoMessage()               {}
+func (*AbandonAction) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+// *
+// envoy.type.v3.RateLimitStrategy. At most one of blanket_rule and token_bucket is set. Since
+// ALLOW_ALL is the zero value, it can't be sent.
+type RateLimitStrategy struct {
+	BlanketRule RateLimitStrategy_BlanketRule `protobuf:"varint,1,opt,name=blanket_rule,json=blanketRule,enum=envoy.service.rate_limit_quota.v3.RateLimitStrategy_BlanketRule" json:"blanket_rule,omitempty"`
+	TokenBucket *TokenBucket                  `protobuf:"bytes,3,opt,name=token_bucket,json=tokenBucket" json:"token_bucket,omitempty"`
+}
+
+func (m *RateLimitStrategy) Reset()                    { *m = RateLimitStrategy{} }
+func (m *RateLimitStrategy) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitStrategy) ProtoMessage()               {}
+func (*RateLimitStrategy) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *RateLimitStrategy) GetBlanketRule() RateLimitStrategy_BlanketRule {
+	if m != nil {
+		return m.BlanketRule
+	}
+	return RateLimitStrategy_ALLOW_ALL
+}
+
+func (m *RateLimitStrategy) GetTokenBucket() *TokenBucket {
+	if m != nil {
+		return m.TokenBucket
+	}
+	return nil
+}
+
+// *
+// envoy.type.v3.TokenBucket
+type TokenBucket struct {
+	MaxTokens     uint32       `protobuf:"varint,1,opt,name=max_tokens,json=maxTokens" json:"max_tokens,omitempty"`
+	TokensPerFill *UInt32Value `protobuf:"bytes,2,opt,name=tokens_per_fill,json=tokensPerFill" json:"tokens_per_fill,omitempty"`
+	FillInterval  *Duration    `protobuf:"bytes,3,opt,name=fill_interval,json=fillInterval" json:"fill_interval,omitempty"`
+}
+
+func (m *TokenBucket) Reset()                    { *m = TokenBucket{} }
+func (m *TokenBucket) String() string            { return proto.CompactTextString(m) }
+func (*TokenBucket) ProtoMessage()               {}
+func (*TokenBucket) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *TokenBucket) GetMaxTokens() uint32 {
+	if m != nil {
+		return m.MaxTokens
+	}
+	return 0
+}
+
+func (m *TokenBucket) GetTokensPerFill() *UInt32Value {
+	if m != nil {
+		return m.TokensPerFill
+	}
+	return nil
+}
+
+func (m *TokenBucket) GetFillInterval() *Duration {
+	if m != nil {
+		return m.FillInterval
+	}
+	return nil
+}
+
+// *
+// google.protobuf.UInt32Value
+type UInt32Value struct {
+	Value uint32 `protobuf:"varint,1,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *UInt32Value) Reset()                    { *m = UInt32Value{} }
+func (m *UInt32Value) String() string            { return proto.CompactTextString(m) }
+func (*UInt32Value) ProtoMessage()               {}
+func (*UInt32Value) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *UInt32Value) GetValue() uint32 {
+	if m != nil {
+		return m.Value
+	}
+	return 0
+}
+
+// *
+// google.protobuf.Duration
+type Duration struct {
+	Seconds int64 `protobuf:"varint,1,opt,name=seconds" json:"seconds,omitempty"`
+	Nanos   int32 `protobuf:"varint,2,opt,name=nanos" json:"nanos,omitempty"`
+}
+
+func (m *Duration) Reset()                    { *m = Duration{} }
+func (m *Duration) String() string            { return proto.CompactTextString(m) }
+func (*Duration) ProtoMessage()               {}
+func (*Duration) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *Duration) GetSeconds() int64 {
+	if m != nil {
+		return m.Seconds
+	}
+	return 0
+}
+
+func (m *Duration) GetNanos() int32 {
+	if m != nil {
+		return m.Nanos
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*RateLimitQuotaUsageReports)(nil), "envoy.service.rate_limit_quota.v3.RateLimitQuotaUsageReports")
+	proto.RegisterType((*BucketQuotaUsage)(nil), "envoy.service.rate_limit_quota.v3.BucketQuotaUsage")
+	proto.RegisterType((*BucketId)(nil), "envoy.service.rate_limit_quota.v3.BucketId")
+	proto.RegisterType((*RateLimitQuotaResponse)(nil), "envoy.service.rate_limit_quota.v3.RateLimitQuotaResponse")
+	proto.RegisterType((*BucketAction)(nil), "envoy.service.rate_limit_quota.v3.BucketAction")
+	proto.RegisterType((*QuotaAssignmentAction)(nil), "envoy.service.rate_limit_quota.v3.QuotaAssignmentAction")
+	proto.RegisterType((*AbandonAction)(nil), "envoy.service.rate_limit_quota.v3.AbandonAction")
+	proto.RegisterType((*RateLimitStrategy)(nil), "envoy.service.rate_limit_quota.v3.RateLimitStrategy")
+	proto.RegisterType((*TokenBucket)(nil), "envoy.service.rate_limit_quota.v3.TokenBucket")
+	proto.RegisterType((*UInt32Value)(nil), "envoy.service.rate_limit_quota.v3.UInt32Value")
+	proto.RegisterType((*Duration)(nil), "envoy.service.rate_limit_quota.v3.Duration")
+	proto.RegisterEnum("envoy.service.rate_limit_quota.v3.RateLimitStrategy_BlanketRule", RateLimitStrategy_BlanketRule_name, RateLimitStrategy_BlanketRule_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for RateLimitQuotaService service
+
+type RateLimitQuotaServiceClient interface {
+	StreamRateLimitQuotas(ctx context.Context, opts ...grpc.CallOption) (RateLimitQuotaService_StreamRateLimitQuotasClient, error)
+}
+
+type rateLimitQuotaServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewRateLimitQuotaServiceClient(cc *grpc.ClientConn) RateLimitQuotaServiceClient {
+	return &rateLimitQuotaServiceClient{cc}
+}
+
+func (c *rateLimitQuotaServiceClient) StreamRateLimitQuotas(ctx context.Context, opts ...grpc.CallOption) (RateLimitQuotaService_StreamRateLimitQuotasClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RateLimitQuotaService_serviceDesc.Streams[0], c.cc, "/envoy.service.rate_limit_quota.v3.RateLimitQuotaService/StreamRateLimitQuotas", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &rateLimitQuotaServiceStreamRateLimitQuotasClient{stream}
+	return x, nil
+}
+
+type RateLimitQuotaService_StreamRateLimitQuotasClient interface {
+	Send(*RateLimitQuotaUsageReports) error
+	Recv() (*RateLimitQuotaResponse, error)
+	grpc.ClientStream
+}
+
+type rateLimitQuotaServiceStreamRateLimitQuotasClient struct {
+	grpc.ClientStream
+}
+
+func (x *rateLimitQuotaServiceStreamRateLimitQuotasClient) Send(m *RateLimitQuotaUsageReports) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *rateLimitQuotaServiceStreamRateLimitQuotasClient) Recv() (*RateLimitQuotaResponse, error) {
+	m := new(RateLimitQuotaResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for RateLimitQuotaService service
+
+type RateLimitQuotaServiceServer interface {
+	StreamRateLimitQuotas(RateLimitQuotaService_StreamRateLimitQuotasServer) error
+}
+
+func RegisterRateLimitQuotaServiceServer(s *grpc.Server, srv RateLimitQuotaServiceServer) {
+	s.RegisterService(&_RateLimitQuotaService_serviceDesc, srv)
+}
+
+func _RateLimitQuotaService_StreamRateLimitQuotas_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RateLimitQuotaServiceServer).StreamRateLimitQuotas(&rateLimitQuotaServiceStreamRateLimitQuotasServer{stream})
+}
+
+type RateLimitQuotaService_StreamRateLimitQuotasServer interface {
+	Send(*RateLimitQuotaResponse) error
+	Recv() (*RateLimitQuotaUsageReports, error)
+	grpc.ServerStream
+}
+
+type rateLimitQuotaServiceStreamRateLimitQuotasServer struct {
+	grpc.ServerStream
+}
+
+func (x *rateLimitQuotaServiceStreamRateLimitQuotasServer) Send(m *RateLimitQuotaResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *rateLimitQuotaServiceStreamRateLimitQuotasServer) Recv() (*RateLimitQuotaUsageReports, error) {
+	m := new(RateLimitQuotaUsageReports)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _RateLimitQuotaService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "envoy.service.rate_limit_quota.v3.RateLimitQuotaService",
+	HandlerType: (*RateLimitQuotaServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRateLimitQuotas",
+			Handler:       _RateLimitQuotaService_StreamRateLimitQuotas_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "protos/rlqs/rlqs.proto",
+}
+
+func init() { proto.RegisterFile("protos/rlqs/rlqs.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 770 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x55, 0x51, 0x6b, 0xe3, 0x46,
+	0x10, 0x3e, 0xd9, 0x77, 0xa9, 0x3d, 0xb2, 0xef, 0xe2, 0x4d, 0x9c, 0x13, 0x81, 0x42, 0xaa, 0xbe,
+	0x98, 0x16, 0x74, 0xc1, 0x2e, 0xf4, 0xee, 0xa0, 0x50, 0x1f, 0x49, 0x69, 0xc0, 0xdc, 0x5d, 0x36,
+	0x4e, 0x42, 0x9f, 0xc4, 0xca, 0x9a, 0x06, 0x11, 0x69, 0x65, 0x6b, 0x57, 0x6e, 0xfc, 0x27, 0xfa,
+	0xd8, 0xd2, 0xe7, 0xfe, 0x82, 0xfe, 0x99, 0xbe, 0xf7, 0x57, 0xf4, 0xb5, 0x68, 0x77, 0x1d, 0xcb,
+	0x49, 0xa0, 0x72, 0xb8, 0x17, 0xa3, 0x6f, 0xc6, 0xdf, 0xf7, 0xcd, 0x8c, 0x66, 0x57, 0xb0, 0x37,
+	0xcd, 0x52, 0x99, 0x8a, 0x57, 0x59, 0x3c, 0xd3, 0x3f, 0x9e, 0x0a, 0x90, 0x2f, 0x90, 0xcf, 0xd3,
+	0x85, 0x27, 0x30, 0x9b, 0x47, 0x13, 0xf4, 0x32, 0x26, 0xd1, 0x8f, 0xa3, 0x24, 0x92, 0xfe, 0x2c,
+	0x4f, 0x25, 0xf3, 0xe6, 0x03, 0xf7, 0x0f, 0x0b, 0xf6, 0x29, 0x93, 0x38, 0x2a, 0xc2, 0xa7, 0x45,
+	0xf4, 0x5c, 0xb0, 0x2b, 0xa4, 0x38, 0x4d, 0x33, 0x29, 0xc8, 0x1e, 0x6c, 0x85, 0x69, 0xc2, 0x22,
+	0xee, 0x58, 0x07, 0x56, 0xaf, 0x49, 0x0d, 0x22, 0x13, 0xd8, 0x09, 0xf2, 0xc9, 0x35, 0x1a, 0x25,
+	0x3f, 0x2f, 0x48, 0xc2, 0xa9, 0x1d, 0xd4, 0x7b, 0x76, 0x7f, 0xe0, 0xfd, 0xaf, 0xaf, 0xf7, 0x4e,
+	0xb1, 0x4b, 0x86, 0x9d, 0xe0, 0x4e, 0x44, 0xb8, 0xbf, 0xd6, 0x60, 0xfb, 0xee, 0xff, 0xc8, 0x8f,
+	0xd0, 0x34, 0xce, 0x51, 0xa8, 0x8a, 0xb2, 0xfb, 0x5f, 0x57, 0xf6, 0x3b, 0x09, 0x69, 0x23, 0x30,
+	0x4f, 0xe4, 0x3d, 0xb4, 0x64, 0x94, 0xa0, 0x8f, 0x31, 0x9b, 0x0a, 0x0c, 0x9d, 0x5a, 0x65, 0xb1,
+	0xa3, 0x3c, 0x63, 0x32, 0x4a, 0x39, 0xb5, 0x0b, 0x81, 0x63, 0xcd, 0x27, 0x87, 0xb0, 0xcb, 0xf3,
+	0xc4, 0xcf, 0x70, 0x96, 0xa3, 0x90, 0xc2, 0x67, 0x71, 0x9c, 0xfe, 0x82, 0xa1, 0x53, 0x3f, 0xb0,
+	0x7a, 0x4f, 0x29, 0xe1, 0x79, 0x42, 0x4d, 0x6a, 0xa8, 0x33, 0xc4, 0x83, 0x9d, 0x35, 0x46, 0x88,
+	0x3c, 0xc2, 0xd0, 0x79, 0xaa, 0x08, 0x9d, 0x12, 0xe1, 0x48, 0x25, 0xdc, 0xdf, 0x2c, 0x68, 0x2c,
+	0x1b, 0x21, 0x1f, 0x60, 0x4b, 0xb7, 0xe2, 0x58, 0x6a, 0xea, 0xdf, 0x6e, 0x30, 0x05, 0xf3, 0x70,
+	0xcc, 0x65, 0xb6, 0xa0, 0x46, 0x66, 0xff, 0x0d, 0xd8, 0xa5, 0x30, 0xd9, 0x86, 0xfa, 0x35, 0x2e,
+	0xcc, 0x7b, 0x2f, 0x1e, 0xc9, 0x2e, 0x3c, 0x9b, 0xb3, 0x38, 0x47, 0x35, 0xa9, 0x26, 0xd5, 0xe0,
+	0x6d, 0xed, 0xb5, 0xe5, 0x72, 0xd8, 0x5b, 0x5f, 0x22, 0x8a, 0x62, 0x9a, 0x72, 0x81, 0x64, 0x0c,
+	0x6d, 0xf3, 0xba, 0xd8, 0xa4, 0x18, 0x99, 0x29, 0xf6, 0x55, 0xe5, 0x62, 0x87, 0x8a, 0x46, 0x5b,
+	0x41, 0x09, 0xb9, 0x7f, 0xd6, 0xa0, 0x55, 0x4e, 0x7f, 0xc2, 0xad, 0x98, 0xc2, 0x4b, 0x95, 0xf6,
+	0x99, 0x10, 0xd1, 0x15, 0x4f, 0x90, 0xdf, 0x96, 0xae, 0x17, 0xe4, 0x75, 0x05, 0x5d, 0x35, 0x83,
+	0xe1, 0xad, 0x80, 0xe9, 0xa1, 0x3b, 0x7b, 0x28, 0x4c, 0x2e, 0xe1, 0x39, 0x0b, 0x18, 0x0f, 0x53,
+	0xbe, 0x34, 0xaa, 0x2b, 0xa3, 0xc3, 0x0a, 0x46, 0x43, 0x4d, 0x34, 0x06, 0x6d, 0x56, 0x86, 0xee,
+	0x3f, 0x16, 0x74, 0x1f, 0xac, 0x84, 0x04, 0xf0, 0xb2, 0xd4, 0x9e, 0x3a, 0x05, 0x32, 0xf5, 0xe3,
+	0x68, 0x8e, 0x8f, 0x39, 0x05, 0xbb, 0x2b, 0xad, 0x71, 0x94, 0xe0, 0x38, 0x1d, 0x45, 0x73, 0x24,
+	0x21, 0xec, 0x94, 0x58, 0x42, 0x16, 0xe0, 0x6a, 0x61, 0x7a, 0xfb, 0xa6, 0x82, 0xfe, 0xed, 0x46,
+	0x9d, 0x19, 0x2e, 0xed, 0x64, 0x77, 0x43, 0xee, 0x0b, 0x68, 0xaf, 0xcd, 0xc0, 0xfd, 0xd7, 0x82,
+	0xce, 0x3d, 0x26, 0x99, 0x40, 0x2b, 0x88, 0x19, 0x2f, 0x16, 0x24, 0xcb, 0x63, 0x54, 0x2b, 0xf2,
+	0xbc, 0xff, 0xfd, 0x63, 0xaa, 0xf0, 0xde, 0x69, 0x21, 0x9a, 0xc7, 0x48, 0xed, 0x60, 0x05, 0xc8,
+	0x29, 0xb4, 0x64, 0x7a, 0x8d, 0xdc, 0x37, 0xe7, 0x52, 0xb7, 0xea, 0x55, 0x30, 0x19, 0x17, 0x34,
+	0xbd, 0x8c, 0xd4, 0x96, 0x2b, 0xe0, 0x7e, 0x05, 0x76, 0xc9, 0x8e, 0xb4, 0xa1, 0x39, 0x1c, 0x8d,
+	0x3e, 0x5c, 0xfa, 0xc3, 0xd1, 0x68, 0xfb, 0x09, 0x69, 0x41, 0xe3, 0xe8, 0xf8, 0xfd, 0x4f, 0x0a,
+	0x59, 0xee, 0xdf, 0x16, 0xd8, 0x25, 0x21, 0xf2, 0x39, 0x40, 0xc2, 0x6e, 0x7c, 0x25, 0x27, 0x54,
+	0xc7, 0x6d, 0xda, 0x4c, 0xd8, 0x8d, 0xfa, 0x8f, 0x20, 0x17, 0xf0, 0x42, 0xa7, 0xfc, 0x29, 0x66,
+	0xfe, 0xcf, 0x51, 0x1c, 0x3b, 0xb5, 0xca, 0x05, 0x9f, 0x9f, 0x70, 0x39, 0xe8, 0x5f, 0x14, 0x17,
+	0x00, 0x6d, 0x6b, 0x99, 0x8f, 0x98, 0xfd, 0x10, 0xc5, 0x31, 0xf9, 0x08, 0xed, 0x42, 0xcc, 0x8f,
+	0xb8, 0xc4, 0x6c, 0xce, 0x62, 0xa7, 0xbe, 0xf9, 0x46, 0xb5, 0x0a, 0x85, 0x13, 0x23, 0xe0, 0x7e,
+	0x09, 0x76, 0xc9, 0x6f, 0x75, 0x0d, 0xe9, 0x96, 0x34, 0x70, 0xdf, 0x42, 0x63, 0x49, 0x27, 0x0e,
+	0x7c, 0x26, 0x70, 0x92, 0xf2, 0x50, 0xb7, 0x5d, 0xa7, 0x4b, 0x58, 0x70, 0x39, 0xe3, 0xa9, 0x50,
+	0xad, 0x3e, 0xa3, 0x1a, 0xf4, 0xff, 0xb2, 0xa0, 0xbb, 0x7e, 0x7f, 0x9d, 0xe9, 0x2a, 0xc9, 0xef,
+	0x16, 0x74, 0xcf, 0x64, 0x86, 0x2c, 0x59, 0xcf, 0x0b, 0xf2, 0xdd, 0x26, 0xbb, 0x73, 0xef, 0xc3,
+	0xba, 0xff, 0x66, 0x63, 0xfa, 0xf2, 0x4a, 0x75, 0x9f, 0xf4, 0xac, 0x43, 0x2b, 0xd8, 0x52, 0x9f,
+	0xf8, 0xc1, 0x7f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x03, 0x00, 0xff, 0xa4, 0x17, 0x01, 0xfc, 0x07,
+	0x00, 0x00,
+}
@@ -0,0 +1,343 @@
+// Code generated by protoc-gen-go.
+// source: protos/rls/rls.proto
+// DO NOT EDIT!
+
+/*
+Package rls is a generated protocol buffer package.
+
+It is generated from these files:
+	protos/rls/rls.proto
+
+It has these top-level messages:
+	RateLimitRequest
+	RateLimitDescriptor
+	RateLimitDescriptorEntry
+	RateLimitResponse
+	DescriptorStatus
+	Duration
+*/
+package rls
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type RateLimitResponse_Code int32
+
+const (
+	RateLimitResponse_UNKNOWN    RateLimitResponse_Code = 0
+	RateLimitResponse_OK         RateLimitResponse_Code = 1
+	RateLimitResponse_OVER_LIMIT RateLimitResponse_Code = 2
+)
+
+var RateLimitResponse_Code_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "OK",
+	2: "OVER_LIMIT",
+}
+var RateLimitResponse_Code_value = map[string]int32{
+	"UNKNOWN":    0,
+	"OK":         1,
+	"OVER_LIMIT": 2,
+}
+
+func (x RateLimitResponse_Code) String() string {
+	return proto.EnumName(RateLimitResponse_Code_name, int32(x))
+}
+func (RateLimitResponse_Code) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{3, 0} }
+
+type RateLimitRequest struct {
+	Domain      string                 `protobuf:"bytes,1,opt,name=domain" json:"domain,omitempty"`
+	Descriptors []*RateLimitDescriptor `protobuf:"bytes,2,rep,name=descriptors" json:"descriptors,omitempty"`
+	// *
+	// Number of hits to add to each descriptor's limit. Treated as 1 if 0.
+	HitsAddend uint32 `protobuf:"varint,3,opt,name=hits_addend,json=hitsAddend" json:"hits_addend,omitempty"`
+}
+
+func (m *RateLimitRequest) Reset()                    { *m = RateLimitRequest{} }
+func (m *RateLimitRequest) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitRequest) ProtoMessage()               {}
+func (*RateLimitRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *RateLimitRequest) GetDomain() string {
+	if m != nil {
+		return m.Domain
+	}
+	return ""
+}
+
+func (m *RateLimitRequest) GetDescriptors() []*RateLimitDescriptor {
+	if m != nil {
+		return m.Descriptors
+	}
+	return nil
+}
+
+func (m *RateLimitRequest) GetHitsAddend() uint32 {
+	if m != nil {
+		return m.HitsAddend
+	}
+	return 0
+}
+
+// *
+// envoy.extensions.common.ratelimit.v3.RateLimitDescriptor
+type RateLimitDescriptor struct {
+	Entries []*RateLimitDescriptorEntry `protobuf:"bytes,1,rep,name=entries" json:"entries,omitempty"`
+}
+
+func (m *RateLimitDescriptor) Reset()                    { *m = RateLimitDescriptor{} }
+func (m *RateLimitDescriptor) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitDescriptor) ProtoMessage()               {}
+func (*RateLimitDescriptor) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *RateLimitDescriptor) GetEntries() []*RateLimitDescriptorEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+// *
+// envoy.extensions.common.ratelimit.v3.RateLimitDescriptor.Entry
+type RateLimitDescriptorEntry struct {
+	Key   string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *RateLimitDescriptorEntry) Reset()                    { *m = RateLimitDescriptorEntry{} }
+func (m *RateLimitDescriptorEntry) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitDescriptorEntry) ProtoMessage()               {}
+func (*RateLimitDescriptorEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *RateLimitDescriptorEntry) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *RateLimitDescriptorEntry) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+type RateLimitResponse struct {
+	OverallCode RateLimitResponse_Code `protobuf:"varint,1,opt,name=overall_code,json=overallCode,enum=envoy.service.ratelimit.v3.RateLimitResponse_Code" json:"overall_code,omitempty"`
+	Statuses    []*DescriptorStatus    `protobuf:"bytes,2,rep,name=statuses" json:"statuses,omitempty"`
+}
+
+func (m *RateLimitResponse) Reset()                    { *m = RateLimitResponse{} }
+func (m *RateLimitResponse) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitResponse) ProtoMessage()               {}
+func (*RateLimitResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *RateLimitResponse) GetOverallCode() RateLimitResponse_Code {
+	if m != nil {
+		return m.OverallCode
+	}
+	return RateLimitResponse_UNKNOWN
+}
+
+func (m *RateLimitResponse) GetStatuses() []*DescriptorStatus {
+	if m != nil {
+		return m.Statuses
+	}
+	return nil
+}
+
+// *
+// envoy.service.ratelimit.v3.RateLimitResponse.DescriptorStatus
+type DescriptorStatus struct {
+	Code               RateLimitResponse_Code `protobuf:"varint,1,opt,name=code,enum=envoy.service.ratelimit.v3.RateLimitResponse_Code" json:"code,omitempty"`
+	LimitRemaining     uint32                 `protobuf:"varint,3,opt,name=limit_remaining,json=limitRemaining" json:"limit_remaining,omitempty"`
+	DurationUntilReset *Duration              `protobuf:"bytes,4,opt,name=duration_until_reset,json=durationUntilReset" json:"duration_until_reset,omitempty"`
+}
+
+func (m *DescriptorStatus) Reset()                    { *m = DescriptorStatus{} }
+func (m *DescriptorStatus) String() string            { return proto.CompactTextString(m) }
+func (*DescriptorStatus) ProtoMessage()               {}
+func (*DescriptorStatus) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *DescriptorStatus) GetCode() RateLimitResponse_Code {
+	if m != nil {
+		return m.Code
+	}
+	return RateLimitResponse_UNKNOWN
+}
+
+func (m *DescriptorStatus) GetLimitRemaining() uint32 {
+	if m != nil {
+		return m.LimitRemaining
+	}
+	return 0
+}
+
+func (m *DescriptorStatus) GetDurationUntilReset() *Duration {
+	if m != nil {
+		return m.DurationUntilReset
+	}
+	return nil
+}
+
+// *
+// google.protobuf.Duration
+type Duration struct {
+	Seconds int64 `protobuf:"varint,1,opt,name=seconds" json:"seconds,omitempty"`
+	Nanos   int32 `protobuf:"varint,2,opt,name=nanos" json:"nanos,omitempty"`
+}
+
+func (m *Duration) Reset()                    { *m = Duration{} }
+func (m *Duration) String() string            { return proto.CompactTextString(m) }
+func (*Duration) ProtoMessage()               {}
+func (*Duration) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *Duration) GetSeconds() int64 {
+	if m != nil {
+		return m.Seconds
+	}
+	return 0
+}
+
+func (m *Duration) GetNanos() int32 {
+	if m != nil {
+		return m.Nanos
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*RateLimitRequest)(nil), "envoy.service.ratelimit.v3.RateLimitRequest")
+	proto.RegisterType((*RateLimitDescriptor)(nil), "envoy.service.ratelimit.v3.RateLimitDescriptor")
+	proto.RegisterType((*RateLimitDescriptorEntry)(nil), "envoy.service.ratelimit.v3.RateLimitDescriptorEntry")
+	proto.RegisterType((*RateLimitResponse)(nil), "envoy.service.ratelimit.v3.RateLimitResponse")
+	proto.RegisterType((*DescriptorStatus)(nil), "envoy.service.ratelimit.v3.DescriptorStatus")
+	proto.RegisterType((*Duration)(nil), "envoy.service.ratelimit.v3.Duration")
+	proto.RegisterEnum("envoy.service.ratelimit.v3.RateLimitResponse_Code", RateLimitResponse_Code_name, RateLimitResponse_Code_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for RateLimitService service
+
+type RateLimitServiceClient interface {
+	ShouldRateLimit(ctx context.Context, in *RateLimitRequest, opts ...grpc.CallOption) (*RateLimitResponse, error)
+}
+
+type rateLimitServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewRateLimitServiceClient(cc *grpc.ClientConn) RateLimitServiceClient {
+	return &rateLimitServiceClient{cc}
+}
+
+func (c *rateLimitServiceClient) ShouldRateLimit(ctx context.Context, in *RateLimitRequest, opts ...grpc.CallOption) (*RateLimitResponse, error) {
+	out := new(RateLimitResponse)
+	err := grpc.Invoke(ctx, "/envoy.service.ratelimit.v3.RateLimitService/ShouldRateLimit", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for RateLimitService service
+
+type RateLimitServiceServer interface {
+	ShouldRateLimit(context.Context, *RateLimitRequest) (*RateLimitResponse, error)
+}
+
+func RegisterRateLimitServiceServer(s *grpc.Server, srv RateLimitServiceServer) {
+	s.RegisterService(&_RateLimitService_serviceDesc, srv)
+}
+
+func _RateLimitService_ShouldRateLimit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RateLimitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitServiceServer).ShouldRateLimit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/envoy.service.ratelimit.v3.RateLimitService/ShouldRateLimit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitServiceServer).ShouldRateLimit(ctx, req.(*RateLimitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _RateLimitService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "envoy.service.ratelimit.v3.RateLimitService",
+	HandlerType: (*RateLimitServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ShouldRateLimit",
+			Handler:    _RateLimitService_ShouldRateLimit_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "protos/rls/rls.proto",
+}
+
+func init() { proto.RegisterFile("protos/rls/rls.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 477 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xa4, 0x93, 0xcd, 0x6e, 0xd3, 0x40,
+	0x10, 0xc7, 0xeb, 0x24, 0x4d, 0xca, 0x18, 0x52, 0x33, 0x44, 0xc8, 0xea, 0x85, 0xc8, 0x42, 0x22,
+	0x12, 0xc5, 0x95, 0x5c, 0x4e, 0xdc, 0xf8, 0x28, 0xa2, 0x6a, 0x49, 0xc4, 0x86, 0x94, 0xa3, 0x65,
+	0xb2, 0x23, 0xba, 0xc2, 0xdd, 0x0d, 0xbb, 0x6b, 0x4b, 0xb9, 0xf3, 0x1c, 0xbc, 0x18, 0x27, 0xde,
+	0x04, 0x79, 0x63, 0x87, 0x08, 0xd1, 0xaa, 0x11, 0x87, 0x48, 0xf9, 0xcf, 0xee, 0xff, 0xe7, 0xf9,
+	0xd8, 0x81, 0xc1, 0x42, 0x2b, 0xab, 0xcc, 0x91, 0xce, 0xdd, 0x2f, 0x76, 0x12, 0x0f, 0x48, 0x96,
+	0x6a, 0x19, 0x1b, 0xd2, 0xa5, 0x98, 0x53, 0xac, 0x33, 0x4b, 0xb9, 0xb8, 0x12, 0x36, 0x2e, 0x8f,
+	0xa3, 0x1f, 0x1e, 0x04, 0x2c, 0xb3, 0x74, 0x5e, 0x05, 0x18, 0x7d, 0x2b, 0xc8, 0x58, 0x7c, 0x08,
+	0x5d, 0xae, 0xae, 0x32, 0x21, 0x43, 0x6f, 0xe8, 0x8d, 0xee, 0xb0, 0x5a, 0xe1, 0x07, 0xf0, 0x39,
+	0x99, 0xb9, 0x16, 0x0b, 0xab, 0xb4, 0x09, 0x5b, 0xc3, 0xf6, 0xc8, 0x4f, 0x8e, 0xe2, 0xeb, 0xf1,
+	0xf1, 0x1a, 0xfd, 0x66, 0xed, 0x63, 0x9b, 0x0c, 0x7c, 0x04, 0xfe, 0xa5, 0xb0, 0x26, 0xcd, 0x38,
+	0x27, 0xc9, 0xc3, 0xf6, 0xd0, 0x1b, 0xdd, 0x63, 0x50, 0x85, 0x5e, 0xba, 0x48, 0x44, 0xf0, 0xe0,
+	0x1f, 0x10, 0x1c, 0x43, 0x8f, 0xa4, 0xd5, 0x82, 0x4c, 0xe8, 0xb9, 0x34, 0x9e, 0x6f, 0x99, 0xc6,
+	0x89, 0xb4, 0x7a, 0xc9, 0x1a, 0x48, 0xf4, 0x0a, 0xc2, 0xeb, 0x2e, 0x61, 0x00, 0xed, 0xaf, 0xb4,
+	0xac, 0x7b, 0x51, 0xfd, 0xc5, 0x01, 0xec, 0x96, 0x59, 0x5e, 0x50, 0xd8, 0x72, 0xb1, 0x95, 0x88,
+	0x7e, 0x79, 0x70, 0x7f, 0xa3, 0x97, 0x66, 0xa1, 0xa4, 0x21, 0x9c, 0xc1, 0x5d, 0x55, 0x92, 0xce,
+	0xf2, 0x3c, 0x9d, 0x2b, 0x4e, 0x0e, 0xd3, 0x4f, 0x92, 0x5b, 0xa5, 0xdb, 0x40, 0xe2, 0xd7, 0x8a,
+	0x13, 0xf3, 0x6b, 0x4e, 0x25, 0xf0, 0x1d, 0xec, 0x19, 0x9b, 0xd9, 0xc2, 0x50, 0x33, 0x88, 0xc3,
+	0x9b, 0x90, 0x7f, 0x6a, 0x9a, 0x3a, 0x17, 0x5b, 0xbb, 0xa3, 0xa7, 0xd0, 0x71, 0x44, 0x1f, 0x7a,
+	0xb3, 0xf1, 0xd9, 0x78, 0xf2, 0x69, 0x1c, 0xec, 0x60, 0x17, 0x5a, 0x93, 0xb3, 0xc0, 0xc3, 0x3e,
+	0xc0, 0xe4, 0xe2, 0x84, 0xa5, 0xe7, 0xa7, 0xef, 0x4f, 0x3f, 0x06, 0xad, 0xe8, 0xa7, 0x07, 0xc1,
+	0xdf, 0x2c, 0x7c, 0x0b, 0x9d, 0xff, 0x2c, 0xcd, 0xf9, 0xf1, 0x09, 0xec, 0xbb, 0x8b, 0xa9, 0xa6,
+	0xea, 0xbd, 0x09, 0xf9, 0xa5, 0x7e, 0x10, 0xfd, 0x7c, 0x65, 0xa9, 0xa3, 0x78, 0x01, 0x03, 0x5e,
+	0xe8, 0xcc, 0x0a, 0x25, 0xd3, 0x42, 0x5a, 0x91, 0xa7, 0x9a, 0x0c, 0xd9, 0xb0, 0x33, 0xf4, 0x46,
+	0x7e, 0xf2, 0xf8, 0xc6, 0x46, 0xd4, 0x3e, 0x86, 0x0d, 0x61, 0x56, 0x01, 0x58, 0xe5, 0x8f, 0x5e,
+	0xc0, 0x5e, 0x73, 0x8e, 0x21, 0xf4, 0x0c, 0xcd, 0x95, 0xe4, 0xc6, 0xd5, 0xd5, 0x66, 0x8d, 0xac,
+	0xa6, 0x2f, 0x33, 0xa9, 0x8c, 0x9b, 0xfe, 0x2e, 0x5b, 0x89, 0xe4, 0xfb, 0xe6, 0x26, 0x4d, 0x57,
+	0x9f, 0xc6, 0x05, 0xec, 0x4f, 0x2f, 0x55, 0x91, 0xf3, 0xf5, 0x09, 0x1e, 0xde, 0xb2, 0x3d, 0x6e,
+	0x15, 0x0f, 0x9e, 0x6d, 0xd5, 0xcc, 0x68, 0xe7, 0x73, 0xd7, 0xed, 0xfc, 0xf1, 0x6f, 0x00, 0x00,
+	0x00, 0xff, 0xff, 0x03, 0x00, 0x6f, 0x33, 0x30, 0x84, 0x0b, 0x04, 0x00, 0x00,
+}
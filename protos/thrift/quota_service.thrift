@@ -0,0 +1,43 @@
+/**
+ * Licensed under the Apache License, Version 2.0
+ * Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+ */
+
+/**
+ * The quota service's Allow API, for clients that use Thrift rather than gRPC. Mirrors
+ * protos/quota_service.proto; see it for details. Served by rpc/thrift, over the framed transport
+ * and binary protocol.
+ */
+namespace go quotaservice
+namespace java com.squareup.quotaservice.thrift
+
+enum AllowStatus {
+  OK = 0,
+  REJECTED_TIMEOUT = 1,
+  REJECTED_NO_BUCKET = 2,
+  REJECTED_TOO_MANY_BUCKETS = 3,
+  REJECTED_TOO_MANY_TOKENS_REQUESTED = 4,
+  REJECTED_INVALID_REQUEST = 5,
+  REJECTED_SERVER_ERROR = 6,
+  REJECTED_OVERLOADED = 7,
+  REJECTED_DENIED = 8
+}
+
+struct AllowRequest {
+  1: string namespace,
+  2: string bucket_name,
+  3: i64 tokens_requested,
+  4: i64 max_wait_millis_override,
+  5: bool max_wait_time_override,
+  6: string request_id
+}
+
+struct AllowResponse {
+  1: AllowStatus status,
+  2: i64 tokens_granted,
+  3: i64 wait_millis
+}
+
+service QuotaService {
+  AllowResponse allow(1: AllowRequest request)
+}
@@ -0,0 +1,102 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/square/quotaservice/config"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// quotaGroupMember is a bucket that draws tokens from a quota group's shared pool, while still
+// being tracked, and reported on in events and stats, under its own name.
+type quotaGroupMember struct {
+	DefaultBucket
+	bc  *bucketContainer
+	cfg *pbconfig.BucketConfig
+	dyn bool
+}
+
+func (m *quotaGroupMember) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	pool, err := m.pool()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return pool.Take(ctx, numTokens, maxWaitTime)
+}
+
+func (m *quotaGroupMember) Charge(ctx context.Context, numTokens int64) error {
+	pool, err := m.pool()
+	if err != nil {
+		return err
+	}
+
+	return pool.Charge(ctx, numTokens)
+}
+
+func (m *quotaGroupMember) Config() *pbconfig.BucketConfig {
+	return m.cfg
+}
+
+func (m *quotaGroupMember) Dynamic() bool {
+	return m.dyn
+}
+
+// pool looks up the shared pool on every call, rather than holding on to it, since it is replaced
+// whenever the quota group's configuration changes.
+func (m *quotaGroupMember) pool() (Bucket, error) {
+	m.bc.RLock()
+	pool := m.bc.quotaGroups[m.cfg.QuotaGroup]
+	m.bc.RUnlock()
+
+	if pool == nil {
+		return nil, fmt.Errorf("no such quota group %v", m.cfg.QuotaGroup)
+	}
+
+	return pool, nil
+}
+
+// newBucket creates a bucket, which draws from a quota group if one is configured, is sampled if a
+// sample rate is configured, and tracks its soft limit if one is configured. Quota group members
+// don't own any state, so this is safe to call while holding locks.
+func (bc *bucketContainer) newBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) Bucket {
+	var b Bucket
+	if cfg.QuotaGroup != "" {
+		b = &quotaGroupMember{bc: bc, cfg: cfg, dyn: dyn}
+	} else {
+		b = bc.bf.NewBucket(namespace, bucketName, cfg, dyn)
+	}
+
+	if cfg.GetSampleRate() > 1 && b != nil {
+		b = newSampledBucket(b, cfg.GetSampleRate())
+	}
+
+	if cfg.GetSoftLimitPercent() > 0 && cfg.QuotaGroup == "" && b != nil {
+		b = newSoftLimitedBucket(b, bc.bf.NewBucket(namespace, bucketName+SoftLimitBucketSuffix, softLimitConfig(cfg), dyn))
+	}
+
+	return b
+}
+
+// updateQuotaGroupsLocked creates, replaces or removes quota groups' shared pools to match the
+// given configs. Callers must hold a write lock.
+func (bc *bucketContainer) updateQuotaGroupsLocked(cfgs map[string]*pbconfig.BucketConfig) {
+	for name, pool := range bc.quotaGroups {
+		if newCfg, exists := cfgs[name]; !exists || config.DifferentBucketConfigs(pool.Config(), newCfg) {
+			pool.Destroy()
+			delete(bc.quotaGroups, name)
+		}
+	}
+
+	for name, cfg := range cfgs {
+		if _, exists := bc.quotaGroups[name]; !exists {
+			bc.quotaGroups[name] = bc.bf.NewBucket(config.QuotaGroupNamespace, name, cfg, false)
+		}
+	}
+}
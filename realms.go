@@ -0,0 +1,176 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/logging"
+)
+
+// RealmSeparator separates a realm from a namespace, in namespaces passed to a multi-realm server.
+// E.g. requests for namespace "payments/api" are served by namespace "api" in realm "payments".
+const RealmSeparator = "/"
+
+// Realm is an isolated configuration root hosted by a multi-realm server. Each realm has its own
+// config, persisted by its own persister, and its own buckets, created by its own bucket factory.
+type Realm struct {
+	Name          string
+	BucketFactory BucketFactory
+	Persister     config.ConfigPersister
+	ReaperConfig  config.ReaperConfig
+}
+
+// MultiRealmServer hosts several realms in one process, sharing RPC endpoints, so that one fleet
+// can serve many organizations without their configs affecting one another.
+type MultiRealmServer interface {
+	Start() (bool, error)
+	Stop() (bool, error)
+	// Realm returns the server for a realm, to configure it, e.g. with listeners or admins. Returns
+	// nil if there is no such realm.
+	Realm(name string) Server
+	// Realms returns the names of the realms hosted, sorted.
+	Realms() []string
+	// ServeAdminConsole serves each realm's admin API under /realms/<realm>/api/, scoped to that
+	// realm, and lists the realms at /realms. The admin web UI isn't served.
+	ServeAdminConsole(mux *http.ServeMux)
+}
+
+type multiRealmServer struct {
+	realms       map[string]*server
+	rpcEndpoints []RpcEndpoint
+}
+
+// NewMultiRealm creates a new server hosting realms. Requests are routed to realms by prefixing
+// namespaces with the realm's name and RealmSeparator.
+func NewMultiRealm(realms []Realm, maxCfgReloadJitterMs int, rpcEndpoints ...RpcEndpoint) MultiRealmServer {
+	if len(rpcEndpoints) == 0 {
+		panic("Need at least 1 RPC endpoint to run the quota service.")
+	}
+
+	if len(realms) == 0 {
+		panic("Need at least 1 realm to run a multi-realm quota service.")
+	}
+
+	m := &multiRealmServer{realms: make(map[string]*server, len(realms)), rpcEndpoints: rpcEndpoints}
+	for _, r := range realms {
+		if r.Name == "" || strings.Contains(r.Name, RealmSeparator) {
+			panic(fmt.Sprintf("Invalid realm name %q", r.Name))
+		}
+
+		if _, exists := m.realms[r.Name]; exists {
+			panic(fmt.Sprintf("Duplicate realm %q", r.Name))
+		}
+
+		// Realms don't serve RPCs themselves; the multi-realm server routes RPCs to them.
+		m.realms[r.Name] = newServer(r.BucketFactory, r.Persister, r.ReaperConfig, maxCfgReloadJitterMs, nil)
+	}
+
+	return m
+}
+
+func (m *multiRealmServer) Start() (bool, error) {
+	for _, name := range m.Realms() {
+		logging.Printf("Starting realm %v", name)
+		if _, err := m.realms[name].Start(); err != nil {
+			return false, err
+		}
+	}
+
+	logging.Printf("Starting RPC servers")
+	for _, rpcServer := range m.rpcEndpoints {
+		rpcServer.Init(m)
+		rpcServer.Start()
+	}
+	logging.Printf("Starting RPC servers: OK")
+
+	return true, nil
+}
+
+func (m *multiRealmServer) Stop() (bool, error) {
+	for _, rpcServer := range m.rpcEndpoints {
+		rpcServer.Stop()
+	}
+
+	for _, name := range m.Realms() {
+		if _, err := m.realms[name].Stop(); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (m *multiRealmServer) Realm(name string) Server {
+	if s, ok := m.realms[name]; ok {
+		return s
+	}
+
+	return nil
+}
+
+func (m *multiRealmServer) Realms() []string {
+	names := make([]string, 0, len(m.realms))
+	for name := range m.realms {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (m *multiRealmServer) ServeAdminConsole(mux *http.ServeMux) {
+	for name, s := range m.realms {
+		prefix := "/realms/" + name
+		realmMux := http.NewServeMux()
+		admin.ServeAdminConsole(s, realmMux, "", false)
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, realmMux))
+	}
+
+	mux.HandleFunc("/realms", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string][]string{"realms": m.Realms()})
+	})
+}
+
+// route splits a realm-qualified namespace into the realm's server and the namespace within it.
+func (m *multiRealmServer) route(namespace string) (*server, string, error) {
+	i := strings.Index(namespace, RealmSeparator)
+	if i < 0 {
+		return nil, "", newError(fmt.Sprintf("Namespace %v doesn't name a realm", namespace), ER_NO_BUCKET)
+	}
+
+	s, ok := m.realms[namespace[:i]]
+	if !ok {
+		return nil, "", newError(fmt.Sprintf("No such realm %v", namespace[:i]), ER_NO_BUCKET)
+	}
+
+	return s, namespace[i+len(RealmSeparator):], nil
+}
+
+func (m *multiRealmServer) Allow(ctx context.Context, namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (time.Duration, bool, error) {
+	s, namespace, err := m.route(namespace)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return s.Allow(ctx, namespace, name, tokensRequested, maxWaitMillisOverride, maxWaitTimeOverride)
+}
+
+func (m *multiRealmServer) Charge(ctx context.Context, namespace, name string, tokensReserved, actualCost int64) error {
+	s, namespace, err := m.route(namespace)
+	if err != nil {
+		return err
+	}
+
+	return s.Charge(ctx, namespace, name, tokensReserved, actualCost)
+}
@@ -0,0 +1,111 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	pb "github.com/square/quotaservice/protos/config"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+)
+
+func realmConfig(t *testing.T, namespace string) *pb.ServiceConfig {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig(namespace)
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("b")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+	return cfg
+}
+
+func TestMultiRealm(t *testing.T) {
+	acme, globex := &qstesting.MockBucketFactory{}, &qstesting.MockBucketFactory{}
+	endpoint := &qstesting.MockEndpoint{}
+	m := quotaservice.NewMultiRealm([]quotaservice.Realm{
+		{Name: "acme", BucketFactory: acme, Persister: config.NewMemoryConfig(realmConfig(t, "api")), ReaperConfig: qstesting.NewReaperConfig()},
+		{Name: "globex", BucketFactory: globex, Persister: config.NewMemoryConfig(realmConfig(t, "web")), ReaperConfig: qstesting.NewReaperConfig()}},
+		0, endpoint)
+	_, err := m.Start()
+	helpers.CheckError(t, err)
+	defer func() {
+		_, err := m.Stop()
+		helpers.CheckError(t, err)
+	}()
+
+	qs := endpoint.QuotaService
+	_, _, err = qs.Allow(context.Background(), "acme/api", "b", 1, 0, false)
+	helpers.CheckError(t, err)
+	_, _, err = qs.Allow(context.Background(), "globex/web", "b", 1, 0, false)
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, qs.Charge(context.Background(), "acme/api", "b", 1, 3))
+
+	if acme.Charged("api", "b") != 2 || globex.Charged("web", "b") != 0 {
+		t.Errorf("Expected only acme to be charged, got %v and %v", acme.Charged("api", "b"), globex.Charged("web", "b"))
+	}
+
+	// Realms don't see each other's namespaces.
+	for _, ns := range []string{"acme/web", "globex/api", "initech/api", "api"} {
+		_, _, err = qs.Allow(context.Background(), ns, "b", 1, 0, false)
+		if qsErr, ok := err.(quotaservice.QuotaServiceError); !ok || qsErr.Reason != quotaservice.ER_NO_BUCKET {
+			t.Errorf("Expected no bucket for %v, got %v", ns, err)
+		}
+	}
+
+	if names := m.Realms(); len(names) != 2 || names[0] != "acme" || names[1] != "globex" {
+		t.Errorf("Unexpected realms %v", names)
+	}
+
+	if m.Realm("acme").GetServerAdministrable().Configs().Namespaces["api"] == nil {
+		t.Error("Expected acme's config to have namespace api")
+	}
+
+	if m.Realm("initech") != nil {
+		t.Error("Expected no realm initech")
+	}
+}
+
+func TestMultiRealmAdmin(t *testing.T) {
+	m := quotaservice.NewMultiRealm([]quotaservice.Realm{
+		{Name: "acme", BucketFactory: &qstesting.MockBucketFactory{}, Persister: config.NewMemoryConfig(realmConfig(t, "api")), ReaperConfig: qstesting.NewReaperConfig()}},
+		0, &qstesting.MockEndpoint{})
+	_, err := m.Start()
+	helpers.CheckError(t, err)
+	defer func() {
+		_, err := m.Stop()
+		helpers.CheckError(t, err)
+	}()
+
+	mux := http.NewServeMux()
+	m.ServeAdminConsole(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/realms/acme/api/api", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %v: %v", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/realms", nil))
+	var rsp struct{ Realms []string }
+	helpers.CheckError(t, json.Unmarshal(rec.Body.Bytes(), &rsp))
+	if len(rsp.Realms) != 1 || rsp.Realms[0] != "acme" {
+		t.Errorf("Unexpected realms %v", rsp.Realms)
+	}
+}
+
+func TestMultiRealmInvalid(t *testing.T) {
+	helpers.ExpectingPanic(t, func() {
+		quotaservice.NewMultiRealm([]quotaservice.Realm{{Name: "a/b"}}, 0, &qstesting.MockEndpoint{})
+	})
+
+	helpers.ExpectingPanic(t, func() {
+		quotaservice.NewMultiRealm([]quotaservice.Realm{{Name: "a"}, {Name: "a"}}, 0, &qstesting.MockEndpoint{})
+	})
+}
@@ -166,10 +166,10 @@ func (r *reaper) reapIdleBuckets(bc *bucketContainer, newWatchers <-chan *watche
 // collection. Callers should ensure they point to the return value of this method when
 // referencing their bucket.
 func (r *reaper) applyWatch(delegate Bucket, namespace, bucketName string, cfg *pbconfig.BucketConfig) (Bucket, *watcher) {
-	if cfg.MaxIdleMillis > 0 {
+	if cfg.GetMaxIdleMillis() > 0 {
 		activityChannel := make(chan struct{}, 1)
 		rb := &reapableBucket{Bucket: delegate, activities: activityChannel}
-		w := createWatcher(namespace, bucketName, time.Duration(cfg.MaxIdleMillis)*time.Millisecond, activityChannel)
+		w := createWatcher(namespace, bucketName, time.Duration(cfg.GetMaxIdleMillis())*time.Millisecond, activityChannel)
 		r.newWatchers <- w
 		return rb, w
 	}
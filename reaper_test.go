@@ -7,17 +7,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice/config"
 	pbc "github.com/square/quotaservice/protos/config"
 )
 
 func TestNotReapable(t *testing.T) {
 	_, bc, r := reaperSetup()
-	tb := &MockBucket{}
+	tb := NewMockBucketFactory().NewBucket("x", "y", config.NewDefaultBucketConfig("y"), false)
 	b, _ := r.applyWatch(tb, "x", "y", config.NewDefaultBucketConfig("y"))
 
-	if _, ok := b.(*MockBucket); !ok {
-		t.Fatalf("OK is false; b is of type %T", b)
+	if b != tb {
+		t.Fatalf("Expected the bucket not to be watched, got %T", b)
 	}
 
 	reaperTeardown(bc)
@@ -89,22 +90,22 @@ func TestIdleAndActivity(t *testing.T) {
 }
 
 func createTestReapableBucket(maxIdle int64, bc *bucketContainer) (*reapableBucket, *watcher) {
-	tb := &MockBucket{}
 	c := config.NewDefaultBucketConfig("y")
-	c.MaxIdleMillis = maxIdle
+	c.MaxIdleMillis = proto.Int64(maxIdle)
+	tb := NewMockBucketFactory().NewBucket("x", "y", c, false)
 	b, w := bc.r.applyWatch(tb, "x", "y", c)
 	return b.(*reapableBucket), w
 }
 
 func createTestReapableBucketNoWatch() (*reapableBucket, <-chan struct{}) {
-	tb := &MockBucket{}
+	tb := NewMockBucketFactory().NewBucket("x", "y", config.NewDefaultBucketConfig("y"), false)
 	ch := make(chan struct{}, 1)
 	return &reapableBucket{Bucket: tb, activities: ch}, ch
 }
 
 func reaperSetup() (*pbc.ServiceConfig, *bucketContainer, *reaper) {
 	cfg := config.NewDefaultServiceConfig()
-	bc, _, _ := NewBucketContainerWithMocks(cfg)
+	bc, _ := NewBucketContainerWithMocks(cfg)
 	return cfg, bc, bc.r
 }
 
@@ -0,0 +1,182 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"sync"
+
+	"github.com/square/quotaservice/config"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// maxParallelNamespaceBuilds bounds the namespaces built concurrently when a config is applied.
+// Bucket factories may create buckets over the network, so this is not tied to the number of CPUs.
+const maxParallelNamespaceBuilds = 32
+
+// containerRebuild holds the state a bucket container switches to when a new config is applied.
+// It is built by rebuild without blocking requests, and swapped in by applyRebuild.
+type containerRebuild struct {
+	cfg           *pbconfig.ServiceConfig
+	namespaces    map[string]*namespace
+	defaultBucket Bucket
+	quotaGroups   map[string]Bucket
+
+	// Namespaces carried over from the current config, whose configs are swapped when the rebuild
+	// is applied.
+	carried map[*namespace]*pbconfig.NamespaceConfig
+	// Namespaces and buckets that are destroyed when the rebuild is applied.
+	replacedNamespaces []*namespace
+	replacedBuckets    []Bucket
+}
+
+// newNamespace creates a namespace and its static buckets, without adding it to the container.
+func (bc *bucketContainer) newNamespace(nsCfg *pbconfig.NamespaceConfig, serviceCfg *pbconfig.ServiceConfig) *namespace {
+	nsp := &namespace{n: bc.n, name: nsCfg.Name, cfg: nsCfg, serviceCfg: serviceCfg, buckets: make(map[string]Bucket)}
+	if nsCfg.DefaultBucket != nil {
+		defaultCfg := config.ResolveBucketConfig(serviceCfg, nsCfg, nsCfg.DefaultBucket)
+		nsp.defaultBucket = withBorrowing(bc.newBucket(nsCfg.Name, config.DefaultBucketName, defaultCfg, false), nsp, defaultCfg)
+	}
+
+	nsp.Lock()
+	defer nsp.Unlock()
+
+	for bucketName, bucketCfg := range nsCfg.Buckets {
+		bc.createNewNamedBucketFromCfg(nsCfg.Name, bucketName, nsp, bucketCfg, false)
+	}
+
+	return nsp
+}
+
+// rebuild builds the state for a new config alongside the current state, which keeps serving
+// requests. Namespaces whose configs have changed are built in parallel, while unchanged
+// namespaces, quota groups and default buckets are carried over along with their buckets' state.
+func (bc *bucketContainer) rebuild(newConfig *pbconfig.ServiceConfig) *containerRebuild {
+	bc.RLock()
+	currentCfg := bc.cfg
+	currentDefault := bc.defaultBucket
+	currentNamespaces := make(map[string]*namespace, len(bc.namespaces))
+	for name, ns := range bc.namespaces {
+		currentNamespaces[name] = ns
+	}
+	currentQuotaGroups := make(map[string]Bucket, len(bc.quotaGroups))
+	for name, pool := range bc.quotaGroups {
+		currentQuotaGroups[name] = pool
+	}
+	bc.RUnlock()
+
+	r := &containerRebuild{
+		cfg:         newConfig,
+		namespaces:  make(map[string]*namespace, len(newConfig.Namespaces)),
+		quotaGroups: make(map[string]Bucket, len(newConfig.QuotaGroups)),
+		carried:     make(map[*namespace]*pbconfig.NamespaceConfig)}
+
+	for name, pool := range currentQuotaGroups {
+		if newCfg, exists := newConfig.QuotaGroups[name]; exists && !config.DifferentBucketConfigs(pool.Config(), newCfg) {
+			r.quotaGroups[name] = pool
+		} else {
+			r.replacedBuckets = append(r.replacedBuckets, pool)
+		}
+	}
+
+	for name, cfg := range newConfig.QuotaGroups {
+		if _, exists := r.quotaGroups[name]; !exists {
+			r.quotaGroups[name] = bc.bf.NewBucket(config.QuotaGroupNamespace, name, cfg, false)
+		}
+	}
+
+	// Start with the global default bucket.
+	var currentDefaultBucketCfg *pbconfig.BucketConfig
+	if currentDefault != nil {
+		currentDefaultBucketCfg = currentDefault.Config()
+	}
+
+	r.defaultBucket = currentDefault
+	newDefaultBucketCfg := config.ResolveBucketTemplate(newConfig, newConfig.GlobalDefaultBucket)
+	globalDefaultChanged := config.DifferentBucketConfigs(currentDefaultBucketCfg, newDefaultBucketCfg)
+	if globalDefaultChanged {
+		if currentDefault != nil {
+			// We need to destroy existing buckets even if we are replacing them.
+			r.replacedBuckets = append(r.replacedBuckets, currentDefault)
+		}
+
+		r.defaultBucket = nil
+		if newConfig.GlobalDefaultBucket != nil {
+			r.defaultBucket = bc.newBucket(config.GlobalNamespace, config.DefaultBucketName, newDefaultBucketCfg, false)
+		}
+	}
+
+	// Namespaces whose configs haven't changed are carried over, keeping their dynamic buckets. If
+	// a namespace's config *has* changed, it is rebuilt. We *could* scan all the buckets in a
+	// namespace and only recreate the ones that have changed, but this may have little benefit,
+	// since the real cost here is with dynamic buckets, and if the namespace config has changed,
+	// it's very likely that the change involves the dynamic bucket template.
+	changedTemplates := config.ChangedBucketTemplates(currentCfg, newConfig)
+	var toBuild []*pbconfig.NamespaceConfig
+	for name, newNsCfg := range newConfig.Namespaces {
+		ns, exists := currentNamespaces[name]
+		// Namespaces that inherit defaults also change with the global default bucket.
+		if exists && !config.DifferentNamespaceConfigs(ns.cfg, newNsCfg) && !config.UsesBucketTemplates(newNsCfg, changedTemplates) &&
+			!(newNsCfg.InheritDefaults && globalDefaultChanged) {
+			r.namespaces[name] = ns
+			r.carried[ns] = newNsCfg
+			continue
+		}
+
+		toBuild = append(toBuild, newNsCfg)
+	}
+
+	for _, ns := range currentNamespaces {
+		if _, carried := r.carried[ns]; !carried {
+			r.replacedNamespaces = append(r.replacedNamespaces, ns)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sem := make(chan struct{}, maxParallelNamespaceBuilds)
+	for _, nsCfg := range toBuild {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(nsCfg *pbconfig.NamespaceConfig) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ns := bc.newNamespace(nsCfg, newConfig)
+			mu.Lock()
+			r.namespaces[nsCfg.Name] = ns
+			mu.Unlock()
+		}(nsCfg)
+	}
+	wg.Wait()
+
+	return r
+}
+
+// applyRebuild atomically swaps in state built by rebuild, and destroys the buckets it replaces.
+// Replaced buckets are destroyed before the lock is released, so that buckets created from the new
+// config never share state with them.
+func (bc *bucketContainer) applyRebuild(r *containerRebuild) {
+	bc.Lock()
+	defer bc.Unlock()
+
+	bc.cfg = r.cfg
+	bc.namespaces = r.namespaces
+	bc.defaultBucket = r.defaultBucket
+	bc.quotaGroups = r.quotaGroups
+
+	for ns, nsCfg := range r.carried {
+		// Just correct the config pointer on the old namespace
+		ns.swapCfg(nsCfg, r.cfg)
+	}
+
+	for _, ns := range r.replacedNamespaces {
+		ns.destroy()
+	}
+
+	for _, b := range r.replacedBuckets {
+		b.Destroy()
+	}
+}
@@ -0,0 +1,104 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	pbconfig "github.com/square/quotaservice/protos/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func newRebuildTestConfig(version int32, namespaces ...string) *pbconfig.ServiceConfig {
+	c := config.NewDefaultServiceConfig()
+	c.Version = version
+	for _, name := range namespaces {
+		ns := config.NewDefaultNamespaceConfig(name)
+		ns.DynamicBucketTemplate = config.NewDefaultBucketConfig(config.DynamicBucketTemplateName)
+		helpers.PanicError(config.AddBucket(ns, config.NewDefaultBucketConfig("b")))
+		helpers.PanicError(config.AddNamespace(c, ns))
+	}
+
+	return c
+}
+
+func TestRebuildCarriesOverUnchangedNamespaces(t *testing.T) {
+	bc, _ := NewBucketContainerWithMocks(newRebuildTestConfig(1, "same", "changed", "removed"))
+
+	same, _ := bc.FindBucket("same", "dyn")
+	changed, _ := bc.FindBucket("changed", "b")
+
+	newCfg := newRebuildTestConfig(2, "same", "changed", "added")
+	newCfg.Namespaces["changed"].MaxDynamicBuckets = 10
+	bc.applyRebuild(bc.rebuild(newCfg))
+
+	if b, _ := bc.FindBucket("same", "dyn"); b != same {
+		t.Fatal("Expected dynamic buckets in unchanged namespaces to be carried over")
+	}
+
+	if bc.namespaces["same"].cfg != newCfg.Namespaces["same"] || bc.namespaces["same"].serviceCfg != newCfg {
+		t.Fatal("Expected carried over namespaces to point to the new config")
+	}
+
+	if b, _ := bc.FindBucket("changed", "b"); b == nil || b == changed {
+		t.Fatal("Expected buckets in changed namespaces to be rebuilt")
+	}
+
+	if !bc.Exists("added", "b") || bc.NamespaceExists("removed") {
+		t.Fatalf("Expected namespaces to be added and removed, got %v", bc)
+	}
+}
+
+// blockingBucketFactory blocks creating buckets in the "slow" namespace until released.
+type blockingBucketFactory struct {
+	MockBucketFactory
+	release chan struct{}
+}
+
+func (bf *blockingBucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) Bucket {
+	if namespace == "slow" {
+		<-bf.release
+	}
+
+	return bf.MockBucketFactory.NewBucket(namespace, bucketName, cfg, dyn)
+}
+
+func TestRebuildDoesNotBlockRequests(t *testing.T) {
+	bf := &blockingBucketFactory{MockBucketFactory: NewMockBucketFactory(), release: make(chan struct{})}
+	bc := NewBucketContainer(bf, NewMockEmitter(), NewReaperConfigForTests())
+	bc.Init(newRebuildTestConfig(1, "fast"))
+
+	rebuilt := make(chan *containerRebuild)
+	go func() {
+		rebuilt <- bc.rebuild(newRebuildTestConfig(2, "fast", "slow"))
+	}()
+
+	found := make(chan Bucket)
+	go func() {
+		b, _ := bc.FindBucket("fast", "b")
+		found <- b
+	}()
+
+	select {
+	case b := <-found:
+		if b == nil {
+			t.Fatal("Expected to find a bucket while buckets are being built")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Requests blocked while buckets were being built")
+	}
+
+	if bc.NamespaceExists("slow") {
+		t.Fatal("Expected new namespaces to be hidden until the rebuild is applied")
+	}
+
+	close(bf.release)
+	bc.applyRebuild(<-rebuilt)
+
+	if !bc.Exists("slow", "b") {
+		t.Fatal("Expected the new namespace once the rebuild is applied")
+	}
+}
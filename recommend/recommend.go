@@ -0,0 +1,252 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package recommend suggests bucket fill rates and sizes from observed traffic, for services that
+// are being onboarded without a good idea of what limits to set.
+package recommend
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos/config"
+)
+
+// Config configures how traffic is recorded, and how recommendations are derived from it.
+type Config struct {
+	// Interval is the granularity at which the tokens requested from each bucket are recorded.
+	Interval time.Duration
+	// Window is how much traffic history is kept for each bucket.
+	Window time.Duration
+	// Percentile of the per-interval request rates that a bucket's fill rate should sustain,
+	// between 0 and 1.
+	Percentile float64
+	// Headroom multiplies observed rates, so that limits aren't set exactly at observed traffic.
+	Headroom float64
+	// MinSamples is the number of intervals a bucket must have been observed for before a
+	// recommendation is made for it.
+	MinSamples int
+}
+
+// NewDefaultConfig returns a config recommending 1.5 times the p99 of per-second request rates
+// over the last hour, once a bucket has been observed for at least 5 minutes.
+func NewDefaultConfig() Config {
+	return Config{
+		Interval:   time.Second,
+		Window:     time.Hour,
+		Percentile: 0.99,
+		Headroom:   1.5,
+		MinSamples: 300}
+}
+
+type bucketKey struct {
+	namespace, bucket string
+}
+
+// bucketTraffic records the tokens requested from a bucket in each interval of the window.
+type bucketTraffic struct {
+	dynamic bool
+	// firstSeen is the interval the bucket was first seen in.
+	firstSeen int64
+	// intervals holds, for each slot, the interval it was last used for.
+	intervals []int64
+	tokens    []int64
+}
+
+// Recorder records the tokens requested from each bucket, and recommends fill rates and sizes
+// from them. Its HandleEvent function is an events.Listener.
+type Recorder struct {
+	cfg     Config
+	slots   int
+	buckets map[bucketKey]*bucketTraffic
+	now     func() time.Time
+	sync.Mutex
+}
+
+// NewRecorder creates a Recorder.
+func NewRecorder(cfg Config) *Recorder {
+	if cfg.Interval <= 0 || cfg.Window < cfg.Interval {
+		panic("Window must be at least one positive interval")
+	}
+
+	if cfg.Percentile <= 0 || cfg.Percentile > 1 {
+		panic("Percentile must be between 0 and 1")
+	}
+
+	if cfg.Headroom < 1 {
+		cfg.Headroom = 1
+	}
+
+	return &Recorder{
+		cfg:     cfg,
+		slots:   int(cfg.Window / cfg.Interval),
+		buckets: make(map[bucketKey]*bucketTraffic),
+		now:     time.Now}
+}
+
+// HandleEvent is an events.Listener. Tokens both served and rejected for timing out count towards
+// a bucket's traffic, since rejected requests are demand that the current limits don't meet.
+func (r *Recorder) HandleEvent(event events.Event) {
+	switch event.EventType() {
+	case events.EVENT_TOKENS_SERVED, events.EVENT_TIMEOUT_SERVING_TOKENS:
+	default:
+		return
+	}
+
+	interval := r.now().UnixNano() / int64(r.cfg.Interval)
+	key := bucketKey{event.Namespace(), event.BucketName()}
+
+	r.Lock()
+	defer r.Unlock()
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucketTraffic{
+			dynamic:   event.Dynamic(),
+			firstSeen: interval,
+			intervals: make([]int64, r.slots),
+			tokens:    make([]int64, r.slots)}
+		r.buckets[key] = b
+	}
+
+	slot := interval % int64(r.slots)
+	if b.intervals[slot] != interval {
+		b.intervals[slot] = interval
+		b.tokens[slot] = 0
+	}
+
+	b.tokens[slot] += event.NumTokens()
+}
+
+// observed returns the number of intervals a bucket has been observed for, the configured
+// percentile of its tokens requested per second, and the most tokens requested in an interval.
+func (r *Recorder) observed(b *bucketTraffic, now int64) (samples int, rate float64, peak int64) {
+	samples = int(now - b.firstSeen + 1)
+	if samples > r.slots {
+		samples = r.slots
+	}
+
+	// Intervals without requests count as zero.
+	perInterval := make([]int64, samples)
+	for i := range perInterval {
+		interval := now - int64(i)
+		slot := interval % int64(r.slots)
+		if b.intervals[slot] == interval {
+			perInterval[i] = b.tokens[slot]
+		}
+	}
+
+	sort.Slice(perInterval, func(i, j int) bool { return perInterval[i] < perInterval[j] })
+	idx := int(math.Ceil(r.cfg.Percentile*float64(samples))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+
+	return samples, float64(perInterval[idx]) / r.cfg.Interval.Seconds(), perInterval[samples-1]
+}
+
+// Recommend suggests fill rates and sizes for the buckets in cfg that have seen enough traffic.
+// Recommendations for a namespace's dynamic buckets apply to its dynamic bucket template, and
+// accommodate its busiest dynamic bucket. Buckets that draw from quota groups, and requests served
+// by default buckets, are ignored. Only buckets whose settings would change are reported.
+func (r *Recorder) Recommend(cfg *pb.ServiceConfig) *admin.RecommendationReport {
+	now := r.now().UnixNano() / int64(r.cfg.Interval)
+	candidate := config.CloneConfig(cfg)
+	recommendations := make(map[string]*admin.Recommendation)
+
+	r.Lock()
+	for key, b := range r.buckets {
+		namespace, bucketName := key.namespace, key.bucket
+		ns := cfg.Namespaces[namespace]
+		if ns == nil {
+			continue
+		}
+
+		bCfg := ns.Buckets[bucketName]
+		if bCfg == nil {
+			if !b.dynamic || ns.DynamicBucketTemplate == nil {
+				continue
+			}
+
+			bucketName = config.DynamicBucketTemplateName
+			bCfg = ns.DynamicBucketTemplate
+		}
+
+		if bCfg.QuotaGroup != "" {
+			continue
+		}
+
+		samples, rate, peak := r.observed(b, now)
+		if samples < r.cfg.MinSamples {
+			continue
+		}
+
+		target := config.FullyQualifiedName(namespace, bucketName)
+		rec, exists := recommendations[target]
+		if !exists {
+			current := config.ResolveBucketConfig(cfg, ns, bCfg)
+			rec = &admin.Recommendation{
+				Namespace:       namespace,
+				Bucket:          bucketName,
+				CurrentFillRate: current.GetFillRate(),
+				CurrentSize:     current.GetSize()}
+			recommendations[target] = rec
+		}
+
+		// Dynamic buckets share a template, which must accommodate the busiest of them.
+		if rate >= rec.ObservedRate {
+			rec.Samples = samples
+			rec.ObservedRate = rate
+		}
+
+		if peak > rec.PeakTokens {
+			rec.PeakTokens = peak
+		}
+	}
+	r.Unlock()
+
+	report := &admin.RecommendationReport{Recommendations: []*admin.Recommendation{}, Candidate: candidate}
+	for _, rec := range recommendations {
+		rec.FillRate = int64(math.Ceil(rec.ObservedRate * r.cfg.Headroom))
+		if rec.FillRate < 1 {
+			rec.FillRate = 1
+		}
+
+		// Size the bucket to absorb the largest burst seen, and at least a second's worth of tokens.
+		rec.Size = int64(math.Ceil(float64(rec.PeakTokens) * r.cfg.Headroom))
+		if rec.Size < rec.FillRate {
+			rec.Size = rec.FillRate
+		}
+
+		if rec.FillRate == rec.CurrentFillRate && rec.Size == rec.CurrentSize {
+			continue
+		}
+
+		ns := candidate.Namespaces[rec.Namespace]
+		bCfg := ns.Buckets[rec.Bucket]
+		if rec.Bucket == config.DynamicBucketTemplateName {
+			bCfg = ns.DynamicBucketTemplate
+		}
+
+		bCfg.FillRate = proto.Int64(rec.FillRate)
+		bCfg.Size = proto.Int64(rec.Size)
+		report.Recommendations = append(report.Recommendations, rec)
+	}
+
+	sort.Slice(report.Recommendations, func(i, j int) bool {
+		a, b := report.Recommendations[i], report.Recommendations[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+
+		return a.Bucket < b.Bucket
+	})
+
+	return report
+}
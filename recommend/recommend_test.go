@@ -0,0 +1,158 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package recommend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func testConfig(t *testing.T) *pb.ServiceConfig {
+	cfg := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, config.AddBucket(ns, config.NewDefaultBucketConfig("static")))
+	grouped := config.NewDefaultBucketConfig("grouped")
+	grouped.QuotaGroup = "group"
+	helpers.CheckError(t, config.AddBucket(ns, grouped))
+	config.SetDynamicBucketTemplate(ns, config.NewDefaultBucketConfig(""))
+	helpers.CheckError(t, config.AddNamespace(cfg, ns))
+	return cfg
+}
+
+func newTestRecorder() (*Recorder, *time.Time) {
+	r := NewRecorder(Config{
+		Interval:   time.Second,
+		Window:     100 * time.Second,
+		Percentile: 0.9,
+		Headroom:   2,
+		MinSamples: 10})
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+func TestRecommend(t *testing.T) {
+	r, now := newTestRecorder()
+
+	// 20 seconds at 10 tokens/sec, with a single second at 50.
+	for i := 0; i < 20; i++ {
+		tokens := int64(10)
+		if i == 5 {
+			tokens = 50
+		}
+
+		r.HandleEvent(events.NewTokensServedEvent("ns", "static", false, tokens, 0))
+		*now = now.Add(time.Second)
+	}
+	*now = now.Add(-time.Second)
+
+	report := r.Recommend(testConfig(t))
+	if len(report.Recommendations) != 1 {
+		t.Fatalf("Expected a single recommendation, got %+v", report.Recommendations)
+	}
+
+	rec := report.Recommendations[0]
+	if rec.Bucket != "static" || rec.Samples != 20 || rec.ObservedRate != 10 || rec.PeakTokens != 50 {
+		t.Fatalf("Unexpected observations %+v", rec)
+	}
+
+	if rec.FillRate != 20 || rec.Size != 100 {
+		t.Fatalf("Unexpected recommendation %+v", rec)
+	}
+
+	b := report.Candidate.Namespaces["ns"].Buckets["static"]
+	if b.GetFillRate() != 20 || b.GetSize() != 100 {
+		t.Fatalf("Expected the recommendation to be applied to the candidate, got %+v", b)
+	}
+}
+
+func TestRecommendCountsIdleIntervalsAndRejections(t *testing.T) {
+	r, now := newTestRecorder()
+
+	// Requests every other second, half of which time out.
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			r.HandleEvent(events.NewTokensServedEvent("ns", "static", false, 5, 0))
+			r.HandleEvent(events.NewTimedOutEvent("ns", "static", false, 5))
+		}
+		*now = now.Add(time.Second)
+	}
+
+	rec := r.Recommend(testConfig(t)).Recommendations[0]
+	if rec.Samples != 21 || rec.ObservedRate != 10 || rec.PeakTokens != 10 {
+		t.Fatalf("Unexpected observations %+v", rec)
+	}
+}
+
+func TestRecommendDynamicBuckets(t *testing.T) {
+	r, now := newTestRecorder()
+
+	for i := 0; i < 10; i++ {
+		r.HandleEvent(events.NewTokensServedEvent("ns", "dyn1", true, 3, 0))
+		r.HandleEvent(events.NewTokensServedEvent("ns", "dyn2", true, 7, 0))
+		// Ignored: quota groups, and buckets that aren't configured.
+		r.HandleEvent(events.NewTokensServedEvent("ns", "grouped", false, 7, 0))
+		r.HandleEvent(events.NewTokensServedEvent("other", "b", false, 7, 0))
+		*now = now.Add(time.Second)
+	}
+	*now = now.Add(-time.Second)
+
+	report := r.Recommend(testConfig(t))
+	if len(report.Recommendations) != 1 {
+		t.Fatalf("Expected a single recommendation, got %+v", report.Recommendations)
+	}
+
+	rec := report.Recommendations[0]
+	if rec.Bucket != config.DynamicBucketTemplateName || rec.FillRate != 14 || rec.Size != 14 {
+		t.Fatalf("Expected the template to accommodate the busiest dynamic bucket, got %+v", rec)
+	}
+
+	if tpl := report.Candidate.Namespaces["ns"].DynamicBucketTemplate; tpl.GetFillRate() != 14 {
+		t.Fatalf("Expected the recommendation to be applied to the template, got %+v", tpl)
+	}
+}
+
+func TestRecommendNeedsMinSamples(t *testing.T) {
+	r, _ := newTestRecorder()
+	r.HandleEvent(events.NewTokensServedEvent("ns", "static", false, 100, 0))
+
+	cfg := testConfig(t)
+	report := r.Recommend(cfg)
+	if len(report.Recommendations) != 0 {
+		t.Fatalf("Expected no recommendations, got %+v", report.Recommendations)
+	}
+
+	if report.Candidate == cfg || report.Candidate.Namespaces["ns"].Buckets["static"].GetFillRate() != cfg.Namespaces["ns"].Buckets["static"].GetFillRate() {
+		t.Fatalf("Expected an unchanged copy of the config")
+	}
+}
+
+func TestRecommendWindow(t *testing.T) {
+	r, now := newTestRecorder()
+	r.HandleEvent(events.NewTokensServedEvent("ns", "static", false, 1000, 0))
+
+	// Long after the burst, only idle intervals remain in the window.
+	*now = now.Add(time.Hour)
+	r.HandleEvent(events.NewTokensServedEvent("ns", "static", false, 1, 0))
+
+	rec := r.Recommend(testConfig(t)).Recommendations[0]
+	if rec.Samples != 100 || rec.PeakTokens != 1 || rec.FillRate != 1 || rec.Size != 2 {
+		t.Fatalf("Expected traffic outside the window to be forgotten, got %+v", rec)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	helpers.ExpectingPanic(t, func() {
+		NewRecorder(Config{Interval: time.Second, Window: time.Millisecond, Percentile: 0.99})
+	})
+
+	helpers.ExpectingPanic(t, func() {
+		NewRecorder(Config{Interval: time.Second, Window: time.Minute, Percentile: 2})
+	})
+}
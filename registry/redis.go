@@ -0,0 +1,210 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package registry
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+)
+
+// keyPrefix prefixes a namespace's keys. The namespace is a hash tag, so that a namespace's keys
+// are kept on the same node of a cluster.
+const keyPrefix = "quotaservice:dynamic:"
+
+// pruneScript drops the buckets in ARGV[2:] that were last hit before ARGV[1], checking each
+// bucket's last hit atomically, so that buckets hit by another server since being listed are kept.
+var pruneScript = redis.NewScript(`
+local cutoff = tonumber(ARGV[1])
+for i = 2, #ARGV do
+	local hit = tonumber(redis.call("HGET", KEYS[3], ARGV[i]))
+	if hit == nil or hit < cutoff then
+		redis.call("SREM", KEYS[1], ARGV[i])
+		redis.call("HDEL", KEYS[2], ARGV[i])
+		redis.call("HDEL", KEYS[3], ARGV[i])
+	end
+end
+return 0`)
+
+type bucketKey struct {
+	namespace, name string
+}
+
+type redisRegistry struct {
+	client  redis.UniversalClient
+	cfg     Config
+	pending map[bucketKey]int64
+	stop    chan struct{}
+	done    chan struct{}
+	closer  sync.Once
+	sync.Mutex
+}
+
+// NewRedisRegistry creates a Registry shared by servers using the same Redis. Each namespace's
+// bucket names are kept in a set, and their creation and last hit times in hashes. A bucket's hits
+// are coalesced, and recorded every HitResolution.
+func NewRedisRegistry(client redis.UniversalClient, cfg Config) Registry {
+	if client == nil {
+		panic("A Redis client is required")
+	}
+
+	cfg.validate()
+	r := &redisRegistry{
+		client:  client,
+		cfg:     cfg,
+		pending: make(map[bucketKey]int64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{})}
+
+	go r.flusher()
+	return r
+}
+
+func keys(namespace string) (names, created, hits string) {
+	prefix := keyPrefix + "{" + namespace + "}:"
+	return prefix + "names", prefix + "created", prefix + "hits"
+}
+
+func (r *redisRegistry) HandleEvent(e events.Event) {
+	millis, ok := seenAt(e, time.Now())
+	if !ok {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.pending[bucketKey{e.Namespace(), e.BucketName()}] = millis
+}
+
+func (r *redisRegistry) flusher() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.HitResolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			r.flush()
+			return
+		case <-ticker.C:
+			r.flush()
+		}
+	}
+}
+
+// flush records pending updates. Updates that fail aren't retried, as buckets still in use are
+// hit again.
+func (r *redisRegistry) flush() {
+	r.Lock()
+	pending := r.pending
+	r.pending = make(map[bucketKey]int64)
+	r.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.HitResolution)
+	defer cancel()
+
+	pipe := r.client.Pipeline()
+	for k, millis := range pending {
+		names, created, hits := keys(k.namespace)
+		pipe.SAdd(ctx, names, k.name)
+		// A bucket is created once per server, so keep the earliest sighting.
+		pipe.HSetNX(ctx, created, k.name, millis)
+		pipe.HSet(ctx, hits, k.name, millis)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logging.Printf("Unable to record %v dynamic buckets in the registry: %v", len(pending), err)
+	}
+}
+
+// List pages through buckets with SSCAN, so a bucket may be listed more than once while paging,
+// and buckets created while paging may not be listed. Buckets found to be idle are dropped.
+func (r *redisRegistry) List(namespace, cursor string, count int) (*admin.DynamicBucketPage, error) {
+	if count < 1 {
+		return nil, ErrInvalidCount
+	}
+
+	var scanCursor uint64
+	if cursor != "" {
+		var err error
+		if scanCursor, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	ctx := context.Background()
+	namesKey, createdKey, hitsKey := keys(namespace)
+	names, next, err := r.client.SScan(ctx, namesKey, scanCursor, "", int64(count)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	page := &admin.DynamicBucketPage{Buckets: make([]*admin.DynamicBucket, 0, len(names))}
+	if next != 0 {
+		page.Cursor = strconv.FormatUint(next, 10)
+	}
+
+	if len(names) == 0 {
+		return page, nil
+	}
+
+	created, err := r.client.HMGet(ctx, createdKey, names...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := r.client.HMGet(ctx, hitsKey, names...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-r.cfg.MaxIdle).UnixNano() / int64(time.Millisecond)
+	idle := []interface{}{cutoff}
+	for i, name := range names {
+		b := &admin.DynamicBucket{Name: name, Created: parseMillis(created[i]), LastHit: parseMillis(hits[i])}
+		if b.LastHit < cutoff {
+			idle = append(idle, name)
+		} else {
+			page.Buckets = append(page.Buckets, b)
+		}
+	}
+
+	if len(idle) > 1 {
+		if err := pruneScript.Run(ctx, r.client, []string{namesKey, createdKey, hitsKey}, idle...).Err(); err != nil {
+			logging.Printf("Unable to drop idle dynamic buckets from the registry: %v", err)
+		}
+	}
+
+	return page, nil
+}
+
+// parseMillis parses a time read with HMGET, which is 0 if missing.
+func parseMillis(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+
+	millis, _ := strconv.ParseInt(s, 10, 64)
+	return millis
+}
+
+func (r *redisRegistry) Close() {
+	r.closer.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+}
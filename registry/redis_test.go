@@ -0,0 +1,93 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func newTestRedisRegistry(t *testing.T, cfg Config) (Registry, redis.UniversalClient) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	names, created, hits := keys("ns")
+	if err := client.Del(context.Background(), names, created, hits).Err(); err != nil {
+		t.Fatalf("Unable to connect to Redis: %v", err)
+	}
+
+	return NewRedisRegistry(client, cfg), client
+}
+
+func TestRedisRegistry(t *testing.T) {
+	r, client := newTestRedisRegistry(t, Config{HitResolution: 5 * time.Millisecond, MaxIdle: time.Hour})
+	defer client.Close()
+	defer r.Close()
+
+	// Another server sharing the registry.
+	other := NewRedisRegistry(client, Config{HitResolution: 5 * time.Millisecond, MaxIdle: time.Hour})
+	defer other.Close()
+
+	for i, name := range []string{"a", "b", "c"} {
+		if i%2 == 0 {
+			r.HandleEvent(events.NewBucketCreatedEvent("ns", name, true))
+		} else {
+			other.HandleEvent(events.NewBucketCreatedEvent("ns", name, true))
+		}
+	}
+
+	r.HandleEvent(events.NewBucketCreatedEvent("ns", "static", false))
+	time.Sleep(50 * time.Millisecond)
+
+	listed := make(map[string]bool)
+	for page, cursor := 0, ""; page == 0 || cursor != ""; page++ {
+		p, err := r.List("ns", cursor, 1)
+		helpers.CheckError(t, err)
+		for _, b := range p.Buckets {
+			if b.Created == 0 || b.LastHit < b.Created {
+				t.Errorf("Unexpected bucket %+v", b)
+			}
+
+			listed[b.Name] = true
+		}
+
+		cursor = p.Cursor
+	}
+
+	if len(listed) != 3 || !listed["a"] || !listed["b"] || !listed["c"] {
+		t.Fatalf("Expected the buckets of both servers to be listed, got %v", listed)
+	}
+
+	if _, err := r.List("ns", "x", 1); err != ErrInvalidCursor {
+		t.Fatalf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestRedisRegistryDropsIdleBuckets(t *testing.T) {
+	r, client := newTestRedisRegistry(t, Config{HitResolution: 5 * time.Millisecond, MaxIdle: 50 * time.Millisecond})
+	defer client.Close()
+
+	r.HandleEvent(events.NewBucketCreatedEvent("ns", "idle", true))
+	r.HandleEvent(events.NewBucketCreatedEvent("ns", "hit", true))
+	time.Sleep(60 * time.Millisecond)
+
+	// Pending hits are recorded on close.
+	r.HandleEvent(events.NewTokensServedEvent("ns", "hit", true, 1, 0))
+	r.Close()
+
+	page, err := r.List("ns", "", 10)
+	helpers.CheckError(t, err)
+	if len(page.Buckets) != 1 || page.Buckets[0].Name != "hit" {
+		t.Fatalf("Expected only the bucket hit to be listed, got %+v", page.Buckets)
+	}
+
+	names, _, _ := keys("ns")
+	if members, err := client.SMembers(context.Background(), names).Result(); err != nil || len(members) != 1 {
+		t.Fatalf("Expected the idle bucket to be dropped, got %v, %v", members, err)
+	}
+}
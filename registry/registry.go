@@ -0,0 +1,150 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package registry tracks the dynamic buckets that currently exist, when they were created and
+// when they were last hit, so that operators can enumerate live dynamic buckets. Registries are
+// fed bucket events, and a registry shared by a fleet, such as the Redis registry, lists the
+// dynamic buckets created by any of its servers.
+package registry
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/events"
+)
+
+// Registry records dynamic buckets from bucket events.
+type Registry interface {
+	HandleEvent(events.Event)
+	// List returns a page of about count of a namespace's dynamic buckets, continuing from a cursor
+	// returned with an earlier page, or from the start if cursor is empty.
+	List(namespace, cursor string, count int) (*admin.DynamicBucketPage, error)
+	// Close records pending updates, and stops background work.
+	Close()
+}
+
+// Config configures a registry.
+type Config struct {
+	// HitResolution is how often hits are recorded in a shared registry. A bucket's last hit may
+	// lag by up to this long.
+	HitResolution time.Duration
+	// MaxIdle is how long a bucket that isn't hit stays in the registry. Servers reap idle dynamic
+	// buckets independently, so buckets are dropped from the registry once idle on all servers,
+	// rather than when removed from any one of them.
+	MaxIdle time.Duration
+}
+
+// NewDefaultConfig creates a Config recording hits every 10 seconds, and dropping buckets idle
+// for an hour.
+func NewDefaultConfig() Config {
+	return Config{
+		HitResolution: 10 * time.Second,
+		MaxIdle:       time.Hour}
+}
+
+func (cfg Config) validate() {
+	if cfg.HitResolution <= 0 || cfg.MaxIdle <= 0 {
+		panic("HitResolution and MaxIdle must be positive")
+	}
+}
+
+var (
+	// ErrInvalidCursor is returned by List for cursors it didn't return.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidCount is returned by List for counts that aren't positive.
+	ErrInvalidCount = errors.New("count must be positive")
+)
+
+// seenAt returns the time, in Unix millis, at which an event shows a dynamic bucket to exist, if
+// it does: when it is created, or serves tokens.
+func seenAt(e events.Event, now time.Time) (int64, bool) {
+	if !e.Dynamic() {
+		return 0, false
+	}
+
+	switch e.EventType() {
+	case events.EVENT_BUCKET_CREATED, events.EVENT_TOKENS_SERVED:
+		return now.UnixNano() / int64(time.Millisecond), true
+	default:
+		return 0, false
+	}
+}
+
+type memoryRegistry struct {
+	cfg        Config
+	namespaces map[string]map[string]*admin.DynamicBucket
+	sync.Mutex
+}
+
+// NewMemoryRegistry creates a Registry held in memory, which lists the dynamic buckets of a single
+// server.
+func NewMemoryRegistry(cfg Config) Registry {
+	cfg.validate()
+	return &memoryRegistry{cfg: cfg, namespaces: make(map[string]map[string]*admin.DynamicBucket)}
+}
+
+func (r *memoryRegistry) HandleEvent(e events.Event) {
+	millis, ok := seenAt(e, time.Now())
+	if !ok {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	ns := r.namespaces[e.Namespace()]
+	if ns == nil {
+		ns = make(map[string]*admin.DynamicBucket)
+		r.namespaces[e.Namespace()] = ns
+	}
+
+	b := ns[e.BucketName()]
+	if b == nil {
+		b = &admin.DynamicBucket{Name: e.BucketName(), Created: millis}
+		ns[e.BucketName()] = b
+	}
+
+	b.LastHit = millis
+}
+
+// List pages through buckets in order of name. The cursor is the name of the last bucket listed.
+func (r *memoryRegistry) List(namespace, cursor string, count int) (*admin.DynamicBucketPage, error) {
+	if count < 1 {
+		return nil, ErrInvalidCount
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	cutoff := time.Now().Add(-r.cfg.MaxIdle).UnixNano() / int64(time.Millisecond)
+	ns := r.namespaces[namespace]
+	names := make([]string, 0, len(ns))
+	for name, b := range ns {
+		if b.LastHit < cutoff {
+			delete(ns, name)
+		} else if name > cursor {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	page := &admin.DynamicBucketPage{}
+	if len(names) > count {
+		names = names[:count]
+		page.Cursor = names[count-1]
+	}
+
+	page.Buckets = make([]*admin.DynamicBucket, 0, len(names))
+	for _, name := range names {
+		b := *ns[name]
+		page.Buckets = append(page.Buckets, &b)
+	}
+
+	return page, nil
+}
+
+func (r *memoryRegistry) Close() {}
@@ -0,0 +1,68 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	r := NewMemoryRegistry(NewDefaultConfig())
+	for _, name := range []string{"c", "a", "b"} {
+		r.HandleEvent(events.NewBucketCreatedEvent("ns", name, true))
+	}
+
+	// Static buckets, and events other than creation and hits, aren't recorded.
+	r.HandleEvent(events.NewBucketCreatedEvent("ns", "static", false))
+	r.HandleEvent(events.NewBucketMissedEvent("ns", "missed", true))
+
+	page, err := r.List("ns", "", 2)
+	helpers.CheckError(t, err)
+	if len(page.Buckets) != 2 || page.Buckets[0].Name != "a" || page.Buckets[1].Name != "b" || page.Cursor != "b" {
+		t.Fatalf("Unexpected first page %+v", page)
+	}
+
+	page, err = r.List("ns", page.Cursor, 2)
+	helpers.CheckError(t, err)
+	if len(page.Buckets) != 1 || page.Buckets[0].Name != "c" || page.Cursor != "" {
+		t.Fatalf("Unexpected last page %+v", page)
+	}
+
+	if b := page.Buckets[0]; b.Created == 0 || b.LastHit != b.Created {
+		t.Fatalf("Expected a new bucket to have been last hit when created, got %+v", b)
+	}
+
+	if _, err := r.List("ns", "", 0); err != ErrInvalidCount {
+		t.Fatalf("Expected ErrInvalidCount, got %v", err)
+	}
+}
+
+func TestMemoryRegistryDropsIdleBuckets(t *testing.T) {
+	r := NewMemoryRegistry(Config{HitResolution: time.Second, MaxIdle: 20 * time.Millisecond})
+	r.HandleEvent(events.NewBucketCreatedEvent("ns", "idle", true))
+	r.HandleEvent(events.NewBucketCreatedEvent("ns", "hit", true))
+
+	time.Sleep(30 * time.Millisecond)
+	r.HandleEvent(events.NewTokensServedEvent("ns", "hit", true, 1, 0))
+
+	page, err := r.List("ns", "", 10)
+	helpers.CheckError(t, err)
+	if len(page.Buckets) != 1 || page.Buckets[0].Name != "hit" || page.Buckets[0].LastHit <= page.Buckets[0].Created {
+		t.Fatalf("Expected only the bucket hit to be listed, got %+v", page.Buckets)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	helpers.ExpectingPanic(t, func() {
+		NewMemoryRegistry(Config{MaxIdle: time.Hour})
+	})
+
+	helpers.ExpectingPanic(t, func() {
+		NewRedisRegistry(nil, NewDefaultConfig())
+	})
+}
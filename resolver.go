@@ -0,0 +1,50 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+)
+
+// Resolver maps an incoming request to the namespace, bucket and number of tokens it is actually
+// charged against. This allows deployments to centralize routing logic, e.g. deriving the bucket
+// from the caller's identity, rather than trusting clients to name buckets correctly.
+//
+// Resolve is called with the namespace, bucket name and tokens named in the request. The context
+// is the one passed in by the RPC endpoint, so for gRPC, metadata and peer information are
+// available through the metadata.FromIncomingContext and peer.FromContext functions in the
+// grpc packages. Errors are returned to the caller as ER_NO_BUCKET, unless they already are a
+// QuotaServiceError.
+type Resolver interface {
+	Resolve(ctx context.Context, namespace, name string, tokens int64) (resolvedNamespace, resolvedName string, resolvedTokens int64, err error)
+}
+
+// ResolverFunc adapts an ordinary function to a Resolver.
+type ResolverFunc func(ctx context.Context, namespace, name string, tokens int64) (string, string, int64, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context, namespace, name string, tokens int64) (string, string, int64, error) {
+	return f(ctx, namespace, name, tokens)
+}
+
+// PassThroughResolver is the default Resolver, which uses the namespace, bucket and tokens as
+// named in the request.
+type PassThroughResolver struct{}
+
+func (PassThroughResolver) Resolve(_ context.Context, namespace, name string, tokens int64) (string, string, int64, error) {
+	return namespace, name, tokens, nil
+}
+
+// resolve applies a Resolver, converting errors to QuotaServiceErrors.
+func resolve(r Resolver, ctx context.Context, namespace, name string, tokens int64) (string, string, int64, error) {
+	ns, n, t, err := r.Resolve(ctx, namespace, name, tokens)
+	if err != nil {
+		if _, ok := err.(QuotaServiceError); ok {
+			return "", "", 0, err
+		}
+
+		return "", "", 0, newError("Cannot resolve bucket "+namespace+":"+name+": "+err.Error(), ER_NO_BUCKET)
+	}
+
+	return ns, n, t, nil
+}
@@ -19,6 +19,28 @@ type QuotaService interface {
 	// tokens could not be obtained, and will contain more context once cast to
 	// quotaservice.QoutaServiceError.
 	Allow(ctx context.Context, namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (waitTime time.Duration, dynamic bool, err error)
+
+	// Charge reconciles tokensReserved, obtained by an earlier call to Allow, with the actual cost
+	// of an operation. The difference is taken from, or returned to, the bucket. Errors indicate
+	// the bucket could not be charged, and will contain more context once cast to
+	// quotaservice.QuotaServiceError.
+	Charge(ctx context.Context, namespace, name string, tokensReserved, actualCost int64) error
+}
+
+// BucketTokens is a number of tokens requested from a bucket, as part of a request to
+// MultiBucketQuotaService.AllowAll.
+type BucketTokens struct {
+	Namespace, Name string
+	Tokens          int64
+}
+
+// MultiBucketQuotaService is implemented by QuotaServices that can grant tokens from several
+// buckets at once, for operations that consume several resources, such that either all are granted,
+// or none are taken.
+type MultiBucketQuotaService interface {
+	// AllowAll is like Allow, but for several buckets, which must all grant their tokens within the
+	// max wait time for any to be taken. The wait time returned is the longest of the buckets'.
+	AllowAll(ctx context.Context, requests []BucketTokens, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (waitTime time.Duration, err error)
 }
 
 // RpcEndpoint defines a subsystem that listens on a network socket for external systems to
@@ -34,3 +56,112 @@ type RpcEndpoint interface {
 	// Stop will be called before the quotaservice stops.
 	Stop()
 }
+
+type requestIDKey struct{}
+
+// WithRequestID attaches a caller-supplied request ID to a context passed to QuotaService.Allow.
+// Buckets that support it use the ID to make token grants idempotent, so a client retrying a
+// request after a network timeout isn't charged twice.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID attached to a context by WithRequestID, or an empty
+// string if there isn't one.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type strictKey struct{}
+
+// WithStrict marks a request passed to QuotaService.Allow as strict: tokens are only granted if
+// the bucket has accumulated them, without going into debt, even if the bucket allows debt. For
+// callers that must never borrow against future capacity.
+func WithStrict(ctx context.Context) context.Context {
+	return context.WithValue(ctx, strictKey{}, true)
+}
+
+// StrictFromContext returns whether a context was marked as strict by WithStrict.
+func StrictFromContext(ctx context.Context) bool {
+	strict, _ := ctx.Value(strictKey{}).(bool)
+	return strict
+}
+
+type callerKey struct{}
+
+// WithCaller attaches the identity of the caller, such as its network address, to a context passed
+// to QuotaService.Allow. It is recorded in the access log, if one is configured.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	if caller == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller attached to a context by WithCaller, or an empty string if
+// there isn't one.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+type responseMetadataKey struct{}
+
+// WithResponseMetadata returns a context that, when passed to QuotaService.Allow, collects the
+// metadata configured on the namespace and bucket the request was for, so endpoints can return it
+// to callers. Read it with ResponseMetadataFromContext once Allow returns.
+func WithResponseMetadata(ctx context.Context) context.Context {
+	return context.WithValue(ctx, responseMetadataKey{}, new(map[string]string))
+}
+
+// ResponseMetadataFromContext returns the metadata collected in a context created by
+// WithResponseMetadata, or nil if there isn't any. The returned map must not be modified.
+func ResponseMetadataFromContext(ctx context.Context) map[string]string {
+	if md, ok := ctx.Value(responseMetadataKey{}).(*map[string]string); ok {
+		return *md
+	}
+
+	return nil
+}
+
+// SetResponseMetadata records metadata in a context created by WithResponseMetadata, for
+// QuotaService implementations to return to endpoints. It does nothing for other contexts.
+func SetResponseMetadata(ctx context.Context, md map[string]string) {
+	if p, ok := ctx.Value(responseMetadataKey{}).(*map[string]string); ok {
+		*p = md
+	}
+}
+
+// AllowDetails describes how QuotaService.Allow handled a request, beyond what it returns.
+type AllowDetails struct {
+	// AllowListed is true if the request was granted, without taking tokens, because the bucket is on
+	// its namespace's allow-list.
+	AllowListed bool
+	// RemainingTokens is the number of tokens left in the bucket after the request, or, if negative,
+	// the tokens it owes. Only set if HasRemainingTokens is true, since not all buckets report it.
+	RemainingTokens    int64
+	HasRemainingTokens bool
+}
+
+type allowDetailsKey struct{}
+
+// WithAllowDetails returns a context that, when passed to QuotaService.Allow, collects details of
+// how the request was handled into the returned AllowDetails. Collecting remaining tokens may cost
+// an extra call to the bucket's backend, so endpoints should only ask for details they return.
+func WithAllowDetails(ctx context.Context) (context.Context, *AllowDetails) {
+	d := &AllowDetails{}
+	return context.WithValue(ctx, allowDetailsKey{}, d), d
+}
+
+// AllowDetailsFromContext returns the AllowDetails attached to a context by WithAllowDetails, for
+// QuotaService implementations to fill in, or nil if there aren't any.
+func AllowDetailsFromContext(ctx context.Context) *AllowDetails {
+	d, _ := ctx.Value(allowDetailsKey{}).(*AllowDetails)
+	return d
+}
@@ -0,0 +1,166 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package envoy implements Envoy's rate limit service, envoy.service.ratelimit.v3, as an RPC
+// endpoint, so the quota service can be used as Envoy's global rate limit backend. Each descriptor
+// in a request is mapped to a bucket, and the request is over the limit if any bucket is.
+package envoy
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/lifecycle"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos/rls"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Config maps Envoy's rate limit domains and descriptors to namespaces and buckets.
+//
+// A descriptor is named by joining its entries, each written as its key and value separated by an
+// underscore, with underscores, and replacing characters that aren't valid in bucket names with
+// underscores. For example, the descriptor [(generic_key, api), (remote_address, 10.0.0.1)] is named
+// generic_key_api_remote_address_10_0_0_1.
+type Config struct {
+	// Namespaces maps domains to namespaces. Domains that aren't mapped are used as namespaces.
+	Namespaces map[string]string
+	// Buckets maps descriptor names to bucket names. Descriptors that aren't mapped use their names
+	// as bucket names, so they are typically served by dynamic buckets.
+	Buckets map[string]string
+}
+
+// EnvoyEndpoint serves Envoy's rate limit service over gRPC.
+type EnvoyEndpoint struct {
+	hostport      string
+	listener      net.Listener
+	cfg           Config
+	grpcServer    *grpc.Server
+	currentStatus lifecycle.Status
+	qs            quotaservice.QuotaService
+}
+
+// New creates a new EnvoyEndpoint, listening on hostport. Hostport is a string in the form
+// "host:port"
+func New(hostport string, cfg Config) *EnvoyEndpoint {
+	if !strings.Contains(hostport, ":") {
+		panic(fmt.Sprintf("hostport should be in the format 'host:port', but is currently %v",
+			hostport))
+	}
+
+	return &EnvoyEndpoint{hostport: hostport, cfg: cfg}
+}
+
+// NewWithListener creates a new EnvoyEndpoint, accepting connections on a listener created by the
+// caller, e.g. with the sockets package, or on an ephemeral port in tests.
+func NewWithListener(lis net.Listener, cfg Config) *EnvoyEndpoint {
+	if lis == nil {
+		panic("listener was nil")
+	}
+
+	return &EnvoyEndpoint{hostport: lis.Addr().String(), listener: lis, cfg: cfg}
+}
+
+func (e *EnvoyEndpoint) Init(qs quotaservice.QuotaService) {
+	e.qs = qs
+}
+
+func (e *EnvoyEndpoint) Start() {
+	lis := e.listener
+	if lis == nil {
+		var err error
+		if lis, err = net.Listen("tcp", e.hostport); err != nil {
+			logging.Fatalf("Cannot start server on port %v. Error %v", e.hostport, err)
+		}
+	}
+
+	e.grpcServer = grpc.NewServer()
+	pb.RegisterRateLimitServiceServer(e.grpcServer, e)
+	go func() {
+		if err := e.grpcServer.Serve(lis); err != nil {
+			logging.Fatalf("Cannot start Envoy rate limit server. Error %v", err)
+		}
+	}()
+
+	e.currentStatus = lifecycle.Started
+	logging.Printf("Starting Envoy rate limit server on %v", e.hostport)
+}
+
+func (e *EnvoyEndpoint) Stop() {
+	e.currentStatus = lifecycle.Stopped
+}
+
+// ShouldRateLimit takes tokens, without waiting, from the bucket each descriptor maps to. Requests
+// for descriptors without buckets, or that fail due to server errors, are allowed, failing open as
+// the gRPC endpoint does.
+func (e *EnvoyEndpoint) ShouldRateLimit(ctx context.Context, req *pb.RateLimitRequest) (*pb.RateLimitResponse, error) {
+	rsp := &pb.RateLimitResponse{OverallCode: pb.RateLimitResponse_OK}
+	if req.Domain == "" || len(req.Descriptors) == 0 {
+		logging.Printf("Invalid request %+v", req)
+		return rsp, nil
+	}
+
+	hits := int64(req.HitsAddend)
+	if hits == 0 {
+		hits = 1
+	}
+
+	namespace := req.Domain
+	if ns, ok := e.cfg.Namespaces[req.Domain]; ok {
+		namespace = ns
+	}
+
+	for _, d := range req.Descriptors {
+		status := &pb.DescriptorStatus{Code: e.allow(ctx, namespace, e.bucketName(d), hits)}
+		if status.Code == pb.RateLimitResponse_OVER_LIMIT {
+			rsp.OverallCode = pb.RateLimitResponse_OVER_LIMIT
+		}
+
+		rsp.Statuses = append(rsp.Statuses, status)
+	}
+
+	return rsp, nil
+}
+
+func (e *EnvoyEndpoint) allow(ctx context.Context, namespace, bucket string, hits int64) pb.RateLimitResponse_Code {
+	_, _, err := e.qs.Allow(ctx, namespace, bucket, hits, 0, true)
+	if err == nil {
+		return pb.RateLimitResponse_OK
+	}
+
+	qsErr, ok := err.(quotaservice.QuotaServiceError)
+	if !ok {
+		logging.Printf("Caught error %v", err)
+		return pb.RateLimitResponse_OK
+	}
+
+	switch qsErr.Reason {
+	case quotaservice.ER_TIMEOUT, quotaservice.ER_TOO_MANY_TOKENS_REQUESTED, quotaservice.ER_DENIED, quotaservice.ER_OVERLOADED:
+		return pb.RateLimitResponse_OVER_LIMIT
+	default:
+		return pb.RateLimitResponse_OK
+	}
+}
+
+var invalidBucketChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+func (e *EnvoyEndpoint) bucketName(d *pb.RateLimitDescriptor) string {
+	parts := make([]string, 0, 2*len(d.Entries))
+	for _, entry := range d.Entries {
+		parts = append(parts, entry.Key)
+		if entry.Value != "" {
+			parts = append(parts, entry.Value)
+		}
+	}
+
+	name := invalidBucketChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+	if bucket, ok := e.cfg.Buckets[name]; ok {
+		return bucket
+	}
+
+	return name
+}
@@ -0,0 +1,97 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package envoy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	pb "github.com/square/quotaservice/protos/rls"
+	"github.com/square/quotaservice/test/helpers"
+	"golang.org/x/net/context"
+)
+
+// fakeQuotaService records requests, failing those for buckets in errs.
+type fakeQuotaService struct {
+	errs      map[string]error
+	requested map[string]int64
+}
+
+func (qs *fakeQuotaService) Allow(_ context.Context, namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (time.Duration, bool, error) {
+	if maxWaitMillisOverride != 0 || !maxWaitTimeOverride {
+		return 0, false, errors.New("expected no waiting")
+	}
+
+	fqn := config.FullyQualifiedName(namespace, name)
+	qs.requested[fqn] += tokensRequested
+	return 0, false, qs.errs[fqn]
+}
+
+func (qs *fakeQuotaService) Charge(_ context.Context, _, _ string, _, _ int64) error {
+	return nil
+}
+
+func descriptor(kvs ...string) *pb.RateLimitDescriptor {
+	d := &pb.RateLimitDescriptor{}
+	for i := 0; i < len(kvs); i += 2 {
+		d.Entries = append(d.Entries, &pb.RateLimitDescriptorEntry{Key: kvs[i], Value: kvs[i+1]})
+	}
+
+	return d
+}
+
+func TestShouldRateLimit(t *testing.T) {
+	qs := &fakeQuotaService{
+		errs: map[string]error{
+			"ns:limited":  quotaservice.QuotaServiceError{Reason: quotaservice.ER_TIMEOUT},
+			"ns:missing":  quotaservice.QuotaServiceError{Reason: quotaservice.ER_NO_BUCKET},
+			"ns:erroring": errors.New("redis is down")},
+		requested: make(map[string]int64)}
+	e := New("localhost:0", Config{
+		Namespaces: map[string]string{"envoy": "ns"},
+		Buckets:    map[string]string{"generic_key_limited": "limited"}})
+	e.Init(qs)
+
+	rsp, err := e.ShouldRateLimit(context.Background(), &pb.RateLimitRequest{
+		Domain:      "envoy",
+		Descriptors: []*pb.RateLimitDescriptor{descriptor("remote_address", "10.0.0.1"), descriptor("missing", "")},
+		HitsAddend:  2})
+	helpers.CheckError(t, err)
+
+	if rsp.OverallCode != pb.RateLimitResponse_OK || len(rsp.Statuses) != 2 {
+		t.Fatalf("Expected request to be allowed, got %+v", rsp)
+	}
+
+	if requested := qs.requested["ns:remote_address_10_0_0_1"]; requested != 2 {
+		t.Fatalf("Expected hits to be taken from the descriptor's bucket, got %v", qs.requested)
+	}
+
+	rsp, err = e.ShouldRateLimit(context.Background(), &pb.RateLimitRequest{
+		Domain:      "envoy",
+		Descriptors: []*pb.RateLimitDescriptor{descriptor("erroring", ""), descriptor("generic_key", "limited")}})
+	helpers.CheckError(t, err)
+
+	if rsp.OverallCode != pb.RateLimitResponse_OVER_LIMIT ||
+		rsp.Statuses[0].Code != pb.RateLimitResponse_OK || rsp.Statuses[1].Code != pb.RateLimitResponse_OVER_LIMIT {
+		t.Fatalf("Expected request to be over the limit, got %+v", rsp)
+	}
+}
+
+func TestUnmappedDomainUsedAsNamespace(t *testing.T) {
+	qs := &fakeQuotaService{requested: make(map[string]int64)}
+	e := New("localhost:0", Config{})
+	e.Init(qs)
+
+	_, err := e.ShouldRateLimit(context.Background(), &pb.RateLimitRequest{
+		Domain:      "edge",
+		Descriptors: []*pb.RateLimitDescriptor{descriptor("path", "/api/v1")}})
+	helpers.CheckError(t, err)
+
+	if requested := qs.requested["edge:path__api_v1"]; requested != 1 {
+		t.Fatalf("Expected 1 hit in the domain's namespace, got %v", qs.requested)
+	}
+}
@@ -6,31 +6,50 @@ package grpc
 import (
 	"fmt"
 	"net"
+	"os"
 	"strings"
 
 	"time"
 
 	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/agent"
 	"github.com/square/quotaservice/events"
 	"github.com/square/quotaservice/lifecycle"
 	"github.com/square/quotaservice/logging"
 	pb "github.com/square/quotaservice/protos"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
 )
 
+// serviceName is the fully qualified name of the QuotaService, as reported by the health service.
+const serviceName = "quotaservice.QuotaService"
+
 type GrpcEndpoint struct {
 	hostport      string
+	network       string
+	socketMode    os.FileMode
+	listener      net.Listener
 	grpcServer    *grpc.Server
+	healthServer  *health.Server
 	currentStatus lifecycle.Status
 	qs            quotaservice.QuotaService
 	producer      events.EventProducer
+	coordinator   *agent.Coordinator
+	// Versions of the Allow RPC that aren't served.
+	disabledVersions   map[APIVersion]bool
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
 }
 
 // New creates a new GrpcEndpoint, listening on hostport. Hostport is a string in the form
 // "host:port"
-func New(hostport string, producer *events.EventProducer) *GrpcEndpoint {
+func New(hostport string, producer *events.EventProducer, opts ...Option) *GrpcEndpoint {
 	if producer == nil {
 		panic("producer was nil")
 	}
@@ -39,7 +58,73 @@ func New(hostport string, producer *events.EventProducer) *GrpcEndpoint {
 		panic(fmt.Sprintf("hostport should be in the format 'host:port', but is currently %v",
 			hostport))
 	}
-	return &GrpcEndpoint{hostport: hostport}
+	return newEndpoint(&GrpcEndpoint{hostport: hostport, network: "tcp"}, opts)
+}
+
+// NewUnix creates a new GrpcEndpoint, listening on a Unix domain socket at path, for sidecar
+// deployments where the quota service runs as a per-host agent. The socket's permissions are set
+// to mode, so that filesystem permissions control which local processes may call the service. A
+// stale socket left at path by a previous process is removed.
+func NewUnix(path string, mode os.FileMode, producer *events.EventProducer, opts ...Option) *GrpcEndpoint {
+	if producer == nil {
+		panic("producer was nil")
+	}
+
+	if path == "" {
+		panic("path was empty")
+	}
+
+	return newEndpoint(&GrpcEndpoint{hostport: path, network: "unix", socketMode: mode}, opts)
+}
+
+// NewWithListener creates a new GrpcEndpoint, accepting connections on a listener created by the
+// caller, e.g. with the sockets package, or on an ephemeral port in tests.
+func NewWithListener(lis net.Listener, producer *events.EventProducer, opts ...Option) *GrpcEndpoint {
+	if producer == nil {
+		panic("producer was nil")
+	}
+
+	if lis == nil {
+		panic("listener was nil")
+	}
+
+	return newEndpoint(&GrpcEndpoint{hostport: lis.Addr().String(), listener: lis}, opts)
+}
+
+func newEndpoint(g *GrpcEndpoint, opts []Option) *GrpcEndpoint {
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+func (g *GrpcEndpoint) listen() (net.Listener, error) {
+	if g.listener != nil {
+		return g.listener, nil
+	}
+
+	if g.network != "unix" {
+		return net.Listen(g.network, g.hostport)
+	}
+
+	if fi, err := os.Stat(g.hostport); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(g.hostport); err != nil {
+			return nil, err
+		}
+	}
+
+	lis, err := net.Listen(g.network, g.hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(g.hostport, g.socketMode); err != nil {
+		_ = lis.Close()
+		return nil, err
+	}
+
+	return lis, nil
 }
 
 func (g *GrpcEndpoint) Init(qs quotaservice.QuotaService) {
@@ -47,15 +132,21 @@ func (g *GrpcEndpoint) Init(qs quotaservice.QuotaService) {
 }
 
 func (g *GrpcEndpoint) Start() {
-	lis, err := net.Listen("tcp", g.hostport)
+	lis, err := g.listen()
 	if err != nil {
 		logging.Fatalf("Cannot start server on port %v. Error %v", g.hostport, err)
 	}
 
 	grpclog.SetLogger(logging.CurrentLogger())
-	g.grpcServer = grpc.NewServer()
+	g.grpcServer = grpc.NewServer(g.serverOptions()...)
 	// Each service should be registered
 	pb.RegisterQuotaServiceServer(g.grpcServer, g)
+	pb.RegisterQuotaServiceV2Server(g.grpcServer, &v2Server{g})
+	// Standard health checking, for load balancers, and server reflection, for tools like grpcurl
+	g.healthServer = health.NewServer()
+	healthpb.RegisterHealthServer(g.grpcServer, g.healthServer)
+	reflection.Register(g.grpcServer)
+	g.setServingStatus(healthpb.HealthCheckResponse_SERVING)
 	go func() {
 		if e := g.grpcServer.Serve(lis); e != nil {
 			logging.Fatalf("Cannot start gRPC server. Error %v", e)
@@ -67,10 +158,25 @@ func (g *GrpcEndpoint) Start() {
 }
 
 func (g *GrpcEndpoint) Stop() {
+	if g.healthServer != nil {
+		g.setServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
 	g.currentStatus = lifecycle.Stopped
 }
 
+func (g *GrpcEndpoint) setServingStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	// The empty service name denotes the health of the server as a whole.
+	g.healthServer.SetServingStatus("", status)
+	g.healthServer.SetServingStatus(serviceName, status)
+	g.healthServer.SetServingStatus(serviceNameV2, status)
+}
+
 func (g *GrpcEndpoint) Allow(ctx context.Context, req *pb.AllowRequest) (*pb.AllowResponse, error) {
+	if err := g.checkVersion(API_V1); err != nil {
+		return nil, err
+	}
+
 	rsp := new(pb.AllowResponse)
 	if invalid(req) {
 		logging.Printf("Invalid request %+v", req)
@@ -78,12 +184,9 @@ func (g *GrpcEndpoint) Allow(ctx context.Context, req *pb.AllowRequest) (*pb.All
 		return rsp, nil
 	}
 
-	var tokensRequested int64 = 1
-	if req.TokensRequested > 0 {
-		tokensRequested = req.TokensRequested
-	}
-
-	wait, dynamic, err := g.qs.Allow(ctx, req.Namespace, req.BucketName, tokensRequested, req.MaxWaitMillisOverride, req.MaxWaitTimeOverride)
+	ctx = quotaservice.WithResponseMetadata(ctx)
+	wait, dynamic, err := g.allow(ctx, req, tokensRequested(req))
+	rsp.Metadata = quotaservice.ResponseMetadataFromContext(ctx)
 
 	if err != nil {
 		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok {
@@ -108,6 +211,100 @@ func (g *GrpcEndpoint) Allow(ctx context.Context, req *pb.AllowRequest) (*pb.All
 	return rsp, nil
 }
 
+// allow calls QuotaService.Allow for a valid request, passing on its ID, whether it is strict and
+// the caller's address, and deriving its max wait time from the caller's deadline if it doesn't set
+// one.
+func (g *GrpcEndpoint) allow(ctx context.Context, req *pb.AllowRequest, tokensRequested int64) (time.Duration, bool, error) {
+	maxWaitMillisOverride, maxWaitTimeOverride := req.MaxWaitMillisOverride, req.MaxWaitTimeOverride
+	if !maxWaitTimeOverride {
+		// Respect the caller's deadline, if any. The server still caps this to the bucket's configured
+		// wait timeout.
+		maxWaitMillisOverride, maxWaitTimeOverride = maxWaitFromDeadline(ctx)
+	}
+
+	ctx = quotaservice.WithRequestID(ctx, req.RequestId)
+	if req.Strict {
+		ctx = quotaservice.WithStrict(ctx)
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ctx = quotaservice.WithCaller(ctx, p.Addr.String())
+	}
+
+	return g.qs.Allow(ctx, req.Namespace, req.BucketName, tokensRequested, maxWaitMillisOverride, maxWaitTimeOverride)
+}
+
+func (g *GrpcEndpoint) Charge(ctx context.Context, req *pb.ChargeRequest) (*pb.ChargeResponse, error) {
+	rsp := new(pb.ChargeResponse)
+	if req.BucketName == "" || req.Namespace == "" || req.TokensReserved < 0 || req.ActualCost < 0 {
+		logging.Printf("Invalid request %+v", req)
+		rsp.Status = pb.ChargeResponse_REJECTED_INVALID_REQUEST
+		return rsp, nil
+	}
+
+	err := g.qs.Charge(ctx, req.Namespace, req.BucketName, req.TokensReserved, req.ActualCost)
+	if err != nil {
+		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok && qsErr.Reason == quotaservice.ER_NO_BUCKET {
+			rsp.Status = pb.ChargeResponse_REJECTED_NO_BUCKET
+		} else {
+			logging.Printf("Caught error %v", err)
+			rsp.Status = pb.ChargeResponse_REJECTED_SERVER_ERROR
+		}
+	}
+
+	return rsp, nil
+}
+
+// SetCoordinator enables the Reconcile RPC, used by agents to reconcile with this quota service.
+// Must be called before Start.
+func (g *GrpcEndpoint) SetCoordinator(c *agent.Coordinator) {
+	g.coordinator = c
+}
+
+func (g *GrpcEndpoint) Reconcile(ctx context.Context, req *pb.ReconcileRequest) (*pb.ReconcileResponse, error) {
+	if g.coordinator == nil {
+		return nil, grpc.Errorf(codes.Unimplemented, "agent coordination is not enabled")
+	}
+
+	if req.AgentId == "" {
+		logging.Printf("Invalid request %+v", req)
+		return &pb.ReconcileResponse{Status: pb.ReconcileResponse_REJECTED_INVALID_REQUEST}, nil
+	}
+
+	for _, u := range req.Usage {
+		if u.BucketName == "" || u.Namespace == "" {
+			logging.Printf("Invalid request %+v", req)
+			return &pb.ReconcileResponse{Status: pb.ReconcileResponse_REJECTED_INVALID_REQUEST}, nil
+		}
+	}
+
+	return g.coordinator.Reconcile(ctx, g.qs, req), nil
+}
+
+// maxWaitFromDeadline derives a max wait time, in millis, from the context's deadline. The second
+// return value is false if the context has no deadline.
+func maxWaitFromDeadline(ctx context.Context) (int64, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	millis := time.Until(deadline).Nanoseconds() / int64(time.Millisecond)
+	if millis < 0 {
+		millis = 0
+	}
+
+	return millis, true
+}
+
+// tokensRequested returns the tokens requested, defaulting to 1.
+func tokensRequested(req *pb.AllowRequest) int64 {
+	if req.TokensRequested > 0 {
+		return req.TokensRequested
+	}
+
+	return 1
+}
+
 func invalid(req *pb.AllowRequest) bool {
 	return req.BucketName == "" || req.Namespace == ""
 }
@@ -122,6 +319,10 @@ func toPBStatus(qsErr quotaservice.QuotaServiceError) (r pb.AllowResponse_Status
 		r = pb.AllowResponse_REJECTED_TOO_MANY_TOKENS_REQUESTED
 	case quotaservice.ER_TIMEOUT:
 		r = pb.AllowResponse_REJECTED_TIMEOUT
+	case quotaservice.ER_OVERLOADED:
+		r = pb.AllowResponse_REJECTED_OVERLOADED
+	case quotaservice.ER_DENIED:
+		r = pb.AllowResponse_REJECTED_DENIED
 	default:
 		r = pb.AllowResponse_REJECTED_SERVER_ERROR
 	}
@@ -0,0 +1,204 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/agent"
+	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos"
+	"github.com/square/quotaservice/test/helpers"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type recordingQuotaService struct {
+	maxWaitMillisOverride int64
+	maxWaitTimeOverride   bool
+	requestID             string
+	strict                bool
+	metadata              map[string]string
+}
+
+func (r *recordingQuotaService) Allow(ctx context.Context, namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (time.Duration, bool, error) {
+	r.maxWaitMillisOverride = maxWaitMillisOverride
+	r.maxWaitTimeOverride = maxWaitTimeOverride
+	r.requestID = quotaservice.RequestIDFromContext(ctx)
+	r.strict = quotaservice.StrictFromContext(ctx)
+	quotaservice.SetResponseMetadata(ctx, r.metadata)
+	return 0, false, nil
+}
+
+func (r *recordingQuotaService) Charge(ctx context.Context, namespace, name string, tokensReserved, actualCost int64) error {
+	return nil
+}
+
+func newTestEndpoint() (*GrpcEndpoint, *recordingQuotaService) {
+	qs := &recordingQuotaService{}
+	g := New("localhost:0", events.NewNilProducer())
+	g.Init(qs)
+	return g, qs
+}
+
+func TestMaxWaitDerivedFromDeadline(t *testing.T) {
+	g, qs := newTestEndpoint()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := g.Allow(ctx, &pb.AllowRequest{Namespace: "ns", BucketName: "b"})
+	helpers.CheckError(t, err)
+
+	if !qs.maxWaitTimeOverride || qs.maxWaitMillisOverride <= 0 || qs.maxWaitMillisOverride > 60000 {
+		t.Fatalf("Expected max wait to be derived from deadline, got %v, %v", qs.maxWaitMillisOverride, qs.maxWaitTimeOverride)
+	}
+}
+
+func TestExplicitMaxWaitTakesPrecedence(t *testing.T) {
+	g, qs := newTestEndpoint()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := g.Allow(ctx, &pb.AllowRequest{Namespace: "ns", BucketName: "b", MaxWaitMillisOverride: 5, MaxWaitTimeOverride: true})
+	helpers.CheckError(t, err)
+
+	if !qs.maxWaitTimeOverride || qs.maxWaitMillisOverride != 5 {
+		t.Fatalf("Expected explicit max wait to be used, got %v, %v", qs.maxWaitMillisOverride, qs.maxWaitTimeOverride)
+	}
+}
+
+func TestNoDeadline(t *testing.T) {
+	g, qs := newTestEndpoint()
+
+	_, err := g.Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "b"})
+	helpers.CheckError(t, err)
+
+	if qs.maxWaitTimeOverride {
+		t.Fatalf("Expected bucket's max wait to be used, got %v, %v", qs.maxWaitMillisOverride, qs.maxWaitTimeOverride)
+	}
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	g, qs := newTestEndpoint()
+
+	_, err := g.Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "b", RequestId: "abc"})
+	helpers.CheckError(t, err)
+
+	if qs.requestID != "abc" {
+		t.Fatalf("Expected request ID to be propagated, got %q", qs.requestID)
+	}
+}
+
+func TestStrictPropagated(t *testing.T) {
+	g, qs := newTestEndpoint()
+
+	_, err := g.Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "b", Strict: true})
+	helpers.CheckError(t, err)
+
+	if !qs.strict {
+		t.Fatal("Expected the request to be strict")
+	}
+}
+
+func TestResponseMetadata(t *testing.T) {
+	g, qs := newTestEndpoint()
+	qs.metadata = map[string]string{"docs": "https://example.com/quotas"}
+
+	rsp, err := g.Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "b"})
+	helpers.CheckError(t, err)
+
+	if rsp.Metadata["docs"] != "https://example.com/quotas" {
+		t.Fatalf("Expected metadata in the response, got %v", rsp.Metadata)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotaservice.sock")
+
+	// A stale socket, e.g. left by a process that crashed, is replaced.
+	stale, err := net.Listen("unix", path)
+	helpers.CheckError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	helpers.CheckError(t, stale.Close())
+
+	g := NewUnix(path, 0600, events.NewNilProducer())
+	qs := &recordingQuotaService{}
+	g.Init(qs)
+	g.Start()
+	defer g.Stop()
+
+	fi, err := os.Stat(path)
+	helpers.CheckError(t, err)
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("Expected socket permissions 0600, got %v", fi.Mode().Perm())
+	}
+
+	conn, err := grpc.Dial(path, grpc.WithInsecure(), grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", addr, timeout)
+	}))
+	helpers.CheckError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rsp, err := pb.NewQuotaServiceClient(conn).Allow(ctx, &pb.AllowRequest{Namespace: "ns", BucketName: "b", RequestId: "uds"})
+	helpers.CheckError(t, err)
+	if rsp.Status != pb.AllowResponse_OK || qs.requestID != "uds" {
+		t.Fatalf("Expected request to be served over the socket, got %v, %q", rsp.Status, qs.requestID)
+	}
+}
+
+func TestListener(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	helpers.CheckError(t, err)
+
+	g := NewWithListener(lis, events.NewNilProducer())
+	qs := &recordingQuotaService{}
+	g.Init(qs)
+	g.Start()
+	defer g.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	helpers.CheckError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rsp, err := pb.NewQuotaServiceClient(conn).Allow(ctx, &pb.AllowRequest{Namespace: "ns", BucketName: "b", RequestId: "lis"})
+	helpers.CheckError(t, err)
+	if rsp.Status != pb.AllowResponse_OK || qs.requestID != "lis" {
+		t.Fatalf("Expected request to be served on the listener, got %v, %q", rsp.Status, qs.requestID)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	g, _ := newTestEndpoint()
+	req := &pb.ReconcileRequest{AgentId: "a1", Usage: []*pb.BucketUsage{{Namespace: "ns", BucketName: "b", TokensConsumed: 1}}}
+
+	if _, err := g.Reconcile(context.Background(), req); grpc.Code(err) != codes.Unimplemented {
+		t.Fatalf("Expected Reconcile to be unimplemented without a coordinator, got %v", err)
+	}
+
+	g.SetCoordinator(agent.NewCoordinator(agent.NewDefaultCoordinatorConfig()))
+
+	rsp, err := g.Reconcile(context.Background(), req)
+	helpers.CheckError(t, err)
+	if rsp.Status != pb.ReconcileResponse_OK || len(rsp.Shares) != 1 || rsp.Shares[0].Share != 1 {
+		t.Fatalf("Expected a lone agent to get the whole bucket, got %+v", rsp)
+	}
+
+	rsp, err = g.Reconcile(context.Background(), &pb.ReconcileRequest{})
+	helpers.CheckError(t, err)
+	if rsp.Status != pb.ReconcileResponse_REJECTED_INVALID_REQUEST {
+		t.Fatalf("Expected a request without an agent ID to be rejected, got %v", rsp.Status)
+	}
+}
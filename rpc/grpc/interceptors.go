@@ -0,0 +1,71 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Option configures a GrpcEndpoint when it is constructed.
+type Option func(g *GrpcEndpoint)
+
+// WithUnaryInterceptors applies middleware, such as authentication, logging or tracing, to the
+// unary RPCs the endpoint serves. Interceptors are applied in order, so the first is outermost, and
+// may be passed in several options, which append to each other.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(g *GrpcEndpoint) {
+		g.unaryInterceptors = append(g.unaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors applies middleware to the streaming RPCs the endpoint serves, such as
+// server reflection. As with WithUnaryInterceptors, the first interceptor is outermost.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(g *GrpcEndpoint) {
+		g.streamInterceptors = append(g.streamInterceptors, interceptors...)
+	}
+}
+
+// serverOptions returns the options the endpoint's grpc.Server is created with. gRPC only accepts
+// a single interceptor of each kind, so interceptors are chained.
+func (g *GrpcEndpoint) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if len(g.unaryInterceptors) > 0 {
+		opts = append(opts, grpc.UnaryInterceptor(chainUnary(g.unaryInterceptors)))
+	}
+
+	if len(g.streamInterceptors) > 0 {
+		opts = append(opts, grpc.StreamInterceptor(chainStream(g.streamInterceptors)))
+	}
+
+	return opts
+}
+
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// Each interceptor calls the next, and the last calls the handler.
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func chainStream(interceptors []grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, next)
+			}
+		}
+
+		return handler(srv, ss)
+	}
+}
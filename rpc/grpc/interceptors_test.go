@@ -0,0 +1,79 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos"
+	"github.com/square/quotaservice/test/helpers"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestInterceptors(t *testing.T) {
+	var calls []string
+	recording := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name+" "+info.FullMethod)
+			return handler(ctx, req)
+		}
+	}
+
+	authenticating := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md, _ := metadata.FromContext(ctx); len(md["token"]) == 0 {
+			return nil, grpc.Errorf(codes.Unauthenticated, "no token")
+		}
+
+		return handler(ctx, req)
+	}
+
+	path := filepath.Join(t.TempDir(), "quotaservice.sock")
+	g := NewUnix(path, 0600, events.NewNilProducer(),
+		WithUnaryInterceptors(recording("first"), recording("second")),
+		WithUnaryInterceptors(authenticating))
+	g.Init(&recordingQuotaService{})
+	g.Start()
+	defer g.Stop()
+
+	conn, err := grpc.Dial(path, grpc.WithInsecure(), grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", addr, timeout)
+	}))
+	helpers.CheckError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := pb.NewQuotaServiceClient(conn)
+	req := &pb.AllowRequest{Namespace: "ns", BucketName: "b"}
+	if _, err := client.Allow(ctx, req); grpc.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected the request to be rejected by an interceptor, got %v", err)
+	}
+
+	rsp, err := client.Allow(metadata.NewContext(ctx, metadata.Pairs("token", "secret")), req)
+	helpers.CheckError(t, err)
+	if rsp.Status != pb.AllowResponse_OK {
+		t.Fatalf("Expected the request to be served, got %v", rsp.Status)
+	}
+
+	method := "/quotaservice.QuotaService/Allow"
+	expected := []string{"first " + method, "second " + method, "first " + method, "second " + method}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Expected interceptors to be called in order, got %v", calls)
+	}
+}
+
+func TestNoInterceptors(t *testing.T) {
+	if opts := New("localhost:0", events.NewNilProducer()).serverOptions(); len(opts) != 0 {
+		t.Fatalf("Expected no server options without interceptors, got %v", opts)
+	}
+}
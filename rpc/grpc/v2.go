@@ -0,0 +1,197 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// serviceNameV2 is the fully qualified name of the QuotaServiceV2, as reported by the health
+// service.
+const serviceNameV2 = "quotaservice.QuotaServiceV2"
+
+// APIVersion identifies a version of the Allow RPC.
+type APIVersion int
+
+const (
+	// QuotaService.Allow. Deprecated in favor of API_V2.
+	API_V1 APIVersion = iota
+	// QuotaServiceV2.Allow, which returns reason codes, remaining tokens and leases.
+	API_V2
+)
+
+var apiVersionNames = []string{"v1", "v2"}
+
+func (v APIVersion) String() string {
+	return apiVersionNames[v]
+}
+
+// DisableVersions stops the endpoint from serving the given versions of the Allow RPC, which then
+// fail with codes.Unimplemented, so clients still using deprecated versions can be found and
+// migrated. Must be called before Start.
+func (g *GrpcEndpoint) DisableVersions(versions ...APIVersion) {
+	if g.disabledVersions == nil {
+		g.disabledVersions = make(map[APIVersion]bool)
+	}
+
+	for _, v := range versions {
+		g.disabledVersions[v] = true
+	}
+}
+
+func (g *GrpcEndpoint) checkVersion(v APIVersion) error {
+	if g.disabledVersions[v] {
+		return grpc.Errorf(codes.Unimplemented, "Allow %v is disabled", v)
+	}
+
+	return nil
+}
+
+// v2Server serves QuotaServiceV2 for a GrpcEndpoint, whose Allow method serves version 1.
+type v2Server struct {
+	g *GrpcEndpoint
+}
+
+func (s *v2Server) Allow(ctx context.Context, req *pb.AllowRequest) (*pb.AllowV2Response, error) {
+	if err := s.g.checkVersion(API_V2); err != nil {
+		return nil, err
+	}
+
+	rsp := new(pb.AllowV2Response)
+	if invalid(req) {
+		logging.Printf("Invalid request %+v", req)
+		rsp.Reason = pb.AllowV2Response_INVALID_REQUEST
+		return rsp, nil
+	}
+
+	ctx = quotaservice.WithResponseMetadata(ctx)
+	ctx, details := quotaservice.WithAllowDetails(ctx)
+
+	tokensRequested := tokensRequested(req)
+	wait, dynamic, err := s.g.allow(ctx, req, tokensRequested)
+	rsp.Metadata = quotaservice.ResponseMetadataFromContext(ctx)
+	rsp.RemainingTokens, rsp.HasRemainingTokens = details.RemainingTokens, details.HasRemainingTokens
+
+	if err != nil {
+		rsp.Reason = pb.AllowV2Response_FAILED_OPEN
+		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok {
+			rsp.Reason = toPBReason(qsErr)
+		} else {
+			logging.Printf("Caught error %v", err)
+		}
+
+		if rsp.Reason != pb.AllowV2Response_FAILED_OPEN {
+			rsp.Message = err.Error()
+			return rsp, nil
+		}
+
+		// Fail open, as version 1 does, but say so.
+		s.g.producer.Emit(events.NewServerErrorEvent(req.Namespace, req.BucketName, dynamic))
+	} else if details.AllowListed {
+		rsp.Reason = pb.AllowV2Response_ALLOW_LISTED
+	}
+
+	rsp.Granted = true
+	rsp.Lease = &pb.Lease{
+		Tokens:              tokensRequested,
+		WaitMillis:          wait.Nanoseconds() / int64(time.Millisecond),
+		NotBeforeUnixMillis: time.Now().Add(wait).UnixNano() / int64(time.Millisecond)}
+
+	return rsp, nil
+}
+
+// AllowAll serves QuotaServiceV2.AllowAll, if the QuotaService implements
+// quotaservice.MultiBucketQuotaService. The lease covers the tokens requested from all buckets.
+func (s *v2Server) AllowAll(ctx context.Context, req *pb.AllowAllRequest) (*pb.AllowV2Response, error) {
+	if err := s.g.checkVersion(API_V2); err != nil {
+		return nil, err
+	}
+
+	qs, ok := s.g.qs.(quotaservice.MultiBucketQuotaService)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unimplemented, "AllowAll isn't supported by %T", s.g.qs)
+	}
+
+	rsp := new(pb.AllowV2Response)
+	if len(req.Buckets) == 0 {
+		logging.Printf("Invalid request %+v", req)
+		rsp.Reason = pb.AllowV2Response_INVALID_REQUEST
+		return rsp, nil
+	}
+
+	requests := make([]quotaservice.BucketTokens, len(req.Buckets))
+	var tokens int64
+	for i, b := range req.Buckets {
+		if b.Namespace == "" || b.BucketName == "" {
+			logging.Printf("Invalid request %+v", req)
+			rsp.Reason = pb.AllowV2Response_INVALID_REQUEST
+			return rsp, nil
+		}
+
+		requests[i] = quotaservice.BucketTokens{Namespace: b.Namespace, Name: b.BucketName, Tokens: b.TokensRequested}
+		if requests[i].Tokens <= 0 {
+			requests[i].Tokens = 1
+		}
+		tokens += requests[i].Tokens
+	}
+
+	maxWaitMillisOverride, maxWaitTimeOverride := req.MaxWaitMillisOverride, req.MaxWaitTimeOverride
+	if !maxWaitTimeOverride {
+		maxWaitMillisOverride, maxWaitTimeOverride = maxWaitFromDeadline(ctx)
+	}
+
+	wait, err := qs.AllowAll(ctx, requests, maxWaitMillisOverride, maxWaitTimeOverride)
+	if err != nil {
+		rsp.Reason = pb.AllowV2Response_FAILED_OPEN
+		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok {
+			rsp.Reason = toPBReason(qsErr)
+		} else {
+			logging.Printf("Caught error %v", err)
+		}
+
+		if rsp.Reason != pb.AllowV2Response_FAILED_OPEN {
+			rsp.Message = err.Error()
+			return rsp, nil
+		}
+
+		for _, b := range req.Buckets {
+			s.g.producer.Emit(events.NewServerErrorEvent(b.Namespace, b.BucketName, false))
+		}
+	}
+
+	rsp.Granted = true
+	rsp.Lease = &pb.Lease{
+		Tokens:              tokens,
+		WaitMillis:          wait.Nanoseconds() / int64(time.Millisecond),
+		NotBeforeUnixMillis: time.Now().Add(wait).UnixNano() / int64(time.Millisecond)}
+
+	return rsp, nil
+}
+
+func toPBReason(qsErr quotaservice.QuotaServiceError) pb.AllowV2Response_Reason {
+	switch qsErr.Reason {
+	case quotaservice.ER_NO_BUCKET:
+		return pb.AllowV2Response_NO_BUCKET
+	case quotaservice.ER_TOO_MANY_BUCKETS:
+		return pb.AllowV2Response_TOO_MANY_BUCKETS
+	case quotaservice.ER_TOO_MANY_TOKENS_REQUESTED:
+		return pb.AllowV2Response_TOO_MANY_TOKENS_REQUESTED
+	case quotaservice.ER_TIMEOUT:
+		return pb.AllowV2Response_TIMEOUT
+	case quotaservice.ER_OVERLOADED:
+		return pb.AllowV2Response_OVERLOADED
+	case quotaservice.ER_DENIED:
+		return pb.AllowV2Response_DENIED
+	default:
+		return pb.AllowV2Response_FAILED_OPEN
+	}
+}
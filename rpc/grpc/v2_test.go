@@ -0,0 +1,155 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func newV2TestServer(t *testing.T) (*v2Server, func()) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	nsc.DeniedBuckets = []string{"denied"}
+	nsc.AllowedBuckets = []string{"allowed"}
+	nsc.Metadata = map[string]string{"docs": "https://example.com/quotas"}
+	b := config.NewDefaultBucketConfig("b")
+	b.Size = proto.Int64(100)
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	g := New("localhost:0", events.NewNilProducer())
+	s := quotaservice.New(&qstesting.MockBucketFactory{}, config.NewMemoryConfig(cfg), qstesting.NewReaperConfig(), 0, g)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+
+	return &v2Server{g}, func() {
+		_, err := s.Stop()
+		helpers.CheckError(t, err)
+	}
+}
+
+func TestAllowV2Granted(t *testing.T) {
+	s, stop := newV2TestServer(t)
+	defer stop()
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	rsp, err := s.Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "b", TokensRequested: 2})
+	helpers.CheckError(t, err)
+
+	if !rsp.Granted || rsp.Reason != pb.AllowV2Response_GRANTED || rsp.Lease.GetTokens() != 2 || rsp.Lease.GetNotBeforeUnixMillis() < before {
+		t.Fatalf("Expected a lease on 2 tokens, got %+v", rsp)
+	}
+
+	if !rsp.HasRemainingTokens || rsp.RemainingTokens != 100 {
+		t.Fatalf("Expected 100 remaining tokens, got %+v", rsp)
+	}
+
+	if rsp.Metadata["docs"] != "https://example.com/quotas" {
+		t.Fatalf("Expected the namespace's metadata, got %v", rsp.Metadata)
+	}
+}
+
+func TestAllowV2Rejected(t *testing.T) {
+	s, stop := newV2TestServer(t)
+	defer stop()
+
+	rsp, err := s.Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "denied"})
+	helpers.CheckError(t, err)
+
+	if rsp.Granted || rsp.Reason != pb.AllowV2Response_DENIED || rsp.Message == "" || rsp.Lease != nil {
+		t.Fatalf("Expected the request to be denied, got %+v", rsp)
+	}
+
+	rsp, err = s.Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "allowed"})
+	helpers.CheckError(t, err)
+
+	if !rsp.Granted || rsp.Reason != pb.AllowV2Response_ALLOW_LISTED || rsp.HasRemainingTokens {
+		t.Fatalf("Expected the request to be allow-listed, got %+v", rsp)
+	}
+}
+
+func TestAllowAll(t *testing.T) {
+	s, stop := newV2TestServer(t)
+	defer stop()
+
+	rsp, err := s.AllowAll(context.Background(), &pb.AllowAllRequest{Buckets: []*pb.BucketTokens{
+		{Namespace: "ns", BucketName: "b", TokensRequested: 2}, {Namespace: "ns", BucketName: "allowed"}}})
+	helpers.CheckError(t, err)
+
+	if !rsp.Granted || rsp.Reason != pb.AllowV2Response_GRANTED || rsp.Lease.GetTokens() != 3 {
+		t.Fatalf("Expected a lease on 3 tokens, got %+v", rsp)
+	}
+
+	rsp, err = s.AllowAll(context.Background(), &pb.AllowAllRequest{Buckets: []*pb.BucketTokens{
+		{Namespace: "ns", BucketName: "b"}, {Namespace: "ns", BucketName: "denied"}}})
+	helpers.CheckError(t, err)
+
+	if rsp.Granted || rsp.Reason != pb.AllowV2Response_DENIED {
+		t.Fatalf("Expected the request to be denied, got %+v", rsp)
+	}
+
+	rsp, err = s.AllowAll(context.Background(), &pb.AllowAllRequest{})
+	helpers.CheckError(t, err)
+
+	if rsp.Granted || rsp.Reason != pb.AllowV2Response_INVALID_REQUEST {
+		t.Fatalf("Expected the request to be invalid, got %+v", rsp)
+	}
+
+	g := New("localhost:0", events.NewNilProducer())
+	g.Init(&failingQuotaService{})
+	if _, err := (&v2Server{g}).AllowAll(context.Background(), &pb.AllowAllRequest{}); grpc.Code(err) != codes.Unimplemented {
+		t.Fatalf("Expected AllowAll to be unimplemented, got %v", err)
+	}
+}
+
+func TestAllowV2FailsOpen(t *testing.T) {
+	g := New("localhost:0", events.NewNilProducer())
+	g.Init(&failingQuotaService{})
+
+	rsp, err := (&v2Server{g}).Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "b"})
+	helpers.CheckError(t, err)
+
+	if !rsp.Granted || rsp.Reason != pb.AllowV2Response_FAILED_OPEN {
+		t.Fatalf("Expected the request to fail open, got %+v", rsp)
+	}
+}
+
+func TestDisableVersions(t *testing.T) {
+	g, _ := newTestEndpoint()
+	g.DisableVersions(API_V1)
+
+	if _, err := g.Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "b"}); grpc.Code(err) != codes.Unimplemented {
+		t.Fatalf("Expected Allow v1 to be disabled, got %v", err)
+	}
+
+	rsp, err := (&v2Server{g}).Allow(context.Background(), &pb.AllowRequest{Namespace: "ns", BucketName: "b"})
+	helpers.CheckError(t, err)
+
+	if !rsp.Granted {
+		t.Fatalf("Expected Allow v2 to be served, got %+v", rsp)
+	}
+}
+
+type failingQuotaService struct{}
+
+func (f *failingQuotaService) Allow(context.Context, string, string, int64, int64, bool) (time.Duration, bool, error) {
+	return 0, false, errors.New("backend unavailable")
+}
+
+func (f *failingQuotaService) Charge(context.Context, string, string, int64, int64) error {
+	return nil
+}
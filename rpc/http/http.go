@@ -1,38 +1,260 @@
 // Licensed under the Apache License, Version 2.0
 // Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
 
+// Package http serves the quota service's Allow and Charge calls as JSON over HTTP, for clients
+// that can't use gRPC. Requests are POSTed to /allow and /charge, with the fields of the gRPC
+// requests, and responses carry the same statuses, by name.
 package http
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/square/quotaservice"
 	"github.com/square/quotaservice/lifecycle"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos"
 )
 
 const defaultPort = 80
 
 // HttpEndpoint is an HTTP-based implementation of an RPC endpoint
 type HttpEndpoint struct {
-	port          int
+	hostport      string
+	listener      net.Listener
+	server        *http.Server
+	mux           *http.ServeMux
 	currentStatus lifecycle.Status
 	qs            quotaservice.QuotaService
 }
 
+// AllowRequest is the body of a request to /allow.
+type AllowRequest struct {
+	Namespace             string `json:"namespace"`
+	BucketName            string `json:"bucket_name"`
+	TokensRequested       int64  `json:"tokens_requested,omitempty"`
+	MaxWaitMillisOverride int64  `json:"max_wait_millis_override,omitempty"`
+	MaxWaitTimeOverride   bool   `json:"max_wait_time_override,omitempty"`
+	RequestID             string `json:"request_id,omitempty"`
+	Strict                bool   `json:"strict,omitempty"`
+}
+
+// AllowResponse is the body of a response from /allow. Status is the name of a
+// pb.AllowResponse_Status, e.g. OK or REJECTED_TIMEOUT.
+type AllowResponse struct {
+	Status        string            `json:"status"`
+	TokensGranted int64             `json:"tokens_granted"`
+	WaitMillis    int64             `json:"wait_millis"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+}
+
+// ChargeRequest is the body of a request to /charge.
+type ChargeRequest struct {
+	Namespace      string `json:"namespace"`
+	BucketName     string `json:"bucket_name"`
+	TokensReserved int64  `json:"tokens_reserved"`
+	ActualCost     int64  `json:"actual_cost"`
+}
+
+// ChargeResponse is the body of a response from /charge. Status is the name of a
+// pb.ChargeResponse_Status.
+type ChargeResponse struct {
+	Status string `json:"status"`
+}
+
+// New creates a new HttpEndpoint, listening on port on all interfaces.
 func New(port int) *HttpEndpoint {
-	return &HttpEndpoint{port: port}
+	return NewWithAddress(fmt.Sprintf(":%v", port))
 }
 
 func NewDefault() *HttpEndpoint {
 	return New(defaultPort)
 }
 
+// NewWithAddress creates a new HttpEndpoint, listening on hostport. Hostport is a string in the
+// form "host:port"
+func NewWithAddress(hostport string) *HttpEndpoint {
+	if !strings.Contains(hostport, ":") {
+		panic(fmt.Sprintf("hostport should be in the format 'host:port', but is currently %v",
+			hostport))
+	}
+
+	return newEndpoint(hostport, nil)
+}
+
+// NewWithListener creates a new HttpEndpoint, accepting connections on a listener created by the
+// caller, e.g. with the sockets package, or on an ephemeral port in tests.
+func NewWithListener(lis net.Listener) *HttpEndpoint {
+	if lis == nil {
+		panic("listener was nil")
+	}
+
+	// Listeners on Unix domain sockets have addresses that aren't in the form "host:port".
+	return newEndpoint(lis.Addr().String(), lis)
+}
+
+func newEndpoint(hostport string, lis net.Listener) *HttpEndpoint {
+	h := &HttpEndpoint{hostport: hostport, listener: lis, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/allow", h.handleAllow)
+	h.mux.HandleFunc("/charge", h.handleCharge)
+	return h
+}
+
 func (h *HttpEndpoint) Init(qs quotaservice.QuotaService) {
 	h.qs = qs
 }
 
 func (h *HttpEndpoint) Start() {
+	lis := h.listener
+	if lis == nil {
+		var err error
+		if lis, err = net.Listen("tcp", h.hostport); err != nil {
+			logging.Fatalf("Cannot start server on port %v. Error %v", h.hostport, err)
+		}
+	}
+
+	h.server = &http.Server{Handler: h}
+	go func() {
+		if err := h.server.Serve(lis); err != nil && err != http.ErrServerClosed {
+			logging.Fatalf("Cannot start HTTP server. Error %v", err)
+		}
+	}()
+
 	h.currentStatus = lifecycle.Started
+	logging.Printf("Starting HTTP server on %v", h.hostport)
 }
 
 func (h *HttpEndpoint) Stop() {
+	if h.server != nil {
+		_ = h.server.Close()
+	}
+
 	h.currentStatus = lifecycle.Stopped
 }
+
+// ServeHTTP serves /allow and /charge.
+func (h *HttpEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *HttpEndpoint) handleAllow(w http.ResponseWriter, r *http.Request) {
+	var req AllowRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	rsp := &AllowResponse{}
+	if req.Namespace == "" || req.BucketName == "" {
+		logging.Printf("Invalid request %+v", req)
+		rsp.Status = pb.AllowResponse_REJECTED_INVALID_REQUEST.String()
+		writeJSON(w, rsp)
+		return
+	}
+
+	tokens := req.TokensRequested
+	if tokens <= 0 {
+		tokens = 1
+	}
+
+	ctx := quotaservice.WithResponseMetadata(r.Context())
+	ctx = quotaservice.WithRequestID(ctx, req.RequestID)
+	if req.Strict {
+		ctx = quotaservice.WithStrict(ctx)
+	}
+	ctx = quotaservice.WithCaller(ctx, r.RemoteAddr)
+
+	wait, _, err := h.qs.Allow(ctx, req.Namespace, req.BucketName, tokens, req.MaxWaitMillisOverride, req.MaxWaitTimeOverride)
+	rsp.Metadata = quotaservice.ResponseMetadataFromContext(ctx)
+	if err != nil {
+		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok {
+			rsp.Status = toPBStatus(qsErr).String()
+		} else {
+			logging.Printf("Caught error %v", err)
+			rsp.Status = pb.AllowResponse_REJECTED_SERVER_ERROR.String()
+		}
+
+		// If there's a server error, fail open, as the gRPC endpoint does.
+		if rsp.Status != pb.AllowResponse_REJECTED_SERVER_ERROR.String() {
+			writeJSON(w, rsp)
+			return
+		}
+	}
+
+	rsp.Status = pb.AllowResponse_OK.String()
+	rsp.TokensGranted = tokens
+	rsp.WaitMillis = wait.Nanoseconds() / int64(time.Millisecond)
+	writeJSON(w, rsp)
+}
+
+func (h *HttpEndpoint) handleCharge(w http.ResponseWriter, r *http.Request) {
+	var req ChargeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	rsp := &ChargeResponse{Status: pb.ChargeResponse_OK.String()}
+	if req.Namespace == "" || req.BucketName == "" || req.TokensReserved < 0 || req.ActualCost < 0 {
+		logging.Printf("Invalid request %+v", req)
+		rsp.Status = pb.ChargeResponse_REJECTED_INVALID_REQUEST.String()
+		writeJSON(w, rsp)
+		return
+	}
+
+	if err := h.qs.Charge(r.Context(), req.Namespace, req.BucketName, req.TokensReserved, req.ActualCost); err != nil {
+		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok && qsErr.Reason == quotaservice.ER_NO_BUCKET {
+			rsp.Status = pb.ChargeResponse_REJECTED_NO_BUCKET.String()
+		} else {
+			logging.Printf("Caught error %v", err)
+			rsp.Status = pb.ChargeResponse_REJECTED_SERVER_ERROR.String()
+		}
+	}
+
+	writeJSON(w, rsp)
+}
+
+// decode reads a JSON request body into v, responding with an error and returning false if the
+// request isn't a POST of valid JSON.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Printf("Couldn't write response: %v", err)
+	}
+}
+
+func toPBStatus(qsErr quotaservice.QuotaServiceError) pb.AllowResponse_Status {
+	switch qsErr.Reason {
+	case quotaservice.ER_NO_BUCKET:
+		return pb.AllowResponse_REJECTED_NO_BUCKET
+	case quotaservice.ER_TOO_MANY_BUCKETS:
+		return pb.AllowResponse_REJECTED_TOO_MANY_BUCKETS
+	case quotaservice.ER_TOO_MANY_TOKENS_REQUESTED:
+		return pb.AllowResponse_REJECTED_TOO_MANY_TOKENS_REQUESTED
+	case quotaservice.ER_TIMEOUT:
+		return pb.AllowResponse_REJECTED_TIMEOUT
+	case quotaservice.ER_OVERLOADED:
+		return pb.AllowResponse_REJECTED_OVERLOADED
+	case quotaservice.ER_DENIED:
+		return pb.AllowResponse_REJECTED_DENIED
+	default:
+		return pb.AllowResponse_REJECTED_SERVER_ERROR
+	}
+}
@@ -0,0 +1,143 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+type fakeQuotaService struct {
+	namespace, name string
+	tokens          int64
+	requestID       string
+	err             error
+}
+
+func (f *fakeQuotaService) Allow(ctx context.Context, namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (time.Duration, bool, error) {
+	f.namespace, f.name, f.tokens = namespace, name, tokensRequested
+	f.requestID = quotaservice.RequestIDFromContext(ctx)
+	return 20 * time.Millisecond, false, f.err
+}
+
+func (f *fakeQuotaService) Charge(ctx context.Context, namespace, name string, tokensReserved, actualCost int64) error {
+	f.namespace, f.name, f.tokens = namespace, name, actualCost-tokensReserved
+	return f.err
+}
+
+func newTestServer(qs quotaservice.QuotaService) *httptest.Server {
+	h := NewWithAddress("localhost:0")
+	h.Init(qs)
+	return httptest.NewServer(h)
+}
+
+func post(t *testing.T, url string, req, rsp interface{}) int {
+	b, err := json.Marshal(req)
+	helpers.CheckError(t, err)
+
+	r, err := http.Post(url, "application/json", bytes.NewReader(b))
+	helpers.CheckError(t, err)
+	defer func() { _ = r.Body.Close() }()
+
+	if r.StatusCode == http.StatusOK {
+		helpers.CheckError(t, json.NewDecoder(r.Body).Decode(rsp))
+	}
+
+	return r.StatusCode
+}
+
+func TestAllow(t *testing.T) {
+	qs := &fakeQuotaService{}
+	ts := newTestServer(qs)
+	defer ts.Close()
+
+	var rsp AllowResponse
+	post(t, ts.URL+"/allow", &AllowRequest{Namespace: "ns", BucketName: "b", RequestID: "id"}, &rsp)
+	if rsp.Status != "OK" || rsp.TokensGranted != 1 || rsp.WaitMillis != 20 {
+		t.Fatalf("Unexpected response %+v", rsp)
+	}
+
+	if qs.namespace != "ns" || qs.name != "b" || qs.tokens != 1 || qs.requestID != "id" {
+		t.Fatalf("Unexpected request %+v", qs)
+	}
+
+	post(t, ts.URL+"/allow", &AllowRequest{Namespace: "ns"}, &rsp)
+	if rsp.Status != "REJECTED_INVALID_REQUEST" {
+		t.Fatalf("Expected an invalid request, got %+v", rsp)
+	}
+
+	qs.err = quotaservice.QuotaServiceError{Reason: quotaservice.ER_TIMEOUT}
+	post(t, ts.URL+"/allow", &AllowRequest{Namespace: "ns", BucketName: "b", TokensRequested: 5}, &rsp)
+	if rsp.Status != "REJECTED_TIMEOUT" {
+		t.Fatalf("Expected a timeout, got %+v", rsp)
+	}
+
+	// Server errors fail open.
+	qs.err = errors.New("boom")
+	rsp = AllowResponse{}
+	post(t, ts.URL+"/allow", &AllowRequest{Namespace: "ns", BucketName: "b", TokensRequested: 5}, &rsp)
+	if rsp.Status != "OK" || rsp.TokensGranted != 5 {
+		t.Fatalf("Expected to fail open, got %+v", rsp)
+	}
+}
+
+func TestCharge(t *testing.T) {
+	qs := &fakeQuotaService{}
+	ts := newTestServer(qs)
+	defer ts.Close()
+
+	var rsp ChargeResponse
+	post(t, ts.URL+"/charge", &ChargeRequest{Namespace: "ns", BucketName: "b", TokensReserved: 5, ActualCost: 8}, &rsp)
+	if rsp.Status != "OK" || qs.tokens != 3 {
+		t.Fatalf("Unexpected response %+v for %+v", rsp, qs)
+	}
+
+	qs.err = quotaservice.QuotaServiceError{Reason: quotaservice.ER_NO_BUCKET}
+	post(t, ts.URL+"/charge", &ChargeRequest{Namespace: "ns", BucketName: "b"}, &rsp)
+	if rsp.Status != "REJECTED_NO_BUCKET" {
+		t.Fatalf("Expected no bucket, got %+v", rsp)
+	}
+}
+
+func TestInvalidHTTPRequests(t *testing.T) {
+	ts := newTestServer(&fakeQuotaService{})
+	defer ts.Close()
+
+	r, err := http.Get(ts.URL + "/allow")
+	helpers.CheckError(t, err)
+	_ = r.Body.Close()
+	if r.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected GETs to be rejected, got %v", r.Status)
+	}
+
+	if code := post(t, ts.URL+"/allow", "not a request", nil); code != http.StatusBadRequest {
+		t.Fatalf("Expected a bad request, got %v", code)
+	}
+}
+
+func TestListener(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	helpers.CheckError(t, err)
+
+	h := NewWithListener(lis)
+	h.Init(&fakeQuotaService{})
+	h.Start()
+	defer h.Stop()
+
+	var rsp AllowResponse
+	post(t, "http://"+lis.Addr().String()+"/allow", &AllowRequest{Namespace: "ns", BucketName: "b"}, &rsp)
+	if rsp.Status != "OK" {
+		t.Fatalf("Expected the request to be served on the listener, got %+v", rsp)
+	}
+}
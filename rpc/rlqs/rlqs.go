@@ -0,0 +1,264 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package rlqs implements the rate limit quota service, envoy.service.rate_limit_quota.v3, as an
+// RPC endpoint, so that Envoy and gRPC clients with built-in RLQS support can use the quota service
+// without custom interceptors. Clients enforce quotas locally, and periodically report each
+// bucket's usage over a stream. In response, the endpoint leases tokens from the matching quota
+// service bucket, sized to the client's recent demand, and assigns them to the client as a token
+// bucket refilled once per reporting interval.
+package rlqs
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/lifecycle"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos/rlqs"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Config maps RLQS domains and bucket IDs to namespaces and buckets.
+type Config struct {
+	// Namespaces maps domains to namespaces. Domains that aren't mapped are used as namespaces.
+	Namespaces map[string]string
+	// BucketKey is the key in bucket IDs whose value names the bucket. Bucket IDs without it are
+	// named by joining their keys and values, sorted by key, with underscores, and replacing
+	// characters that aren't valid in bucket names with underscores.
+	BucketKey string
+	// AssignmentTTL is how long clients may use an assignment without receiving a new one, e.g. if
+	// the quota service is unreachable.
+	AssignmentTTL time.Duration
+	// ReportingInterval is assumed to be the clients' reporting interval, for reports that don't say
+	// how much time they cover.
+	ReportingInterval time.Duration
+}
+
+// NewDefaultConfig creates a Config with sensible defaults.
+func NewDefaultConfig() Config {
+	return Config{
+		BucketKey:         "name",
+		AssignmentTTL:     time.Minute,
+		ReportingInterval: 5 * time.Second}
+}
+
+// RLQSEndpoint serves the rate limit quota service over gRPC.
+type RLQSEndpoint struct {
+	hostport      string
+	listener      net.Listener
+	cfg           Config
+	grpcServer    *grpc.Server
+	currentStatus lifecycle.Status
+	qs            quotaservice.QuotaService
+}
+
+// New creates a new RLQSEndpoint, listening on hostport. Hostport is a string in the form
+// "host:port"
+func New(hostport string, cfg Config) *RLQSEndpoint {
+	if !strings.Contains(hostport, ":") {
+		panic(fmt.Sprintf("hostport should be in the format 'host:port', but is currently %v",
+			hostport))
+	}
+
+	if cfg.AssignmentTTL <= 0 || cfg.ReportingInterval <= 0 {
+		panic("AssignmentTTL and ReportingInterval must be positive")
+	}
+
+	return &RLQSEndpoint{hostport: hostport, cfg: cfg}
+}
+
+// NewWithListener creates a new RLQSEndpoint, accepting connections on a listener created by the
+// caller, e.g. with the sockets package, or on an ephemeral port in tests.
+func NewWithListener(lis net.Listener, cfg Config) *RLQSEndpoint {
+	if lis == nil {
+		panic("listener was nil")
+	}
+
+	if cfg.AssignmentTTL <= 0 || cfg.ReportingInterval <= 0 {
+		panic("AssignmentTTL and ReportingInterval must be positive")
+	}
+
+	return &RLQSEndpoint{hostport: lis.Addr().String(), listener: lis, cfg: cfg}
+}
+
+func (e *RLQSEndpoint) Init(qs quotaservice.QuotaService) {
+	e.qs = qs
+}
+
+func (e *RLQSEndpoint) Start() {
+	lis := e.listener
+	if lis == nil {
+		var err error
+		if lis, err = net.Listen("tcp", e.hostport); err != nil {
+			logging.Fatalf("Cannot start server on port %v. Error %v", e.hostport, err)
+		}
+	}
+
+	e.grpcServer = grpc.NewServer()
+	pb.RegisterRateLimitQuotaServiceServer(e.grpcServer, e)
+	go func() {
+		if err := e.grpcServer.Serve(lis); err != nil {
+			logging.Fatalf("Cannot start RLQS server. Error %v", err)
+		}
+	}()
+
+	e.currentStatus = lifecycle.Started
+	logging.Printf("Starting RLQS server on %v", e.hostport)
+}
+
+func (e *RLQSEndpoint) Stop() {
+	e.currentStatus = lifecycle.Stopped
+}
+
+// StreamRateLimitQuotas responds to each usage report on the stream with an action for every
+// bucket reported on.
+func (e *RLQSEndpoint) StreamRateLimitQuotas(stream pb.RateLimitQuotaService_StreamRateLimitQuotasServer) error {
+	namespace := ""
+
+	for {
+		reports, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if namespace == "" {
+			// The domain is only set in the first report.
+			if reports.Domain == "" {
+				return grpc.Errorf(codes.InvalidArgument, "the first report on a stream must set a domain")
+			}
+
+			namespace = reports.Domain
+			if ns, ok := e.cfg.Namespaces[reports.Domain]; ok {
+				namespace = ns
+			}
+		}
+
+		rsp := &pb.RateLimitQuotaResponse{}
+		for _, usage := range reports.BucketQuotaUsages {
+			rsp.BucketAction = append(rsp.BucketAction, e.assign(stream.Context(), namespace, usage))
+		}
+
+		if err := stream.Send(rsp); err != nil {
+			return err
+		}
+	}
+}
+
+// assign leases tokens for a client's next reporting interval, returning the action for the
+// bucket. Clients are abandoned, falling back to their configured default behavior, for buckets
+// that don't exist, and fail open on server errors.
+func (e *RLQSEndpoint) assign(ctx context.Context, namespace string, usage *pb.BucketQuotaUsage) *pb.BucketAction {
+	action := &pb.BucketAction{BucketId: usage.BucketId}
+	name := e.bucketName(usage.BucketId)
+
+	interval := e.cfg.ReportingInterval
+	if d := usage.TimeElapsed; d != nil && (d.Seconds > 0 || d.Nanos > 0) {
+		interval = time.Duration(d.Seconds)*time.Second + time.Duration(d.Nanos)
+	}
+
+	demand := int64(usage.NumRequestsAllowed + usage.NumRequestsDenied)
+	if demand < 1 {
+		demand = 1
+	}
+
+	granted, err := e.lease(ctx, namespace, name, demand)
+	strategy := &pb.RateLimitStrategy{}
+
+	if qsErr, ok := err.(quotaservice.QuotaServiceError); ok {
+		switch qsErr.Reason {
+		case quotaservice.ER_NO_BUCKET, quotaservice.ER_TOO_MANY_BUCKETS:
+			action.AbandonAction = &pb.AbandonAction{}
+			return action
+		case quotaservice.ER_DENIED, quotaservice.ER_OVERLOADED:
+			granted = 0
+		}
+	} else if err != nil {
+		logging.Printf("Caught error %v", err)
+		granted = demand
+	}
+
+	if granted == 0 {
+		strategy.BlanketRule = pb.RateLimitStrategy_DENY_ALL
+	} else {
+		strategy.TokenBucket = &pb.TokenBucket{
+			MaxTokens:     uint32(granted),
+			TokensPerFill: &pb.UInt32Value{Value: uint32(granted)},
+			FillInterval:  toDuration(interval)}
+	}
+
+	action.QuotaAssignmentAction = &pb.QuotaAssignmentAction{
+		AssignmentTimeToLive: toDuration(e.cfg.AssignmentTTL),
+		RateLimitStrategy:    strategy}
+	return action
+}
+
+// lease takes up to demand tokens from a bucket, without waiting, backing off to smaller leases if
+// the bucket can't satisfy the demand. Returns 0 if not even 1 token is available. Errors other
+// than timeouts are returned as is.
+func (e *RLQSEndpoint) lease(ctx context.Context, namespace, name string, demand int64) (int64, error) {
+	if demand > 1<<31 {
+		demand = 1 << 31
+	}
+
+	for n := demand; ; n /= 4 {
+		if n < 1 {
+			n = 1
+		}
+
+		_, _, err := e.qs.Allow(ctx, namespace, name, n, 0, true)
+		if err == nil {
+			return n, nil
+		}
+
+		qsErr, ok := err.(quotaservice.QuotaServiceError)
+		if !ok || (qsErr.Reason != quotaservice.ER_TIMEOUT && qsErr.Reason != quotaservice.ER_TOO_MANY_TOKENS_REQUESTED) {
+			return 0, err
+		}
+
+		if n == 1 {
+			return 0, nil
+		}
+	}
+}
+
+var invalidBucketChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+func (e *RLQSEndpoint) bucketName(id *pb.BucketId) string {
+	if id == nil {
+		return ""
+	}
+
+	if name, ok := id.Bucket[e.cfg.BucketKey]; ok && e.cfg.BucketKey != "" {
+		return name
+	}
+
+	keys := make([]string, 0, len(id.Bucket))
+	for k := range id.Bucket {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		parts = append(parts, k, id.Bucket[k])
+	}
+
+	return invalidBucketChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+}
+
+func toDuration(d time.Duration) *pb.Duration {
+	return &pb.Duration{Seconds: int64(d / time.Second), Nanos: int32(d % time.Second)}
+}
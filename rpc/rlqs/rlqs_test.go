@@ -0,0 +1,180 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package rlqs
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	pb "github.com/square/quotaservice/protos/rlqs"
+	"github.com/square/quotaservice/test/helpers"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// fakeQuotaService grants requests for up to the tokens available in each bucket, failing those for
+// buckets in errs.
+type fakeQuotaService struct {
+	available map[string]int64
+	errs      map[string]error
+}
+
+func (qs *fakeQuotaService) Allow(_ context.Context, namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (time.Duration, bool, error) {
+	if maxWaitMillisOverride != 0 || !maxWaitTimeOverride {
+		return 0, false, errors.New("expected no waiting")
+	}
+
+	fqn := config.FullyQualifiedName(namespace, name)
+	if err := qs.errs[fqn]; err != nil {
+		return 0, false, err
+	}
+
+	if tokensRequested > qs.available[fqn] {
+		return 0, false, quotaservice.QuotaServiceError{Reason: quotaservice.ER_TIMEOUT}
+	}
+
+	qs.available[fqn] -= tokensRequested
+	return 0, false, nil
+}
+
+func (qs *fakeQuotaService) Charge(_ context.Context, _, _ string, _, _ int64) error {
+	return nil
+}
+
+// fakeStream replays reports, recording responses.
+type fakeStream struct {
+	reports   []*pb.RateLimitQuotaUsageReports
+	responses []*pb.RateLimitQuotaResponse
+	grpc.ServerStream
+}
+
+func (s *fakeStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeStream) Recv() (*pb.RateLimitQuotaUsageReports, error) {
+	if len(s.reports) == 0 {
+		return nil, io.EOF
+	}
+
+	r := s.reports[0]
+	s.reports = s.reports[1:]
+	return r, nil
+}
+
+func (s *fakeStream) Send(rsp *pb.RateLimitQuotaResponse) error {
+	s.responses = append(s.responses, rsp)
+	return nil
+}
+
+func usage(bucket map[string]string, allowed, denied uint64) *pb.BucketQuotaUsage {
+	return &pb.BucketQuotaUsage{
+		BucketId:           &pb.BucketId{Bucket: bucket},
+		TimeElapsed:        &pb.Duration{Seconds: 2},
+		NumRequestsAllowed: allowed,
+		NumRequestsDenied:  denied}
+}
+
+func TestStreamRateLimitQuotas(t *testing.T) {
+	qs := &fakeQuotaService{
+		available: map[string]int64{"ns:plenty": 1000, "ns:scarce": 30, "ns:empty": 0},
+		errs: map[string]error{
+			"ns:missing":  quotaservice.QuotaServiceError{Reason: quotaservice.ER_NO_BUCKET},
+			"ns:erroring": errors.New("redis is down")}}
+	cfg := NewDefaultConfig()
+	cfg.Namespaces = map[string]string{"envoy": "ns"}
+	e := New("localhost:0", cfg)
+	e.Init(qs)
+
+	stream := &fakeStream{reports: []*pb.RateLimitQuotaUsageReports{
+		{Domain: "envoy", BucketQuotaUsages: []*pb.BucketQuotaUsage{
+			usage(map[string]string{"name": "plenty"}, 80, 20),
+			usage(map[string]string{"name": "scarce"}, 100, 0),
+			usage(map[string]string{"name": "empty"}, 0, 0),
+			usage(map[string]string{"name": "missing"}, 5, 0),
+			usage(map[string]string{"name": "erroring"}, 5, 0)}},
+		{BucketQuotaUsages: []*pb.BucketQuotaUsage{
+			usage(map[string]string{"name": "plenty"}, 0, 0)}}}}
+
+	helpers.CheckError(t, e.StreamRateLimitQuotas(stream))
+
+	if len(stream.responses) != 2 {
+		t.Fatalf("Expected 2 responses, got %v", len(stream.responses))
+	}
+
+	actions := stream.responses[0].BucketAction
+	if len(actions) != 5 {
+		t.Fatalf("Expected 5 actions, got %v", len(actions))
+	}
+
+	// plenty: the whole demand is leased, refilled every reporting interval.
+	tb := actions[0].QuotaAssignmentAction.RateLimitStrategy.TokenBucket
+	if tb.MaxTokens != 100 || tb.TokensPerFill.Value != 100 || tb.FillInterval.Seconds != 2 {
+		t.Errorf("Unexpected token bucket %+v", tb)
+	}
+
+	if ttl := actions[0].QuotaAssignmentAction.AssignmentTimeToLive; ttl.Seconds != 60 {
+		t.Errorf("Expected a TTL of 60s, got %+v", ttl)
+	}
+
+	if actions[0].BucketId.Bucket["name"] != "plenty" {
+		t.Errorf("Expected the bucket ID to be echoed, got %+v", actions[0].BucketId)
+	}
+
+	// scarce: backs off to a quarter of the demand.
+	if tb := actions[1].QuotaAssignmentAction.RateLimitStrategy.TokenBucket; tb.MaxTokens != 25 {
+		t.Errorf("Expected 25 tokens, got %+v", tb)
+	}
+
+	// empty: not even a single token is available.
+	if s := actions[2].QuotaAssignmentAction.RateLimitStrategy; s.TokenBucket != nil || s.BlanketRule != pb.RateLimitStrategy_DENY_ALL {
+		t.Errorf("Expected DENY_ALL, got %+v", s)
+	}
+
+	if actions[3].AbandonAction == nil || actions[3].QuotaAssignmentAction != nil {
+		t.Errorf("Expected missing bucket to be abandoned, got %+v", actions[3])
+	}
+
+	// erroring: fails open.
+	if tb := actions[4].QuotaAssignmentAction.RateLimitStrategy.TokenBucket; tb == nil || tb.MaxTokens != 5 {
+		t.Errorf("Expected 5 tokens, got %+v", tb)
+	}
+
+	// An idle bucket still gets a token, so that clients can tell when demand resumes.
+	if tb := stream.responses[1].BucketAction[0].QuotaAssignmentAction.RateLimitStrategy.TokenBucket; tb.MaxTokens != 1 {
+		t.Errorf("Expected 1 token, got %+v", tb)
+	}
+
+	if qs.available["ns:plenty"] != 899 {
+		t.Errorf("Expected 899 tokens left, got %v", qs.available["ns:plenty"])
+	}
+}
+
+func TestStreamRequiresDomain(t *testing.T) {
+	e := New("localhost:0", NewDefaultConfig())
+	e.Init(&fakeQuotaService{})
+
+	stream := &fakeStream{reports: []*pb.RateLimitQuotaUsageReports{
+		{BucketQuotaUsages: []*pb.BucketQuotaUsage{usage(map[string]string{"name": "b"}, 1, 0)}}}}
+
+	if err := e.StreamRateLimitQuotas(stream); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestBucketName(t *testing.T) {
+	e := New("localhost:0", NewDefaultConfig())
+
+	if n := e.bucketName(&pb.BucketId{Bucket: map[string]string{"name": "b", "path": "/x"}}); n != "b" {
+		t.Errorf("Expected b, got %v", n)
+	}
+
+	if n := e.bucketName(&pb.BucketId{Bucket: map[string]string{"path": "/api", "method": "GET"}}); n != "method_GET_path__api" {
+		t.Errorf("Expected method_GET_path__api, got %v", n)
+	}
+}
@@ -0,0 +1,8 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package sockets
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,7 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package sockets
+
+// soReusePort is SO_REUSEPORT, which the syscall package doesn't define on Linux.
+const soReusePort = 0xf
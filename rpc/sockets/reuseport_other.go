@@ -0,0 +1,16 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package sockets
+
+import (
+	"errors"
+	"runtime"
+)
+
+func setReusePort(_ uintptr) error {
+	return errors.New("SO_REUSEPORT isn't supported on " + runtime.GOOS)
+}
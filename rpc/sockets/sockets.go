@@ -0,0 +1,67 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package sockets creates listeners for RPC endpoints that can't simply listen on an address, such
+// as several acceptor processes sharing a port, or processes started by systemd socket activation.
+// Endpoints are passed the listeners created with their NewWithListener constructors.
+package sockets
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+// ListenReusePort listens on address with SO_REUSEPORT set, so that several processes, such as a
+// quota service's replacement during a restart, can accept connections on the same port, with the
+// kernel balancing connections between them. Only supported on Linux and macOS.
+func ListenReusePort(network, address string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: func(_, _ string, c syscall.RawConn) error {
+		var err error
+		if cErr := c.Control(func(fd uintptr) { err = setReusePort(fd) }); cErr != nil {
+			return cErr
+		}
+
+		return err
+	}}
+
+	return lc.Listen(context.Background(), network, address)
+}
+
+// SystemdListeners returns the listeners passed to the process by systemd socket activation, in the
+// order their sockets are listed in the socket unit. Returns no listeners if the process wasn't
+// socket activated.
+func SystemdListeners() ([]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%v", fd))
+		// FileListener duplicates the descriptor, so the file is closed either way.
+		lis, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("file descriptor %v isn't a listening socket: %v", fd, err)
+		}
+
+		listeners = append(listeners, lis)
+	}
+
+	return listeners, nil
+}
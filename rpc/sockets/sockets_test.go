@@ -0,0 +1,56 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package sockets
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestListenReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("SO_REUSEPORT isn't supported on " + runtime.GOOS)
+	}
+
+	first, err := ListenReusePort("tcp", "127.0.0.1:0")
+	helpers.CheckError(t, err)
+	defer func() { _ = first.Close() }()
+
+	second, err := ListenReusePort("tcp", first.Addr().String())
+	helpers.CheckError(t, err)
+	_ = second.Close()
+}
+
+func TestSystemdListeners(t *testing.T) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+	}()
+
+	if listeners, err := SystemdListeners(); err != nil || listeners != nil {
+		t.Fatalf("Expected no listeners without socket activation, got %v, %v", listeners, err)
+	}
+
+	// Sockets passed to another process are ignored.
+	helpers.CheckError(t, os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1)))
+	helpers.CheckError(t, os.Setenv("LISTEN_FDS", "1"))
+	if listeners, err := SystemdListeners(); err != nil || listeners != nil {
+		t.Fatalf("Expected no listeners for another process, got %v, %v", listeners, err)
+	}
+
+	helpers.CheckError(t, os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid())))
+	helpers.CheckError(t, os.Setenv("LISTEN_FDS", "none"))
+	if _, err := SystemdListeners(); err == nil {
+		t.Fatal("Expected an error for an invalid LISTEN_FDS")
+	}
+
+	helpers.CheckError(t, os.Setenv("LISTEN_FDS", "0"))
+	if listeners, err := SystemdListeners(); err != nil || len(listeners) != 0 {
+		t.Fatalf("Expected no listeners, got %v, %v", listeners, err)
+	}
+}
@@ -0,0 +1,317 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package thrift
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Thrift binary protocol field types.
+const (
+	typeStop   byte = 0
+	typeBool   byte = 2
+	typeByte   byte = 3
+	typeDouble byte = 4
+	typeI16    byte = 6
+	typeI32    byte = 8
+	typeI64    byte = 10
+	typeString byte = 11
+	typeStruct byte = 12
+	typeMap    byte = 13
+	typeSet    byte = 14
+	typeList   byte = 15
+)
+
+// Thrift message types.
+const (
+	messageCall      byte = 1
+	messageReply     byte = 2
+	messageException byte = 3
+)
+
+// TApplicationException types.
+const (
+	exceptionUnknownMethod  int32 = 1
+	exceptionInvalidMessage int32 = 2
+	exceptionProtocolError  int32 = 7
+)
+
+const (
+	versionMask = 0xffff0000
+	version1    = 0x80010000
+	// maxFrameSize bounds the frames read from clients.
+	maxFrameSize = 1 << 20
+	// maxDepth bounds the nesting of skipped values.
+	maxDepth = 64
+)
+
+var errInvalidData = errors.New("invalid thrift data")
+
+// readFrame reads a frame of the framed transport: a 4 byte, big endian length, followed by that
+// many bytes.
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxFrameSize {
+		return nil, errInvalidData
+	}
+
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+func writeFrame(w io.Writer, frame []byte) error {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(frame)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// decoder reads values in the binary protocol from a frame.
+type decoder struct {
+	b []byte
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.b) {
+		return nil, errInvalidData
+	}
+
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *decoder) readByte() (byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+func (d *decoder) readBool() (bool, error) {
+	b, err := d.readByte()
+	return b != 0, err
+}
+
+func (d *decoder) readI16() (int16, error) {
+	b, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (d *decoder) readI32() (int32, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *decoder) readI64() (int64, error) {
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (d *decoder) readString() (string, error) {
+	n, err := d.readI32()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := d.next(int(n))
+	return string(b), err
+}
+
+// readMessageBegin reads a message header, in either the strict or the old, non-strict format.
+func (d *decoder) readMessageBegin() (name string, typ byte, seqID int32, err error) {
+	v, err := d.readI32()
+	if err != nil {
+		return
+	}
+
+	if v < 0 {
+		if uint32(v)&versionMask != version1 {
+			err = errInvalidData
+			return
+		}
+
+		typ = byte(v)
+		if name, err = d.readString(); err != nil {
+			return
+		}
+	} else {
+		var b []byte
+		if b, err = d.next(int(v)); err != nil {
+			return
+		}
+
+		name = string(b)
+		if typ, err = d.readByte(); err != nil {
+			return
+		}
+	}
+
+	seqID, err = d.readI32()
+	return
+}
+
+// readFieldBegin reads a field header, returning typeStop at the end of a struct.
+func (d *decoder) readFieldBegin() (typ byte, id int16, err error) {
+	if typ, err = d.readByte(); err != nil || typ == typeStop {
+		return
+	}
+
+	id, err = d.readI16()
+	return
+}
+
+// skip skips a value of the given type, e.g. an unknown field.
+func (d *decoder) skip(typ byte, depth int) error {
+	if depth > maxDepth {
+		return errInvalidData
+	}
+
+	var err error
+	switch typ {
+	case typeBool, typeByte:
+		_, err = d.next(1)
+	case typeI16:
+		_, err = d.next(2)
+	case typeI32:
+		_, err = d.next(4)
+	case typeDouble, typeI64:
+		_, err = d.next(8)
+	case typeString:
+		_, err = d.readString()
+	case typeStruct:
+		for {
+			ft, _, err := d.readFieldBegin()
+			if err != nil || ft == typeStop {
+				return err
+			}
+
+			if err := d.skip(ft, depth+1); err != nil {
+				return err
+			}
+		}
+	case typeMap:
+		var kt, vt byte
+		var n int32
+		if kt, err = d.readByte(); err != nil {
+			return err
+		}
+		if vt, err = d.readByte(); err != nil {
+			return err
+		}
+		if n, err = d.readI32(); err != nil {
+			return err
+		}
+
+		for i := int32(0); i < n; i++ {
+			if err := d.skip(kt, depth+1); err != nil {
+				return err
+			}
+			if err := d.skip(vt, depth+1); err != nil {
+				return err
+			}
+		}
+	case typeSet, typeList:
+		var et byte
+		var n int32
+		if et, err = d.readByte(); err != nil {
+			return err
+		}
+		if n, err = d.readI32(); err != nil {
+			return err
+		}
+
+		for i := int32(0); i < n; i++ {
+			if err := d.skip(et, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		err = errInvalidData
+	}
+
+	return err
+}
+
+// encoder writes values in the binary protocol.
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) writeI16(v int16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	e.Write(b[:])
+}
+
+func (e *encoder) writeI32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	e.Write(b[:])
+}
+
+func (e *encoder) writeI64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.Write(b[:])
+}
+
+func (e *encoder) writeBool(v bool) {
+	if v {
+		e.WriteByte(1)
+	} else {
+		e.WriteByte(0)
+	}
+}
+
+func (e *encoder) writeString(v string) {
+	e.writeI32(int32(len(v)))
+	e.WriteString(v)
+}
+
+// writeMessageBegin writes a message header in the strict format.
+func (e *encoder) writeMessageBegin(name string, typ byte, seqID int32) {
+	e.writeI32(int32(uint32(version1) | uint32(typ)))
+	e.writeString(name)
+	e.writeI32(seqID)
+}
+
+func (e *encoder) writeFieldBegin(typ byte, id int16) {
+	e.WriteByte(typ)
+	e.writeI16(id)
+}
+
+func (e *encoder) writeFieldStop() {
+	e.WriteByte(typeStop)
+}
@@ -0,0 +1,323 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package thrift implements the quota service's Allow API over Apache Thrift, as an RPC endpoint,
+// for clients that haven't adopted gRPC. The service is defined in
+// protos/thrift/quota_service.thrift, and served over the framed transport and binary protocol,
+// so clients generated from that file with any Thrift compiler can call it. Requests are handled
+// as they are by the gRPC endpoint.
+//
+// The protocol is implemented directly, rather than with the Thrift library, so that the quota
+// service doesn't depend on it.
+package thrift
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/lifecycle"
+	"github.com/square/quotaservice/logging"
+	pb "github.com/square/quotaservice/protos"
+	"golang.org/x/net/context"
+)
+
+// AllowRequest mirrors AllowRequest in quota_service.thrift.
+type AllowRequest struct {
+	Namespace             string
+	BucketName            string
+	TokensRequested       int64
+	MaxWaitMillisOverride int64
+	MaxWaitTimeOverride   bool
+	RequestID             string
+}
+
+// AllowResponse mirrors AllowResponse in quota_service.thrift. Statuses have the same values as
+// in the gRPC API.
+type AllowResponse struct {
+	Status        pb.AllowResponse_Status
+	TokensGranted int64
+	WaitMillis    int64
+}
+
+type ThriftEndpoint struct {
+	hostport      string
+	listener      net.Listener
+	currentStatus lifecycle.Status
+	qs            quotaservice.QuotaService
+	producer      *events.EventProducer
+	stopped       chan struct{}
+	stopOnce      sync.Once
+}
+
+// New creates a new ThriftEndpoint, listening on hostport. Hostport is a string in the form
+// "host:port"
+func New(hostport string, producer *events.EventProducer) *ThriftEndpoint {
+	if producer == nil {
+		panic("producer was nil")
+	}
+
+	if !strings.Contains(hostport, ":") {
+		panic(fmt.Sprintf("hostport should be in the format 'host:port', but is currently %v",
+			hostport))
+	}
+
+	return &ThriftEndpoint{hostport: hostport, producer: producer, stopped: make(chan struct{})}
+}
+
+// NewWithListener creates a new ThriftEndpoint, accepting connections on a listener created by the
+// caller, e.g. with the sockets package, or on an ephemeral port in tests.
+func NewWithListener(lis net.Listener, producer *events.EventProducer) *ThriftEndpoint {
+	if producer == nil {
+		panic("producer was nil")
+	}
+
+	if lis == nil {
+		panic("listener was nil")
+	}
+
+	return &ThriftEndpoint{hostport: lis.Addr().String(), listener: lis, producer: producer, stopped: make(chan struct{})}
+}
+
+func (t *ThriftEndpoint) Init(qs quotaservice.QuotaService) {
+	t.qs = qs
+}
+
+func (t *ThriftEndpoint) Start() {
+	if t.listener == nil {
+		lis, err := net.Listen("tcp", t.hostport)
+		if err != nil {
+			logging.Fatalf("Cannot start server on port %v. Error %v", t.hostport, err)
+		}
+
+		t.listener = lis
+	}
+
+	go t.serve(t.listener)
+
+	t.currentStatus = lifecycle.Started
+	logging.Printf("Starting Thrift server on %v", t.hostport)
+}
+
+func (t *ThriftEndpoint) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopped)
+		if t.listener != nil {
+			_ = t.listener.Close()
+		}
+	})
+
+	t.currentStatus = lifecycle.Stopped
+}
+
+func (t *ThriftEndpoint) serve(lis net.Listener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			select {
+			case <-t.stopped:
+			default:
+				logging.Printf("Thrift server stopped accepting connections. Error %v", err)
+			}
+
+			return
+		}
+
+		go t.serveConn(conn)
+	}
+}
+
+// serveConn handles calls on a connection until the client closes it, or sends something that
+// isn't a valid call.
+func (t *ThriftEndpoint) serveConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	ctx := quotaservice.WithCaller(context.Background(), conn.RemoteAddr().String())
+
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			return
+		}
+
+		reply, ok := t.handle(ctx, frame)
+		if err := writeFrame(conn, reply); err != nil || !ok {
+			return
+		}
+	}
+}
+
+// handle decodes and dispatches a call, returning the reply. Returns false if the connection should
+// be closed after replying.
+func (t *ThriftEndpoint) handle(ctx context.Context, frame []byte) ([]byte, bool) {
+	d := &decoder{b: frame}
+	name, typ, seqID, err := d.readMessageBegin()
+	if err != nil {
+		return exception(name, seqID, exceptionProtocolError, err.Error()), false
+	}
+
+	if typ != messageCall {
+		return exception(name, seqID, exceptionInvalidMessage, "expected a call"), false
+	}
+
+	if name != "allow" {
+		return exception(name, seqID, exceptionUnknownMethod, "unknown method "+name), true
+	}
+
+	req, err := readAllowArgs(d)
+	if err != nil {
+		return exception(name, seqID, exceptionProtocolError, err.Error()), false
+	}
+
+	rsp := t.Allow(ctx, req)
+
+	e := &encoder{}
+	e.writeMessageBegin(name, messageReply, seqID)
+	// The result struct: field 0 is the return value.
+	e.writeFieldBegin(typeStruct, 0)
+	writeAllowResponse(e, rsp)
+	e.writeFieldStop()
+	return e.Bytes(), true
+}
+
+// Allow handles a request as the gRPC endpoint does.
+func (t *ThriftEndpoint) Allow(ctx context.Context, req *AllowRequest) *AllowResponse {
+	rsp := new(AllowResponse)
+	if req.BucketName == "" || req.Namespace == "" {
+		logging.Printf("Invalid request %+v", req)
+		rsp.Status = pb.AllowResponse_REJECTED_INVALID_REQUEST
+		return rsp
+	}
+
+	var tokensRequested int64 = 1
+	if req.TokensRequested > 0 {
+		tokensRequested = req.TokensRequested
+	}
+
+	ctx = quotaservice.WithRequestID(ctx, req.RequestID)
+	wait, dynamic, err := t.qs.Allow(ctx, req.Namespace, req.BucketName, tokensRequested, req.MaxWaitMillisOverride, req.MaxWaitTimeOverride)
+
+	if err != nil {
+		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok {
+			rsp.Status = toStatus(qsErr)
+		} else {
+			logging.Printf("Caught error %v", err)
+			rsp.Status = pb.AllowResponse_REJECTED_SERVER_ERROR
+		}
+
+		// If there's a server error, fail open. Otherwise, return the status as is
+		if rsp.Status != pb.AllowResponse_REJECTED_SERVER_ERROR {
+			return rsp
+		}
+
+		t.producer.Emit(events.NewServerErrorEvent(req.Namespace, req.BucketName, dynamic))
+	}
+
+	rsp.Status = pb.AllowResponse_OK
+	rsp.TokensGranted = req.TokensRequested
+	rsp.WaitMillis = wait.Nanoseconds() / int64(time.Millisecond)
+
+	return rsp
+}
+
+func toStatus(qsErr quotaservice.QuotaServiceError) pb.AllowResponse_Status {
+	switch qsErr.Reason {
+	case quotaservice.ER_NO_BUCKET:
+		return pb.AllowResponse_REJECTED_NO_BUCKET
+	case quotaservice.ER_TOO_MANY_BUCKETS:
+		return pb.AllowResponse_REJECTED_TOO_MANY_BUCKETS
+	case quotaservice.ER_TOO_MANY_TOKENS_REQUESTED:
+		return pb.AllowResponse_REJECTED_TOO_MANY_TOKENS_REQUESTED
+	case quotaservice.ER_TIMEOUT:
+		return pb.AllowResponse_REJECTED_TIMEOUT
+	case quotaservice.ER_OVERLOADED:
+		return pb.AllowResponse_REJECTED_OVERLOADED
+	case quotaservice.ER_DENIED:
+		return pb.AllowResponse_REJECTED_DENIED
+	default:
+		return pb.AllowResponse_REJECTED_SERVER_ERROR
+	}
+}
+
+// readAllowArgs reads the arguments struct of a call to allow, whose only field is the request.
+func readAllowArgs(d *decoder) (*AllowRequest, error) {
+	req := &AllowRequest{}
+
+	for {
+		typ, id, err := d.readFieldBegin()
+		if err != nil {
+			return nil, err
+		}
+
+		if typ == typeStop {
+			return req, nil
+		}
+
+		if id == 1 && typ == typeStruct {
+			err = readAllowRequest(d, req)
+		} else {
+			err = d.skip(typ, 0)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readAllowRequest(d *decoder, req *AllowRequest) error {
+	for {
+		typ, id, err := d.readFieldBegin()
+		if err != nil || typ == typeStop {
+			return err
+		}
+
+		switch {
+		case id == 1 && typ == typeString:
+			req.Namespace, err = d.readString()
+		case id == 2 && typ == typeString:
+			req.BucketName, err = d.readString()
+		case id == 3 && typ == typeI64:
+			req.TokensRequested, err = d.readI64()
+		case id == 4 && typ == typeI64:
+			req.MaxWaitMillisOverride, err = d.readI64()
+		case id == 5 && typ == typeBool:
+			req.MaxWaitTimeOverride, err = d.readBool()
+		case id == 6 && typ == typeString:
+			req.RequestID, err = d.readString()
+		default:
+			err = d.skip(typ, 1)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeAllowResponse(e *encoder, rsp *AllowResponse) {
+	e.writeFieldBegin(typeI32, 1)
+	e.writeI32(int32(rsp.Status))
+	e.writeFieldBegin(typeI64, 2)
+	e.writeI64(rsp.TokensGranted)
+	e.writeFieldBegin(typeI64, 3)
+	e.writeI64(rsp.WaitMillis)
+	e.writeFieldStop()
+}
+
+// exception returns a TApplicationException reply.
+func exception(name string, seqID int32, typ int32, msg string) []byte {
+	e := &encoder{}
+	e.writeMessageBegin(name, messageException, seqID)
+	e.writeFieldBegin(typeString, 1)
+	e.writeString(msg)
+	e.writeFieldBegin(typeI32, 2)
+	e.writeI32(typ)
+	e.writeFieldStop()
+	return e.Bytes()
+}
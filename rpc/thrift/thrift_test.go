@@ -0,0 +1,160 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package thrift
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos"
+	"github.com/square/quotaservice/test/helpers"
+	"golang.org/x/net/context"
+)
+
+// fakeQuotaService waits 10ms for each token, failing requests for buckets in errs.
+type fakeQuotaService struct {
+	errs map[string]error
+}
+
+func (qs *fakeQuotaService) Allow(_ context.Context, namespace, name string, tokensRequested int64, _ int64, _ bool) (time.Duration, bool, error) {
+	if err := qs.errs[config.FullyQualifiedName(namespace, name)]; err != nil {
+		return 0, false, err
+	}
+
+	return time.Duration(tokensRequested) * 10 * time.Millisecond, false, nil
+}
+
+func (qs *fakeQuotaService) Charge(_ context.Context, _, _ string, _, _ int64) error {
+	return nil
+}
+
+func call(t *testing.T, conn net.Conn, method string, seqID int32, req *AllowRequest) *decoder {
+	e := &encoder{}
+	e.writeMessageBegin(method, messageCall, seqID)
+	e.writeFieldBegin(typeStruct, 1)
+	e.writeFieldBegin(typeString, 1)
+	e.writeString(req.Namespace)
+	e.writeFieldBegin(typeString, 2)
+	e.writeString(req.BucketName)
+	e.writeFieldBegin(typeI64, 3)
+	e.writeI64(req.TokensRequested)
+	// An unknown field, as sent by clients generated from a newer IDL.
+	e.writeFieldBegin(typeList, 99)
+	e.WriteByte(typeString)
+	e.writeI32(1)
+	e.writeString("ignored")
+	e.writeFieldStop()
+	e.writeFieldStop()
+	helpers.CheckError(t, writeFrame(conn, e.Bytes()))
+
+	frame, err := readFrame(conn)
+	helpers.CheckError(t, err)
+	return &decoder{b: frame}
+}
+
+func readResponse(t *testing.T, d *decoder) *AllowResponse {
+	rsp := &AllowResponse{}
+	typ, id, err := d.readFieldBegin()
+	helpers.CheckError(t, err)
+	if typ != typeStruct || id != 0 {
+		t.Fatalf("Expected the success field, got type %v, ID %v", typ, id)
+	}
+
+	for {
+		typ, id, err := d.readFieldBegin()
+		helpers.CheckError(t, err)
+		if typ == typeStop {
+			return rsp
+		}
+
+		switch id {
+		case 1:
+			status, err := d.readI32()
+			helpers.CheckError(t, err)
+			rsp.Status = pb.AllowResponse_Status(status)
+		case 2:
+			rsp.TokensGranted, err = d.readI64()
+		case 3:
+			rsp.WaitMillis, err = d.readI64()
+		}
+		helpers.CheckError(t, err)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	errored := make(chan events.Event, 1)
+	producer := events.RegisterListener(func(e events.Event) { errored <- e }, 10)
+	e := New("localhost:0", producer)
+	e.Init(&fakeQuotaService{errs: map[string]error{
+		"ns:limited":  quotaservice.QuotaServiceError{Reason: quotaservice.ER_TIMEOUT},
+		"ns:erroring": errors.New("redis is down")}})
+	e.Start()
+	defer e.Stop()
+
+	conn, err := net.Dial("tcp", e.listener.Addr().String())
+	helpers.CheckError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	tests := []struct {
+		bucket     string
+		tokens     int64
+		status     pb.AllowResponse_Status
+		waitMillis int64
+	}{
+		{"ok", 3, pb.AllowResponse_OK, 30},
+		{"limited", 1, pb.AllowResponse_REJECTED_TIMEOUT, 0},
+		{"erroring", 1, pb.AllowResponse_OK, 0},
+		{"", 1, pb.AllowResponse_REJECTED_INVALID_REQUEST, 0}}
+
+	for i, test := range tests {
+		d := call(t, conn, "allow", int32(i), &AllowRequest{Namespace: "ns", BucketName: test.bucket, TokensRequested: test.tokens})
+		name, typ, seqID, err := d.readMessageBegin()
+		helpers.CheckError(t, err)
+		if name != "allow" || typ != messageReply || seqID != int32(i) {
+			t.Fatalf("Unexpected reply header %v %v %v", name, typ, seqID)
+		}
+
+		rsp := readResponse(t, d)
+		if rsp.Status != test.status || rsp.WaitMillis != test.waitMillis {
+			t.Errorf("Bucket %v: expected %v after %vms, got %+v", test.bucket, test.status, test.waitMillis, rsp)
+		}
+	}
+
+	select {
+	case ev := <-errored:
+		if ev.EventType() != events.EVENT_SERVER_ERROR || ev.BucketName() != "erroring" {
+			t.Errorf("Unexpected event %v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected a server error event")
+	}
+
+	d := call(t, conn, "reserve", 7, &AllowRequest{Namespace: "ns", BucketName: "ok"})
+	_, typ, seqID, err := d.readMessageBegin()
+	helpers.CheckError(t, err)
+	if typ != messageException || seqID != 7 {
+		t.Errorf("Expected an exception, got type %v, sequence ID %v", typ, seqID)
+	}
+}
+
+func TestInvalidFrame(t *testing.T) {
+	e := New("localhost:0", &events.EventProducer{})
+	e.Init(&fakeQuotaService{})
+
+	reply, ok := e.handle(context.Background(), []byte{0x80, 0x01})
+	if ok {
+		t.Error("Expected the connection to be closed")
+	}
+
+	_, typ, _, err := (&decoder{b: reply}).readMessageBegin()
+	helpers.CheckError(t, err)
+	if typ != messageException {
+		t.Errorf("Expected an exception, got %v", typ)
+	}
+}
@@ -0,0 +1,51 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// sampledBucket enforces a very hot bucket probabilistically: only 1 in rate requests, chosen at
+// random, consults the underlying bucket, taking rate times the tokens requested, so that each
+// sampled grant stands in for the requests that weren't sampled. Unsampled requests reuse the
+// outcome of the last sampled request, without waiting. Requests too large to be scaled up, which
+// config validation normally prevents, are enforced exactly.
+type sampledBucket struct {
+	Bucket
+	rate int64
+	// denied is 1 if the last sampled request was denied, updated atomically.
+	denied int32
+	random func(n int64) int64
+}
+
+func newSampledBucket(b Bucket, rate int64) *sampledBucket {
+	return &sampledBucket{Bucket: b, rate: rate, random: rand.Int63n}
+}
+
+func (b *sampledBucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	if numTokens > math.MaxInt64/b.rate || numTokens*b.rate > b.Config().GetSize() {
+		// Scaled up, the request would overflow, or never be granted.
+		return b.Bucket.Take(ctx, numTokens, maxWaitTime)
+	}
+
+	if b.random(b.rate) != 0 {
+		return 0, atomic.LoadInt32(&b.denied) == 0, nil
+	}
+
+	wait, ok, err := b.Bucket.Take(ctx, numTokens*b.rate, maxWaitTime)
+	if err == nil {
+		denied := int32(0)
+		if !ok {
+			denied = 1
+		}
+		atomic.StoreInt32(&b.denied, denied)
+	}
+
+	return wait, ok, err
+}
@@ -6,37 +6,98 @@ package quotaservice
 import (
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/square/quotaservice/admin"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/leader"
 	"github.com/square/quotaservice/lifecycle"
 	"github.com/square/quotaservice/logging"
+	"github.com/square/quotaservice/metrics"
 	pb "github.com/square/quotaservice/protos/config"
+	"github.com/square/quotaservice/recommend"
+	"github.com/square/quotaservice/registry"
+	"github.com/square/quotaservice/slo"
 	"github.com/square/quotaservice/stats"
+	"github.com/square/quotaservice/usage"
+)
+
+const (
+	deletedNamespacePurgeInterval = time.Hour
+	// deletedNamespacePurgeUser is recorded as the user that made config changes that purge deleted
+	// namespaces.
+	deletedNamespacePurgeUser = "quotaservice"
+	// defaultStatsSnapshotInterval is used if SetStatsSnapshotStore is passed a non-positive
+	// interval.
+	defaultStatsSnapshotInterval = time.Minute
+	// eventHistorySize is the number of recent events kept for RecentEvents.
+	eventHistorySize = 1000
+	// warmStaticBucketsTimeout bounds how long applying a config waits for static buckets to load,
+	// if the config sets eager_static_buckets.
+	warmStaticBucketsTimeout = 10 * time.Second
 )
 
 // Implements the quotaservice.Server interface
 type server struct {
-	currentStatus     lifecycle.Status
-	bucketContainer   *bucketContainer
-	bucketFactory     BucketFactory
-	rpcEndpoints      []RpcEndpoint
-	listener          events.Listener
-	statsListener     stats.Listener
-	eventQueueBufSize int
-	maxJitterMillis   int
-	producer          *events.EventProducer
-	cfgs              *pb.ServiceConfig
-	persister         config.ConfigPersister
-	reaperConfig      config.ReaperConfig
-	sync.RWMutex      // Embedded mutex
+	currentStatus      lifecycle.Status
+	bucketContainer    *bucketContainer
+	bucketFactory      BucketFactory
+	rpcEndpoints       []RpcEndpoint
+	listener           events.Listener
+	statsListener      stats.Listener
+	recorder           *recommend.Recorder
+	sloTracker         *slo.Tracker
+	registry           registry.Registry
+	usageExporter      *usage.Exporter
+	configPropagation  configPropagation
+	statsSnapshots     stats.SnapshotStore
+	snapshotInterval   time.Duration
+	eventQueueBufSize  int
+	maxJitterMillis    int
+	producer           *events.EventProducer
+	cfgs               *pb.ServiceConfig
+	persister          config.ConfigPersister
+	reaperConfig       config.ReaperConfig
+	admission          admissionController
+	broadcaster        *events.Broadcaster
+	history            *events.History
+	suppressedEvents   atomic.Value // map[string]map[events.EventType]bool, of event types by namespace
+	eventLabels        atomic.Value // *eventLabels
+	resolver           Resolver
+	accessLog          *accessLog
+	readOnly           bool
+	follower           bool
+	elector            leader.Elector
+	cleanupInterval    time.Duration
+	readOnlyAdmins     map[string]bool
+	adminRateLimiter   *adminRateLimiter
+	preApplyHooks      []ConfigHook
+	postApplyHooks     []ConfigHook
+	bundleKey          []byte
+	configUpdates      sync.Mutex // Serializes config updates made through this server
+	configApplies      sync.Mutex // Serializes applying configs read from the persister
+	approvals          approvalQueue
+	stopPurger         chan struct{}
+	stopSnapshotter    chan struct{}
+	stopCleaner        chan struct{}
+	tokenSnapshots     *tokenSnapshotter
+	thresholds         *thresholdTracker
+	dashboardRates     *dashboardRates
+	now                func() time.Time
+	stopTokenSnapshots chan struct{}
+	waiters            int64 // Requests currently taking tokens; accessed atomically
+	configReloads      int64 // Configs applied; accessed atomically
+	watchingConfig     int32 // Whether the config listener is running; accessed atomically
+	lastConfigNotify   int64 // Unix time of the last config change notification; accessed atomically
+	sync.RWMutex             // Embedded mutex
 }
 
 func (s *server) String() string {
@@ -59,6 +120,26 @@ func (s *server) Start() (bool, error) {
 		if s.statsListener != nil {
 			s.statsListener.HandleEvent(e)
 		}
+
+		if s.recorder != nil {
+			s.recorder.HandleEvent(e)
+		}
+
+		if s.sloTracker != nil {
+			s.sloTracker.HandleEvent(e)
+		}
+
+		if s.registry != nil {
+			s.registry.HandleEvent(e)
+		}
+
+		if s.usageExporter != nil {
+			s.usageExporter.HandleEvent(e)
+		}
+
+		s.broadcaster.HandleEvent(e)
+		s.history.HandleEvent(e)
+		s.dashboardRates.HandleEvent(e)
 	}, bufSize)
 
 	logging.Printf("Creating bucket container")
@@ -70,10 +151,33 @@ func (s *server) Start() (bool, error) {
 	logging.Printf("Waiting for persister to start: OK")
 
 	logging.Printf("Reading latest config")
-	s.readUpdatedConfig(0)
+	s.readUpdatedConfig(0, time.Now())
 	logging.Printf("Reading latest config: OK")
 
 	go s.configListener(s.persister.ConfigChangedWatcher())
+	if !s.follower {
+		s.stopPurger = make(chan struct{})
+		go s.deletedNamespacePurger(s.stopPurger)
+
+		if cleaner, ok := s.bucketFactory.(StaleBucketCleaner); ok && s.cleanupInterval > 0 {
+			s.stopCleaner = make(chan struct{})
+			go s.staleBucketCleaner(cleaner, s.stopCleaner)
+		}
+	}
+
+	if snapshotter := s.statsSnapshotter(); snapshotter != nil {
+		logging.Printf("Restoring stats snapshot")
+		s.restoreStatsSnapshot(snapshotter)
+		logging.Printf("Restoring stats snapshot: OK")
+
+		s.stopSnapshotter = make(chan struct{})
+		go s.statsSnapshotSaver(snapshotter, s.stopSnapshotter)
+	}
+
+	if s.tokenSnapshots != nil {
+		s.stopTokenSnapshots = make(chan struct{})
+		go s.tokenSnapshots.run(s, s.stopTokenSnapshots)
+	}
 
 	// Start the RPC servers
 	logging.Printf("Starting RPC servers")
@@ -89,6 +193,40 @@ func (s *server) Start() (bool, error) {
 
 func (s *server) Stop() (bool, error) {
 	s.currentStatus = lifecycle.Stopped
+	if s.stopPurger != nil {
+		close(s.stopPurger)
+		s.stopPurger = nil
+	}
+
+	if s.stopCleaner != nil {
+		close(s.stopCleaner)
+		s.stopCleaner = nil
+	}
+
+	if s.stopSnapshotter != nil {
+		close(s.stopSnapshotter)
+		s.stopSnapshotter = nil
+		if s.isLeader() {
+			s.saveStatsSnapshot(s.statsSnapshotter())
+		}
+	}
+
+	if s.elector != nil {
+		s.elector.Close()
+	}
+
+	if s.registry != nil {
+		s.registry.Close()
+	}
+
+	if s.usageExporter != nil {
+		s.usageExporter.Close()
+	}
+
+	if s.stopTokenSnapshots != nil {
+		close(s.stopTokenSnapshots)
+		s.stopTokenSnapshots = nil
+	}
 
 	// Stop the RPC servers
 	for _, rpcServer := range s.rpcEndpoints {
@@ -99,11 +237,58 @@ func (s *server) Stop() (bool, error) {
 	s.RLock()
 	defer s.RUnlock()
 	s.bucketContainer.Stop()
+	if closer, ok := s.bucketFactory.(BucketFactoryCloser); ok {
+		closer.Close()
+	}
+
 	s.persister.Close()
 	return true, nil
 }
 
 func (s *server) Allow(ctx context.Context, namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (time.Duration, bool, error) {
+	w, dynamic, e := s.allow(ctx, namespace, name, tokensRequested, maxWaitMillisOverride, maxWaitTimeOverride)
+
+	if s.accessLog != nil {
+		s.accessLog.log(ctx, namespace, name, tokensRequested, w, e)
+	}
+
+	return w, dynamic, e
+}
+
+func (s *server) allow(ctx context.Context, namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (time.Duration, bool, error) {
+	namespace, name, tokensRequested, e := resolve(s.resolver, ctx, namespace, name, tokensRequested)
+	if e != nil {
+		return 0, false, e
+	}
+
+	s.RLock()
+	globalLimit, namespaceLimit := s.inFlightLimitsLocked(namespace)
+	denied, allowed := s.accessListsLocked(namespace, name)
+	nsMetadata := s.cfgs.GetNamespaces()[namespace].GetMetadata()
+	s.RUnlock()
+
+	SetResponseMetadata(ctx, nsMetadata)
+
+	if denied {
+		return 0, false, newError("Bucket "+config.FullyQualifiedName(namespace, name)+" is denied", ER_DENIED)
+	}
+
+	details := AllowDetailsFromContext(ctx)
+	if allowed {
+		// Granted unconditionally, without taking tokens.
+		if details != nil {
+			details.AllowListed = true
+		}
+
+		return 0, false, nil
+	}
+
+	release, e := s.admission.admit(namespace, globalLimit, namespaceLimit)
+	if e != nil {
+		return 0, false, e
+	}
+	defer release()
+
 	s.RLock()
 	b, e := s.bucketContainer.FindBucket(namespace, name)
 	s.RUnlock()
@@ -119,23 +304,35 @@ func (s *server) Allow(ctx context.Context, namespace, name string, tokensReques
 		return 0, false, newError("No such bucket "+config.FullyQualifiedName(namespace, name), ER_NO_BUCKET)
 	}
 
-	if b.Config().MaxTokensPerRequest < tokensRequested && b.Config().MaxTokensPerRequest > 0 {
-		s.Emit(events.NewTooManyTokensRequestedEvent(namespace, name, b.Dynamic(), tokensRequested))
+	SetResponseMetadata(ctx, config.MergeMetadata(nsMetadata, b.Config().Metadata))
+
+	if b.Config().GetMaxTokensPerRequest() < tokensRequested && b.Config().GetMaxTokensPerRequest() > 0 {
+		s.Emit(events.WithCaller(events.NewTooManyTokensRequestedEvent(namespace, name, b.Dynamic(), tokensRequested), CallerFromContext(ctx)))
 		return 0, b.Dynamic(), newError(fmt.Sprintf("Too many tokens requested. Bucket %v:%v, tokensRequested=%v, maxTokensPerRequest=%v",
-			namespace, name, tokensRequested, b.Config().MaxTokensPerRequest),
+			namespace, name, tokensRequested, b.Config().GetMaxTokensPerRequest()),
 			ER_TOO_MANY_TOKENS_REQUESTED)
 	}
 
-	maxWaitTime := time.Millisecond
-	if maxWaitTimeOverride && maxWaitMillisOverride < b.Config().WaitTimeoutMillis {
-		// Use the max wait time override from the request.
-		maxWaitTime *= time.Duration(maxWaitMillisOverride)
-	} else {
-		// Fall back to the max wait time configured on the bucket.
-		maxWaitTime *= time.Duration(b.Config().WaitTimeoutMillis)
+	maxWaitTime, beforeDeadline := MaxWaitWithinDeadline(ctx, bucketMaxWaitTime(b.Config(), maxWaitMillisOverride, maxWaitTimeOverride))
+	if !beforeDeadline {
+		// The caller has given up, so don't take tokens it can't use.
+		s.Emit(events.WithCaller(events.NewTimedOutEvent(namespace, name, b.Dynamic(), tokensRequested), CallerFromContext(ctx)))
+		return 0, b.Dynamic(), newError(fmt.Sprintf("Deadline exceeded before taking tokens from %v:%v", namespace, name), ER_TIMEOUT)
+	}
+
+	if s.tokenSnapshots != nil {
+		s.tokenSnapshots.record(namespace, name, b)
 	}
 
+	ctx = withSoftLimit(ctx)
+	atomic.AddInt64(&s.waiters, 1)
 	w, success, err := b.Take(ctx, tokensRequested, maxWaitTime)
+	atomic.AddInt64(&s.waiters, -1)
+
+	if details != nil && err == nil {
+		remainingTokens(ctx, namespace, name, b, details)
+	}
+
 	if err != nil {
 		s.Emit(events.NewBucketErrorEvent(namespace, name, b.Dynamic()))
 		return 0, b.Dynamic(), errors.Wrap(err, "failed to take tokens")
@@ -143,15 +340,135 @@ func (s *server) Allow(ctx context.Context, namespace, name string, tokensReques
 
 	if !success {
 		// Could not claim tokens within the given max wait time
-		s.Emit(events.NewTimedOutEvent(namespace, name, b.Dynamic(), tokensRequested))
+		s.Emit(events.WithCaller(events.NewTimedOutEvent(namespace, name, b.Dynamic(), tokensRequested), CallerFromContext(ctx)))
 		return 0, b.Dynamic(), newError(fmt.Sprintf("Timed out waiting on %v:%v", namespace, name), ER_TIMEOUT)
 	}
 
+	if overSoftLimit(ctx) {
+		s.Emit(events.WithCaller(events.NewOverSoftLimitEvent(namespace, name, b.Dynamic(), tokensRequested), CallerFromContext(ctx)))
+		SetResponseMetadata(ctx, config.MergeMetadata(ResponseMetadataFromContext(ctx), map[string]string{OverSoftLimitMetadataKey: "true"}))
+	}
+
+	consumed, crossed := s.thresholds.record(namespace, name, b.Config(), tokensRequested)
+	for _, threshold := range crossed {
+		s.Emit(events.NewThresholdCrossedEvent(namespace, name, b.Dynamic(), consumed, threshold))
+	}
+
 	// The only result that successfully claims tokens
 	s.Emit(events.NewTokensServedEvent(namespace, name, b.Dynamic(), tokensRequested, w))
 	return w, b.Dynamic(), nil
 }
 
+// bucketMaxWaitTime returns how long a request may wait for tokens from a bucket: the max wait time
+// override from the request, if it is shorter than the bucket's wait timeout, or else the wait
+// timeout, capped by the bucket's max wait override, if any.
+func bucketMaxWaitTime(cfg *pb.BucketConfig, maxWaitMillisOverride int64, maxWaitTimeOverride bool) time.Duration {
+	millis := cfg.GetWaitTimeoutMillis()
+	if maxWaitTimeOverride && maxWaitMillisOverride < millis {
+		millis = maxWaitMillisOverride
+	}
+
+	if cfg.MaxWaitOverrideMillis != nil && cfg.GetMaxWaitOverrideMillis() < millis {
+		millis = cfg.GetMaxWaitOverrideMillis()
+	}
+
+	return time.Duration(millis) * time.Millisecond
+}
+
+// MaxWaitWithinDeadline caps a max wait time to the time remaining before the context's deadline,
+// if any, so that callers aren't granted waits they can't honor. Buckets pass the result on to
+// their backends, which reject, without taking tokens, requests that would need to wait longer.
+// The second return value is false if the deadline has already passed.
+func MaxWaitWithinDeadline(ctx context.Context, maxWaitTime time.Duration) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return maxWaitTime, true
+	}
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return 0, false
+	}
+
+	if remaining < maxWaitTime {
+		return remaining, true
+	}
+
+	return maxWaitTime, true
+}
+
+// remainingTokens records the tokens left in a bucket in details, if the bucket can report them.
+func remainingTokens(ctx context.Context, namespace, name string, b Bucket, details *AllowDetails) {
+	inspector, ok := b.(TokenInspector)
+	if !ok {
+		return
+	}
+
+	tokens, err := inspector.Tokens(ctx)
+	if err == ErrNotSupported {
+		return
+	} else if err != nil {
+		logging.Printf("Unable to read tokens remaining in bucket %v: %v", config.FullyQualifiedName(namespace, name), err)
+		return
+	}
+
+	details.RemainingTokens, details.HasRemainingTokens = tokens, true
+}
+
+func (s *server) Charge(ctx context.Context, namespace, name string, tokensReserved, actualCost int64) error {
+	// Only the namespace and bucket are resolved; the tokens reserved and actual cost are reconciled
+	// as is.
+	namespace, name, _, err := resolve(s.resolver, ctx, namespace, name, tokensReserved)
+	if err != nil {
+		return err
+	}
+
+	s.RLock()
+	b, e := s.bucketContainer.FindBucket(namespace, name)
+	s.RUnlock()
+
+	if e != nil || b == nil {
+		return newError("No such bucket "+config.FullyQualifiedName(namespace, name), ER_NO_BUCKET)
+	}
+
+	delta := actualCost - tokensReserved
+	if delta == 0 {
+		return nil
+	}
+
+	if err := b.Charge(ctx, delta); err != nil {
+		s.Emit(events.NewBucketErrorEvent(namespace, name, b.Dynamic()))
+		return errors.Wrap(err, "failed to charge tokens")
+	}
+
+	return nil
+}
+
+// inFlightLimitsLocked returns the configured global and namespace limits on concurrent requests.
+// Callers must hold a read lock.
+func (s *server) inFlightLimitsLocked(namespace string) (globalLimit, namespaceLimit int64) {
+	if s.cfgs == nil {
+		return 0, 0
+	}
+
+	return s.cfgs.MaxInFlightRequests, s.cfgs.Namespaces[namespace].GetMaxInFlightRequests()
+}
+
+// accessListsLocked returns whether a bucket is on its namespace's deny-list or allow-list. Callers
+// must hold a read lock.
+func (s *server) accessListsLocked(namespace, name string) (denied, allowed bool) {
+	if s.cfgs == nil {
+		return false, false
+	}
+
+	nsCfg := s.cfgs.Namespaces[namespace]
+	if config.MatchesBucketPattern(nsCfg.GetDeniedBuckets(), name) {
+		return true, false
+	}
+
+	return false, config.MatchesBucketPattern(nsCfg.GetAllowedBuckets(), name)
+}
+
 func (s *server) ServeAdminConsole(mux *http.ServeMux, assetsDir string, development bool) {
 	admin.ServeAdminConsole(s, mux, assetsDir, development)
 }
@@ -171,6 +488,106 @@ func (s *server) SetStatsListener(listener stats.Listener) {
 	s.statsListener = listener
 }
 
+func (s *server) SetRecommendationRecorder(recorder *recommend.Recorder) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set recommendation recorder after server has started!")
+	}
+
+	s.recorder = recorder
+}
+
+func (s *server) SetUsageExporter(exporter *usage.Exporter) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set usage exporter after server has started!")
+	}
+
+	s.usageExporter = exporter
+}
+
+func (s *server) SetSLOTracker(tracker *slo.Tracker) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set SLO tracker after server has started!")
+	}
+
+	tracker.SetEmitter(s.Emit)
+	s.sloTracker = tracker
+}
+
+func (s *server) SetStatsSnapshotStore(store stats.SnapshotStore, interval time.Duration) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set stats snapshot store after server has started!")
+	}
+
+	if interval <= 0 {
+		interval = defaultStatsSnapshotInterval
+	}
+
+	s.statsSnapshots = store
+	s.snapshotInterval = interval
+}
+
+func (s *server) SetDynamicBucketRegistry(r registry.Registry) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set dynamic bucket registry after server has started!")
+	}
+
+	s.registry = r
+}
+
+func (s *server) SetLeaderElector(elector leader.Elector) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set leader elector after server has started!")
+	}
+
+	s.elector = elector
+}
+
+func (s *server) SetStaleBucketCleanupInterval(interval time.Duration) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set stale bucket cleanup interval after server has started!")
+	}
+
+	s.cleanupInterval = interval
+}
+
+func (s *server) SetTokenSnapshots(interval time.Duration, topN int) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set token snapshots after server has started!")
+	}
+
+	if interval <= 0 {
+		s.tokenSnapshots = nil
+		return
+	}
+
+	s.tokenSnapshots = newTokenSnapshotter(interval, topN)
+}
+
+func (s *server) SetAccessLog(w io.Writer, cfg AccessLogConfig) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set access log after server has started!")
+	}
+
+	if w == nil {
+		s.accessLog = nil
+		return
+	}
+
+	s.accessLog = newAccessLog(w, cfg)
+}
+
+func (s *server) SetResolver(resolver Resolver) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set resolver after server has started!")
+	}
+
+	if resolver == nil {
+		resolver = PassThroughResolver{}
+	}
+
+	s.resolver = resolver
+}
+
 func (s *server) SetListener(listener events.Listener, eventQueueBufSize int) {
 	if s.currentStatus == lifecycle.Started {
 		panic("Cannot add listener after server has started!")
@@ -185,27 +602,65 @@ func (s *server) SetListener(listener events.Listener, eventQueueBufSize int) {
 }
 
 func (s *server) Emit(e events.Event) {
+	if suppressed, _ := s.suppressedEvents.Load().(map[string]map[events.EventType]bool); suppressed[e.Namespace()][e.EventType()] {
+		return
+	}
+
 	if s.producer != nil {
-		s.producer.Emit(e)
+		s.producer.Emit(s.withLabels(e))
+	}
+}
+
+// setSuppressedEvents records the event types each namespace suppresses. It is read without locks,
+// since events are emitted while configs are being applied.
+func (s *server) setSuppressedEvents(cfg *pb.ServiceConfig) {
+	suppressed := make(map[string]map[events.EventType]bool)
+	for name, nsCfg := range cfg.Namespaces {
+		for _, typeName := range nsCfg.SuppressedEvents {
+			et, ok := events.ParseEventType(typeName)
+			if !ok {
+				logging.Printf("Namespace %v suppresses unknown event type %v", name, typeName)
+				continue
+			}
+
+			if suppressed[name] == nil {
+				suppressed[name] = make(map[events.EventType]bool)
+			}
+			suppressed[name][et] = true
+		}
 	}
+
+	s.suppressedEvents.Store(suppressed)
 }
 
 func (s *server) configListener(ch <-chan struct{}) {
+	atomic.StoreInt32(&s.watchingConfig, 1)
+	defer atomic.StoreInt32(&s.watchingConfig, 0)
+
 	for range ch {
+		notifiedAt := time.Now()
+		atomic.StoreInt64(&s.lastConfigNotify, notifiedAt.Unix())
 		jitter := 0
 		if s.maxJitterMillis != 0 {
 			// Pick a random number between 0 and maxJitterMillis
 			jitter = rand.Intn(s.maxJitterMillis)
 		}
-		s.readUpdatedConfig(time.Duration(jitter) * time.Millisecond)
+		s.readUpdatedConfig(time.Duration(jitter)*time.Millisecond, notifiedAt)
 	}
 }
 
-func (s *server) readUpdatedConfig(jitter time.Duration) {
+func (s *server) readUpdatedConfig(jitter time.Duration, notifiedAt time.Time) {
 	newConfig, err := s.persister.ReadPersistedConfig()
 
 	if err != nil {
 		logging.Println("error reading persisted config", err)
+		s.Emit(events.NewConfigRejectedEvent(0, err))
+		return
+	}
+
+	if err := validateServiceConfig(newConfig); err != nil {
+		logging.Printf("Config version %d is invalid. Ignoring. %v", newConfig.Version, err)
+		s.Emit(events.NewConfigRejectedEvent(newConfig.Version, err))
 		return
 	}
 
@@ -213,7 +668,42 @@ func (s *server) readUpdatedConfig(jitter time.Duration) {
 		time.Sleep(jitter)
 	}
 
-	s.updateBucketContainer(newConfig)
+	if s.updateBucketContainer(newConfig) {
+		if newConfig.EagerStaticBuckets {
+			s.warmStaticBuckets()
+		}
+
+		s.configPropagation.record(newConfig, notifiedAt, time.Now())
+	}
+}
+
+// warmStaticBuckets loads the state of static buckets that implement BucketWarmer, so that the
+// first requests after a config is applied don't wait for it. Buckets that fail to load are logged
+// and emit EVENT_BUCKET_ERROR events, and are loaded on their first request instead.
+func (s *server) warmStaticBuckets() {
+	ctx, cancel := context.WithTimeout(context.Background(), warmStaticBucketsTimeout)
+	defer cancel()
+
+	start := time.Now()
+	warmed := 0
+	for _, b := range s.bucketContainer.staticBuckets() {
+		warmer, ok := b.Bucket.(BucketWarmer)
+		if !ok {
+			continue
+		}
+
+		if err := warmer.Warm(ctx); err == ErrNotSupported {
+			continue
+		} else if err != nil {
+			logging.Printf("Cannot warm bucket %v: %v", config.FullyQualifiedName(b.namespace, b.name), err)
+			s.Emit(events.NewBucketErrorEvent(b.namespace, b.name, false))
+			continue
+		}
+
+		warmed++
+	}
+
+	logging.Printf("Warmed %v static buckets in %v", warmed, time.Since(start))
 }
 
 func (s *server) createBucketContainer() {
@@ -226,160 +716,685 @@ func (s *server) createBucketContainer() {
 	s.bucketContainer = NewBucketContainer(s.bucketFactory, s, s.reaperConfig)
 }
 
-func (s *server) updateBucketContainer(newConfig *pb.ServiceConfig) {
-	s.Lock()
-	defer s.Unlock()
+// updateBucketContainer applies a new config, returning false if it was ignored for not being newer
+// than the current one. Buckets for the new config are built while requests are still served with
+// the current config, and then swapped in atomically.
+func (s *server) updateBucketContainer(newConfig *pb.ServiceConfig) bool {
+	s.configApplies.Lock()
+	defer s.configApplies.Unlock()
+
+	s.RLock()
+	currentConfig := s.cfgs
+	s.RUnlock()
 
 	// Guard against updating the existing config with a lower valued version number
-	if s.cfgs != nil && newConfig.Version <= s.cfgs.Version {
+	if currentConfig != nil && newConfig.Version <= currentConfig.Version {
 		logging.Printf("Proposed config version %d is lower than existing config version %d. Ignoring.",
-			newConfig.Version, s.cfgs.Version)
-		return
+			newConfig.Version, currentConfig.Version)
+		// The current config being re-read isn't a rejection.
+		if newConfig.Version < currentConfig.Version {
+			s.Emit(events.NewConfigRejectedEvent(newConfig.Version,
+				fmt.Errorf("config version %d is older than current version %d", newConfig.Version, currentConfig.Version)))
+		}
+		return false
 	}
 
-	s.bucketContainer.Lock()
-	defer s.bucketContainer.Unlock()
-
 	// Initialize buckets
 	s.bucketFactory.Init(newConfig)
 
+	s.bucketContainer.RLock()
 	// If there is no existing config, then this bucket container is brand-new and hasn't been used before.
 	firstTime := s.bucketContainer.cfg == nil
+	s.bucketContainer.RUnlock()
+
+	var rebuild *containerRebuild
+	if !firstTime {
+		start := time.Now()
+		rebuild = s.bucketContainer.rebuild(newConfig)
+		logging.Printf("Built buckets for config version %d in %v", newConfig.Version, time.Since(start))
+	}
+
+	s.Lock()
+	defer s.Unlock()
 
 	// Set the new config on the the server
 	s.cfgs = newConfig
+	s.setSuppressedEvents(newConfig)
+	s.setEventLabels(newConfig)
+	atomic.AddInt64(&s.configReloads, 1)
+	s.Emit(events.NewConfigAppliedEvent(newConfig.Version))
 
 	if firstTime {
-		s.bucketContainer.initLocked(newConfig)
-		return
-	}
-
-	s.bucketContainer.cfg = newConfig
-	// Diff existing configs, buckets and namespaces against the new config and see what needs to be evicted
-
-	// Start with the globalDefaultBucket
-	var currentDefaultBucketCfg *pb.BucketConfig
-	if s.bucketContainer.defaultBucket != nil {
-		currentDefaultBucketCfg = s.bucketContainer.defaultBucket.Config()
+		s.bucketContainer.Init(newConfig)
+	} else {
+		s.bucketContainer.applyRebuild(rebuild)
 	}
 
-	if config.DifferentBucketConfigs(currentDefaultBucketCfg, newConfig.GlobalDefaultBucket) {
-		if s.bucketContainer.defaultBucket != nil {
-			// We need to destroy existing buckets even if we are replacing them.
-			s.bucketContainer.defaultBucket.Destroy()
-		}
+	return true
+}
 
-		if newConfig.GlobalDefaultBucket == nil {
-			s.bucketContainer.defaultBucket = nil
-		} else {
-			s.bucketContainer.createGlobalDefaultBucketLocked(s.cfgs.GlobalDefaultBucket)
-		}
-	}
+// errConfigUnchanged is returned by config updaters that didn't change anything, so that no new
+// version is persisted.
+var errConfigUnchanged = errors.New("config unchanged")
 
-	// Scan through all namespaces in s.bucketContainer.namespaces and update the config to point to
-	// the new instance, *regardless* of whether the config has changed or not. Also, if the config *has*
-	// changed, throw away the old namespace and recreate it. We *could* scan all the buckets in a namespace
-	// and only recreate the ones that have changed, but this may have little benefit, since the real cost
-	// here is with dynamic buckets, and if the namespace config has changed, it's very likely that the
-	// change involves the dynamic bucket template.
-	for name, ns := range s.bucketContainer.namespaces {
-		newNsCfg, exists := newConfig.Namespaces[name]
-		if exists {
-			if config.DifferentNamespaceConfigs(ns.cfg, newNsCfg) {
-				// We need to destroy the old namespace before overwriting.
-				ns.destroy()
-				// This will overwrite the existing namespace
-				s.bucketContainer.createNamespaceLocked(newNsCfg)
-			} else {
-				// Just correct the config pointer on the old namespace
-				ns.swapCfg(newNsCfg)
-			}
-		} else {
-			ns.destroy()
-			delete(s.bucketContainer.namespaces, name)
-		}
+// updateConfig applies a config change made by a user, unless two-person approval is enabled, in
+// which case the change is queued for approval.
+func (s *server) updateConfig(user, description string, updater func(*pb.ServiceConfig) error) error {
+	if s.approvals.required() {
+		return s.proposeConfigUpdate(user, description, updater)
 	}
 
-	// Now look for any new namespaces in the new config and add them
-	for name, nsCfg := range newConfig.Namespaces {
-		if _, exists := s.bucketContainer.namespaces[name]; !exists {
-			s.bucketContainer.createNamespaceLocked(nsCfg)
-		}
-	}
+	return s.applyConfigUpdate(user, updater)
 }
 
-func (s *server) updateConfig(user string, updater func(*pb.ServiceConfig) error) error {
+func (s *server) applyConfigUpdate(user string, updater func(*pb.ServiceConfig) error) error {
+	s.configUpdates.Lock()
+	defer s.configUpdates.Unlock()
+
 	s.Lock()
+	if err := s.writableLocked(); err != nil {
+		s.Unlock()
+		return err
+	}
 	clonedCfg := config.CloneConfig(s.cfgs)
 	currentVersion := clonedCfg.Version
 	s.Unlock()
 
 	err := updater(clonedCfg)
 
+	if err == errConfigUnchanged {
+		return nil
+	}
+
 	if err != nil {
 		return err
 	}
 
 	config.ApplyDefaults(clonedCfg)
 
+	if err := validateServiceConfig(clonedCfg); err != nil {
+		return err
+	}
+
 	clonedCfg.User = user
-	clonedCfg.Date = time.Now().Unix()
+	clonedCfg.Date = s.now().Unix()
 	clonedCfg.Version = currentVersion + 1
 
+	s.RLock()
+	current := s.cfgs
+	preApplyHooks, postApplyHooks := s.preApplyHooks, s.postApplyHooks
+	s.RUnlock()
+
+	if err := runPreApplyHooks(preApplyHooks, current, clonedCfg, user); err != nil {
+		return err
+	}
+
 	// TODO(manik) make use of the old hash for an optimistic version check
-	return s.persister.PersistAndNotify("", clonedCfg)
+	if err := s.persister.PersistAndNotify("", clonedCfg); err != nil {
+		return err
+	}
+
+	runPostApplyHooks(postApplyHooks, current, clonedCfg, user)
+	return nil
 }
 
-// Implements admin.Administrable
-func (s *server) Configs() *pb.ServiceConfig {
-	s.RLock()
-	defer s.RUnlock()
+// validateServiceConfig checks that a config's buckets are valid, as are references between its
+// buckets, templates and quota groups.
+func validateServiceConfig(cfg *pb.ServiceConfig) error {
+	if err := config.ValidateBucketTemplates(cfg); err != nil {
+		return err
+	}
+
+	if err := config.ValidateBuckets(cfg); err != nil {
+		return err
+	}
+
+	if err := config.ValidateQuotaGroups(cfg); err != nil {
+		return err
+	}
+
+	return config.ValidateBorrowing(cfg)
+}
+
+// Implements admin.Administrable
+func (s *server) Configs() *pb.ServiceConfig {
+	s.RLock()
+	defer s.RUnlock()
 	return s.cfgs
 }
 
 func (s *server) UpdateConfig(c *pb.ServiceConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+	return s.updateConfig(user, "update config", func(clonedCfg *pb.ServiceConfig) error {
 		*clonedCfg = *c
 		return nil
 	})
 }
 
 func (s *server) AddBucket(namespace string, b *pb.BucketConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+	return s.updateConfig(user, "add bucket "+config.FullyQualifiedName(namespace, b.Name), func(clonedCfg *pb.ServiceConfig) error {
 		return config.CreateBucket(clonedCfg, namespace, b)
 	})
 }
 
 func (s *server) UpdateBucket(namespace string, b *pb.BucketConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+	return s.updateConfig(user, "update bucket "+config.FullyQualifiedName(namespace, b.Name), func(clonedCfg *pb.ServiceConfig) error {
 		return config.UpdateBucket(clonedCfg, namespace, b)
 	})
 }
 
 func (s *server) DeleteBucket(namespace, name, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+	return s.updateConfig(user, "delete bucket "+config.FullyQualifiedName(namespace, name), func(clonedCfg *pb.ServiceConfig) error {
 		return config.DeleteBucket(clonedCfg, namespace, name)
 	})
 }
 
 func (s *server) AddNamespace(n *pb.NamespaceConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+	return s.updateConfig(user, "add namespace "+n.Name, func(clonedCfg *pb.ServiceConfig) error {
 		return config.CreateNamespace(clonedCfg, n)
 	})
 }
 
 func (s *server) UpdateNamespace(n *pb.NamespaceConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+	return s.updateConfig(user, "update namespace "+n.Name, func(clonedCfg *pb.ServiceConfig) error {
 		return config.UpdateNamespace(clonedCfg, n)
 	})
 }
 
+// DeleteNamespace soft-deletes a namespace, which can be restored with RestoreNamespace until it is
+// purged.
 func (s *server) DeleteNamespace(n, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
-		return config.DeleteNamespace(clonedCfg, n)
+	return s.updateConfig(user, "delete namespace "+n, func(clonedCfg *pb.ServiceConfig) error {
+		return config.SoftDeleteNamespace(clonedCfg, n, s.now())
+	})
+}
+
+func (s *server) RestoreNamespace(n, user string) error {
+	return s.updateConfig(user, "restore namespace "+n, func(clonedCfg *pb.ServiceConfig) error {
+		return config.RestoreNamespace(clonedCfg, n)
+	})
+}
+
+// purgeDeletedNamespaces permanently removes soft-deleted namespaces whose retention period has
+// passed.
+func (s *server) purgeDeletedNamespaces() error {
+	return s.applyConfigUpdate(deletedNamespacePurgeUser, func(clonedCfg *pb.ServiceConfig) error {
+		purged := config.PurgeDeletedNamespaces(clonedCfg, s.now())
+		if len(purged) == 0 {
+			return errConfigUnchanged
+		}
+
+		logging.Printf("Purging deleted namespaces %v", purged)
+		return nil
+	})
+}
+
+func (s *server) deletedNamespacePurger(stop <-chan struct{}) {
+	ticker := time.NewTicker(deletedNamespacePurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !s.isLeader() {
+				continue
+			}
+
+			if err := s.purgeDeletedNamespaces(); err != nil {
+				logging.Printf("Unable to purge deleted namespaces: %v", err)
+			}
+		}
+	}
+}
+
+// statsSnapshotter returns the stats listener as a stats.Snapshotter, or nil if stats aren't
+// being snapshotted.
+func (s *server) statsSnapshotter() stats.Snapshotter {
+	if s.statsSnapshots == nil {
+		return nil
+	}
+
+	snapshotter, ok := s.statsListener.(stats.Snapshotter)
+	if !ok {
+		return nil
+	}
+
+	return snapshotter
+}
+
+func (s *server) restoreStatsSnapshot(snapshotter stats.Snapshotter) {
+	snapshot, err := s.statsSnapshots.LoadSnapshot()
+	if err != nil {
+		// Stats are informational, so don't prevent the server from starting.
+		logging.Printf("Unable to load stats snapshot: %v", err)
+		return
+	}
+
+	if snapshot != nil {
+		snapshotter.Restore(snapshot)
+	}
+}
+
+func (s *server) saveStatsSnapshot(snapshotter stats.Snapshotter) {
+	if err := s.statsSnapshots.SaveSnapshot(snapshotter.Snapshot()); err != nil {
+		logging.Printf("Unable to save stats snapshot: %v", err)
+	}
+}
+
+func (s *server) statsSnapshotSaver(snapshotter stats.Snapshotter, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if s.isLeader() {
+				s.saveStatsSnapshot(snapshotter)
+			}
+		}
+	}
+}
+
+func (s *server) staleBucketCleaner(cleaner StaleBucketCleaner, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// Read-only mode pauses cleanup, as it does cleanups through the admin API.
+			if !s.isLeader() || s.writable() != nil {
+				continue
+			}
+
+			report, err := cleaner.CleanStaleBuckets(context.Background(), false)
+			if err != nil {
+				logging.Printf("Unable to clean up stale buckets: %v", err)
+			} else if report.Deleted > 0 {
+				logging.Printf("Cleaned up %v stale buckets", report.Deleted)
+			}
+		}
+	}
+}
+
+// isLeader is true if this instance should run singleton maintenance tasks.
+func (s *server) isLeader() bool {
+	return s.elector == nil || s.elector.IsLeader()
+}
+
+func (s *server) EnsureNamespace(name, template, user string) error {
+	return s.updateConfig(user, "provision namespace "+name+" from template "+template, func(clonedCfg *pb.ServiceConfig) error {
+		if clonedCfg.Namespaces[name] != nil {
+			return errConfigUnchanged
+		}
+
+		// The namespace may have been created by a config push that has been persisted, but not yet
+		// applied.
+		if persisted, err := s.persister.ReadPersistedConfig(); err == nil && persisted.Namespaces[name] != nil {
+			return errConfigUnchanged
+		}
+
+		return config.CreateNamespaceFromTemplate(clonedCfg, name, template)
 	})
 }
 
+// CloneNamespace creates namespace dst as a copy of namespace src, with overrides applied.
+func (s *server) CloneNamespace(src, dst string, overrides config.CloneOverrides, user string) error {
+	return s.updateConfig(user, "clone namespace "+src+" to "+dst, func(clonedCfg *pb.ServiceConfig) error {
+		return config.CloneNamespace(clonedCfg, src, dst, overrides)
+	})
+}
+
+// ReadOnly is true if the admin API is in read-only mode, as it always is on followers.
+func (s *server) ReadOnly() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.readOnly || s.follower
+}
+
+func (s *server) SetReadOnly(readOnly bool, user string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.readOnlyAdmins[user] {
+		return admin.ErrNotAuthorized
+	}
+
+	if s.follower && !readOnly {
+		return admin.ErrFollower
+	}
+
+	if s.readOnly != readOnly {
+		s.readOnly = readOnly
+		logging.Printf("Admin read-only mode set to %v by %v", readOnly, user)
+	}
+
+	return nil
+}
+
+func (s *server) SetFollower(follower bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.follower = follower
+}
+
+// writable returns an error if changes can't be made through this server.
+func (s *server) writable() error {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.writableLocked()
+}
+
+func (s *server) writableLocked() error {
+	if s.follower {
+		return admin.ErrFollower
+	}
+
+	if s.readOnly {
+		return admin.ErrReadOnly
+	}
+
+	return nil
+}
+
+func (s *server) SetReadOnlyAdmins(users ...string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.readOnlyAdmins = make(map[string]bool, len(users))
+	for _, user := range users {
+		s.readOnlyAdmins[user] = true
+	}
+}
+
+func (s *server) SetConfigBundleKey(key []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.bundleKey = key
+}
+
+// ExportConfig exports the current config as a signed bundle.
+func (s *server) ExportConfig(user string) (*config.Bundle, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if len(s.bundleKey) == 0 {
+		return nil, errors.New("config bundles aren't enabled")
+	}
+
+	logging.Printf("Config version %v exported by %v", s.cfgs.Version, user)
+	return config.NewBundle(s.cfgs, s.bundleKey, user, s.now())
+}
+
+// ImportConfig replaces the current config with the contents of a bundle, if it was signed with
+// this server's bundle key.
+func (s *server) ImportConfig(bundle *config.Bundle, user string) error {
+	s.RLock()
+	key := s.bundleKey
+	s.RUnlock()
+
+	if len(key) == 0 {
+		return errors.New("config bundles aren't enabled")
+	}
+
+	cfg, err := config.OpenBundle(bundle, key)
+	if err != nil {
+		return err
+	}
+
+	description := fmt.Sprintf("import config version %v exported by %v", bundle.ConfigVersion, bundle.ExportedBy)
+	return s.updateConfig(user, description, func(clonedCfg *pb.ServiceConfig) error {
+		*clonedCfg = *cfg
+		return nil
+	})
+}
+
+func (s *server) IsAdmin(user string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.readOnlyAdmins[user]
+}
+
+func (s *server) DebugState() *admin.DebugState {
+	s.RLock()
+	defer s.RUnlock()
+
+	state := &admin.DebugState{
+		ConfigVersion:          s.cfgs.GetVersion(),
+		Namespaces:             make(map[string]*admin.NamespaceDebugState),
+		ReadOnly:               s.readOnly || s.follower,
+		Follower:               s.follower,
+		ConfigWatcherRunning:   atomic.LoadInt32(&s.watchingConfig) == 1,
+		LastConfigNotification: atomic.LoadInt64(&s.lastConfigNotify)}
+
+	if s.bucketContainer == nil {
+		return state
+	}
+
+	s.bucketContainer.RLock()
+	defer s.bucketContainer.RUnlock()
+
+	for name, ns := range s.bucketContainer.namespaces {
+		nsState := &admin.NamespaceDebugState{}
+
+		ns.RLock()
+		for _, b := range ns.buckets {
+			if b.Dynamic() {
+				nsState.DynamicBuckets++
+			} else {
+				nsState.StaticBuckets++
+			}
+		}
+		nsState.DefaultBucket = ns.defaultBucket != nil
+		ns.RUnlock()
+
+		state.Namespaces[name] = nsState
+	}
+
+	return state
+}
+
+// Implements admin.Administrable
+func (s *server) CleanStaleBuckets(dryRun bool, user string) (*admin.CleanupReport, error) {
+	cleaner, ok := s.bucketFactory.(StaleBucketCleaner)
+	if !ok {
+		return nil, errors.New("the bucket factory doesn't support cleaning up stale buckets")
+	}
+
+	if dryRun {
+		logging.Printf("Stale bucket cleanup dry run requested by %v", user)
+	} else if err := s.writable(); err != nil {
+		return nil, err
+	} else {
+		logging.Printf("Stale bucket cleanup requested by %v", user)
+	}
+
+	return cleaner.CleanStaleBuckets(context.Background(), dryRun)
+}
+
+// existingBucket returns the bucket backing a bucket that has been created, without creating
+// dynamic buckets.
+func (s *server) existingBucket(namespace, name string) (Bucket, error) {
+	s.RLock()
+	b := s.bucketContainer.findExistingBucket(namespace, name)
+	s.RUnlock()
+
+	if b == nil {
+		return nil, newError("No such bucket "+config.FullyQualifiedName(namespace, name), ER_NO_BUCKET)
+	}
+
+	return backingBucket(b)
+}
+
+// existingSoftLimit returns the bucket tracking the soft limit of a bucket that has been created, or
+// nil if it has no soft limit.
+func (s *server) existingSoftLimit(namespace, name string) Bucket {
+	s.RLock()
+	b := s.bucketContainer.findExistingBucket(namespace, name)
+	s.RUnlock()
+
+	if b == nil {
+		return nil
+	}
+
+	return softLimitOf(b)
+}
+
+func (s *server) BucketDebt(namespace, name string) (*admin.BucketDebt, error) {
+	b, err := s.existingBucket(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	inspector, ok := b.(TokenInspector)
+	if !ok {
+		return nil, errors.New("the bucket doesn't support reporting its tokens")
+	}
+
+	tokens, err := inspector.Tokens(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	debt := &admin.BucketDebt{Namespace: namespace, Bucket: name, Dynamic: b.Dynamic(), Tokens: tokens}
+	if tokens < 0 {
+		debt.DebtTokens = -tokens
+		// A blocked bucket never refills, so never pays its debt back.
+		if cfg := b.Config(); config.Blocked(cfg) {
+			debt.Unbounded = true
+		} else {
+			debt.DebtMillis = debt.DebtTokens * 1000 / cfg.GetFillRate()
+		}
+	}
+
+	return debt, nil
+}
+
+func (s *server) ForgiveDebt(namespace, name, user string) error {
+	b, err := s.existingBucket(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	forgiver, ok := b.(DebtForgiver)
+	if !ok {
+		return errors.New("the bucket doesn't support forgiving debt")
+	}
+
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	logging.Printf("Debt of bucket %v forgiven by %v", config.FullyQualifiedName(namespace, name), user)
+	if err := forgiver.ForgiveDebt(context.Background()); err != nil {
+		return err
+	}
+
+	if softLimit, ok := s.existingSoftLimit(namespace, name).(DebtForgiver); ok {
+		return softLimit.ForgiveDebt(context.Background())
+	}
+
+	return nil
+}
+
+// ResetBucket restores a bucket to full capacity, emitting an EVENT_BUCKET_RESET event. Resetting
+// a bucket in a quota group resets the group's shared pool.
+func (s *server) ResetBucket(namespace, name, user string) error {
+	b, err := s.existingBucket(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	resetter, ok := b.(BucketResetter)
+	if !ok {
+		return errors.New("the bucket doesn't support being reset")
+	}
+
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	if err := resetter.Reset(context.Background()); err != nil {
+		return err
+	}
+
+	// So that requests aren't flagged as over the soft limit of a full bucket.
+	if softLimit, ok := s.existingSoftLimit(namespace, name).(BucketResetter); ok {
+		if err := softLimit.Reset(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	logging.Printf("Bucket %v reset by %v", config.FullyQualifiedName(namespace, name), user)
+	s.Emit(events.NewBucketResetEvent(namespace, name, b.Dynamic()))
+	return nil
+}
+
+func (s *server) Recommendations() (*admin.RecommendationReport, error) {
+	if s.recorder == nil {
+		return nil, errors.New("recommendations aren't enabled")
+	}
+
+	s.RLock()
+	cfg := s.cfgs
+	s.RUnlock()
+
+	return s.recorder.Recommend(cfg), nil
+}
+
+func (s *server) SLOs() (*admin.SLOReport, error) {
+	if s.sloTracker == nil {
+		return nil, errors.New("SLO tracking isn't enabled")
+	}
+
+	return s.sloTracker.Report(), nil
+}
+
+func (s *server) DynamicBuckets(namespace, cursor string, count int) (*admin.DynamicBucketPage, error) {
+	if s.registry == nil {
+		return nil, errors.New("the dynamic bucket registry isn't enabled")
+	}
+
+	return s.registry.List(namespace, cursor, count)
+}
+
+func (s *server) SubscribeEvents(bufSize int) (<-chan events.Event, func()) {
+	return s.broadcaster.Subscribe(bufSize)
+}
+
+// RecentEvents returns up to limit of the most recent events in a namespace, or in all namespaces
+// if namespace is empty, newest first.
+func (s *server) RecentEvents(namespace string, limit int) []events.RecordedEvent {
+	return s.history.Recent(namespace, limit)
+}
+
+func (s *server) HealthMetrics() *metrics.Health {
+	h := &metrics.Health{
+		Runtime:              metrics.ReadRuntime(),
+		Waiters:              atomic.LoadInt64(&s.waiters),
+		ConfigReloads:        atomic.LoadInt64(&s.configReloads),
+		BucketPool:           metrics.ReadPoolStats(s.bucketFactory.Client()),
+		BucketBackendVersion: metrics.ReadBackendVersion(s.bucketFactory),
+		Config:               s.configPropagation.status()}
+
+	if s.producer != nil {
+		h.EventQueueDepth = s.producer.QueueDepth()
+		h.EventQueueCapacity = s.producer.QueueCapacity()
+		h.ListenerLagMillis = s.producer.Lag().Nanoseconds() / int64(time.Millisecond)
+	}
+
+	return h
+}
+
 func (s *server) TopDynamicHits(namespace string) []*stats.BucketScore {
 	if s.statsListener == nil {
 		return nil
@@ -404,6 +1419,40 @@ func (s *server) DynamicBucketStats(namespace, bucket string) *stats.BucketScore
 	return s.statsListener.Get(namespace, bucket)
 }
 
+func (s *server) NamespaceStats(namespace string) *stats.AggregateStats {
+	if s.statsListener == nil {
+		return nil
+	}
+
+	totals := s.statsListener.NamespaceStats(namespace)
+	totals.ActiveBuckets = s.activeBuckets(namespace)
+	return totals
+}
+
+func (s *server) GlobalStats() *stats.AggregateStats {
+	if s.statsListener == nil {
+		return nil
+	}
+
+	totals := s.statsListener.GlobalStats()
+	totals.ActiveBuckets = s.activeBuckets("")
+	return totals
+}
+
+// activeBuckets counts the buckets that exist on this server in a namespace, or in all namespaces if
+// the namespace is empty.
+func (s *server) activeBuckets(namespace string) int64 {
+	s.RLock()
+	bc := s.bucketContainer
+	s.RUnlock()
+
+	if bc == nil {
+		return 0
+	}
+
+	return bc.countBuckets(namespace)
+}
+
 func (s *server) HistoricalConfigs() ([]*pb.ServiceConfig, error) {
 	configs, err := s.persister.ReadHistoricalConfigs()
 	if err != nil {
@@ -5,22 +5,31 @@ package quotaservice
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/admin"
 	"github.com/square/quotaservice/config"
 	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos/config"
+	"github.com/square/quotaservice/registry"
+	"github.com/square/quotaservice/stats"
 	"github.com/square/quotaservice/test/helpers"
+	"github.com/square/quotaservice/usage"
 )
 
 func TestWithNoRpcs(t *testing.T) {
 	helpers.ExpectingPanic(t, func() {
-		New(&MockBucketFactory{}, &config.MemoryConfigPersister{}, NewReaperConfigForTests(), 0)
+		New(NewMockBucketFactory(), &config.MemoryConfigPersister{}, NewReaperConfigForTests(), 0)
 	})
 }
 
 func TestValidServer(t *testing.T) {
-	s := New(&MockBucketFactory{}, config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
 	_, err := s.Start()
 	helpers.CheckError(t, err)
 	stopServer(t, s)
@@ -28,7 +37,7 @@ func TestValidServer(t *testing.T) {
 
 func TestUpdateConfig(t *testing.T) {
 	p := config.NewMemoryConfigPersister()
-	s := New(&MockBucketFactory{}, p, NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	s := New(NewMockBucketFactory(), p, NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
 
 	originalConfig := config.NewDefaultServiceConfig()
 	originalConfig.Version = 2
@@ -74,11 +83,11 @@ func TestTooManyTokensRequested(t *testing.T) {
 	cfg := config.NewDefaultServiceConfig()
 	nsc := config.NewDefaultNamespaceConfig("dummy")
 	bc := config.NewDefaultBucketConfig("dummy")
-	bc.MaxTokensPerRequest = 5
+	bc.MaxTokensPerRequest = proto.Int64(5)
 	helpers.CheckError(t, config.AddBucket(nsc, bc))
 	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
 
-	s := New(&MockBucketFactory{}, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
 	_, err := s.Start()
 	helpers.CheckError(t, err)
 	defer stopServer(t, s)
@@ -104,7 +113,7 @@ func TestTooManyTokensRequested(t *testing.T) {
 
 func TestInitWithLowerVersionedConfig(t *testing.T) {
 	p := config.NewMemoryConfigPersister()
-	s := New(&MockBucketFactory{}, p, NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	s := New(NewMockBucketFactory(), p, NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
 
 	// Write a config with version 2
 	s.cfgs = config.NewDefaultServiceConfig()
@@ -127,10 +136,9 @@ func TestBucketErrorEmitsEvent(t *testing.T) {
 	bc := config.NewDefaultBucketConfig("dummy")
 	helpers.CheckError(t, config.AddBucket(nsc, bc))
 	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
-	bf := MockBucketFactory{
-		SimulateFailure: true,
-	}
-	s := New(&bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	bf := NewMockBucketFactory()
+	bf.SetError("dummy", "dummy", errors.New("mock bucket had an error!"))
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
 	eventsCh := make(chan events.Event)
 	s.SetListener(func(evt events.Event) {
 		eventsCh <- evt
@@ -141,7 +149,7 @@ func TestBucketErrorEmitsEvent(t *testing.T) {
 
 	_, _, err = s.Allow(context.Background(), "dummy", "dummy", 1, 0, false)
 	if err == nil {
-		t.Fatal("Expected an Allow() error due to SimulateFailure=true on the mock bucket")
+		t.Fatal("Expected an Allow() error due to the mock bucket failing")
 	}
 
 	for {
@@ -163,3 +171,1240 @@ func stopServer(t *testing.T, s *server) {
 	_, err := s.Stop()
 	helpers.CheckError(t, err)
 }
+
+func TestInFlightLimit(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	cfg.MaxInFlightRequests = 1
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("dummy")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	_, _, e := s.Allow(context.Background(), "dummy", "dummy", 1, 0, false)
+	helpers.CheckError(t, e)
+
+	// Simulate a request in flight
+	release, e := s.admission.admit("dummy", 1, 0)
+	helpers.CheckError(t, e)
+
+	_, _, e = s.Allow(context.Background(), "dummy", "dummy", 1, 0, false)
+	expectOverloaded(t, e)
+
+	release()
+	_, _, e = s.Allow(context.Background(), "dummy", "dummy", 1, 0, false)
+	helpers.CheckError(t, e)
+}
+
+func TestCharge(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("dummy")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	helpers.CheckError(t, s.Charge(context.Background(), "dummy", "dummy", 10, 15))
+	helpers.CheckError(t, s.Charge(context.Background(), "dummy", "dummy", 10, 3))
+	if charged := bf.Charged("dummy", "dummy"); charged != -2 {
+		t.Fatalf("Expected net charge of -2 tokens, was %v", charged)
+	}
+
+	err = s.Charge(context.Background(), "dummy", "nonexistent", 1, 2)
+	if qsErr, ok := err.(QuotaServiceError); !ok || qsErr.Reason != ER_NO_BUCKET {
+		t.Fatalf("Expected ER_NO_BUCKET, got %v", err)
+	}
+}
+
+func TestForgiveDebt(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	b := config.NewDefaultBucketConfig("dummy")
+	b.Size = proto.Int64(10)
+	b.FillRate = proto.Int64(2)
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	helpers.CheckError(t, s.Charge(context.Background(), "dummy", "dummy", 0, 30))
+	debt, err := s.BucketDebt("dummy", "dummy")
+	helpers.CheckError(t, err)
+	if debt.Tokens != -20 || debt.DebtTokens != 20 || debt.DebtMillis != 10000 {
+		t.Fatalf("Expected a debt of 20 tokens, got %+v", debt)
+	}
+
+	helpers.CheckError(t, s.ForgiveDebt("dummy", "dummy", "alice"))
+	debt, err = s.BucketDebt("dummy", "dummy")
+	helpers.CheckError(t, err)
+	if debt.Tokens != 0 || debt.DebtTokens != 0 {
+		t.Fatalf("Expected the debt to be forgiven, got %+v", debt)
+	}
+
+	err = s.ForgiveDebt("dummy", "nonexistent", "alice")
+	if qsErr, ok := err.(QuotaServiceError); !ok || qsErr.Reason != ER_NO_BUCKET {
+		t.Fatalf("Expected ER_NO_BUCKET, got %v", err)
+	}
+}
+
+func TestBlockedBucketDebt(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	b := config.NewDefaultBucketConfig("blocked")
+	b.Size = proto.Int64(10)
+	b.FillRate = proto.Int64(0)
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	helpers.CheckError(t, s.Charge(context.Background(), "dummy", "blocked", 0, 30))
+	debt, err := s.BucketDebt("dummy", "blocked")
+	helpers.CheckError(t, err)
+	if debt.DebtTokens != 20 || debt.DebtMillis != 0 || !debt.Unbounded {
+		t.Fatalf("Expected an unbounded debt of 20 tokens, got %+v", debt)
+	}
+}
+
+func TestResetBucket(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("dummy")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	eventsCh := make(chan events.Event, 100)
+	s.SetListener(func(evt events.Event) {
+		eventsCh <- evt
+	}, 1000)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	helpers.CheckError(t, s.Charge(context.Background(), "dummy", "dummy", 0, 30))
+	helpers.CheckError(t, s.ResetBucket("dummy", "dummy", "alice"))
+	if charged := bf.Charged("dummy", "dummy"); charged != 0 {
+		t.Fatalf("Expected the bucket to be reset, but %v tokens were charged", charged)
+	}
+
+	for {
+		select {
+		case evt := <-eventsCh:
+			if evt.EventType() == events.EVENT_BUCKET_RESET && evt.BucketName() == "dummy" {
+				return
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatalf("did not get event with type %s within timeout", events.EVENT_BUCKET_RESET)
+		}
+	}
+}
+
+func TestRecentEvents(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	for _, name := range []string{"ns1", "ns2"} {
+		nsc := config.NewDefaultNamespaceConfig(name)
+		helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("b")))
+		helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+	}
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetListener(func(events.Event) {}, 100)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	for _, name := range []string{"ns1", "ns2", "ns1"} {
+		_, _, err := s.Allow(context.Background(), name, "b", 1, 0, false)
+		helpers.CheckError(t, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(s.RecentEvents("ns1", 0)) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 2 events in ns1, got %v", s.RecentEvents("ns1", 0))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	recent := s.RecentEvents("ns1", 1)
+	if len(recent) != 1 || recent[0].EventType() != events.EVENT_TOKENS_SERVED || recent[0].Namespace() != "ns1" {
+		t.Fatalf("Expected the most recent ns1 event, got %v", recent)
+	}
+
+	if len(s.RecentEvents("", 0)) < 3 {
+		t.Fatalf("Expected events from all namespaces, got %v", s.RecentEvents("", 0))
+	}
+}
+
+func TestSuppressedEvents(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("hot")
+	nsc.SuppressedEvents = []string{events.EVENT_TOKENS_SERVED.String()}
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("b")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	eventsCh := make(chan events.Event, 100)
+	s.SetListener(func(evt events.Event) {
+		eventsCh <- evt
+	}, 100)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	_, _, err = s.Allow(context.Background(), "hot", "b", 1, 0, false)
+	helpers.CheckError(t, err)
+	if _, _, err := s.Allow(context.Background(), "hot", "nonexistent", 1, 0, false); err == nil {
+		t.Fatal("Expected an error for a nonexistent bucket")
+	}
+
+	for {
+		select {
+		case evt := <-eventsCh:
+			if evt.EventType() == events.EVENT_TOKENS_SERVED {
+				t.Fatalf("Expected EVENT_TOKENS_SERVED to be suppressed, got %v", evt)
+			}
+
+			if evt.EventType() == events.EVENT_BUCKET_MISS {
+				return
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatalf("did not get event with type %s within timeout", events.EVENT_BUCKET_MISS)
+		}
+	}
+}
+
+func TestEagerStaticBuckets(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	cfg.EagerStaticBuckets = true
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("b")))
+	config.SetDynamicBucketTemplate(nsc, config.NewDefaultBucketConfig(""))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	if warmed := bf.Warmed("ns", "b"); warmed != 1 {
+		t.Fatalf("Expected the static bucket to be warmed when the config was applied, was warmed %v times", warmed)
+	}
+
+	_, _, err = s.Allow(context.Background(), "ns", "dyn", 1, 0, false)
+	helpers.CheckError(t, err)
+	if warmed := bf.Warmed("ns", "dyn"); warmed != 0 {
+		t.Fatalf("Expected dynamic buckets not to be warmed, was warmed %v times", warmed)
+	}
+}
+
+func TestConfigEvents(t *testing.T) {
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	eventsCh := make(chan events.Event, 100)
+	s.SetListener(func(evt events.Event) {
+		if evt.EventType() == events.EVENT_CONFIG_APPLIED || evt.EventType() == events.EVENT_CONFIG_REJECTED {
+			eventsCh <- evt
+		}
+	}, 100)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	nextEvent := func() events.Event {
+		select {
+		case evt := <-eventsCh:
+			return evt
+		case <-time.After(1 * time.Second):
+			t.Fatal("did not get a config event within timeout")
+			return nil
+		}
+	}
+
+	evt := nextEvent()
+	if evt.EventType() != events.EVENT_CONFIG_APPLIED {
+		t.Fatalf("Expected the initial config to be applied, got %v", evt)
+	}
+
+	helpers.CheckError(t, s.AddNamespace(config.NewDefaultNamespaceConfig("ns"), "alice"))
+	version := events.ConfigVersionOf(evt) + 1
+	if evt := nextEvent(); evt.EventType() != events.EVENT_CONFIG_APPLIED || events.ConfigVersionOf(evt) != version {
+		t.Fatalf("Expected version %v to be applied, got %v", version, evt)
+	}
+
+	stale := config.CloneConfig(s.Configs())
+	stale.Version = version - 1
+	s.updateBucketContainer(stale)
+	if evt := nextEvent(); evt.EventType() != events.EVENT_CONFIG_REJECTED || events.ConfigVersionOf(evt) != stale.Version {
+		t.Fatalf("Expected version %v to be rejected, got %v", stale.Version, evt)
+	}
+
+	invalid := config.CloneConfig(s.Configs())
+	invalid.Version = version + 1
+	invalid.Namespaces["ns"].DefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
+	invalid.Namespaces["ns"].DefaultBucket.Namespace = "ns"
+	invalid.Namespaces["ns"].DefaultBucket.QuotaGroup = "nonexistent"
+	helpers.CheckError(t, s.persister.PersistAndNotify("", invalid))
+	evt = nextEvent()
+	if evt.EventType() != events.EVENT_CONFIG_REJECTED || events.ConfigErrorOf(evt) == nil {
+		t.Fatalf("Expected an invalid config to be rejected, got %v", evt)
+	}
+
+	if s.Configs().Version != version {
+		t.Fatalf("Expected version %v to still be in use, got %v", version, s.Configs().Version)
+	}
+}
+
+func TestUpdateConfigValidatesBuckets(t *testing.T) {
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	b := config.NewDefaultBucketConfig("b")
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+	b.FillRate = proto.Int64(-1)
+	if s.UpdateConfig(cfg, "alice") == nil {
+		t.Fatal("Expected a bucket with a negative fill rate to be rejected")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	if err := s.SetReadOnly(true, "mallory"); err != admin.ErrNotAuthorized {
+		t.Fatalf("Expected ErrNotAuthorized, got %v", err)
+	}
+
+	s.SetReadOnlyAdmins("alice")
+	helpers.CheckError(t, s.SetReadOnly(true, "alice"))
+	if err := s.AddNamespace(config.NewDefaultNamespaceConfig("ns"), "bob"); err != admin.ErrReadOnly {
+		t.Fatalf("Expected ErrReadOnly, got %v", err)
+	}
+
+	helpers.CheckError(t, s.SetReadOnly(false, "alice"))
+	helpers.CheckError(t, s.AddNamespace(config.NewDefaultNamespaceConfig("ns"), "bob"))
+}
+
+func TestFollower(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("b")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+	persister := config.NewMemoryConfig(cfg)
+
+	s := New(NewMockBucketFactory(), persister, NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetFollower(true)
+	s.SetReadOnlyAdmins("alice")
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	if !s.ReadOnly() || !s.DebugState().Follower {
+		t.Fatal("Expected a follower to be read-only")
+	}
+
+	if err := s.AddNamespace(config.NewDefaultNamespaceConfig("ns2"), "alice"); err != admin.ErrFollower {
+		t.Fatalf("Expected ErrFollower, got %v", err)
+	}
+
+	if err := s.ResetBucket("ns", "b", "alice"); err != admin.ErrFollower {
+		t.Fatalf("Expected ErrFollower, got %v", err)
+	}
+
+	if err := s.SetReadOnly(false, "alice"); err != admin.ErrFollower {
+		t.Fatalf("Expected followers not to leave read-only mode, got %v", err)
+	}
+
+	// Configs persisted by other servers are still applied.
+	updated := config.CloneConfig(s.Configs())
+	updated.Version++
+	helpers.CheckError(t, config.AddNamespace(updated, config.NewDefaultNamespaceConfig("ns2")))
+	helpers.CheckError(t, persister.PersistAndNotify("", updated))
+	for deadline := time.Now().Add(time.Second); s.Configs().Version != updated.Version; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the follower to apply the persisted config")
+		}
+	}
+
+	if _, _, err := s.Allow(context.Background(), "ns", "b", 1, 0, false); err != nil {
+		t.Fatalf("Expected followers to serve requests, got %v", err)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("resolved")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetResolver(ResolverFunc(func(ctx context.Context, namespace, name string, tokens int64) (string, string, int64, error) {
+		if name == "unknown" {
+			return "", "", 0, errors.New("unknown caller")
+		}
+
+		return namespace, "resolved", tokens, nil
+	}))
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	_, _, err = s.Allow(context.Background(), "dummy", "anything", 1, 0, false)
+	helpers.CheckError(t, err)
+
+	helpers.CheckError(t, s.Charge(context.Background(), "dummy", "anything", 1, 3))
+	if charged := bf.Charged("dummy", "resolved"); charged != 2 {
+		t.Fatalf("Expected resolved bucket to be charged 2 tokens, was %v", charged)
+	}
+
+	_, _, err = s.Allow(context.Background(), "dummy", "unknown", 1, 0, false)
+	if qsErr, ok := err.(QuotaServiceError); !ok || qsErr.Reason != ER_NO_BUCKET {
+		t.Fatalf("Expected ER_NO_BUCKET, got %v", err)
+	}
+}
+
+func TestAccessLists(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	nsc.DeniedBuckets = []string{"abuser", "batch_*"}
+	nsc.AllowedBuckets = []string{"critical", "batch_critical"}
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("abuser")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	for _, name := range []string{"abuser", "batch_critical"} {
+		_, _, err = s.Allow(context.Background(), "dummy", name, 1, 0, false)
+		if qsErr, ok := err.(QuotaServiceError); !ok || qsErr.Reason != ER_DENIED {
+			t.Fatalf("Expected ER_DENIED for %v, got %v", name, err)
+		}
+	}
+
+	// Allowed even though no such bucket exists.
+	_, _, err = s.Allow(context.Background(), "dummy", "critical", 1, 0, false)
+	helpers.CheckError(t, err)
+}
+
+func TestResponseMetadata(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	nsc.Metadata = map[string]string{"docs": "https://example.com/quotas", "tier": "standard"}
+	b := config.NewDefaultBucketConfig("premium")
+	b.Metadata = map[string]string{"tier": "premium"}
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	ctx := WithResponseMetadata(context.Background())
+	_, _, err = s.Allow(ctx, "dummy", "premium", 1, 0, false)
+	helpers.CheckError(t, err)
+
+	md := ResponseMetadataFromContext(ctx)
+	if md["docs"] != "https://example.com/quotas" || md["tier"] != "premium" {
+		t.Fatalf("Expected namespace metadata overridden by the bucket's, got %v", md)
+	}
+
+	// Rejected requests still get the namespace's metadata.
+	ctx = WithResponseMetadata(context.Background())
+	_, _, err = s.Allow(ctx, "dummy", "nonexistent", 1, 0, false)
+	if qsErr, ok := err.(QuotaServiceError); !ok || qsErr.Reason != ER_NO_BUCKET {
+		t.Fatalf("Expected ER_NO_BUCKET, got %v", err)
+	}
+
+	if md = ResponseMetadataFromContext(ctx); md["tier"] != "standard" {
+		t.Fatalf("Expected namespace metadata, got %v", md)
+	}
+
+	if md = ResponseMetadataFromContext(context.Background()); md != nil {
+		t.Fatalf("Expected no metadata without WithResponseMetadata, got %v", md)
+	}
+}
+
+func TestBucketTemplatePropagation(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	cfg.BucketTemplates = map[string]*pb.BucketConfig{"tpl": {Size: proto.Int64(500)}}
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	helpers.CheckError(t, config.AddBucket(nsc, &pb.BucketConfig{Name: "dummy", Template: "tpl"}))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+	config.ApplyDefaults(cfg)
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	expectSize := func(size int64) {
+		t.Helper()
+		s.RLock()
+		b, _ := s.bucketContainer.FindBucket("dummy", "dummy")
+		s.RUnlock()
+
+		if b.Config().GetSize() != size {
+			t.Fatalf("Expected bucket size %v, was %v", size, b.Config().GetSize())
+		}
+	}
+
+	expectSize(500)
+
+	newCfg := config.CloneConfig(s.Configs())
+	newCfg.BucketTemplates["tpl"].Size = proto.Int64(1000)
+	helpers.CheckError(t, s.UpdateConfig(newCfg, "test"))
+
+	start := time.Now()
+	for s.Configs().BucketTemplates["tpl"].GetSize() != 1000 {
+		if time.Since(start) > time.Second {
+			t.Fatal("Timeout waiting for config to change!")
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	expectSize(1000)
+}
+
+func TestEnsureNamespace(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	tpl := config.NewDefaultNamespaceConfig("")
+	tpl.DynamicBucketTemplate = config.NewDefaultBucketConfig("")
+	cfg.NamespaceTemplates = map[string]*pb.NamespaceConfig{"service": tpl}
+
+	p := config.NewMemoryConfig(cfg)
+	s := New(NewMockBucketFactory(), p, NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	helpers.CheckError(t, s.EnsureNamespace("onboarded", "service", "bot"))
+	persisted, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	if persisted.Namespaces["onboarded"].GetDynamicBucketTemplate().GetNamespace() != "onboarded" {
+		t.Fatalf("Expected namespace to be created from template, got %+v", persisted.Namespaces["onboarded"])
+	}
+
+	// Idempotent, even before the new config has been applied.
+	helpers.CheckError(t, s.EnsureNamespace("onboarded", "service", "bot"))
+	again, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	if again.Version != persisted.Version {
+		t.Fatalf("Expected no new config version, got %v after %v", again.Version, persisted.Version)
+	}
+
+	if s.EnsureNamespace("other", "nonexistent", "bot") == nil {
+		t.Fatal("Expected an error for a nonexistent namespace template")
+	}
+}
+
+func TestConfigBundle(t *testing.T) {
+	staging := config.NewDefaultServiceConfig()
+	helpers.CheckError(t, config.AddNamespace(staging, config.NewDefaultNamespaceConfig("promoted")))
+
+	src := New(NewMockBucketFactory(), config.NewMemoryConfig(staging), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := src.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, src)
+
+	p := config.NewMemoryConfig(config.NewDefaultServiceConfig())
+	dst := New(NewMockBucketFactory(), p, NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err = dst.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, dst)
+
+	if _, err := src.ExportConfig("alice"); err == nil {
+		t.Fatal("Expected an error exporting without a bundle key")
+	}
+
+	src.SetConfigBundleKey([]byte("secret"))
+	bundle, err := src.ExportConfig("alice")
+	helpers.CheckError(t, err)
+
+	dst.SetConfigBundleKey([]byte("other"))
+	if err := dst.ImportConfig(bundle, "bob"); err != config.ErrBundleSignature {
+		t.Fatalf("Expected ErrBundleSignature importing with a different key, got %v", err)
+	}
+
+	dst.SetConfigBundleKey([]byte("secret"))
+	helpers.CheckError(t, dst.ImportConfig(bundle, "bob"))
+	persisted, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	if persisted.Namespaces["promoted"] == nil || persisted.User != "bob" {
+		t.Fatalf("Expected the bundle's config to be imported, got %+v", persisted)
+	}
+}
+
+func TestSoftDeleteNamespace(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("dummy")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	p := config.NewMemoryConfig(cfg)
+	s := New(NewMockBucketFactory(), p, NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	awaitNamespace := func(exists bool) {
+		t.Helper()
+		start := time.Now()
+		for s.bucketContainer.NamespaceExists("dummy") != exists {
+			if time.Since(start) > time.Second {
+				t.Fatalf("Timeout waiting for namespace to exist: %v", exists)
+			}
+
+			time.Sleep(time.Millisecond * 5)
+		}
+	}
+
+	helpers.CheckError(t, s.DeleteNamespace("dummy", "test"))
+	awaitNamespace(false)
+	if len(s.Configs().DeletedNamespaces) != 1 {
+		t.Fatal("Expected namespace to be retained after deletion")
+	}
+
+	helpers.CheckError(t, s.RestoreNamespace("dummy", "test"))
+	awaitNamespace(true)
+
+	// Purging does nothing until the retention period has passed.
+	helpers.CheckError(t, s.DeleteNamespace("dummy", "test"))
+	awaitNamespace(false)
+	helpers.CheckError(t, s.purgeDeletedNamespaces())
+	persisted, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	if len(persisted.DeletedNamespaces) != 1 {
+		t.Fatal("Expected namespace to be retained until the retention period has passed")
+	}
+}
+
+func TestApprovals(t *testing.T) {
+	p := config.NewMemoryConfig(config.NewDefaultServiceConfig())
+	s := New(NewMockBucketFactory(), p, NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	s.SetApprovers("alice", "bob")
+
+	err = s.AddNamespace(config.NewDefaultNamespaceConfig("ns"), "alice")
+	pendingErr, ok := err.(*admin.PendingApprovalError)
+	if !ok {
+		t.Fatalf("Expected change to be pending approval, got %v", err)
+	}
+
+	// Changes are validated upfront.
+	if _, ok := s.DeleteNamespace("nonexistent", "alice").(*admin.PendingApprovalError); ok {
+		t.Fatal("Expected an invalid change to be rejected, rather than queued")
+	}
+
+	changes := s.PendingChanges()
+	if len(changes) != 1 || changes[0].ID != pendingErr.ChangeID || changes[0].User != "alice" {
+		t.Fatalf("Expected one pending change by alice, got %+v", changes)
+	}
+
+	if err := s.ApproveChange(pendingErr.ChangeID, "alice"); err != admin.ErrSelfApproval {
+		t.Fatalf("Expected ErrSelfApproval, got %v", err)
+	}
+
+	if err := s.ApproveChange(pendingErr.ChangeID, "mallory"); err != admin.ErrNotApprover {
+		t.Fatalf("Expected ErrNotApprover, got %v", err)
+	}
+
+	helpers.CheckError(t, s.ApproveChange(pendingErr.ChangeID, "bob"))
+	persisted, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	if persisted.Namespaces["ns"] == nil || persisted.User != "alice, approved by bob" {
+		t.Fatalf("Expected approved change to be persisted, got %+v", persisted)
+	}
+
+	start := time.Now()
+	for s.Configs().Namespaces["ns"] == nil {
+		if time.Since(start) > time.Second {
+			t.Fatal("Timeout waiting for config to change!")
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	err = s.DeleteNamespace("ns", "bob")
+	pendingErr, ok = err.(*admin.PendingApprovalError)
+	if !ok {
+		t.Fatalf("Expected change to be pending approval, got %v", err)
+	}
+
+	helpers.CheckError(t, s.RejectChange(pendingErr.ChangeID, "alice"))
+	if len(s.PendingChanges()) != 0 {
+		t.Fatal("Expected rejected change to be discarded")
+	}
+
+	if err := s.ApproveChange(pendingErr.ChangeID, "alice"); err != admin.ErrNoSuchChange {
+		t.Fatalf("Expected ErrNoSuchChange, got %v", err)
+	}
+}
+
+func TestStaleChangesRemainPending(t *testing.T) {
+	p := config.NewMemoryConfig(config.NewDefaultServiceConfig())
+	s := New(NewMockBucketFactory(), p, NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	s.SetApprovers("alice", "bob")
+	base := s.Configs().Version
+	pendingErr, ok := s.AddNamespace(config.NewDefaultNamespaceConfig("ns"), "alice").(*admin.PendingApprovalError)
+	if !ok {
+		t.Fatal("Expected change to be pending approval")
+	}
+
+	changes := s.PendingChanges()
+	if len(changes) != 1 || changes[0].BaseVersion != base || changes[0].Config.Namespaces["ns"] == nil ||
+		!reflect.DeepEqual(changes[0].Changes, []string{"added namespace ns"}) {
+		t.Fatalf("Expected the proposed config to be pending, got %+v", changes[0])
+	}
+
+	// Another change is applied first, so the pending change no longer applies to the config it was
+	// reviewed against.
+	s.SetApprovers()
+	helpers.CheckError(t, s.AddNamespace(config.NewDefaultNamespaceConfig("other"), "carol"))
+	for deadline := time.Now().Add(time.Second); s.Configs().Version == base; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for config to change!")
+		}
+	}
+
+	s.SetApprovers("alice", "bob")
+	if err := s.ApproveChange(pendingErr.ChangeID, "bob"); err != admin.ErrStaleChange {
+		t.Fatalf("Expected ErrStaleChange, got %v", err)
+	}
+
+	if changes := s.PendingChanges(); len(changes) != 1 || changes[0].ID != pendingErr.ChangeID {
+		t.Fatalf("Expected the change to remain pending, got %+v", changes)
+	}
+
+	if persisted, _ := p.ReadPersistedConfig(); persisted.Namespaces["ns"] != nil {
+		t.Fatal("Expected the stale change not to be applied")
+	}
+
+	helpers.CheckError(t, s.RejectChange(pendingErr.ChangeID, "bob"))
+}
+
+func TestStatsSnapshots(t *testing.T) {
+	store := stats.NewMemorySnapshotStore()
+	helpers.CheckError(t, store.SaveSnapshot(stats.Snapshot{"ns": {
+		Hits:   map[string]int64{"dyn": 10},
+		Misses: map[string]int64{}}}))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetStatsListener(stats.NewMemoryStatsListener())
+	s.SetStatsSnapshotStore(store, time.Hour)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+
+	if scores := s.DynamicBucketStats("ns", "dyn"); scores.Hits != 10 {
+		t.Fatalf("Expected stats to be restored from snapshot, got %+v", scores)
+	}
+
+	s.statsListener.HandleEvent(events.NewBucketMissedEvent("ns", "dyn", true))
+	stopServer(t, s)
+
+	snapshot, err := store.LoadSnapshot()
+	helpers.CheckError(t, err)
+	if snapshot["ns"].Hits["dyn"] != 10 || snapshot["ns"].Misses["dyn"] != 1 {
+		t.Fatalf("Expected stats to be snapshotted on stop, got %+v", snapshot["ns"])
+	}
+}
+
+func TestBucketMaxWaitTime(t *testing.T) {
+	b := config.NewDefaultBucketConfig("b")
+	b.WaitTimeoutMillis = proto.Int64(1000)
+	for _, tc := range []struct {
+		maxWaitOverride       *int64
+		maxWaitMillisOverride int64
+		maxWaitTimeOverride   bool
+		expected              time.Duration
+	}{
+		{nil, 0, false, time.Second},
+		{nil, 500, true, 500 * time.Millisecond},
+		{nil, 5000, true, time.Second},
+		{proto.Int64(200), 0, false, 200 * time.Millisecond},
+		{proto.Int64(200), 500, true, 200 * time.Millisecond},
+		{proto.Int64(200), 100, true, 100 * time.Millisecond},
+		{proto.Int64(0), 500, true, 0},
+	} {
+		b.MaxWaitOverrideMillis = tc.maxWaitOverride
+		if w := bucketMaxWaitTime(b, tc.maxWaitMillisOverride, tc.maxWaitTimeOverride); w != tc.expected {
+			t.Errorf("Expected a max wait of %v with an override of %v, requesting %v (%v), got %v",
+				tc.expected, b.GetMaxWaitOverrideMillis(), tc.maxWaitMillisOverride, tc.maxWaitTimeOverride, w)
+		}
+	}
+}
+
+func TestMaxWaitOverride(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	b := config.NewDefaultBucketConfig("b")
+	b.WaitTimeoutMillis = proto.Int64(int64(time.Hour / time.Millisecond))
+	b.MaxWaitOverrideMillis = proto.Int64(100)
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	bf.SetWaitTime("ns", "b", time.Minute)
+	if _, _, err := s.Allow(context.Background(), "ns", "b", 1, 0, false); err == nil {
+		t.Fatal("Expected a wait longer than the max wait override to be denied")
+	}
+
+	if _, err := s.AllowAll(context.Background(), []BucketTokens{{"ns", "b", 1}}, 0, false); err == nil {
+		t.Fatal("Expected a wait longer than the max wait override to be denied when taking from several buckets")
+	}
+
+	bf.SetWaitTime("ns", "b", 50*time.Millisecond)
+	w, _, err := s.Allow(context.Background(), "ns", "b", 1, 0, false)
+	helpers.CheckError(t, err)
+	if w != 50*time.Millisecond {
+		t.Fatalf("Expected a wait within the max wait override to be granted, got %v", w)
+	}
+}
+
+func TestDeadlineAwareRejection(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	b := config.NewDefaultBucketConfig("b")
+	b.WaitTimeoutMillis = proto.Int64(int64(time.Hour / time.Millisecond))
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bf.SetWaitTime("ns", "b", time.Minute)
+	if _, _, err := s.Allow(ctx, "ns", "b", 1, 0, false); err == nil || err.(QuotaServiceError).Reason != ER_TIMEOUT {
+		t.Fatalf("Expected a wait past the deadline to time out, got %v", err)
+	}
+
+	if _, err := s.AllowAll(ctx, []BucketTokens{{"ns", "b", 1}}, 0, false); err == nil || err.(QuotaServiceError).Reason != ER_TIMEOUT {
+		t.Fatalf("Expected a wait past the deadline to time out when taking from several buckets, got %v", err)
+	}
+
+	bf.SetWaitTime("ns", "b", 50*time.Millisecond)
+	if _, _, err := s.Allow(ctx, "ns", "b", 1, 0, false); err != nil {
+		t.Fatalf("Expected a wait within the deadline to be granted, got %v", err)
+	}
+
+	bf.SetWaitTime("ns", "b", 0)
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	if _, _, err := s.Allow(expired, "ns", "b", 1, 0, false); err == nil || err.(QuotaServiceError).Reason != ER_TIMEOUT {
+		t.Fatalf("Expected a request past its deadline to time out without waiting, got %v", err)
+	}
+}
+
+func TestMaxWaitWithinDeadline(t *testing.T) {
+	if w, ok := MaxWaitWithinDeadline(context.Background(), time.Hour); !ok || w != time.Hour {
+		t.Fatalf("Expected the max wait to be unchanged without a deadline, got %v %v", w, ok)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if w, ok := MaxWaitWithinDeadline(ctx, time.Hour); !ok || w > time.Minute {
+		t.Fatalf("Expected the max wait to be capped by the deadline, got %v %v", w, ok)
+	}
+
+	if w, ok := MaxWaitWithinDeadline(ctx, time.Second); !ok || w != time.Second {
+		t.Fatalf("Expected a max wait within the deadline to be unchanged, got %v %v", w, ok)
+	}
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	if _, ok := MaxWaitWithinDeadline(expired, time.Hour); ok {
+		t.Fatal("Expected a passed deadline to be reported")
+	}
+}
+
+func TestAggregateStats(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	config.SetDynamicBucketTemplate(nsc, config.NewDefaultBucketConfig(""))
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("static")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	if totals := s.NamespaceStats("ns"); totals != nil {
+		t.Fatalf("Expected no stats without a stats listener, got %+v", totals)
+	}
+
+	s.SetStatsListener(stats.NewMemoryStatsListener())
+	s.SetListener(func(events.Event) {}, 100)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	for _, b := range []string{"static", "dyn1", "dyn2"} {
+		_, _, err = s.Allow(context.Background(), "ns", b, 2, 0, false)
+		helpers.CheckError(t, err)
+	}
+
+	// Events are delivered asynchronously. Stats only count dynamic buckets, but all buckets are
+	// active.
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		totals := s.NamespaceStats("ns")
+		if totals.Hits == 4 && totals.Created == 2 && totals.ActiveBuckets == 3 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected namespace totals to include all buckets, got %+v", totals)
+		}
+	}
+
+	if totals := s.GlobalStats(); totals.Hits != 4 || totals.ActiveBuckets < 3 {
+		t.Fatalf("Expected global totals to include the namespace, got %+v", totals)
+	}
+}
+
+// fakeElector is the leader while leader is set, and records being closed.
+type fakeElector struct {
+	leader, closed int32
+}
+
+func (e *fakeElector) IsLeader() bool { return atomic.LoadInt32(&e.leader) == 1 }
+func (e *fakeElector) Close()         { atomic.StoreInt32(&e.closed, 1) }
+
+// cleaningBucketFactory counts stale bucket cleanups.
+type cleaningBucketFactory struct {
+	MockBucketFactory
+	cleanups int32
+}
+
+func (bf *cleaningBucketFactory) CleanStaleBuckets(context.Context, bool) (*admin.CleanupReport, error) {
+	atomic.AddInt32(&bf.cleanups, 1)
+	return &admin.CleanupReport{}, nil
+}
+
+func TestLeaderElection(t *testing.T) {
+	bf := &cleaningBucketFactory{MockBucketFactory: NewMockBucketFactory()}
+	store := stats.NewMemorySnapshotStore()
+	elector := &fakeElector{}
+
+	s := New(bf, config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetStatsListener(stats.NewMemoryStatsListener())
+	s.SetStatsSnapshotStore(store, time.Hour)
+	s.SetLeaderElector(elector)
+	s.SetStaleBucketCleanupInterval(time.Millisecond)
+	s.SetReadOnlyAdmins("alice")
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	if cleanups := atomic.LoadInt32(&bf.cleanups); cleanups != 0 {
+		t.Fatalf("Expected only the leader to clean up stale buckets, got %v cleanups", cleanups)
+	}
+
+	atomic.StoreInt32(&elector.leader, 1)
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&bf.cleanups) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the leader to clean up stale buckets")
+		}
+	}
+
+	// Read-only mode pauses cleanups.
+	helpers.CheckError(t, s.SetReadOnly(true, "alice"))
+	time.Sleep(5 * time.Millisecond)
+	cleanups := atomic.LoadInt32(&bf.cleanups)
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&bf.cleanups) != cleanups {
+		t.Fatal("Expected read-only mode to pause cleanups")
+	}
+
+	atomic.StoreInt32(&elector.leader, 0)
+	s.statsListener.HandleEvent(events.NewBucketMissedEvent("ns", "dyn", true))
+	stopServer(t, s)
+
+	if snapshot, err := store.LoadSnapshot(); err != nil || snapshot != nil {
+		t.Fatalf("Expected only the leader to snapshot stats, got %+v, %v", snapshot, err)
+	}
+
+	if atomic.LoadInt32(&elector.closed) != 1 {
+		t.Fatal("Expected the elector to be closed when the server stops")
+	}
+}
+
+func TestDynamicBucketRegistry(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	config.SetDynamicBucketTemplate(nsc, config.NewDefaultBucketConfig(""))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	if _, err := s.DynamicBuckets("ns", "", 10); err == nil {
+		t.Fatal("Expected an error without a registry")
+	}
+
+	s.SetDynamicBucketRegistry(registry.NewMemoryRegistry(registry.NewDefaultConfig()))
+	s.SetListener(func(events.Event) {}, 100)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	_, _, err = s.Allow(context.Background(), "ns", "dyn", 1, 0, false)
+	helpers.CheckError(t, err)
+
+	// Events are delivered asynchronously.
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		page, err := s.DynamicBuckets("ns", "", 10)
+		helpers.CheckError(t, err)
+		if len(page.Buckets) == 1 && page.Buckets[0].Name == "dyn" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the dynamic bucket to be registered, got %+v", page.Buckets)
+		}
+	}
+}
+
+func TestUsageExporter(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("b")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	written := make(chan *usage.Row, 10)
+	usageCfg := usage.NewDefaultConfig()
+	usageCfg.Interval = 10 * time.Millisecond
+	exporter := usage.NewExporter(usage.SinkFunc(func(_ context.Context, rows []*usage.Row) error {
+		for _, row := range rows {
+			written <- row
+		}
+		return nil
+	}), usageCfg)
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetUsageExporter(exporter)
+	s.SetListener(func(events.Event) {}, 100)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	_, _, err = s.Allow(context.Background(), "ns", "b", 2, 0, false)
+	helpers.CheckError(t, err)
+
+	select {
+	case row := <-written:
+		if row.Bucket != "b" || row.Tokens != 2 {
+			t.Fatalf("Unexpected usage %+v", row)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected usage to be written")
+	}
+}
+
+func TestHealthMetrics(t *testing.T) {
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	s.SetListener(func(events.Event) {}, 10)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	h := s.HealthMetrics()
+	if h.Runtime == nil || h.Runtime.Goroutines == 0 {
+		t.Fatalf("Expected runtime metrics, got %+v", h.Runtime)
+	}
+
+	if h.ConfigReloads != 1 || h.EventQueueCapacity != 10 || h.Waiters != 0 || h.BucketPool != nil {
+		t.Fatalf("Unexpected health metrics %+v", h)
+	}
+}
+
+func TestDebugState(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	config.SetDynamicBucketTemplate(nsc, config.NewDefaultBucketConfig(""))
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("static")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	s := New(NewMockBucketFactory(), config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	if s.IsAdmin("alice") {
+		t.Fatal("Expected no admins by default")
+	}
+
+	s.SetReadOnlyAdmins("alice")
+	if !s.IsAdmin("alice") {
+		t.Fatal("Expected alice to be an admin")
+	}
+
+	_, _, err = s.Allow(context.Background(), "dummy", "dyn", 1, 0, false)
+	helpers.CheckError(t, err)
+
+	state := s.DebugState()
+	ns := state.Namespaces["dummy"]
+	if ns == nil || ns.StaticBuckets != 1 || ns.DynamicBuckets != 1 || ns.DefaultBucket {
+		t.Fatalf("Unexpected namespace state %+v", ns)
+	}
+
+	if state.ConfigVersion != s.Configs().Version || state.ReadOnly {
+		t.Fatalf("Unexpected debug state %+v", state)
+	}
+}
+
+type closingBucketFactory struct {
+	MockBucketFactory
+	closed bool
+}
+
+func (bf *closingBucketFactory) Close() {
+	bf.closed = true
+}
+
+func TestBucketFactoryClosedOnStop(t *testing.T) {
+	bf := &closingBucketFactory{MockBucketFactory: NewMockBucketFactory()}
+	s := New(bf, config.NewMemoryConfig(config.NewDefaultServiceConfig()), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	stopServer(t, s)
+
+	if !bf.closed {
+		t.Fatal("Expected bucket factory to be closed when the server stops")
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	now := time.Unix(1000, 0)
+	received := make(chan events.Event, 10)
+	listener := stats.NewMemoryStatsListener()
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("b")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	qs, err := NewServer(NewMockBucketFactory(), config.NewMemoryConfig(cfg),
+		WithEndpoints(NewMockEndpoint()),
+		WithListener(func(e events.Event) { received <- e }, 10),
+		WithStatsListener(listener),
+		WithClock(func() time.Time { return now }),
+		WithReaperConfig(NewReaperConfigForTests()),
+		WithMaxConfigReloadJitter(time.Second))
+	helpers.CheckError(t, err)
+
+	s := qs.(*server)
+	if s.statsListener != listener || s.reaperConfig != NewReaperConfigForTests() || s.maxJitterMillis != 1000 {
+		t.Fatalf("Expected options to configure the server, got %+v", s)
+	}
+
+	_, err = s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	_, _, err = s.Allow(context.Background(), "ns", "b", 1, 0, false)
+	helpers.CheckError(t, err)
+	for e := range received {
+		if e.EventType() == events.EVENT_TOKENS_SERVED {
+			break
+		}
+	}
+
+	version := s.Configs().Version
+	helpers.CheckError(t, s.AddNamespace(config.NewDefaultNamespaceConfig("other"), "alice"))
+	for s.Configs().Version == version {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if date := s.Configs().Date; date != now.Unix() {
+		t.Fatalf("Expected config changes to be dated by the clock, got %v", date)
+	}
+
+	s.SetApprovers("alice", "bob")
+	if _, ok := s.AddNamespace(config.NewDefaultNamespaceConfig("pending"), "alice").(*admin.PendingApprovalError); !ok {
+		t.Fatal("Expected the change to be pending approval")
+	}
+
+	if changes := s.PendingChanges(); len(changes) != 1 || changes[0].Created != now.Unix() {
+		t.Fatalf("Expected pending changes to be dated by the clock, got %+v", changes)
+	}
+
+	s.SetAdminRateLimit(1, 1)
+	if limiterNow := s.adminRateLimiter.now(); !limiterNow.Equal(now) {
+		t.Fatalf("Expected admin requests to be limited by the clock, got %v", limiterNow)
+	}
+}
+
+func TestNewServerMisconfigured(t *testing.T) {
+	persister := config.NewMemoryConfig(config.NewDefaultServiceConfig())
+	invalidReaper := NewReaperConfigForTests()
+	invalidReaper.MinFrequency = 0
+	bf, endpoint := NewMockBucketFactory(), NewMockEndpoint()
+
+	for name, create := range map[string]func() (Server, error){
+		"no bucket factory": func() (Server, error) { return NewServer(nil, persister, WithEndpoints(endpoint)) },
+		"no persister":      func() (Server, error) { return NewServer(bf, nil, WithEndpoints(endpoint)) },
+		"no endpoints":      func() (Server, error) { return NewServer(bf, persister) },
+		"nil endpoint":      func() (Server, error) { return NewServer(bf, persister, WithEndpoints(nil)) },
+		"no event buffer": func() (Server, error) {
+			return NewServer(bf, persister, WithEndpoints(endpoint), WithListener(func(events.Event) {}, 0))
+		},
+		"nil clock": func() (Server, error) {
+			return NewServer(bf, persister, WithEndpoints(endpoint), WithClock(nil))
+		},
+		"invalid reaper config": func() (Server, error) {
+			return NewServer(bf, persister, WithEndpoints(endpoint), WithReaperConfig(invalidReaper))
+		},
+		"negative jitter": func() (Server, error) {
+			return NewServer(bf, persister, WithEndpoints(endpoint), WithMaxConfigReloadJitter(-time.Second))
+		},
+	} {
+		if s, err := create(); err == nil || s != nil {
+			t.Errorf("Expected an error creating a server with %v, got %v", name, s)
+		}
+	}
+
+	helpers.ExpectingPanic(t, func() {
+		New(bf, persister, NewReaperConfigForTests(), 0)
+	})
+
+	// New accepted a negative jitter before NewServer validated options, and still does.
+	if s := New(bf, persister, NewReaperConfigForTests(), -1, endpoint).(*server); s.maxJitterMillis != 0 {
+		t.Fatalf("Expected a negative jitter to disable jitter, got %v", s.maxJitterMillis)
+	}
+}
@@ -0,0 +1,698 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package serverconfig assembles a quotaservice server from bootstrap settings - the bucket
+// backend, config persister, listener addresses and so on - read from a YAML file, environment
+// variables and command-line flags, so that servers can be run without writing Go code.
+package serverconfig
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang/protobuf/proto"
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/buckets/memory"
+	qsredis "github.com/square/quotaservice/buckets/redis"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/config/etcdpersister"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/leader"
+	pb "github.com/square/quotaservice/protos/config"
+	"github.com/square/quotaservice/registry"
+	"github.com/square/quotaservice/rpc/grpc"
+	qshttp "github.com/square/quotaservice/rpc/http"
+	"github.com/square/quotaservice/rpc/sockets"
+	"github.com/square/quotaservice/stats"
+	"github.com/square/quotaservice/usage"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+
+	PersisterMemory    = "memory"
+	PersisterDisk      = "disk"
+	PersisterZooKeeper = "zookeeper"
+	PersisterEtcd      = "etcd"
+
+	UsageFormatJSON    = "json"
+	UsageFormatParquet = "parquet"
+
+	// EnvPrefix prefixes the environment variables read by Load.
+	EnvPrefix = "QS_"
+)
+
+// Config holds the settings needed to assemble a server.
+type Config struct {
+	// Backend stores buckets: "memory" or "redis".
+	Backend string      `yaml:"backend"`
+	Redis   RedisConfig `yaml:"redis"`
+
+	// Persister stores the service config: "memory", "disk", "zookeeper" or "etcd".
+	Persister string `yaml:"persister"`
+	// ServiceConfigFile is a YAML service config loaded into the memory persister at startup.
+	ServiceConfigFile string          `yaml:"service_config_file"`
+	DiskPath          string          `yaml:"disk_path"`
+	ZooKeeper         ZooKeeperConfig `yaml:"zookeeper"`
+	Etcd              EtcdConfig      `yaml:"etcd"`
+	// Follower runs the server as a read-only follower, which only reads configs from a shared
+	// persister.
+	Follower bool `yaml:"follower"`
+	// LeaderID identifies this instance in elections, held with a lock in the Redis backend, for
+	// the one instance in a fleet that runs maintenance tasks. If empty, the instance runs them
+	// itself.
+	LeaderID string `yaml:"leader_id"`
+	// StaleBucketCleanupInterval is how often the leader deletes stale buckets from the backend. If
+	// zero, stale buckets are only cleaned up through the admin API.
+	StaleBucketCleanupInterval time.Duration `yaml:"stale_bucket_cleanup_interval"`
+
+	GRPCAddress string `yaml:"grpc_address"`
+	// HTTPAddress is where Allow and Charge are served as JSON over HTTP, if set.
+	HTTPAddress string `yaml:"http_address"`
+	// ReusePort sets SO_REUSEPORT on the gRPC and HTTP listeners, so that several processes can
+	// serve the same ports, e.g. while a replacement process starts. Only supported on Linux and
+	// macOS.
+	ReusePort bool `yaml:"reuse_port"`
+	// AdminAddress is where the admin console is served, if set.
+	AdminAddress string `yaml:"admin_address"`
+	// AdminAssets is the directory of admin UI assets. If empty, only the REST API is served.
+	AdminAssets string `yaml:"admin_assets"`
+	// AdminRateLimit is how many requests to change state through the admin API each user, or
+	// client address, may make a minute, in bursts of up to as many. If zero, they aren't limited.
+	AdminRateLimit int `yaml:"admin_rate_limit"`
+
+	// Stats keeps in-memory stats on bucket usage, served by the admin API.
+	Stats bool `yaml:"stats"`
+	// StatsStaticBuckets keeps stats on static buckets, as well as dynamic buckets. It adds work to
+	// every request, so is off by default.
+	StatsStaticBuckets bool `yaml:"stats_static_buckets"`
+	// DynamicBucketRegistry records live dynamic buckets, listed by the admin API, in Redis with the
+	// Redis backend, so that they are listed across a fleet, or else in memory.
+	DynamicBucketRegistry bool `yaml:"dynamic_bucket_registry"`
+	// Usage exports per-bucket usage every 5 minutes, to a directory or S3 bucket, if set.
+	Usage UsageConfig `yaml:"usage"`
+}
+
+// RedisConfig configures the Redis backend.
+type RedisConfig struct {
+	// Addresses of Redis nodes, as host:port. Cluster mode is used if there is more than one.
+	Addresses         []string      `yaml:"addresses"`
+	Cluster           bool          `yaml:"cluster"`
+	Password          string        `yaml:"password"`
+	DB                int           `yaml:"db"`
+	PoolSize          int           `yaml:"pool_size"`
+	ConnectionRetries int           `yaml:"connection_retries"`
+	KeyMaxIdleTime    time.Duration `yaml:"key_max_idle_time"`
+	// TimeUnit buckets are accounted in: nanos, micros or millis. Defaults to nanos.
+	TimeUnit string `yaml:"time_unit"`
+	// KeyPrefix prefixes every bucket key, e.g. "qs:staging:". Unprefixed by default.
+	KeyPrefix string `yaml:"key_prefix"`
+	// AllowUnprefixedCleanup allows stale bucket cleanup without a KeyPrefix, when Redis isn't
+	// shared with other applications whose keys could be mistaken for stale buckets.
+	AllowUnprefixedCleanup bool `yaml:"allow_unprefixed_cleanup"`
+}
+
+// UsageConfig configures usage export.
+type UsageConfig struct {
+	// Dir is a directory usage files are written to.
+	Dir string `yaml:"dir"`
+	// Format of the files written to Dir: json or parquet. Defaults to json.
+	Format string `yaml:"format"`
+	// S3Bucket is an S3 bucket Parquet files are uploaded to, under S3Prefix, with credentials from
+	// the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+	S3Bucket string `yaml:"s3_bucket"`
+	S3Region string `yaml:"s3_region"`
+	S3Prefix string `yaml:"s3_prefix"`
+	// S3Endpoint is the base URL of an S3-compatible store, if not S3 itself.
+	S3Endpoint string `yaml:"s3_endpoint"`
+}
+
+// ZooKeeperConfig configures the ZooKeeper persister.
+type ZooKeeperConfig struct {
+	Servers []string `yaml:"servers"`
+	Path    string   `yaml:"path"`
+}
+
+// EtcdConfig configures the etcd persister.
+type EtcdConfig struct {
+	// Endpoints are etcd client URLs, e.g. http://etcd-0:2379.
+	Endpoints []string `yaml:"endpoints"`
+	Prefix    string   `yaml:"prefix"`
+}
+
+// NewDefaultConfig returns a config for a server with in-memory buckets and config, serving gRPC
+// on localhost:10990 and the admin console on localhost:8080, with UI assets from admin/public.
+func NewDefaultConfig() *Config {
+	return &Config{
+		Backend:      BackendMemory,
+		Persister:    PersisterMemory,
+		Redis:        RedisConfig{Addresses: []string{"localhost:6379"}, ConnectionRetries: 3},
+		ZooKeeper:    ZooKeeperConfig{Path: "/quotaservice"},
+		Etcd:         EtcdConfig{Prefix: "/quotaservice"},
+		GRPCAddress:  "localhost:10990",
+		AdminAddress: "localhost:8080",
+		AdminAssets:  "admin/public",
+		Stats:        true}
+}
+
+// ReadConfig reads YAML settings over the defaults.
+func ReadConfig(r io.Reader) (*Config, error) {
+	c := NewDefaultConfig()
+	if err := c.readYAML(r); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Config) readYAML(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return yaml.UnmarshalStrict(b, c)
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	return c.readYAML(f)
+}
+
+// setting is a config setting that can be set from an environment variable or a flag.
+type setting struct {
+	name  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+func stringSetting(name, usage string, field func(c *Config) *string) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func listSetting(name, usage string, field func(c *Config) *[]string) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		*field(c) = splitList(value)
+		return nil
+	}}
+}
+
+func intSetting(name, usage string, field func(c *Config) *int) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %v %q: %v", name, value, err)
+		}
+
+		*field(c) = i
+		return nil
+	}}
+}
+
+func boolSetting(name, usage string, field func(c *Config) *bool) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %v %q: %v", name, value, err)
+		}
+
+		*field(c) = b
+		return nil
+	}}
+}
+
+func durationSetting(name, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %v %q: %v", name, value, err)
+		}
+
+		*field(c) = d
+		return nil
+	}}
+}
+
+var settings = []setting{
+	stringSetting("backend", "bucket backend: memory or redis", func(c *Config) *string { return &c.Backend }),
+	listSetting("redis-addresses", "comma-separated Redis addresses", func(c *Config) *[]string { return &c.Redis.Addresses }),
+	boolSetting("redis-cluster", "use Redis cluster mode", func(c *Config) *bool { return &c.Redis.Cluster }),
+	stringSetting("redis-password", "Redis password", func(c *Config) *string { return &c.Redis.Password }),
+	intSetting("redis-db", "Redis database", func(c *Config) *int { return &c.Redis.DB }),
+	intSetting("redis-pool-size", "Redis connection pool size", func(c *Config) *int { return &c.Redis.PoolSize }),
+	intSetting("redis-connection-retries", "Redis connection retries", func(c *Config) *int { return &c.Redis.ConnectionRetries }),
+	durationSetting("redis-key-max-idle-time", "how long idle bucket keys are kept in Redis", func(c *Config) *time.Duration { return &c.Redis.KeyMaxIdleTime }),
+	stringSetting("redis-time-unit", "time unit Redis buckets are accounted in: nanos, micros or millis", func(c *Config) *string { return &c.Redis.TimeUnit }),
+	stringSetting("redis-key-prefix", "prefix of Redis bucket keys", func(c *Config) *string { return &c.Redis.KeyPrefix }),
+	boolSetting("redis-allow-unprefixed-cleanup", "allow stale bucket cleanup without a Redis key prefix", func(c *Config) *bool { return &c.Redis.AllowUnprefixedCleanup }),
+	stringSetting("persister", "config persister: memory, disk, zookeeper or etcd", func(c *Config) *string { return &c.Persister }),
+	stringSetting("service-config-file", "YAML service config loaded by the memory persister", func(c *Config) *string { return &c.ServiceConfigFile }),
+	stringSetting("disk-path", "file the disk persister stores configs in", func(c *Config) *string { return &c.DiskPath }),
+	listSetting("zookeeper-servers", "comma-separated ZooKeeper servers", func(c *Config) *[]string { return &c.ZooKeeper.Servers }),
+	stringSetting("zookeeper-path", "ZooKeeper path configs are stored under", func(c *Config) *string { return &c.ZooKeeper.Path }),
+	listSetting("etcd-endpoints", "comma-separated etcd client URLs", func(c *Config) *[]string { return &c.Etcd.Endpoints }),
+	stringSetting("etcd-prefix", "etcd key prefix configs are stored under", func(c *Config) *string { return &c.Etcd.Prefix }),
+	boolSetting("follower", "run as a read-only follower, rejecting config changes", func(c *Config) *bool { return &c.Follower }),
+	stringSetting("leader-id", "ID to elect a leader with, through the Redis backend, to run maintenance tasks", func(c *Config) *string { return &c.LeaderID }),
+	durationSetting("stale-bucket-cleanup-interval", "how often the leader cleans up stale buckets; 0 to disable", func(c *Config) *time.Duration { return &c.StaleBucketCleanupInterval }),
+	stringSetting("grpc-address", "address to serve gRPC on", func(c *Config) *string { return &c.GRPCAddress }),
+	stringSetting("http-address", "address to serve JSON over HTTP on; empty to disable", func(c *Config) *string { return &c.HTTPAddress }),
+	boolSetting("reuse-port", "set SO_REUSEPORT on the gRPC and HTTP listeners", func(c *Config) *bool { return &c.ReusePort }),
+	stringSetting("admin-address", "address to serve the admin console on; empty to disable", func(c *Config) *string { return &c.AdminAddress }),
+	stringSetting("admin-assets", "directory of admin UI assets; empty to serve only the REST API", func(c *Config) *string { return &c.AdminAssets }),
+	intSetting("admin-rate-limit", "admin API changes each user may make a minute; 0 for no limit", func(c *Config) *int { return &c.AdminRateLimit }),
+	boolSetting("stats", "keep in-memory bucket stats", func(c *Config) *bool { return &c.Stats }),
+	boolSetting("stats-static-buckets", "keep stats on static buckets as well as dynamic buckets", func(c *Config) *bool { return &c.StatsStaticBuckets }),
+	boolSetting("dynamic-bucket-registry", "record live dynamic buckets, in Redis with the Redis backend", func(c *Config) *bool { return &c.DynamicBucketRegistry }),
+	stringSetting("usage-dir", "directory per-bucket usage is exported to; empty to disable", func(c *Config) *string { return &c.Usage.Dir }),
+	stringSetting("usage-format", "format of usage files: json or parquet", func(c *Config) *string { return &c.Usage.Format }),
+	stringSetting("usage-s3-bucket", "S3 bucket per-bucket usage is exported to; empty to disable", func(c *Config) *string { return &c.Usage.S3Bucket }),
+	stringSetting("usage-s3-region", "region of the usage S3 bucket", func(c *Config) *string { return &c.Usage.S3Region }),
+	stringSetting("usage-s3-prefix", "prefix of usage S3 objects", func(c *Config) *string { return &c.Usage.S3Prefix }),
+	stringSetting("usage-s3-endpoint", "base URL of an S3-compatible store for usage", func(c *Config) *string { return &c.Usage.S3Endpoint }),
+}
+
+// envName returns the environment variable for a setting, e.g. QS_REDIS_ADDRESSES for
+// redis-addresses.
+func envName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// Load reads settings from the YAML file named by the -config flag or the QS_CONFIG environment
+// variable, if any, then from QS_-prefixed environment variables (e.g. QS_BACKEND), then from
+// command-line flags (e.g. -backend), each taking precedence over the last. lookupEnv is usually
+// os.LookupEnv, and args are the command-line arguments, excluding the program name.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	fs := flag.NewFlagSet("quotaservice", flag.ContinueOnError)
+	configFile, _ := lookupEnv(envName("config"))
+	fs.StringVar(&configFile, "config", configFile, "YAML file of settings")
+
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		name := s.name
+		fs.Func(name, s.usage+" (env "+envName(name)+")", func(value string) error {
+			flagValues[name] = value
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := NewDefaultConfig()
+	if configFile != "" {
+		if err := c.readFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := lookupEnv(envName(s.name)); ok {
+			if err := s.set(c, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := flagValues[s.name]; ok {
+			if err := s.set(c, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c, c.Validate()
+}
+
+// Validate checks that the config names a known backend and persister, with the settings they
+// need.
+func (c *Config) Validate() error {
+	switch c.Backend {
+	case BackendMemory:
+	case BackendRedis:
+		if len(c.Redis.Addresses) == 0 {
+			return fmt.Errorf("the redis backend needs at least one address")
+		}
+
+		if c.Redis.TimeUnit != "" {
+			if _, err := qsredis.ParseTimeUnit(c.Redis.TimeUnit); err != nil {
+				return err
+			}
+		}
+
+		if err := c.keyLayout().Validate(); err != nil {
+			return err
+		}
+
+		if c.StaleBucketCleanupInterval > 0 && c.Redis.KeyPrefix == "" && !c.Redis.AllowUnprefixedCleanup {
+			return fmt.Errorf("stale bucket cleanup needs a redis key prefix, unless unprefixed cleanup is allowed")
+		}
+	default:
+		return fmt.Errorf("unknown backend %q", c.Backend)
+	}
+
+	switch c.Persister {
+	case PersisterMemory:
+	case PersisterDisk:
+		if c.DiskPath == "" {
+			return fmt.Errorf("the disk persister needs a disk path")
+		}
+	case PersisterZooKeeper:
+		if len(c.ZooKeeper.Servers) == 0 || c.ZooKeeper.Path == "" {
+			return fmt.Errorf("the zookeeper persister needs servers and a path")
+		}
+	case PersisterEtcd:
+		if len(c.Etcd.Endpoints) == 0 || c.Etcd.Prefix == "" {
+			return fmt.Errorf("the etcd persister needs endpoints and a prefix")
+		}
+	default:
+		return fmt.Errorf("unknown persister %q", c.Persister)
+	}
+
+	if c.Follower && c.Persister == PersisterMemory {
+		return fmt.Errorf("a follower needs a shared persister, such as disk, zookeeper or etcd")
+	}
+
+	if c.LeaderID != "" && c.Backend != BackendRedis {
+		return fmt.Errorf("leader election needs the redis backend")
+	}
+
+	if c.StaleBucketCleanupInterval < 0 {
+		return fmt.Errorf("the stale bucket cleanup interval can't be negative")
+	}
+
+	if c.GRPCAddress == "" {
+		return fmt.Errorf("a gRPC address is needed")
+	}
+
+	if c.AdminRateLimit < 0 {
+		return fmt.Errorf("the admin rate limit can't be negative")
+	}
+
+	if c.HTTPAddress != "" && !strings.Contains(c.HTTPAddress, ":") {
+		return fmt.Errorf("the HTTP address %q isn't of the form host:port", c.HTTPAddress)
+	}
+
+	switch c.Usage.Format {
+	case "", UsageFormatJSON, UsageFormatParquet:
+	default:
+		return fmt.Errorf("unknown usage format %q", c.Usage.Format)
+	}
+
+	if c.Usage.S3Bucket != "" && c.Usage.S3Region == "" {
+		return fmt.Errorf("usage export to S3 needs a region")
+	}
+
+	return nil
+}
+
+// NewBucketFactory creates the configured bucket backend.
+func (c *Config) NewBucketFactory() (quotaservice.BucketFactory, error) {
+	switch c.Backend {
+	case BackendMemory:
+		return memory.NewBucketFactory(), nil
+	case BackendRedis:
+		r := c.Redis
+		unit := qsredis.TIME_UNIT_NANOS
+		if r.TimeUnit != "" {
+			var err error
+			if unit, err = qsredis.ParseTimeUnit(r.TimeUnit); err != nil {
+				return nil, err
+			}
+		}
+
+		var bf quotaservice.BucketFactory
+		if r.Cluster || len(r.Addresses) > 1 {
+			bf = qsredis.NewClusterBucketFactory(&redis.ClusterOptions{
+				Addrs:    r.Addresses,
+				Password: r.Password,
+				PoolSize: r.PoolSize}, r.ConnectionRetries, r.KeyMaxIdleTime)
+		} else if len(r.Addresses) == 0 {
+			return nil, fmt.Errorf("the redis backend needs at least one address")
+		} else {
+			bf = qsredis.NewBucketFactory(&redis.Options{
+				Addr:     r.Addresses[0],
+				Password: r.Password,
+				DB:       r.DB,
+				PoolSize: r.PoolSize}, r.ConnectionRetries, r.KeyMaxIdleTime)
+		}
+
+		qsredis.SetTimeUnit(bf, unit)
+		qsredis.SetKeyLayout(bf, c.keyLayout())
+		cleanup := qsredis.NewDefaultCleanupConfig()
+		cleanup.AllowUnprefixed = r.AllowUnprefixedCleanup
+		qsredis.SetCleanupConfig(bf, cleanup)
+		return bf, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q", c.Backend)
+	}
+}
+
+// keyLayout returns the layout of the Redis backend's keys.
+func (c *Config) keyLayout() qsredis.KeyLayout {
+	layout := qsredis.NewDefaultKeyLayout()
+	layout.Prefix = c.Redis.KeyPrefix
+	return layout
+}
+
+// newRedisClient creates a client of the Redis backend, for uses other than storing buckets.
+func (c *Config) newRedisClient() redis.UniversalClient {
+	r := c.Redis
+	if r.Cluster || len(r.Addresses) > 1 {
+		return redis.NewClusterClient(&redis.ClusterOptions{Addrs: r.Addresses, Password: r.Password})
+	}
+
+	return redis.NewClient(&redis.Options{Addr: r.Addresses[0], Password: r.Password, DB: r.DB})
+}
+
+// NewPersister creates the configured config persister. The memory persister starts with the
+// contents of the service config file, if set, or else initial, if not nil, or else an empty
+// config.
+func (c *Config) NewPersister(initial *pb.ServiceConfig) (config.ConfigPersister, error) {
+	switch c.Persister {
+	case PersisterMemory:
+		if c.ServiceConfigFile != "" {
+			var err error
+			if initial, err = config.ParseConfigFile(c.ServiceConfigFile); err != nil {
+				return nil, err
+			}
+		}
+
+		if initial == nil {
+			initial = config.NewDefaultServiceConfig()
+		}
+
+		return config.NewMemoryConfig(initial), nil
+	case PersisterDisk:
+		return config.NewDiskConfigPersister(c.DiskPath)
+	case PersisterZooKeeper:
+		return config.NewZkConfigPersister(c.ZooKeeper.Path, c.ZooKeeper.Servers)
+	case PersisterEtcd:
+		cfg := etcdpersister.NewDefaultConfig(c.Etcd.Endpoints...)
+		cfg.Prefix = c.Etcd.Prefix
+		return etcdpersister.New(cfg)
+	default:
+		return nil, fmt.Errorf("unknown persister %q", c.Persister)
+	}
+}
+
+// NewServer assembles a server, which has yet to be started, from the config. initial is passed
+// to NewPersister.
+func (c *Config) NewServer(initial *pb.ServiceConfig) (quotaservice.Server, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	bf, err := c.NewBucketFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	persister, err := c.NewPersister(initial)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := c.newEndpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []quotaservice.Option{quotaservice.WithEndpoints(endpoints...)}
+	if c.Stats {
+		var statsOpts []stats.Option
+		if c.StatsStaticBuckets {
+			statsOpts = append(statsOpts, stats.WithStaticBuckets())
+		}
+
+		opts = append(opts, quotaservice.WithStatsListener(stats.NewMemoryStatsListener(statsOpts...)))
+	}
+
+	server, err := quotaservice.NewServer(bf, persister, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.AdminRateLimit > 0 {
+		server.SetAdminRateLimit(float64(c.AdminRateLimit)/60, c.AdminRateLimit)
+	}
+
+	if c.DynamicBucketRegistry {
+		if c.Backend == BackendRedis {
+			server.SetDynamicBucketRegistry(registry.NewRedisRegistry(c.newRedisClient(), registry.NewDefaultConfig()))
+		} else {
+			server.SetDynamicBucketRegistry(registry.NewMemoryRegistry(registry.NewDefaultConfig()))
+		}
+	}
+
+	if sink := c.newUsageSink(); sink != nil {
+		cfg := usage.NewDefaultConfig()
+		cfg.Server, _ = os.Hostname()
+		server.SetUsageExporter(usage.NewExporter(sink, cfg))
+	}
+
+	server.SetFollower(c.Follower)
+	server.SetStaleBucketCleanupInterval(c.StaleBucketCleanupInterval)
+	if c.LeaderID != "" {
+		server.SetLeaderElector(leader.NewRedisElector(c.newRedisClient(), leader.NewDefaultRedisConfig(c.LeaderID)))
+	}
+
+	return server, nil
+}
+
+// newEndpoints creates the gRPC endpoint and, if an HTTP address is set, the HTTP endpoint. With
+// ReusePort, their listeners are created up front, so that failing to listen is reported here.
+func (c *Config) newEndpoints() ([]quotaservice.RpcEndpoint, error) {
+	if !c.ReusePort {
+		endpoints := []quotaservice.RpcEndpoint{grpc.New(c.GRPCAddress, events.NewNilProducer())}
+		if c.HTTPAddress != "" {
+			endpoints = append(endpoints, qshttp.NewWithAddress(c.HTTPAddress))
+		}
+
+		return endpoints, nil
+	}
+
+	lis, err := sockets.ListenReusePort("tcp", c.GRPCAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []quotaservice.RpcEndpoint{grpc.NewWithListener(lis, events.NewNilProducer())}
+	if c.HTTPAddress != "" {
+		httpLis, err := sockets.ListenReusePort("tcp", c.HTTPAddress)
+		if err != nil {
+			_ = lis.Close()
+			return nil, err
+		}
+
+		endpoints = append(endpoints, qshttp.NewWithListener(httpLis))
+	}
+
+	return endpoints, nil
+}
+
+// newUsageSink creates the sink usage is exported to, or nil if usage isn't exported. Usage is
+// uploaded to S3 if a bucket is set, or else written to files in the usage directory.
+func (c *Config) newUsageSink() usage.Sink {
+	u := c.Usage
+	switch {
+	case u.S3Bucket != "":
+		cfg := usage.NewS3Config(u.S3Bucket, u.S3Region)
+		cfg.Prefix = u.S3Prefix
+		cfg.Endpoint = u.S3Endpoint
+		return usage.NewS3Sink(cfg)
+	case u.Dir != "" && u.Format == UsageFormatParquet:
+		return usage.NewParquetFileSink(u.Dir)
+	case u.Dir != "":
+		return usage.NewJSONFileSink(u.Dir)
+	default:
+		return nil
+	}
+}
+
+// ReloadServiceConfig re-reads the service config file, if set, and applies it as a config update
+// on behalf of user, through the same path as updates made with the admin API, unless it matches
+// the current config. It returns whether the config was updated. Settings other than the service
+// config, such as the backend, only take effect on restart. Followers never reload it.
+func (c *Config) ReloadServiceConfig(a admin.Administrable, user string) (bool, error) {
+	if c.ServiceConfigFile == "" || c.Follower {
+		return false, nil
+	}
+
+	cfg, err := config.ParseConfigFile(c.ServiceConfigFile)
+	if err != nil {
+		return false, err
+	}
+
+	if sameServiceConfig(cfg, a.Configs()) {
+		return false, nil
+	}
+
+	if err := a.UpdateConfig(cfg, user); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ChangedSettings returns the YAML names of the settings that differ in reloaded, e.g. settings
+// re-read on SIGHUP. Unlike the contents of the service config file, these settings are only read
+// when a server is assembled, so changes to them only take effect on restart.
+func (c *Config) ChangedSettings(reloaded *Config) []string {
+	var changed []string
+	v1, v2 := reflect.ValueOf(c).Elem(), reflect.ValueOf(reloaded).Elem()
+	for i := 0; i < v1.NumField(); i++ {
+		if !reflect.DeepEqual(v1.Field(i).Interface(), v2.Field(i).Interface()) {
+			changed = append(changed, v1.Type().Field(i).Tag.Get("yaml"))
+		}
+	}
+
+	return changed
+}
+
+// sameServiceConfig compares configs, ignoring when and by whom they were made.
+func sameServiceConfig(c1, c2 *pb.ServiceConfig) bool {
+	if c1 == nil || c2 == nil {
+		return c1 == c2
+	}
+
+	c1, c2 = config.CloneConfig(c1), config.CloneConfig(c2)
+	for _, c := range []*pb.ServiceConfig{c1, c2} {
+		c.Version, c.User, c.Date = 0, "", 0
+	}
+
+	return proto.Equal(c1, c2)
+}
@@ -0,0 +1,270 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package serverconfig
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := Load(nil, env(nil))
+	helpers.CheckError(t, err)
+
+	if !reflect.DeepEqual(c, NewDefaultConfig()) {
+		t.Errorf("Expected defaults, got %+v", c)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serverconfig")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "quotaservice.yaml")
+	helpers.CheckError(t, ioutil.WriteFile(file, []byte(`
+backend: redis
+redis:
+  addresses: [redis-1:6379]
+  pool_size: 5
+  key_max_idle_time: 1h
+  time_unit: millis
+  key_prefix: "qs:"
+leader_id: qs-1
+stale_bucket_cleanup_interval: 6h
+grpc_address: 0.0.0.0:1000
+admin_address: 0.0.0.0:2000
+`), 0644))
+
+	c, err := Load(
+		[]string{"-config", file, "-grpc-address", "0.0.0.0:3000"},
+		env(map[string]string{
+			"QS_REDIS_ADDRESSES": "redis-2:6379, redis-3:6379",
+			"QS_GRPC_ADDRESS":    "0.0.0.0:4000",
+			"QS_STATS":           "false"}))
+	helpers.CheckError(t, err)
+
+	if c.Backend != BackendRedis || c.Redis.PoolSize != 5 || c.Redis.KeyMaxIdleTime != time.Hour || c.Redis.TimeUnit != "millis" || c.Redis.KeyPrefix != "qs:" || c.LeaderID != "qs-1" || c.StaleBucketCleanupInterval != 6*time.Hour || c.AdminAddress != "0.0.0.0:2000" {
+		t.Errorf("Expected settings from the file, got %+v", c)
+	}
+
+	if !reflect.DeepEqual(c.Redis.Addresses, []string{"redis-2:6379", "redis-3:6379"}) || c.Stats {
+		t.Errorf("Expected environment variables to override the file, got %+v", c)
+	}
+
+	if c.GRPCAddress != "0.0.0.0:3000" {
+		t.Errorf("Expected flags to override environment variables, got %v", c.GRPCAddress)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serverconfig")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "quotaservice.yaml")
+	helpers.CheckError(t, ioutil.WriteFile(file, []byte("persister: disk\ndisk_path: /tmp/qs.cfg\n"), 0644))
+
+	c, err := Load(nil, env(map[string]string{"QS_CONFIG": file}))
+	helpers.CheckError(t, err)
+
+	if c.Persister != PersisterDisk || c.DiskPath != "/tmp/qs.cfg" {
+		t.Errorf("Expected settings from the file, got %+v", c)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		env  map[string]string
+	}{
+		{args: []string{"-backend", "cassandra"}},
+		{args: []string{"-persister", "disk"}},
+		{args: []string{"-persister", "zookeeper", "-zookeeper-servers", ""}},
+		{args: []string{"-persister", "etcd"}},
+		{args: []string{"-persister", "etcd", "-etcd-endpoints", "http://etcd:2379", "-etcd-prefix", ""}},
+		{args: []string{"-http-address", "8081"}},
+		{args: []string{"-admin-rate-limit", "-1"}},
+		{args: []string{"-backend", "redis", "-redis-addresses", ""}},
+		{env: map[string]string{"QS_REDIS_DB": "one"}},
+		{env: map[string]string{"QS_STATS": "maybe"}},
+		{args: []string{"-redis-key-max-idle-time", "forever"}},
+		{args: []string{"-backend", "redis", "-redis-time-unit", "seconds"}},
+		{args: []string{"-follower"}},
+		{args: []string{"-leader-id", "qs-1"}},
+		{args: []string{"-stale-bucket-cleanup-interval", "-1h"}},
+		{args: []string{"-backend", "redis", "-stale-bucket-cleanup-interval", "1h"}},
+		{args: []string{"-backend", "redis", "-redis-key-prefix", "qs:{"}},
+		{args: []string{"-usage-format", "csv"}},
+		{args: []string{"-usage-s3-bucket", "usage"}},
+		{args: []string{"-config", "/nonexistent.yaml"}},
+		{args: []string{"-unknown"}},
+	} {
+		if _, err := Load(tc.args, env(tc.env)); err == nil {
+			t.Errorf("Expected an error for %v %v", tc.args, tc.env)
+		}
+	}
+}
+
+func TestReadConfigStrict(t *testing.T) {
+	if _, err := ReadConfig(strings.NewReader("backnd: redis\n")); err == nil {
+		t.Error("Expected an error for an unknown setting")
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	c := NewDefaultConfig()
+	cfg := config.NewDefaultServiceConfig()
+	helpers.CheckError(t, config.AddNamespace(cfg, config.NewDefaultNamespaceConfig("ns")))
+
+	if _, err := c.NewServer(cfg); err != nil {
+		t.Fatalf("NewServer errored: %v", err)
+	}
+
+	c.DynamicBucketRegistry = true
+	c.Usage.Dir = t.TempDir()
+	c.Usage.Format = UsageFormatParquet
+	c.GRPCAddress = "localhost:0"
+	c.HTTPAddress = "localhost:0"
+	server, err := c.NewServer(cfg)
+	helpers.CheckError(t, err)
+	_, err = server.Start()
+	helpers.CheckError(t, err)
+	// Stopping the server stops the usage exporter's flusher.
+	t.Cleanup(func() { _, _ = server.Stop() })
+	if _, err := server.GetServerAdministrable().DynamicBuckets("ns", "", 10); err != nil {
+		t.Errorf("Expected the dynamic bucket registry to be enabled, got %v", err)
+	}
+
+	// Several servers can listen on the same ports with SO_REUSEPORT.
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		helpers.CheckError(t, err)
+		c.GRPCAddress = lis.Addr().String()
+		helpers.CheckError(t, lis.Close())
+
+		c.ReusePort = true
+		first, err := c.NewServer(cfg)
+		helpers.CheckError(t, err)
+		_, err = first.Start()
+		helpers.CheckError(t, err)
+		t.Cleanup(func() { _, _ = first.Stop() })
+		if _, err := c.NewServer(cfg); err != nil {
+			t.Errorf("Expected a second server to listen on the same port, got %v", err)
+		}
+		c.ReusePort = false
+	}
+
+	persister, err := c.NewPersister(cfg)
+	helpers.CheckError(t, err)
+	persisted, err := persister.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	if persisted.Namespaces["ns"] == nil {
+		t.Errorf("Expected the memory persister to start with the initial config, got %+v", persisted)
+	}
+
+	etcd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer etcd.Close()
+	c.Persister = PersisterEtcd
+	c.Etcd.Endpoints = []string{etcd.URL}
+	persister, err = c.NewPersister(cfg)
+	helpers.CheckError(t, err)
+	persister.Close()
+
+	c.Backend = BackendRedis
+	c.Redis.Addresses = []string{"localhost:6379", "localhost:6380"}
+	if _, err := c.NewBucketFactory(); err != nil {
+		t.Errorf("Expected a Redis cluster bucket factory, got %v", err)
+	}
+
+	c.Persister = "mysql"
+	if _, err := c.NewServer(cfg); err == nil {
+		t.Error("Expected an error for an unknown persister")
+	}
+}
+
+func TestMalformedServiceConfigFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "service.yaml")
+	helpers.CheckError(t, ioutil.WriteFile(file, []byte("namespaces: [\n"), 0644))
+
+	c := NewDefaultConfig()
+	c.ServiceConfigFile = file
+	if _, err := c.NewServer(nil); err == nil {
+		t.Fatal("Expected an error for a malformed service config file")
+	}
+}
+
+func TestReloadServiceConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serverconfig")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "service.yaml")
+	helpers.CheckError(t, ioutil.WriteFile(file, []byte("namespaces:\n  ns1:\n    name: ns1\n"), 0644))
+
+	c := NewDefaultConfig()
+	c.GRPCAddress = "localhost:0"
+	c.ServiceConfigFile = file
+	s, err := c.NewServer(nil)
+	helpers.CheckError(t, err)
+	_, err = s.Start()
+	helpers.CheckError(t, err)
+	defer func() { _, _ = s.Stop() }()
+
+	a := s.GetServerAdministrable()
+	if updated, err := c.ReloadServiceConfig(a, "test"); err != nil || updated {
+		t.Fatalf("Expected no update for an unchanged file, got %v, %v", updated, err)
+	}
+
+	helpers.CheckError(t, ioutil.WriteFile(file, []byte("namespaces:\n  ns2:\n    name: ns2\n"), 0644))
+	if updated, err := c.ReloadServiceConfig(a, "test"); err != nil || !updated {
+		t.Fatalf("Expected an update for a changed file, got %v, %v", updated, err)
+	}
+
+	helpers.CheckError(t, ioutil.WriteFile(file, []byte("namespaces: [unclosed"), 0644))
+	if _, err := c.ReloadServiceConfig(a, "test"); err == nil {
+		t.Fatal("Expected an error for invalid YAML")
+	}
+
+	c.Follower = true
+	if updated, err := c.ReloadServiceConfig(a, "test"); err != nil || updated {
+		t.Fatalf("Expected followers not to reload the file, got %v, %v", updated, err)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	c := NewDefaultConfig()
+	reloaded := NewDefaultConfig()
+	if changed := c.ChangedSettings(reloaded); len(changed) != 0 {
+		t.Fatalf("Expected no changes, got %v", changed)
+	}
+
+	reloaded.Backend = BackendRedis
+	reloaded.Redis.PoolSize = 20
+	reloaded.Usage.Dir = "/tmp/usage"
+	if changed := c.ChangedSettings(reloaded); !reflect.DeepEqual(changed, []string{"backend", "redis", "usage"}) {
+		t.Fatalf("Expected the backend, redis and usage settings to have changed, got %v", changed)
+	}
+}
@@ -0,0 +1,25 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice_test
+
+import (
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/events"
+	qstesting "github.com/square/quotaservice/testing"
+)
+
+// init hands the mocks in package testing to the tests of quotaservice's internals, which can't
+// import them. See export_test.go.
+func init() {
+	quotaservice.NewMockBucketFactory = func() quotaservice.MockBucketFactory {
+		return &qstesting.MockBucketFactory{}
+	}
+	quotaservice.NewMockEmitter = func() interface{ Emit(e events.Event) } {
+		return &qstesting.MockEmitter{}
+	}
+	quotaservice.NewMockEndpoint = func() quotaservice.RpcEndpoint {
+		return &qstesting.MockEndpoint{}
+	}
+	quotaservice.NewReaperConfigForTests = qstesting.NewReaperConfig
+}
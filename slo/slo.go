@@ -0,0 +1,214 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package slo tracks, for each bucket, how often granted requests wait longer than a latency
+// budget, so teams can tell whether their limits cause user-visible latency.
+package slo
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/admin"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+)
+
+// Config configures a Tracker.
+type Config struct {
+	// Threshold is the longest a granted request may wait and still count towards the objective.
+	Threshold time.Duration
+	// Thresholds overrides Threshold for specific buckets, keyed on their fully qualified names.
+	Thresholds map[string]time.Duration
+	// Objective is the fraction of granted requests, between 0 and 1, that must wait no longer than
+	// the threshold.
+	Objective float64
+	// Window is the rolling period over which the objective is evaluated, in steps of Interval.
+	Window   time.Duration
+	Interval time.Duration
+	// MinRequests is the number of requests granted within the window before a bucket can breach
+	// its objective, to avoid flagging buckets on low traffic.
+	MinRequests int64
+	// EmitEvents emits an EVENT_SLO_BREACHED event each time a bucket starts breaching its
+	// objective.
+	EmitEvents bool
+}
+
+// NewDefaultConfig returns a config expecting 99% of grants to wait no longer than 100ms, over
+// the last 5 minutes.
+func NewDefaultConfig() Config {
+	return Config{
+		Threshold:   100 * time.Millisecond,
+		Objective:   0.99,
+		Window:      5 * time.Minute,
+		Interval:    10 * time.Second,
+		MinRequests: 100}
+}
+
+type bucketKey struct {
+	namespace, bucket string
+}
+
+// bucketGrants counts the requests granted by a bucket, and those that waited too long, in each
+// interval of the window.
+type bucketGrants struct {
+	dynamic  bool
+	breached bool
+	// intervals holds, for each slot, the interval it was last used for.
+	intervals     []int64
+	granted, slow []int64
+}
+
+// Tracker tracks how often requests granted by each bucket wait longer than their threshold. Its
+// HandleEvent function is an events.Listener.
+type Tracker struct {
+	cfg     Config
+	slots   int
+	buckets map[bucketKey]*bucketGrants
+	emit    func(events.Event)
+	now     func() time.Time
+	sync.Mutex
+}
+
+// NewTracker creates a Tracker.
+func NewTracker(cfg Config) *Tracker {
+	if cfg.Interval <= 0 || cfg.Window < cfg.Interval {
+		panic("Window must be at least one positive interval")
+	}
+
+	if cfg.Objective <= 0 || cfg.Objective > 1 {
+		panic("Objective must be between 0 and 1")
+	}
+
+	return &Tracker{
+		cfg:     cfg,
+		slots:   int(cfg.Window / cfg.Interval),
+		buckets: make(map[bucketKey]*bucketGrants),
+		now:     time.Now}
+}
+
+// SetEmitter sets the function EVENT_SLO_BREACHED events are emitted with, if Config.EmitEvents is
+// set. Servers set this to their own event producer.
+func (t *Tracker) SetEmitter(emit func(events.Event)) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.emit = emit
+}
+
+func (t *Tracker) threshold(namespace, bucket string) time.Duration {
+	if d, ok := t.cfg.Thresholds[config.FullyQualifiedName(namespace, bucket)]; ok {
+		return d
+	}
+
+	return t.cfg.Threshold
+}
+
+// HandleEvent is an events.Listener, counting EVENT_TOKENS_SERVED events.
+func (t *Tracker) HandleEvent(event events.Event) {
+	if event.EventType() != events.EVENT_TOKENS_SERVED {
+		return
+	}
+
+	now := t.now().UnixNano() / int64(t.cfg.Interval)
+	key := bucketKey{event.Namespace(), event.BucketName()}
+	threshold := t.threshold(key.namespace, key.bucket)
+
+	t.Lock()
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &bucketGrants{
+			dynamic:   event.Dynamic(),
+			intervals: make([]int64, t.slots),
+			granted:   make([]int64, t.slots),
+			slow:      make([]int64, t.slots)}
+		t.buckets[key] = b
+	}
+
+	slot := now % int64(t.slots)
+	if b.intervals[slot] != now {
+		b.intervals[slot] = now
+		b.granted[slot], b.slow[slot] = 0, 0
+	}
+
+	b.granted[slot]++
+	if event.WaitTime() > threshold {
+		b.slow[slot]++
+	}
+
+	granted, slow := t.totals(b, now)
+	breached := t.breached(granted, slow)
+	startedBreaching := breached && !b.breached
+	b.breached = breached
+	emit := t.emit
+	t.Unlock()
+
+	if startedBreaching && t.cfg.EmitEvents && emit != nil {
+		emit(events.NewSLOBreachedEvent(key.namespace, key.bucket, event.Dynamic(), slow, threshold))
+	}
+}
+
+// totals returns the requests granted by a bucket within the window, and how many of those waited
+// too long. Callers must hold the lock.
+func (t *Tracker) totals(b *bucketGrants, now int64) (granted, slow int64) {
+	for i := 0; i < t.slots; i++ {
+		interval := now - int64(i)
+		slot := interval % int64(t.slots)
+		if b.intervals[slot] == interval {
+			granted += b.granted[slot]
+			slow += b.slow[slot]
+		}
+	}
+
+	return
+}
+
+func (t *Tracker) breached(granted, slow int64) bool {
+	return granted >= t.cfg.MinRequests && granted > 0 &&
+		float64(granted-slow)/float64(granted) < t.cfg.Objective
+}
+
+// Report returns the status of every bucket that granted requests within the window, breaching
+// buckets first. Buckets that haven't are forgotten.
+func (t *Tracker) Report() *admin.SLOReport {
+	now := t.now().UnixNano() / int64(t.cfg.Interval)
+	report := &admin.SLOReport{Buckets: []*admin.SLOStatus{}}
+
+	t.Lock()
+	for key, b := range t.buckets {
+		granted, slow := t.totals(b, now)
+		if granted == 0 {
+			delete(t.buckets, key)
+			continue
+		}
+
+		b.breached = t.breached(granted, slow)
+		report.Buckets = append(report.Buckets, &admin.SLOStatus{
+			Namespace:       key.namespace,
+			Bucket:          key.bucket,
+			Dynamic:         b.dynamic,
+			ThresholdMillis: t.threshold(key.namespace, key.bucket).Nanoseconds() / int64(time.Millisecond),
+			Objective:       t.cfg.Objective,
+			Granted:         granted,
+			Slow:            slow,
+			WithinThreshold: float64(granted-slow) / float64(granted),
+			Breached:        b.breached})
+	}
+	t.Unlock()
+
+	sort.Slice(report.Buckets, func(i, j int) bool {
+		a, b := report.Buckets[i], report.Buckets[j]
+		if a.Breached != b.Breached {
+			return a.Breached
+		}
+
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+
+		return a.Bucket < b.Bucket
+	})
+
+	return report
+}
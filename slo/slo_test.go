@@ -0,0 +1,94 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package slo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+)
+
+func newTestTracker(emitted *[]events.Event) (*Tracker, *time.Time) {
+	tr := NewTracker(Config{
+		Threshold:   100 * time.Millisecond,
+		Thresholds:  map[string]time.Duration{"ns:patient": time.Second},
+		Objective:   0.9,
+		Window:      10 * time.Second,
+		Interval:    time.Second,
+		MinRequests: 10,
+		EmitEvents:  true})
+	now := time.Unix(1000, 0)
+	tr.now = func() time.Time { return now }
+	tr.SetEmitter(func(e events.Event) { *emitted = append(*emitted, e) })
+	return tr, &now
+}
+
+func serve(tr *Tracker, bucket string, n int, wait time.Duration) {
+	for i := 0; i < n; i++ {
+		tr.HandleEvent(events.NewTokensServedEvent("ns", bucket, false, 1, wait))
+	}
+}
+
+func TestBreach(t *testing.T) {
+	var emitted []events.Event
+	tr, now := newTestTracker(&emitted)
+
+	serve(tr, "b", 18, 0)
+	serve(tr, "b", 2, 200*time.Millisecond)
+	if len(emitted) != 0 {
+		t.Fatalf("Expected 10%% slow requests to meet a 90%% objective, got %v", emitted)
+	}
+
+	serve(tr, "b", 1, 200*time.Millisecond)
+	if len(emitted) != 1 || emitted[0].EventType() != events.EVENT_SLO_BREACHED || emitted[0].NumTokens() != 3 ||
+		emitted[0].WaitTime() != 100*time.Millisecond {
+		t.Fatalf("Expected a single breach event, got %v", emitted)
+	}
+
+	// Only the start of a breach is emitted.
+	serve(tr, "b", 1, 200*time.Millisecond)
+	if len(emitted) != 1 {
+		t.Fatalf("Expected a single breach event, got %v", emitted)
+	}
+
+	report := tr.Report()
+	if len(report.Buckets) != 1 || !report.Buckets[0].Breached || report.Buckets[0].Granted != 22 ||
+		report.Buckets[0].Slow != 4 || report.Buckets[0].ThresholdMillis != 100 {
+		t.Fatalf("Unexpected report %+v", report.Buckets[0])
+	}
+
+	// Once the window passes, the bucket recovers, and is forgotten.
+	*now = now.Add(10 * time.Second)
+	serve(tr, "b", 10, 0)
+	if len(emitted) != 1 || tr.Report().Buckets[0].Breached {
+		t.Fatalf("Expected the bucket to recover, got %+v", tr.Report().Buckets[0])
+	}
+
+	*now = now.Add(10 * time.Second)
+	if report = tr.Report(); len(report.Buckets) != 0 {
+		t.Fatalf("Expected idle buckets to be forgotten, got %+v", report.Buckets)
+	}
+}
+
+func TestMinRequests(t *testing.T) {
+	var emitted []events.Event
+	tr, _ := newTestTracker(&emitted)
+
+	serve(tr, "b", 9, time.Second)
+	if len(emitted) != 0 || tr.Report().Buckets[0].Breached {
+		t.Fatal("Expected buckets with too few requests not to breach")
+	}
+}
+
+func TestThresholdOverride(t *testing.T) {
+	var emitted []events.Event
+	tr, _ := newTestTracker(&emitted)
+
+	serve(tr, "patient", 20, 500*time.Millisecond)
+	report := tr.Report()
+	if len(emitted) != 0 || report.Buckets[0].Breached || report.Buckets[0].ThresholdMillis != 1000 {
+		t.Fatalf("Expected the bucket's threshold to be overridden, got %+v", report.Buckets[0])
+	}
+}
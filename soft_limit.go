@@ -0,0 +1,126 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// OverSoftLimitMetadataKey is set to "true" in the response metadata of requests granted past their
+// bucket's soft limit.
+const OverSoftLimitMetadataKey = "over-soft-limit"
+
+// SoftLimitBucketSuffix names the bucket tracking a bucket's soft limit, which is created by the
+// same BucketFactory, so that the soft limit is shared by all servers, like the bucket itself. A
+// bucket named "b" has its soft limit tracked by "b#soft_limit".
+const SoftLimitBucketSuffix = "#soft_limit"
+
+// softLimitedBucket tracks consumption of a bucket against its soft limit, using a second bucket
+// whose size and fill rate are soft_limit_percent of the bucket's. Every granted request is asked
+// of the soft limit bucket without waiting; if it can't grant the tokens, the request is over the
+// soft limit. The soft limit never denies requests.
+type softLimitedBucket struct {
+	Bucket
+	softLimit Bucket
+}
+
+func newSoftLimitedBucket(b Bucket, softLimit Bucket) *softLimitedBucket {
+	return &softLimitedBucket{Bucket: b, softLimit: softLimit}
+}
+
+// softLimitConfig returns the config of the bucket tracking cfg's soft limit.
+func softLimitConfig(cfg *pbconfig.BucketConfig) *pbconfig.BucketConfig {
+	return &pbconfig.BucketConfig{
+		Name:          cfg.Name + SoftLimitBucketSuffix,
+		Namespace:     cfg.Namespace,
+		Size:          proto.Int64(percentOf(cfg.GetSize(), cfg.GetSoftLimitPercent())),
+		FillRate:      proto.Int64(percentOf(cfg.GetFillRate(), cfg.GetSoftLimitPercent())),
+		MaxIdleMillis: cfg.MaxIdleMillis,
+		MaxDebtMillis: proto.Int64(0)}
+}
+
+// percentOf returns percent of n, at least 1, without overflowing.
+func percentOf(n, percent int64) int64 {
+	p := n/100*percent + n%100*percent/100
+	if p < 1 {
+		return 1
+	}
+
+	return p
+}
+
+func (b *softLimitedBucket) Take(ctx context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	wait, ok, err := b.Bucket.Take(ctx, numTokens, maxWaitTime)
+	if err != nil || !ok {
+		return wait, ok, err
+	}
+
+	if _, under, err := b.softLimit.Take(ctx, numTokens, 0); err == nil && !under {
+		markOverSoftLimit(ctx)
+	}
+
+	return wait, true, nil
+}
+
+func (b *softLimitedBucket) Charge(ctx context.Context, numTokens int64) error {
+	if err := b.Bucket.Charge(ctx, numTokens); err != nil {
+		return err
+	}
+
+	// The soft limit is advisory, so it's best effort.
+	_ = b.softLimit.Charge(ctx, numTokens)
+	return nil
+}
+
+func (b *softLimitedBucket) Destroy() {
+	b.Bucket.Destroy()
+	b.softLimit.Destroy()
+}
+
+// softLimitOf returns the bucket tracking the soft limit of b, or of the bucket b wraps, or nil if
+// it has no soft limit.
+func softLimitOf(b Bucket) Bucket {
+	for {
+		switch w := b.(type) {
+		case *softLimitedBucket:
+			return w.softLimit
+		case *reapableBucket:
+			b = w.Bucket
+		case *sampledBucket:
+			b = w.Bucket
+		case *negativeCachedBucket:
+			b = w.Bucket
+		case *borrowingBucket:
+			b = w.Bucket
+		case *fairShareBucket:
+			b = w.Bucket
+		default:
+			return nil
+		}
+	}
+}
+
+type overSoftLimitKey struct{}
+
+// withSoftLimit returns a context in which buckets record whether a request was over their soft
+// limit, read with overSoftLimit.
+func withSoftLimit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, overSoftLimitKey{}, new(int32))
+}
+
+func markOverSoftLimit(ctx context.Context) {
+	if over, ok := ctx.Value(overSoftLimitKey{}).(*int32); ok {
+		atomic.StoreInt32(over, 1)
+	}
+}
+
+func overSoftLimit(ctx context.Context) bool {
+	over, ok := ctx.Value(overSoftLimitKey{}).(*int32)
+	return ok && atomic.LoadInt32(over) == 1
+}
@@ -0,0 +1,131 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestSoftLimit(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	b := config.NewDefaultBucketConfig("b")
+	b.SoftLimitPercent = proto.Int64(80)
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	eventsCh := make(chan events.Event, 100)
+	s.SetListener(func(evt events.Event) {
+		if evt.EventType() == events.EVENT_OVER_SOFT_LIMIT {
+			eventsCh <- evt
+		}
+	}, 1000)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	allow := func() map[string]string {
+		ctx := WithResponseMetadata(context.Background())
+		_, _, err := s.Allow(ctx, "dummy", "b", 1, 0, false)
+		helpers.CheckError(t, err)
+		return ResponseMetadataFromContext(ctx)
+	}
+
+	if md := allow(); md[OverSoftLimitMetadataKey] != "" {
+		t.Fatalf("Expected a request under the soft limit not to be flagged, got %v", md)
+	}
+
+	// The soft limit can't grant tokens without waiting, but the bucket still can.
+	bf.SetWaitTime("dummy", "b"+SoftLimitBucketSuffix, time.Second)
+	if md := allow(); md[OverSoftLimitMetadataKey] != "true" {
+		t.Fatalf("Expected a request over the soft limit to be flagged, got %v", md)
+	}
+
+	select {
+	case evt := <-eventsCh:
+		if evt.BucketName() != "b" || evt.NumTokens() != 1 {
+			t.Fatalf("Expected an event for 1 token from b, got %v", evt)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("did not get event with type %s within timeout", events.EVENT_OVER_SOFT_LIMIT)
+	}
+
+	// Past the hard limit, requests are denied.
+	bf.SetWaitTime("dummy", "b", time.Minute)
+	ctx := WithResponseMetadata(context.Background())
+	if _, _, err := s.Allow(ctx, "dummy", "b", 1, 0, false); err == nil {
+		t.Fatal("Expected a request over the hard limit to be denied")
+	}
+
+	if md := ResponseMetadataFromContext(ctx); md[OverSoftLimitMetadataKey] != "" {
+		t.Fatalf("Expected a denied request not to be flagged, got %v", md)
+	}
+}
+
+func TestSoftLimitConfig(t *testing.T) {
+	b := config.NewDefaultBucketConfig("b")
+	b.Size = proto.Int64(1000)
+	b.FillRate = proto.Int64(50)
+	b.SoftLimitPercent = proto.Int64(99)
+
+	soft := softLimitConfig(b)
+	if soft.GetSize() != 990 || soft.GetFillRate() != 49 || soft.GetMaxDebtMillis() != 0 {
+		t.Fatalf("Expected size and fill rate scaled to the soft limit, without debt, got %v", soft)
+	}
+
+	b.FillRate = proto.Int64(1)
+	if soft = softLimitConfig(b); soft.GetFillRate() != 1 {
+		t.Fatalf("Expected the soft limit to fill at least 1 token/sec, got %v", soft.GetFillRate())
+	}
+}
+
+func TestSoftLimitAdmin(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("dummy")
+	b := config.NewDefaultBucketConfig("b")
+	b.SoftLimitPercent = proto.Int64(80)
+	helpers.CheckError(t, config.AddBucket(nsc, b))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	_, _, err = s.Allow(context.Background(), "dummy", "b", 1, 0, false)
+	helpers.CheckError(t, err)
+
+	helpers.CheckError(t, s.Charge(context.Background(), "dummy", "b", 0, 5))
+	if bf.Charged("dummy", "b") != 5 || bf.Charged("dummy", "b"+SoftLimitBucketSuffix) != 5 {
+		t.Fatal("Expected the bucket and its soft limit to be charged")
+	}
+
+	if _, err := s.BucketDebt("dummy", "b"); err != nil {
+		t.Fatalf("Expected the debt of a bucket with a soft limit to be reported, got %v", err)
+	}
+
+	helpers.CheckError(t, s.ForgiveDebt("dummy", "b", "alice"))
+	helpers.CheckError(t, s.ResetBucket("dummy", "b", "alice"))
+	if bf.Charged("dummy", "b") != 0 || bf.Charged("dummy", "b"+SoftLimitBucketSuffix) != 0 {
+		t.Fatal("Expected resetting the bucket to reset its soft limit")
+	}
+
+	// Buckets with soft limits are taken from in a single call.
+	s.RLock()
+	wrapped := s.bucketContainer.findExistingBucket("dummy", "b")
+	s.RUnlock()
+	if backing, err := backingBucket(wrapped); err != nil || backing == wrapped {
+		t.Fatalf("Expected the soft limit to be unwrapped, got %T", backing)
+	}
+}
@@ -5,28 +5,44 @@ package stats
 
 import (
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/square/quotaservice/events"
 )
 
 type namespaceStats struct {
-	hits, misses map[string]*BucketScore
+	hits, misses      map[string]*BucketScore
+	waits, waitMillis map[string]*BucketScore
+	created, removed  int64
 }
 
 type memoryListener struct {
-	namespaces map[string]*namespaceStats
+	namespaces   map[string]*namespaceStats
+	opts         *options
+	sync.RWMutex // Embedded mutex
 }
 
-// NewMemoryStatsListener creates an in-memory stats listener.
-func NewMemoryStatsListener() Listener {
-	return &memoryListener{make(map[string]*namespaceStats)}
+// NewMemoryStatsListener creates an in-memory stats listener. It implements Snapshotter, so its
+// stats can be persisted across restarts with a SnapshotStore.
+func NewMemoryStatsListener(opts ...Option) Listener {
+	return &memoryListener{namespaces: make(map[string]*namespaceStats), opts: newOptions(opts)}
+}
+
+func newNamespaceStats() *namespaceStats {
+	return &namespaceStats{
+		hits:       make(map[string]*BucketScore),
+		misses:     make(map[string]*BucketScore),
+		waits:      make(map[string]*BucketScore),
+		waitMillis: make(map[string]*BucketScore)}
 }
 
 func (l *memoryListener) bucketScoreTop10(scoreMap map[string]*BucketScore) []*BucketScore {
 	arr := make(BucketScoreArray, 0)
 
+	// Copies, since scores continue to be updated once the lock is released.
 	for _, value := range scoreMap {
-		arr = append(arr, value)
+		arr = append(arr, &BucketScore{value.Bucket, value.Score})
 	}
 
 	sort.Sort(arr)
@@ -43,6 +59,9 @@ func (l *memoryListener) bucketScoreTop10(scoreMap map[string]*BucketScore) []*B
 // TopHits returns a sorted list of the 10 buckets with the highest # of hits
 // in the specified namespace
 func (l *memoryListener) TopHits(namespace string) []*BucketScore {
+	l.RLock()
+	defer l.RUnlock()
+
 	stats, ok := l.namespaces[namespace]
 
 	if !ok {
@@ -56,6 +75,9 @@ func (l *memoryListener) TopHits(namespace string) []*BucketScore {
 // TopMisses returns a sorted list of the 10 buckets with the highest # of misses
 // in the specified namespace
 func (l *memoryListener) TopMisses(namespace string) []*BucketScore {
+	l.RLock()
+	defer l.RUnlock()
+
 	stats, ok := l.namespaces[namespace]
 
 	if !ok {
@@ -66,40 +88,99 @@ func (l *memoryListener) TopMisses(namespace string) []*BucketScore {
 }
 
 // Get is implemented for stats.Listener
-// Get returns the hits and misses for a bucket in the specified namespace
+// Get returns the hits, misses and waits for a bucket in the specified namespace
 func (l *memoryListener) Get(namespace, bucket string) *BucketScores {
+	l.RLock()
+	defer l.RUnlock()
+
 	stats, ok := l.namespaces[namespace]
 
 	if !ok {
 		return emptyBucketScores
 	}
 
-	scores := &BucketScores{0, 0}
+	return &BucketScores{
+		Hits:       scoreOf(stats.hits, bucket),
+		Misses:     scoreOf(stats.misses, bucket),
+		Waits:      scoreOf(stats.waits, bucket),
+		WaitMillis: scoreOf(stats.waitMillis, bucket)}
+}
 
-	if hitValue, ok := stats.hits[bucket]; ok {
-		scores.Hits = hitValue.Score
+func scoreOf(scoreMap map[string]*BucketScore, bucket string) int64 {
+	if value, ok := scoreMap[bucket]; ok {
+		return value.Score
 	}
 
-	if missValue, ok := stats.misses[bucket]; ok {
-		scores.Misses = missValue.Score
+	return 0
+}
+
+// NamespaceStats is implemented for stats.Listener
+// NamespaceStats returns the totals of the tracked buckets in the specified namespace
+func (l *memoryListener) NamespaceStats(namespace string) *AggregateStats {
+	l.RLock()
+	defer l.RUnlock()
+
+	stats, ok := l.namespaces[namespace]
+
+	if !ok {
+		return &AggregateStats{}
 	}
 
-	return scores
+	return stats.totals()
+}
+
+// GlobalStats is implemented for stats.Listener
+// GlobalStats returns the totals of the tracked buckets in all namespaces
+func (l *memoryListener) GlobalStats() *AggregateStats {
+	l.RLock()
+	defer l.RUnlock()
+
+	global := &AggregateStats{}
+
+	for _, stats := range l.namespaces {
+		global.add(stats.totals())
+	}
+
+	return global
+}
+
+func (s *namespaceStats) totals() *AggregateStats {
+	totals := &AggregateStats{Created: s.created, Removed: s.removed}
+
+	for _, score := range s.hits {
+		totals.Hits += score.Score
+	}
+
+	for _, score := range s.misses {
+		totals.Misses += score.Score
+	}
+
+	for _, score := range s.waits {
+		totals.Waits += score.Score
+	}
+
+	for _, score := range s.waitMillis {
+		totals.WaitMillis += score.Score
+	}
+
+	return totals
 }
 
 // HandleEvent is implemented for stats.Listener
-// HandleEvent consumes dynamic bucket events (see events.Event)
+// HandleEvent consumes dynamic bucket events, and static bucket events with
+// WithStaticBuckets (see events.Event)
 func (l *memoryListener) HandleEvent(event events.Event) {
-	if !event.Dynamic() {
+	if !l.opts.tracks(event) {
 		return
 	}
 
 	namespace := event.Namespace()
 
+	l.Lock()
+	defer l.Unlock()
+
 	if _, ok := l.namespaces[namespace]; !ok {
-		l.namespaces[namespace] = &namespaceStats{
-			make(map[string]*BucketScore),
-			make(map[string]*BucketScore)}
+		l.namespaces[namespace] = newNamespaceStats()
 	}
 
 	stats := l.namespaces[namespace]
@@ -113,15 +194,93 @@ func (l *memoryListener) HandleEvent(event events.Event) {
 	case events.EVENT_TOKENS_SERVED:
 		numTokens = event.NumTokens()
 		statsBucket = stats.hits
+
+		if wait := event.WaitTime(); wait > 0 {
+			addScore(stats.waits, event.BucketName(), 1)
+			addScore(stats.waitMillis, event.BucketName(), int64(wait/time.Millisecond))
+		}
+	case events.EVENT_BUCKET_CREATED:
+		if event.Dynamic() {
+			stats.created++
+		}
+		return
+	case events.EVENT_BUCKET_REMOVED:
+		if event.Dynamic() {
+			stats.removed++
+		}
+		return
 	default:
 		return
 	}
 
-	key := event.BucketName()
+	addScore(statsBucket, event.BucketName(), numTokens)
+}
+
+func addScore(scoreMap map[string]*BucketScore, key string, score int64) {
+	if _, ok := scoreMap[key]; !ok {
+		scoreMap[key] = &BucketScore{key, 0}
+	}
+
+	scoreMap[key].Score += score
+}
 
-	if _, ok := statsBucket[key]; !ok {
-		statsBucket[key] = &BucketScore{key, 0}
+// Snapshot is implemented for stats.Snapshotter
+func (l *memoryListener) Snapshot() Snapshot {
+	l.RLock()
+	defer l.RUnlock()
+
+	snapshot := make(Snapshot, len(l.namespaces))
+
+	for namespace, stats := range l.namespaces {
+		snapshot[namespace] = &NamespaceSnapshot{
+			Hits:       scoreMapSnapshot(stats.hits),
+			Misses:     scoreMapSnapshot(stats.misses),
+			Waits:      scoreMapSnapshot(stats.waits),
+			WaitMillis: scoreMapSnapshot(stats.waitMillis),
+			Created:    stats.created,
+			Removed:    stats.removed}
 	}
 
-	statsBucket[key].Score += numTokens
+	return snapshot
+}
+
+// Restore is implemented for stats.Snapshotter
+// Restore adds the hits, misses and waits in a snapshot to those already recorded
+func (l *memoryListener) Restore(snapshot Snapshot) {
+	l.Lock()
+	defer l.Unlock()
+
+	for namespace, nsSnapshot := range snapshot {
+		if nsSnapshot == nil {
+			continue
+		}
+
+		if _, ok := l.namespaces[namespace]; !ok {
+			l.namespaces[namespace] = newNamespaceStats()
+		}
+
+		stats := l.namespaces[namespace]
+		restoreScoreMap(stats.hits, nsSnapshot.Hits)
+		restoreScoreMap(stats.misses, nsSnapshot.Misses)
+		restoreScoreMap(stats.waits, nsSnapshot.Waits)
+		restoreScoreMap(stats.waitMillis, nsSnapshot.WaitMillis)
+		stats.created += nsSnapshot.Created
+		stats.removed += nsSnapshot.Removed
+	}
+}
+
+func scoreMapSnapshot(scoreMap map[string]*BucketScore) map[string]int64 {
+	scores := make(map[string]int64, len(scoreMap))
+
+	for key, value := range scoreMap {
+		scores[key] = value.Score
+	}
+
+	return scores
+}
+
+func restoreScoreMap(scoreMap map[string]*BucketScore, scores map[string]int64) {
+	for key, score := range scores {
+		addScore(scoreMap, key, score)
+	}
 }
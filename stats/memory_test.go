@@ -6,6 +6,7 @@ package stats
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/square/quotaservice/events"
 )
@@ -127,3 +128,51 @@ func TestMemoryTop10Misses(t *testing.T) {
 		t.Fatalf("Misses top10 is not correct %+v", misses)
 	}
 }
+
+func TestMemoryAggregateStats(t *testing.T) {
+	listener = NewMemoryStatsListener()
+	listener.HandleEvent(events.NewBucketCreatedEvent("test", "a", true))
+	listener.HandleEvent(events.NewBucketCreatedEvent("test", "b", true))
+	listener.HandleEvent(events.NewTokensServedEvent("test", "a", true, 3, 0))
+	listener.HandleEvent(events.NewTokensServedEvent("test", "b", true, 2, 0))
+	listener.HandleEvent(events.NewBucketRemovedEvent("test", "b", true))
+	listener.HandleEvent(events.NewBucketMissedEvent("other", "c", true))
+	listener.HandleEvent(events.NewBucketCreatedEvent("other", "static", false))
+
+	expected := &AggregateStats{Hits: 5, Created: 2, Removed: 1}
+	if totals := listener.NamespaceStats("test"); !reflect.DeepEqual(totals, expected) {
+		t.Fatalf("Namespace totals were not accurate: %+v != %+v", totals, expected)
+	}
+
+	expected = &AggregateStats{Hits: 5, Misses: 1, Created: 2, Removed: 1}
+	if totals := listener.GlobalStats(); !reflect.DeepEqual(totals, expected) {
+		t.Fatalf("Global totals were not accurate: %+v != %+v", totals, expected)
+	}
+
+	if totals := listener.NamespaceStats("nonexistent"); !reflect.DeepEqual(totals, &AggregateStats{}) {
+		t.Fatalf("Nonexisting namespace totals were not empty: %+v", totals)
+	}
+}
+
+func TestMemoryStaticBuckets(t *testing.T) {
+	listener = NewMemoryStatsListener(WithStaticBuckets())
+	listener.HandleEvent(events.NewBucketCreatedEvent("test", "static", false))
+	listener.HandleEvent(events.NewTokensServedEvent("test", "static", false, 2, 0))
+	listener.HandleEvent(events.NewTokensServedEvent("test", "static", false, 1, 30*time.Millisecond))
+	listener.HandleEvent(events.NewBucketMissedEvent("test", "dyn", true))
+
+	expected := &BucketScores{Hits: 3, Waits: 1, WaitMillis: 30}
+	if scores := listener.Get("test", "static"); !reflect.DeepEqual(scores, expected) {
+		t.Fatalf("Static bucket score was not accurate: %+v != %+v", scores, expected)
+	}
+
+	if top := listener.TopHits("test"); len(top) != 1 || top[0].Bucket != "static" {
+		t.Fatalf("Static bucket wasn't in top hits: %+v", top)
+	}
+
+	// Static buckets aren't counted as dynamic bucket churn.
+	expectedTotals := &AggregateStats{Hits: 3, Misses: 1, Waits: 1, WaitMillis: 30}
+	if totals := listener.NamespaceStats("test"); !reflect.DeepEqual(totals, expectedTotals) {
+		t.Fatalf("Namespace totals were not accurate: %+v != %+v", totals, expectedTotals)
+	}
+}
@@ -6,6 +6,7 @@ package stats
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -23,11 +24,12 @@ type redisListener struct {
 	notifyBatcher    chan struct{}
 	batchSize        int
 	batchDeadline    time.Duration
+	opts             *options
 }
 
 // NewRedisStatsListener creates a stats listener backed
 // by a standalone Redis instance.
-func NewRedisStatsListener(redisOpts *redis.Options, statsBatchSize int, statsBatchDeadline time.Duration) Listener {
+func NewRedisStatsListener(redisOpts *redis.Options, statsBatchSize int, statsBatchDeadline time.Duration, opts ...Option) Listener {
 	client := redis.NewClient(redisOpts)
 	_, err := client.Ping(context.TODO()).Result()
 
@@ -43,6 +45,7 @@ func NewRedisStatsListener(redisOpts *redis.Options, statsBatchSize int, statsBa
 		statsUpdatesLock: &sync.Mutex{},
 		batchSize:        statsBatchSize,
 		batchDeadline:    statsBatchDeadline,
+		opts:             newOptions(opts),
 	}
 
 	go l.batcher()
@@ -52,7 +55,7 @@ func NewRedisStatsListener(redisOpts *redis.Options, statsBatchSize int, statsBa
 
 // NewRedisClusterStatsListener creates a stats listener backed
 // by a Redis cluster.
-func NewRedisClusterStatsListener(redisClusterOpts *redis.ClusterOptions, statsBatchSize int, statsBatchDeadline time.Duration) Listener {
+func NewRedisClusterStatsListener(redisClusterOpts *redis.ClusterOptions, statsBatchSize int, statsBatchDeadline time.Duration, opts ...Option) Listener {
 	client := redis.NewClusterClient(redisClusterOpts)
 	_, err := client.Ping(context.TODO()).Result()
 
@@ -68,6 +71,7 @@ func NewRedisClusterStatsListener(redisClusterOpts *redis.ClusterOptions, statsB
 		statsUpdatesLock: &sync.Mutex{},
 		batchSize:        statsBatchSize,
 		batchDeadline:    statsBatchDeadline,
+		opts:             newOptions(opts),
 	}
 
 	go l.batcher()
@@ -96,6 +100,10 @@ func statsNamespace(key, namespace string) string {
 	return fmt.Sprintf("stats:%s:%s", namespace, key)
 }
 
+// globalTotalsKey holds the totals of all namespaces. Keys of namespaces' stats have a namespace,
+// so they can't collide with it.
+const globalTotalsKey = "stats:totals"
+
 // TopHits is implemented for stats.Listener
 // TopHits returns a sorted list of the 10 buckets with the highest # of hits
 // in the specified namespace within the current bucketed hour
@@ -111,28 +119,62 @@ func (l *redisListener) TopMisses(namespace string) []*BucketScore {
 }
 
 // Get is implemented for stats.Listener
-// Get returns the hits and misses for a bucket in the specified namespace
+// Get returns the hits, misses and waits for a bucket in the specified namespace
 // within the current bucketed hour
 func (l *redisListener) Get(namespace, bucket string) *BucketScores {
-	scores := &BucketScores{0, 0}
+	return &BucketScores{
+		Hits:       l.redisScore(namespace, "hits", bucket),
+		Misses:     l.redisScore(namespace, "misses", bucket),
+		Waits:      l.redisScore(namespace, "waits", bucket),
+		WaitMillis: l.redisScore(namespace, "waitMillis", bucket)}
+}
 
-	value, err := l.client.ZScore(context.TODO(), statsNamespace("misses", namespace), bucket).Result()
+func (l *redisListener) redisScore(namespace, key, bucket string) int64 {
+	value, err := l.client.ZScore(context.TODO(), statsNamespace(key, namespace), bucket).Result()
 
 	if err != nil && err.Error() != "redis: nil" {
 		logging.Printf("RedisStatsListener.Get error (%s, %s) %v", namespace, bucket, err)
-	} else {
-		scores.Misses = int64(value)
+		return 0
 	}
 
-	value, err = l.client.ZScore(context.TODO(), statsNamespace("hits", namespace), bucket).Result()
+	return int64(value)
+}
+
+// NamespaceStats is implemented for stats.Listener
+// NamespaceStats returns the totals of the tracked buckets in the specified
+// namespace within the current bucketed hour
+func (l *redisListener) NamespaceStats(namespace string) *AggregateStats {
+	return l.redisTotals(statsNamespace("totals", namespace))
+}
+
+// GlobalStats is implemented for stats.Listener
+// GlobalStats returns the totals of the tracked buckets in all namespaces
+// within the current bucketed hour
+func (l *redisListener) GlobalStats() *AggregateStats {
+	return l.redisTotals(globalTotalsKey)
+}
+
+func (l *redisListener) redisTotals(key string) *AggregateStats {
+	totals := &AggregateStats{}
+
+	values, err := l.client.HGetAll(context.TODO(), key).Result()
 
 	if err != nil && err.Error() != "redis: nil" {
-		logging.Printf("RedisStatsListener.Get error (%s, %s) %v", namespace, bucket, err)
-	} else {
-		scores.Hits = int64(value)
+		logging.Printf("RedisStatsListener.Totals error (%s) %v", key, err)
+		return totals
 	}
 
-	return scores
+	for field, total := range map[string]*int64{
+		"hits":       &totals.Hits,
+		"misses":     &totals.Misses,
+		"waits":      &totals.Waits,
+		"waitMillis": &totals.WaitMillis,
+		"created":    &totals.Created,
+		"removed":    &totals.Removed} {
+		*total, _ = strconv.ParseInt(values[field], 10, 64)
+	}
+
+	return totals
 }
 
 func nearestHour() time.Time {
@@ -140,9 +182,10 @@ func nearestHour() time.Time {
 }
 
 // HandleEvent is implemented for stats.Listener
-// HandleEvent consumes dynamic bucket events (see events.Event)
+// HandleEvent consumes dynamic bucket events, and static bucket events with
+// WithStaticBuckets (see events.Event)
 func (l *redisListener) HandleEvent(event events.Event) {
-	if !event.Dynamic() {
+	if !l.opts.tracks(event) {
 		return
 	}
 
@@ -155,22 +198,44 @@ func (l *redisListener) HandleEvent(event events.Event) {
 	case events.EVENT_TOKENS_SERVED:
 		numTokens = event.NumTokens()
 		key = "hits"
+
+		if wait := event.WaitTime(); wait > 0 {
+			l.queueStatsUpdate(event.Namespace(), "waits", 1, event.BucketName())
+			l.queueStatsUpdate(event.Namespace(), "waitMillis", int64(wait/time.Millisecond), event.BucketName())
+		}
+	case events.EVENT_BUCKET_CREATED:
+		if !event.Dynamic() {
+			return
+		}
+
+		key = "created"
+	case events.EVENT_BUCKET_REMOVED:
+		if !event.Dynamic() {
+			return
+		}
+
+		key = "removed"
 	default:
 		return
 	}
 
-	namespace := statsNamespace(key, event.Namespace())
-	bucket := event.BucketName()
-
-	l.queueStatsUpdate(namespace, numTokens, bucket)
+	l.queueStatsUpdate(event.Namespace(), key, numTokens, event.BucketName())
 }
 
 // queueStatsUpdate queues a statsUpdate to be sent to redis via the batcher
-func (l *redisListener) queueStatsUpdate(namespace string, numTokens int64, bucket string) {
+func (l *redisListener) queueStatsUpdate(namespace, key string, numTokens int64, bucket string) {
 	l.statsUpdatesLock.Lock()
 
-	l.pipe.ZIncrBy(context.TODO(), namespace, float64(numTokens), bucket)
-	l.pipe.ExpireAt(context.TODO(), namespace, nearestHour())
+	if key != "created" && key != "removed" {
+		scores := statsNamespace(key, namespace)
+		l.pipe.ZIncrBy(context.TODO(), scores, float64(numTokens), bucket)
+		l.pipe.ExpireAt(context.TODO(), scores, nearestHour())
+	}
+
+	for _, totals := range []string{statsNamespace("totals", namespace), globalTotalsKey} {
+		l.pipe.HIncrBy(context.TODO(), totals, key, numTokens)
+		l.pipe.ExpireAt(context.TODO(), totals, nearestHour())
+	}
 
 	l.queuedUpdates++
 
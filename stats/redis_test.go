@@ -224,3 +224,40 @@ func TestRedisBatching(t *testing.T) {
 
 	teardown(listener)
 }
+
+func TestRedisAggregateStats(t *testing.T) {
+	listener := setUp()
+
+	namespace = randomNamespace()
+	listener.HandleEvent(events.NewBucketCreatedEvent(namespace, "a", true))
+	listener.HandleEvent(events.NewTokensServedEvent(namespace, "a", true, 3, 0))
+	listener.HandleEvent(events.NewBucketMissedEvent(namespace, "b", true))
+	listener.HandleEvent(events.NewBucketRemovedEvent(namespace, "a", true))
+	time.Sleep(waitForBatchSubmit)
+
+	expected := &AggregateStats{Hits: 3, Misses: 1, Created: 1, Removed: 1}
+	if totals := listener.NamespaceStats(namespace); !reflect.DeepEqual(totals, expected) {
+		t.Fatalf("Namespace totals were not accurate: %+v != %+v", totals, expected)
+	}
+
+	if totals := listener.GlobalStats(); totals.Hits < 3 || totals.Created < 1 {
+		t.Fatalf("Global totals didn't include the namespace's: %+v", totals)
+	}
+
+	teardown(listener)
+}
+
+func TestRedisStaticBuckets(t *testing.T) {
+	listener := NewRedisStatsListener(&redis.Options{Addr: "localhost:6379"}, 128, batchSubmitInterval, WithStaticBuckets())
+
+	namespace = randomNamespace()
+	listener.HandleEvent(events.NewTokensServedEvent(namespace, "static", false, 2, 30*time.Millisecond))
+	time.Sleep(waitForBatchSubmit)
+
+	expected := &BucketScores{Hits: 2, Waits: 1, WaitMillis: 30}
+	if scores := listener.Get(namespace, "static"); !reflect.DeepEqual(scores, expected) {
+		t.Fatalf("Static bucket score was not accurate: %+v != %+v", scores, expected)
+	}
+
+	teardown(listener)
+}
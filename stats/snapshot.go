@@ -0,0 +1,108 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package stats
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Snapshot is a point-in-time copy of a Listener's stats, keyed on namespace.
+type Snapshot map[string]*NamespaceSnapshot
+
+// NamespaceSnapshot stores the hits, misses and waits
+// of each tracked bucket in a namespace
+type NamespaceSnapshot struct {
+	Hits       map[string]int64 `json:"hits"`
+	Misses     map[string]int64 `json:"misses"`
+	Waits      map[string]int64 `json:"waits,omitempty"`
+	WaitMillis map[string]int64 `json:"waitMillis,omitempty"`
+	// Created and Removed count the namespace's dynamic bucket churn.
+	Created int64 `json:"created,omitempty"`
+	Removed int64 `json:"removed,omitempty"`
+}
+
+// Snapshotter is implemented by Listeners that hold their stats in memory, so that they can be
+// saved to a SnapshotStore and reloaded after a restart.
+type Snapshotter interface {
+	Snapshot() Snapshot
+	Restore(Snapshot)
+}
+
+// SnapshotStore persists Snapshots.
+type SnapshotStore interface {
+	SaveSnapshot(Snapshot) error
+	// LoadSnapshot returns the most recently saved Snapshot, or nil if none has been saved.
+	LoadSnapshot() (Snapshot, error)
+}
+
+type fileSnapshotStore struct {
+	path string
+}
+
+// NewFileSnapshotStore creates a SnapshotStore that saves snapshots as JSON to a file on the local
+// filesystem.
+func NewFileSnapshotStore(path string) SnapshotStore {
+	return &fileSnapshotStore{path}
+}
+
+func (f *fileSnapshotStore) SaveSnapshot(snapshot Snapshot) error {
+	b, e := json.Marshal(snapshot)
+	if e != nil {
+		return e
+	}
+
+	// Written to a temporary file first, so a crash mid-write doesn't corrupt the last snapshot.
+	tmp := f.path + ".tmp"
+	if e := os.WriteFile(tmp, b, 0644); e != nil {
+		return e
+	}
+
+	return os.Rename(tmp, f.path)
+}
+
+func (f *fileSnapshotStore) LoadSnapshot() (Snapshot, error) {
+	b, e := os.ReadFile(f.path)
+	if os.IsNotExist(e) {
+		return nil, nil
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	snapshot := make(Snapshot)
+	if e := json.Unmarshal(b, &snapshot); e != nil {
+		return nil, e
+	}
+
+	return snapshot, nil
+}
+
+type memorySnapshotStore struct {
+	snapshot Snapshot
+	sync.Mutex
+}
+
+// NewMemorySnapshotStore creates a SnapshotStore that holds the last snapshot in memory. Useful
+// for testing.
+func NewMemorySnapshotStore() SnapshotStore {
+	return &memorySnapshotStore{}
+}
+
+func (m *memorySnapshotStore) SaveSnapshot(snapshot Snapshot) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.snapshot = snapshot
+	return nil
+}
+
+func (m *memorySnapshotStore) LoadSnapshot() (Snapshot, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.snapshot, nil
+}
@@ -0,0 +1,68 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestMemorySnapshotRestore(t *testing.T) {
+	l := NewMemoryStatsListener()
+	l.HandleEvent(events.NewTokensServedEvent("test", "dyn", true, 5, 20*time.Millisecond))
+	l.HandleEvent(events.NewBucketMissedEvent("test", "missing", true))
+
+	snapshot := l.(Snapshotter).Snapshot()
+	expected := Snapshot{"test": {
+		Hits:       map[string]int64{"dyn": 5},
+		Misses:     map[string]int64{"missing": 1},
+		Waits:      map[string]int64{"dyn": 1},
+		WaitMillis: map[string]int64{"dyn": 20}}}
+
+	if !reflect.DeepEqual(snapshot, expected) {
+		t.Fatalf("Expected snapshot %+v, got %+v", expected, snapshot)
+	}
+
+	restored := NewMemoryStatsListener()
+	restored.HandleEvent(events.NewTokensServedEvent("test", "dyn", true, 1, 0))
+	restored.(Snapshotter).Restore(snapshot)
+
+	if scores := restored.Get("test", "dyn"); scores.Hits != 6 || scores.WaitMillis != 20 {
+		t.Fatalf("Expected restored hits to be added to existing hits, got %+v", scores)
+	}
+
+	if top := restored.TopMisses("test"); len(top) != 1 || top[0].Bucket != "missing" || top[0].Score != 1 {
+		t.Fatalf("Expected restored misses, got %+v", top)
+	}
+}
+
+func TestFileSnapshotStore(t *testing.T) {
+	dir, e := os.MkdirTemp("", "qs_stats_snapshot")
+	helpers.CheckError(t, e)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store := NewFileSnapshotStore(filepath.Join(dir, "stats.json"))
+	snapshot, e := store.LoadSnapshot()
+	helpers.CheckError(t, e)
+	if snapshot != nil {
+		t.Fatalf("Expected no snapshot, got %+v", snapshot)
+	}
+
+	expected := Snapshot{"test": {
+		Hits:   map[string]int64{"dyn": 5},
+		Misses: map[string]int64{}}}
+	helpers.CheckError(t, store.SaveSnapshot(expected))
+
+	snapshot, e = store.LoadSnapshot()
+	helpers.CheckError(t, e)
+	if !reflect.DeepEqual(snapshot, expected) {
+		t.Fatalf("Expected snapshot %+v, got %+v", expected, snapshot)
+	}
+}
@@ -10,19 +10,84 @@ import (
 )
 
 // Listener is an interface for consuming
-// and retrieving dynamic bucket hits and misses
+// and retrieving dynamic bucket hits and misses,
+// and those of static buckets with WithStaticBuckets
 type Listener interface {
 	TopHits(string) []*BucketScore
 	TopMisses(string) []*BucketScore
 	Get(string, string) *BucketScores
+	// NamespaceStats returns the totals of a namespace's tracked buckets.
+	NamespaceStats(string) *AggregateStats
+	// GlobalStats returns the totals of the tracked buckets of all namespaces.
+	GlobalStats() *AggregateStats
 	HandleEvent(events.Event)
 }
 
+// Option configures a Listener when it is constructed.
+type Option func(o *options)
+
+type options struct {
+	staticBuckets bool
+}
+
+// WithStaticBuckets tracks the stats of statically configured buckets, as well as those of
+// dynamic buckets. Static buckets usually serve most requests, so this adds work to every request
+// a Listener handles, and is off by default.
+func WithStaticBuckets() Option {
+	return func(o *options) {
+		o.staticBuckets = true
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// tracks reports whether the stats of an event's bucket are tracked.
+func (o *options) tracks(event events.Event) bool {
+	return event.Dynamic() || o.staticBuckets
+}
+
+// AggregateStats stores the totals of the tracked buckets
+// of a namespace, or of the whole service
+type AggregateStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Waits counts the requests that waited for tokens, and WaitMillis the time they waited.
+	Waits      int64 `json:"waits"`
+	WaitMillis int64 `json:"waitMillis"`
+	// Created and Removed count the dynamic buckets created and removed, i.e. their churn.
+	Created int64 `json:"created"`
+	Removed int64 `json:"removed"`
+	// ActiveBuckets is the number of buckets that exist on the server reporting the stats. It is
+	// filled in by the server, rather than by Listeners.
+	ActiveBuckets int64 `json:"activeBuckets"`
+}
+
+// add adds other's totals to a's.
+func (a *AggregateStats) add(other *AggregateStats) {
+	a.Hits += other.Hits
+	a.Misses += other.Misses
+	a.Waits += other.Waits
+	a.WaitMillis += other.WaitMillis
+	a.Created += other.Created
+	a.Removed += other.Removed
+	a.ActiveBuckets += other.ActiveBuckets
+}
+
 // BucketScores stores a specific bucket's
-// stats on hits and misses
+// stats on hits, misses and waits
 type BucketScores struct {
 	Hits   int64 `json:"hits"`
 	Misses int64 `json:"misses"`
+	// Waits counts the requests that waited for tokens, and WaitMillis the time they waited.
+	Waits      int64 `json:"waits"`
+	WaitMillis int64 `json:"waitMillis"`
 }
 
 // BucketScore stores a specific bucket's
@@ -37,7 +102,7 @@ var emptyBucketScores *BucketScores
 
 func init() {
 	emptyArr = make([]*BucketScore, 0)
-	emptyBucketScores = &BucketScores{0, 0}
+	emptyBucketScores = &BucketScores{}
 }
 
 func (b *BucketScore) String() string {
@@ -0,0 +1,189 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package integration
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+
+	"github.com/square/quotaservice"
+	qsredis "github.com/square/quotaservice/buckets/redis"
+	"github.com/square/quotaservice/client"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	pb "github.com/square/quotaservice/protos"
+	qsgrpc "github.com/square/quotaservice/rpc/grpc"
+	"github.com/square/quotaservice/test/helpers"
+	qstesting "github.com/square/quotaservice/testing"
+)
+
+const (
+	namespace = "integration"
+	bucket    = "bucket"
+	// bucketSize is the bucket's capacity, which fills at 1 token a second.
+	bucketSize = 1000
+)
+
+var testRedis *Redis
+
+func TestMain(m *testing.M) {
+	r, err := StartRedis()
+	if err != nil {
+		fmt.Printf("Skipping integration tests: %v\n", err)
+	}
+	testRedis = r
+
+	code := m.Run()
+	if r != nil {
+		r.Stop()
+	}
+
+	os.Exit(code)
+}
+
+// startServer starts a server with the Redis backend and empty buckets, returning a client for it
+// and a function that stops both.
+func startServer(t *testing.T) (*client.Client, func()) {
+	if testRedis == nil {
+		t.Skip("Redis unavailable")
+	}
+
+	helpers.CheckError(t, testRedis.FlushAll())
+
+	cfg := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig(namespace)
+	b := config.NewDefaultBucketConfig(bucket)
+	b.Size = proto.Int64(bucketSize)
+	b.FillRate = proto.Int64(1)
+	b.MaxTokensPerRequest = proto.Int64(bucketSize)
+	b.MaxDebtMillis = proto.Int64(0)
+	helpers.PanicError(config.AddBucket(ns, b))
+	helpers.PanicError(config.AddNamespace(cfg, ns))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	helpers.CheckError(t, err)
+	addr := l.Addr().String()
+	helpers.CheckError(t, l.Close())
+
+	server := quotaservice.New(qsredis.NewBucketFactory(&redis.Options{Addr: testRedis.Addr}, 2, 0),
+		config.NewMemoryConfig(cfg),
+		qstesting.NewReaperConfig(),
+		0,
+		qsgrpc.New(addr, events.NewNilProducer()))
+	_, err = server.Start()
+	helpers.CheckError(t, err)
+
+	c, err := client.New(addr, grpc.WithInsecure())
+	helpers.CheckError(t, err)
+
+	return c, func() {
+		_ = c.Close()
+		_, _ = server.Stop()
+	}
+}
+
+func allow(c *client.Client, tokens int64) (pb.AllowResponse_Status, error) {
+	rsp, err := c.Allow(&pb.AllowRequest{
+		Namespace:           namespace,
+		BucketName:          bucket,
+		TokensRequested:     tokens,
+		MaxWaitTimeOverride: true})
+	if err != nil {
+		return 0, err
+	}
+
+	return rsp.Status, nil
+}
+
+// TestTokenAccounting checks that concurrent requests are granted no more tokens than the bucket
+// holds, and no fewer.
+func TestTokenAccounting(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+
+	const workers = 50
+	const requestsPerWorker = 2 * bucketSize / workers
+
+	var granted, errs int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requestsPerWorker; j++ {
+				s, err := allow(c, 1)
+				switch {
+				case err != nil:
+					atomic.AddInt64(&errs, 1)
+				case s == pb.AllowResponse_OK:
+					atomic.AddInt64(&granted, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if errs > 0 {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+
+	// The bucket fills at 1 token a second while requests are served.
+	refilled := int64(time.Since(start)/time.Second) + 1
+	if granted < bucketSize || granted > bucketSize+refilled {
+		t.Fatalf("Expected %v to %v tokens to be granted, got %v", bucketSize, bucketSize+refilled, granted)
+	}
+}
+
+// TestFailover checks that the server recovers from Redis being unavailable, keeping the tokens
+// taken before the outage.
+func TestFailover(t *testing.T) {
+	if testRedis != nil && !testRedis.CanInterrupt() {
+		t.Skip("Redis wasn't started in Docker, so can't be interrupted")
+	}
+
+	c, stop := startServer(t)
+	defer stop()
+
+	if s, err := allow(c, bucketSize/2); err != nil || s != pb.AllowResponse_OK {
+		t.Fatalf("Expected tokens to be granted, got %v, %v", s, err)
+	}
+
+	// Requests made during the outage mustn't fail at the RPC level.
+	outage := make(chan error)
+	go func() { outage <- testRedis.Interrupt(5 * time.Second) }()
+	time.Sleep(time.Second)
+	if _, err := allow(c, 1); err != nil {
+		t.Fatalf("Expected requests during the outage to get a response, got %v", err)
+	}
+	helpers.CheckError(t, <-outage)
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		s, err := allow(c, 1)
+		helpers.CheckError(t, err)
+		if s == pb.AllowResponse_OK {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the server to recover once Redis did, got %v", s)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Tokens taken before the outage are still taken.
+	if s, err := allow(c, bucketSize); err != nil || s == pb.AllowResponse_OK {
+		t.Fatalf("Expected tokens taken before the outage to be accounted for, got %v, %v", s, err)
+	}
+}
@@ -0,0 +1,139 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package integration runs the full quota server against a real Redis, under concurrent load, to
+// validate bucket backends beyond unit tests. Redis is started in Docker if it's available.
+// Otherwise, the Redis at $QS_REDIS_ADDR, or localhost:6379, is used, and tests that need to
+// interrupt Redis are skipped. If no Redis is reachable, all tests are skipped.
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	dockertest "github.com/ory/dockertest/v3"
+)
+
+// redisStartTimeout bounds how long Redis takes to accept connections once started.
+const redisStartTimeout = 30 * time.Second
+
+// ErrNoRedis is returned by StartRedis if Redis can't be started or reached.
+var ErrNoRedis = errors.New("no Redis available; install Docker or set QS_REDIS_ADDR")
+
+// Redis is a Redis server used by integration tests.
+type Redis struct {
+	Addr string
+	// pool and resource are set if Redis was started in Docker, so outages can be simulated.
+	pool     *dockertest.Pool
+	resource *dockertest.Resource
+}
+
+// StartRedis starts Redis in Docker, falling back to an existing Redis at $QS_REDIS_ADDR or
+// localhost:6379.
+func StartRedis() (*Redis, error) {
+	if addr := os.Getenv("QS_REDIS_ADDR"); addr != "" {
+		return existingRedis(addr)
+	}
+
+	if r, err := startContainer(); err == nil {
+		return r, nil
+	}
+
+	return existingRedis("localhost:6379")
+}
+
+func existingRedis(addr string) (*Redis, error) {
+	r := &Redis{Addr: addr}
+	if err := r.ping(time.Second); err != nil {
+		return nil, ErrNoRedis
+	}
+
+	return r, nil
+}
+
+func startContainer() (*Redis, error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := pool.Run("redis", "6", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Redis{
+		Addr:     net.JoinHostPort("localhost", resource.GetPort("6379/tcp")),
+		pool:     pool,
+		resource: resource}
+	if err := r.ping(redisStartTimeout); err != nil {
+		r.Stop()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// CanInterrupt returns whether Interrupt is supported, i.e. if Redis was started in Docker.
+func (r *Redis) CanInterrupt() bool {
+	return r.resource != nil
+}
+
+// Interrupt makes Redis unresponsive for down, by pausing its container, then waits until it
+// accepts connections again. Its data is kept.
+func (r *Redis) Interrupt(down time.Duration) error {
+	if !r.CanInterrupt() {
+		return errors.New("Redis wasn't started in Docker")
+	}
+
+	id := r.resource.Container.ID
+	if err := r.pool.Client.PauseContainer(id); err != nil {
+		return err
+	}
+
+	time.Sleep(down)
+	if err := r.pool.Client.UnpauseContainer(id); err != nil {
+		return err
+	}
+
+	return r.ping(redisStartTimeout)
+}
+
+// FlushAll deletes all keys, so that tests start with full buckets.
+func (r *Redis) FlushAll() error {
+	client := redis.NewClient(&redis.Options{Addr: r.Addr})
+	defer func() { _ = client.Close() }()
+
+	return client.FlushAll(context.Background()).Err()
+}
+
+// Stop stops Redis if it was started in Docker.
+func (r *Redis) Stop() {
+	if r.CanInterrupt() {
+		_ = r.pool.Purge(r.resource)
+	}
+}
+
+func (r *Redis) ping(timeout time.Duration) error {
+	client := redis.NewClient(&redis.Options{Addr: r.Addr, MaxRetries: -1})
+	defer func() { _ = client.Close() }()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := client.Ping(context.Background()).Err()
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Redis at %v not reachable: %v", r.Addr, err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
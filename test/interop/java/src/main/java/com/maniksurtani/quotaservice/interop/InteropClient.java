@@ -0,0 +1,53 @@
+package com.maniksurtani.quotaservice.interop;
+
+import com.maniksurtani.quotaservice.proto.AllowRequest;
+import com.maniksurtani.quotaservice.proto.AllowResponse;
+import com.maniksurtani.quotaservice.proto.ChargeRequest;
+import com.maniksurtani.quotaservice.proto.ChargeResponse;
+import com.maniksurtani.quotaservice.proto.QuotaServiceGrpc;
+import io.grpc.ManagedChannel;
+import io.grpc.ManagedChannelBuilder;
+import java.util.concurrent.TimeUnit;
+
+/** Checks the quota service's responses to the Java client. See ../README.md. */
+public final class InteropClient {
+  private static boolean failed;
+
+  private static void check(String name, Object expected, Object actual) {
+    if (!expected.equals(actual)) {
+      System.out.printf("%s: expected status %s, got %s%n", name, expected, actual);
+      failed = true;
+    }
+  }
+
+  private static AllowRequest allow(String namespace, String bucket, long tokens) {
+    return AllowRequest.newBuilder()
+        .setNamespace(namespace)
+        .setBucketName(bucket)
+        .setTokensRequested(tokens)
+        .build();
+  }
+
+  public static void main(String[] args) throws InterruptedException {
+    String target = System.getenv().getOrDefault("QS_TARGET", "localhost:10990");
+    ManagedChannel channel = ManagedChannelBuilder.forTarget(target).usePlaintext().build();
+    QuotaServiceGrpc.QuotaServiceBlockingStub stub = QuotaServiceGrpc.newBlockingStub(channel)
+        .withWaitForReady()
+        .withDeadlineAfter(30, TimeUnit.SECONDS);
+
+    check("allow", AllowResponse.Status.OK, stub.allow(allow("interop", "fixed", 1)).getStatus());
+    check("allow too many tokens", AllowResponse.Status.REJECTED_TOO_MANY_TOKENS_REQUESTED,
+        stub.allow(allow("interop", "fixed", 11)).getStatus());
+    check("allow missing bucket", AllowResponse.Status.REJECTED_NO_BUCKET,
+        stub.allow(allow("missing", "missing", 1)).getStatus());
+    check("charge", ChargeResponse.Status.OK, stub.charge(ChargeRequest.newBuilder()
+        .setNamespace("interop")
+        .setBucketName("fixed")
+        .setTokensReserved(1)
+        .setActualCost(2)
+        .build()).getStatus());
+
+    channel.shutdown().awaitTermination(5, TimeUnit.SECONDS);
+    System.exit(failed ? 1 : 0);
+  }
+}
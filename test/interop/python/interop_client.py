@@ -0,0 +1,39 @@
+"""Checks the quota service's responses to the Python client. See ../README.md."""
+
+import os
+import sys
+
+import grpc
+
+import quota_service_pb2 as pb
+import quota_service_pb2_grpc as pb_grpc
+
+
+def main():
+    channel = grpc.insecure_channel(os.environ.get("QS_TARGET", "localhost:10990"))
+    grpc.channel_ready_future(channel).result(timeout=30)
+    stub = pb_grpc.QuotaServiceStub(channel)
+
+    checks = [
+        ("allow", pb.AllowResponse.OK,
+         stub.Allow(pb.AllowRequest(namespace="interop", bucket_name="fixed", tokens_requested=1)).status),
+        ("allow too many tokens", pb.AllowResponse.REJECTED_TOO_MANY_TOKENS_REQUESTED,
+         stub.Allow(pb.AllowRequest(namespace="interop", bucket_name="fixed", tokens_requested=11)).status),
+        ("allow missing bucket", pb.AllowResponse.REJECTED_NO_BUCKET,
+         stub.Allow(pb.AllowRequest(namespace="missing", bucket_name="missing", tokens_requested=1)).status),
+        ("charge", pb.ChargeResponse.OK,
+         stub.Charge(pb.ChargeRequest(namespace="interop", bucket_name="fixed", tokens_reserved=1,
+                                      actual_cost=2)).status),
+    ]
+
+    failed = False
+    for name, expected, actual in checks:
+        if expected != actual:
+            print("%s: expected status %d, got %d" % (name, expected, actual))
+            failed = True
+
+    sys.exit(1 if failed else 0)
+
+
+if __name__ == "__main__":
+    main()
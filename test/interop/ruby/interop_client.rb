@@ -0,0 +1,38 @@
+# Checks the quota service's responses to the Ruby client. See ../README.md.
+
+require 'grpc'
+require 'quota_service_services_pb'
+
+stub = QuotaService::QuotaService::Stub.new(ENV.fetch('QS_TARGET', 'localhost:10990'), :this_channel_is_insecure)
+deadline = Time.now + 30
+
+call = lambda do |method, request|
+  begin
+    stub.public_send(method, request, deadline: Time.now + 5)
+  rescue GRPC::Unavailable
+    raise if Time.now > deadline
+    sleep 1
+    retry
+  end
+end
+
+checks = [
+  ['allow', :OK,
+   call.(:allow, QuotaService::AllowRequest.new(namespace: 'interop', bucket_name: 'fixed', tokens_requested: 1)).status],
+  ['allow too many tokens', :REJECTED_TOO_MANY_TOKENS_REQUESTED,
+   call.(:allow, QuotaService::AllowRequest.new(namespace: 'interop', bucket_name: 'fixed', tokens_requested: 11)).status],
+  ['allow missing bucket', :REJECTED_NO_BUCKET,
+   call.(:allow, QuotaService::AllowRequest.new(namespace: 'missing', bucket_name: 'missing', tokens_requested: 1)).status],
+  ['charge', :OK,
+   call.(:charge, QuotaService::ChargeRequest.new(namespace: 'interop', bucket_name: 'fixed', tokens_reserved: 1,
+                                                   actual_cost: 2)).status]
+]
+
+failed = false
+checks.each do |name, expected, actual|
+  next if expected == actual
+  puts "#{name}: expected status #{expected}, got #{actual}"
+  failed = true
+end
+
+exit(failed ? 1 : 0)
@@ -0,0 +1,17 @@
+#!/bin/bash
+# Runs each non-Go client against a freshly started server, failing if any client gets an
+# unexpected response. Requires Docker Compose.
+
+set -e
+
+cd "$(dirname "$0")"
+compose="docker-compose -p quotaservice-interop"
+
+trap '$compose down --volumes' EXIT
+$compose build
+$compose up -d server
+
+for client in python ruby java; do
+  echo "Running $client interop client"
+  $compose run --rm "$client"
+done
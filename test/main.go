@@ -10,27 +10,24 @@ import (
 	"sync"
 	"syscall"
 
-	"github.com/square/quotaservice"
-	"github.com/square/quotaservice/buckets/memory"
+	"github.com/golang/protobuf/proto"
 	"github.com/square/quotaservice/config"
-	"github.com/square/quotaservice/events"
 	"github.com/square/quotaservice/logging"
-	"github.com/square/quotaservice/rpc/grpc"
-	"github.com/square/quotaservice/stats"
+	"github.com/square/quotaservice/serverconfig"
 	"github.com/square/quotaservice/test/helpers"
 )
 
-const (
-	adminServer = "localhost:8080"
-	gRPCServer  = "localhost:10990"
-)
-
+// Settings are read from flags, QS_ environment variables or a YAML file; see package serverconfig.
 func main() {
+	settings, err := serverconfig.Load(os.Args[1:], os.LookupEnv)
+	helpers.PanicError(err)
+
+	// Used by the memory persister, unless a service config file is given.
 	cfg := config.NewDefaultServiceConfig()
 	ns := config.NewDefaultNamespaceConfig("test.namespace")
 	ns.DynamicBucketTemplate = config.NewDefaultBucketConfig(config.DynamicBucketTemplateName)
-	ns.DynamicBucketTemplate.Size = 100000000000
-	ns.DynamicBucketTemplate.FillRate = 100000000
+	ns.DynamicBucketTemplate.Size = proto.Int64(100000000000)
+	ns.DynamicBucketTemplate.FillRate = proto.Int64(100000000)
 	b := config.NewDefaultBucketConfig("xyz")
 	helpers.PanicError(config.AddBucket(ns, b))
 	helpers.PanicError(config.AddNamespace(cfg, ns))
@@ -41,21 +38,19 @@ func main() {
 	helpers.PanicError(config.AddBucket(ns, b))
 	helpers.PanicError(config.AddNamespace(cfg, ns))
 
-	server := quotaservice.New(memory.NewBucketFactory(),
-		config.NewMemoryConfig(cfg),
-		config.NewReaperConfig(),
-		0,
-		grpc.New(gRPCServer, events.NewNilProducer()))
-	server.SetStatsListener(stats.NewMemoryStatsListener())
+	server, err := settings.NewServer(cfg)
+	helpers.PanicError(err)
 	if _, e := server.Start(); e != nil {
 		panic(e)
 	}
 
 	// Serve Admin Console
-	logging.Printf("Starting admin server on %v\n", adminServer)
-	sm := http.NewServeMux()
-	server.ServeAdminConsole(sm, "admin/public", true)
-	go func() { _ = http.ListenAndServe(adminServer, sm) }()
+	if settings.AdminAddress != "" {
+		logging.Printf("Starting admin server on %v\n", settings.AdminAddress)
+		sm := http.NewServeMux()
+		server.ServeAdminConsole(sm, settings.AdminAssets, true)
+		go func() { _ = http.ListenAndServe(settings.AdminAddress, sm) }()
+	}
 
 	// Block until SIGTERM or SIGINT
 	sigs := make(chan os.Signal, 1)
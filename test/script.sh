@@ -12,6 +12,9 @@ case "$TEST" in
     npm run clean-dist
     npm run test
     ;;
+  "INTEROP")
+    test/interop/run.sh
+    ;;
   *)
     go vet $(go list ./... | grep -v /vendor/)
     go test -race -v -covermode atomic ./...
@@ -0,0 +1,338 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package testing provides test doubles for code integrating with the quota service: a bucket
+// factory whose buckets are scripted to grant, deny or fail Takes, and an endpoint that hands
+// tests the QuotaService a server was started with.
+package testing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+// ErrSimulatedFailure is returned by calls to buckets that are set to fail without an error of
+// their own, e.g. by MockBucketFactory.SimulateFailure.
+var ErrSimulatedFailure = errors.New("mock bucket had an error!")
+
+// Behavior scripts the outcome of a single Take on a mock bucket.
+type Behavior struct {
+	// WaitTime is the wait granted, if it is within the Take's max wait time. Otherwise the Take is
+	// denied.
+	WaitTime time.Duration
+	// Err, if set, fails the Take.
+	Err error
+}
+
+// Wait scripts a Take that is granted after d, or denied if d exceeds its max wait time.
+func Wait(d time.Duration) Behavior {
+	return Behavior{WaitTime: d}
+}
+
+// Fail scripts a Take that fails with err.
+func Fail(err error) Behavior {
+	return Behavior{Err: err}
+}
+
+// behavior is how a bucket answers calls. It is kept by the factory, so that it can be set before a
+// bucket is created, and outlives buckets recreated when configs change.
+type behavior struct {
+	sync.Mutex
+	waitTime time.Duration
+	err      error
+	script   []Behavior
+}
+
+// next returns the outcome of the next Take: the next scripted behavior, if any, or else the
+// bucket's wait time and error.
+func (b *behavior) next() Behavior {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.script) > 0 {
+		next := b.script[0]
+		b.script = b.script[1:]
+		return next
+	}
+
+	return Behavior{b.waitTime, b.err}
+}
+
+func (b *behavior) failure() error {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.err
+}
+
+var _ quotaservice.Bucket = (*MockBucket)(nil)
+var _ quotaservice.TokenInspector = (*MockBucket)(nil)
+var _ quotaservice.DebtForgiver = (*MockBucket)(nil)
+var _ quotaservice.BucketResetter = (*MockBucket)(nil)
+var _ quotaservice.BucketWarmer = (*MockBucket)(nil)
+
+// MockBucket is a bucket created by MockBucketFactory. It grants every Take whose max wait time
+// covers its wait time, without running out of tokens, unless scripted otherwise.
+type MockBucket struct {
+	sync.RWMutex
+	quotaservice.DefaultBucket
+	namespace, bucketName string
+	dyn                   bool
+	cfg                   *pbconfig.BucketConfig
+	behavior              *behavior
+	// Taken is the number of tokens granted by Take.
+	Taken int64
+	// Charged is the net number of tokens charged to this bucket with Charge.
+	Charged int64
+	// Warmed is the number of times this bucket was warmed with Warm.
+	Warmed int
+}
+
+func (b *MockBucket) Take(_ context.Context, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	next := b.behavior.next()
+	if next.Err != nil {
+		return 0, false, next.Err
+	}
+
+	if next.WaitTime > maxWaitTime {
+		return 0, false, nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.Taken += numTokens
+	return next.WaitTime, true, nil
+}
+
+func (b *MockBucket) Charge(_ context.Context, numTokens int64) error {
+	if err := b.behavior.failure(); err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	b.Charged += numTokens
+	return nil
+}
+
+func (b *MockBucket) Tokens(_ context.Context) (int64, error) {
+	if err := b.behavior.failure(); err != nil {
+		return 0, err
+	}
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.cfg.GetSize() - b.Charged, nil
+}
+
+func (b *MockBucket) ForgiveDebt(_ context.Context) error {
+	if err := b.behavior.failure(); err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	if b.Charged > b.cfg.GetSize() {
+		b.Charged = b.cfg.GetSize()
+	}
+	return nil
+}
+
+func (b *MockBucket) Reset(_ context.Context) error {
+	if err := b.behavior.failure(); err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	b.Charged = 0
+	return nil
+}
+
+func (b *MockBucket) Warm(_ context.Context) error {
+	if err := b.behavior.failure(); err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	b.Warmed++
+	return nil
+}
+
+func (b *MockBucket) Config() *pbconfig.BucketConfig {
+	return b.cfg
+}
+
+func (b *MockBucket) Dynamic() bool {
+	return b.dyn
+}
+
+// MockBucketFactory is a quotaservice.BucketFactory creating MockBuckets. The zero value is ready
+// to use. Buckets' behavior is set by bucket name, and may be set before buckets are created.
+type MockBucketFactory struct {
+	sync.Mutex
+	buckets   map[string]*MockBucket
+	behaviors map[string]*behavior
+	// SimulateFailure fails every call to buckets created while it is set with ErrSimulatedFailure.
+	SimulateFailure bool
+}
+
+// SetWaitTime sets the wait a bucket grants Takes, unless scripted otherwise. Takes whose max wait
+// time is shorter are denied.
+func (bf *MockBucketFactory) SetWaitTime(namespace, name string, d time.Duration) {
+	b := bf.behavior(namespace, name)
+	b.Lock()
+	defer b.Unlock()
+
+	b.waitTime = d
+}
+
+// SetError fails every call to a bucket with err, unless its Takes are scripted otherwise. A nil
+// err stops the bucket failing.
+func (bf *MockBucketFactory) SetError(namespace, name string, err error) {
+	b := bf.behavior(namespace, name)
+	b.Lock()
+	defer b.Unlock()
+
+	b.err = err
+}
+
+// Script queues the outcomes of a bucket's next Takes, after which it answers Takes as set by
+// SetWaitTime and SetError again.
+func (bf *MockBucketFactory) Script(namespace, name string, behaviors ...Behavior) {
+	b := bf.behavior(namespace, name)
+	b.Lock()
+	defer b.Unlock()
+
+	b.script = append(b.script, behaviors...)
+}
+
+// Taken returns the tokens granted by the current instance of a bucket, which must exist.
+func (bf *MockBucketFactory) Taken(namespace, name string) int64 {
+	bucket := bf.Bucket(namespace, name)
+	bucket.RLock()
+	defer bucket.RUnlock()
+
+	return bucket.Taken
+}
+
+// Charged returns the net tokens charged to the current instance of a bucket, which must exist.
+func (bf *MockBucketFactory) Charged(namespace, name string) int64 {
+	bucket := bf.Bucket(namespace, name)
+	bucket.RLock()
+	defer bucket.RUnlock()
+
+	return bucket.Charged
+}
+
+// Warmed returns the number of times the current instance of a bucket, which must exist, was
+// warmed.
+func (bf *MockBucketFactory) Warmed(namespace, name string) int {
+	bucket := bf.Bucket(namespace, name)
+	bucket.RLock()
+	defer bucket.RUnlock()
+
+	return bucket.Warmed
+}
+
+// Bucket returns the most recently created instance of a bucket, panicking if there is none.
+func (bf *MockBucketFactory) Bucket(namespace, name string) *MockBucket {
+	fqn := config.FullyQualifiedName(namespace, name)
+	bf.Lock()
+	bucket := bf.buckets[fqn]
+	bf.Unlock()
+	if bucket == nil {
+		panic(fmt.Sprintf("No such bucket %v", fqn))
+	}
+	return bucket
+}
+
+// behavior returns the behavior of a bucket, creating it if need be.
+func (bf *MockBucketFactory) behavior(namespace, name string) *behavior {
+	fqn := config.FullyQualifiedName(namespace, name)
+	bf.Lock()
+	defer bf.Unlock()
+
+	if bf.behaviors == nil {
+		bf.behaviors = make(map[string]*behavior)
+	}
+
+	b := bf.behaviors[fqn]
+	if b == nil {
+		b = &behavior{}
+		bf.behaviors[fqn] = b
+	}
+
+	return b
+}
+
+func (bf *MockBucketFactory) Init(cfg *pbconfig.ServiceConfig) {}
+func (bf *MockBucketFactory) Client() interface{}              { return nil }
+func (bf *MockBucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	b := &MockBucket{
+		namespace:  namespace,
+		bucketName: bucketName,
+		dyn:        dyn,
+		cfg:        cfg,
+		behavior:   bf.behavior(namespace, bucketName),
+	}
+
+	bf.Lock()
+	defer bf.Unlock()
+	if bf.buckets == nil {
+		bf.buckets = make(map[string]*MockBucket)
+	}
+
+	if bf.SimulateFailure {
+		// Fails this bucket, and its later instances, whatever its behavior.
+		b.behavior = &behavior{err: ErrSimulatedFailure}
+	}
+
+	bf.buckets[config.FullyQualifiedName(namespace, bucketName)] = b
+	return b
+}
+
+// MockEmitter collects the events emitted by a bucket container into Events, if set.
+type MockEmitter struct {
+	Events chan events.Event
+}
+
+func (m *MockEmitter) Emit(e events.Event) {
+	if m.Events != nil {
+		m.Events <- e
+	}
+}
+
+var _ quotaservice.RpcEndpoint = (*MockEndpoint)(nil)
+
+// MockEndpoint is an endpoint that serves nothing, but keeps the QuotaService it is initialized
+// with, so that tests can call the server directly.
+type MockEndpoint struct {
+	QuotaService quotaservice.QuotaService
+}
+
+func (d *MockEndpoint) Init(qs quotaservice.QuotaService) {
+	d.QuotaService = qs
+}
+func (d *MockEndpoint) Start() {}
+func (d *MockEndpoint) Stop()  {}
+
+// NewReaperConfig creates a reaper config that reaps idle buckets more often than is sensible in
+// production, so that tests needn't wait long for buckets to be reaped.
+func NewReaperConfig() config.ReaperConfig {
+	r := config.NewReaperConfig()
+	r.MinFrequency = 100 * time.Millisecond
+	r.InitSleep = 100 * time.Millisecond
+	return r
+}
@@ -0,0 +1,75 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package testing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice"
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestScriptedTakes(t *testing.T) {
+	bf := &MockBucketFactory{}
+	failure := errors.New("failed")
+
+	// Behavior may be set before buckets are created.
+	bf.SetWaitTime("ns", "b", time.Second)
+	bf.Script("ns", "b", Wait(0), Fail(failure), Wait(time.Hour))
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+
+	expectTake(t, b, 0, true, nil)
+	expectTake(t, b, 0, false, failure)
+	expectTake(t, b, 0, false, nil)
+	expectTake(t, b, time.Second, true, nil)
+
+	if taken := bf.Taken("ns", "b"); taken != 2 {
+		t.Fatalf("Expected 2 tokens to be taken, got %v", taken)
+	}
+}
+
+func TestSetError(t *testing.T) {
+	bf := &MockBucketFactory{}
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+	other := bf.NewBucket("ns", "other", config.NewDefaultBucketConfig("other"), false)
+
+	failure := errors.New("failed")
+	bf.SetError("ns", "b", failure)
+	expectTake(t, b, 0, false, failure)
+	if err := b.Charge(context.Background(), 1); err != failure {
+		t.Fatalf("Expected Charge to fail, got %v", err)
+	}
+
+	// Only the bucket set to fail does.
+	expectTake(t, other, 0, true, nil)
+
+	// Behavior outlives buckets recreated when configs change.
+	b = bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+	expectTake(t, b, 0, false, failure)
+
+	bf.SetError("ns", "b", nil)
+	expectTake(t, b, 0, true, nil)
+}
+
+func TestSimulateFailure(t *testing.T) {
+	bf := &MockBucketFactory{SimulateFailure: true}
+	b := bf.NewBucket("ns", "b", config.NewDefaultBucketConfig("b"), false)
+	expectTake(t, b, 0, false, ErrSimulatedFailure)
+
+	helpers.ExpectingPanic(t, func() {
+		bf.Charged("ns", "nonexistent")
+	})
+}
+
+func expectTake(t *testing.T, b quotaservice.Bucket, wait time.Duration, granted bool, err error) {
+	t.Helper()
+	w, ok, e := b.Take(context.Background(), 1, time.Minute)
+	if w != wait || ok != granted || e != err {
+		t.Fatalf("Expected Take to return (%v, %v, %v), got (%v, %v, %v)", wait, granted, err, w, ok, e)
+	}
+}
@@ -0,0 +1,124 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+)
+
+const defaultTokenSnapshotTopN = 10
+
+// bucketActivity counts requests to a bucket since the last token snapshot.
+type bucketActivity struct {
+	namespace, name string
+	bucket          Bucket
+	requests        int64
+}
+
+// tokenSnapshotter counts requests to each bucket, and periodically emits EVENT_TOKEN_SNAPSHOT
+// events with the tokens held by the buckets that saw the most requests since the last snapshot.
+// Only buckets that implement TokenInspector are snapshotted.
+type tokenSnapshotter struct {
+	interval time.Duration
+	topN     int
+	activity map[string]*bucketActivity
+	sync.Mutex
+}
+
+func newTokenSnapshotter(interval time.Duration, topN int) *tokenSnapshotter {
+	if topN < 1 {
+		topN = defaultTokenSnapshotTopN
+	}
+
+	return &tokenSnapshotter{
+		interval: interval,
+		topN:     topN,
+		activity: make(map[string]*bucketActivity)}
+}
+
+// record counts a request to a bucket, identified by the namespace and name requested.
+func (t *tokenSnapshotter) record(namespace, name string, b Bucket) {
+	if _, ok := b.(TokenInspector); !ok {
+		return
+	}
+
+	key := namespace + ":" + name
+	t.Lock()
+	defer t.Unlock()
+
+	if a, exists := t.activity[key]; exists {
+		// The bucket may have been replaced, e.g. by a config change.
+		a.bucket = b
+		a.requests++
+		return
+	}
+
+	t.activity[key] = &bucketActivity{namespace: namespace, name: name, bucket: b, requests: 1}
+}
+
+// mostActive returns up to topN buckets that saw the most requests since it was last called,
+// busiest first, and resets the counts.
+func (t *tokenSnapshotter) mostActive() []*bucketActivity {
+	t.Lock()
+	activity := t.activity
+	t.activity = make(map[string]*bucketActivity)
+	t.Unlock()
+
+	active := make([]*bucketActivity, 0, len(activity))
+	for _, a := range activity {
+		active = append(active, a)
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].requests != active[j].requests {
+			return active[i].requests > active[j].requests
+		}
+
+		return active[i].namespace+":"+active[i].name < active[j].namespace+":"+active[j].name
+	})
+
+	if len(active) > t.topN {
+		active = active[:t.topN]
+	}
+
+	return active
+}
+
+// snapshot emits an EVENT_TOKEN_SNAPSHOT event for each of the most active buckets.
+func (t *tokenSnapshotter) snapshot(n notifier) {
+	for _, a := range t.mostActive() {
+		ctx, cancel := context.WithTimeout(context.Background(), t.interval)
+		tokens, err := a.bucket.(TokenInspector).Tokens(ctx)
+		cancel()
+
+		if err == ErrNotSupported {
+			continue
+		} else if err != nil {
+			logging.Printf("Unable to snapshot tokens of bucket %v:%v: %v", a.namespace, a.name, err)
+			continue
+		}
+
+		n.Emit(events.NewTokenSnapshotEvent(a.namespace, a.name, a.bucket.Dynamic(), tokens))
+	}
+}
+
+func (t *tokenSnapshotter) run(n notifier, stop <-chan struct{}) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.snapshot(n)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestTokenSnapshots(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	nsc := config.NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("busy")))
+	helpers.CheckError(t, config.AddBucket(nsc, config.NewDefaultBucketConfig("quiet")))
+	helpers.CheckError(t, config.AddNamespace(cfg, nsc))
+
+	bf := NewMockBucketFactory()
+	s := New(bf, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, NewMockEndpoint()).(*server)
+	snapshots := make(chan events.Event, 10)
+	s.SetListener(func(e events.Event) {
+		if e.EventType() == events.EVENT_TOKEN_SNAPSHOT {
+			snapshots <- e
+		}
+	}, 100)
+	s.SetTokenSnapshots(10*time.Millisecond, 1)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	helpers.CheckError(t, s.Charge(context.Background(), "ns", "busy", 0, 5))
+	for i := 0; i < 3; i++ {
+		_, _, err := s.Allow(context.Background(), "ns", "busy", 1, 0, false)
+		helpers.CheckError(t, err)
+	}
+	_, _, err = s.Allow(context.Background(), "ns", "quiet", 1, 0, false)
+	helpers.CheckError(t, err)
+
+	select {
+	case e := <-snapshots:
+		size := config.NewDefaultBucketConfig("").GetSize()
+		if e.Namespace() != "ns" || e.BucketName() != "busy" || e.NumTokens() != size-5 {
+			t.Fatalf("Expected a snapshot of the busiest bucket, got %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a token snapshot")
+	}
+
+	select {
+	case e := <-snapshots:
+		t.Fatalf("Expected a single snapshot of the top bucket, got %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTokenSnapshotterMostActive(t *testing.T) {
+	ts := newTokenSnapshotter(time.Minute, 2)
+	bf := NewMockBucketFactory()
+	for name, requests := range map[string]int{"a": 1, "b": 3, "c": 2} {
+		b := bf.NewBucket("ns", name, config.NewDefaultBucketConfig(name), false)
+		for i := 0; i < requests; i++ {
+			ts.record("ns", name, b)
+		}
+	}
+
+	active := ts.mostActive()
+	if len(active) != 2 || active[0].name != "b" || active[0].requests != 3 || active[1].name != "c" {
+		t.Fatalf("Unexpected most active buckets %+v", active)
+	}
+
+	if active := ts.mostActive(); len(active) != 0 {
+		t.Fatalf("Expected activity to be reset, got %+v", active)
+	}
+}
@@ -0,0 +1,83 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package usage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Encoder writes rows in a file format warehouses load.
+type Encoder func(w io.Writer, rows []*Row) error
+
+// EncodeJSON writes rows as newline delimited JSON, which BigQuery and other warehouses load as is,
+// e.g. with "bq load --source_format=NEWLINE_DELIMITED_JSON".
+func EncodeJSON(w io.Writer, rows []*Row) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// fileName names a file of rows after the time it is written, e.g.
+// usage-20060102T150405.000000000Z.json.
+func fileName(ext string) string {
+	return fmt.Sprintf("usage-%v.%v", time.Now().UTC().Format("20060102T150405.000000000Z"), ext)
+}
+
+type fileSink struct {
+	dir    string
+	ext    string
+	encode Encoder
+}
+
+// NewJSONFileSink creates a Sink writing each batch of rows to a new file in dir, as newline
+// delimited JSON. Files are named after the time they are written,
+// usage-20060102T150405.000000000Z.json, and appear complete, so that they can be shipped to
+// object storage as they appear.
+func NewJSONFileSink(dir string) Sink {
+	return &fileSink{dir: dir, ext: "json", encode: EncodeJSON}
+}
+
+// NewParquetFileSink creates a Sink writing each batch of rows to a new Parquet file in dir, named
+// as with NewJSONFileSink.
+func NewParquetFileSink(dir string) Sink {
+	return &fileSink{dir: dir, ext: "parquet", encode: EncodeParquet}
+}
+
+func (s *fileSink) Write(_ context.Context, rows []*Row) (err error) {
+	// Write to a temporary file, renamed once complete.
+	f, err := ioutil.TempFile(s.dir, ".usage-*."+s.ext)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err = s.encode(f, rows); err != nil {
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(s.dir, fileName(s.ext)))
+}
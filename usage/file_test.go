@@ -0,0 +1,78 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package usage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/test/helpers"
+)
+
+func TestJSONFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usage")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []*Row{
+		{Start: start, End: start.Add(time.Minute), Namespace: "ns", Bucket: "a", Requests: 2, Granted: 2, Tokens: 4,
+			Labels: map[string]string{"team": "quota"}},
+		{Start: start, End: start.Add(time.Minute), Namespace: "ns", Bucket: "b", Requests: 1, Denied: 1}}
+	helpers.CheckError(t, NewJSONFileSink(dir).Write(context.Background(), rows))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	helpers.CheckError(t, err)
+	if len(files) != 1 || filepath.Ext(files[0]) != ".json" || filepath.Base(files[0])[:6] != "usage-" {
+		t.Fatalf("Expected a single usage file, got %v", files)
+	}
+
+	f, err := os.Open(files[0])
+	helpers.CheckError(t, err)
+	defer func() { _ = f.Close() }()
+
+	var read []*Row
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		row := &Row{}
+		helpers.CheckError(t, json.Unmarshal(scanner.Bytes(), row))
+		read = append(read, row)
+	}
+
+	if !reflect.DeepEqual(read, rows) {
+		t.Fatalf("Expected a row per line, got %+v", read)
+	}
+
+	if err := NewJSONFileSink(filepath.Join(dir, "missing")).Write(context.Background(), rows); err == nil {
+		t.Fatal("Expected an error writing to a missing directory")
+	}
+}
+
+func TestParquetFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usage")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []*Row{
+		{Start: start, End: start.Add(time.Minute), Namespace: "ns", Bucket: "a", Dynamic: true, Tokens: 4},
+		{Start: start, End: start.Add(time.Minute), Namespace: "ns", Bucket: "b"}}
+	helpers.CheckError(t, NewParquetFileSink(dir).Write(context.Background(), rows))
+
+	files, err := filepath.Glob(filepath.Join(dir, "usage-*.parquet"))
+	helpers.CheckError(t, err)
+	if len(files) != 1 {
+		t.Fatalf("Expected a single usage file, got %v", files)
+	}
+
+	b, err := ioutil.ReadFile(files[0])
+	helpers.CheckError(t, err)
+	checkParquet(t, b, rows)
+}
@@ -0,0 +1,291 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package usage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+)
+
+// Parquet physical types, converted types and other enums, from parquet.thrift.
+const (
+	parquetBoolean   int32 = 0
+	parquetInt64     int32 = 2
+	parquetByteArray int32 = 6
+
+	parquetConvertedUTF8            int32 = 0
+	parquetConvertedTimestampMillis int32 = 9
+
+	parquetRequired int32 = 0
+
+	parquetEncodingPlain int32 = 0
+	parquetEncodingRLE   int32 = 3
+
+	parquetPageData      int32 = 0
+	parquetUncompressed  int32 = 0
+	parquetFormatVersion int32 = 1
+)
+
+const parquetMagic = "PAR1"
+
+// parquetColumn is a column of the Row schema, with the PLAIN encoding of a row's value.
+type parquetColumn struct {
+	name          string
+	physicalType  int32
+	convertedType int32 // -1 if none
+	encode        func(buf *bytes.Buffer, row *Row)
+}
+
+func int64Column(name string, value func(row *Row) int64) parquetColumn {
+	return parquetColumn{name, parquetInt64, -1, func(buf *bytes.Buffer, row *Row) {
+		_ = binary.Write(buf, binary.LittleEndian, value(row))
+	}}
+}
+
+func timestampColumn(name string, value func(row *Row) int64) parquetColumn {
+	c := int64Column(name, value)
+	c.convertedType = parquetConvertedTimestampMillis
+	return c
+}
+
+func stringColumn(name string, value func(row *Row) string) parquetColumn {
+	return parquetColumn{name, parquetByteArray, parquetConvertedUTF8, func(buf *bytes.Buffer, row *Row) {
+		s := value(row)
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}}
+}
+
+// boolColumn's values are bit-packed, so they are encoded together rather than a row at a time.
+func boolColumn(name string) parquetColumn {
+	return parquetColumn{name: name, physicalType: parquetBoolean, convertedType: -1}
+}
+
+var parquetColumns = []parquetColumn{
+	stringColumn("server", func(row *Row) string { return row.Server }),
+	timestampColumn("start", func(row *Row) int64 { return row.Start.UnixNano() / 1e6 }),
+	timestampColumn("end", func(row *Row) int64 { return row.End.UnixNano() / 1e6 }),
+	stringColumn("namespace", func(row *Row) string { return row.Namespace }),
+	stringColumn("bucket", func(row *Row) string { return row.Bucket }),
+	boolColumn("dynamic"),
+	int64Column("requests", func(row *Row) int64 { return row.Requests }),
+	int64Column("granted", func(row *Row) int64 { return row.Granted }),
+	int64Column("denied", func(row *Row) int64 { return row.Denied }),
+	int64Column("tokens", func(row *Row) int64 { return row.Tokens }),
+	int64Column("wait_millis", func(row *Row) int64 { return row.WaitMillis }),
+	stringColumn("labels", labelsJSON),
+}
+
+// labelsJSON encodes a row's labels as a JSON object, since labels are arbitrary.
+func labelsJSON(row *Row) string {
+	if len(row.Labels) == 0 {
+		return "{}"
+	}
+
+	b, _ := json.Marshal(row.Labels)
+	return string(b)
+}
+
+// EncodeParquet writes rows as a Parquet file, with a single uncompressed row group and a column
+// per Row field, named as in JSON. Times are millisecond timestamps.
+func EncodeParquet(w io.Writer, rows []*Row) error {
+	file := &bytes.Buffer{}
+	file.WriteString(parquetMagic)
+
+	type chunk struct {
+		offset, size int64
+	}
+	chunks := make([]chunk, len(parquetColumns))
+
+	for i, col := range parquetColumns {
+		data := &bytes.Buffer{}
+		if col.encode == nil {
+			// Booleans are bit-packed, least significant bit first.
+			packed := make([]byte, (len(rows)+7)/8)
+			for j, row := range rows {
+				if row.Dynamic {
+					packed[j/8] |= 1 << uint(j%8)
+				}
+			}
+			data.Write(packed)
+		} else {
+			for _, row := range rows {
+				col.encode(data, row)
+			}
+		}
+
+		// All columns are required, so pages have no repetition or definition levels.
+		header := &compactWriter{}
+		header.i32Field(1, parquetPageData)
+		header.i32Field(2, int32(data.Len()))
+		header.i32Field(3, int32(data.Len()))
+		header.structField(5)
+		header.i32Field(1, int32(len(rows)))
+		header.i32Field(2, parquetEncodingPlain)
+		header.i32Field(3, parquetEncodingRLE)
+		header.i32Field(4, parquetEncodingRLE)
+		header.endStruct()
+		header.endStruct()
+
+		chunks[i] = chunk{int64(file.Len()), int64(header.buf.Len() + data.Len())}
+		file.Write(header.buf.Bytes())
+		file.Write(data.Bytes())
+	}
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+
+	meta := &compactWriter{}
+	meta.i32Field(1, parquetFormatVersion)
+
+	// The schema is a root element followed by a leaf per column.
+	meta.listField(2, compactStruct, len(parquetColumns)+1)
+	meta.beginStruct()
+	meta.stringField(4, "usage")
+	meta.i32Field(5, int32(len(parquetColumns)))
+	meta.endStruct()
+	for _, col := range parquetColumns {
+		meta.beginStruct()
+		meta.i32Field(1, col.physicalType)
+		meta.i32Field(3, parquetRequired)
+		meta.stringField(4, col.name)
+		if col.convertedType >= 0 {
+			meta.i32Field(6, col.convertedType)
+		}
+		meta.endStruct()
+	}
+
+	meta.i64Field(3, int64(len(rows)))
+
+	meta.listField(4, compactStruct, 1)
+	meta.beginStruct()
+	meta.listField(1, compactStruct, len(parquetColumns))
+	for i, col := range parquetColumns {
+		meta.beginStruct()
+		meta.i64Field(2, chunks[i].offset)
+		meta.structField(3)
+		meta.i32Field(1, col.physicalType)
+		meta.listField(2, compactI32, 2)
+		meta.i32(parquetEncodingPlain)
+		meta.i32(parquetEncodingRLE)
+		meta.listField(3, compactBinary, 1)
+		meta.string(col.name)
+		meta.i32Field(4, parquetUncompressed)
+		meta.i64Field(5, int64(len(rows)))
+		meta.i64Field(6, chunks[i].size)
+		meta.i64Field(7, chunks[i].size)
+		meta.i64Field(9, chunks[i].offset)
+		meta.endStruct()
+		meta.endStruct()
+	}
+	meta.i64Field(2, total)
+	meta.i64Field(3, int64(len(rows)))
+	meta.endStruct()
+
+	meta.stringField(6, "quotaservice")
+	meta.endStruct()
+
+	file.Write(meta.buf.Bytes())
+	_ = binary.Write(file, binary.LittleEndian, uint32(meta.buf.Len()))
+	file.WriteString(parquetMagic)
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// Thrift compact protocol types.
+const (
+	compactI32    byte = 5
+	compactI64    byte = 6
+	compactBinary byte = 8
+	compactList   byte = 9
+	compactStruct byte = 12
+)
+
+// compactWriter writes the Thrift compact protocol Parquet metadata is encoded in. Fields must be
+// written in increasing order of ID within each struct.
+type compactWriter struct {
+	buf bytes.Buffer
+	// lastIDs holds the ID of the last field written in each enclosing struct.
+	lastIDs []int16
+	lastID  int16
+}
+
+func (w *compactWriter) fieldHeader(id int16, t byte) {
+	if delta := id - w.lastID; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | t)
+	} else {
+		w.buf.WriteByte(t)
+		w.varint(uint64(uint16(id)<<1 ^ uint16(id>>15)))
+	}
+	w.lastID = id
+}
+
+func (w *compactWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *compactWriter) i32(v int32) {
+	w.varint(uint64(uint32(v<<1 ^ v>>31)))
+}
+
+func (w *compactWriter) i64(v int64) {
+	w.varint(uint64(v<<1 ^ v>>63))
+}
+
+func (w *compactWriter) string(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *compactWriter) i32Field(id int16, v int32) {
+	w.fieldHeader(id, compactI32)
+	w.i32(v)
+}
+
+func (w *compactWriter) i64Field(id int16, v int64) {
+	w.fieldHeader(id, compactI64)
+	w.i64(v)
+}
+
+func (w *compactWriter) stringField(id int16, s string) {
+	w.fieldHeader(id, compactBinary)
+	w.string(s)
+}
+
+// listField starts a list of size elements of type t, which are written without field headers.
+func (w *compactWriter) listField(id int16, t byte, size int) {
+	w.fieldHeader(id, compactList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | t)
+	} else {
+		w.buf.WriteByte(0xf0 | t)
+		w.varint(uint64(size))
+	}
+}
+
+// structField starts a struct field, ended with endStruct.
+func (w *compactWriter) structField(id int16) {
+	w.fieldHeader(id, compactStruct)
+	w.beginStruct()
+}
+
+// beginStruct starts a struct that is an element of a list, or the top-level struct.
+func (w *compactWriter) beginStruct() {
+	w.lastIDs = append(w.lastIDs, w.lastID)
+	w.lastID = 0
+}
+
+func (w *compactWriter) endStruct() {
+	w.buf.WriteByte(0)
+	if n := len(w.lastIDs); n > 0 {
+		w.lastID = w.lastIDs[n-1]
+		w.lastIDs = w.lastIDs[:n-1]
+	}
+}
@@ -0,0 +1,83 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package usage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/test/helpers"
+)
+
+// checkParquet checks that b is framed as a Parquet file, with rows' values in its column chunks.
+func checkParquet(t *testing.T, b []byte, rows []*Row) {
+	t.Helper()
+
+	n := len(b)
+	if n < 12 || string(b[:4]) != parquetMagic || string(b[n-4:]) != parquetMagic {
+		t.Fatalf("Expected a Parquet file, got %q", b)
+	}
+
+	metaLen := int(binary.LittleEndian.Uint32(b[n-8 : n-4]))
+	if metaLen <= 0 || metaLen > n-12 {
+		t.Fatalf("Invalid metadata length %v in a file of %v bytes", metaLen, n)
+	}
+
+	data := b[4 : n-8-metaLen]
+	for _, row := range rows {
+		for _, s := range []string{row.Namespace, row.Bucket} {
+			value := &bytes.Buffer{}
+			_ = binary.Write(value, binary.LittleEndian, uint32(len(s)))
+			value.WriteString(s)
+			if !bytes.Contains(data, value.Bytes()) {
+				t.Fatalf("Expected %q in the column chunks", s)
+			}
+		}
+	}
+
+	for _, col := range parquetColumns {
+		if !bytes.Contains(b[n-8-metaLen:n-8], []byte(col.name)) {
+			t.Fatalf("Expected column %v in the schema", col.name)
+		}
+	}
+}
+
+func TestEncodeParquet(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	var rows []*Row
+	for i := 0; i < 20; i++ {
+		rows = append(rows, &Row{Server: "qs-1", Start: start, End: start.Add(time.Minute), Namespace: "ns",
+			Bucket: string(rune('a' + i)), Dynamic: i%3 == 0, Requests: int64(i)})
+	}
+
+	buf := &bytes.Buffer{}
+	helpers.CheckError(t, EncodeParquet(buf, rows))
+	checkParquet(t, buf.Bytes(), rows)
+}
+
+func TestCompactWriter(t *testing.T) {
+	w := &compactWriter{}
+	w.i32Field(1, -1)
+	w.i64Field(2, 300)
+	w.stringField(20, "ab")
+	w.structField(21)
+	w.i32Field(1, 0)
+	w.endStruct()
+	w.listField(22, compactI32, 1)
+	w.i32(1)
+	w.endStruct()
+
+	expected := []byte{
+		0x15, 0x01, // field 1, i32 -1
+		0x16, 0xd8, 0x04, // field 2, i64 300
+		0x08, 0x28, 0x02, 'a', 'b', // field 20, long form, binary "ab"
+		0x1c, 0x15, 0x00, 0x00, // field 21, struct with field 1, i32 0
+		0x19, 0x15, 0x02, // field 22, list of 1 i32, 1
+		0x00}
+	if !bytes.Equal(w.buf.Bytes(), expected) {
+		t.Fatalf("Expected % x, got % x", expected, w.buf.Bytes())
+	}
+}
@@ -0,0 +1,175 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package usage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3 sink.
+type S3Config struct {
+	// Bucket and Region rows are uploaded to, under Prefix, e.g. "usage/".
+	Bucket string
+	Region string
+	Prefix string
+	// Endpoint is the S3 API's base URL. Defaults to https://s3.<region>.amazonaws.com; set it to
+	// use an S3-compatible store. Objects are addressed by path, as <endpoint>/<bucket>/<key>.
+	Endpoint string
+	// Credentials requests are signed with. SessionToken is only needed for temporary credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Encoder writes the objects uploaded, and Extension names them. Defaults to Parquet.
+	Encoder   Encoder
+	Extension string
+	// Client makes requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// NewS3Config creates an S3Config uploading Parquet files to bucket, with credentials from the
+// standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func NewS3Config(bucket, region string) S3Config {
+	return S3Config{
+		Bucket:          bucket,
+		Region:          region,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN")}
+}
+
+type s3Sink struct {
+	cfg S3Config
+	now func() time.Time
+}
+
+// NewS3Sink creates a Sink uploading each batch of rows to a new S3 object, named as files of
+// NewJSONFileSink are, from which warehouses such as Athena, Redshift Spectrum and BigQuery load
+// them.
+func NewS3Sink(cfg S3Config) Sink {
+	if cfg.Bucket == "" || cfg.Region == "" {
+		panic("A bucket and region are required")
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://s3.%v.amazonaws.com", cfg.Region)
+	}
+
+	if cfg.Encoder == nil {
+		cfg.Encoder, cfg.Extension = EncodeParquet, "parquet"
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	return &s3Sink{cfg: cfg, now: time.Now}
+}
+
+func (s *s3Sink) Write(ctx context.Context, rows []*Row) error {
+	body := &bytes.Buffer{}
+	if err := s.cfg.Encoder(body, rows); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(s.cfg.Endpoint, "/"))
+	if err != nil {
+		return err
+	}
+	u.Path += "/" + s.cfg.Bucket + "/" + s.cfg.Prefix + fileName(s.cfg.Extension)
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	s.sign(req, body.Bytes())
+	resp, err := s.cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("S3 upload to %v failed with %v: %s", u, resp.Status, msg)
+	}
+
+	return nil
+}
+
+// sign signs req with AWS Signature Version 4.
+func (s *s3Sink) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		req.Header.Get("X-Amz-Date"),
+		scope,
+		sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + s.cfg.SecretAccessKey)
+	for _, part := range []string{date, s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		s.cfg.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
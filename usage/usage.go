@@ -0,0 +1,233 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package usage aggregates each bucket's usage over intervals, and periodically exports the
+// aggregated rows to a warehouse for long-term capacity analysis and chargeback reporting. Sinks
+// are pluggable; the file sinks write JSON or Parquet files that warehouses such as BigQuery load
+// directly, and the S3 sink uploads Parquet files to S3.
+package usage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+)
+
+// Row is a bucket's usage over an interval.
+type Row struct {
+	// Server identifies the server that recorded the row, so that rows from a fleet can be told
+	// apart.
+	Server    string    `json:"server,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Namespace string    `json:"namespace"`
+	Bucket    string    `json:"bucket"`
+	Dynamic   bool      `json:"dynamic"`
+	// Requests is the number of requests for tokens, Granted the number granted, and Denied the
+	// number that timed out or asked for too many tokens.
+	Requests int64 `json:"requests"`
+	Granted  int64 `json:"granted"`
+	Denied   int64 `json:"denied"`
+	// Tokens is the number of tokens granted, and WaitMillis the time granted requests waited for
+	// them in total.
+	Tokens     int64 `json:"tokens"`
+	WaitMillis int64 `json:"wait_millis"`
+	// Labels attribute the bucket's usage, e.g. to a team or cost center.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Sink writes rows to a warehouse.
+type Sink interface {
+	Write(ctx context.Context, rows []*Row) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, rows []*Row) error
+
+func (f SinkFunc) Write(ctx context.Context, rows []*Row) error {
+	return f(ctx, rows)
+}
+
+// Config configures an Exporter.
+type Config struct {
+	// Server is recorded in each row.
+	Server string
+	// Interval is the period rows aggregate usage over, and how often they are written.
+	Interval time.Duration
+	// Timeout bounds each write to the sink.
+	Timeout time.Duration
+	// MaxBufferedRows is the number of rows kept to retry after failed writes. The oldest are
+	// dropped first.
+	MaxBufferedRows int
+}
+
+// NewDefaultConfig creates a Config writing rows every 5 minutes, with writes timing out after 30
+// seconds, and keeping up to 100,000 rows while the sink is unavailable.
+func NewDefaultConfig() Config {
+	return Config{
+		Interval:        5 * time.Minute,
+		Timeout:         30 * time.Second,
+		MaxBufferedRows: 100000}
+}
+
+// Status reports on an Exporter's writes.
+type Status struct {
+	// Writes is the number of writes to the sink, and WriteErrors those that failed.
+	Writes      int64
+	WriteErrors int64
+	// RowsWritten is the number of rows written, and RowsDropped those dropped after failed writes.
+	RowsWritten int64
+	RowsDropped int64
+}
+
+type bucketKey struct {
+	namespace, bucket string
+}
+
+// Exporter aggregates usage from bucket events, and writes it to a Sink every interval.
+type Exporter struct {
+	// Counters for Status, accessed atomically. These come first for 64-bit alignment.
+	writes      int64
+	writeErrors int64
+	rowsWritten int64
+	rowsDropped int64
+	sink        Sink
+	cfg         Config
+	start       time.Time
+	current     map[bucketKey]*Row
+	// buffered holds rows whose write failed. It is only accessed by the flusher.
+	buffered []*Row
+	stop     chan struct{}
+	done     chan struct{}
+	closer   sync.Once
+	sync.Mutex
+}
+
+// NewExporter creates an Exporter writing to sink, and starts its flusher.
+func NewExporter(sink Sink, cfg Config) *Exporter {
+	if sink == nil {
+		panic("A sink is required")
+	}
+
+	if cfg.Interval <= 0 || cfg.Timeout <= 0 || cfg.MaxBufferedRows < 0 {
+		panic("Interval and Timeout must be positive, and MaxBufferedRows can't be negative")
+	}
+
+	e := &Exporter{
+		sink:    sink,
+		cfg:     cfg,
+		start:   time.Now(),
+		current: make(map[bucketKey]*Row),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{})}
+
+	go e.flusher()
+	return e
+}
+
+// HandleEvent records a request's use of a bucket.
+func (e *Exporter) HandleEvent(event events.Event) {
+	switch event.EventType() {
+	case events.EVENT_TOKENS_SERVED, events.EVENT_TIMEOUT_SERVING_TOKENS, events.EVENT_TOO_MANY_TOKENS_REQUESTED:
+	default:
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	k := bucketKey{event.Namespace(), event.BucketName()}
+	row := e.current[k]
+	if row == nil {
+		row = &Row{Namespace: k.namespace, Bucket: k.bucket, Dynamic: event.Dynamic(), Labels: events.LabelsOf(event)}
+		e.current[k] = row
+	}
+
+	row.Requests++
+	if event.EventType() == events.EVENT_TOKENS_SERVED {
+		row.Granted++
+		row.Tokens += event.NumTokens()
+		row.WaitMillis += int64(event.WaitTime() / time.Millisecond)
+	} else {
+		row.Denied++
+	}
+}
+
+// Status reports on the Exporter's writes so far.
+func (e *Exporter) Status() Status {
+	return Status{
+		Writes:      atomic.LoadInt64(&e.writes),
+		WriteErrors: atomic.LoadInt64(&e.writeErrors),
+		RowsWritten: atomic.LoadInt64(&e.rowsWritten),
+		RowsDropped: atomic.LoadInt64(&e.rowsDropped)}
+}
+
+func (e *Exporter) flusher() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			e.flush(time.Now())
+			return
+		case now := <-ticker.C:
+			e.flush(now)
+		}
+	}
+}
+
+// flush closes the current interval, and writes its rows along with any buffered from failed
+// writes.
+func (e *Exporter) flush(now time.Time) {
+	e.Lock()
+	rows := e.buffered
+	for _, row := range e.current {
+		row.Server = e.cfg.Server
+		row.Start = e.start
+		row.End = now
+		rows = append(rows, row)
+	}
+
+	e.current = make(map[bucketKey]*Row)
+	e.start = now
+	e.Unlock()
+
+	if len(rows) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+	defer cancel()
+
+	atomic.AddInt64(&e.writes, 1)
+	if err := e.sink.Write(ctx, rows); err != nil {
+		atomic.AddInt64(&e.writeErrors, 1)
+		total := len(rows)
+		if dropped := total - e.cfg.MaxBufferedRows; dropped > 0 {
+			rows = rows[dropped:]
+			atomic.AddInt64(&e.rowsDropped, int64(dropped))
+		}
+
+		logging.Printf("Unable to write %v usage rows, keeping %v to retry: %v", total, len(rows), err)
+		e.buffered = rows
+		return
+	}
+
+	atomic.AddInt64(&e.rowsWritten, int64(len(rows)))
+	e.buffered = nil
+}
+
+// Close writes usage recorded since the last write, and stops the flusher.
+func (e *Exporter) Close() {
+	e.closer.Do(func() {
+		close(e.stop)
+		<-e.done
+	})
+}
@@ -0,0 +1,114 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package usage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+// recordingSink records the rows written, failing while failing is set.
+type recordingSink struct {
+	sync.Mutex
+	failing bool
+	rows    []*Row
+}
+
+func (s *recordingSink) Write(_ context.Context, rows []*Row) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.failing {
+		return errors.New("unavailable")
+	}
+
+	s.rows = append(s.rows, rows...)
+	return nil
+}
+
+func (s *recordingSink) setFailing(failing bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.failing = failing
+}
+
+func (s *recordingSink) written() []*Row {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*Row(nil), s.rows...)
+}
+
+func newTestExporter(sink Sink) *Exporter {
+	return NewExporter(sink, Config{Server: "qs-1", Interval: time.Hour, Timeout: time.Second, MaxBufferedRows: 1})
+}
+
+func TestAggregation(t *testing.T) {
+	sink := &recordingSink{}
+	e := newTestExporter(sink)
+
+	e.HandleEvent(events.WithLabels(events.NewTokensServedEvent("ns", "b", false, 3, 10*time.Millisecond),
+		map[string]string{"team": "quota"}))
+	e.HandleEvent(events.NewTokensServedEvent("ns", "b", false, 2, 5*time.Millisecond))
+	e.HandleEvent(events.NewTimedOutEvent("ns", "b", false, 1))
+	e.HandleEvent(events.NewTooManyTokensRequestedEvent("ns", "b", false, 100))
+	e.HandleEvent(events.NewBucketMissedEvent("ns", "missing", false))
+	e.Close()
+
+	rows := sink.written()
+	if len(rows) != 1 {
+		t.Fatalf("Expected a row for the bucket used, got %+v", rows)
+	}
+
+	row := rows[0]
+	expected := Row{Server: "qs-1", Start: row.Start, End: row.End, Namespace: "ns", Bucket: "b",
+		Requests: 4, Granted: 2, Denied: 2, Tokens: 5, WaitMillis: 15, Labels: map[string]string{"team": "quota"}}
+	if !reflect.DeepEqual(*row, expected) || row.End.Before(row.Start) {
+		t.Fatalf("Unexpected row %+v", row)
+	}
+
+	if status := e.Status(); status != (Status{Writes: 1, RowsWritten: 1}) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
+
+func TestFailedWritesAreRetried(t *testing.T) {
+	sink := &recordingSink{failing: true}
+	e := newTestExporter(sink)
+	defer e.Close()
+
+	e.HandleEvent(events.NewTokensServedEvent("ns", "a", false, 1, 0))
+	e.flush(time.Now())
+
+	// Only the newest rows are kept, up to MaxBufferedRows.
+	e.HandleEvent(events.NewTokensServedEvent("ns", "b", false, 1, 0))
+	e.HandleEvent(events.NewTokensServedEvent("ns", "c", false, 1, 0))
+	e.flush(time.Now())
+
+	sink.setFailing(false)
+	e.flush(time.Now())
+	if rows := sink.written(); len(rows) != 1 || rows[0].Bucket == "a" {
+		t.Fatalf("Expected a buffered row to be written, got %+v", rows)
+	}
+
+	if status := e.Status(); status != (Status{Writes: 3, WriteErrors: 2, RowsWritten: 1, RowsDropped: 2}) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	helpers.ExpectingPanic(t, func() {
+		NewExporter(nil, NewDefaultConfig())
+	})
+
+	helpers.ExpectingPanic(t, func() {
+		NewExporter(&recordingSink{}, Config{Timeout: time.Second})
+	})
+}
@@ -0,0 +1,319 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package webhooks implements an events.Listener that POSTs bucket events to HTTP endpoints.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/square/quotaservice/alerts"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/logging"
+	pbconfig "github.com/square/quotaservice/protos/config"
+)
+
+const (
+	// SignatureHeader carries the hex-encoded HMAC-SHA256 of the request body, prefixed with "sha256=".
+	SignatureHeader = "X-Quotaservice-Signature"
+
+	// NotificationBucketCreated is sent when a bucket is created.
+	NotificationBucketCreated = "BUCKET_CREATED"
+	// NotificationBucketRemoved is sent when a bucket is removed. Dynamic buckets are removed when
+	// they expire.
+	NotificationBucketRemoved = "BUCKET_REMOVED"
+	// NotificationQuotaExhausted is sent when a bucket rejects at least ExhaustionThreshold requests
+	// within ExhaustionWindow.
+	NotificationQuotaExhausted = "QUOTA_EXHAUSTED"
+	// NotificationThresholdCrossed is sent when the tokens consumed from a bucket within its
+	// notification window cross one of its notification thresholds.
+	NotificationThresholdCrossed = "THRESHOLD_CROSSED"
+	// NotificationAlertFiring is sent when an alerts.Rule is breached.
+	NotificationAlertFiring = "ALERT_FIRING"
+	// NotificationAlertResolved is sent when a breached alerts.Rule is no longer breached.
+	NotificationAlertResolved = "ALERT_RESOLVED"
+)
+
+// Config configures a webhook Listener.
+type Config struct {
+	// URLs that each notification is POSTed to.
+	URLs []string
+	// Secret used to sign request bodies. Requests are not signed if empty.
+	Secret []byte
+	// MaxRetries is the number of times a failed delivery is retried.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry; it doubles with each subsequent retry.
+	RetryBackoff time.Duration
+	// Timeout for each HTTP request.
+	Timeout time.Duration
+	// ExhaustionThreshold is the number of rejected requests on a bucket, within ExhaustionWindow,
+	// that trigger a NotificationQuotaExhausted. Set to 0 to disable.
+	ExhaustionThreshold int64
+	ExhaustionWindow    time.Duration
+	// QueueSize is the number of notifications buffered for each URL before new ones are dropped.
+	QueueSize int
+}
+
+// NewDefaultConfig creates a Config with sensible defaults, posting to the given URLs.
+func NewDefaultConfig(urls ...string) Config {
+	return Config{
+		URLs:                urls,
+		MaxRetries:          3,
+		RetryBackoff:        500 * time.Millisecond,
+		Timeout:             5 * time.Second,
+		ExhaustionThreshold: 100,
+		ExhaustionWindow:    time.Minute,
+		QueueSize:           1000}
+}
+
+// Notification is the JSON payload POSTed to webhook endpoints.
+type Notification struct {
+	Type      string `json:"type"`
+	Namespace string `json:"namespace"`
+	Bucket    string `json:"bucket"`
+	Dynamic   bool   `json:"dynamic"`
+	// Config is the bucket's resolved config, with the settings it inherits from its namespace and
+	// template. Only set for NotificationBucketCreated and NotificationBucketRemoved.
+	Config *pbconfig.BucketConfig `json:"config,omitempty"`
+	// Expired is true if a dynamic bucket was removed after being idle for its max idle time. Only
+	// set for NotificationBucketRemoved.
+	Expired bool `json:"expired,omitempty"`
+	// Rejections is the number of rejected requests within the exhaustion window. Only set for
+	// NotificationQuotaExhausted.
+	Rejections int64 `json:"rejections,omitempty"`
+	// Threshold is the percentage of the bucket's size crossed, and Consumed the tokens consumed
+	// within the notification window. Only set for NotificationThresholdCrossed.
+	Threshold int64 `json:"threshold,omitempty"`
+	Consumed  int64 `json:"consumed,omitempty"`
+	// Rule and Value are only set for alert notifications.
+	Rule      string  `json:"rule,omitempty"`
+	Value     float64 `json:"value,omitempty"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+type exhaustion struct {
+	windowStart time.Time
+	rejections  int64
+	notified    bool
+}
+
+// delivery is a notification queued for delivery, along with its body.
+type delivery struct {
+	n    *Notification
+	body []byte
+}
+
+// Listener consumes events and delivers matching notifications to webhooks. Register its
+// HandleEvent function with Server.SetListener.
+type Listener struct {
+	cfg    Config
+	client *http.Client
+	// queues holds the deliveries to each URL, so that a URL that is slow or down, and retried,
+	// doesn't hold up deliveries to the others.
+	queues      map[string]chan delivery
+	exhaustions map[string]*exhaustion
+	wg          sync.WaitGroup
+	now         func() time.Time
+}
+
+// NewListener creates a Listener and starts a delivery goroutine for each URL.
+func NewListener(cfg Config) (*Listener, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("need at least 1 URL to deliver webhooks to")
+	}
+
+	if cfg.QueueSize < 0 {
+		return nil, errors.New("queue size must not be negative")
+	}
+
+	l := &Listener{
+		cfg:         cfg,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		queues:      make(map[string]chan delivery, len(cfg.URLs)),
+		exhaustions: make(map[string]*exhaustion),
+		now:         time.Now}
+
+	for _, url := range cfg.URLs {
+		if _, exists := l.queues[url]; exists {
+			continue
+		}
+
+		queue := make(chan delivery, cfg.QueueSize)
+		l.queues[url] = queue
+		l.wg.Add(1)
+		go l.deliverAll(url, queue)
+	}
+
+	return l, nil
+}
+
+// HandleEvent is an events.Listener. It is not safe to call concurrently, which is consistent
+// with how the events package notifies listeners.
+func (l *Listener) HandleEvent(e events.Event) {
+	switch e.EventType() {
+	case events.EVENT_BUCKET_CREATED:
+		n := l.newNotification(NotificationBucketCreated, e)
+		n.Config = events.BucketConfigOf(e)
+		l.enqueue(n)
+	case events.EVENT_BUCKET_REMOVED:
+		delete(l.exhaustions, key(e))
+		n := l.newNotification(NotificationBucketRemoved, e)
+		n.Config = events.BucketConfigOf(e)
+		// Dynamic buckets are only removed when they expire.
+		n.Expired = e.Dynamic()
+		l.enqueue(n)
+	case events.EVENT_TIMEOUT_SERVING_TOKENS, events.EVENT_TOO_MANY_TOKENS_REQUESTED:
+		l.recordRejection(e)
+	case events.EVENT_THRESHOLD_CROSSED:
+		n := l.newNotification(NotificationThresholdCrossed, e)
+		n.Threshold = events.ThresholdOf(e)
+		n.Consumed = e.NumTokens()
+		l.enqueue(n)
+	}
+}
+
+// HandleAlert is an alerts.Handler, delivering fired and resolved alerts.
+func (l *Listener) HandleAlert(a *alerts.Alert) {
+	n := &Notification{
+		Type:      NotificationAlertFiring,
+		Namespace: a.Namespace,
+		Bucket:    a.Bucket,
+		Rule:      a.Rule.Name,
+		Value:     a.Value,
+		Timestamp: a.Time.Unix()}
+
+	if a.Resolved {
+		n.Type = NotificationAlertResolved
+	}
+
+	l.enqueue(n)
+}
+
+// Stop stops accepting notifications, and waits for queued notifications to be delivered.
+func (l *Listener) Stop() {
+	for _, queue := range l.queues {
+		close(queue)
+	}
+	l.wg.Wait()
+}
+
+func (l *Listener) recordRejection(e events.Event) {
+	if l.cfg.ExhaustionThreshold <= 0 {
+		return
+	}
+
+	now := l.now()
+	k := key(e)
+	ex, ok := l.exhaustions[k]
+	if !ok || now.Sub(ex.windowStart) > l.cfg.ExhaustionWindow {
+		ex = &exhaustion{windowStart: now}
+		l.exhaustions[k] = ex
+	}
+
+	ex.rejections++
+	if ex.rejections >= l.cfg.ExhaustionThreshold && !ex.notified {
+		// Only notify once per window.
+		ex.notified = true
+		n := l.newNotification(NotificationQuotaExhausted, e)
+		n.Rejections = ex.rejections
+		l.enqueue(n)
+	}
+}
+
+func (l *Listener) newNotification(notificationType string, e events.Event) *Notification {
+	return &Notification{
+		Type:      notificationType,
+		Namespace: e.Namespace(),
+		Bucket:    e.BucketName(),
+		Dynamic:   e.Dynamic(),
+		Timestamp: l.now().Unix()}
+}
+
+func (l *Listener) enqueue(n *Notification) {
+	body, e := json.Marshal(n)
+	if e != nil {
+		logging.Printf("Unable to marshal webhook notification %+v: %v", n, e)
+		return
+	}
+
+	for url, queue := range l.queues {
+		select {
+		case queue <- delivery{n, body}:
+		// OK
+		default:
+			logging.Printf("Webhook queue for %s full; dropping %s notification for %s.%s", url, n.Type, n.Namespace, n.Bucket)
+		}
+	}
+}
+
+// deliverAll delivers the notifications queued for a URL, in order.
+func (l *Listener) deliverAll(url string, queue chan delivery) {
+	defer l.wg.Done()
+
+	for d := range queue {
+		if e := l.deliver(url, d.body); e != nil {
+			logging.Printf("Giving up delivering %s notification for %s.%s to %s: %v", d.n.Type, d.n.Namespace, d.n.Bucket, url, e)
+		}
+	}
+}
+
+func (l *Listener) deliver(url string, body []byte) (err error) {
+	backoff := l.cfg.RetryBackoff
+	for attempt := 0; attempt <= l.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if err = l.post(url, body); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (l *Listener) post(url string, body []byte) error {
+	req, e := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if e != nil {
+		return e
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(l.cfg.Secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(l.cfg.Secret, body))
+	}
+
+	resp, e := l.client.Do(req)
+	if e != nil {
+		return e
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of body using secret. Receivers can use it to
+// verify the SignatureHeader of incoming requests.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func key(e events.Event) string {
+	return e.Namespace() + ":" + e.BucketName()
+}
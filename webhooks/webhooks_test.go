@@ -0,0 +1,187 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package webhooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/quotaservice/config"
+	"github.com/square/quotaservice/events"
+	"github.com/square/quotaservice/test/helpers"
+)
+
+type recorder struct {
+	sync.Mutex
+	failures      int
+	notifications []*Notification
+	signatures    []string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+	n := &Notification{}
+	_ = json.Unmarshal(body, n)
+	r.notifications = append(r.notifications, n)
+	r.signatures = append(r.signatures, req.Header.Get(SignatureHeader))
+}
+
+func newTestListener(url string) *Listener {
+	cfg := NewDefaultConfig(url)
+	cfg.RetryBackoff = time.Millisecond
+	cfg.ExhaustionThreshold = 3
+	cfg.Secret = []byte("secret")
+	l, err := NewListener(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	return l
+}
+
+func TestBucketLifecycleNotifications(t *testing.T) {
+	r := &recorder{}
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	l := newTestListener(ts.URL)
+	cfg := config.NewDefaultBucketConfig("b")
+	l.HandleEvent(events.WithBucketConfig(events.NewBucketCreatedEvent("ns", "b", true), cfg))
+	l.HandleEvent(events.NewTokensServedEvent("ns", "b", true, 1, 0))
+	l.HandleEvent(events.WithBucketConfig(events.NewBucketRemovedEvent("ns", "b", true), cfg))
+	l.Stop()
+
+	if len(r.notifications) != 2 {
+		t.Fatalf("Expected 2 notifications, got %v", len(r.notifications))
+	}
+
+	if r.notifications[0].Type != NotificationBucketCreated || r.notifications[1].Type != NotificationBucketRemoved {
+		t.Fatalf("Unexpected notifications %+v, %+v", r.notifications[0], r.notifications[1])
+	}
+
+	if r.notifications[0].Namespace != "ns" || r.notifications[0].Bucket != "b" || !r.notifications[0].Dynamic {
+		t.Fatalf("Unexpected notification %+v", r.notifications[0])
+	}
+
+	for _, n := range r.notifications {
+		if n.Config.GetSize() != cfg.GetSize() || n.Config.GetFillRate() != cfg.GetFillRate() {
+			t.Fatalf("Expected the bucket's config, got %+v", n.Config)
+		}
+	}
+
+	if r.notifications[0].Expired || !r.notifications[1].Expired {
+		t.Fatalf("Expected only the removed dynamic bucket to have expired, got %+v, %+v", r.notifications[0], r.notifications[1])
+	}
+}
+
+func TestQuotaExhaustedNotification(t *testing.T) {
+	r := &recorder{}
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	l := newTestListener(ts.URL)
+	for i := 0; i < 5; i++ {
+		l.HandleEvent(events.NewTimedOutEvent("ns", "b", false, 1))
+	}
+	l.Stop()
+
+	if len(r.notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %v", len(r.notifications))
+	}
+
+	if r.notifications[0].Type != NotificationQuotaExhausted || r.notifications[0].Rejections != 3 {
+		t.Fatalf("Unexpected notification %+v", r.notifications[0])
+	}
+}
+
+func TestThresholdCrossedNotification(t *testing.T) {
+	r := &recorder{}
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	l := newTestListener(ts.URL)
+	l.HandleEvent(events.NewThresholdCrossedEvent("ns", "b", false, 82, 80))
+	l.Stop()
+
+	if len(r.notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %v", len(r.notifications))
+	}
+
+	if n := r.notifications[0]; n.Type != NotificationThresholdCrossed || n.Threshold != 80 || n.Consumed != 82 {
+		t.Fatalf("Unexpected notification %+v", n)
+	}
+}
+
+func TestRetriesAndSignature(t *testing.T) {
+	r := &recorder{failures: 2}
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	l := newTestListener(ts.URL)
+	l.HandleEvent(events.NewBucketCreatedEvent("ns", "b", false))
+	l.Stop()
+
+	if len(r.notifications) != 1 {
+		t.Fatalf("Expected 1 notification after retries, got %v", len(r.notifications))
+	}
+
+	body, _ := json.Marshal(r.notifications[0])
+	if expected := "sha256=" + Sign([]byte("secret"), body); r.signatures[0] != expected {
+		t.Fatalf("Signature %v != %v", r.signatures[0], expected)
+	}
+}
+
+func TestSlowURLsDontHoldUpOthers(t *testing.T) {
+	failing := httptest.NewServer(&recorder{failures: 1000})
+	defer failing.Close()
+	r := &recorder{}
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	cfg := NewDefaultConfig(failing.URL, ts.URL)
+	cfg.RetryBackoff = time.Hour
+	l, err := NewListener(cfg)
+	helpers.CheckError(t, err)
+
+	l.HandleEvent(events.NewBucketCreatedEvent("ns", "b", false))
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		r.Lock()
+		delivered := len(r.notifications)
+		r.Unlock()
+
+		if delivered == 1 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the notification to be delivered while another URL is retried")
+		}
+	}
+}
+
+func TestNewListenerErrors(t *testing.T) {
+	if _, err := NewListener(NewDefaultConfig()); err == nil {
+		t.Fatal("Expected an error without URLs")
+	}
+
+	cfg := NewDefaultConfig("http://localhost")
+	cfg.QueueSize = -1
+	if _, err := NewListener(cfg); err == nil {
+		t.Fatal("Expected an error with a negative queue size")
+	}
+}